@@ -0,0 +1,94 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/bulkhead/bulkhead"
+)
+
+// slowCall stands in for a call to a dependency that has become slow.
+func slowCall() error {
+	time.Sleep(200 * time.Millisecond)
+	return nil
+}
+
+func fastCall() error {
+	time.Sleep(5 * time.Millisecond)
+	return nil
+}
+
+func main() {
+	// Each dependency gets its own bulkhead: two calls at a time, two more
+	// may wait up to 100ms for a slot.
+	config := bulkhead.Config{MaxConcurrent: 2, MaxQueue: 2, QueueTimeout: 100 * time.Millisecond}
+	slow := bulkhead.New("slow-service", config)
+	fast := bulkhead.New("fast-service", config)
+
+	var wg sync.WaitGroup
+	results := make(chan string, 20)
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			results <- outcome("slow", slow.Execute(context.Background(), slowCall))
+		}()
+		go func() {
+			defer wg.Done()
+			time.Sleep(10 * time.Millisecond)
+			results <- outcome("fast", fast.Execute(context.Background(), fastCall))
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	counts := map[string]int{}
+	for r := range results {
+		counts[r]++
+	}
+	fmt.Println(counts)
+	fmt.Printf("%+v\n%+v\n", slow.Stats(), fast.Stats())
+}
+
+func outcome(name string, err error) string {
+	switch {
+	case err == nil:
+		return name + " ok"
+	case errors.Is(err, bulkhead.ErrFull):
+		return name + " rejected"
+	case errors.Is(err, bulkhead.ErrQueueTimeout):
+		return name + " timed out in queue"
+	}
+	return name + " failed"
+}
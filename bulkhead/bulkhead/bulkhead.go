@@ -0,0 +1,166 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package bulkhead limits how many calls to a dependency may run at once.
+// Like the watertight compartments of a ship, a bulkhead per dependency
+// keeps one slow dependency from tying up every goroutine, connection or
+// worker of the caller.
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrFull is returned when all slots are taken and the queue is full.
+	ErrFull = errors.New("bulkhead: full")
+	// ErrQueueTimeout is returned when a queued call did not get a slot in
+	// time.
+	ErrQueueTimeout = errors.New("bulkhead: timed out waiting for a slot")
+)
+
+// Config sizes a bulkhead.
+type Config struct {
+	// MaxConcurrent is how many calls may run at once (10 if zero).
+	MaxConcurrent int
+	// MaxQueue is how many calls may wait for a slot; more are rejected at
+	// once with ErrFull. Zero means calls never wait.
+	MaxQueue int
+	// QueueTimeout limits how long a call waits for a slot. Zero means it
+	// waits until its context is done.
+	QueueTimeout time.Duration
+}
+
+// Stats are the counters of a bulkhead.
+type Stats struct {
+	Name     string `json:"name"`
+	Active   int    `json:"active"`
+	Queued   int    `json:"queued"`
+	Accepted uint64 `json:"accepted"`
+	Rejected uint64 `json:"rejected"`
+	TimedOut uint64 `json:"timed_out"`
+}
+
+// Bulkhead is a semaphore with a bounded queue. It is safe for concurrent
+// use.
+type Bulkhead struct {
+	name   string
+	config Config
+	slots  chan struct{}
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+func New(name string, config Config) *Bulkhead {
+	if config.MaxConcurrent <= 0 {
+		config.MaxConcurrent = 10
+	}
+	return &Bulkhead{
+		name:   name,
+		config: config,
+		slots:  make(chan struct{}, config.MaxConcurrent),
+		stats:  Stats{Name: name},
+	}
+}
+
+func (b *Bulkhead) Name() string {
+	return b.name
+}
+
+// Execute runs fn once a slot is free. It returns ErrFull or
+// ErrQueueTimeout without calling fn if no slot could be had, ctx's error if
+// ctx was done while waiting, and otherwise the error of fn.
+func (b *Bulkhead) Execute(ctx context.Context, fn func() error) error {
+	if err := b.acquire(ctx); err != nil {
+		return err
+	}
+	defer b.release()
+
+	return fn()
+}
+
+func (b *Bulkhead) acquire(ctx context.Context) error {
+	select {
+	case b.slots <- struct{}{}:
+		b.update(func(s *Stats) { s.Active++; s.Accepted++ })
+		return nil
+	default:
+	}
+
+	b.mu.Lock()
+	if b.stats.Queued >= b.config.MaxQueue {
+		b.stats.Rejected++
+		b.mu.Unlock()
+		return ErrFull
+	}
+	b.stats.Queued++
+	b.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if b.config.QueueTimeout > 0 {
+		timer := time.NewTimer(b.config.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+		b.update(func(s *Stats) { s.Queued--; s.Active++; s.Accepted++ })
+		return nil
+	case <-timeout:
+		b.update(func(s *Stats) { s.Queued--; s.TimedOut++ })
+		return ErrQueueTimeout
+	case <-ctx.Done():
+		b.update(func(s *Stats) { s.Queued-- })
+		return ctx.Err()
+	}
+}
+
+func (b *Bulkhead) release() {
+	<-b.slots
+	b.update(func(s *Stats) { s.Active-- })
+}
+
+func (b *Bulkhead) update(fn func(s *Stats)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	fn(&b.stats)
+}
+
+// Stats returns the bulkhead's counters.
+func (b *Bulkhead) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.stats
+}
@@ -0,0 +1,3 @@
+module github.com/rajamummidi/go-design-patterns/bulkhead
+
+go 1.20
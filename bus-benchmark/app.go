@@ -0,0 +1,234 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+)
+
+// Every approach delivers each published event to the same number of
+// subscribers, which record how long the event took to reach them. A
+// benchmark operation is one event delivered to all subscribers.
+
+// delivery is the data of a benchmark event.
+type delivery struct {
+	sent time.Time
+}
+
+// latency accumulates the publish-to-receive time of every delivery.
+type latency struct {
+	total atomic.Int64
+	count atomic.Int64
+}
+
+func (l *latency) observe(d delivery) {
+	l.total.Add(int64(time.Since(d.sent)))
+	l.count.Add(1)
+}
+
+func (l *latency) report(b *testing.B) {
+	if n := l.count.Load(); n > 0 {
+		b.ReportMetric(float64(l.total.Load())/float64(n), "ns-latency")
+	}
+}
+
+// syncBus runs the handlers on the publisher's goroutine.
+func syncBus(subscribers int) func(b *testing.B) {
+	return func(b *testing.B) {
+		var lat latency
+		bus := eventbus.NewEventBus()
+		for i := 0; i < subscribers; i++ {
+			bus.Register("tick", eventbus.DefaultPriority, func(e eventbus.Event) error {
+				lat.observe(e.Data.(delivery))
+				return nil
+			})
+		}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			bus.Dispatch("tick", delivery{sent: time.Now()})
+		}
+		b.StopTimer()
+		lat.report(b)
+	}
+}
+
+// queuedBus hands the events to worker goroutines through the bus queue.
+func queuedBus(subscribers, workers int) func(b *testing.B) {
+	return func(b *testing.B) {
+		var lat latency
+		var done sync.WaitGroup
+		bus := eventbus.NewQueuedEventBus(eventbus.QueueConfig{Size: 1024, Workers: workers})
+		for i := 0; i < subscribers; i++ {
+			bus.Register("tick", eventbus.DefaultPriority, func(e eventbus.Event) error {
+				lat.observe(e.Data.(delivery))
+				done.Done()
+				return nil
+			})
+		}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		done.Add(b.N * subscribers)
+		for i := 0; i < b.N; i++ {
+			bus.Dispatch("tick", delivery{sent: time.Now()})
+		}
+		done.Wait()
+		b.StopTimer()
+		lat.report(b)
+		bus.Close(context.Background())
+	}
+}
+
+// channels gives every subscriber a buffered channel and a goroutine, and
+// the publisher sends each event to every channel.
+func channels(subscribers int) func(b *testing.B) {
+	return func(b *testing.B) {
+		var lat latency
+		var done sync.WaitGroup
+		chans := make([]chan delivery, subscribers)
+		for i := range chans {
+			chans[i] = make(chan delivery, 1024)
+			done.Add(1)
+			go func(ch chan delivery) {
+				defer done.Done()
+				for d := range ch {
+					lat.observe(d)
+				}
+			}(chans[i])
+		}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			d := delivery{sent: time.Now()}
+			for _, ch := range chans {
+				ch <- d
+			}
+		}
+		for _, ch := range chans {
+			close(ch)
+		}
+		done.Wait()
+		b.StopTimer()
+		lat.report(b)
+	}
+}
+
+// cond publishes into a shared log and wakes every subscriber with
+// sync.Cond.Broadcast; each subscriber reads the entries it has not seen.
+func cond(subscribers int) func(b *testing.B) {
+	return func(b *testing.B) {
+		var lat latency
+		var done sync.WaitGroup
+		var mu sync.Mutex
+		c := sync.NewCond(&mu)
+		var log []delivery
+		closed := false
+
+		for i := 0; i < subscribers; i++ {
+			done.Add(1)
+			go func() {
+				defer done.Done()
+				seen := 0
+				mu.Lock()
+				defer mu.Unlock()
+				for {
+					for seen == len(log) && !closed {
+						c.Wait()
+					}
+					if seen == len(log) {
+						return
+					}
+					pending := log[seen:]
+					seen = len(log)
+					mu.Unlock()
+					for _, d := range pending {
+						lat.observe(d)
+					}
+					mu.Lock()
+				}
+			}()
+		}
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			mu.Lock()
+			log = append(log, delivery{sent: time.Now()})
+			mu.Unlock()
+			c.Broadcast()
+		}
+		mu.Lock()
+		closed = true
+		mu.Unlock()
+		c.Broadcast()
+		done.Wait()
+		b.StopTimer()
+		lat.report(b)
+	}
+}
+
+func main() {
+	subscribers := flag.Int("subscribers", 4, "subscribers per event")
+	workers := flag.Int("workers", 4, "worker goroutines of the queued bus")
+	flag.Parse()
+
+	benchmarks := []struct {
+		name string
+		fn   func(b *testing.B)
+	}{
+		{"eventbus (sync)", syncBus(*subscribers)},
+		{fmt.Sprintf("eventbus (queued, %d workers)", *workers), queuedBus(*subscribers, *workers)},
+		{"channel fan-out", channels(*subscribers)},
+		{"sync.Cond broadcast", cond(*subscribers)},
+	}
+
+	fmt.Printf("%d subscribers per event\n\n", *subscribers)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "approach\tevents/s\tns/event\tlatency ns\tallocs/event\tB/event\t")
+	for _, bm := range benchmarks {
+		r := testing.Benchmark(bm.fn)
+		perSecond := float64(r.N) / r.T.Seconds()
+		fmt.Fprintf(w, "%s\t%.0f\t%d\t%.0f\t%d\t%d\t\n",
+			bm.name, perSecond, r.NsPerOp(), r.Extra["ns-latency"], r.AllocsPerOp(), r.AllocedBytesPerOp())
+	}
+	w.Flush()
+}
@@ -29,46 +29,432 @@ SOFTWARE.
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
 
-	"github.com/afex/hystrix-go/hystrix"
+	"github.com/rajamummidi/go-design-patterns/bulkhead/bulkhead"
+	"github.com/rajamummidi/go-design-patterns/circuit-breaker/circuitbreaker"
+	"github.com/rajamummidi/go-design-patterns/decorator/decorator"
+	"github.com/rajamummidi/go-design-patterns/health/health"
+	"github.com/rajamummidi/go-design-patterns/lifecycle/lifecycle"
+	"github.com/rajamummidi/go-design-patterns/observability/observability"
+	"github.com/rajamummidi/go-design-patterns/otlp/otlp"
+	"github.com/rajamummidi/go-design-patterns/proxy/proxy"
 )
 
-func init() {
-	hystrix.ConfigureCommand("my_service", hystrix.CommandConfig{
-		Timeout:               1000,
-		MaxConcurrentRequests: 100,
-		ErrorPercentThreshold: 25,
+// breakers holds a breaker per downstream service and per route of this
+// server. Breakers not configured explicitly use the defaults. configure
+// sets it up, along with the other parts below.
+var breakers *circuitbreaker.Registry
+
+var breaker *circuitbreaker.Breaker
+
+// upstream is the service this server depends on.
+var upstream string
+
+// serviceTimeout is the Timeout of the my_service breaker, which handler
+// also puts on the request to the service.
+var serviceTimeout time.Duration
+
+// bulkheads bound how many requests to each upstream service may be in
+// flight, so a slow service cannot tie up every handler of this server.
+var bulkheads map[string]*bulkhead.Bulkhead
+
+// logger writes the server's log. main replaces it once the flags say in
+// which format.
+var logger = observability.NewLogger(observability.LogConfig{Service: "circuit-breaker"})
+
+// tracer traces requests if the -traces flag asks for it. It is nil
+// otherwise, which traces nothing.
+var tracer *observability.Tracer
+
+// client guards every outbound request with the breaker of its host, and
+// tries a request once more if it fails while the breaker is closed. Its
+// transport traces every attempt.
+var client = &http.Client{}
+
+// serviceClient makes the requests of handler, which guards them with the
+// my_service breaker itself.
+var serviceClient = &http.Client{}
+
+func newTransport() http.RoundTripper {
+	return decorator.ChainTransport(nil,
+		decorator.Retry(decorator.RetryConfig{
+			Attempts: 2,
+			Retryable: func(resp *http.Response, err error) bool {
+				return !errors.Is(err, circuitbreaker.ErrOpen) && !errors.Is(err, circuitbreaker.ErrTooManyRequests) &&
+					(err != nil || resp.StatusCode >= http.StatusInternalServerError)
+			},
+		}),
+		circuitbreaker.TransportMiddleware(breakers, circuitbreaker.ByHost),
+		observability.Transport(tracer),
+	)
+}
+
+// configure sets up the breakers, the bulkheads and the clients from cfg.
+func configure(cfg settings) {
+	upstream = cfg.Upstream
+	serviceTimeout = cfg.MyService.Timeout
+	breakers = circuitbreaker.NewRegistry(circuitbreaker.Config{
+		MinRequests: cfg.Defaults.MinRequests,
+		OpenTimeout: cfg.Defaults.OpenTimeout,
 	})
+	breakers.Configure("my_service", circuitbreaker.Config{
+		Timeout:      cfg.MyService.Timeout,
+		MinRequests:  cfg.MyService.MinRequests,
+		FailureRatio: cfg.MyService.FailureRatio,
+		OpenTimeout:  cfg.MyService.OpenTimeout,
+		// A full bulkhead says this server is busy, not that the service
+		// is failing.
+		IsFailure: func(err error) bool {
+			return err != nil && !errors.Is(err, bulkhead.ErrFull) && !errors.Is(err, bulkhead.ErrQueueTimeout)
+		},
+	})
+	breakers.OnStateChange(func(name string, from, to circuitbreaker.State) {
+		logger.Warn("circuit changed state", "circuit", name, "from", from.String(), "to", to.String())
+	})
+	breaker = breakers.Get("my_service")
+
+	bulkheads = map[string]*bulkhead.Bulkhead{
+		"my_service": bulkhead.New("my_service", bulkhead.Config{
+			MaxConcurrent: cfg.MyService.MaxConcurrent,
+			MaxQueue:      cfg.MyService.MaxQueue,
+			QueueTimeout:  cfg.MyService.QueueTimeout,
+		}),
+		"status": bulkhead.New("status", bulkhead.Config{
+			MaxConcurrent: cfg.Status.MaxConcurrent,
+			QueueTimeout:  cfg.Status.QueueTimeout,
+		}),
+	}
+
+	client.Timeout = cfg.ClientTimeout
+	client.Transport = newTransport()
+	serviceClient.Transport = observability.Transport(tracer)(http.DefaultTransport)
 }
 
 func main() {
-	http.HandleFunc("/", handler)
-	http.ListenAndServe(":8080", nil)
+	cfg, err := loadSettings()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	logger = observability.NewLogger(observability.LogConfig{Service: "circuit-breaker", Format: cfg.Log.Format})
+
+	var exporter *otlp.Exporter
+	if cfg.OTLP != "" {
+		exporter = otlp.New(otlp.Config{
+			Endpoint: cfg.OTLP,
+			Resource: map[string]string{"service.name": "circuit-breaker"},
+		})
+	}
+	switch cfg.Traces {
+	case "log":
+		tracer = observability.NewTracer(observability.TracerConfig{Exporter: observability.LogExporter(logger)})
+	case "otlp":
+		if exporter == nil {
+			fmt.Fprintln(os.Stderr, "-traces otlp needs an -otlp collector")
+			os.Exit(2)
+		}
+		tracer = observability.NewTracer(observability.TracerConfig{Exporter: observability.OTLPExporter(exporter, "circuit-breaker")})
+	}
+	configure(cfg)
+
+	upstreamProxy, err := newUpstreamProxy(cfg)
+	if err != nil {
+		logger.Error("configuring the upstream proxy", "err", err)
+		os.Exit(2)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handler)
+	mux.HandleFunc("/status", statusHandler)
+
+	// Every route of this server gets a breaker of its own as well, except
+	// the admin endpoints, which must stay reachable to force breakers.
+	admin := decorator.Then()
+	if cfg.AdminToken != "" {
+		admin = decorator.BearerAuth(func(token string) bool {
+			return subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) == 1
+		})
+	}
+	// The probes are open to the orchestrator, and are not counted by a
+	// route breaker either.
+	checks := health.New(health.Config{})
+	root := http.NewServeMux()
+	root.Handle("/healthz", checks.LiveHandler())
+	root.Handle("/readyz", checks.ReadyHandler())
+	root.Handle("/breakers", admin(breakers.AdminHandler()))
+	root.Handle("/breakers/metrics", admin(breakers.MetricsHandler()))
+	root.Handle("/bulkheads", admin(http.HandlerFunc(bulkheadsHandler)))
+	root.Handle("/proxy", admin(proxyStatsHandler(upstreamProxy)))
+	// The proxy answers from its cache and throttles clients before a
+	// request reaches the breaker, so neither counts against the service.
+	root.Handle("/upstream/", http.StripPrefix("/upstream", upstreamProxy))
+	root.Handle("/", decorator.Chain(mux,
+		decorator.Gzip(),
+		circuitbreaker.Middleware(breakers, circuitbreaker.ByRoute),
+	))
+
+	// Every request is traced, and logged with its trace.
+	server := &http.Server{Addr: cfg.Addr, Handler: decorator.Chain(root,
+		observability.Middleware(tracer),
+		observability.Logging(logger),
+	)}
+
+	// The server stops first and lets the requests in flight finish, so
+	// the breakers' final numbers include them, and the exporter sends
+	// those numbers before the process exits.
+	m := lifecycle.New()
+	m.SetStopTimeout(5 * time.Second)
+	m.Register("breakers", lifecycle.Hooks{OnStop: func(ctx context.Context) error {
+		for _, s := range breakers.Stats() {
+			logger.Info("circuit stats", "circuit", s.Name, "state", s.State.String(),
+				"requests", s.Requests, "failures", s.Failures, "short_circuits", s.ShortCircuits)
+		}
+		return nil
+	}})
+	if exporter != nil {
+		exporter.Register("circuitbreaker", breakers.WritePrometheus)
+		m.Register("otlp", lifecycle.Hooks{
+			OnStart: func(ctx context.Context) error {
+				exporter.Start()
+				return nil
+			},
+			OnStop: exporter.Shutdown,
+		}, "breakers")
+	}
+	// The tracer exports the spans of the last requests before the exporter
+	// it sends them through stops.
+	httpDeps := []string{"breakers"}
+	if tracer != nil {
+		var deps []string
+		if exporter != nil {
+			deps = append(deps, "otlp")
+		}
+		m.Register("tracer", lifecycle.Hooks{OnStop: tracer.Shutdown}, deps...)
+		httpDeps = append(httpDeps, "tracer")
+	}
+	m.Register("http", lifecycle.WithStopTimeout(httpServer(server), cfg.ShutdownTimeout), httpDeps...)
+
+	// The server is alive while it accepts connections. It is ready once
+	// its components have started and while requests do not pile up in
+	// the bulkhead. An open breaker or an unreachable upstream only
+	// degrade it, since the cache and the proxy answer in the meantime.
+	checks.AddLiveness("listener", health.Dial(server.Addr))
+	checks.AddReadiness("components", m)
+	checks.AddReadiness("my_service-queue", health.Threshold(func() int {
+		return bulkheads["my_service"].Stats().Queued
+	}, cfg.MyService.ReadyQueue))
+	checks.AddReadiness("breakers", health.Optional(breakers))
+	checks.AddReadiness("upstream", health.Optional(health.Dial(upstreamAddr())))
+
+	if err := m.Run(context.Background()); err != nil {
+		logger.Error("running server", "err", err)
+		os.Exit(1)
+	}
 }
 
-func handler(w http.ResponseWriter, r *http.Request) {
-	err := hystrix.Do("my_service", func() error {
-		// code to make the request to the service
-		resp, err := http.Get("https://www.example.com")
+// httpServer runs server as a component. Start returns once the server
+// listens, so a port in use fails the start, and Stop waits for the
+// requests in flight.
+func httpServer(server *http.Server) lifecycle.Component {
+	return lifecycle.Hooks{
+		OnStart: func(ctx context.Context) error {
+			listener, err := net.Listen("tcp", server.Addr)
+			if err != nil {
+				return err
+			}
+			go server.Serve(listener)
+			return nil
+		},
+		OnStop: server.Shutdown,
+	}
+}
+
+// statusHandler checks a second service through the protected client.
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	err := bulkheads["status"].Execute(r.Context(), func() error {
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, "https://status.example.com", nil)
 		if err != nil {
 			return err
 		}
-
-		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
 		}
+		defer resp.Body.Close()
 
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
 		return nil
-	}, nil)
+	})
+	switch {
+	case errors.Is(err, bulkhead.ErrFull), errors.Is(err, bulkhead.ErrQueueTimeout):
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("Error: " + err.Error()))
+	case err != nil:
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("Error: " + err.Error()))
+	}
+}
+
+// bulkheadsHandler reports the counters of every bulkhead as JSON.
+func bulkheadsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := make([]bulkhead.Stats, 0, len(bulkheads))
+	for _, name := range []string{"my_service", "status"} {
+		stats = append(stats, bulkheads[name].Stats())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// newUpstreamProxy returns a caching, throttling reverse proxy to the
+// upstream. It sends its requests through the client's transport, so they
+// are guarded by the breaker of the upstream's host, and it serves cached
+// responses for a while when the breaker is open.
+func newUpstreamProxy(cfg settings) (*proxy.Proxy, error) {
+	target, err := url.Parse(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream: %w", err)
+	}
+	return proxy.New(proxy.Config{
+		Target:               target,
+		Transport:            client.Transport,
+		TTL:                  cfg.Proxy.TTL,
+		StaleWhileRevalidate: cfg.Proxy.StaleWhileRevalidate,
+		StaleIfError:         cfg.Proxy.StaleIfError,
+		Rate:                 cfg.Proxy.Rate,
+		Burst:                cfg.Proxy.Burst,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			status := http.StatusBadGateway
+			if errors.Is(err, circuitbreaker.ErrOpen) || errors.Is(err, circuitbreaker.ErrTooManyRequests) {
+				status = http.StatusServiceUnavailable
+			}
+			http.Error(w, "Error: "+err.Error(), status)
+		},
+	})
+}
+
+// upstreamAddr returns the host and port of the upstream, to check that it
+// is reachable.
+func upstreamAddr() string {
+	target, err := url.Parse(upstream)
+	if err != nil {
+		return upstream
+	}
+	if target.Port() != "" {
+		return target.Host
+	}
+	if target.Scheme == "https" {
+		return net.JoinHostPort(target.Hostname(), "443")
+	}
+	return net.JoinHostPort(target.Hostname(), "80")
+}
+
+// proxyStatsHandler reports the counters of the upstream proxy as JSON.
+func proxyStatsHandler(p *proxy.Proxy) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p.Stats())
+	})
+}
+
+// levels names who served a request, indexed by the level returned from
+// ExecuteWithFallback.
+var levels = []string{"primary", "cache", "default"}
 
+// cache holds the last response the service returned, which is served while
+// the service is unavailable.
+var cache struct {
+	sync.Mutex
+	body []byte
+}
+
+func handler(w http.ResponseWriter, r *http.Request) {
+	// The breaker stops waiting for the primary after its timeout, while
+	// the primary may still be running. So the primary has a body of its
+	// own, which is only read once the breaker has seen it return, and its
+	// request to the service is cancelled at the same timeout.
+	var body, fetched []byte
+
+	level, err := breaker.ExecuteWithFallback(r.Context(),
+		func() error {
+			ctx, cancel := context.WithTimeout(r.Context(), serviceTimeout)
+			defer cancel()
+			return bulkheads["my_service"].Execute(ctx, func() error {
+				return fetch(ctx, &fetched)
+			})
+		},
+		func() error {
+			cache.Lock()
+			defer cache.Unlock()
+			if cache.body == nil {
+				return errors.New("no cached response")
+			}
+			body = cache.body
+			return nil
+		},
+		func() error {
+			body = []byte("Success")
+			return nil
+		},
+	)
+
+	// The span of the request says which breaker decided how it was
+	// served, and what state the breaker was left in.
+	span := observability.SpanFromContext(r.Context())
+	span.SetAttributes(
+		slog.String("breaker.name", breaker.Name()),
+		slog.String("breaker.state", breaker.State().String()),
+	)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("Error: " + err.Error()))
 		return
 	}
 
+	if level == 0 {
+		body = fetched
+	}
+	span.SetAttributes(slog.String("breaker.served_by", levels[level]))
+	w.Header().Set("X-Served-By", levels[level])
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Success"))
+	w.Write(body)
+}
+
+// fetch makes the request to the service and caches the response.
+func fetch(ctx context.Context, body *[]byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstream, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := serviceClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	if *body, err = io.ReadAll(resp.Body); err != nil {
+		return err
+	}
+	cache.Lock()
+	cache.body = *body
+	cache.Unlock()
+	return nil
 }
@@ -0,0 +1,146 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package circuitbreaker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// AdminHandler serves the stats of every breaker as JSON on GET. A POST
+// with the parameters name and state forces the named breaker into state,
+// which is "open", "closed" or "half-open", or releases it with "auto":
+//
+//	curl -X POST 'localhost:8080/breakers?name=my_service&state=open'
+func (r *Registry) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			name := req.FormValue("name")
+			if name == "" {
+				http.Error(w, "missing name", http.StatusBadRequest)
+				return
+			}
+			b := r.Get(name)
+			switch state := req.FormValue("state"); state {
+			case "open":
+				b.Force(Open)
+			case "closed":
+				b.Force(Closed)
+			case "half-open":
+				b.Force(HalfOpen)
+			case "auto":
+				b.Release()
+			default:
+				http.Error(w, fmt.Sprintf("unknown state %q", state), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(r.Stats())
+	})
+}
+
+// Stats returns the stats of every breaker, sorted by name.
+func (r *Registry) Stats() []Stats {
+	breakers := r.Breakers()
+	stats := make([]Stats, len(breakers))
+	for i, b := range breakers {
+		stats[i] = b.Stats()
+	}
+	return stats
+}
+
+// Check returns an error naming the open breakers, or nil when none is
+// open. It has the signature of a health check, so a readiness probe can
+// use the registry directly.
+func (r *Registry) Check(ctx context.Context) error {
+	var open []string
+	for _, b := range r.Breakers() {
+		if b.State() == Open {
+			open = append(open, b.name)
+		}
+	}
+	if len(open) > 0 {
+		return fmt.Errorf("circuit breakers open: %s", strings.Join(open, ", "))
+	}
+	return nil
+}
+
+// MetricsHandler serves the stats of every breaker in the Prometheus text
+// exposition format.
+func (r *Registry) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		r.WritePrometheus(w)
+	})
+}
+
+// WritePrometheus writes the stats of every breaker in the Prometheus text
+// exposition format.
+func (r *Registry) WritePrometheus(w io.Writer) {
+	stats := r.Stats()
+
+	counters := []struct {
+		name, help string
+		value      func(Stats) uint64
+	}{
+		{"circuitbreaker_requests_total", "Calls let through the breaker.", func(s Stats) uint64 { return s.Requests }},
+		{"circuitbreaker_failures_total", "Calls that failed.", func(s Stats) uint64 { return s.Failures }},
+		{"circuitbreaker_short_circuits_total", "Calls rejected by the breaker.", func(s Stats) uint64 { return s.ShortCircuits }},
+	}
+	for _, c := range counters {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+		for _, s := range stats {
+			fmt.Fprintf(w, "%s{name=%q} %d\n", c.name, s.Name, c.value(s))
+		}
+	}
+
+	fmt.Fprintf(w, "# HELP circuitbreaker_state Current state: 0 closed, 1 open, 2 half-open.\n# TYPE circuitbreaker_state gauge\n")
+	for _, s := range stats {
+		fmt.Fprintf(w, "circuitbreaker_state{name=%q} %d\n", s.Name, s.State)
+	}
+
+	const latency = "circuitbreaker_call_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Latency of recent calls.\n# TYPE %s summary\n", latency, latency)
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s{name=%q,quantile=\"0.5\"} %g\n", latency, s.Name, s.P50.Seconds())
+		fmt.Fprintf(w, "%s{name=%q,quantile=\"0.9\"} %g\n", latency, s.Name, s.P90.Seconds())
+		fmt.Fprintf(w, "%s{name=%q,quantile=\"0.99\"} %g\n", latency, s.Name, s.P99.Seconds())
+	}
+}
@@ -0,0 +1,478 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package circuitbreaker implements the circuit breaker pattern: a Breaker
+// watches the calls to a dependency and, once too many of them fail, rejects
+// further calls for a while so the dependency can recover.
+//
+// A breaker starts Closed and lets every call through, counting successes
+// and failures in a sliding window. When the window holds at least
+// MinRequests calls and the share of failures reaches FailureRatio, the
+// breaker trips to Open and fails calls immediately with ErrOpen. After
+// OpenTimeout it moves to HalfOpen and lets HalfOpenRequests probe calls
+// through: if they all succeed the breaker closes again, and a single
+// failure opens it for another OpenTimeout.
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/future/future"
+	"github.com/rajamummidi/go-design-patterns/state-machine/statemachine"
+)
+
+// State is the state of a breaker.
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+// MarshalText encodes the state by name, for example in JSON stats.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+var (
+	// ErrOpen is returned by Execute while the breaker is open.
+	ErrOpen = errors.New("circuitbreaker: circuit open")
+	// ErrTooManyRequests is returned by Execute while the breaker is half
+	// open and all probe calls are already in flight.
+	ErrTooManyRequests = errors.New("circuitbreaker: too many requests while half open")
+)
+
+// Config holds the thresholds of a breaker. Zero fields take the defaults
+// given below.
+type Config struct {
+	// Window is the length of the sliding window failures are counted in
+	// (10s), divided into Buckets buckets (10).
+	Window  time.Duration
+	Buckets int
+
+	// MinRequests is how many calls the window must hold before the
+	// breaker may trip (20), and FailureRatio the share of them that must
+	// have failed (0.5).
+	MinRequests  int
+	FailureRatio float64
+
+	// OpenTimeout is how long the breaker stays open before probing the
+	// dependency again (5s).
+	OpenTimeout time.Duration
+
+	// HalfOpenRequests is how many probe calls must succeed in a row to
+	// close the breaker again (1).
+	HalfOpenRequests int
+
+	// Timeout, if set, limits every call. A call that runs out of time
+	// counts as a failure.
+	Timeout time.Duration
+
+	// IsFailure decides which errors count as failures. By default every
+	// error does, except the caller canceling its context.
+	IsFailure func(err error) bool
+}
+
+func (c Config) withDefaults() Config {
+	if c.Window <= 0 {
+		c.Window = 10 * time.Second
+	}
+	if c.Buckets <= 0 {
+		c.Buckets = 10
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = 20
+	}
+	if c.FailureRatio <= 0 {
+		c.FailureRatio = 0.5
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 5 * time.Second
+	}
+	if c.HalfOpenRequests <= 0 {
+		c.HalfOpenRequests = 1
+	}
+	if c.IsFailure == nil {
+		c.IsFailure = func(err error) bool {
+			return err != nil && !errors.Is(err, context.Canceled)
+		}
+	}
+	return c
+}
+
+// Counts are the calls recorded in the sliding window.
+type Counts struct {
+	Requests  int `json:"requests"`
+	Failures  int `json:"failures"`
+	Successes int `json:"successes"`
+}
+
+// StateChange describes a transition of a breaker. It is also the data of the
+// events published by PublishTo.
+type StateChange struct {
+	Name string
+	From State
+	To   State
+	Time time.Time
+}
+
+// Publisher is what PublishTo needs to publish state changes as events. The
+// EventBus of the event-driven-architecture module satisfies it.
+type Publisher interface {
+	Dispatch(eventType string, data interface{}) error
+}
+
+// Event types published by PublishTo.
+const (
+	EventOpened   = "breaker-opened"
+	EventHalfOpen = "breaker-half-open"
+	EventClosed   = "breaker-closed"
+)
+
+// historySize is how many state changes a breaker remembers.
+const historySize = 10
+
+// trigger is an event of a breaker's state machine.
+type trigger string
+
+const (
+	tripped      trigger = "tripped" // too many calls failed
+	cooledDown   trigger = "cooled down"
+	probeFailed  trigger = "probe failed"
+	probesPassed trigger = "probes passed"
+)
+
+// forceTo is the trigger of Force(state).
+func forceTo(state State) trigger {
+	return trigger("forced " + state.String())
+}
+
+// Transition is a state change in the history of a breaker, with the
+// trigger that caused it.
+type Transition struct {
+	From  State     `json:"from"`
+	To    State     `json:"to"`
+	Cause string    `json:"cause"`
+	Time  time.Time `json:"time"`
+}
+
+// Breaker is a circuit breaker. It is safe for concurrent use.
+type Breaker struct {
+	name   string
+	config Config
+
+	hooksMu sync.RWMutex
+	hooks   []func(from, to State)
+
+	mu         sync.Mutex
+	pending    []StateChange // changes whose hooks have not run yet
+	fsm        *statemachine.Machine[State, trigger]
+	generation uint64 // incremented on every state change
+	window     *window
+	openedAt   time.Time
+	probes     int // probe calls started in the current half-open state
+	probesOK   int
+	forced     bool // state set by Force, kept until Release
+	metrics    metrics
+}
+
+// New returns a closed breaker guarding the dependency called name.
+func New(name string, config Config) *Breaker {
+	config = config.withDefaults()
+	b := &Breaker{
+		name:   name,
+		config: config,
+		window: newWindow(config.Window, config.Buckets),
+	}
+	b.fsm = b.newMachine()
+	return b
+}
+
+// newMachine declares the states of the breaker and what moves it between
+// them. Force may move it from any state to any other.
+func (b *Breaker) newMachine() *statemachine.Machine[State, trigger] {
+	m := statemachine.New[State, trigger](Closed).
+		Permit(Closed, tripped, Open).
+		Permit(Open, cooledDown, HalfOpen).
+		Permit(HalfOpen, probeFailed, Open).
+		Permit(HalfOpen, probesPassed, Closed).
+		OnTransition(b.changed).
+		OnEnter(Open, func(statemachine.Transition[State, trigger]) {
+			b.openedAt = time.Now()
+		}).
+		OnEnter(Closed, func(statemachine.Transition[State, trigger]) {
+			b.window.reset()
+		}).
+		KeepHistory(historySize)
+	states := []State{Closed, Open, HalfOpen}
+	for _, from := range states {
+		for _, to := range states {
+			if from != to {
+				m.Permit(from, forceTo(to), to)
+			}
+		}
+	}
+	return m
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// OnStateChange registers fn to be called after every state change. Hooks
+// run on the goroutine whose call caused the change, after the breaker has
+// been unlocked, so they may call the breaker themselves.
+func (b *Breaker) OnStateChange(fn func(from, to State)) {
+	b.hooksMu.Lock()
+	defer b.hooksMu.Unlock()
+
+	b.hooks = append(b.hooks, fn)
+}
+
+// PublishTo publishes every state change as a breaker-opened,
+// breaker-half-open or breaker-closed event with a StateChange as data.
+func (b *Breaker) PublishTo(p Publisher) {
+	b.OnStateChange(func(from, to State) {
+		eventType := EventClosed
+		switch to {
+		case Open:
+			eventType = EventOpened
+		case HalfOpen:
+			eventType = EventHalfOpen
+		}
+		p.Dispatch(eventType, StateChange{Name: b.name, From: from, To: to, Time: time.Now()})
+	})
+}
+
+// State returns the current state, moving an open breaker whose timeout has
+// passed to half open.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.expire(time.Now())
+	return b.fsm.State()
+}
+
+// History returns the most recent state changes of the breaker, oldest
+// first.
+func (b *Breaker) History() []Transition {
+	records := b.fsm.History()
+	history := make([]Transition, len(records))
+	for i, r := range records {
+		history[i] = Transition{From: r.From, To: r.To, Cause: string(r.Event), Time: r.Time}
+	}
+	return history
+}
+
+// Counts returns the calls recorded in the current window.
+func (b *Breaker) Counts() Counts {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.window.counts(time.Now())
+}
+
+// Execute calls fn if the breaker allows it and records the outcome. It
+// returns ErrOpen or ErrTooManyRequests without calling fn when the breaker
+// rejects the call, and otherwise the error of fn. If ctx is done before fn
+// returns, Execute returns ctx's error without waiting for fn.
+func (b *Breaker) Execute(ctx context.Context, fn func() error) error {
+	generation, err := b.allow()
+	if err != nil {
+		return err
+	}
+
+	if b.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.config.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err = call(ctx, fn)
+	b.record(generation, !b.config.IsFailure(err), time.Since(start))
+	return err
+}
+
+// ExecuteAsync is like Execute but calls fn in the background and returns
+// at once with a future of its outcome. If ctx is done first, the future
+// fails with ctx's error. Then chains work onto a successful call, and
+// Catch turns a rejection into a fallback value.
+func (b *Breaker) ExecuteAsync(ctx context.Context, fn func() error) *future.Future[struct{}] {
+	return future.Go(ctx, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, b.Execute(ctx, fn)
+	})
+}
+
+// run calls fn on the caller's goroutine if the breaker allows it and
+// records the outcome. Unlike Execute it never abandons fn, which suits
+// callers such as HTTP handlers that must not return while fn is still
+// running; Config.Timeout does not apply.
+func (b *Breaker) run(fn func() error) error {
+	generation, err := b.allow()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = fn()
+	b.record(generation, !b.config.IsFailure(err), time.Since(start))
+	return err
+}
+
+// call runs fn, giving up when ctx is done. A context that can never be
+// done runs fn on the caller's goroutine.
+func call(ctx context.Context, fn func() error) error {
+	if ctx.Done() == nil {
+		return fn()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	result := make(chan error, 1)
+	go func() { result <- fn() }()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// allow decides whether a call may proceed and returns the generation it
+// belongs to.
+func (b *Breaker) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.expire(time.Now())
+	switch b.fsm.State() {
+	case Open:
+		b.metrics.shortCircuits++
+		return 0, ErrOpen
+	case HalfOpen:
+		if b.probes >= b.config.HalfOpenRequests {
+			b.metrics.shortCircuits++
+			return 0, ErrTooManyRequests
+		}
+		b.probes++
+	}
+	return b.generation, nil
+}
+
+// record counts the outcome of a call. Calls started before the last state
+// change are ignored, so a slow call from before the breaker opened cannot
+// close it again.
+func (b *Breaker) record(generation uint64, ok bool, latency time.Duration) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.metrics.record(ok, latency)
+	now := time.Now()
+	b.expire(now)
+	if generation != b.generation || b.forced {
+		return
+	}
+
+	switch b.fsm.State() {
+	case Closed:
+		b.window.record(now, ok)
+		c := b.window.counts(now)
+		if c.Requests >= b.config.MinRequests && float64(c.Failures) >= b.config.FailureRatio*float64(c.Requests) {
+			b.fire(tripped)
+		}
+	case HalfOpen:
+		if !ok {
+			b.fire(probeFailed)
+			return
+		}
+		b.probesOK++
+		if b.probesOK >= b.config.HalfOpenRequests {
+			b.fire(probesPassed)
+		}
+	}
+}
+
+// unlock releases b.mu and then runs the hooks of the state changes made
+// while it was held.
+func (b *Breaker) unlock() {
+	pending := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+	b.hooksMu.RLock()
+	hooks := b.hooks
+	b.hooksMu.RUnlock()
+	for _, change := range pending {
+		for _, hook := range hooks {
+			hook(change.From, change.To)
+		}
+	}
+}
+
+// expire moves an open breaker to half open once its timeout has passed.
+// The caller must hold b.mu.
+func (b *Breaker) expire(now time.Time) {
+	if b.fsm.State() == Open && !b.forced && !now.Before(b.openedAt.Add(b.config.OpenTimeout)) {
+		b.fire(cooledDown)
+	}
+}
+
+// fire moves the breaker's state machine. The caller must hold b.mu, and
+// only fires triggers that are valid in the current state.
+func (b *Breaker) fire(event trigger) {
+	b.fsm.Fire(event)
+}
+
+// changed queues the hooks of a state change and starts a new generation.
+// The state machine calls it on every transition, with b.mu held.
+func (b *Breaker) changed(t statemachine.Transition[State, trigger]) {
+	b.pending = append(b.pending, StateChange{Name: b.name, From: t.From, To: t.To, Time: time.Now()})
+	b.generation++
+	b.probes, b.probesOK = 0, 0
+}
@@ -0,0 +1,69 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrAllFailed is returned by ExecuteWithFallback, joined with the error of
+// every level, when neither the primary call nor any fallback succeeded.
+var ErrAllFailed = errors.New("circuitbreaker: primary and all fallbacks failed")
+
+// ExecuteWithFallback calls primary through the breaker, like Execute. If
+// the call fails or the breaker rejects it, the fallbacks are tried in order,
+// for example a cached response, a secondary endpoint and finally a static
+// default, until one of them succeeds. Fallbacks are not guarded by the
+// breaker; if they call a remote service themselves they should use a
+// breaker of their own.
+//
+// The returned level reports who served the request: 0 for primary and i
+// for the i-th fallback. If every level failed, level is -1 and err wraps
+// ErrAllFailed and the errors of all levels.
+func (b *Breaker) ExecuteWithFallback(ctx context.Context, primary func() error, fallbacks ...func() error) (level int, err error) {
+	err = b.Execute(ctx, primary)
+	if err == nil {
+		return 0, nil
+	}
+
+	errs := []error{ErrAllFailed, fmt.Errorf("primary: %w", err)}
+	for i, fallback := range fallbacks {
+		if err := ctx.Err(); err != nil {
+			return -1, err
+		}
+		err := fallback()
+		if err == nil {
+			return i + 1, nil
+		}
+		errs = append(errs, fmt.Errorf("fallback %d: %w", i+1, err))
+	}
+	return -1, errors.Join(errs...)
+}
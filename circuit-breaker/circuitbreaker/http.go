@@ -0,0 +1,139 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package circuitbreaker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// KeyFunc picks the breaker that guards a request.
+type KeyFunc func(r *http.Request) string
+
+// ByHost keys requests on their host, so every downstream service gets its
+// own breaker. It suits outbound requests.
+func ByHost(r *http.Request) string {
+	return r.URL.Host
+}
+
+// ByRoute keys requests on their method and path, so a failing endpoint
+// does not take the others down with it. It suits inbound requests.
+func ByRoute(r *http.Request) string {
+	return r.Method + " " + r.URL.Path
+}
+
+// statusError is how a 5xx response is recorded as a failure.
+type statusError int
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("status %d", int(e))
+}
+
+func checkStatus(code int) error {
+	if code >= http.StatusInternalServerError {
+		return statusError(code)
+	}
+	return nil
+}
+
+// Middleware guards a handler with the breakers of registry. Responses with
+// a 5xx status count as failures, and while the breaker of a request is
+// open the request is answered with 503 Service Unavailable without
+// reaching the handler. Config.Timeout does not apply; use the server's
+// timeouts or http.TimeoutHandler instead.
+func Middleware(registry *Registry, key KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			err := registry.Get(key(r)).run(func() error {
+				next.ServeHTTP(sw, r)
+				return checkStatus(sw.status)
+			})
+			if errors.Is(err, ErrOpen) || errors.Is(err, ErrTooManyRequests) {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Transport is an http.RoundTripper that guards outbound requests with the
+// breakers of Registry, keyed by Key (ByHost if nil). Transport errors and
+// 5xx responses count as failures; the response is still returned to the
+// caller. While a breaker is open, RoundTrip fails with ErrOpen without
+// sending the request. Config.Timeout does not apply; set http.Client's
+// Timeout instead.
+type Transport struct {
+	Registry *Registry
+	Key      KeyFunc
+	// Base sends the requests, http.DefaultTransport if nil.
+	Base http.RoundTripper
+}
+
+// TransportMiddleware wraps round trippers in a Transport with the breakers
+// of registry, for use next to Middleware on the client side.
+func TransportMiddleware(registry *Registry, key KeyFunc) func(http.RoundTripper) http.RoundTripper {
+	return func(base http.RoundTripper) http.RoundTripper {
+		return &Transport{Registry: registry, Key: key, Base: base}
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, base := t.Key, t.Base
+	if key == nil {
+		key = ByHost
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	var resp *http.Response
+	err := t.Registry.Get(key(req)).run(func() error {
+		var err error
+		if resp, err = base.RoundTrip(req); err != nil {
+			return err
+		}
+		return checkStatus(resp.StatusCode)
+	})
+	var status statusError
+	if errors.As(err, &status) {
+		return resp, nil
+	}
+	return resp, err
+}
@@ -0,0 +1,139 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package circuitbreaker
+
+import (
+	"sort"
+	"time"
+)
+
+// latencySamples is how many of the most recent call latencies a breaker
+// keeps to compute percentiles from.
+const latencySamples = 1024
+
+// Stats are the counters of a breaker since it was created.
+type Stats struct {
+	Name   string `json:"name"`
+	State  State  `json:"state"`
+	Forced bool   `json:"forced"`
+
+	// Requests counts the finished calls the breaker let through, and
+	// Successes and Failures their outcomes. ShortCircuits counts the calls
+	// it rejected.
+	Requests      uint64 `json:"requests"`
+	Successes     uint64 `json:"successes"`
+	Failures      uint64 `json:"failures"`
+	ShortCircuits uint64 `json:"short_circuits"`
+
+	// Window holds the calls in the current sliding window.
+	Window Counts `json:"window"`
+
+	// Latency percentiles over the most recent calls.
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+
+	// History holds the most recent state changes, oldest first.
+	History []Transition `json:"history"`
+}
+
+type metrics struct {
+	successes     uint64
+	failures      uint64
+	shortCircuits uint64
+
+	latencies []time.Duration // ring of the last latencySamples calls
+	next      int
+}
+
+func (m *metrics) record(ok bool, latency time.Duration) {
+	if ok {
+		m.successes++
+	} else {
+		m.failures++
+	}
+	if len(m.latencies) < latencySamples {
+		m.latencies = append(m.latencies, latency)
+		return
+	}
+	m.latencies[m.next] = latency
+	m.next = (m.next + 1) % latencySamples
+}
+
+// Stats returns the breaker's counters.
+func (b *Breaker) Stats() Stats {
+	b.mu.Lock()
+	defer b.unlock()
+
+	now := time.Now()
+	b.expire(now)
+	m := &b.metrics
+	stats := Stats{
+		Name:          b.name,
+		State:         b.fsm.State(),
+		Forced:        b.forced,
+		Requests:      m.successes + m.failures,
+		Successes:     m.successes,
+		Failures:      m.failures,
+		ShortCircuits: m.shortCircuits,
+		Window:        b.window.counts(now),
+		History:       b.History(),
+	}
+
+	if len(m.latencies) > 0 {
+		sorted := append([]time.Duration(nil), m.latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		percentile := func(p float64) time.Duration {
+			return sorted[int(p*float64(len(sorted)-1))]
+		}
+		stats.P50, stats.P90, stats.P99 = percentile(0.5), percentile(0.9), percentile(0.99)
+	}
+	return stats
+}
+
+// Force puts the breaker into state and keeps it there, whatever the calls
+// return, until Release is called. It is meant for testing how callers cope
+// with an open breaker, or for keeping traffic off a dependency by hand.
+func (b *Breaker) Force(state State) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if state != b.fsm.State() {
+		b.fire(forceTo(state))
+	}
+	b.forced = true
+}
+
+// Release lets a forced breaker change state on its own again.
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.forced = false
+}
@@ -0,0 +1,111 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package circuitbreaker
+
+import (
+	"sort"
+	"sync"
+)
+
+// Registry manages breakers by name, such as one per downstream host or
+// route, creating each the first time it is asked for.
+type Registry struct {
+	defaults Config
+
+	mu       sync.Mutex
+	configs  map[string]Config
+	breakers map[string]*Breaker
+	hooks    []func(name string, from, to State)
+}
+
+// NewRegistry returns a registry whose breakers use defaults unless
+// Configure gives them a configuration of their own.
+func NewRegistry(defaults Config) *Registry {
+	return &Registry{
+		defaults: defaults,
+		configs:  make(map[string]Config),
+		breakers: make(map[string]*Breaker),
+	}
+}
+
+// Configure sets the configuration of the breaker called name. It only
+// affects a breaker that has not been created yet.
+func (r *Registry) Configure(name string, config Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.configs[name] = config
+}
+
+// OnStateChange registers fn to be called on the state changes of every
+// breaker in the registry, including ones created later.
+func (r *Registry) OnStateChange(fn func(name string, from, to State)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.hooks = append(r.hooks, fn)
+	for name, b := range r.breakers {
+		name := name
+		b.OnStateChange(func(from, to State) { fn(name, from, to) })
+	}
+}
+
+// Get returns the breaker called name, creating it if necessary.
+func (r *Registry) Get(name string) *Breaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, ok := r.breakers[name]; ok {
+		return b
+	}
+	config, ok := r.configs[name]
+	if !ok {
+		config = r.defaults
+	}
+	b := New(name, config)
+	for _, fn := range r.hooks {
+		fn := fn
+		b.OnStateChange(func(from, to State) { fn(name, from, to) })
+	}
+	r.breakers[name] = b
+	return b
+}
+
+// Breakers returns the breakers created so far, sorted by name.
+func (r *Registry) Breakers() []*Breaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	breakers := make([]*Breaker, 0, len(r.breakers))
+	for _, b := range r.breakers {
+		breakers = append(breakers, b)
+	}
+	sort.Slice(breakers, func(i, j int) bool { return breakers[i].name < breakers[j].name })
+	return breakers
+}
@@ -0,0 +1,88 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package circuitbreaker
+
+import "time"
+
+// window counts successes and failures over a sliding period of time. The
+// period is divided into buckets; as time moves on, the oldest bucket is
+// reused for the newest, so old outcomes drop out without being tracked one
+// by one.
+type window struct {
+	width   time.Duration
+	buckets []bucket
+}
+
+type bucket struct {
+	index     int64 // which bucket-width slice of time the counts belong to
+	successes int
+	failures  int
+}
+
+func newWindow(length time.Duration, buckets int) *window {
+	width := length / time.Duration(buckets)
+	if width <= 0 {
+		width = 1
+	}
+	return &window{width: width, buckets: make([]bucket, buckets)}
+}
+
+func (w *window) record(now time.Time, ok bool) {
+	index := now.UnixNano() / int64(w.width)
+	b := &w.buckets[index%int64(len(w.buckets))]
+	if b.index != index {
+		*b = bucket{index: index}
+	}
+	if ok {
+		b.successes++
+	} else {
+		b.failures++
+	}
+}
+
+func (w *window) counts(now time.Time) Counts {
+	index := now.UnixNano() / int64(w.width)
+	oldest := index - int64(len(w.buckets)) + 1
+
+	var c Counts
+	for _, b := range w.buckets {
+		if b.index >= oldest && b.index <= index {
+			c.Successes += b.successes
+			c.Failures += b.failures
+		}
+	}
+	c.Requests = c.Successes + c.Failures
+	return c
+}
+
+func (w *window) reset() {
+	for i := range w.buckets {
+		w.buckets[i] = bucket{}
+	}
+}
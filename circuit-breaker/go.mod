@@ -1,7 +1,31 @@
 module github.com/rajamummidi/go-design-patterns/circuit-breaker
 
-go 1.20
+go 1.21
 
-require github.com/afex/hystrix-go v0.0.0-20180502004556-fa1af6a1f4f5
+require (
+	github.com/rajamummidi/go-design-patterns/bulkhead v0.0.0
+	github.com/rajamummidi/go-design-patterns/config v0.0.0
+	github.com/rajamummidi/go-design-patterns/decorator v0.0.0
+	github.com/rajamummidi/go-design-patterns/future v0.0.0
+	github.com/rajamummidi/go-design-patterns/health v0.0.0
+	github.com/rajamummidi/go-design-patterns/lifecycle v0.0.0
+	github.com/rajamummidi/go-design-patterns/observability v0.0.0
+	github.com/rajamummidi/go-design-patterns/otlp v0.0.0
+	github.com/rajamummidi/go-design-patterns/proxy v0.0.0
+	github.com/rajamummidi/go-design-patterns/rate-limiter v0.0.0
+	github.com/rajamummidi/go-design-patterns/state-machine v0.0.0
+)
 
-require github.com/smartystreets/goconvey v1.8.0 // indirect
+replace (
+	github.com/rajamummidi/go-design-patterns/bulkhead => ../bulkhead
+	github.com/rajamummidi/go-design-patterns/config => ../config
+	github.com/rajamummidi/go-design-patterns/decorator => ../decorator
+	github.com/rajamummidi/go-design-patterns/future => ../future
+	github.com/rajamummidi/go-design-patterns/health => ../health
+	github.com/rajamummidi/go-design-patterns/lifecycle => ../lifecycle
+	github.com/rajamummidi/go-design-patterns/observability => ../observability
+	github.com/rajamummidi/go-design-patterns/otlp => ../otlp
+	github.com/rajamummidi/go-design-patterns/proxy => ../proxy
+	github.com/rajamummidi/go-design-patterns/rate-limiter => ../rate-limiter
+	github.com/rajamummidi/go-design-patterns/state-machine => ../state-machine
+)
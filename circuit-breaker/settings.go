@@ -0,0 +1,95 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/config/config"
+)
+
+// settings are what the demo can be configured with. Load reads them from
+// their defaults, a file given with -config, variables prefixed with
+// BREAKER_ and flags, in that order: -my-service-min-requests, for
+// example, is min-requests under my-service in a file and
+// BREAKER_MY_SERVICE_MIN_REQUESTS in the environment.
+type settings struct {
+	Addr            string        `default:":8080" usage:"address to serve on" validate:"required"`
+	Upstream        string        `default:"https://www.example.com" usage:"URL of the service behind the breaker and the /upstream/ proxy" validate:"required"`
+	AdminToken      string        `usage:"bearer token required by the admin endpoints; empty leaves them open"`
+	ShutdownTimeout time.Duration `default:"10s" usage:"how long to wait for requests in flight on SIGINT or SIGTERM" validate:"min=0s"`
+	ClientTimeout   time.Duration `default:"2s" usage:"how long a request to another service may take, retries included" validate:"min=1ms"`
+	OTLP            string        `usage:"OpenTelemetry collector to export breaker metrics to over OTLP/HTTP, e.g. http://localhost:4318"`
+	Traces          string        `default:"off" usage:"where to send traces of requests: off, log, or otlp for the -otlp collector" validate:"oneof=off|log|otlp"`
+	Log             struct {
+		Format string `default:"text" usage:"format of the log: text or json" validate:"oneof=text|json"`
+	}
+
+	// Defaults apply to the breakers of the routes and of the hosts the
+	// client calls.
+	Defaults struct {
+		MinRequests int           `default:"10" usage:"requests a breaker sees before it may open" validate:"min=1"`
+		OpenTimeout time.Duration `default:"10s" usage:"how long a breaker stays open before it lets a probe through" validate:"min=1ms"`
+	}
+
+	// MyService configures the breaker and the bulkhead of the service
+	// behind /.
+	MyService struct {
+		Timeout       time.Duration `default:"1s" usage:"how long a call to my_service may take before it counts as failed" validate:"min=1ms"`
+		MinRequests   int           `default:"4" usage:"requests the my_service breaker sees before it may open" validate:"min=1"`
+		FailureRatio  float64       `default:"0.25" usage:"share of failed calls that opens the my_service breaker" validate:"min=0,max=1"`
+		OpenTimeout   time.Duration `default:"5s" usage:"how long the my_service breaker stays open" validate:"min=1ms"`
+		MaxConcurrent int           `default:"20" usage:"calls to my_service in flight at once" validate:"min=1"`
+		MaxQueue      int           `default:"10" usage:"calls waiting for the my_service bulkhead" validate:"min=0"`
+		QueueTimeout  time.Duration `default:"100ms" usage:"how long a call waits for the my_service bulkhead" validate:"min=0s"`
+		ReadyQueue    int           `default:"10" usage:"calls waiting for the my_service bulkhead at which the server stops being ready" validate:"min=1"`
+	}
+
+	// Status configures the bulkhead of the service behind /status.
+	Status struct {
+		MaxConcurrent int           `default:"5" usage:"calls to the status service in flight at once" validate:"min=1"`
+		QueueTimeout  time.Duration `default:"50ms" usage:"how long a call waits for the status bulkhead" validate:"min=0s"`
+	}
+
+	// Proxy configures the caching proxy of /upstream/.
+	Proxy struct {
+		TTL                  time.Duration `default:"30s" usage:"how long the proxy serves a response from its cache" validate:"min=0s"`
+		StaleWhileRevalidate time.Duration `default:"30s" usage:"how long after it expires a response is served while the proxy refreshes it" validate:"min=0s"`
+		StaleIfError         time.Duration `default:"5m" usage:"how long after it expires a response is served while the upstream fails" validate:"min=0s"`
+		Rate                 float64       `default:"5" usage:"requests per second each client may send through the proxy, 0 for no limit" validate:"min=0"`
+		Burst                int           `default:"10" usage:"requests a client may send at once before -proxy-rate applies" validate:"min=1"`
+	}
+}
+
+// loadSettings loads the settings of the command line.
+func loadSettings() (settings, error) {
+	var s settings
+	err := config.Load(&s, config.Options{EnvPrefix: "BREAKER"})
+	return s, err
+}
@@ -0,0 +1,121 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/config/config"
+)
+
+// Settings are the settings of a made-up service. Every setting has a
+// default, and the file, the environment and the flags may change it.
+type Settings struct {
+	Addr     string        `default:":8080" usage:"address to listen on" validate:"required"`
+	LogLevel string        `default:"info" usage:"lowest level logged" validate:"oneof=debug|info|warn|error"`
+	Timeout  time.Duration `default:"2s" usage:"how long a request may take" validate:"min=1ms"`
+	Admins   []string      `usage:"comma-separated admin users"`
+	Breaker  struct {
+		MinRequests  int           `default:"10" usage:"requests before the breaker may open" validate:"min=1"`
+		FailureRatio float64       `default:"0.5" usage:"share of failed requests that opens the breaker" validate:"min=0,max=1"`
+		OpenTimeout  time.Duration `default:"10s" usage:"how long the breaker stays open"`
+	}
+	// The token is only read from the environment, to keep it out of
+	// files and the process list.
+	Token string `flag:"-" validate:"required"`
+}
+
+// load loads settings from file, the fake environment env and args, with
+// the variables prefixed by DEMO.
+func load(file string, env map[string]string, args ...string) (Settings, error) {
+	var s Settings
+	err := config.Load(&s, config.Options{
+		EnvPrefix: "DEMO",
+		FlagSet:   flag.NewFlagSet("demo", flag.ContinueOnError),
+		Args:      append([]string{}, args...), // nil would mean the command line
+		File:      file,
+		LookupEnv: func(key string) (string, bool) {
+			v, ok := env[key]
+			return v, ok
+		},
+	})
+	return s, err
+}
+
+func show(s Settings, err error) {
+	if err != nil {
+		fmt.Printf("  error:\n    %s\n", strings.ReplaceAll(err.Error(), "\n", "\n    "))
+		return
+	}
+	fmt.Printf("  addr=%s log-level=%s timeout=%s admins=%v token=%s\n", s.Addr, s.LogLevel, s.Timeout, s.Admins, strings.Repeat("*", len(s.Token)))
+	fmt.Printf("  breaker: min-requests=%d failure-ratio=%g open-timeout=%s\n", s.Breaker.MinRequests, s.Breaker.FailureRatio, s.Breaker.OpenTimeout)
+}
+
+func main() {
+	dir, err := os.MkdirTemp("", "config")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Chdir(dir)
+	file := "service.yaml"
+	os.WriteFile(file, []byte(`# Settings for production.
+addr: ":9000"
+admins:
+  - alice
+  - bob
+breaker:
+  min-requests: 20
+  open-timeout: 30s
+`), 0o644)
+
+	env := map[string]string{"DEMO_TOKEN": "s3cret"}
+
+	fmt.Println("defaults and the token:")
+	show(load("", env))
+
+	fmt.Println("with the file:")
+	show(load(file, env))
+
+	fmt.Println("with the file, and the environment overriding it:")
+	env["DEMO_BREAKER_MIN_REQUESTS"] = "5"
+	show(load(file, env))
+
+	fmt.Println("with the file and the environment, and flags overriding both:")
+	show(load(file, env, "-breaker-min-requests=3", "-log-level=debug"))
+
+	fmt.Println("with mistakes in every layer:")
+	bad := "bad.json"
+	os.WriteFile(bad, []byte(`{"addr": "", "breaker": {"failure-ratio": 1.5, "open-timout": "1m"}}`), 0o644)
+	show(load(bad, map[string]string{"DEMO_TIMEOUT": "soon"}, "-log-level=verbose"))
+}
@@ -0,0 +1,434 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package config loads the settings of a program into a struct from four
+// layers, each overriding the one before: the defaults in the struct's tags,
+// a JSON or YAML file, environment variables and command line flags. The
+// struct's tags name every setting once, and the file key, the variable and
+// the flag are derived from that name, so the layers cannot drift apart.
+// Once loaded, the settings are validated against the rules in the tags.
+//
+//	type Config struct {
+//	    Port  string        `default:":8000" usage:"address to listen on"`
+//	    Rate  float64       `default:"5" validate:"min=0"`
+//	    Drain time.Duration `config:"drain-timeout" default:"30s"`
+//	}
+//
+// With the prefix "CHAT", Rate is set by the file key "rate", the variable
+// CHAT_RATE and the flag -rate.
+package config
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Options says where Load looks for settings. The zero value loads flags
+// from the command line and variables from the environment, without a
+// prefix, and reads a file only if the -config flag names one.
+type Options struct {
+	// EnvPrefix is put in front of every variable name, followed by an
+	// underscore: with "CHAT", the setting "drain-timeout" is read from
+	// CHAT_DRAIN_TIMEOUT.
+	EnvPrefix string
+	// FlagSet receives a flag per setting (flag.CommandLine). Load parses
+	// it with Args (os.Args[1:]).
+	FlagSet *flag.FlagSet
+	Args    []string
+	// File is the file read when neither the file flag nor its variable
+	// names one. Empty means no file.
+	File string
+	// FileFlag names the flag, and with EnvPrefix the variable, that
+	// selects the file ("config").
+	FileFlag string
+	// LookupEnv reads a variable (os.LookupEnv).
+	LookupEnv func(key string) (string, bool)
+}
+
+func (o Options) withDefaults() Options {
+	if o.FlagSet == nil {
+		o.FlagSet = flag.CommandLine
+	}
+	if o.Args == nil {
+		o.Args = os.Args[1:]
+	}
+	if o.FileFlag == "" {
+		o.FileFlag = "config"
+	}
+	if o.LookupEnv == nil {
+		o.LookupEnv = os.LookupEnv
+	}
+	return o
+}
+
+// A setting is one field of the struct, found by walking it. Its name is
+// the field's config tag, or the field name in kebab case, such as
+// "drain-timeout" for DrainTimeout. A field of a nested struct is named
+// after the struct's field as well: "timeout" in Breaker is
+// "breaker.timeout" in a file, -breaker-timeout as a flag and
+// BREAKER_TIMEOUT as a variable.
+type setting struct {
+	path  []string // the names from the top of the struct down
+	value reflect.Value
+	def   string // default tag
+	usage string // usage tag, for the flag
+	rules string // validate tag
+	env   string // variable name, empty if the env tag is "-"
+	flag  string // flag name, empty if the flag tag is "-"
+}
+
+func (s *setting) name() string { return strings.Join(s.path, ".") }
+
+// Load fills dst, a pointer to a struct, from the layers in order:
+//
+//  1. the default tag of each field; fields without one keep the value
+//     they have, so a caller can set defaults in code as well,
+//  2. the file, if there is one,
+//  3. the environment,
+//  4. the flags set on the command line.
+//
+// It then checks every validate tag. Load reports every problem it finds
+// rather than the first, each with where the bad value came from.
+//
+// Fields are bound by these tags:
+//
+//	config:"name"      the name of the setting; "-" skips the field
+//	default:"value"    the default, in the format of the flag
+//	usage:"text"       the flag's help text
+//	env:"NAME"         the variable, instead of the derived one; "-" for none
+//	flag:"name"        the flag, instead of the derived one; "-" for none
+//	validate:"rules"   see Validate
+//
+// Fields may be strings, booleans, integers, floats, time.Durations,
+// slices of strings, which flags and variables give comma-separated, and
+// any type implementing encoding.TextUnmarshaler.
+func Load(dst interface{}, opts Options) error {
+	opts = opts.withDefaults()
+	settings, err := walk(dst)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, s := range settings {
+		if s.def == "" {
+			continue
+		}
+		if err := set(s.value, s.def); err != nil {
+			errs = append(errs, fmt.Errorf("default of %s: %w", s.name(), err))
+		}
+	}
+	if len(errs) > 0 {
+		// A bad default is a bug in the program, not in its configuration.
+		return errors.Join(errs...)
+	}
+
+	// Flags are parsed first, to find the file, but applied last. Their
+	// values are checked as they are parsed, so a malformed one is
+	// reported with the usage like any other flag error.
+	fs := opts.FlagSet
+	file := fs.String(opts.FileFlag, "", "JSON or YAML file to read settings from")
+	flags := make(map[string]*setting)
+	for _, s := range settings {
+		if s.flag == "" {
+			continue
+		}
+		flags[s.flag] = s
+		define(fs, s)
+	}
+	if err := fs.Parse(opts.Args); err != nil {
+		return err
+	}
+
+	path := opts.File
+	if v, ok := opts.LookupEnv(envName(opts.EnvPrefix, []string{opts.FileFlag})); ok {
+		path = v
+	}
+	if *file != "" {
+		path = *file
+	}
+	if path != "" {
+		errs = append(errs, loadFile(path, settings)...)
+	}
+
+	for _, s := range settings {
+		if s.env == "" {
+			continue
+		}
+		name := envName(opts.EnvPrefix, []string{s.env})
+		v, ok := opts.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := set(s.value, v); err != nil {
+			errs = append(errs, fmt.Errorf("$%s: %w", name, err))
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		if s, ok := flags[f.Name]; ok {
+			// The flag checked the value already.
+			set(s.value, f.Value.String())
+		}
+	})
+
+	return errors.Join(append(errs, Validate(dst))...)
+}
+
+// define defines the flag of s on fs, with the current value of s as its
+// default. The flag holds its value until Load applies it. Types the flag
+// package knows get its flags, so the usage shows their type.
+func define(fs *flag.FlagSet, s *setting) {
+	v := s.value
+	switch {
+	case v.Type() == durationType:
+		fs.Duration(s.flag, time.Duration(v.Int()), s.usage)
+	case v.Kind() == reflect.String && !isText(v):
+		fs.String(s.flag, v.String(), s.usage)
+	case v.Kind() == reflect.Bool && !isText(v):
+		fs.Bool(s.flag, v.Bool(), s.usage)
+	case v.Kind() == reflect.Int:
+		fs.Int(s.flag, int(v.Int()), s.usage)
+	case v.Kind() == reflect.Int64:
+		fs.Int64(s.flag, v.Int(), s.usage)
+	case v.Kind() == reflect.Uint:
+		fs.Uint(s.flag, uint(v.Uint()), s.usage)
+	case v.Kind() == reflect.Uint64:
+		fs.Uint64(s.flag, v.Uint(), s.usage)
+	case v.Kind() == reflect.Float64:
+		fs.Float64(s.flag, v.Float(), s.usage)
+	default:
+		fs.Var(&flagValue{setting: s, text: format(v)}, s.flag, s.usage)
+	}
+}
+
+// flagValue is the flag of a type the flag package does not know.
+type flagValue struct {
+	setting *setting
+	text    string
+}
+
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.text
+}
+
+func (v *flagValue) Set(text string) error {
+	if err := set(reflect.New(v.setting.value.Type()).Elem(), text); err != nil {
+		return err
+	}
+	v.text = text
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.setting.value.Kind() == reflect.Bool
+}
+
+// walk returns the settings of the struct dst points to.
+func walk(dst interface{}) ([]*setting, error) {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config: want a pointer to a struct, not %T", dst)
+	}
+	var settings []*setting
+	walkStruct(v.Elem(), nil, &settings)
+	return settings, nil
+}
+
+func walkStruct(v reflect.Value, path []string, settings *[]*setting) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Tag.Get("config")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = kebab(field.Name)
+		}
+		fieldPath := append(append([]string(nil), path...), name)
+
+		fv := v.Field(i)
+		if field.Type.Kind() == reflect.Struct && !isText(fv) {
+			walkStruct(fv, fieldPath, settings)
+			continue
+		}
+
+		s := &setting{
+			path:  fieldPath,
+			value: fv,
+			def:   field.Tag.Get("default"),
+			usage: field.Tag.Get("usage"),
+			rules: field.Tag.Get("validate"),
+			env:   strings.Join(fieldPath, "_"),
+			flag:  strings.Join(fieldPath, "-"),
+		}
+		if env, ok := field.Tag.Lookup("env"); ok {
+			s.env = env
+			if env == "-" {
+				s.env = ""
+			}
+		}
+		if name, ok := field.Tag.Lookup("flag"); ok {
+			s.flag = name
+			if name == "-" {
+				s.flag = ""
+			}
+		}
+		*settings = append(*settings, s)
+	}
+}
+
+// kebab turns a Go name into a setting name: "DrainTimeout" becomes
+// "drain-timeout" and "TLSCert" becomes "tls-cert".
+func kebab(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// A word starts at an upper case letter after a lower case
+			// one, or at the last upper case letter of an acronym.
+			if i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])) {
+				b.WriteByte('-')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// envName returns the variable of a setting: the parts of its name in
+// upper case, joined with underscores and behind the prefix. An explicit
+// env tag is taken as it is, apart from the prefix.
+func envName(prefix string, parts []string) string {
+	name := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(strings.Join(parts, "_")))
+	if prefix != "" {
+		name = prefix + "_" + name
+	}
+	return name
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func isText(v reflect.Value) bool {
+	return reflect.PointerTo(v.Type()).Implements(textUnmarshalerType)
+}
+
+// set parses text into v.
+func set(v reflect.Value, text string) error {
+	if isText(v) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(text, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(text, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items).Convert(v.Type()))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// format returns v as set would parse it, to show as a flag's default.
+func format(v reflect.Value) string {
+	if m, ok := v.Addr().Interface().(encoding.TextMarshaler); ok {
+		text, _ := m.MarshalText()
+		return string(text)
+	}
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	if v.Kind() == reflect.Slice {
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = v.Index(i).String()
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,129 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// loadFile applies the settings in the file at path. Files ending in .json
+// are JSON; everything else is read as YAML, of which JSON is a subset for
+// this purpose. A key that names no setting is an error, so a misspelled
+// setting does not go unnoticed.
+func loadFile(path string, settings []*setting) []error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []error{err}
+	}
+	var doc map[string]interface{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &doc)
+	} else {
+		doc, err = parseYAML(data)
+	}
+	if err != nil {
+		return []error{fmt.Errorf("%s: %w", path, err)}
+	}
+
+	byName := make(map[string]*setting, len(settings))
+	for _, s := range settings {
+		byName[s.name()] = s
+	}
+	var errs []error
+	apply(doc, "", func(name string, value interface{}) {
+		s, ok := byName[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %s", path, name))
+			return
+		}
+		if value == nil {
+			// An empty key leaves the setting as it is.
+			return
+		}
+		text, err := scalarText(value)
+		if err == nil {
+			err = set(s.value, text)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", path, name, err))
+		}
+	})
+	return errs
+}
+
+// apply calls fn with the dotted name and value of every leaf of doc, in
+// the order of the names.
+func apply(doc map[string]interface{}, prefix string, fn func(name string, value interface{})) {
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := prefix + key
+		if nested, ok := doc[key].(map[string]interface{}); ok {
+			apply(nested, name+".", fn)
+			continue
+		}
+		fn(name, doc[key])
+	}
+}
+
+// scalarText turns a value of a file into the text set parses. A list
+// becomes a comma-separated one.
+func scalarText(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			text, err := scalarText(item)
+			if err != nil {
+				return "", err
+			}
+			if strings.Contains(text, ",") {
+				return "", fmt.Errorf("list item %q contains a comma", text)
+			}
+			items[i] = text
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", value)
+}
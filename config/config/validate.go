@@ -0,0 +1,133 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validate checks the validate tags of the struct dst points to. Load
+// calls it; programs that change their settings afterwards, such as from
+// an admin endpoint, can call it again. A tag holds comma-separated rules:
+//
+//	required      the value is not the zero value
+//	min=N, max=N  a number or duration is at least or at most N; a string
+//	              or list has at least or at most N elements
+//	oneof=a|b|c   the value is one of those given
+//
+// Every broken rule is reported, with the setting's name.
+func Validate(dst interface{}) error {
+	settings, err := walk(dst)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, s := range settings {
+		if s.rules == "" {
+			continue
+		}
+		for _, rule := range strings.Split(s.rules, ",") {
+			if err := check(s.value, strings.TrimSpace(rule)); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.name(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func check(v reflect.Value, rule string) error {
+	name, arg, _ := strings.Cut(rule, "=")
+	switch name {
+	case "required":
+		if v.IsZero() {
+			return errors.New("is required")
+		}
+	case "min", "max":
+		limit, err := number(v.Type(), arg)
+		if err != nil {
+			return fmt.Errorf("invalid rule %s: %w", rule, err)
+		}
+		n, isLen := measure(v)
+		if name == "min" && n < limit {
+			if isLen {
+				return fmt.Errorf("needs at least %s elements", arg)
+			}
+			return fmt.Errorf("must be at least %s, not %s", arg, format(v))
+		}
+		if name == "max" && n > limit {
+			if isLen {
+				return fmt.Errorf("may have at most %s elements", arg)
+			}
+			return fmt.Errorf("must be at most %s, not %s", arg, format(v))
+		}
+	case "oneof":
+		options := strings.Split(arg, "|")
+		value := format(v)
+		for _, option := range options {
+			if value == option {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s, not %q", strings.Join(options, ", "), value)
+	default:
+		return fmt.Errorf("unknown rule %q", rule)
+	}
+	return nil
+}
+
+// number parses the argument of min or max for a field of type t: a
+// duration for durations, and a number for everything else.
+func number(t reflect.Type, arg string) (float64, error) {
+	if t == durationType {
+		d, err := time.ParseDuration(arg)
+		return float64(d), err
+	}
+	return strconv.ParseFloat(arg, 64)
+}
+
+// measure returns the number min and max compare: the value of a number,
+// or the length of anything else, with whether it is a length.
+func measure(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false
+	case reflect.String, reflect.Slice:
+		return float64(v.Len()), true
+	}
+	return 0, true
+}
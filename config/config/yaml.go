@@ -0,0 +1,211 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the part of YAML that configuration files use: nested
+// mappings of scalars, lists of scalars in block ("- item") or flow
+// ("[a, b]") style, quoted strings and comments. Scalars are returned as
+// strings, to be parsed into the type of their field. Anchors, multi-line
+// strings, lists of mappings and multiple documents are not supported.
+func parseYAML(data []byte) (map[string]interface{}, error) {
+	var lines []yamlLine
+	for i, text := range strings.Split(string(data), "\n") {
+		text = strings.TrimRight(stripComment(text), " \t\r")
+		if strings.TrimSpace(text) == "" || text == "---" {
+			continue
+		}
+		indent := len(text) - len(strings.TrimLeft(text, " "))
+		if strings.HasPrefix(text[indent:], "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed in indentation", i+1)
+		}
+		lines = append(lines, yamlLine{number: i + 1, indent: indent, text: text[indent:]})
+	}
+	p := &yamlParser{lines: lines}
+	doc := map[string]interface{}{}
+	if len(lines) == 0 {
+		return doc, nil
+	}
+	value, err := p.block(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", lines[p.pos].number)
+	}
+	doc, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("line %d: the document must be a mapping", lines[0].number)
+	}
+	return doc, nil
+}
+
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// block parses the mapping or list whose lines are indented by indent.
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	if strings.HasPrefix(p.lines[p.pos].text, "- ") || p.lines[p.pos].text == "-" {
+		return p.list(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) list(indent int) (interface{}, error) {
+	var items []interface{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		line := p.lines[p.pos]
+		item, ok := strings.CutPrefix(line.text, "-")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected a list item", line.number)
+		}
+		value, err := scalar(strings.TrimSpace(item))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line.number, err)
+		}
+		items = append(items, value)
+		p.pos++
+	}
+	return items, nil
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	m := map[string]interface{}{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		line := p.lines[p.pos]
+		key, rest, ok := strings.Cut(line.text, ":")
+		if !ok || (rest != "" && rest[0] != ' ') {
+			return nil, fmt.Errorf("line %d: expected key: value", line.number)
+		}
+		key = strings.TrimSpace(key)
+		if unquoted, err := scalar(key); err == nil {
+			key, _ = unquoted.(string)
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line.number, key)
+		}
+		p.pos++
+
+		rest = strings.TrimSpace(rest)
+		if rest != "" {
+			value, err := scalar(rest)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line.number, err)
+			}
+			m[key] = value
+			continue
+		}
+		// A key without a value starts a nested block, or is empty.
+		if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+			value, err := p.block(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		} else if p.pos < len(p.lines) && p.lines[p.pos].indent == indent && strings.HasPrefix(p.lines[p.pos].text, "- ") {
+			// Lists may sit at the indentation of their key.
+			value, err := p.list(indent)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		} else {
+			m[key] = nil
+		}
+	}
+	return m, nil
+}
+
+// scalar parses a value on a single line: a quoted or plain string, or a
+// flow list of them.
+func scalar(text string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(text, "["):
+		inner, ok := strings.CutSuffix(text, "]")
+		if !ok {
+			return nil, fmt.Errorf("unterminated list %s", text)
+		}
+		items := []interface{}{}
+		if inner = strings.TrimSpace(inner[1:]); inner == "" {
+			return items, nil
+		}
+		for _, item := range strings.Split(inner, ",") {
+			value, err := scalar(strings.TrimSpace(item))
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		return items, nil
+	case strings.HasPrefix(text, `"`):
+		return strconv.Unquote(text)
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("unterminated string %s", text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case text == "~" || text == "null":
+		return nil, nil
+	case strings.HasPrefix(text, "{"), strings.HasPrefix(text, "&"), strings.HasPrefix(text, "*"), text == "|", text == ">":
+		return nil, fmt.Errorf("unsupported YAML %s", text)
+	}
+	return text, nil
+}
+
+// stripComment removes a comment from a line: a # at its start or after a
+// space, outside quotes.
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case (r == '"' || r == '\'') && (i == 0 || strings.ContainsRune(" \t:[,-", rune(line[i-1]))):
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
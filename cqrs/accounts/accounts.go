@@ -0,0 +1,198 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package accounts is the write side of the example: the commands that
+// change bank accounts, the Account aggregate that decides whether they
+// may, and the events it records. Accounts are event sourced, so the
+// events in the store are the only state.
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rajamummidi/go-design-patterns/cqrs/cqrs"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventstore"
+)
+
+var (
+	ErrAccountExists     = errors.New("account already exists")
+	ErrNoAccount         = errors.New("no such account")
+	ErrInvalidAmount     = errors.New("amount must be positive")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+)
+
+type OpenAccount struct {
+	ID    string
+	Owner string
+}
+
+type Deposit struct {
+	ID     string
+	Amount int64
+}
+
+type Withdraw struct {
+	ID     string
+	Amount int64
+}
+
+func (OpenAccount) CommandName() string { return "open-account" }
+func (Deposit) CommandName() string     { return "deposit" }
+func (Withdraw) CommandName() string    { return "withdraw" }
+
+// The events accounts publish on the bus, all under "account.".
+const (
+	Opened    = "account.opened"
+	Deposited = "account.deposited"
+	Withdrawn = "account.withdrawn"
+)
+
+type AccountOpened struct {
+	ID    string `json:"id"`
+	Owner string `json:"owner"`
+}
+
+type MoneyDeposited struct {
+	ID     string `json:"id"`
+	Amount int64  `json:"amount"`
+}
+
+type MoneyWithdrawn struct {
+	ID     string `json:"id"`
+	Amount int64  `json:"amount"`
+}
+
+// Account is rebuilt from its events before every command.
+type Account struct {
+	ID      string `json:"id"`
+	Owner   string `json:"owner"`
+	Balance int64  `json:"balance"`
+}
+
+func (a *Account) Apply(record eventstore.Record) error {
+	switch record.Type {
+	case Opened:
+		var e AccountOpened
+		if err := record.Decode(&e); err != nil {
+			return err
+		}
+		a.ID, a.Owner = e.ID, e.Owner
+	case Deposited:
+		var e MoneyDeposited
+		if err := record.Decode(&e); err != nil {
+			return err
+		}
+		a.Balance += e.Amount
+	case Withdrawn:
+		var e MoneyWithdrawn
+		if err := record.Decode(&e); err != nil {
+			return err
+		}
+		a.Balance -= e.Amount
+	}
+	return nil
+}
+
+func stream(id string) string {
+	return "account-" + id
+}
+
+type handlers struct {
+	store  eventstore.EventStore
+	events *eventbus.EventBus
+}
+
+// Register adds the account command handlers to commands. They append the
+// resulting events to store and then publish them on events.
+func Register(commands *cqrs.CommandBus, store eventstore.EventStore, events *eventbus.EventBus) {
+	h := &handlers{store: store, events: events}
+	cqrs.HandleCommand(commands, h.open)
+	cqrs.HandleCommand(commands, h.deposit)
+	cqrs.HandleCommand(commands, h.withdraw)
+}
+
+func (h *handlers) open(ctx context.Context, cmd OpenAccount) error {
+	account, version, err := h.load(cmd.ID)
+	if err != nil {
+		return err
+	}
+	if account.ID != "" {
+		return fmt.Errorf("%s: %w", cmd.ID, ErrAccountExists)
+	}
+	return h.record(cmd.ID, version, Opened, AccountOpened{ID: cmd.ID, Owner: cmd.Owner})
+}
+
+func (h *handlers) deposit(ctx context.Context, cmd Deposit) error {
+	if cmd.Amount <= 0 {
+		return ErrInvalidAmount
+	}
+	account, version, err := h.load(cmd.ID)
+	if err != nil {
+		return err
+	}
+	if account.ID == "" {
+		return fmt.Errorf("%s: %w", cmd.ID, ErrNoAccount)
+	}
+	return h.record(cmd.ID, version, Deposited, MoneyDeposited{ID: cmd.ID, Amount: cmd.Amount})
+}
+
+func (h *handlers) withdraw(ctx context.Context, cmd Withdraw) error {
+	if cmd.Amount <= 0 {
+		return ErrInvalidAmount
+	}
+	account, version, err := h.load(cmd.ID)
+	if err != nil {
+		return err
+	}
+	if account.ID == "" {
+		return fmt.Errorf("%s: %w", cmd.ID, ErrNoAccount)
+	}
+	if account.Balance < cmd.Amount {
+		return fmt.Errorf("%s: %w", cmd.ID, ErrInsufficientFunds)
+	}
+	return h.record(cmd.ID, version, Withdrawn, MoneyWithdrawn{ID: cmd.ID, Amount: cmd.Amount})
+}
+
+func (h *handlers) load(id string) (Account, uint64, error) {
+	var account Account
+	version, err := eventstore.Rebuild(h.store, nil, stream(id), &account)
+	return account, version, err
+}
+
+// record appends the event, expecting the stream to still be at version,
+// so that two commands racing on one account cannot both succeed on stale
+// state. Only then is the event published.
+func (h *handlers) record(id string, version uint64, eventType string, event interface{}) error {
+	if _, err := h.store.Append(stream(id), int64(version), eventType, event); err != nil {
+		return err
+	}
+	return h.events.Dispatch(eventType, event)
+}
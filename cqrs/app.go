@@ -0,0 +1,110 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/cqrs/accounts"
+	"github.com/rajamummidi/go-design-patterns/cqrs/cqrs"
+	"github.com/rajamummidi/go-design-patterns/cqrs/readmodel"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventstore"
+)
+
+// logCommands is command middleware that reports every command and its
+// outcome.
+func logCommands(next cqrs.CommandHandler) cqrs.CommandHandler {
+	return func(ctx context.Context, cmd cqrs.Command) error {
+		err := next(ctx, cmd)
+		if err != nil {
+			fmt.Printf("%-13s %+v: %v\n", cmd.CommandName(), cmd, err)
+		} else {
+			fmt.Printf("%-13s %+v\n", cmd.CommandName(), cmd)
+		}
+		return err
+	}
+}
+
+func main() {
+	ctx := context.Background()
+
+	// A queued bus with a single worker: events reach the projection in
+	// order, but after the command has returned.
+	events := eventbus.NewQueuedEventBus(eventbus.QueueConfig{Size: 100, Workers: 1})
+	store := eventstore.NewMemoryStore()
+
+	commands := cqrs.NewCommandBus()
+	commands.Use(logCommands)
+	accounts.Register(commands, store, events)
+
+	queries := cqrs.NewQueryBus()
+	projection := readmodel.NewProjection()
+	projection.Subscribe(events)
+	projection.Register(queries)
+
+	// Slow the projection down a little so that the lag is visible.
+	events.Register("account.*", eventbus.DefaultPriority+1, func(eventbus.Event) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+
+	for _, cmd := range []cqrs.Command{
+		accounts.OpenAccount{ID: "acc-1", Owner: "Alice"},
+		accounts.OpenAccount{ID: "acc-2", Owner: "Bob"},
+		accounts.Deposit{ID: "acc-1", Amount: 100_00},
+		accounts.Deposit{ID: "acc-2", Amount: 250_00},
+		accounts.Withdraw{ID: "acc-1", Amount: 30_00},
+		accounts.Withdraw{ID: "acc-1", Amount: 500_00},
+		accounts.Deposit{ID: "acc-3", Amount: 10_00},
+		accounts.OpenAccount{ID: "acc-1", Owner: "Mallory"},
+	} {
+		commands.Send(ctx, cmd)
+	}
+
+	// The write side has accepted five events; the read side catches up
+	// on its own time.
+	alice, err := cqrs.Ask[readmodel.AccountSummary](ctx, queries, readmodel.GetAccount{ID: "acc-1"})
+	fmt.Printf("\nright away, after %d of 5 events: %+v %v\n", projection.Applied(), alice, err)
+
+	events.Close(ctx)
+
+	alice, _ = cqrs.Ask[readmodel.AccountSummary](ctx, queries, readmodel.GetAccount{ID: "acc-1"})
+	fmt.Printf("once caught up, after %d events:  %+v\n", projection.Applied(), alice)
+
+	list, _ := cqrs.Ask[[]readmodel.AccountSummary](ctx, queries, readmodel.ListAccounts{})
+	fmt.Println("\naccounts, richest first:")
+	for _, a := range list {
+		fmt.Printf("  %s %-6s %8.2f in %d transactions\n", a.ID, a.Owner, float64(a.Balance)/100, a.Transactions)
+	}
+	totals, _ := cqrs.Ask[readmodel.Totals](ctx, queries, readmodel.GetTotals{})
+	fmt.Printf("totals: %+v\n", totals)
+}
@@ -0,0 +1,172 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package cqrs provides the two buses of Command Query Responsibility
+// Segregation: a command bus that routes each command to the one handler
+// that changes state, and a query bus that routes each query to the read
+// model that answers it.
+package cqrs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNoHandler is returned when nothing handles a command or query.
+var ErrNoHandler = errors.New("cqrs: no handler")
+
+// Command asks the system to change. Its name routes it to its handler.
+type Command interface {
+	CommandName() string
+}
+
+// Query asks the system a question without changing it.
+type Query interface {
+	QueryName() string
+}
+
+type CommandHandler func(ctx context.Context, cmd Command) error
+
+// CommandMiddleware wraps every command handler, for cross-cutting concerns
+// such as logging, validation or authorization.
+type CommandMiddleware func(next CommandHandler) CommandHandler
+
+type CommandBus struct {
+	mu         sync.RWMutex
+	handlers   map[string]CommandHandler
+	middleware []CommandMiddleware
+}
+
+func NewCommandBus() *CommandBus {
+	return &CommandBus{handlers: make(map[string]CommandHandler)}
+}
+
+// Handle registers the handler for commands called name. A command has
+// exactly one handler, so registering a second one panics.
+func (b *CommandBus) Handle(name string, handler CommandHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.handlers[name]; ok {
+		panic("cqrs: second handler for command " + name)
+	}
+	b.handlers[name] = handler
+}
+
+// Use adds middleware; the first added runs outermost.
+func (b *CommandBus) Use(mw ...CommandMiddleware) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.middleware = append(b.middleware, mw...)
+}
+
+// Send runs the handler of cmd and returns its error. Commands return
+// nothing else: whoever wants to see the result asks a query.
+func (b *CommandBus) Send(ctx context.Context, cmd Command) error {
+	b.mu.RLock()
+	handler, ok := b.handlers[cmd.CommandName()]
+	middleware := b.middleware
+	b.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%w for command %s", ErrNoHandler, cmd.CommandName())
+	}
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler(ctx, cmd)
+}
+
+type QueryHandler func(ctx context.Context, q Query) (interface{}, error)
+
+type QueryBus struct {
+	mu       sync.RWMutex
+	handlers map[string]QueryHandler
+}
+
+func NewQueryBus() *QueryBus {
+	return &QueryBus{handlers: make(map[string]QueryHandler)}
+}
+
+// Handle registers the handler for queries called name. Registering a
+// second one panics.
+func (b *QueryBus) Handle(name string, handler QueryHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.handlers[name]; ok {
+		panic("cqrs: second handler for query " + name)
+	}
+	b.handlers[name] = handler
+}
+
+// Ask runs the handler of q and returns its answer.
+func (b *QueryBus) Ask(ctx context.Context, q Query) (interface{}, error) {
+	b.mu.RLock()
+	handler, ok := b.handlers[q.QueryName()]
+	b.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w for query %s", ErrNoHandler, q.QueryName())
+	}
+	return handler(ctx, q)
+}
+
+// HandleCommand registers a handler for the command type C, whose name is
+// taken from C's zero value.
+func HandleCommand[C Command](b *CommandBus, handler func(ctx context.Context, cmd C) error) {
+	var zero C
+	b.Handle(zero.CommandName(), func(ctx context.Context, cmd Command) error {
+		return handler(ctx, cmd.(C))
+	})
+}
+
+// HandleQuery registers a handler for the query type Q.
+func HandleQuery[Q Query, R any](b *QueryBus, handler func(ctx context.Context, q Q) (R, error)) {
+	var zero Q
+	b.Handle(zero.QueryName(), func(ctx context.Context, q Query) (interface{}, error) {
+		return handler(ctx, q.(Q))
+	})
+}
+
+// Ask is QueryBus.Ask with a typed answer.
+func Ask[R any](ctx context.Context, b *QueryBus, q Query) (R, error) {
+	var zero R
+	answer, err := b.Ask(ctx, q)
+	if err != nil {
+		return zero, err
+	}
+	r, ok := answer.(R)
+	if !ok {
+		return zero, fmt.Errorf("cqrs: query %s answered with %T, not %T", q.QueryName(), answer, zero)
+	}
+	return r, nil
+}
@@ -0,0 +1,172 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package readmodel is the read side of the example. A projection listens
+// to the account events on the bus and keeps denormalized summaries that
+// queries can answer without touching the event store.
+package readmodel
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/rajamummidi/go-design-patterns/cqrs/accounts"
+	"github.com/rajamummidi/go-design-patterns/cqrs/cqrs"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+)
+
+var ErrNotFound = errors.New("readmodel: account not found")
+
+// AccountSummary is shaped for the screens that show it, not for the
+// rules that change it.
+type AccountSummary struct {
+	ID           string
+	Owner        string
+	Balance      int64
+	Transactions int
+}
+
+// Totals is an aggregate over all accounts that would be expensive to
+// compute from the events on every request.
+type Totals struct {
+	Accounts    int
+	Deposits    int64
+	Withdrawals int64
+}
+
+type GetAccount struct {
+	ID string
+}
+
+// ListAccounts returns the accounts, richest first.
+type ListAccounts struct{}
+
+type GetTotals struct{}
+
+func (GetAccount) QueryName() string   { return "get-account" }
+func (ListAccounts) QueryName() string { return "list-accounts" }
+func (GetTotals) QueryName() string    { return "get-totals" }
+
+// Projection keeps the read model up to date.
+type Projection struct {
+	mu       sync.RWMutex
+	accounts map[string]*AccountSummary
+	totals   Totals
+	applied  uint64
+}
+
+func NewProjection() *Projection {
+	return &Projection{accounts: make(map[string]*AccountSummary)}
+}
+
+// Subscribe makes the projection follow the account events on bus.
+func (p *Projection) Subscribe(bus *eventbus.EventBus) {
+	bus.Register("account.*", eventbus.DefaultPriority, func(event eventbus.Event) error {
+		p.apply(event.Data)
+		return nil
+	})
+}
+
+func (p *Projection) apply(event interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch e := event.(type) {
+	case accounts.AccountOpened:
+		p.accounts[e.ID] = &AccountSummary{ID: e.ID, Owner: e.Owner}
+		p.totals.Accounts++
+	case accounts.MoneyDeposited:
+		if a, ok := p.accounts[e.ID]; ok {
+			a.Balance += e.Amount
+			a.Transactions++
+		}
+		p.totals.Deposits += e.Amount
+	case accounts.MoneyWithdrawn:
+		if a, ok := p.accounts[e.ID]; ok {
+			a.Balance -= e.Amount
+			a.Transactions++
+		}
+		p.totals.Withdrawals += e.Amount
+	default:
+		return
+	}
+	p.applied++
+}
+
+// Applied is the number of events the projection has seen, which tells
+// callers how far behind the write side it is.
+func (p *Projection) Applied() uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.applied
+}
+
+// Register adds the projection's query handlers to queries.
+func (p *Projection) Register(queries *cqrs.QueryBus) {
+	cqrs.HandleQuery(queries, p.getAccount)
+	cqrs.HandleQuery(queries, p.listAccounts)
+	cqrs.HandleQuery(queries, p.getTotals)
+}
+
+func (p *Projection) getAccount(ctx context.Context, q GetAccount) (AccountSummary, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	a, ok := p.accounts[q.ID]
+	if !ok {
+		return AccountSummary{}, ErrNotFound
+	}
+	return *a, nil
+}
+
+func (p *Projection) listAccounts(ctx context.Context, q ListAccounts) ([]AccountSummary, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	list := make([]AccountSummary, 0, len(p.accounts))
+	for _, a := range p.accounts {
+		list = append(list, *a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Balance != list[j].Balance {
+			return list[i].Balance > list[j].Balance
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+func (p *Projection) getTotals(ctx context.Context, q GetTotals) (Totals, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.totals, nil
+}
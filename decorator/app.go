@@ -0,0 +1,98 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/decorator/decorator"
+)
+
+// flaky answers every third request with 503 Service Unavailable.
+func flaky() http.Handler {
+	var requests atomic.Int64
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1)%3 == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, strings.Repeat("Hello, decorated world! ", 20))
+	})
+}
+
+func main() {
+	logger := log.New(os.Stdout, "server: ", 0)
+
+	// The handler knows nothing of logging, authentication or compression.
+	handler := decorator.Chain(flaky(),
+		decorator.Logging(logger),
+		decorator.BearerAuth(func(token string) bool { return token == "secret" }),
+		decorator.Gzip(),
+	)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// Neither does the client code below know of retries or tokens.
+	client := &http.Client{
+		Transport: decorator.ChainTransport(nil,
+			decorator.Retry(decorator.RetryConfig{Attempts: 3, Backoff: 10 * time.Millisecond}),
+			decorator.Bearer("secret"),
+		),
+	}
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL + "/hello")
+		if err != nil {
+			fmt.Println("client:", err)
+			continue
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		// The transport decompresses the body and drops the header when it
+		// asked for gzip itself; Uncompressed says it did.
+		fmt.Printf("client: %s, %d bytes, decompressed: %t\n", resp.Status, len(body), resp.Uncompressed)
+	}
+
+	// Without the token the request never reaches the handler.
+	resp, err := http.Get(server.URL + "/hello")
+	if err != nil {
+		fmt.Println("client:", err)
+		return
+	}
+	resp.Body.Close()
+	fmt.Println("client without token:", resp.Status)
+}
@@ -0,0 +1,208 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package decorator
+
+import (
+	"compress/gzip"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Middleware decorates a handler with behaviour of its own. Functions of
+// the type func(http.Handler) http.Handler, such as the Middleware of the
+// circuitbreaker package, can be passed wherever a Middleware is expected.
+type Middleware func(http.Handler) http.Handler
+
+// Chain decorates h with ms. The first middleware is the outermost, so it
+// sees a request first and its response last.
+func Chain(h http.Handler, ms ...Middleware) http.Handler {
+	for i := len(ms) - 1; i >= 0; i-- {
+		h = ms[i](h)
+	}
+	return h
+}
+
+// Then combines ms into a single middleware, which can be reused in front
+// of several handlers.
+func Then(ms ...Middleware) Middleware {
+	return func(h http.Handler) http.Handler {
+		return Chain(h, ms...)
+	}
+}
+
+// recorder remembers the status a handler answered with.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *recorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += n
+	return n, err
+}
+
+func (w *recorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Logging logs every request with its status, size and duration to logger,
+// or to the standard logger if logger is nil.
+func Logging(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &recorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			logger.Printf("%s %s %d %dB %s", r.Method, r.URL.RequestURI(), rec.status, rec.bytes, time.Since(start).Round(time.Microsecond))
+		})
+	}
+}
+
+// BearerAuth lets a request through only if it carries a bearer token that
+// valid accepts. Other requests are answered with 401 Unauthorized.
+func BearerAuth(valid func(token string) bool) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || !valid(token) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Gzip compresses responses for clients that accept gzip. Responses that
+// are already encoded, and responses without a body, are left alone.
+func Gzip() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsGzip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			gw := &gzipWriter{ResponseWriter: w, head: r.Method == http.MethodHead}
+			defer gw.close()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, coding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, _, _ = strings.Cut(coding, ";")
+		if strings.TrimSpace(coding) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipWriter decides whether to compress when the status is written, and
+// creates the gzip.Writer only once there is a body to compress.
+type gzipWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	head        bool
+	wroteHeader bool
+	compress    bool
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	w.compress = !w.head && status != http.StatusNoContent && status != http.StatusNotModified &&
+		h.Get("Content-Encoding") == ""
+	if w.compress {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		// Sniff the type from the plain body; net/http would otherwise
+		// sniff the compressed one.
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.compress {
+		return w.ResponseWriter.Write(p)
+	}
+	if w.gz == nil {
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	return w.gz.Write(p)
+}
+
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *gzipWriter) close() {
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
@@ -0,0 +1,166 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package decorator
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// RoundTripperFunc adapts a function to an http.RoundTripper.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Tripperware decorates a round tripper, the client side counterpart of
+// Middleware.
+type Tripperware func(http.RoundTripper) http.RoundTripper
+
+// ChainTransport decorates base, http.DefaultTransport if nil, with ts. The
+// first tripperware is the outermost, so it sees a request first and its
+// response last.
+func ChainTransport(base http.RoundTripper, ts ...Tripperware) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	for i := len(ts) - 1; i >= 0; i-- {
+		base = ts[i](base)
+	}
+	return base
+}
+
+// Bearer sends token as the bearer token of every request that carries no
+// Authorization header of its own.
+func Bearer(token string) Tripperware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("Authorization") != "" {
+				return next.RoundTrip(req)
+			}
+			// A round tripper must not modify the caller's request.
+			req = req.Clone(req.Context())
+			req.Header.Set("Authorization", "Bearer "+token)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// RetryConfig configures Retry.
+type RetryConfig struct {
+	// Attempts bounds how often a request is sent, 3 if zero.
+	Attempts int
+	// Backoff is the wait before the first retry, which doubles for every
+	// retry after it. 100ms if zero.
+	Backoff time.Duration
+	// Retryable tells whether a response or error is worth another attempt.
+	// If nil, transport errors and 502, 503 and 504 responses are.
+	Retryable func(resp *http.Response, err error) bool
+}
+
+func (c RetryConfig) withDefaults() RetryConfig {
+	if c.Attempts <= 0 {
+		c.Attempts = 3
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = 100 * time.Millisecond
+	}
+	if c.Retryable == nil {
+		c.Retryable = retryable
+	}
+	return c
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// idempotent reports whether req may be sent more than once. Requests with
+// a body qualify only if the body can be sent again.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// Retry sends idempotent requests again while config.Retryable says so.
+// The last response or error is returned once the attempts are used up or
+// the request's context ends. For jittered and capped delays, see the
+// retry module.
+func Retry(config RetryConfig) Tripperware {
+	config = config.withDefaults()
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if !idempotent(req) {
+				return next.RoundTrip(req)
+			}
+			backoff := config.Backoff
+			for attempt := 1; ; attempt++ {
+				resp, err := next.RoundTrip(req)
+				if attempt == config.Attempts || !config.Retryable(resp, err) {
+					return resp, err
+				}
+
+				timer := time.NewTimer(backoff)
+				select {
+				case <-req.Context().Done():
+					timer.Stop()
+					return resp, err
+				case <-timer.C:
+				}
+				backoff *= 2
+
+				if req.GetBody != nil {
+					body, bodyErr := req.GetBody()
+					if bodyErr != nil {
+						return resp, err
+					}
+					req = req.Clone(req.Context())
+					req.Body = body
+				}
+				if resp != nil {
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/rajamummidi/go-design-patterns/decorator
+
+go 1.20
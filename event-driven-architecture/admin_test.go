@@ -0,0 +1,229 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/golden/golden"
+	"github.com/rajamummidi/go-design-patterns/health/health"
+)
+
+// get sends a request to h and returns the body of the response, failing
+// the test unless the status is want.
+func get(t *testing.T, h http.Handler, method, target string, want int) []byte {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	if w.Code != want {
+		t.Fatalf("%s %s: got status %d, want %d: %s", method, target, w.Code, want, w.Body)
+	}
+	return w.Body.Bytes()
+}
+
+// withToken sends the requests to h with token as their bearer token.
+func withToken(h http.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+token)
+		h.ServeHTTP(w, req)
+	})
+}
+
+// TestOpenAPI locks down the OpenAPI document of the admin endpoints.
+func TestOpenAPI(t *testing.T) {
+	doc := get(t, OpenAPIHandler(), http.MethodGet, "/openapi.json", http.StatusOK)
+	golden.Assert(t, "openapi", append(doc, '\n'))
+}
+
+// TestAdminFormats locks down the JSON the admin endpoints serve and the
+// data of server-stats events, which dashboards and scripts read.
+func TestAdminFormats(t *testing.T) {
+	cs, err := NewChatServer(
+		WithPort("127.0.0.1:0"),
+		WithAdminToken("s3cret"),
+		WithLogHandler(slog.NewTextHandler(io.Discard, nil)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cs.Stop(context.Background())
+
+	// Before the server listens, nothing answers the bus check.
+	checks := health.New(health.Config{Timeout: 50 * time.Millisecond})
+	cs.RegisterHealth(checks)
+	report := func(body []byte) health.Report {
+		var r health.Report
+		if err := json.Unmarshal(body, &r); err != nil {
+			t.Fatal(err)
+		}
+		for i := range r.Checks {
+			r.Checks[i].Duration = 0
+		}
+		return r
+	}
+	golden.AssertJSON(t, "readyz-down", report(get(t, checks.ReadyHandler(), http.MethodGet, "/readyz", http.StatusServiceUnavailable)))
+
+	if _, err := cs.listen(); err != nil {
+		t.Fatal(err)
+	}
+	golden.AssertJSON(t, "readyz", report(get(t, checks.ReadyHandler(), http.MethodGet, "/readyz", http.StatusOK)))
+	golden.AssertJSON(t, "healthz", report(get(t, checks.LiveHandler(), http.MethodGet, "/healthz", http.StatusOK)))
+
+	golden.Assert(t, "broadcast", get(t, withToken(cs.BroadcastHandler(), "s3cret"), http.MethodGet, "/broadcast", http.StatusOK))
+	golden.Assert(t, "inbound", get(t, withToken(cs.InboundHandler(), "s3cret"), http.MethodGet, "/inbound", http.StatusOK))
+
+	topics := withToken(cs.TopicAdminHandler(), "s3cret")
+	if err := cs.eventBus.CreateTopic("room.news.message", eventbus.TopicConfig{
+		Retention:   time.Hour,
+		MaxRetained: 100,
+		TTL:         30 * time.Second,
+		ACL:         eventbus.ACL{Publishers: []string{"alice"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	golden.Assert(t, "topics", get(t, topics, http.MethodGet, "/topics", http.StatusOK))
+
+	stats := make(chan ServerStats, 1)
+	cs.eventBus.Register(statsTopic, eventbus.DefaultPriority, func(e eventbus.Event) error {
+		stats <- e.Data.(ServerStats)
+		return nil
+	})
+	if err := cs.publishStats(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s := <-stats
+	s.Time = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	golden.AssertJSON(t, "server-stats", s)
+}
+
+// newAdminServer returns a server built with opts that is stopped when the
+// test ends.
+func newAdminServer(t *testing.T, opts ...ServerOption) *ChatServer {
+	t.Helper()
+	opts = append(opts, WithPort("127.0.0.1:0"), WithLogHandler(slog.NewTextHandler(io.Discard, nil)))
+	cs, err := NewChatServer(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cs.Stop(context.Background()) })
+	return cs
+}
+
+// TestTopicAdminAuth checks that /topics only lets the admin token change
+// topics.
+func TestTopicAdminAuth(t *testing.T) {
+	const put = "/topics?name=room.news.message"
+
+	open := newAdminServer(t).TopicAdminHandler()
+	get(t, open, http.MethodGet, "/topics", http.StatusOK)
+	get(t, open, http.MethodPut, put, http.StatusForbidden)
+	get(t, open, http.MethodDelete, put, http.StatusForbidden)
+
+	cs := newAdminServer(t, WithAdminToken("s3cret"))
+	topics := cs.TopicAdminHandler()
+	get(t, topics, http.MethodGet, "/topics", http.StatusUnauthorized)
+	get(t, withToken(topics, "guess"), http.MethodGet, "/topics", http.StatusUnauthorized)
+	get(t, withToken(topics, "guess"), http.MethodDelete, put, http.StatusUnauthorized)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, put, strings.NewReader(`{"retention": "1h"}`))
+	withToken(topics, "s3cret").ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT with the admin token: got status %d: %s", w.Code, w.Body)
+	}
+	if infos := cs.eventBus.Topics(); len(infos) != 1 || infos[0].Name != "room.news.message" {
+		t.Errorf("topics after PUT: %+v", infos)
+	}
+}
+
+// TestBroadcastAuth checks that /broadcast only lets the admin token switch
+// the broadcast strategy.
+func TestBroadcastAuth(t *testing.T) {
+	const post = "/broadcast?strategy=sharded"
+
+	open := newAdminServer(t)
+	get(t, open.BroadcastHandler(), http.MethodGet, "/broadcast", http.StatusOK)
+	get(t, open.BroadcastHandler(), http.MethodPost, post, http.StatusForbidden)
+
+	cs := newAdminServer(t, WithAdminToken("s3cret"))
+	broadcast := cs.BroadcastHandler()
+	get(t, broadcast, http.MethodGet, "/broadcast", http.StatusUnauthorized)
+	get(t, broadcast, http.MethodPost, post, http.StatusUnauthorized)
+	get(t, withToken(broadcast, "guess"), http.MethodPost, post, http.StatusUnauthorized)
+	if got := cs.BroadcastStrategy(); got != "room" {
+		t.Fatalf("strategy after refused POSTs: got %q, want room", got)
+	}
+
+	get(t, withToken(broadcast, "s3cret"), http.MethodPost, post, http.StatusOK)
+	if got := cs.BroadcastStrategy(); got != "sharded" {
+		t.Errorf("strategy after POST with the admin token: got %q, want sharded", got)
+	}
+}
+
+// TestInboundAuth checks that /inbound only lets the admin token change the
+// inbound chain.
+func TestInboundAuth(t *testing.T) {
+	const target = "/inbound?name=profanity"
+	hasProfanity := func(cs *ChatServer) bool {
+		for _, link := range cs.inbound.Links() {
+			if link.Name == "profanity" {
+				return true
+			}
+		}
+		return false
+	}
+
+	open := newAdminServer(t)
+	get(t, open.InboundHandler(), http.MethodGet, "/inbound", http.StatusOK)
+	get(t, open.InboundHandler(), http.MethodDelete, target, http.StatusForbidden)
+	get(t, open.InboundHandler(), http.MethodPost, target, http.StatusForbidden)
+
+	cs := newAdminServer(t, WithAdminToken("s3cret"))
+	inbound := cs.InboundHandler()
+	get(t, inbound, http.MethodGet, "/inbound", http.StatusUnauthorized)
+	get(t, inbound, http.MethodDelete, target, http.StatusUnauthorized)
+	get(t, withToken(inbound, "guess"), http.MethodDelete, target, http.StatusUnauthorized)
+	if !hasProfanity(cs) {
+		t.Fatal("profanity filter removed by a DELETE without the admin token")
+	}
+
+	get(t, withToken(inbound, "s3cret"), http.MethodDelete, target, http.StatusOK)
+	if hasProfanity(cs) {
+		t.Error("profanity filter still in the chain after DELETE with the admin token")
+	}
+}
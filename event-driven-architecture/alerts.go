@@ -0,0 +1,71 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/diagnostics"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/protocol"
+)
+
+// SetAlertRoom posts the warnings and errors the server logs into room as
+// system messages, so that operators who join it see them as they happen.
+func (cs *ChatServer) SetAlertRoom(room string) {
+	cs.eventBus.Register(diagnostics.Topic+".*", eventbus.DefaultPriority, func(event eventbus.Event) error {
+		rec := event.Data.(diagnostics.Record)
+		cs.send(cs.members(room, nil), protocol.Envelope{
+			Type:      protocol.TypeSystem,
+			Room:      room,
+			Timestamp: rec.Time.UTC(),
+			Body:      formatAlert(rec),
+		})
+		return nil
+	})
+}
+
+// formatAlert renders a log record as one line, its attributes sorted by
+// key.
+func formatAlert(rec diagnostics.Record) string {
+	keys := make([]string, 0, len(rec.Attrs))
+	for key := range rec.Attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s", rec.Level, rec.Message)
+	for _, key := range keys {
+		fmt.Fprintf(&b, " %s=%v", key, rec.Attrs[key])
+	}
+	return b.String()
+}
@@ -29,130 +29,898 @@ SOFTWARE.
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"expvar"
 	"fmt"
+	"log/slog"
 	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/chain"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/compression"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/cron"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/diagnostics"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventstore"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/membudget"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/protocol"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/scheduler"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/strategy"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/usage"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/websocket"
+	"github.com/rajamummidi/go-design-patterns/health/health"
+	"github.com/rajamummidi/go-design-patterns/leader-election/leaderelection"
+	"github.com/rajamummidi/go-design-patterns/lifecycle/lifecycle"
+	"github.com/rajamummidi/go-design-patterns/observability/observability"
+	"github.com/rajamummidi/go-design-patterns/otlp/otlp"
+	"github.com/rajamummidi/go-design-patterns/rate-limiter/ratelimiter"
 )
 
-type Event struct {
-	Type string
-	Data interface{}
-}
+// drainNotice is sent to every client when the server starts draining.
+const drainNotice = "Server is restarting, please reconnect."
+
+// stopTimeout bounds how long Stop waits for the event bus at the end of a
+// drain.
+const stopTimeout = 5 * time.Second
 
-type EventHandler func(Event)
+// Sinks that see event data outside the handlers. Fields tagged as
+// sensitive, such as message texts and tokens, are redacted for them unless
+// the server's redaction policy allows the sink the event.
+const (
+	logSink     = "log"
+	historySink = "history"
+)
 
-type EventBus struct {
-	handlers map[string][]EventHandler
+// Transportable is what the chat server needs from a client connection. Raw
+// TCP connections and WebSocket connections both satisfy it, so the bus
+// handlers do not care how a client is connected.
+type Transportable interface {
+	Read(p []byte) (int, error)
+	Write(p []byte) (int, error)
+	Close() error
+	RemoteAddr() net.Addr
 }
 
-func NewEventBus() *EventBus {
-	return &EventBus{
-		handlers: make(map[string][]EventHandler),
-	}
+// Message is the data of a message-received event.
+type Message struct {
+	From Transportable
+	Nick string
+	Text string `redact:"mask"`
+	Time time.Time
+	// Expires is when the message stops being delivered, if it has a TTL.
+	Expires time.Time
+
+	// ctx is the context of the message-received event, so that the room
+	// message joins its trace.
+	ctx context.Context
 }
 
-func (eb *EventBus) Register(eventType string, handler EventHandler) {
-	handlers := eb.handlers[eventType]
-	handlers = append(handlers, handler)
-	eb.handlers[eventType] = handlers
+type ChatServer struct {
+	eventBus *eventbus.EventBus
+	// logger writes to the handler of WithLogHandler, or stdout, and
+	// publishes warnings and errors on the bus as diagnostics events.
+	logger *slog.Logger
+
+	mu            sync.Mutex
+	clients       map[Transportable]string    // nickname, empty until authenticated
+	lastSeen      map[Transportable]time.Time // authenticated clients only
+	encodings     map[Transportable]string    // accepted by the client in its hello
+	compression   compression.Stats
+	nicks         map[string]Transportable
+	tokens        map[string]string
+	history       *History
+	inbound       *chain.Chain[Message]
+	blocklist     *regexp.Regexp
+	redact        *eventbus.RedactionPolicy
+	opts          serverOptions
+	limiter       *ratelimiter.Keyed[Transportable]
+	meter         *usage.Meter // nil without WithUsage
+	floodAction   string
+	rooms         map[string]map[Transportable]bool
+	joined        map[Transportable][]string
+	listener      net.Listener
+	guests        int // legacy clients accepted, for their nicknames
+	broadcaster   strategy.Strategy
+	broadcastName string
+	stopped       bool
+	draining      bool
+	scheduler     *scheduler.Scheduler
+	elector       *leaderelection.Elector // nil without WithLeaderElection
+	stopCampaign  context.CancelFunc
+	campaignDone  chan error
+
+	done     chan struct{}
+	stopOnce sync.Once
 }
 
-func (eb *EventBus) Dispatch(eventType string, data interface{}) {
-	event := Event{Type: eventType, Data: data}
-	handlers := eb.handlers[eventType]
-	for _, handler := range handlers {
-		handler(event)
+// NewChatServer returns a server configured by opts. Without options it
+// listens on :8000 over plain TCP, keeps the last 50 messages of each room
+// and does not limit how fast clients send.
+func NewChatServer(opts ...ServerOption) (*ChatServer, error) {
+	options := defaultServerOptions()
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
+	history := options.history
+	if history == nil {
+		size := defaultHistorySize
+		if options.historySize != nil {
+			size = *options.historySize
+		}
+		history = NewHistory(size, nil)
+	}
+
+	logHandler := options.logHandler
+	if logHandler == nil {
+		logHandler = slog.NewTextHandler(os.Stdout, nil)
+	}
+	bus := eventbus.NewEventBus()
+	if options.tracer != nil {
+		bus.SetTracer(busTracer{options.tracer})
+	}
+	cs := &ChatServer{
+		eventBus: bus,
+		logger: slog.New(diagnostics.NewHandler(bus, &diagnostics.Options{
+			Next: logHandler,
+		})),
+		clients:   make(map[Transportable]string),
+		lastSeen:  make(map[Transportable]time.Time),
+		encodings: make(map[Transportable]string),
+		nicks:     make(map[string]Transportable),
+		tokens:    options.tokens,
+		history:   history,
+		redact:    defaultRedaction(),
+		opts:      options,
+		rooms:     make(map[string]map[Transportable]bool),
+		joined:    make(map[Transportable][]string),
+		meter:     options.meter,
+		done:      make(chan struct{}),
+	}
+	cs.scheduler = scheduler.New(bus)
+	if options.election != nil {
+		if err := cs.newElector(*options.election); err != nil {
+			return nil, err
+		}
+	}
+	if err := cs.SetRateLimit(options.rate, options.burst, options.floodAction); err != nil {
+		return nil, err
+	}
+	if err := cs.SetBroadcastStrategy(options.broadcast); err != nil {
+		return nil, err
+	}
+	cs.SetBlocklist(options.blocklist)
+	cs.inbound = chain.New[Message]()
+	for _, name := range defaultInbound {
+		cs.EnableProcessor(name)
 	}
+	return cs, nil
 }
 
-type ChatServer struct {
-	eventBus *EventBus
-	clients  map[net.Conn]bool
+// defaultRedaction lets the message history keep message texts. Everything
+// else is redacted for every sink.
+func defaultRedaction() *eventbus.RedactionPolicy {
+	policy := eventbus.NewRedactionPolicy()
+	policy.Allow(roomTopic("*", "message"), historySink)
+	return policy
 }
 
-func NewChatServer() *ChatServer {
-	return &ChatServer{
-		eventBus: NewEventBus(),
-		clients:  make(map[net.Conn]bool),
+// Start listens on the server's port and serves clients until the server
+// is stopped.
+func (cs *ChatServer) Start() error {
+	listener, err := cs.listen()
+	if err != nil {
+		return err
 	}
+	return cs.serve(listener)
 }
 
-func (cs *ChatServer) Start(port string) error {
+// listen opens the server's port and subscribes the server to the bus. It
+// returns once the server is ready for clients, which serve then accepts.
+func (cs *ChatServer) listen() (net.Listener, error) {
+	options := cs.opts
+	port := options.port
+	tlsConfig, err := options.serverTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	listener, err := net.Listen("tcp", port)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	fmt.Printf("Listening on port %s...\n", port)
-	defer listener.Close()
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	cs.logger.Info("listening", "addr", port, "tls", tlsConfig != nil)
+
+	cs.mu.Lock()
+	cs.listener = listener
+	cs.mu.Unlock()
+
+	cs.eventBus.Register("new-connection", eventbus.DefaultPriority, cs.onNewConnection)
+	cs.eventBus.Register("disconnected", eventbus.DefaultPriority, cs.onDisconnected)
+	cs.eventBus.Register("auth-requested", eventbus.DefaultPriority, cs.onAuthRequested)
+	cs.eventBus.Register("user-joined", eventbus.DefaultPriority, cs.onUserJoined)
+	cs.eventBus.Register("user-left", eventbus.DefaultPriority, cs.onUserLeft)
+	cs.eventBus.Register("message-received", eventbus.DefaultPriority, cs.onMessageReceived)
+	cs.eventBus.Register("client-throttled", eventbus.DefaultPriority, cs.onClientThrottled)
+	cs.eventBus.Register(roomTopic("*", "message"), eventbus.DefaultPriority, cs.onRoomMessage)
+	cs.eventBus.Register(roomTopic("*", "message"), eventbus.DefaultPriority, cs.onRoomMessageRecorded)
+	cs.eventBus.Register(roomTopic("*", "joined"), eventbus.DefaultPriority, cs.onRoomChange)
+	cs.eventBus.Register(roomTopic("*", "joined"), eventbus.DefaultPriority, cs.onRoomJoinedReplay)
+	cs.eventBus.Register(roomTopic("*", "left"), eventbus.DefaultPriority, cs.onRoomChange)
+	cs.eventBus.Register("heartbeat", eventbus.DefaultPriority, cs.onHeartbeat)
+	cs.eventBus.Register(statsTopic, eventbus.DefaultPriority, cs.onServerStats)
+	cs.eventBus.Register(healthTopic, eventbus.DefaultPriority, cs.onHealthPing)
+	cs.campaign()
+	if err := cs.schedule(); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
 
-	cs.eventBus.Register("new-connection", cs.onNewConnection)
-	cs.eventBus.Register("disconnected", cs.onDisconnected)
-	cs.eventBus.Register("message-received", cs.onMessageReceived)
+// serve accepts clients on listener until the server is stopped.
+func (cs *ChatServer) serve(listener net.Listener) error {
+	defer listener.Close()
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			fmt.Printf("Error accepting connection: %v\n", err)
+			if cs.isClosing() {
+				return nil
+			}
+			cs.logger.Error("accepting connection", "err", err)
 			continue
 		}
 
-		cs.eventBus.Dispatch("new-connection", conn)
+		if cs.opts.legacy {
+			conn = protocol.NewLegacyConn(conn, cs.guestNick())
+		}
+		cs.accept(conn)
 	}
 }
 
-func (cs *ChatServer) onNewConnection(event Event) {
-	conn := event.Data.(net.Conn)
-	cs.clients[conn] = true
-	fmt.Printf("New connection from %s\n", conn.RemoteAddr().String())
+// guestNick returns the next nickname for a legacy client, which has no way
+// to choose one.
+func (cs *ChatServer) guestNick() string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.guests++
+	return fmt.Sprintf("guest-%d", cs.guests)
 }
 
-func (cs *ChatServer) onDisconnected(event Event) {
-	conn := event.Data.(net.Conn)
-	delete(cs.clients, conn)
-	fmt.Printf("Disconnected from %s\n", conn.RemoteAddr().String())
+// ServeWebSocket upgrades an HTTP request to a WebSocket connection and
+// treats it like any other client, so browsers can join the chat. Only
+// pages from the server's own host and from WithAllowedOrigins may connect.
+func (cs *ChatServer) ServeWebSocket(w http.ResponseWriter, r *http.Request) {
+	if cs.isClosing() {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	cs.mu.Lock()
+	upgrader := websocket.Upgrader{AllowedOrigins: cs.opts.origins}
+	cs.mu.Unlock()
+	conn, err := upgrader.Upgrade(w, r)
+	if err != nil {
+		cs.logger.InfoContext(r.Context(), "upgrading connection", "addr", r.RemoteAddr, "err", err)
+		return
+	}
+	cs.accept(conn)
+}
+
+func (cs *ChatServer) accept(conn Transportable) {
+	cs.mu.Lock()
+	client := NewClient(conn, cs.eventBus)
+	client.readTimeout = cs.opts.readTimeout
+	client.writeTimeout = cs.opts.writeTimeout
+	client.messageTTL = cs.opts.messageTTL
+	client.decompressed = cs.recordDecompression
+	cs.mu.Unlock()
+
+	cs.eventBus.Dispatch("new-connection", conn)
+	go client.Start()
 }
 
-func (cs *ChatServer) onMessageReceived(event Event) {
-	msg := event.Data.(string)
+// Stop closes the listener and every client connection, waits for running
+// scheduled jobs and then closes the event bus, waiting for queued events
+// to be handled until ctx expires. Start returns nil once the server has
+// been stopped.
+func (cs *ChatServer) Stop(ctx context.Context) error {
+	cs.mu.Lock()
+	cs.stopped = true
+	if cs.listener != nil {
+		cs.listener.Close()
+	}
 	for conn := range cs.clients {
-		_, err := conn.Write([]byte(msg))
+		conn.Close()
+	}
+	cs.mu.Unlock()
+
+	// Scheduled jobs publish on the bus, so they finish before it closes.
+	// The election ends after the jobs, which may only run on the leader.
+	// The usage of the messages handled until then is rolled up last.
+	err := errors.Join(cs.scheduler.Stop(ctx), cs.resign(ctx), cs.eventBus.Close(ctx), cs.rollupUsage(ctx))
+	cs.stopOnce.Do(func() { close(cs.done) })
+	return err
+}
+
+// Drain prepares the server for a rolling restart. It stops accepting new
+// connections, asks the connected clients to reconnect, which sends them to
+// another instance behind the load balancer, and waits for them to leave
+// until ctx expires. The remaining clients are then disconnected by Stop.
+func (cs *ChatServer) Drain(ctx context.Context) error {
+	cs.mu.Lock()
+	cs.draining = true
+	if cs.listener != nil {
+		cs.listener.Close()
+	}
+	conns := make([]Transportable, 0, len(cs.clients))
+	for conn := range cs.clients {
+		conns = append(conns, conn)
+	}
+	cs.mu.Unlock()
+
+	cs.logger.Info("draining", "clients", len(conns))
+	cs.send(conns, protocol.Envelope{Type: protocol.TypeSystem, Body: drainNotice})
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for cs.clientCount() > 0 {
+		select {
+		case <-ctx.Done():
+			cs.logger.Warn("drain timed out", "clients", cs.clientCount())
+			return cs.stopAfterDrain()
+		case <-ticker.C:
+		}
+	}
+	return cs.stopAfterDrain()
+}
+
+func (cs *ChatServer) stopAfterDrain() error {
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+	return cs.Stop(ctx)
+}
+
+// Done is closed once the server has stopped.
+func (cs *ChatServer) Done() <-chan struct{} {
+	return cs.done
+}
+
+func (cs *ChatServer) isClosing() bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return cs.stopped || cs.draining
+}
+
+func (cs *ChatServer) clientCount() int {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return len(cs.clients)
+}
+
+func (cs *ChatServer) onNewConnection(event eventbus.Event) error {
+	conn := event.Data.(Transportable)
+	cs.mu.Lock()
+	cs.clients[conn] = ""
+	cs.mu.Unlock()
+	cs.logger.InfoContext(event.Context(), "connected", "addr", conn.RemoteAddr().String())
+	return nil
+}
+
+func (cs *ChatServer) onDisconnected(event eventbus.Event) error {
+	conn := event.Data.(Transportable)
+
+	// Both the reader and a failed broadcast report the same connection.
+	cs.mu.Lock()
+	nick, ok := cs.clients[conn]
+	delete(cs.clients, conn)
+	delete(cs.lastSeen, conn)
+	delete(cs.encodings, conn)
+	if nick != "" {
+		delete(cs.nicks, nick)
+	}
+	limiter := cs.limiter
+	cs.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if limiter != nil {
+		limiter.Forget(conn)
+	}
+
+	conn.Close()
+	cs.logger.InfoContext(event.Context(), "disconnected", "addr", conn.RemoteAddr().String())
+
+	for _, room := range cs.leaveAll(conn) {
+		cs.eventBus.DispatchContext(event.Context(), roomTopic(room, "left"), RoomChange{Room: room, Conn: conn, Nick: nick})
+	}
+	if nick != "" {
+		cs.eventBus.DispatchContext(event.Context(), "user-left", Presence{Nick: nick, Conn: conn})
+	}
+	return nil
+}
+
+// onHeartbeat handles the heartbeat event published by the cron bridge when
+// the server runs with a schedule.
+func (cs *ChatServer) onHeartbeat(event eventbus.Event) error {
+	cs.logger.InfoContext(event.Context(), "heartbeat", "time", event.Data.(time.Time).Format(time.RFC3339))
+	return nil
+}
+
+// validateMessage drops blank messages before they are broadcast.
+func (cs *ChatServer) validateMessage(msg Message, next chain.Next[Message]) error {
+	if strings.TrimSpace(msg.Text) == "" {
+		return nil
+	}
+	return next(msg)
+}
+
+// publishMessage publishes a chat message to the sender's current room. It
+// is the last link of the inbound chain.
+func (cs *ChatServer) publishMessage(msg Message, next chain.Next[Message]) error {
+	room, ok := cs.currentRoom(msg.From)
+	if !ok {
+		cs.notify(msg.From, "You are not in a room. Use JOIN <room>.")
+		return nil
+	}
+	// The message is published as its sender, so a topic ACL can limit who
+	// may post in a room.
+	err := cs.eventBus.DispatchEvent(eventbus.Event{
+		Type:      roomTopic(room, "message"),
+		Data:      RoomMessage{Room: room, From: msg.From, Nick: msg.Nick, Text: msg.Text, Time: msg.Time, Expires: msg.Expires},
+		Principal: msg.Nick,
+		Deadline:  msg.Expires,
+	}.WithContext(msg.ctx))
+	if errors.Is(err, eventbus.ErrForbidden) {
+		cs.notify(msg.From, "You may not post in #%s.", room)
+		return nil
+	}
+	if err == nil {
+		cs.recordUsage(msg.Nick, usage.Usage{Messages: 1, Bytes: int64(len(msg.Text))})
+	}
+	return err
+}
+
+// send writes env to every connection, disconnecting the ones that fail.
+func (cs *ChatServer) send(conns []Transportable, env protocol.Envelope) {
+	frames, ok := cs.frames(env)
+	if !ok {
+		return
+	}
+
+	cs.mu.Lock()
+	writeTimeout := cs.opts.writeTimeout
+	cs.mu.Unlock()
+
+	for _, conn := range conns {
+		setDeadline(conn, true, writeTimeout)
+		_, err := conn.Write(frames.For(conn))
 		if err != nil {
 			cs.eventBus.Dispatch("disconnected", conn)
 		}
 	}
 }
 
+// encode marshals env, stamping it with the current time if it has none.
+func (cs *ChatServer) encode(env protocol.Envelope) ([]byte, bool) {
+	if env.Timestamp.IsZero() {
+		env.Timestamp = time.Now().UTC()
+	}
+	data, err := protocol.Marshal(env)
+	if err != nil {
+		cs.logger.Error("encoding envelope", "type", env.Type, "err", err)
+		return nil, false
+	}
+	return data, true
+}
+
+// notify sends a system notice to a single client.
+func (cs *ChatServer) notify(conn Transportable, format string, args ...interface{}) {
+	cs.send([]Transportable{conn}, protocol.Envelope{Type: protocol.TypeSystem, Body: fmt.Sprintf(format, args...)})
+}
+
 type Client struct {
-	conn     net.Conn
-	eventBus *EventBus
+	conn     Transportable
+	eventBus *eventbus.EventBus
+	nick     string
+
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	messageTTL   time.Duration
+	// decompressed counts the compressed envelopes the client sends.
+	decompressed func(in, out int)
 }
 
-func NewClient(conn net.Conn, eventBus *EventBus) *Client {
+func NewClient(conn Transportable, eventBus *eventbus.EventBus) *Client {
 	return &Client{
 		conn:     conn,
 		eventBus: eventBus,
 	}
 }
 
+// Start authenticates the client and then decodes envelopes from the
+// connection until it fails, publishing every chat message as a
+// message-received event. The server runs it on its own goroutine per
+// connection.
 func (c *Client) Start() {
-	c.eventBus.Dispatch("new-connection", c.conn)
+	setDeadline(c.conn, false, c.readTimeout)
+	dec := protocol.NewDecoder(c.conn)
+	if err := c.handshake(dec); err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			err = errHelloTimeout
+		}
+		c.fail(err)
+		return
+	}
 
-	buf := make([]byte, 1024)
+	// Idle clients are found by the server's idle sweep, not by a deadline.
+	setDeadline(c.conn, false, 0)
 	for {
-		n, err := c.conn.Read(buf)
+		env, err := dec.Decode()
 		if err != nil {
 			c.eventBus.Dispatch("disconnected", c.conn)
 			break
 		}
+		if env.Type != protocol.TypeMessage {
+			continue
+		}
+		if env.Encoding != "" {
+			size := len(env.Body)
+			if env, err = protocol.Decompress(env); err != nil {
+				c.fail(err)
+				break
+			}
+			if c.decompressed != nil {
+				c.decompressed(size, len(env.Body))
+			}
+		}
 
-		msg := string(buf[:n])
-		c.eventBus.Dispatch("message-received", msg)
+		now := time.Now().UTC()
+		msg := Message{From: c.conn, Nick: c.nick, Text: env.Body, Time: now, Expires: expiry(now, env.TTL, c.messageTTL)}
+		c.eventBus.DispatchEvent(eventbus.Event{Type: "message-received", Data: msg, Deadline: msg.Expires})
 	}
 }
 
+// fail tells the client why it is being disconnected and disconnects it.
+func (c *Client) fail(err error) {
+	setDeadline(c.conn, true, c.writeTimeout)
+	protocol.NewEncoder(c.conn).Encode(protocol.Envelope{
+		Type:      protocol.TypeError,
+		Timestamp: time.Now().UTC(),
+		Body:      err.Error(),
+	})
+	c.eventBus.Dispatch("disconnected", c.conn)
+}
+
 func main() {
-	cs := NewChatServer()
-	err := cs.Start(":8000")
+	cfg, err := loadSettings()
 	if err != nil {
-		fmt.Printf("Error starting server: %v\n", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	logger := observability.NewLogger(observability.LogConfig{Service: "chat", Format: cfg.Log.Format})
+
+	opts := []ServerOption{
+		WithPort(cfg.Port),
+		WithRateLimit(cfg.Rate, cfg.Burst, cfg.Flood),
+		WithBroadcastStrategy(cfg.Broadcast),
+		WithReadTimeout(cfg.ReadTimeout),
+		WithWriteTimeout(cfg.WriteTimeout),
+		WithIdleTimeout(cfg.IdleTimeout),
+		WithMessageTTL(cfg.MessageTTL),
+		WithStatsInterval(cfg.StatsInterval),
+		WithCompaction(cfg.CompactInterval),
+	}
+	if cfg.LeaderLock != "" {
+		lock, err := parseLock(cfg.LeaderLock)
+		if err != nil {
+			logger.Error("configuring leader election", "err", err)
+			return
+		}
+		if closer, ok := lock.(interface{ Close() error }); ok {
+			defer closer.Close()
+		}
+		opts = append(opts, WithLeaderElection(lock, cfg.InstanceID))
+	}
+	if len(cfg.Blocklist) > 0 {
+		opts = append(opts, WithBlocklist(cfg.Blocklist...))
+	}
+	if cfg.Compress.Threshold > 0 {
+		opts = append(opts, WithCompression(cfg.Compress.Threshold, cfg.Compress.Rooms...))
+	}
+	if cfg.Tokens != "" {
+		tokens, err := loadTokens(cfg.Tokens)
+		if err != nil {
+			logger.Error("loading tokens", "err", err)
+			return
+		}
+		opts = append(opts, WithTokens(tokens))
+	}
+	if cfg.AdminToken != "" {
+		opts = append(opts, WithAdminToken(cfg.AdminToken))
+	}
+	if cfg.TLS.Cert != "" || cfg.TLS.Key != "" {
+		opts = append(opts, WithTLS(cfg.TLS.Cert, cfg.TLS.Key))
+	}
+	if cfg.Legacy {
+		opts = append(opts, WithLegacyClients())
+	}
+	if len(cfg.WSOrigins) > 0 {
+		opts = append(opts, WithAllowedOrigins(cfg.WSOrigins...))
+	}
+
+	history := NewHistory(cfg.History, nil)
+	if cfg.HistoryFile != "" {
+		var keyring *eventstore.Keyring
+		if cfg.HistoryKey != "" {
+			var err error
+			keyring, err = eventstore.NewKeyring(eventstore.EnvSecrets{Prefix: "EVENTSTORE_KEY_"}, cfg.HistoryKey)
+			if err != nil {
+				logger.Error("loading history key", "err", err)
+				return
+			}
+		}
+		store, err := eventstore.OpenEncryptedFileStore(cfg.HistoryFile, keyring)
+		if err != nil {
+			logger.Error("opening history", "err", err)
+			return
+		}
+		defer store.Close()
+		history = NewHistory(cfg.History, store)
+	}
+	// The history and the retained events of the topics share one budget.
+	var budget *membudget.Budget
+	if cfg.MemoryBudget > 0 {
+		budget = membudget.New(cfg.MemoryBudget)
+		history.UseBudget(budget, 1)
+	}
+	opts = append(opts, WithHistory(history), WithLogHandler(logger.Handler()))
+
+	// Usage is always metered, so /usage can report it. Without a file,
+	// the rollups of the last quota period are kept in memory.
+	var usageRepo usage.Repository = usage.NewMemoryRepository(cfg.Usage.Period)
+	if cfg.Usage.File != "" {
+		repo, err := usage.OpenFileRepository(cfg.Usage.File)
+		if err != nil {
+			logger.Error("opening usage file", "err", err)
+			return
+		}
+		defer repo.Close()
+		usageRepo = repo
+	}
+	meter := usage.New(usageRepo)
+	quota := usage.Usage{Messages: cfg.Usage.Messages, Bytes: cfg.Usage.Bytes, Events: cfg.Usage.Events}
+	if err := meter.SetQuota(quota, cfg.Usage.Period); err != nil {
+		logger.Error("configuring quotas", "err", err)
+		return
+	}
+	opts = append(opts, WithUsage(meter, cfg.Usage.Rollup))
+
+	var exporter *otlp.Exporter
+	if cfg.OTLP != "" {
+		exporter = otlp.New(otlp.Config{
+			Endpoint: cfg.OTLP,
+			Interval: cfg.OTLPInterval,
+			Resource: map[string]string{"service.name": "chat"},
+		})
+	}
+	tracer, err := newTracer(cfg.Traces, logger, exporter)
+	if err != nil {
+		logger.Error("configuring traces", "err", err)
+		return
+	}
+	if tracer != nil {
+		opts = append(opts, WithTracer(tracer))
+	}
+
+	cs, err := NewChatServer(opts...)
+	if err != nil {
+		logger.Error("configuring server", "err", err)
+		return
+	}
+	if budget != nil {
+		cs.eventBus.UseBudget(budget, 1)
+	}
+
+	if cfg.Log.Events {
+		for _, topic := range cfg.Log.Unredacted {
+			cs.redact.Allow(topic, logSink)
+		}
+		cs.eventBus.Wiretap(logSink, cs.redact, eventbus.Sample(func(event eventbus.Event) error {
+			logger.InfoContext(event.Context(), "event", "type", event.Type, "data", fmt.Sprintf("%+v", event.Data))
+			return nil
+		}, cfg.Log.Sample, cfg.Log.Burst))
+	}
+
+	if cfg.Alerts != "" {
+		cs.SetAlertRoom(cfg.Alerts)
+	}
+
+	// The parts of the server stop in the reverse order of their start.
+	// Everything that feeds the chat server, such as the WebSocket
+	// listener and the cron bridge, stops before it; the admin server
+	// and the exporter stay up until the chat server has drained, so the
+	// drain can be watched and its numbers are exported.
+	m := lifecycle.New()
+	m.SetStopTimeout(stopTimeout)
+	var chatDeps []string
+
+	if cfg.SlowHandler.Budget > 0 {
+		cs.eventBus.Register(eventbus.SlowHandlerTopic, eventbus.DefaultPriority, func(event eventbus.Event) error {
+			cs.logger.Warn("slow handlers", "report", event.Data.(eventbus.SlowReport).String())
+			return nil
+		})
+		var stop func()
+		m.Register("slow-handlers", lifecycle.Hooks{
+			OnStart: func(ctx context.Context) error {
+				stop = cs.eventBus.DetectSlowHandlers(eventbus.SlowHandlerConfig{Budget: cfg.SlowHandler.Budget, Period: cfg.SlowHandler.Period})
+				return nil
+			},
+			OnStop: func(ctx context.Context) error {
+				stop()
+				return nil
+			},
+		})
+		chatDeps = append(chatDeps, "slow-handlers")
+	}
+
+	if exporter != nil {
+		exporter.Register("eventbus", cs.eventBus.WritePrometheus)
+		m.Register("otlp", lifecycle.Hooks{
+			OnStart: func(ctx context.Context) error {
+				exporter.Start()
+				return nil
+			},
+			OnStop: exporter.Shutdown,
+		})
+		chatDeps = append(chatDeps, "otlp")
+	}
+
+	// The tracer exports the spans of the drain before the exporter it
+	// sends them through stops.
+	if tracer != nil {
+		var deps []string
+		if exporter != nil {
+			deps = append(deps, "otlp")
+		}
+		m.Register("tracer", lifecycle.Hooks{OnStop: tracer.Shutdown}, deps...)
+		chatDeps = append(chatDeps, "tracer")
+	}
+
+	// Cancelling ctx stops the server as a signal would.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if cfg.Metrics != "" {
+		cs.eventBus.PublishExpvar("eventbus")
+		expvar.Publish("history", expvar.Func(func() interface{} { return history.Stats() }))
+		expvar.Publish("jobs", expvar.Func(func() interface{} { return cs.Jobs() }))
+		expvar.Publish("compression", expvar.Func(func() interface{} {
+			stats := cs.CompressionStats()
+			return struct {
+				compression.Stats
+				Ratio float64 `json:"ratio"`
+			}{stats, stats.Ratio()}
+		}))
+		http.Handle("/metrics", cs.eventBus.MetricsHandler())
+		http.Handle("/topics", cs.TopicAdminHandler())
+		http.Handle("/broadcast", cs.BroadcastHandler())
+		http.Handle("/inbound", cs.InboundHandler())
+		http.Handle("/usage", cs.UsageHandler())
+		http.Handle("/openapi.json", OpenAPIHandler())
+		checks := health.New(health.Config{})
+		cs.RegisterHealth(checks)
+		checks.AddReadiness("components", m)
+		http.Handle("/healthz", checks.LiveHandler())
+		http.Handle("/readyz", checks.ReadyHandler())
+		// Draining shuts the server down, so it takes the admin token, and
+		// is refused without one.
+		http.Handle("/drain", cs.requireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			cancel()
+			w.WriteHeader(http.StatusAccepted)
+		})))
+		m.Register("admin", httpServer(&http.Server{Addr: cfg.Metrics}, "", "", logger))
+		chatDeps = append(chatDeps, "admin")
+	}
+
+	// Stopping the chat server drains it. A second signal during the drain
+	// gives up on it.
+	m.Register("chat", lifecycle.WithStopTimeout(lifecycle.Hooks{
+		OnStart: func(ctx context.Context) error {
+			listener, err := cs.listen()
+			if err != nil {
+				return err
+			}
+			go cs.serve(listener)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, cfg.DrainTimeout)
+			defer cancel()
+			return cs.Drain(ctx)
+		},
+	}, cfg.DrainTimeout+stopTimeout), chatDeps...)
+
+	if cfg.WS != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/chat", cs.ServeWebSocket)
+		m.Register("websocket", httpServer(&http.Server{Addr: cfg.WS, Handler: mux}, cfg.TLS.Cert, cfg.TLS.Key, logger), "chat")
+	}
+
+	if cfg.Schedule != "" {
+		entries, err := cron.LoadEntries(cfg.Schedule)
+		if err != nil {
+			logger.Error("loading schedule", "err", err)
+			return
+		}
+		bridge, err := cron.NewBridge(cs.eventBus, entries)
+		if err != nil {
+			logger.Error("loading schedule", "err", err)
+			return
+		}
+		m.Register("cron", lifecycle.Hooks{
+			OnStart: func(ctx context.Context) error {
+				bridge.Start(context.Background())
+				return nil
+			},
+			OnStop: func(ctx context.Context) error {
+				bridge.Stop()
+				return nil
+			},
+		}, "chat")
+	}
+
+	// SIGINT and SIGTERM, which orchestrators send before replacing an
+	// instance, drain the server; a second one stops it straight away.
+	if err := m.Run(ctx); err != nil {
+		logger.Error("running server", "err", err)
+	}
+}
+
+// httpServer runs server as a component, over TLS if certFile is set.
+// Start returns once the server listens, so an address in use fails the
+// start, and Stop waits for the requests in flight. Errors serving go to
+// logger.
+func httpServer(server *http.Server, certFile, keyFile string, logger *slog.Logger) lifecycle.Component {
+	return lifecycle.Hooks{
+		OnStart: func(ctx context.Context) error {
+			listener, err := net.Listen("tcp", server.Addr)
+			if err != nil {
+				return err
+			}
+			go func() {
+				var err error
+				if certFile != "" {
+					err = server.ServeTLS(listener, certFile, keyFile)
+				} else {
+					err = server.Serve(listener)
+				}
+				if err != http.ErrServerClosed {
+					logger.Error("serving", "addr", server.Addr, "err", err)
+				}
+			}()
+			return nil
+		},
+		OnStop: server.Shutdown,
 	}
 }
@@ -0,0 +1,269 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/compression"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/protocol"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/usage"
+	"github.com/rajamummidi/go-design-patterns/leakcheck/leakcheck"
+)
+
+// TestStopLeaksNothing runs a server with connected clients and checks that
+// Stop ends every goroutine the server started: the accept loop, the
+// clients' readers, the scheduler and the bus. The clients speak the
+// protocol over plain connections, which start no goroutines of their own,
+// and stay connected until after the check, so Stop must close them.
+func TestStopLeaksNothing(t *testing.T) {
+	var conns []net.Conn
+	t.Cleanup(func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	leakcheck.Check(t)
+
+	cs, err := NewChatServer(WithPort("127.0.0.1:0"), WithLogHandler(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := cs.listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- cs.serve(listener) }()
+	addr := listener.Addr().String()
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+	signIn := func(nick string) (*protocol.Encoder, *protocol.Decoder) {
+		conn := dial()
+		enc, dec := protocol.NewEncoder(conn), protocol.NewDecoder(conn)
+		if err := enc.Encode(protocol.Envelope{Type: protocol.TypeHello, Sender: nick}); err != nil {
+			t.Fatal(err)
+		}
+		if env, err := dec.Decode(); err != nil || env.Type != protocol.TypeSystem {
+			t.Fatalf("%s signing in: got %+v, %v", nick, env, err)
+		}
+		return enc, dec
+	}
+	alice, _ := signIn("alice")
+	_, bob := signIn("bob")
+	// A connection that never signs in must be closed by Stop too.
+	dial()
+
+	if err := alice.Encode(protocol.Envelope{Type: protocol.TypeMessage, Body: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		env, err := bob.Decode()
+		if err != nil {
+			t.Fatalf("bob did not receive the message: %v", err)
+		}
+		if env.Type == protocol.TypeMessage && env.Body == "hello" {
+			break
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := cs.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != nil {
+		t.Fatalf("serve returned %v", err)
+	}
+}
+
+// TestCompression checks that large envelopes are compressed only for the
+// clients that offered gzip in their hello, and that a compressed message
+// from a client reaches the others as plain text.
+func TestCompression(t *testing.T) {
+	cs, err := NewChatServer(WithPort("127.0.0.1:0"), WithCompression(100), WithLogHandler(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := cs.listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go cs.serve(listener)
+	defer cs.Stop(context.Background())
+
+	signIn := func(nick, encodings string) (*protocol.Encoder, *protocol.Decoder) {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		enc, dec := protocol.NewEncoder(conn), protocol.NewDecoder(conn)
+		if err := enc.Encode(protocol.Envelope{Type: protocol.TypeHello, Sender: nick, Encoding: encodings}); err != nil {
+			t.Fatal(err)
+		}
+		return enc, dec
+	}
+	// next returns the next chat message, skipping notices.
+	next := func(nick string, dec *protocol.Decoder) protocol.Envelope {
+		for {
+			env, err := dec.Decode()
+			if err != nil {
+				t.Fatalf("%s: %v", nick, err)
+			}
+			if env.Type == protocol.TypeMessage {
+				return env
+			}
+		}
+	}
+	// await skips envelopes until a notice containing text.
+	await := func(nick string, dec *protocol.Decoder, text string) {
+		for {
+			env, err := dec.Decode()
+			if err != nil {
+				t.Fatalf("%s waiting for %q: %v", nick, text, err)
+			}
+			if env.Type == protocol.TypeSystem && strings.Contains(env.Body, text) {
+				return
+			}
+		}
+	}
+	alice, aliceIn := signIn("alice", "zstd, gzip")
+	await("alice", aliceIn, "talking in #lobby")
+	bob, bobIn := signIn("bob", "")
+	await("alice", aliceIn, "bob joined #lobby")
+
+	long := strings.Repeat("all work and no play ", 20)
+	bob.Encode(protocol.Envelope{Type: protocol.TypeMessage, Body: long})
+	env := next("alice", aliceIn)
+	if env.Encoding != compression.Gzip {
+		t.Fatalf("alice got a long message with encoding %q", env.Encoding)
+	}
+	if env, err = protocol.Decompress(env); err != nil || env.Body != long {
+		t.Fatalf("alice decompressed %q, %v", env.Body, err)
+	}
+
+	compressed, err := protocol.Compress(protocol.Envelope{Type: protocol.TypeMessage, Body: long}, compression.Gzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice.Encode(compressed)
+	if env := next("bob", bobIn); env.Encoding != "" || env.Body != long {
+		t.Fatalf("bob got %+v", env)
+	}
+
+	stats := cs.CompressionStats()
+	if stats.Messages != 1 || stats.Ratio() >= 1 || stats.DecompressedOut != uint64(len(long)) {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+// TestQuota checks that a client over its quota has its messages dropped
+// without being disconnected, even with the disconnect flood action, and
+// that /usage reports what it sent.
+func TestQuota(t *testing.T) {
+	meter := usage.New(nil)
+	if err := meter.SetQuota(usage.Usage{Messages: 2}, 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	cs, err := NewChatServer(
+		WithPort("127.0.0.1:0"),
+		WithRateLimit(100, 10, floodDisconnect),
+		WithUsage(meter, time.Hour),
+		WithAdminToken("s3cret"),
+		WithLogHandler(slog.NewTextHandler(io.Discard, nil)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := cs.listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go cs.serve(listener)
+	defer cs.Stop(context.Background())
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	enc, dec := protocol.NewEncoder(conn), protocol.NewDecoder(conn)
+	if err := enc.Encode(protocol.Envelope{Type: protocol.TypeHello, Sender: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	// await skips envelopes until a notice containing text.
+	await := func(text string) {
+		for {
+			env, err := dec.Decode()
+			if err != nil {
+				t.Fatalf("waiting for %q: %v", text, err)
+			}
+			if env.Type == protocol.TypeSystem && strings.Contains(env.Body, text) {
+				return
+			}
+		}
+	}
+	await("talking in #lobby")
+
+	for _, text := range []string{"one", "two", "three"} {
+		enc.Encode(protocol.Envelope{Type: protocol.TypeMessage, Body: text})
+	}
+	await("used up your quota")
+	enc.Encode(protocol.Envelope{Type: protocol.TypeMessage, Body: "four"})
+	await("used up your quota")
+
+	handler := cs.UsageHandler()
+	get(t, handler, http.MethodGet, "/usage?key=alice", http.StatusUnauthorized)
+	var report usage.Report
+	if err := json.Unmarshal(get(t, withToken(handler, "s3cret"), http.MethodGet, "/usage?key=alice", http.StatusOK), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Total.Messages != 2 || report.Total.Bytes != int64(len("one")+len("two")) {
+		t.Errorf("usage of alice: %+v", report.Total)
+	}
+}
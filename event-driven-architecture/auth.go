@@ -0,0 +1,235 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/compression"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/protocol"
+)
+
+// authTimeout bounds how long a client waits for the auth handler.
+const authTimeout = 5 * time.Second
+
+var nickname = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+var (
+	errHelloExpected = errors.New("expected a hello envelope with your nickname")
+	errBadNickname   = errors.New("nicknames are 1-32 letters, digits, - or _")
+	errBadToken      = errors.New("invalid token")
+	errNicknameTaken = errors.New("nickname is already in use")
+	errHelloTimeout  = errors.New("timed out waiting for hello")
+	errIdle          = errors.New("disconnected after being idle")
+)
+
+// AuthRequest is the data of an auth-requested event, which the client's
+// reader publishes with Request and the server answers with Reply.
+type AuthRequest struct {
+	Conn  Transportable
+	Nick  string
+	Token string `redact:"omit"`
+	// Encoding is the body encoding negotiated from the hello, if any.
+	Encoding string
+}
+
+// Presence is the data of the user-joined and user-left events.
+type Presence struct {
+	Nick string
+	Conn Transportable
+}
+
+// SetTokens makes the given nicknames require a token. Nicknames without an
+// entry can be used without one.
+func (cs *ChatServer) SetTokens(tokens map[string]string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.tokens = tokens
+}
+
+func loadTokens(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tokens map[string]string
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return tokens, nil
+}
+
+// TopicAdminHandler serves the topic admin endpoint of the event bus to
+// requests that carry the token of WithAdminToken as
+// "Authorization: Bearer <token>". Without an admin token, topics can be
+// listed but not changed.
+func (cs *ChatServer) TopicAdminHandler() http.Handler {
+	return cs.requireAdmin(cs.eventBus.TopicAdminHandler())
+}
+
+// requireAdmin lets requests with the admin token through to next, and
+// only GET requests if there is no admin token.
+func (cs *ChatServer) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token := cs.opts.adminToken
+		if token == "" {
+			if req.Method != http.MethodGet {
+				http.Error(w, "read-only without an admin token", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, req)
+			return
+		}
+		got, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, errBadToken.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// handshake reads the client's hello and asks the server to admit it.
+func (c *Client) handshake(dec *protocol.Decoder) error {
+	env, err := dec.Decode()
+	if err != nil {
+		return err
+	}
+	if env.Type != protocol.TypeHello {
+		return errHelloExpected
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), authTimeout)
+	defer cancel()
+	_, err = c.eventBus.Request(ctx, "auth-requested", AuthRequest{
+		Conn:     c.conn,
+		Nick:     env.Sender,
+		Token:    env.Body,
+		Encoding: compression.Negotiate(env.Encoding),
+	})
+	if err != nil {
+		return err
+	}
+	c.nick = env.Sender
+	return nil
+}
+
+// onAuthRequested checks the nickname and token of a connecting client and
+// claims the nickname for it.
+func (cs *ChatServer) onAuthRequested(event eventbus.Event) error {
+	req := event.Data.(AuthRequest)
+	if !nickname.MatchString(req.Nick) {
+		return cs.eventBus.Reply(event, errBadNickname)
+	}
+
+	cs.mu.Lock()
+	if want, ok := cs.tokens[req.Nick]; ok && subtle.ConstantTimeCompare([]byte(want), []byte(req.Token)) != 1 {
+		cs.mu.Unlock()
+		return cs.eventBus.Reply(event, errBadToken)
+	}
+	if _, taken := cs.nicks[req.Nick]; taken {
+		cs.mu.Unlock()
+		return cs.eventBus.Reply(event, errNicknameTaken)
+	}
+	if _, connected := cs.clients[req.Conn]; !connected {
+		cs.mu.Unlock()
+		return cs.eventBus.Reply(event, net.ErrClosed)
+	}
+	cs.nicks[req.Nick] = req.Conn
+	cs.clients[req.Conn] = req.Nick
+	cs.lastSeen[req.Conn] = time.Now()
+	if req.Encoding != "" {
+		cs.encodings[req.Conn] = req.Encoding
+	}
+	cs.mu.Unlock()
+
+	if err := cs.eventBus.Reply(event, req.Nick); err != nil {
+		return err
+	}
+	return cs.eventBus.DispatchContext(event.Context(), "user-joined", Presence{Nick: req.Nick, Conn: req.Conn})
+}
+
+// onUserJoined welcomes a new user, tells everyone else and puts the user in
+// the lobby.
+func (cs *ChatServer) onUserJoined(event eventbus.Event) error {
+	p := event.Data.(Presence)
+	cs.logger.InfoContext(event.Context(), "signed in", "nick", p.Nick, "addr", p.Conn.RemoteAddr().String())
+
+	cs.notify(p.Conn, "Welcome, %s!", p.Nick)
+	cs.send(cs.users(p.Conn), protocol.Envelope{Type: protocol.TypeSystem, Body: p.Nick + " is online"})
+	cs.join(p.Conn, lobby)
+	return nil
+}
+
+func (cs *ChatServer) onUserLeft(event eventbus.Event) error {
+	p := event.Data.(Presence)
+	cs.send(cs.users(p.Conn), protocol.Envelope{Type: protocol.TypeSystem, Body: p.Nick + " went offline"})
+	return nil
+}
+
+// users returns the authenticated connections other than except.
+func (cs *ChatServer) users(except Transportable) []Transportable {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	conns := make([]Transportable, 0, len(cs.nicks))
+	for _, conn := range cs.nicks {
+		if conn != except {
+			conns = append(conns, conn)
+		}
+	}
+	return conns
+}
+
+// who returns the nicknames of the connected users in alphabetical order.
+func (cs *ChatServer) who() []string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	nicks := make([]string, 0, len(cs.nicks))
+	for nick := range cs.nicks {
+		nicks = append(nicks, nick)
+	}
+	sort.Strings(nicks)
+	return nicks
+}
@@ -0,0 +1,140 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/protocol"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/strategy"
+)
+
+// defaultBroadcast is the strategy room messages are delivered with unless
+// WithBroadcastStrategy picks another.
+const defaultBroadcast = "room"
+
+// roster lets broadcast strategies look up the server's clients.
+type roster struct {
+	cs *ChatServer
+}
+
+func (r roster) Clients() []strategy.Conn {
+	r.cs.mu.Lock()
+	defer r.cs.mu.Unlock()
+
+	conns := make([]strategy.Conn, 0, len(r.cs.nicks))
+	for _, conn := range r.cs.nicks {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+func (r roster) Members(room string) []strategy.Conn {
+	members := r.cs.members(room, nil)
+	conns := make([]strategy.Conn, len(members))
+	for i, conn := range members {
+		conns[i] = conn
+	}
+	return conns
+}
+
+// SetBroadcastStrategy switches the strategy room messages are delivered
+// with to the one registered under name. It takes effect with the next
+// message.
+func (cs *ChatServer) SetBroadcastStrategy(name string) error {
+	s, err := strategy.Lookup(name)
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.broadcaster, cs.broadcastName = s, name
+	return nil
+}
+
+// BroadcastStrategy returns the name of the current broadcast strategy.
+func (cs *ChatServer) BroadcastStrategy() string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return cs.broadcastName
+}
+
+// broadcast delivers a room message with the current strategy and
+// disconnects the recipients it could not be written to.
+func (cs *ChatServer) broadcast(room string, from Transportable, env protocol.Envelope) {
+	frames, ok := cs.frames(env)
+	if !ok {
+		return
+	}
+
+	cs.mu.Lock()
+	s, writeTimeout := cs.broadcaster, cs.opts.writeTimeout
+	cs.mu.Unlock()
+
+	failed := s.Broadcast(strategy.Message{Room: room, From: from, Data: frames.plain}, roster{cs}, func(conn strategy.Conn, data []byte) error {
+		setDeadline(conn.(Transportable), true, writeTimeout)
+		_, err := conn.Write(frames.For(conn.(Transportable)))
+		return err
+	})
+	for _, conn := range failed {
+		cs.eventBus.Dispatch("disconnected", conn.(Transportable))
+	}
+}
+
+// BroadcastHandler shows the current broadcast strategy and the available
+// ones as JSON on GET. A POST with the parameter strategy switches to
+// another one. It answers the same requests as TopicAdminHandler, so
+// switching takes the admin token:
+//
+//	curl -X POST -H 'Authorization: Bearer s3cret' 'localhost:8001/broadcast?strategy=sharded'
+func (cs *ChatServer) BroadcastHandler() http.Handler {
+	return cs.requireAdmin(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			if err := cs.SetBroadcastStrategy(req.FormValue("strategy")); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Current   string   `json:"current"`
+			Available []string `json:"available"`
+		}{cs.BroadcastStrategy(), strategy.Names()})
+	}))
+}
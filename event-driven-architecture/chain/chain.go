@@ -0,0 +1,165 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package chain implements the chain of responsibility pattern. A message
+// is passed along a chain of processors, and each processor decides what
+// happens to it: it handles the message and ends the chain, transforms it
+// and passes the result on, or passes it on untouched. The chat server
+// runs every inbound message through a chain. Processors can be added to
+// and removed from a chain while messages flow through it.
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrDuplicate is returned by Register for a name that is already taken.
+var ErrDuplicate = errors.New("chain: processor already registered")
+
+// Next passes a message on to the rest of the chain. After the last
+// processor it does nothing and returns nil.
+type Next[T any] func(msg T) error
+
+// Processor is a link of a chain. It calls next to pass msg, or a message
+// derived from it, on to the links after it, and returns without calling
+// next to end the chain.
+type Processor[T any] interface {
+	Process(msg T, next Next[T]) error
+}
+
+// ProcessorFunc adapts a function to a Processor.
+type ProcessorFunc[T any] func(msg T, next Next[T]) error
+
+func (f ProcessorFunc[T]) Process(msg T, next Next[T]) error {
+	return f(msg, next)
+}
+
+// Link describes a registered processor.
+type Link struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+}
+
+type link[T any] struct {
+	Link
+	seq       uint64
+	processor Processor[T]
+}
+
+// Chain is a chain of processors for messages of type T. It is safe for
+// concurrent use.
+type Chain[T any] struct {
+	mu    sync.RWMutex
+	links []link[T] // never modified in place, so Handle can run on a snapshot
+	seq   uint64
+}
+
+// New returns an empty chain, which passes every message through.
+func New[T any]() *Chain[T] {
+	return &Chain[T]{}
+}
+
+// Register adds p to the chain under name. Processors run from the highest
+// priority to the lowest, in registration order for equal priorities, the
+// same order as the handlers of an event bus. Messages already on their
+// way through the chain are not seen by p.
+func (c *Chain[T]) Register(name string, priority int, p Processor[T]) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, l := range c.links {
+		if l.Name == name {
+			return fmt.Errorf("%w: %s", ErrDuplicate, name)
+		}
+	}
+	c.seq++
+	links := append(append([]link[T](nil), c.links...), link[T]{
+		Link:      Link{Name: name, Priority: priority},
+		seq:       c.seq,
+		processor: p,
+	})
+	sort.SliceStable(links, func(i, j int) bool {
+		if links[i].Priority != links[j].Priority {
+			return links[i].Priority > links[j].Priority
+		}
+		return links[i].seq < links[j].seq
+	})
+	c.links = links
+	return nil
+}
+
+// Unregister removes the processor registered under name, and reports
+// whether there was one.
+func (c *Chain[T]) Unregister(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, l := range c.links {
+		if l.Name == name {
+			links := append([]link[T](nil), c.links[:i]...)
+			c.links = append(links, c.links[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Links lists the registered processors in the order they run.
+func (c *Chain[T]) Links() []Link {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	links := make([]Link, len(c.links))
+	for i, l := range c.links {
+		links[i] = l.Link
+	}
+	return links
+}
+
+// Handle passes msg to the first processor and returns what it returns. A
+// processor gets the error of the processors after it from next, and may
+// handle it or return it in turn.
+func (c *Chain[T]) Handle(msg T) error {
+	c.mu.RLock()
+	links := c.links
+	c.mu.RUnlock()
+
+	var next func(i int) Next[T]
+	next = func(i int) Next[T] {
+		return func(msg T) error {
+			if i == len(links) {
+				return nil
+			}
+			return links[i].processor.Process(msg, next(i+1))
+		}
+	}
+	return next(0)(msg)
+}
@@ -0,0 +1,531 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package client connects Go programs to the chat server. It speaks the
+// envelope protocol of the protocol package over TCP, optionally with TLS,
+// and keeps the connection up: when it drops, the client reconnects with
+// exponential backoff, signs in again and rejoins the rooms it was in.
+// Messages sent while it is disconnected are buffered and sent once it is
+// back.
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/compression"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/protocol"
+	"github.com/rajamummidi/go-design-patterns/state-machine/statemachine"
+)
+
+var (
+	// ErrClosed is returned for sends on a closed client.
+	ErrClosed = errors.New("client: closed")
+	// ErrBufferFull is returned for sends while the buffer of unsent
+	// envelopes is full, which happens when the client has been
+	// disconnected for a while.
+	ErrBufferFull = errors.New("client: send buffer full")
+)
+
+// RejectedError is returned by Dial when the server turns the client away
+// during the handshake, for example because of a wrong token.
+type RejectedError struct {
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return "client: rejected by server: " + e.Reason
+}
+
+// State is the state of a client's connection.
+type State int
+
+const (
+	// Connecting means Dial is trying to reach the server.
+	Connecting State = iota
+	// Authenticated means the server accepted the client's hello, and the
+	// client is rejoining its rooms.
+	Authenticated
+	// Active means the client is in its rooms and can chat.
+	Active
+	// Reconnecting means the connection dropped and the client is trying
+	// to get it back.
+	Reconnecting
+	Closed
+)
+
+func (s State) String() string {
+	switch s {
+	case Connecting:
+		return "connecting"
+	case Authenticated:
+		return "authenticated"
+	case Active:
+		return "active"
+	case Reconnecting:
+		return "reconnecting"
+	case Closed:
+		return "closed"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// trigger is an event of a client's state machine.
+type trigger string
+
+const (
+	signedIn    trigger = "signed in"
+	rejoined    trigger = "rejoined"
+	dropped     trigger = "dropped"
+	retryFailed trigger = "retry failed"
+	closing     trigger = "closing"
+)
+
+// newMachine declares the lifecycle of a connection. A client that cannot
+// connect in the first place is never returned by Dial, so only a client
+// that got as far as signing in once goes on to reconnect.
+func newMachine() *statemachine.Machine[State, trigger] {
+	m := statemachine.New[State, trigger](Connecting).
+		Permit(Connecting, signedIn, Authenticated).
+		Permit(Authenticated, rejoined, Active).
+		Permit(Authenticated, dropped, Reconnecting).
+		Permit(Active, dropped, Reconnecting).
+		Permit(Reconnecting, retryFailed, Reconnecting).
+		Permit(Reconnecting, signedIn, Authenticated)
+	for _, from := range []State{Connecting, Authenticated, Active, Reconnecting} {
+		m.Permit(from, closing, Closed)
+	}
+	return m
+}
+
+// Message is a chat message relayed by the server.
+type Message struct {
+	Room   string
+	Sender string
+	Text   string
+	Time   time.Time
+	// TTL is how long the message stays relevant, zero if it does not
+	// expire.
+	TTL time.Duration
+	// History is set for earlier messages replayed when joining a room.
+	History bool
+}
+
+// Notice is a notice from the server, such as a welcome or someone
+// joining a room.
+type Notice struct {
+	Room string
+	Text string
+	Time time.Time
+}
+
+// Config configures a client. Addr and Nick are required.
+type Config struct {
+	Addr  string
+	Nick  string
+	Token string
+	// TLS, if set, connects over TLS with this configuration.
+	TLS *tls.Config
+	// Rooms are joined after every connect, in order, so the last one is
+	// where messages go. The server puts every client in the lobby first.
+	Rooms []string
+
+	// The wait before the n-th reconnect attempt doubles from MinBackoff
+	// (100ms) up to MaxBackoff (10s), with up to half of it randomized so
+	// that clients dropped together do not all come back together.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// BufferSize is how many envelopes may wait to be sent (100).
+	BufferSize int
+	// Timeout bounds connecting and signing in, and every write (10s).
+	Timeout time.Duration
+	// Compression asks the server to gzip the envelopes it sends, which a
+	// server started with compression does for large ones.
+	Compression bool
+
+	// OnMessage, OnNotice and OnState are called on the client's reading
+	// goroutine, so they must not block for long.
+	OnMessage func(Message)
+	OnNotice  func(Notice)
+	// OnState reports connection changes, with the error that caused a
+	// disconnect.
+	OnState func(state State, err error)
+}
+
+func (c Config) withDefaults() Config {
+	if c.MinBackoff <= 0 {
+		c.MinBackoff = 100 * time.Millisecond
+	}
+	if c.MaxBackoff < c.MinBackoff {
+		c.MaxBackoff = 10 * time.Second
+	}
+	if c.BufferSize <= 0 {
+		c.BufferSize = 100
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	return c
+}
+
+// Client is a connection to the chat server that survives disconnects. It
+// is safe for concurrent use.
+type Client struct {
+	config Config
+	out    chan protocol.Envelope
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	fsm *statemachine.Machine[State, trigger]
+
+	mu    sync.Mutex
+	rooms []string
+}
+
+// session is one connection to the server.
+type session struct {
+	conn net.Conn
+	dec  *protocol.Decoder
+}
+
+// Dial connects to the server and signs in. Until ctx is done it retries
+// with backoff, unless the server rejects the client.
+func Dial(ctx context.Context, config Config) (*Client, error) {
+	if config.Addr == "" || config.Nick == "" {
+		return nil, errors.New("client: Addr and Nick are required")
+	}
+	config = config.withDefaults()
+	c := &Client{
+		config: config,
+		out:    make(chan protocol.Envelope, config.BufferSize),
+		done:   make(chan struct{}),
+		rooms:  append([]string(nil), config.Rooms...),
+		fsm:    newMachine(),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	s, err := c.connect(ctx)
+	for attempt := 0; err != nil; attempt++ {
+		var rejected *RejectedError
+		if errors.As(err, &rejected) {
+			return nil, err
+		}
+		if !sleep(ctx, c.backoff(attempt)) {
+			return nil, fmt.Errorf("client: %w (last error: %v)", ctx.Err(), err)
+		}
+		s, err = c.connect(ctx)
+	}
+	c.fire(signedIn, nil)
+	go c.run(s)
+	return c, nil
+}
+
+// connect dials the server and signs in. The server answers a good hello
+// with a welcome notice and a bad one with an error envelope.
+func (c *Client) connect(ctx context.Context) (session, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	var conn net.Conn
+	var err error
+	if c.config.TLS != nil {
+		dialer := &tls.Dialer{Config: c.config.TLS}
+		conn, err = dialer.DialContext(ctx, "tcp", c.config.Addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", c.config.Addr)
+	}
+	if err != nil {
+		return session{}, err
+	}
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	s := session{conn: conn, dec: protocol.NewDecoder(conn)}
+	err = protocol.NewEncoder(conn).Encode(protocol.Envelope{
+		Type:      protocol.TypeHello,
+		Sender:    c.config.Nick,
+		Timestamp: time.Now().UTC(),
+		Body:      c.config.Token,
+		Encoding:  c.encodings(),
+	})
+	var env protocol.Envelope
+	if err == nil {
+		env, err = s.dec.Decode()
+	}
+	if err == nil {
+		env, err = protocol.Decompress(env)
+	}
+	if err == nil && env.Type == protocol.TypeError {
+		err = &RejectedError{Reason: env.Body}
+	}
+	if err != nil {
+		conn.Close()
+		return session{}, err
+	}
+	conn.SetDeadline(time.Time{})
+	c.deliver(env)
+	return s, nil
+}
+
+// encodings returns the body encodings the client accepts.
+func (c *Client) encodings() string {
+	if c.config.Compression {
+		return compression.Gzip
+	}
+	return ""
+}
+
+// run serves connections until the client is closed, reconnecting
+// whenever one drops. Rejections are retried here too: after a drop the
+// server may not have noticed yet that the nickname is free again.
+func (c *Client) run(s session) {
+	defer close(c.done)
+
+	for {
+		err := c.serve(s)
+		if c.ctx.Err() != nil {
+			c.fire(closing, nil)
+			return
+		}
+		c.fire(dropped, err)
+
+		for attempt := 0; ; attempt++ {
+			if !sleep(c.ctx, c.backoff(attempt)) {
+				c.fire(closing, nil)
+				return
+			}
+			if s, err = c.connect(c.ctx); err == nil {
+				break
+			}
+			c.fire(retryFailed, err)
+		}
+		c.fire(signedIn, nil)
+	}
+}
+
+// serve rejoins the client's rooms on s, then writes buffered envelopes
+// and reads incoming ones until the connection fails or the client is
+// closed.
+func (c *Client) serve(s session) error {
+	defer s.conn.Close()
+
+	c.mu.Lock()
+	rooms := append([]string(nil), c.rooms...)
+	c.mu.Unlock()
+	for _, room := range rooms {
+		if err := c.write(s.conn, command("JOIN", room)); err != nil {
+			return err
+		}
+	}
+	c.fire(rejoined, nil)
+
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- c.read(s.dec)
+	}()
+
+	for {
+		select {
+		case env := <-c.out:
+			if err := c.write(s.conn, env); err != nil {
+				// The envelope may or may not have reached the server.
+				// Sending it again risks a duplicate, dropping it a loss;
+				// chat messages are better duplicated.
+				c.requeue(env)
+				return err
+			}
+		case err := <-readErr:
+			return err
+		case <-c.ctx.Done():
+			return ErrClosed
+		}
+	}
+}
+
+// requeue puts env back in the buffer, if there is room.
+func (c *Client) requeue(env protocol.Envelope) {
+	select {
+	case c.out <- env:
+	default:
+	}
+}
+
+func (c *Client) write(conn net.Conn, env protocol.Envelope) error {
+	conn.SetWriteDeadline(time.Now().Add(c.config.Timeout))
+	return protocol.NewEncoder(conn).Encode(env)
+}
+
+// read delivers incoming envelopes until the connection fails. An error
+// envelope tells why the server is about to close the connection.
+func (c *Client) read(dec *protocol.Decoder) error {
+	for {
+		env, err := dec.Decode()
+		if err == nil {
+			env, err = protocol.Decompress(env)
+		}
+		if err != nil {
+			return err
+		}
+		if env.Type == protocol.TypeError {
+			return fmt.Errorf("client: disconnected by server: %s", env.Body)
+		}
+		c.deliver(env)
+	}
+}
+
+func (c *Client) deliver(env protocol.Envelope) {
+	switch env.Type {
+	case protocol.TypeMessage, protocol.TypeHistory:
+		if c.config.OnMessage != nil {
+			c.config.OnMessage(Message{
+				Room:    env.Room,
+				Sender:  env.Sender,
+				Text:    env.Body,
+				Time:    env.Timestamp,
+				TTL:     time.Duration(env.TTL) * time.Second,
+				History: env.Type == protocol.TypeHistory,
+			})
+		}
+	case protocol.TypeSystem:
+		if c.config.OnNotice != nil {
+			c.config.OnNotice(Notice{Room: env.Room, Text: env.Body, Time: env.Timestamp})
+		}
+	}
+}
+
+// fire moves the client's state machine and reports the new state. Only
+// Dial and then the run goroutine fire triggers, so they never race.
+func (c *Client) fire(event trigger, err error) {
+	if c.fsm.Fire(event) != nil {
+		return
+	}
+	if c.config.OnState != nil {
+		c.config.OnState(c.fsm.State(), err)
+	}
+}
+
+// State returns the state of the connection.
+func (c *Client) State() State {
+	return c.fsm.State()
+}
+
+// backoff returns the wait before reconnect attempt n, counting from 0.
+func (c *Client) backoff(n int) time.Duration {
+	d := c.config.MinBackoff
+	for i := 0; i < n && d < c.config.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > c.config.MaxBackoff {
+		d = c.config.MaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleep waits for d and reports whether ctx was still live after it.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Send sends text to the room the client is talking in. While the client
+// is disconnected, the message waits in the buffer.
+func (c *Client) Send(text string) error {
+	return c.enqueue(protocol.Envelope{Type: protocol.TypeMessage, Body: text})
+}
+
+// SendTTL is like Send for a message that expires after ttl, which the
+// server rounds up to whole seconds.
+func (c *Client) SendTTL(text string, ttl time.Duration) error {
+	seconds := int((ttl + time.Second - 1) / time.Second)
+	return c.enqueue(protocol.Envelope{Type: protocol.TypeMessage, Body: text, TTL: seconds})
+}
+
+// Join joins room and makes it the room messages go to. The client joins
+// it again after every reconnect until Leave is called.
+func (c *Client) Join(room string) error {
+	c.mu.Lock()
+	c.rooms = append(remove(c.rooms, room), room)
+	c.mu.Unlock()
+	return c.enqueue(command("JOIN", room))
+}
+
+// Leave leaves room.
+func (c *Client) Leave(room string) error {
+	c.mu.Lock()
+	c.rooms = remove(c.rooms, room)
+	c.mu.Unlock()
+	return c.enqueue(command("LEAVE", room))
+}
+
+func (c *Client) enqueue(env protocol.Envelope) error {
+	if c.ctx.Err() != nil {
+		return ErrClosed
+	}
+	select {
+	case c.out <- env:
+		return nil
+	default:
+		return ErrBufferFull
+	}
+}
+
+// Close closes the connection and stops reconnecting. Envelopes still in
+// the buffer are not sent.
+func (c *Client) Close() error {
+	c.cancel()
+	<-c.done
+	return nil
+}
+
+func command(name, room string) protocol.Envelope {
+	return protocol.Envelope{Type: protocol.TypeMessage, Body: name + " " + room}
+}
+
+func remove(rooms []string, room string) []string {
+	kept := rooms[:0]
+	for _, r := range rooms {
+		if r != room {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,201 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/client"
+)
+
+// chat-client is an interactive client for the chat server. Lines read
+// from stdin are sent to the current room, JOIN <room> and LEAVE <room>
+// switch rooms, and /quit or end of input exits:
+//
+//	chat-client -addr localhost:8000 -nick raja -rooms go,ops
+//
+// When the connection drops, the client reconnects with exponential backoff
+// and rejoins its rooms; lines typed in the meantime are sent once it is
+// back.
+func main() {
+	addr := flag.String("addr", "localhost:8000", "address of the chat server")
+	nick := flag.String("nick", os.Getenv("USER"), "nickname to sign in with")
+	token := flag.String("token", "", "token for a nickname listed in the server's token file")
+	rooms := flag.String("rooms", "", "comma-separated rooms to join, the last one being where messages go")
+	useTLS := flag.Bool("tls", false, "connect over TLS")
+	caFile := flag.String("ca", "", "PEM file of the CA to trust for -tls instead of the system roots")
+	minBackoff := flag.Duration("min-backoff", 100*time.Millisecond, "wait before the first reconnect attempt")
+	maxBackoff := flag.Duration("max-backoff", 10*time.Second, "longest wait between reconnect attempts")
+	compress := flag.Bool("compress", false, "ask the server to gzip large envelopes")
+	flag.Parse()
+
+	config := client.Config{
+		Addr:        *addr,
+		Nick:        *nick,
+		Token:       *token,
+		MinBackoff:  *minBackoff,
+		MaxBackoff:  *maxBackoff,
+		Compression: *compress,
+		OnMessage:   printMessage,
+		OnNotice:    printNotice,
+		OnState:     stateReporter(),
+	}
+	if *rooms != "" {
+		config.Rooms = strings.Split(*rooms, ",")
+	}
+	if *useTLS {
+		tlsConfig, err := loadTLS(*caFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		config.TLS = tlsConfig
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(os.Stderr, "-- connecting to %s as %s\n", *addr, *nick)
+	c, err := client.Dial(ctx, config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer c.Close()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case line, ok := <-lines:
+			if !ok || strings.TrimSpace(line) == "/quit" {
+				return
+			}
+			if err := handle(c, line); err != nil {
+				fmt.Fprintln(os.Stderr, "--", err)
+			}
+		}
+	}
+}
+
+// handle sends a line typed by the user. Room changes go through Join and
+// Leave rather than as plain text, so that the client remembers its rooms
+// and rejoins them after a reconnect.
+func handle(c *client.Client, line string) error {
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+	command, room, _ := strings.Cut(strings.TrimSpace(line), " ")
+	room = strings.TrimSpace(room)
+	switch strings.ToUpper(command) {
+	case "JOIN", "/JOIN":
+		if room != "" {
+			return c.Join(room)
+		}
+	case "LEAVE", "/LEAVE":
+		if room != "" {
+			return c.Leave(room)
+		}
+	}
+	return c.Send(line)
+}
+
+func printMessage(m client.Message) {
+	if m.History {
+		fmt.Printf("%s #%s <%s> %s (earlier)\n", m.Time.Local().Format(time.Kitchen), m.Room, m.Sender, m.Text)
+		return
+	}
+	fmt.Printf("%s #%s <%s> %s\n", m.Time.Local().Format(time.Kitchen), m.Room, m.Sender, m.Text)
+}
+
+func printNotice(n client.Notice) {
+	if n.Room != "" {
+		fmt.Printf("%s #%s * %s\n", n.Time.Local().Format(time.Kitchen), n.Room, n.Text)
+		return
+	}
+	fmt.Printf("%s * %s\n", n.Time.Local().Format(time.Kitchen), n.Text)
+}
+
+// stateReporter returns an OnState callback that tells the user about the
+// connection on stderr. The client calls it from one goroutine at a time,
+// so it can remember the previous state to tell a lost connection from a
+// failed attempt to get it back.
+func stateReporter() func(client.State, error) {
+	previous := client.Connecting
+	return func(state client.State, err error) {
+		switch {
+		case state == client.Reconnecting && previous == client.Reconnecting:
+			fmt.Fprintf(os.Stderr, "-- reconnect failed: %v\n", err)
+		case state == client.Reconnecting:
+			fmt.Fprintf(os.Stderr, "-- connection lost: %v; reconnecting\n", err)
+		case state == client.Active:
+			fmt.Fprintln(os.Stderr, "-- connected")
+		}
+		previous = state
+	}
+}
+
+// loadTLS returns the TLS configuration for the connection. Without a CA
+// file the system roots are trusted.
+func loadTLS(caFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return config, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in " + caFile)
+	}
+	config.RootCAs = roots
+	return config, nil
+}
@@ -0,0 +1,72 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventstore"
+)
+
+// reencrypt-events rewrites an event log with a new key after a rotation:
+//
+//	EVENTSTORE_KEY_K2=... EVENTSTORE_KEY_K1=... reencrypt-events -key k2 -old k1 events.jsonl
+func main() {
+	active := flag.String("key", "", "ID of the key to encrypt with")
+	old := flag.String("old", "", "comma-separated IDs of keys the log may currently use")
+	prefix := flag.String("env-prefix", "EVENTSTORE_KEY_", "prefix of the environment variables holding the secrets")
+	flag.Parse()
+
+	if *active == "" || flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: reencrypt-events -key ID [-old ID,...] LOG...")
+		os.Exit(2)
+	}
+
+	var older []string
+	if *old != "" {
+		older = strings.Split(*old, ",")
+	}
+	keyring, err := eventstore.NewKeyring(eventstore.EnvSecrets{Prefix: *prefix}, *active, older...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	for _, path := range flag.Args() {
+		n, err := eventstore.Reencrypt(path, keyring)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s: re-encrypted %d events with key %s\n", path, n, *active)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/compression"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/protocol"
+)
+
+// compressionOptions are the settings of WithCompression.
+type compressionOptions struct {
+	threshold int
+	rooms     map[string]bool // empty means every envelope
+}
+
+// applies reports whether env is large enough, and in a room listed, to be
+// compressed.
+func (o *compressionOptions) applies(env protocol.Envelope) bool {
+	if o == nil || len(env.Body) < o.threshold {
+		return false
+	}
+	return len(o.rooms) == 0 || o.rooms[env.Room]
+}
+
+// frames is an envelope on its way to several connections. It is marshaled
+// once as it is, and compressed at most once per encoding, however many
+// recipients accept it. Sharded broadcasts write from several goroutines at
+// once, hence the lock.
+type frames struct {
+	cs       *ChatServer
+	env      protocol.Envelope
+	plain    []byte
+	compress bool
+
+	mu      sync.Mutex
+	encoded map[string][]byte // nil if compressing did not pay off
+}
+
+// frames marshals env, stamping it with the current time if it has none.
+func (cs *ChatServer) frames(env protocol.Envelope) (*frames, bool) {
+	if env.Timestamp.IsZero() {
+		env.Timestamp = time.Now().UTC()
+	}
+	data, ok := cs.encode(env)
+	if !ok {
+		return nil, false
+	}
+	cs.mu.Lock()
+	compress := cs.opts.compression.applies(env)
+	cs.mu.Unlock()
+	return &frames{cs: cs, env: env, plain: data, compress: compress}, true
+}
+
+// For returns the bytes to write to conn: the compressed envelope if conn
+// accepts an encoding and compressing made it smaller, the plain one
+// otherwise.
+func (f *frames) For(conn Transportable) []byte {
+	if !f.compress {
+		return f.plain
+	}
+	f.cs.mu.Lock()
+	encoding := f.cs.encodings[conn]
+	f.cs.mu.Unlock()
+	if encoding == "" {
+		return f.plain
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, done := f.encoded[encoding]
+	if !done {
+		data = f.cs.compressEnvelope(f.env, encoding, len(f.plain))
+		if f.encoded == nil {
+			f.encoded = make(map[string][]byte)
+		}
+		f.encoded[encoding] = data
+	}
+	if data == nil {
+		return f.plain
+	}
+	return data
+}
+
+// compressEnvelope returns env compressed and marshaled, or nil if that
+// failed or came out no smaller than the plain size.
+func (cs *ChatServer) compressEnvelope(env protocol.Envelope, encoding string, plain int) []byte {
+	compressed, err := protocol.Compress(env, encoding)
+	if err != nil {
+		cs.logger.Error("compressing envelope", "type", env.Type, "err", err)
+		return nil
+	}
+	data, ok := cs.encode(compressed)
+	if !ok || len(data) >= plain {
+		return nil
+	}
+	cs.mu.Lock()
+	cs.compression.Compressed(plain, len(data))
+	cs.mu.Unlock()
+	return data
+}
+
+// recordDecompression counts a compressed envelope received from a client.
+func (cs *ChatServer) recordDecompression(in, out int) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.compression.Decompressed(in, out)
+}
+
+// CompressionStats returns how much the server saved by compressing the
+// envelopes it sent, and what it decompressed from clients.
+func (cs *ChatServer) CompressionStats() compression.Stats {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.compression
+}
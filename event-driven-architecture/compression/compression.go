@@ -0,0 +1,149 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package compression compresses payloads for the chat protocol and the
+// bridges, and counts what it saved.
+//
+// The only encoding is gzip. zstd compresses faster and better, but the
+// standard library has no zstd, and the examples depend on nothing outside
+// it. The encodings are negotiated by name, so a peer that offers zstd and
+// gzip gets gzip.
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Gzip is the name of the gzip encoding in headers and envelopes.
+const Gzip = "gzip"
+
+// ErrTooLarge is returned by Decompress when a payload expands to more than
+// the limit.
+var ErrTooLarge = errors.New("compression: payload too large once decompressed")
+
+// Supported reports whether encoding is one this package implements.
+func Supported(encoding string) bool {
+	return encoding == Gzip
+}
+
+// Negotiate returns the first supported encoding in offered, a
+// comma-separated list in order of preference, or "" if there is none.
+func Negotiate(offered string) string {
+	for _, encoding := range strings.Split(offered, ",") {
+		if encoding = strings.TrimSpace(encoding); Supported(encoding) {
+			return encoding
+		}
+	}
+	return ""
+}
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+// Compress compresses payload with encoding.
+func Compress(encoding string, payload []byte) ([]byte, error) {
+	if !Supported(encoding) {
+		return nil, fmt.Errorf("compression: unsupported encoding %q", encoding)
+	}
+	var buf bytes.Buffer
+	zw := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(zw)
+
+	zw.Reset(&buf)
+	if _, err := zw.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress reverses Compress. A payload that expands to more than limit
+// bytes fails with ErrTooLarge rather than being cut short, so a peer
+// cannot make the reader buffer without bound.
+func Decompress(encoding string, payload []byte, limit int) ([]byte, error) {
+	if !Supported(encoding) {
+		return nil, fmt.Errorf("compression: unsupported encoding %q", encoding)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("compression: %w", err)
+	}
+	defer zr.Close()
+
+	// One byte past the limit tells a payload of exactly limit bytes from
+	// a longer one.
+	data, err := io.ReadAll(io.LimitReader(zr, int64(limit)+1))
+	if err != nil {
+		return nil, fmt.Errorf("compression: %w", err)
+	}
+	if len(data) > limit {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
+
+// Stats counts the bytes that were compressed and decompressed. It does no
+// locking; its owner keeps it under its own lock.
+type Stats struct {
+	Messages        uint64 `json:"messages"`
+	BytesBefore     uint64 `json:"bytes_before"`
+	BytesAfter      uint64 `json:"bytes_after"`
+	DecompressedIn  uint64 `json:"decompressed_in"`
+	DecompressedOut uint64 `json:"decompressed_out"`
+}
+
+// Compressed records a payload of before bytes compressed to after bytes.
+func (s *Stats) Compressed(before, after int) {
+	s.Messages++
+	s.BytesBefore += uint64(before)
+	s.BytesAfter += uint64(after)
+}
+
+// Decompressed records a payload of in bytes decompressed to out bytes.
+func (s *Stats) Decompressed(in, out int) {
+	s.DecompressedIn += uint64(in)
+	s.DecompressedOut += uint64(out)
+}
+
+// Ratio is the compressed size of outgoing payloads relative to their
+// original size, or 1 if nothing was compressed yet.
+func (s Stats) Ratio() float64 {
+	if s.BytesBefore == 0 {
+		return 1
+	}
+	return float64(s.BytesAfter) / float64(s.BytesBefore)
+}
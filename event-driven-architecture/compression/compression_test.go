@@ -0,0 +1,106 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package compression
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	payload := bytes.Repeat([]byte("hello, chat "), 100)
+	compressed, err := Compress(Gzip, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compressed) >= len(payload) {
+		t.Errorf("compressed %d bytes to %d", len(payload), len(compressed))
+	}
+	got, err := Decompress(Gzip, compressed, len(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Error("payload changed in the round trip")
+	}
+}
+
+// TestDecompressLimit checks that a payload over the limit fails instead
+// of being cut short.
+func TestDecompressLimit(t *testing.T) {
+	compressed, err := Compress(Gzip, make([]byte, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decompress(Gzip, compressed, 1000); err != nil {
+		t.Errorf("payload of exactly the limit: %v", err)
+	}
+	if _, err := Decompress(Gzip, compressed, 999); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("payload over the limit: got %v, want ErrTooLarge", err)
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	if _, err := Compress("zstd", nil); err == nil {
+		t.Error("Compress accepted zstd")
+	}
+	if _, err := Decompress("zstd", nil, 10); err == nil {
+		t.Error("Decompress accepted zstd")
+	}
+	if _, err := Decompress(Gzip, []byte("not gzip"), 10); err == nil {
+		t.Error("Decompress accepted a corrupt payload")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for offered, want := range map[string]string{
+		"":           "",
+		"gzip":       "gzip",
+		"zstd, gzip": "gzip",
+		"zstd":       "",
+		"br,gzip":    "gzip",
+	} {
+		if got := Negotiate(offered); got != want {
+			t.Errorf("Negotiate(%q) = %q, want %q", offered, got, want)
+		}
+	}
+}
+
+func TestRatio(t *testing.T) {
+	var s Stats
+	if s.Ratio() != 1 {
+		t.Errorf("empty ratio = %v, want 1", s.Ratio())
+	}
+	s.Compressed(100, 25)
+	s.Compressed(300, 75)
+	if s.Ratio() != 0.25 || s.Messages != 2 {
+		t.Errorf("got %+v, ratio %v", s, s.Ratio())
+	}
+}
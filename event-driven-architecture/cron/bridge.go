@@ -0,0 +1,130 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package cron
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Publisher is the part of the EventBus the bridge needs.
+type Publisher interface {
+	Dispatch(eventType string, data interface{}) error
+}
+
+// Entry publishes an event on Topic whenever Cron matches. The event data is
+// the scheduled time of the tick.
+type Entry struct {
+	Topic string `json:"topic"`
+	Cron  string `json:"cron"`
+}
+
+// LoadEntries reads a JSON array of entries, for example:
+//
+//	[{"topic": "cleanup", "cron": "0 3 * * *"}]
+func LoadEntries(path string) ([]Entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("cron: %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// Bridge turns cron schedules into events, so time-driven flows go through
+// the same bus as everything else.
+type Bridge struct {
+	bus       Publisher
+	entries   []Entry
+	schedules []*Schedule
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewBridge validates all entries up front so a typo in the configuration
+// fails at startup rather than silently never firing.
+func NewBridge(bus Publisher, entries []Entry) (*Bridge, error) {
+	schedules := make([]*Schedule, len(entries))
+	for i, entry := range entries {
+		schedule, err := Parse(entry.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("topic %s: %w", entry.Topic, err)
+		}
+		schedules[i] = schedule
+	}
+	return &Bridge{bus: bus, entries: entries, schedules: schedules}, nil
+}
+
+// Start runs one goroutine per entry until ctx is done or Stop is called.
+func (b *Bridge) Start(ctx context.Context) {
+	ctx, b.cancel = context.WithCancel(ctx)
+	for i := range b.entries {
+		b.wg.Add(1)
+		go b.run(ctx, b.entries[i], b.schedules[i])
+	}
+}
+
+// Stop stops all entries and waits for their goroutines to exit.
+func (b *Bridge) Stop() {
+	if b.cancel != nil {
+		b.cancel()
+	}
+	b.wg.Wait()
+}
+
+func (b *Bridge) run(ctx context.Context, entry Entry, schedule *Schedule) {
+	defer b.wg.Done()
+
+	for {
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := b.bus.Dispatch(entry.Topic, next); err != nil {
+			fmt.Printf("Error publishing scheduled %s event: %v\n", entry.Topic, err)
+		}
+	}
+}
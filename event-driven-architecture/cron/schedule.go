@@ -0,0 +1,171 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed five-field cron expression:
+//
+//	minute hour day-of-month month day-of-week
+//
+// Each field accepts *, single values, ranges (1-5), lists (1,15) and steps
+// (*/10, 0-30/5). Day-of-week runs from 0 (Sunday) to 6; 7 is also Sunday.
+// As in classic cron, when both day fields are restricted a time matches if
+// either of them does.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Parse parses a cron expression such as "0 3 * * *".
+func Parse(expr string) (*Schedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("cron: %q: expected %d fields, got %d", expr, len(fields), len(parts))
+	}
+
+	masks := make([]uint64, len(fields))
+	for i, part := range parts {
+		mask, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron: %q: %w", expr, err)
+		}
+		masks[i] = mask
+	}
+
+	// Fold 7 into 0 so that both spellings of Sunday match.
+	if masks[4]&(1<<7) != 0 {
+		masks[4] = masks[4]&^(1<<7) | 1
+	}
+
+	return &Schedule{
+		minute: masks[0],
+		hour:   masks[1],
+		dom:    masks[2],
+		month:  masks[3],
+		dow:    masks[4],
+		domAny: parts[2] == "*",
+		dowAny: parts[4] == "*",
+	}, nil
+}
+
+func parseField(s string, f field) (uint64, error) {
+	var mask uint64
+	for _, item := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q in %s", stepStr, f.name)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(loStr); err != nil {
+				return 0, fmt.Errorf("invalid value %q in %s", loStr, f.name)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiStr); err != nil {
+					return 0, fmt.Errorf("invalid value %q in %s", hiStr, f.name)
+				}
+			} else if hasStep {
+				hi = f.max
+			}
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("%s range %d-%d outside %d-%d", f.name, lo, hi, f.min, f.max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			mask |= 1 << uint(v)
+		}
+	}
+	return mask, nil
+}
+
+// Next returns the first time after t that matches the schedule, or the zero
+// time if there is none within the next five years (for example "0 0 30 2 *").
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
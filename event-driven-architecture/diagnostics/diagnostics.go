@@ -0,0 +1,206 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package diagnostics turns log records into events. Its Handler is an
+// slog.Handler that publishes warnings and errors on an event bus, so the
+// parts of a program that alert or notify people can react to log
+// conditions the same way they react to any other event, without parsing
+// log output.
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+)
+
+// Topic is the default topic prefix of log events. A record is published as
+// the prefix followed by its lower-cased level, for example
+// "diagnostics.warn", so "diagnostics.*" sees every level.
+const Topic = "diagnostics"
+
+// Record is the data of a log event.
+type Record struct {
+	Time    time.Time
+	Level   slog.Level
+	Message string
+	// Attrs holds the attributes of the record and of its logger. Keys in
+	// groups are qualified with the group names, as in "request.id".
+	Attrs map[string]interface{}
+}
+
+// Options configures a Handler.
+type Options struct {
+	// Level is the lowest level that is published (slog.LevelWarn by
+	// default). Records below it only go to Next.
+	Level slog.Leveler
+	// Topic is the topic prefix of the events (Topic by default).
+	Topic string
+	// Next, if set, also receives every record it is enabled for, so the
+	// handler can be put in front of the handler that writes the log.
+	Next slog.Handler
+}
+
+// Handler publishes log records as events. Handlers of its events must not
+// log at a published level themselves: on a synchronous bus that would
+// publish again from inside the handler.
+type Handler struct {
+	bus    *eventbus.EventBus
+	level  slog.Leveler
+	topic  string
+	next   slog.Handler
+	attrs  map[string]interface{} // of the logger, keys qualified with their groups
+	groups []string
+}
+
+var _ slog.Handler = (*Handler)(nil)
+
+// NewHandler returns a handler that publishes records on bus. opts may be
+// nil.
+func NewHandler(bus *eventbus.EventBus, opts *Options) *Handler {
+	h := &Handler{bus: bus, level: slog.LevelWarn, topic: Topic}
+	if opts != nil {
+		if opts.Level != nil {
+			h.level = opts.Level
+		}
+		if opts.Topic != "" {
+			h.topic = opts.Topic
+		}
+		h.next = opts.Next
+	}
+	return h
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.publishes(level) || (h.next != nil && h.next.Enabled(ctx, level))
+}
+
+func (h *Handler) publishes(level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle publishes the record if its level is high enough and passes it on
+// to Next. The event carries ctx, so it joins the trace of the record. An
+// error publishing the event does not keep the record from Next.
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	if h.publishes(r.Level) {
+		errs = append(errs, h.bus.DispatchContext(ctx, h.Topic(r.Level), h.record(r)))
+	}
+	if h.next != nil && h.next.Enabled(ctx, r.Level) {
+		errs = append(errs, h.next.Handle(ctx, r))
+	}
+	return errors.Join(errs...)
+}
+
+// Topic returns the topic records of level are published under.
+func (h *Handler) Topic(level slog.Level) string {
+	return h.topic + "." + strings.ToLower(level.String())
+}
+
+func (h *Handler) record(r slog.Record) Record {
+	rec := Record{
+		Time:    r.Time,
+		Level:   r.Level,
+		Message: r.Message,
+		Attrs:   make(map[string]interface{}, len(h.attrs)+r.NumAttrs()),
+	}
+	for key, value := range h.attrs {
+		rec.Attrs[key] = value
+	}
+	prefix := strings.Join(h.groups, ".")
+	r.Attrs(func(a slog.Attr) bool {
+		addAttr(rec.Attrs, prefix, a)
+		return true
+	})
+	return rec
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := h.clone()
+	prefix := strings.Join(h.groups, ".")
+	for _, a := range attrs {
+		addAttr(h2.attrs, prefix, a)
+	}
+	if h.next != nil {
+		h2.next = h.next.WithAttrs(attrs)
+	}
+	return h2
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := h.clone()
+	h2.groups = append(h2.groups, name)
+	if h.next != nil {
+		h2.next = h.next.WithGroup(name)
+	}
+	return h2
+}
+
+func (h *Handler) clone() *Handler {
+	h2 := *h
+	h2.attrs = make(map[string]interface{}, len(h.attrs))
+	for key, value := range h.attrs {
+		h2.attrs[key] = value
+	}
+	h2.groups = append([]string(nil), h.groups...)
+	return &h2
+}
+
+// addAttr stores a in attrs under its key qualified with prefix, flattening
+// groups and resolving LogValuers. Empty attributes are left out, as slog
+// asks of handlers.
+func addAttr(attrs map[string]interface{}, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	key := a.Key
+	if prefix != "" && key != "" {
+		key = prefix + "." + key
+	} else if key == "" {
+		key = prefix
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			addAttr(attrs, key, ga)
+		}
+		return
+	}
+	attrs[key] = a.Value.Any()
+}
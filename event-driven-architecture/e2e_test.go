@@ -0,0 +1,352 @@
+//go:build e2e
+
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// These tests build the chat server and the chat client, run them as
+// separate processes and talk to them over loopback, the way users and
+// operators do. Run them with
+//
+//	go test -tags e2e -run E2E .
+
+// bin holds the binaries TestMain builds.
+var bin string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "chat-e2e")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	bin = dir
+	code := build(dir)
+	if code == 0 {
+		code = m.Run()
+	}
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func build(dir string) int {
+	for name, pkg := range map[string]string{"chat": ".", "chat-client": "./cmd/chat-client"} {
+		cmd := exec.Command("go", "build", "-o", filepath.Join(dir, name), pkg)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			fmt.Fprintf(os.Stderr, "building %s: %v\n%s", name, err, out)
+			return 1
+		}
+	}
+	return 0
+}
+
+// freeAddr returns a loopback address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// lines collects the output of a process line by line.
+type lines struct {
+	mu      sync.Mutex
+	partial []byte
+	all     []string
+	ch      chan string
+}
+
+func newLines() *lines {
+	return &lines{ch: make(chan string, 10000)}
+}
+
+func (l *lines) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.partial = append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(l.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := string(l.partial[:i])
+		l.partial = l.partial[i+1:]
+		l.all = append(l.all, line)
+		l.ch <- line
+	}
+}
+
+func (l *lines) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.all, "\n")
+}
+
+// expect waits for a line containing want and returns it.
+func (l *lines) expect(t *testing.T, who, want string) string {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line := <-l.ch:
+			if strings.Contains(line, want) {
+				return line
+			}
+		case <-timeout:
+			t.Fatalf("%s did not print %q; output so far:\n%s", who, want, l)
+		}
+	}
+}
+
+type server struct {
+	addr, admin string
+	cmd         *exec.Cmd
+	out         *lines
+}
+
+// startServer runs the chat server and waits until it is ready. The test
+// fails unless the server exits cleanly on SIGINT at the end.
+func startServer(t *testing.T, args ...string) *server {
+	t.Helper()
+	s := &server{addr: freeAddr(t), admin: freeAddr(t), out: newLines()}
+	args = append([]string{"-port", s.addr, "-metrics", s.admin, "-rate", "0", "-drain-timeout", "1s"}, args...)
+	s.cmd = exec.Command(filepath.Join(bin, "chat"), args...)
+	s.cmd.Stdout, s.cmd.Stderr = s.out, s.out
+	if err := s.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.cmd.Process.Signal(os.Interrupt)
+		if err := s.cmd.Wait(); err != nil {
+			t.Errorf("server exited with %v; output:\n%s", err, s.out)
+		}
+	})
+
+	for start := time.Now(); ; time.Sleep(20 * time.Millisecond) {
+		resp, err := http.Get("http://" + s.admin + "/readyz")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return s
+			}
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("server not ready: %v; output:\n%s", err, s.out)
+		}
+	}
+}
+
+// vars returns the server's /debug/vars.
+func (s *server) vars(t *testing.T) struct {
+	History HistoryStats `json:"history"`
+} {
+	t.Helper()
+	resp, err := http.Get("http://" + s.admin + "/debug/vars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var vars struct {
+		History HistoryStats `json:"history"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&vars); err != nil {
+		t.Fatal(err)
+	}
+	return vars
+}
+
+type chatClient struct {
+	nick     string
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	out, log *lines
+}
+
+// startClient runs the chat client and waits until it is in its rooms.
+func startClient(t *testing.T, s *server, nick string, rooms string) *chatClient {
+	t.Helper()
+	c := &chatClient{nick: nick, out: newLines(), log: newLines()}
+	c.cmd = exec.Command(filepath.Join(bin, "chat-client"), "-addr", s.addr, "-nick", nick, "-rooms", rooms)
+	c.cmd.Stdout, c.cmd.Stderr = c.out, c.log
+	var err error
+	if c.stdin, err = c.cmd.StdinPipe(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.stdin.Close()
+		c.cmd.Wait()
+	})
+	c.log.expect(t, nick, "-- connected")
+	return c
+}
+
+func (c *chatClient) send(t *testing.T, line string) {
+	t.Helper()
+	if _, err := io.WriteString(c.stdin, line+"\n"); err != nil {
+		t.Fatalf("%s: %v", c.nick, err)
+	}
+}
+
+func (c *chatClient) expect(t *testing.T, want string) string {
+	t.Helper()
+	return c.out.expect(t, c.nick, want)
+}
+
+func TestE2EChat(t *testing.T) {
+	s := startServer(t)
+	alice := startClient(t, s, "alice", "go")
+	bob := startClient(t, s, "bob", "go")
+
+	alice.send(t, "hello bob")
+	bob.expect(t, "#go <alice> hello bob")
+	bob.send(t, "hi alice")
+	alice.expect(t, "#go <bob> hi alice")
+
+	bob.send(t, "/who")
+	bob.expect(t, "Online: alice, bob")
+
+	// A client that quits leaves the others notified and its nickname free.
+	alice.send(t, "/quit")
+	if err := alice.cmd.Wait(); err != nil {
+		t.Fatalf("alice exited with %v", err)
+	}
+	bob.expect(t, "alice went offline")
+	startClient(t, s, "alice", "go")
+	bob.expect(t, "alice is online")
+}
+
+// TestE2EClientKilledMidStream kills a client while it is sending messages
+// as fast as it can. The server must notice, tell the others, free the
+// nickname and keep every message that was relayed.
+func TestE2EClientKilledMidStream(t *testing.T) {
+	s := startServer(t)
+	bob := startClient(t, s, "bob", "go")
+	carol := startClient(t, s, "carol", "go")
+
+	// The history keeps 50 messages per room, so carol sends fewer.
+	streaming := make(chan struct{})
+	go func() {
+		defer close(streaming)
+		for i := 0; i < 40; i++ {
+			if _, err := fmt.Fprintf(carol.stdin, "message %d\n", i); err != nil {
+				return
+			}
+			time.Sleep(2 * time.Millisecond)
+		}
+	}()
+	bob.expect(t, "<carol> message 5")
+	if err := carol.cmd.Process.Kill(); err != nil {
+		t.Fatal(err)
+	}
+	<-streaming
+
+	// Every message the server relayed reached bob before the notice that
+	// carol is gone, and was recorded in the history.
+	relayed := 6
+	for {
+		line := bob.expect(t, " ")
+		if strings.Contains(line, "carol went offline") {
+			break
+		}
+		if strings.Contains(line, "<carol> message") {
+			relayed++
+		}
+	}
+	if history := s.vars(t).History; history.Messages != relayed {
+		t.Errorf("history holds %d messages, bob received %d", history.Messages, relayed)
+	}
+
+	bob.send(t, "/who")
+	bob.expect(t, "Online: bob")
+	startClient(t, s, "carol", "go")
+	bob.expect(t, "carol is online")
+}
+
+// TestE2EDrain stops the server while clients are connected. The clients
+// are asked to reconnect and keep trying, and the server exits cleanly,
+// which the cleanup of startServer checks.
+func TestE2EDrain(t *testing.T) {
+	s := startServer(t)
+	alice := startClient(t, s, "alice", "go")
+
+	s.cmd.Process.Signal(os.Interrupt)
+	alice.expect(t, "Server is restarting, please reconnect.")
+	alice.log.expect(t, "alice", "-- connection lost")
+}
+
+// TestE2EDrainOverHTTP checks that POST /drain takes the admin token, and
+// that the server drains once it gets it.
+func TestE2EDrainOverHTTP(t *testing.T) {
+	s := startServer(t, "-admin-token", "s3cret")
+	alice := startClient(t, s, "alice", "go")
+
+	drain := func(token string) int {
+		req, err := http.NewRequest(http.MethodPost, "http://"+s.admin+"/drain", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := drain(""); code != http.StatusUnauthorized {
+		t.Fatalf("POST /drain without a token: got status %d, want 401", code)
+	}
+	if code := drain("s3cret"); code != http.StatusAccepted {
+		t.Fatalf("POST /drain with the admin token: got status %d, want 202", code)
+	}
+	alice.expect(t, "Server is restarting, please reconnect.")
+}
@@ -0,0 +1,77 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import (
+	"context"
+	"errors"
+)
+
+// Deduplicator is what Deduplicate needs to recognize copies of an event,
+// such as an *idempotency.Deduplicator from the idempotency module.
+type Deduplicator interface {
+	Do(ctx context.Context, key string, fn func() ([]byte, error)) (result []byte, duplicate bool, err error)
+}
+
+// DispatchWithID is like Dispatch for events that may be published more
+// than once, such as the messages of an outbox relay. Handlers wrapped with
+// Deduplicate see only the first event with a given ID.
+func (eb *EventBus) DispatchWithID(id, eventType string, data interface{}) error {
+	return eb.DispatchEvent(Event{Type: eventType, Data: data, ID: id})
+}
+
+// Deduplicate wraps a handler so that it handles every event ID once: a
+// copy of an event it handled before returns nil without reaching it. If
+// the handler fails, the event is not recorded, and a redelivery is handled
+// again. A handler that stops propagation stops it for the copies as well.
+// Events without an ID are always handled.
+//
+// name scopes the IDs, so several handlers of the same event can share a
+// Deduplicator and still each see the event once.
+func Deduplicate(d Deduplicator, name string, handler EventHandler) EventHandler {
+	return func(event Event) error {
+		if event.ID == "" {
+			return handler(event)
+		}
+		result, _, err := d.Do(event.Context(), name+"/"+event.Type+"/"+event.ID, func() ([]byte, error) {
+			err := handler(event)
+			if errors.Is(err, ErrStopPropagation) {
+				return stopped, nil
+			}
+			return nil, err
+		})
+		if err == nil && string(result) == string(stopped) {
+			return ErrStopPropagation
+		}
+		return err
+	}
+}
+
+// stopped is the result recorded for a handler that stopped propagation.
+var stopped = []byte("stop")
@@ -0,0 +1,424 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/workerpool"
+)
+
+// ErrQueueFull is returned by Dispatch when the event queue is full and the
+// bus is configured with the OverflowError policy.
+var ErrQueueFull = errors.New("eventbus: event queue is full")
+
+// ErrClosed is returned by Dispatch and Request once the bus has been closed.
+var ErrClosed = errors.New("eventbus: bus is closed")
+
+// ErrStopPropagation can be returned by a handler to prevent the handlers
+// after it from seeing the event. Any other error is ignored by the bus and
+// does not stop the chain.
+var ErrStopPropagation = errors.New("eventbus: stop propagation")
+
+// DefaultPriority is the priority of ordinary handlers. Handlers with a
+// higher priority run first; handlers with equal priority run in the order
+// they were registered.
+const DefaultPriority = 0
+
+type Event struct {
+	Type string
+	Data interface{}
+
+	// ID identifies the event to Deduplicate. Publishers that may deliver
+	// an event more than once, such as an outbox relay or a broker, give
+	// every copy the same ID. The bus does not set it.
+	ID string
+
+	// CorrelationID and ReplyTo are set on events published by Request; a
+	// handler answers such an event with EventBus.Reply.
+	CorrelationID string
+	ReplyTo       string
+
+	// Source names the bridge an event arrived through from another process.
+	// It is empty for events published locally.
+	Source string
+
+	// Principal names who published the event with DispatchAs, for the
+	// ACLs of created topics. It is empty for the program itself.
+	Principal string
+
+	// Deadline, if set, is when the event stops being worth delivering. An
+	// event still waiting in the queue at its deadline is shed instead of
+	// being handed to the handlers. DispatchWithTTL and TopicConfig.TTL set
+	// it relative to the time of publishing.
+	Deadline time.Time
+
+	// ctx is the context the event was published with; see Context.
+	ctx context.Context
+}
+
+// Expired reports whether the deadline of e passed before now.
+func (e Event) Expired(now time.Time) bool {
+	return !e.Deadline.IsZero() && now.After(e.Deadline)
+}
+
+type EventHandler func(Event) error
+
+// OverflowPolicy decides what a queued EventBus does with a new event when
+// its queue is already full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the publisher until a worker frees a slot.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest queued event to make room.
+	OverflowDropOldest
+	// OverflowDropNewest discards the event being published.
+	OverflowDropNewest
+	// OverflowError rejects the event being published with ErrQueueFull.
+	OverflowError
+)
+
+// QueueConfig configures the queued dispatch mode of an EventBus.
+type QueueConfig struct {
+	Size     int
+	Workers  int
+	Overflow OverflowPolicy
+	// Order is the order in which workers take events from the queue. With
+	// workerpool.EarliestDeadlineFirst, events with a deadline overtake
+	// those without, and the most urgent go first.
+	Order workerpool.Order
+}
+
+type EventBus struct {
+	mu       sync.RWMutex
+	handlers map[string][]*subscription
+	patterns map[string]bool
+	nextID   SubscriptionID
+
+	pool     *workerpool.Pool
+	overflow OverflowPolicy
+
+	closed    atomic.Bool
+	done      chan struct{}
+	closeOnce sync.Once
+
+	metrics     *metrics
+	slow        atomic.Pointer[slowDetector]
+	tracer      atomic.Pointer[tracerBox]
+	provisioned provisioning
+}
+
+// NewEventBus returns a bus that runs handlers synchronously on the
+// publisher's goroutine.
+func NewEventBus() *EventBus {
+	return &EventBus{
+		handlers: make(map[string][]*subscription),
+		patterns: make(map[string]bool),
+		done:     make(chan struct{}),
+		metrics:  newMetrics(),
+	}
+}
+
+// NewQueuedEventBus returns a bus that puts published events into a bounded
+// queue consumed by a pool of cfg.Workers goroutines. Handlers for different
+// events may run concurrently, so the order of delivery is only preserved
+// with a single worker. A handler that panics is logged and does not stop
+// its worker.
+func NewQueuedEventBus(cfg QueueConfig) *EventBus {
+	eb := NewEventBus()
+	eb.overflow = cfg.Overflow
+	eb.pool = workerpool.New(workerpool.Config{
+		Workers:   cfg.Workers,
+		QueueSize: cfg.Size,
+		Order:     cfg.Order,
+		OnPanic: func(job workerpool.Job, err *workerpool.PanicError) {
+			fmt.Printf("Handler for %s panicked: %v\n%s", job.(delivery).event.Type, err.Value, err.Stack)
+		},
+	})
+	return eb
+}
+
+// Dispatch delivers an event to the handlers registered for eventType. On a
+// synchronous bus the handlers have run by the time Dispatch returns; on a
+// queued bus the event is only enqueued, subject to the overflow policy.
+func (eb *EventBus) Dispatch(eventType string, data interface{}) error {
+	return eb.DispatchEvent(Event{Type: eventType, Data: data})
+}
+
+// DispatchWithDeadline is like Dispatch for events that are useless once
+// deadline has passed, such as typing indicators or price ticks. On a queued
+// bus an event that waited in the queue past its deadline is dropped and
+// counted as expired, which keeps a backlog from delaying fresh events.
+func (eb *EventBus) DispatchWithDeadline(eventType string, data interface{}, deadline time.Time) error {
+	return eb.DispatchEvent(Event{Type: eventType, Data: data, Deadline: deadline})
+}
+
+// DispatchEvent is like Dispatch but publishes a fully populated event, for
+// components such as bridges that need to carry metadata along.
+func (eb *EventBus) DispatchEvent(event Event) error {
+	if eb.closed.Load() {
+		return ErrClosed
+	}
+	if err := eb.admit(&event); err != nil {
+		eb.metrics.rejected(event.Type)
+		return err
+	}
+	eb.metrics.published(event.Type)
+	if event.Expired(time.Now()) {
+		eb.metrics.expired(event.Type, 1)
+		return nil
+	}
+	if eb.pool == nil {
+		eb.deliver(event)
+		return nil
+	}
+	return eb.enqueue(event)
+}
+
+func (eb *EventBus) enqueue(event Event) error {
+	job := delivery{eb, event}
+	switch eb.overflow {
+	case OverflowDropOldest:
+		for {
+			if err := eb.tryGo(job); err != workerpool.ErrFull {
+				return eb.poolError(err)
+			}
+			if dropped, ok := eb.pool.DropOldest(); ok {
+				eb.metrics.dropped(dropped.(delivery).event.Type)
+			}
+		}
+	case OverflowDropNewest:
+		err := eb.tryGo(job)
+		if err == workerpool.ErrFull {
+			eb.metrics.dropped(event.Type)
+			return nil
+		}
+		return eb.poolError(err)
+	case OverflowError:
+		err := eb.tryGo(job)
+		if err == workerpool.ErrFull {
+			eb.metrics.dropped(event.Type)
+			return ErrQueueFull
+		}
+		return eb.poolError(err)
+	default:
+		err := eb.tryGo(job)
+		if err == workerpool.ErrFull {
+			err = eb.pool.Go(context.Background(), job)
+		}
+		return eb.poolError(err)
+	}
+}
+
+// tryGo queues job if there is room. If the queue is full, it purges the
+// expired events from it first, so that they never cost a fresh event its
+// place or keep a publisher waiting.
+func (eb *EventBus) tryGo(job delivery) error {
+	err := eb.pool.TryGo(job)
+	if err == workerpool.ErrFull && eb.purgeQueue(time.Now()) > 0 {
+		err = eb.pool.TryGo(job)
+	}
+	return err
+}
+
+// poolError maps the pool's errors to the bus's own.
+func (eb *EventBus) poolError(err error) error {
+	if err == workerpool.ErrClosed {
+		return ErrClosed
+	}
+	return err
+}
+
+// delivery is the job a queued bus runs on its worker pool for each event.
+type delivery struct {
+	bus   *EventBus
+	event Event
+}
+
+// Deadline orders the event in an earliest-deadline-first queue: by its own
+// deadline or by the one inherited from the event whose handler published
+// it, whichever is earlier.
+func (d delivery) Deadline() time.Time {
+	deadline := d.event.Deadline
+	if inherited, ok := workerpool.InheritedDeadline(d.event.Context()); ok && (deadline.IsZero() || inherited.Before(deadline)) {
+		deadline = inherited
+	}
+	return deadline
+}
+
+// Run delivers the event. Its context passes the event's deadline on, so
+// that events the handlers publish with DispatchContext(event.Context(), ...)
+// are as urgent in the queue as the event that caused them.
+func (d delivery) Run(ctx context.Context) (interface{}, error) {
+	event := d.event
+	if deadline, ok := workerpool.InheritedDeadline(ctx); ok {
+		event = event.WithContext(workerpool.InheritDeadline(event.Context(), deadline))
+	}
+	d.bus.deliver(event)
+	return nil, nil
+}
+
+// QueueDepth returns the number of events waiting in the queue. It is always
+// zero for a synchronous bus.
+func (eb *EventBus) QueueDepth() int {
+	if eb.pool == nil {
+		return 0
+	}
+	return eb.pool.Queued()
+}
+
+// Check reports whether the bus can take events: it fails once the bus is
+// closed, and while the queue of a queued bus is full. It has the signature
+// of a health check, so a readiness probe can use the bus directly.
+func (eb *EventBus) Check(ctx context.Context) error {
+	if eb.closed.Load() {
+		return ErrClosed
+	}
+	if eb.pool != nil {
+		if depth, capacity := eb.pool.Queued(), eb.pool.Capacity(); depth >= capacity {
+			return fmt.Errorf("%w: %d of %d", ErrQueueFull, depth, capacity)
+		}
+	}
+	return nil
+}
+
+// SetWorkers changes the number of workers of a queued bus while it runs.
+// It does nothing on a synchronous bus.
+func (eb *EventBus) SetWorkers(n int) {
+	if eb.pool != nil {
+		eb.pool.Resize(n)
+	}
+}
+
+// Close stops the bus from accepting new events, wakes up publishers blocked
+// on a full queue and callers waiting in Request, and waits for the workers
+// to deliver the events already queued. If ctx expires first, Close returns
+// its error and the workers finish draining in the background. Events
+// published concurrently with Close may be dropped.
+func (eb *EventBus) Close(ctx context.Context) error {
+	eb.closeOnce.Do(func() {
+		eb.closed.Store(true)
+		close(eb.done)
+	})
+
+	if eb.pool == nil {
+		return nil
+	}
+	return eb.pool.Close(ctx)
+}
+
+func (eb *EventBus) deliver(event Event) {
+	now := time.Now()
+	if event.Expired(now) {
+		eb.metrics.expired(event.Type, 1)
+		return
+	}
+
+	// The span ends with the first error a handler returns, other than a
+	// stop of propagation.
+	event, end := eb.startSpan(event)
+	var failure error
+	defer func() { end(failure) }()
+
+	handlers := eb.subscribers(event.Type)
+	for i, sub := range handlers {
+		if sub.principal != "" && !eb.mayReceive(sub.principal, event.Type) {
+			continue
+		}
+		// Slow handlers may run an event past its deadline, which spares
+		// the handlers after them.
+		if i > 0 && !event.Deadline.IsZero() {
+			if now = time.Now(); event.Expired(now) {
+				eb.metrics.expired(event.Type, 1)
+				return
+			}
+		}
+		claimed, last := sub.claim(now)
+		if !claimed {
+			continue
+		}
+		if last {
+			eb.Unregister(sub.topic, sub.id)
+		}
+		slow := eb.slow.Load()
+		var timer *time.Timer
+		if slow != nil {
+			timer = slow.watch(sub)
+		}
+		start := time.Now()
+		err := sub.handler(event)
+		elapsed := time.Since(start)
+		eb.metrics.handled(event.Type, elapsed, err)
+		if slow != nil {
+			slow.observe(sub, elapsed, timer)
+		}
+		if errors.Is(err, ErrStopPropagation) {
+			return
+		}
+		if err != nil && failure == nil {
+			failure = err
+		}
+	}
+}
+
+// subscribers returns the handlers for eventType, including those subscribed
+// through a matching pattern, in the order they should run.
+func (eb *EventBus) subscribers(eventType string) []*subscription {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+
+	handlers := eb.handlers[eventType]
+	merged := false
+	for pattern := range eb.patterns {
+		if !matchTopic(pattern, eventType) {
+			continue
+		}
+		if !merged {
+			handlers = append([]*subscription(nil), handlers...)
+			merged = true
+		}
+		handlers = append(handlers, eb.handlers[pattern]...)
+	}
+	if merged {
+		sort.SliceStable(handlers, func(i, j int) bool {
+			if handlers[i].priority != handlers[j].priority {
+				return handlers[i].priority > handlers[j].priority
+			}
+			return handlers[i].id < handlers[j].id
+		})
+	}
+	return handlers
+}
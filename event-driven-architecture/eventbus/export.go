@@ -0,0 +1,127 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// PublishExpvar exposes the bus statistics under name in the expvar
+// registry, and so on /debug/vars of the default HTTP mux. Like
+// expvar.Publish, it panics if name is already in use.
+func (eb *EventBus) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return eb.Stats()
+	}))
+}
+
+// MetricsHandler serves the bus statistics in the Prometheus text exposition
+// format.
+func (eb *EventBus) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		eb.WritePrometheus(w)
+	})
+}
+
+// WritePrometheus writes the bus statistics in the Prometheus text
+// exposition format.
+func (eb *EventBus) WritePrometheus(w io.Writer) {
+	writePrometheus(w, eb.Stats())
+}
+
+func writePrometheus(w io.Writer, stats Stats) {
+	topics := make([]string, 0, len(stats.Topics))
+	for name := range stats.Topics {
+		topics = append(topics, name)
+	}
+	sort.Strings(topics)
+
+	counters := []struct {
+		name, help string
+		value      func(TopicStats) uint64
+	}{
+		{"eventbus_events_published_total", "Events dispatched on the bus.", func(t TopicStats) uint64 { return t.Published }},
+		{"eventbus_events_dropped_total", "Events dropped because the queue was full.", func(t TopicStats) uint64 { return t.Dropped }},
+		{"eventbus_events_rejected_total", "Events refused by their topic config.", func(t TopicStats) uint64 { return t.Rejected }},
+		{"eventbus_events_expired_total", "Events shed because their deadline passed.", func(t TopicStats) uint64 { return t.Expired }},
+		{"eventbus_handler_calls_total", "Handler invocations that succeeded.", func(t TopicStats) uint64 { return t.Handled }},
+		{"eventbus_handler_errors_total", "Handler invocations that returned an error.", func(t TopicStats) uint64 { return t.Errored }},
+	}
+	for _, c := range counters {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+		for _, topic := range topics {
+			fmt.Fprintf(w, "%s{topic=%q} %d\n", c.name, topic, c.value(stats.Topics[topic]))
+		}
+	}
+
+	const latency = "eventbus_handler_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Handler latency.\n# TYPE %s histogram\n", latency, latency)
+	for _, topic := range topics {
+		h := stats.Topics[topic].Latency
+		var cumulative uint64
+		for i, bound := range LatencyBuckets {
+			if h.Counts != nil {
+				cumulative += h.Counts[i]
+			}
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			fmt.Fprintf(w, "%s_bucket{topic=%q,le=%q} %d\n", latency, topic, le, cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{topic=%q,le=\"+Inf\"} %d\n", latency, topic, h.Count)
+		fmt.Fprintf(w, "%s_sum{topic=%q} %g\n", latency, topic, h.Sum)
+		fmt.Fprintf(w, "%s_count{topic=%q} %d\n", latency, topic, h.Count)
+	}
+
+	fmt.Fprintf(w, "# HELP eventbus_subscriptions Registered handlers.\n# TYPE eventbus_subscriptions gauge\n")
+	subscribed := make([]string, 0, len(stats.Subscriptions))
+	for name := range stats.Subscriptions {
+		subscribed = append(subscribed, name)
+	}
+	sort.Strings(subscribed)
+	for _, topic := range subscribed {
+		fmt.Fprintf(w, "eventbus_subscriptions{topic=%q} %d\n", topic, len(stats.Subscriptions[topic]))
+	}
+
+	fmt.Fprintf(w, "# HELP eventbus_queue_depth Events waiting in the queue.\n# TYPE eventbus_queue_depth gauge\n")
+	fmt.Fprintf(w, "eventbus_queue_depth %d\n", stats.QueueDepth)
+
+	if stats.Workers != nil {
+		fmt.Fprintf(w, "# HELP eventbus_workers Goroutines delivering queued events.\n# TYPE eventbus_workers gauge\n")
+		fmt.Fprintf(w, "eventbus_workers %d\n", stats.Workers.Workers)
+		fmt.Fprintf(w, "# HELP eventbus_workers_busy Workers currently delivering an event.\n# TYPE eventbus_workers_busy gauge\n")
+		fmt.Fprintf(w, "eventbus_workers_busy %d\n", stats.Workers.Busy)
+		fmt.Fprintf(w, "# HELP eventbus_handler_panics_total Deliveries in which a handler panicked.\n# TYPE eventbus_handler_panics_total counter\n")
+		fmt.Fprintf(w, "eventbus_handler_panics_total %d\n", stats.Workers.Panicked)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/golden/golden"
+)
+
+// dashboardStats runs a queued bus through events that touch every counter
+// and returns its stats once it has drained. Handler latencies depend on the
+// machine, so they are replaced with fixed ones.
+func dashboardStats(t *testing.T) Stats {
+	t.Helper()
+	bus, err := New(WithQueue(16, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.CreateTopic("room.news.message", TopicConfig{ACL: ACL{Publishers: []string{"alice"}}}); err != nil {
+		t.Fatal(err)
+	}
+	bus.Register("room.*.message", DefaultPriority, func(e Event) error {
+		if e.Data == "fail" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	bus.RegisterOnce("user-joined", DefaultPriority+10, func(Event) error { return nil })
+
+	bus.Dispatch("room.go.message", "hi")
+	bus.Dispatch("room.go.message", "fail")
+	bus.DispatchAs("alice", "room.news.message", "news")
+	bus.DispatchAs("bob", "room.news.message", "not news")
+	bus.DispatchWithDeadline("room.go.message", "late", time.Now().Add(-time.Second))
+	if err := bus.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := bus.Stats()
+	for name, topic := range stats.Topics {
+		if topic.Latency.Count > 0 {
+			topic.Latency = Histogram{Counts: make([]uint64, len(LatencyBuckets)+1), Count: topic.Latency.Count}
+			topic.Latency.Counts[1] = topic.Latency.Count
+			topic.Latency.Sum = 0.0008 * float64(topic.Latency.Count)
+		}
+		stats.Topics[name] = topic
+	}
+	return stats
+}
+
+// TestDashboardFormats locks down the JSON served on /debug/vars and the
+// Prometheus text served on /metrics, which dashboards and alerts are built
+// on.
+func TestDashboardFormats(t *testing.T) {
+	stats := dashboardStats(t)
+	golden.AssertJSON(t, "stats", stats)
+
+	var buf bytes.Buffer
+	writePrometheus(&buf, stats)
+	golden.Assert(t, "metrics", buf.Bytes())
+}
@@ -0,0 +1,165 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/workerpool"
+)
+
+// latencyBound is the p99 latency that urgent events must stay under while
+// the queue holds a backlog of about half a second of bulk events. With
+// earliest-deadline-first ordering an urgent event only waits for the bulk
+// handlers already running, about 2ms.
+const latencyBound = 25 * time.Millisecond
+
+// urgentLatencies publishes a backlog of bulk events on a bus ordered by
+// order, then urgent events with a deadline while the backlog drains, and
+// returns how long each urgent event waited for its handler.
+func urgentLatencies(t *testing.T, order workerpool.Order) []time.Duration {
+	t.Helper()
+	bus, err := New(WithQueue(1000, 2), WithOrder(order))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close(context.Background())
+
+	bus.Register("bulk", DefaultPriority, func(Event) error {
+		time.Sleep(2 * time.Millisecond)
+		return nil
+	})
+	var mu sync.Mutex
+	var latencies []time.Duration
+	var wg sync.WaitGroup
+	bus.Register("urgent", DefaultPriority, func(e Event) error {
+		mu.Lock()
+		latencies = append(latencies, time.Since(e.Data.(time.Time)))
+		mu.Unlock()
+		wg.Done()
+		return nil
+	})
+
+	for i := 0; i < 500; i++ {
+		bus.Dispatch("bulk", i)
+	}
+	const urgent = 50
+	wg.Add(urgent)
+	for i := 0; i < urgent; i++ {
+		now := time.Now()
+		bus.DispatchWithDeadline("urgent", now, now.Add(time.Second))
+		time.Sleep(2 * time.Millisecond)
+	}
+	wg.Wait()
+	return latencies
+}
+
+func p99(latencies []time.Duration) time.Duration {
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies[len(latencies)*99/100]
+}
+
+func TestUrgentLatencyUnderLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("takes about a second")
+	}
+	edf := p99(urgentLatencies(t, workerpool.EarliestDeadlineFirst))
+	if edf > latencyBound {
+		t.Errorf("p99 latency of urgent events with EDF ordering is %v, want under %v", edf, latencyBound)
+	}
+	// The same load in FIFO order shows that the backlog is real: urgent
+	// events wait for the bulk events queued before them.
+	fifo := p99(urgentLatencies(t, workerpool.FIFO))
+	if fifo < 4*latencyBound {
+		t.Errorf("p99 latency of urgent events with FIFO ordering is only %v; the load is too light to test anything", fifo)
+	}
+	t.Logf("p99 latency of urgent events: %v with EDF, %v with FIFO", edf, fifo)
+}
+
+// TestInheritedUrgency checks that an event published by the handler of
+// an urgent event with the urgent event's context overtakes the backlog,
+// although it has no deadline of its own.
+func TestInheritedUrgency(t *testing.T) {
+	bus, err := New(WithQueue(1000, 1), WithOrder(workerpool.EarliestDeadlineFirst))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close(context.Background())
+
+	bus.Register("bulk", DefaultPriority, func(Event) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	bus.Register("urgent", DefaultPriority, func(e Event) error {
+		return bus.DispatchContext(e.Context(), "follow-up", time.Now())
+	})
+	waited := make(chan time.Duration, 1)
+	bus.Register("follow-up", DefaultPriority, func(e Event) error {
+		waited <- time.Since(e.Data.(time.Time))
+		return nil
+	})
+
+	for i := 0; i < 200; i++ {
+		bus.Dispatch("bulk", i)
+	}
+	bus.DispatchWithTTL("urgent", nil, time.Second)
+	select {
+	case d := <-waited:
+		if d > latencyBound {
+			t.Errorf("follow-up waited %v, want under %v", d, latencyBound)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("follow-up was not delivered")
+	}
+}
+
+func BenchmarkQueuedDispatch(b *testing.B) {
+	for _, bc := range []struct {
+		name  string
+		order workerpool.Order
+	}{
+		{"FIFO", workerpool.FIFO},
+		{"EDF", workerpool.EarliestDeadlineFirst},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			bus, _ := New(WithQueue(1024, 4), WithOrder(bc.order))
+			defer bus.Close(context.Background())
+			bus.Register("tick", DefaultPriority, func(Event) error { return nil })
+			deadline := time.Now().Add(time.Hour)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				bus.DispatchWithDeadline("tick", i, deadline.Add(time.Duration(i%64)*time.Millisecond))
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/leakcheck/leakcheck"
+)
+
+func TestCloseEndsWorkers(t *testing.T) {
+	leakcheck.Check(t)
+	bus, err := New(WithQueue(100, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var handled atomic.Int64
+	bus.Register("tick", DefaultPriority, func(Event) error {
+		handled.Add(1)
+		return nil
+	})
+	for i := 0; i < 50; i++ {
+		bus.Dispatch("tick", i)
+	}
+	bus.SetWorkers(8)
+	bus.SetWorkers(2)
+
+	if err := bus.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := handled.Load(); n != 50 {
+		t.Errorf("%d events handled before Close returned, want 50", n)
+	}
+}
+
+func TestUnregisterRemovesSubscriptions(t *testing.T) {
+	bus := NewEventBus()
+	leakcheck.CheckSubscriptions(t, bus)
+
+	ids := []SubscriptionID{
+		bus.Register("room.*.message", DefaultPriority, func(Event) error { return nil }),
+		bus.Register("room.*.message", DefaultPriority+1, func(Event) error { return nil }),
+		bus.Register("tick", DefaultPriority, func(Event) error { return nil }),
+	}
+	bus.RegisterOnce("tick", DefaultPriority, func(Event) error { return nil })
+	bus.Dispatch("tick", nil)
+
+	bus.Unregister("room.*.message", ids[0])
+	bus.Unregister("room.*.message", ids[1])
+	bus.Unregister("tick", ids[2])
+}
+
+// TestRequestCleansUp checks that a request removes its reply subscription
+// and ends its goroutine whether it is answered, times out or is cut off by
+// Close.
+func TestRequestCleansUp(t *testing.T) {
+	leakcheck.Check(t)
+	bus, err := New(WithQueue(10, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leakcheck.CheckSubscriptions(t, bus)
+	defer bus.Close(context.Background())
+
+	id := bus.Register("echo", DefaultPriority, func(e Event) error {
+		return bus.Reply(e, e.Data)
+	})
+	defer bus.Unregister("echo", id)
+	if got, err := bus.Request(context.Background(), "echo", "hello"); err != nil || got != "hello" {
+		t.Fatalf("Request returned %v, %v", got, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := bus.Request(ctx, "nobody-answers", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unanswered Request returned %v", err)
+	}
+
+	pending := bus.RequestAsync(context.Background(), "nobody-answers", nil)
+	bus.Close(context.Background())
+	if _, err := pending.Get(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Request pending at Close returned %v", err)
+	}
+}
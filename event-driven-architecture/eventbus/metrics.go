@@ -0,0 +1,219 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/workerpool"
+)
+
+// LatencyBuckets are the upper bounds, in seconds, of the handler latency
+// histogram buckets.
+var LatencyBuckets = []float64{0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// TopicStats are the counters the bus keeps for one event type.
+type TopicStats struct {
+	// Published counts events dispatched, including ones later dropped.
+	Published uint64 `json:"published"`
+	// Dropped counts events discarded or rejected because the queue was full.
+	Dropped uint64 `json:"dropped"`
+	// Rejected counts events refused by the config of their topic, or
+	// because the topic was not created in default-deny mode.
+	Rejected uint64 `json:"rejected"`
+	// Expired counts events shed because their deadline passed before they
+	// were delivered, and retained events dropped at their deadline.
+	Expired uint64 `json:"expired"`
+	// Handled counts handler invocations that returned nil or
+	// ErrStopPropagation; Errored counts the ones that returned another error.
+	Handled uint64    `json:"handled"`
+	Errored uint64    `json:"errored"`
+	Latency Histogram `json:"latency"`
+}
+
+// Histogram counts handler latencies into LatencyBuckets. Counts[i] is the
+// number of observations in bucket i; the final extra entry counts
+// observations above the largest bound.
+type Histogram struct {
+	Counts []uint64 `json:"counts"`
+	Sum    float64  `json:"sum"`
+	Count  uint64   `json:"count"`
+}
+
+func (h *Histogram) observe(seconds float64) {
+	if h.Counts == nil {
+		h.Counts = make([]uint64, len(LatencyBuckets)+1)
+	}
+	i := sort.SearchFloat64s(LatencyBuckets, seconds)
+	h.Counts[i]++
+	h.Sum += seconds
+	h.Count++
+}
+
+// SubscriptionInfo describes a registered handler.
+type SubscriptionInfo struct {
+	ID        SubscriptionID `json:"id"`
+	Priority  int            `json:"priority"`
+	Expires   time.Time      `json:"expires,omitempty"`
+	Remaining int64          `json:"remaining,omitempty"`
+}
+
+// Stats is a point-in-time snapshot of what the bus is doing.
+type Stats struct {
+	Topics        map[string]TopicStats         `json:"topics"`
+	Subscriptions map[string][]SubscriptionInfo `json:"subscriptions"`
+	QueueDepth    int                           `json:"queue_depth"`
+	QueueCapacity int                           `json:"queue_capacity"`
+	// Workers describes the worker pool of a queued bus.
+	Workers *workerpool.Stats `json:"workers,omitempty"`
+}
+
+type metrics struct {
+	mu     sync.Mutex
+	topics map[string]*TopicStats
+}
+
+func newMetrics() *metrics {
+	return &metrics{topics: make(map[string]*TopicStats)}
+}
+
+// topic returns the counters for eventType, or nil for the private reply
+// topics, which are unique per request and would otherwise grow without
+// bound. The caller must hold m.mu.
+func (m *metrics) topic(eventType string) *TopicStats {
+	if strings.HasPrefix(eventType, replyTopicPrefix) {
+		return nil
+	}
+	t, ok := m.topics[eventType]
+	if !ok {
+		t = &TopicStats{}
+		m.topics[eventType] = t
+	}
+	return t
+}
+
+func (m *metrics) published(eventType string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t := m.topic(eventType); t != nil {
+		t.Published++
+	}
+}
+
+func (m *metrics) dropped(eventType string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t := m.topic(eventType); t != nil {
+		t.Dropped++
+	}
+}
+
+func (m *metrics) rejected(eventType string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t := m.topic(eventType); t != nil {
+		t.Rejected++
+	}
+}
+
+func (m *metrics) expired(eventType string, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if t := m.topic(eventType); t != nil {
+		t.Expired += uint64(n)
+	}
+}
+
+func (m *metrics) handled(eventType string, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.topic(eventType)
+	if t == nil {
+		return
+	}
+	if err == nil || errors.Is(err, ErrStopPropagation) {
+		t.Handled++
+	} else {
+		t.Errored++
+	}
+	t.Latency.observe(latency.Seconds())
+}
+
+// Stats returns a snapshot of the per-topic counters, the current
+// subscriptions and the queue depth.
+func (eb *EventBus) Stats() Stats {
+	stats := Stats{
+		Topics:        make(map[string]TopicStats),
+		Subscriptions: eb.Subscriptions(),
+		QueueDepth:    eb.QueueDepth(),
+	}
+	if eb.pool != nil {
+		stats.QueueCapacity = eb.pool.Capacity()
+		pool := eb.pool.Stats()
+		stats.Workers = &pool
+	}
+
+	eb.metrics.mu.Lock()
+	defer eb.metrics.mu.Unlock()
+	for name, t := range eb.metrics.topics {
+		snapshot := *t
+		snapshot.Latency.Counts = append([]uint64(nil), t.Latency.Counts...)
+		stats.Topics[name] = snapshot
+	}
+	return stats
+}
+
+// Subscriptions lists the registered handlers per event type, in the order
+// they run.
+func (eb *EventBus) Subscriptions() map[string][]SubscriptionInfo {
+	eb.mu.RLock()
+	defer eb.mu.RUnlock()
+
+	subs := make(map[string][]SubscriptionInfo, len(eb.handlers))
+	for eventType, handlers := range eb.handlers {
+		infos := make([]SubscriptionInfo, len(handlers))
+		for i, sub := range handlers {
+			infos[i] = SubscriptionInfo{ID: sub.id, Priority: sub.priority, Expires: sub.expires}
+			if sub.limited {
+				infos[i].Remaining = sub.remaining.Load()
+			}
+		}
+		subs[eventType] = infos
+	}
+	return subs
+}
@@ -0,0 +1,125 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/workerpool"
+)
+
+// Option configures an EventBus created with New.
+type Option func(*options)
+
+type options struct {
+	queued      bool
+	size        int
+	workers     int
+	overflow    OverflowPolicy
+	overflowSet bool
+	order       workerpool.Order
+	orderSet    bool
+	defaultDeny bool
+}
+
+// WithQueue makes the bus queued: published events wait in a queue of size
+// events for one of workers goroutines to deliver them. See
+// NewQueuedEventBus.
+func WithQueue(size, workers int) Option {
+	return func(o *options) {
+		o.queued, o.size, o.workers = true, size, workers
+	}
+}
+
+// WithOverflow sets what a queued bus does when its queue is full
+// (OverflowBlock by default). It needs WithQueue.
+func WithOverflow(policy OverflowPolicy) Option {
+	return func(o *options) {
+		o.overflow, o.overflowSet = policy, true
+	}
+}
+
+// WithOrder sets the order in which a queued bus delivers the events
+// waiting in its queue (workerpool.FIFO by default). It needs WithQueue.
+func WithOrder(order workerpool.Order) Option {
+	return func(o *options) {
+		o.order, o.orderSet = order, true
+	}
+}
+
+// WithDefaultDeny rejects events for topics that were not created with
+// CreateTopic. See SetDefaultDeny.
+func WithDefaultDeny() Option {
+	return func(o *options) {
+		o.defaultDeny = true
+	}
+}
+
+// New returns a bus configured by opts. Without options it is the
+// synchronous bus of NewEventBus. Options that make no sense together,
+// such as an overflow policy for a bus without a queue, are rejected.
+func New(opts ...Option) (*EventBus, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var errs []error
+	if o.queued && o.size < 1 {
+		errs = append(errs, fmt.Errorf("eventbus: queue size must be at least 1, not %d", o.size))
+	}
+	if o.queued && o.workers < 1 {
+		errs = append(errs, fmt.Errorf("eventbus: workers must be at least 1, not %d", o.workers))
+	}
+	if o.overflowSet && !o.queued {
+		errs = append(errs, errors.New("eventbus: WithOverflow needs WithQueue, a synchronous bus never queues"))
+	}
+	if o.orderSet && !o.queued {
+		errs = append(errs, errors.New("eventbus: WithOrder needs WithQueue, a synchronous bus never queues"))
+	}
+	if o.order < workerpool.FIFO || o.order > workerpool.EarliestDeadlineFirst {
+		errs = append(errs, fmt.Errorf("eventbus: unknown queue order %d", o.order))
+	}
+	if o.overflow < OverflowBlock || o.overflow > OverflowError {
+		errs = append(errs, fmt.Errorf("eventbus: unknown overflow policy %d", o.overflow))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	var eb *EventBus
+	if o.queued {
+		eb = NewQueuedEventBus(QueueConfig{Size: o.size, Workers: o.workers, Overflow: o.overflow, Order: o.order})
+	} else {
+		eb = NewEventBus()
+	}
+	eb.SetDefaultDeny(o.defaultDeny)
+	return eb, nil
+}
@@ -0,0 +1,271 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Mask replaces the value of string fields tagged `redact:"mask"`.
+const Mask = "[REDACTED]"
+
+// wiretapPriority runs wiretaps before any other handler, so a handler that
+// stops propagation does not hide events from them.
+const wiretapPriority = 1 << 30
+
+// Sensitive fields of event data are marked with a struct tag:
+//
+//	type Signup struct {
+//		Nick     string
+//		Email    string `redact:"mask"`
+//		Password string `redact:"omit"`
+//	}
+//
+// Redact masks string fields tagged "mask" and clears fields tagged "omit",
+// as well as non-string fields tagged "mask".
+
+// RedactionPolicy decides which sinks, such as logs, wiretaps or persistent
+// stores, may see the sensitive fields of which events. Every sink sees
+// redacted data unless the policy allows it the topic.
+type RedactionPolicy struct {
+	mu    sync.RWMutex
+	allow map[string]map[string]bool // topic or pattern -> sinks
+}
+
+func NewRedactionPolicy() *RedactionPolicy {
+	return &RedactionPolicy{allow: make(map[string]map[string]bool)}
+}
+
+// Allow lets sinks see the unredacted data of the events matching topic,
+// which may be a pattern such as "room.*.message".
+func (p *RedactionPolicy) Allow(topic string, sinks ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.allow[topic] == nil {
+		p.allow[topic] = make(map[string]bool)
+	}
+	for _, sink := range sinks {
+		p.allow[topic][sink] = true
+	}
+}
+
+// Allowed reports whether sink may see the unredacted data of eventType. A
+// nil policy allows nothing.
+func (p *RedactionPolicy) Allowed(sink, eventType string) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for topic, sinks := range p.allow {
+		if sinks[sink] && (topic == eventType || isPattern(topic) && matchTopic(topic, eventType)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns the event as sink may see it.
+func (p *RedactionPolicy) Apply(sink string, event Event) Event {
+	if !p.Allowed(sink, event.Type) {
+		event.Data = Redact(event.Data)
+	}
+	return event
+}
+
+// Wiretap passes a copy of every event to handler, redacted by policy for
+// sink. Errors returned by handler are ignored, so a failing wiretap cannot
+// affect delivery to the other handlers.
+func (eb *EventBus) Wiretap(sink string, policy *RedactionPolicy, handler EventHandler) SubscriptionID {
+	return eb.Register("#", wiretapPriority, func(event Event) error {
+		handler(policy.Apply(sink, event))
+		return nil
+	})
+}
+
+// Redact returns a copy of v with its sensitive fields masked or cleared.
+// Only the values on the way to a tagged field are copied; everything else,
+// including v itself if nothing in it is tagged, is shared with v.
+func Redact(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	out, _ := redactValue(reflect.ValueOf(v), make(map[uintptr]bool))
+	return out.Interface()
+}
+
+// redactValue returns the redacted value and whether it differs from v.
+// Pointers already seen are not followed again, so cyclic data terminates.
+func redactValue(v reflect.Value, seen map[uintptr]bool) (reflect.Value, bool) {
+	if !sensitive(v.Type()) {
+		return v, false
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || seen[v.Pointer()] {
+			return v, false
+		}
+		seen[v.Pointer()] = true
+		elem, changed := redactValue(v.Elem(), seen)
+		if !changed {
+			return v, false
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(elem)
+		return out, true
+	case reflect.Interface:
+		if v.IsNil() {
+			return v, false
+		}
+		elem, changed := redactValue(v.Elem(), seen)
+		if !changed {
+			return v, false
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(elem)
+		return out, true
+	case reflect.Slice, reflect.Array:
+		var out reflect.Value
+		for i := 0; i < v.Len(); i++ {
+			elem, changed := redactValue(v.Index(i), seen)
+			if !changed {
+				continue
+			}
+			if !out.IsValid() {
+				out = reflect.New(v.Type()).Elem()
+				if v.Kind() == reflect.Slice {
+					out.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+				}
+				reflect.Copy(out, v)
+			}
+			out.Index(i).Set(elem)
+		}
+		if !out.IsValid() {
+			return v, false
+		}
+		return out, true
+	case reflect.Map:
+		var out reflect.Value
+		iter := v.MapRange()
+		for iter.Next() {
+			elem, changed := redactValue(iter.Value(), seen)
+			if !changed {
+				continue
+			}
+			if !out.IsValid() {
+				out = reflect.MakeMapWithSize(v.Type(), v.Len())
+				all := v.MapRange()
+				for all.Next() {
+					out.SetMapIndex(all.Key(), all.Value())
+				}
+			}
+			out.SetMapIndex(iter.Key(), elem)
+		}
+		if !out.IsValid() {
+			return v, false
+		}
+		return out, true
+	case reflect.Struct:
+		var out reflect.Value
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			var elem reflect.Value
+			switch field.Tag.Get("redact") {
+			case "mask":
+				elem = reflect.Zero(field.Type)
+				if field.Type.Kind() == reflect.String {
+					elem = reflect.ValueOf(Mask).Convert(field.Type)
+				}
+			case "omit":
+				elem = reflect.Zero(field.Type)
+			default:
+				var changed bool
+				if elem, changed = redactValue(v.Field(i), seen); !changed {
+					continue
+				}
+			}
+			if !out.IsValid() {
+				out = reflect.New(v.Type()).Elem()
+				out.Set(v)
+			}
+			out.Field(i).Set(elem)
+		}
+		if !out.IsValid() {
+			return v, false
+		}
+		return out, true
+	}
+	return v, false
+}
+
+var sensitiveTypes sync.Map // reflect.Type -> bool
+
+// sensitive reports whether values of type t may hold a tagged field.
+// Interfaces always may; their dynamic type is checked when the value is
+// redacted.
+func sensitive(t reflect.Type) bool {
+	if s, ok := sensitiveTypes.Load(t); ok {
+		return s.(bool)
+	}
+	s := sensitiveType(t, make(map[reflect.Type]bool))
+	sensitiveTypes.Store(t, s)
+	return s
+}
+
+func sensitiveType(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return sensitiveType(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if field.Tag.Get("redact") != "" || sensitiveType(field.Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"github.com/rajamummidi/go-design-patterns/future/future"
+)
+
+// ErrNotARequest is returned by Reply when the event was not published by
+// Request and so has nowhere to send the reply.
+var ErrNotARequest = errors.New("eventbus: event has no reply address")
+
+// replyTopicPrefix starts the private topic each request listens on for its
+// reply.
+const replyTopicPrefix = "reply."
+
+// replyPriority puts the reply waiter ahead of any other handler that happens
+// to watch reply topics.
+const replyPriority = 1 << 20
+
+// Request publishes data as an eventType event and blocks until a handler
+// answers it with Reply or ctx is done. If the reply payload is an error, it
+// is returned as the error of the call. The event carries ctx, like one
+// published with DispatchContext.
+func (eb *EventBus) Request(ctx context.Context, eventType string, data interface{}) (interface{}, error) {
+	return eb.RequestAsync(ctx, eventType, data).Get()
+}
+
+// RequestAsync is like Request but returns at once with a future of the
+// reply, so that a caller can send several requests and wait for them
+// together, or chain work onto a reply. The future fails with ctx's error
+// if ctx is done before the reply arrives, and with ErrClosed if the bus
+// closes.
+func (eb *EventBus) RequestAsync(ctx context.Context, eventType string, data interface{}) *future.Future[interface{}] {
+	correlationID, err := newCorrelationID()
+	if err != nil {
+		return future.Rejected[interface{}](err)
+	}
+	replyTo := replyTopicPrefix + correlationID
+
+	reply := future.NewPromise[interface{}]()
+	id := eb.RegisterOnce(replyTo, replyPriority, func(event Event) error {
+		if err, ok := event.Data.(error); ok {
+			reply.Reject(err)
+		} else {
+			reply.Resolve(event.Data)
+		}
+		return nil
+	})
+
+	err = eb.DispatchEvent(Event{
+		Type:          eventType,
+		Data:          data,
+		CorrelationID: correlationID,
+		ReplyTo:       replyTo,
+	}.WithContext(ctx))
+	if err != nil {
+		eb.Unregister(replyTo, id)
+		return future.Rejected[interface{}](err)
+	}
+
+	go func() {
+		defer eb.Unregister(replyTo, id)
+		select {
+		case <-reply.Future().Done():
+		case <-ctx.Done():
+			reply.Reject(ctx.Err())
+		case <-eb.done:
+			reply.Reject(ErrClosed)
+		}
+	}()
+	return reply.Future()
+}
+
+// Reply answers a request event. Only the first reply to a request reaches
+// the caller of Request; later ones find no subscriber and are dropped.
+func (eb *EventBus) Reply(request Event, data interface{}) error {
+	if request.ReplyTo == "" {
+		return ErrNotARequest
+	}
+	return eb.DispatchEvent(Event{
+		Type:          request.ReplyTo,
+		Data:          data,
+		CorrelationID: request.CorrelationID,
+	}.WithContext(request.ctx))
+}
+
+func newCorrelationID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,142 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import (
+	"encoding/json"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/membudget"
+)
+
+// DefaultMaxRetained is the number of events a topic retains at most when
+// its config does not set MaxRetained.
+const DefaultMaxRetained = 1000
+
+// retainedEventOverhead approximates the memory of a retained event
+// besides its type, ID and data.
+const retainedEventOverhead = 128
+
+// retainedSize estimates the memory a retained event takes up. Data that is
+// not a string or bytes is measured by its JSON encoding.
+func retainedSize(event Event) int64 {
+	size := retainedEventOverhead + len(event.Type) + len(event.ID)
+	switch data := event.Data.(type) {
+	case nil:
+	case string:
+		size += len(data)
+	case []byte:
+		size += len(data)
+	case json.RawMessage:
+		size += len(data)
+	default:
+		if b, err := json.Marshal(data); err == nil {
+			size += len(b)
+		}
+	}
+	return int64(size)
+}
+
+// maxRetained returns the number of events t retains at most.
+func (t *topic) maxRetained() int {
+	if t.config.MaxRetained > 0 {
+		return t.config.MaxRetained
+	}
+	return DefaultMaxRetained
+}
+
+// trim drops the oldest retained events of t beyond its maximum. The
+// caller must hold eb.provisioned.mu.
+func (eb *EventBus) trim(t *topic) {
+	excess := len(t.retained) - t.maxRetained()
+	if excess <= 0 {
+		return
+	}
+	for _, r := range t.retained[:excess] {
+		eb.provisioned.pending -= r.size
+	}
+	n := copy(t.retained, t.retained[excess:])
+	clear(t.retained[n:])
+	t.retained = t.retained[:n]
+}
+
+// UseBudget accounts the retained events of all topics against budget.
+// When the budget runs out, the oldest retained events across topics are
+// evicted first.
+func (eb *EventBus) UseBudget(budget *membudget.Budget, weight float64) {
+	memory := budget.Register("retained-events", weight, eb.evictRetained)
+
+	eb.provisioned.mu.Lock()
+	eb.provisioned.memory = memory
+	eb.provisioned.mu.Unlock()
+	eb.settleRetained()
+}
+
+// settleRetained tells the budget about the memory retained or freed since
+// the last call. It must be called without eb.provisioned.mu held, because
+// reserving memory may call back into evictRetained.
+func (eb *EventBus) settleRetained() {
+	eb.provisioned.mu.Lock()
+	memory, pending := eb.provisioned.memory, eb.provisioned.pending
+	if memory != nil {
+		eb.provisioned.pending = 0
+	}
+	eb.provisioned.mu.Unlock()
+
+	switch {
+	case memory == nil:
+	case pending > 0:
+		memory.Reserve(pending)
+	case pending < 0:
+		memory.Release(-pending)
+	}
+}
+
+// evictRetained drops the oldest retained events across all topics until
+// need bytes are freed or no events are retained.
+func (eb *EventBus) evictRetained(need int64) int64 {
+	eb.provisioned.mu.Lock()
+	defer eb.provisioned.mu.Unlock()
+
+	var freed int64
+	for freed < need {
+		var oldest *topic
+		for _, t := range eb.provisioned.topics {
+			if len(t.retained) > 0 && (oldest == nil || t.retained[0].at.Before(oldest.retained[0].at)) {
+				oldest = t
+			}
+		}
+		if oldest == nil {
+			break
+		}
+		freed += oldest.retained[0].size
+		oldest.retained[0] = retainedEvent{}
+		oldest.retained = oldest.retained[1:]
+	}
+	return freed
+}
@@ -0,0 +1,102 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/membudget"
+)
+
+func TestMaxRetained(t *testing.T) {
+	bus, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.CreateTopic("news", TopicConfig{Retention: time.Hour, MaxRetained: 3}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		bus.Dispatch("news", fmt.Sprint(i))
+	}
+
+	var got []interface{}
+	for _, e := range bus.Retained("news") {
+		got = append(got, e.Data)
+	}
+	if fmt.Sprint(got) != "[2 3 4]" {
+		t.Errorf("retained %v, want [2 3 4]", got)
+	}
+
+	if err := bus.UpdateTopic("news", TopicConfig{Retention: time.Hour, MaxRetained: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(bus.Retained("news")); n != 1 {
+		t.Errorf("%d events retained after lowering the maximum, want 1", n)
+	}
+	if err := bus.UpdateTopic("news", TopicConfig{MaxRetained: -1}); err == nil {
+		t.Error("negative MaxRetained was accepted")
+	}
+}
+
+func TestRetainedBudget(t *testing.T) {
+	bus, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if err := bus.CreateTopic(name, TopicConfig{Retention: time.Hour}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size := retainedSize(Event{Type: "a", Data: "x"})
+	budget := membudget.New(3 * size)
+	bus.UseBudget(budget, 1)
+
+	bus.Dispatch("a", "x")
+	bus.Dispatch("b", "x")
+	bus.Dispatch("a", "y")
+	bus.Dispatch("b", "y")
+
+	if got := budget.Usage()["retained-events"]; got != 3*size {
+		t.Errorf("retained events use %d bytes, want %d", got, 3*size)
+	}
+	if a, b := bus.Retained("a"), bus.Retained("b"); len(a) != 1 || a[0].Data != "y" || len(b) != 2 {
+		t.Errorf("retained a=%v b=%v, want the oldest event of a evicted", a, b)
+	}
+
+	if err := bus.DeleteTopic("b"); err != nil {
+		t.Fatal(err)
+	}
+	if got := budget.Usage()["retained-events"]; got != size {
+		t.Errorf("retained events use %d bytes after deleting a topic, want %d", got, size)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import (
+	"sync"
+	"time"
+)
+
+// Sample wraps a handler for high-volume events, such as a logging wiretap,
+// so that it does not see all of them. For every event type, the first burst
+// events of each second are passed on and after that only one in every n.
+// Events that are sampled out return nil.
+func Sample(handler EventHandler, n, burst int) EventHandler {
+	type window struct {
+		start time.Time
+		seen  int
+	}
+	var mu sync.Mutex
+	windows := make(map[string]*window)
+
+	return func(event Event) error {
+		now := time.Now()
+		mu.Lock()
+		w, ok := windows[event.Type]
+		if !ok || now.Sub(w.start) >= time.Second {
+			w = &window{start: now}
+			windows[event.Type] = w
+		}
+		w.seen++
+		keep := w.seen <= burst || n > 0 && (w.seen-burst)%n == 0
+		mu.Unlock()
+
+		if !keep {
+			return nil
+		}
+		return handler(event)
+	}
+}
@@ -0,0 +1,221 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SlowHandlerTopic is the default event type of slow-handler reports.
+const SlowHandlerTopic = "slow-handlers"
+
+// SlowHandlerConfig configures DetectSlowHandlers.
+type SlowHandlerConfig struct {
+	// Budget is how long a handler may run before it counts as slow.
+	Budget time.Duration
+	// Period is how often a report is published (1 minute by default).
+	Period time.Duration
+	// Topic is the event type of the reports (SlowHandlerTopic by default).
+	Topic string
+}
+
+// SlowHandler summarizes the slow runs of one subscription during a report
+// period.
+type SlowHandler struct {
+	Topic        string         `json:"topic"`
+	Subscription SubscriptionID `json:"subscription"`
+	Handler      string         `json:"handler"`
+	Calls        int            `json:"calls"`
+	Slow         int            `json:"slow"`
+	Max          time.Duration  `json:"max"`
+	Total        time.Duration  `json:"total"`
+	// Stack is the stack of the handler's goroutine, sampled when one of its
+	// runs went over budget.
+	Stack string `json:"stack,omitempty"`
+}
+
+// SlowReport is the data of a slow-handler report event. Handlers are
+// listed slowest first.
+type SlowReport struct {
+	Budget   time.Duration `json:"budget"`
+	Period   time.Duration `json:"period"`
+	Handlers []SlowHandler `json:"handlers"`
+}
+
+// String summarizes the report in a few lines, suitable for a log.
+func (r SlowReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d handlers exceeded %s in the last %s", len(r.Handlers), r.Budget, r.Period)
+	for _, h := range r.Handlers {
+		fmt.Fprintf(&b, "\n  %s on %s: %d of %d calls slow, max %s", h.Handler, h.Topic, h.Slow, h.Calls, h.Max)
+		if h.Stack != "" {
+			fmt.Fprintf(&b, "\n    %s", strings.ReplaceAll(strings.TrimSpace(h.Stack), "\n", "\n    "))
+		}
+	}
+	return b.String()
+}
+
+// DetectSlowHandlers times every handler run against cfg.Budget. Once per
+// cfg.Period, if any handler went over budget, it publishes a SlowReport on
+// cfg.Topic. The returned function stops the detection; closing the bus
+// stops it too.
+func (eb *EventBus) DetectSlowHandlers(cfg SlowHandlerConfig) (stop func()) {
+	if cfg.Period <= 0 {
+		cfg.Period = time.Minute
+	}
+	if cfg.Topic == "" {
+		cfg.Topic = SlowHandlerTopic
+	}
+
+	d := &slowDetector{budget: cfg.Budget, handlers: make(map[SubscriptionID]*SlowHandler)}
+	eb.slow.Store(d)
+
+	quit := make(chan struct{})
+	var once sync.Once
+	go func() {
+		ticker := time.NewTicker(cfg.Period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if handlers := d.collect(); len(handlers) > 0 {
+					eb.Dispatch(cfg.Topic, SlowReport{Budget: cfg.Budget, Period: cfg.Period, Handlers: handlers})
+				}
+			case <-quit:
+				return
+			case <-eb.done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		once.Do(func() {
+			eb.slow.CompareAndSwap(d, nil)
+			close(quit)
+		})
+	}
+}
+
+type slowDetector struct {
+	budget time.Duration
+
+	mu       sync.Mutex
+	handlers map[SubscriptionID]*SlowHandler
+}
+
+// watch starts timing a handler run. If the run is still going when the
+// budget is spent, the stack of its goroutine is sampled.
+func (d *slowDetector) watch(sub *subscription) *time.Timer {
+	return time.AfterFunc(d.budget, func() {
+		stack := sampleStack(handlerName(sub.handler))
+		if stack == "" {
+			return
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.stats(sub).Stack = stack
+	})
+}
+
+// observe records a finished handler run.
+func (d *slowDetector) observe(sub *subscription, elapsed time.Duration, timer *time.Timer) {
+	timer.Stop()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	h := d.stats(sub)
+	h.Calls++
+	h.Total += elapsed
+	if elapsed > h.Max {
+		h.Max = elapsed
+	}
+	if elapsed > d.budget {
+		h.Slow++
+	}
+}
+
+// stats returns the counters of sub. The caller must hold d.mu.
+func (d *slowDetector) stats(sub *subscription) *SlowHandler {
+	h, ok := d.handlers[sub.id]
+	if !ok {
+		h = &SlowHandler{Topic: sub.topic, Subscription: sub.id, Handler: handlerName(sub.handler)}
+		d.handlers[sub.id] = h
+	}
+	return h
+}
+
+// collect returns the handlers that were slow since the last call and
+// starts a new period.
+func (d *slowDetector) collect() []SlowHandler {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var slow []SlowHandler
+	for _, h := range d.handlers {
+		if h.Slow > 0 {
+			slow = append(slow, *h)
+		}
+	}
+	d.handlers = make(map[SubscriptionID]*SlowHandler)
+
+	sort.Slice(slow, func(i, j int) bool { return slow[i].Max > slow[j].Max })
+	return slow
+}
+
+// handlerName returns the name of the function behind handler, without the
+// -fm suffix of method values.
+func handlerName(handler EventHandler) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(handler).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	return strings.TrimSuffix(fn.Name(), "-fm")
+}
+
+// sampleStack returns the stack of the first goroutine that is running the
+// function called name, or "" if none is.
+func sampleStack(name string) string {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.Contains(stack, []byte(name+"(")) {
+			return string(stack)
+		}
+	}
+	return ""
+}
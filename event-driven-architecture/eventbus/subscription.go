@@ -0,0 +1,159 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SubscriptionID identifies a registered handler so it can be removed again
+// with Unregister.
+type SubscriptionID uint64
+
+// Expiry limits how long a subscription stays registered. A zero TTL or
+// MaxDeliveries means no limit on that dimension; whichever limit is reached
+// first removes the subscription.
+type Expiry struct {
+	TTL           time.Duration
+	MaxDeliveries int
+}
+
+type subscription struct {
+	id       SubscriptionID
+	topic    string
+	priority int
+	handler  EventHandler
+	// principal registered the subscription with RegisterAs; it is empty
+	// for the program's own subscriptions.
+	principal string
+
+	expires   time.Time
+	limited   bool
+	remaining atomic.Int64
+}
+
+// claim reserves one delivery for the subscription. It reports whether the
+// handler may run and whether this was its last allowed delivery. Claims are
+// atomic, so a once-only handler runs once even with several workers.
+func (s *subscription) claim(now time.Time) (ok, last bool) {
+	if !s.expires.IsZero() && !now.Before(s.expires) {
+		return false, false
+	}
+	if !s.limited {
+		return true, false
+	}
+	for {
+		n := s.remaining.Load()
+		if n <= 0 {
+			return false, false
+		}
+		if s.remaining.CompareAndSwap(n, n-1) {
+			return true, n == 1
+		}
+	}
+}
+
+// Register subscribes handler to eventType, which may be a pattern such as
+// "room.*.message". Handlers run in descending order of priority, so auth
+// or validation handlers can be registered with a high priority and stop
+// the event before it reaches the rest.
+func (eb *EventBus) Register(eventType string, priority int, handler EventHandler) SubscriptionID {
+	return eb.RegisterWithExpiry(eventType, priority, handler, Expiry{})
+}
+
+// RegisterOnce subscribes handler to the next eventType event only. This is
+// the building block for request/response correlation over the bus.
+func (eb *EventBus) RegisterOnce(eventType string, priority int, handler EventHandler) SubscriptionID {
+	return eb.RegisterWithExpiry(eventType, priority, handler, Expiry{MaxDeliveries: 1})
+}
+
+// RegisterWithExpiry subscribes handler to eventType until the subscription
+// expires, either after expiry.TTL or after expiry.MaxDeliveries events.
+func (eb *EventBus) RegisterWithExpiry(eventType string, priority int, handler EventHandler, expiry Expiry) SubscriptionID {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	return eb.register(eventType, priority, handler, expiry, "")
+}
+
+// register adds a subscription. eb.mu must be held.
+func (eb *EventBus) register(eventType string, priority int, handler EventHandler, expiry Expiry, principal string) SubscriptionID {
+	eb.nextID++
+	sub := &subscription{id: eb.nextID, topic: eventType, priority: priority, handler: handler, principal: principal}
+	if expiry.TTL > 0 {
+		sub.expires = time.Now().Add(expiry.TTL)
+		time.AfterFunc(expiry.TTL, func() { eb.Unregister(eventType, sub.id) })
+	}
+	if expiry.MaxDeliveries > 0 {
+		sub.limited = true
+		sub.remaining.Store(int64(expiry.MaxDeliveries))
+	}
+
+	// Copy on write: workers may be iterating over the old slice.
+	old := eb.handlers[eventType]
+	i := 0
+	for i < len(old) && old[i].priority >= priority {
+		i++
+	}
+	handlers := make([]*subscription, 0, len(old)+1)
+	handlers = append(handlers, old[:i]...)
+	handlers = append(handlers, sub)
+	handlers = append(handlers, old[i:]...)
+	eb.handlers[eventType] = handlers
+	if isPattern(eventType) {
+		eb.patterns[eventType] = true
+	}
+	return sub.id
+}
+
+// Unregister removes a subscription. It reports false if the subscription was
+// already gone, for example because it expired.
+func (eb *EventBus) Unregister(eventType string, id SubscriptionID) bool {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	old := eb.handlers[eventType]
+	for i, sub := range old {
+		if sub.id != id {
+			continue
+		}
+		handlers := make([]*subscription, 0, len(old)-1)
+		handlers = append(handlers, old[:i]...)
+		handlers = append(handlers, old[i+1:]...)
+		if len(handlers) == 0 {
+			delete(eb.handlers, eventType)
+			delete(eb.patterns, eventType)
+		} else {
+			eb.handlers[eventType] = handlers
+		}
+		return true
+	}
+	return false
+}
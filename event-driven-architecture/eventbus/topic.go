@@ -0,0 +1,58 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import "strings"
+
+// Event types are dot-separated hierarchies such as "room.lobby.message".
+// Handlers can subscribe to a pattern instead of a single type: "*" matches
+// exactly one segment and a trailing "#" matches one or more segments, so
+// "room.*.message" sees the messages of every room and "room.#" sees every
+// room event.
+
+func isPattern(topic string) bool {
+	return strings.ContainsAny(topic, "*#")
+}
+
+func matchTopic(pattern, topic string) bool {
+	patternParts := strings.Split(pattern, ".")
+	topicParts := strings.Split(topic, ".")
+	for i, part := range patternParts {
+		if part == "#" && i == len(patternParts)-1 {
+			return len(topicParts) > i
+		}
+		if i >= len(topicParts) {
+			return false
+		}
+		if part != "*" && part != topicParts[i] {
+			return false
+		}
+	}
+	return len(topicParts) == len(patternParts)
+}
@@ -0,0 +1,494 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/membudget"
+)
+
+var (
+	// ErrUnknownTopic is returned for topics that were not created, by
+	// UpdateTopic and DeleteTopic and, in default-deny mode, by Dispatch.
+	ErrUnknownTopic = errors.New("eventbus: unknown topic")
+	// ErrTopicExists is returned by CreateTopic for a topic that exists.
+	ErrTopicExists = errors.New("eventbus: topic already exists")
+	// ErrForbidden is returned when a topic's ACL does not allow a
+	// principal to publish or subscribe.
+	ErrForbidden = errors.New("eventbus: forbidden by topic ACL")
+	// ErrTooManySubscribers is returned by RegisterAs for a topic that has
+	// MaxSubscribers subscriptions already.
+	ErrTooManySubscribers = errors.New("eventbus: topic has too many subscribers")
+	// ErrSchema is returned by Dispatch for data of the wrong type.
+	ErrSchema = errors.New("eventbus: data does not match the topic schema")
+)
+
+// ACL lists the principals allowed to publish to and subscribe to a topic.
+// An empty list allows everyone, and "*" in a list does too. The empty
+// principal is the program itself, which is always allowed: ACLs guard
+// topics against clients and other processes, not against the code that
+// owns the bus.
+type ACL struct {
+	Publishers  []string `json:"publishers,omitempty"`
+	Subscribers []string `json:"subscribers,omitempty"`
+}
+
+func allowed(list []string, principal string) bool {
+	if principal == "" || len(list) == 0 {
+		return true
+	}
+	for _, p := range list {
+		if p == "*" || p == principal {
+			return true
+		}
+	}
+	return false
+}
+
+// TopicConfig configures a topic created with CreateTopic.
+type TopicConfig struct {
+	// Retention keeps the events of the topic for this long, so that a
+	// late subscriber can catch up with Retained. Zero keeps none.
+	Retention time.Duration `json:"retention,omitempty"`
+	// MaxRetained caps the retained events of the topic; the oldest are
+	// dropped beyond it. Zero means DefaultMaxRetained.
+	MaxRetained int `json:"max_retained,omitempty"`
+	// TTL is the deadline given to events published without one, relative
+	// to when they are published. Zero leaves them without a deadline.
+	TTL time.Duration `json:"ttl,omitempty"`
+	// MaxSubscribers limits the subscriptions RegisterAs accepts for the
+	// topic. Zero means no limit.
+	MaxSubscribers int `json:"max_subscribers,omitempty"`
+	// Schema names a type registered with RegisterSchema that the data of
+	// every event must have.
+	Schema string `json:"schema,omitempty"`
+	ACL    ACL    `json:"acl"`
+}
+
+// topicConfigJSON is TopicConfig with the retention period and TTL as
+// strings such as "10m", which is what an operator writes.
+type topicConfigJSON struct {
+	Retention      string `json:"retention,omitempty"`
+	MaxRetained    int    `json:"max_retained,omitempty"`
+	TTL            string `json:"ttl,omitempty"`
+	MaxSubscribers int    `json:"max_subscribers,omitempty"`
+	Schema         string `json:"schema,omitempty"`
+	ACL            ACL    `json:"acl"`
+}
+
+func (c TopicConfig) MarshalJSON() ([]byte, error) {
+	j := topicConfigJSON{MaxRetained: c.MaxRetained, MaxSubscribers: c.MaxSubscribers, Schema: c.Schema, ACL: c.ACL}
+	if c.Retention > 0 {
+		j.Retention = c.Retention.String()
+	}
+	if c.TTL > 0 {
+		j.TTL = c.TTL.String()
+	}
+	return json.Marshal(j)
+}
+
+func (c *TopicConfig) UnmarshalJSON(data []byte) error {
+	var j topicConfigJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	retention, err := parseDuration(j.Retention)
+	if err != nil {
+		return err
+	}
+	ttl, err := parseDuration(j.TTL)
+	if err != nil {
+		return err
+	}
+	*c = TopicConfig{
+		Retention:      retention,
+		MaxRetained:    j.MaxRetained,
+		TTL:            ttl,
+		MaxSubscribers: j.MaxSubscribers,
+		Schema:         j.Schema,
+		ACL:            j.ACL,
+	}
+	return nil
+}
+
+// parseDuration is time.ParseDuration that takes "" for zero.
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// TopicInfo describes a created topic.
+type TopicInfo struct {
+	Name        string      `json:"name"`
+	Config      TopicConfig `json:"config"`
+	Subscribers int         `json:"subscribers"`
+	Retained    int         `json:"retained"`
+}
+
+type topic struct {
+	config   TopicConfig
+	schema   reflect.Type
+	retained []retainedEvent
+}
+
+type retainedEvent struct {
+	event Event
+	at    time.Time
+	size  int64
+}
+
+// prune drops the retained events older than the retention period and
+// those past their deadline. It returns how many were past their deadline
+// and the bytes it freed.
+func (t *topic) prune(now time.Time) (expired int, freed int64) {
+	kept := t.retained[:0]
+	for _, r := range t.retained {
+		switch {
+		case now.Sub(r.at) > t.config.Retention:
+			freed += r.size
+		case r.event.Expired(now):
+			expired++
+			freed += r.size
+		default:
+			kept = append(kept, r)
+		}
+	}
+	clear(t.retained[len(kept):])
+	t.retained = kept
+	return expired, freed
+}
+
+// prune prunes the created topic name. The caller must hold
+// eb.provisioned.mu.
+func (eb *EventBus) prune(name string, t *topic, now time.Time) {
+	n, freed := t.prune(now)
+	if n > 0 {
+		eb.metrics.expired(name, n)
+	}
+	eb.provisioned.pending -= freed
+}
+
+type provisioning struct {
+	mu          sync.RWMutex
+	defaultDeny bool
+	topics      map[string]*topic
+	schemas     map[string]reflect.Type
+	memory      *membudget.Component
+	pending     int64 // bytes retained or freed since the budget was last told
+}
+
+// RegisterSchema makes name usable as TopicConfig.Schema. The data of
+// events on topics with that schema must have the type of example.
+func (eb *EventBus) RegisterSchema(name string, example interface{}) {
+	eb.provisioned.mu.Lock()
+	defer eb.provisioned.mu.Unlock()
+
+	if eb.provisioned.schemas == nil {
+		eb.provisioned.schemas = make(map[string]reflect.Type)
+	}
+	eb.provisioned.schemas[name] = reflect.TypeOf(example)
+}
+
+// SetDefaultDeny turns default-deny mode on or off. In default-deny mode
+// events for topics that were not created with CreateTopic are rejected
+// with ErrUnknownTopic. Private reply topics of Request are exempt.
+func (eb *EventBus) SetDefaultDeny(on bool) {
+	eb.provisioned.mu.Lock()
+	defer eb.provisioned.mu.Unlock()
+
+	eb.provisioned.defaultDeny = on
+}
+
+// CreateTopic declares the topic name with cfg: how long its events are
+// retained and stay deliverable, how many subscribers it may have, what
+// type its data must have and which principals may publish and subscribe.
+// Patterns cannot be created.
+//
+// Topics are otherwise created implicitly: publishing or subscribing to an
+// event type is all it takes. That suits a single program, but a bus shared
+// by several teams or exposed to other processes through bridges needs more
+// control. In default-deny mode, events for topics that were never created
+// are rejected.
+func (eb *EventBus) CreateTopic(name string, cfg TopicConfig) error {
+	return eb.putTopic(name, cfg, true)
+}
+
+// UpdateTopic replaces the config of a created topic. Retained events are
+// kept, subject to the new retention period; subscriptions over a lowered
+// MaxSubscribers stay registered.
+func (eb *EventBus) UpdateTopic(name string, cfg TopicConfig) error {
+	return eb.putTopic(name, cfg, false)
+}
+
+func (eb *EventBus) putTopic(name string, cfg TopicConfig, create bool) error {
+	if name == "" || isPattern(name) {
+		return fmt.Errorf("eventbus: invalid topic name %q", name)
+	}
+	if cfg.Retention < 0 || cfg.MaxRetained < 0 || cfg.TTL < 0 || cfg.MaxSubscribers < 0 {
+		return fmt.Errorf("eventbus: negative limit in config of topic %s", name)
+	}
+
+	defer eb.settleRetained()
+
+	eb.provisioned.mu.Lock()
+	defer eb.provisioned.mu.Unlock()
+
+	var schema reflect.Type
+	if cfg.Schema != "" {
+		var ok bool
+		if schema, ok = eb.provisioned.schemas[cfg.Schema]; !ok {
+			return fmt.Errorf("eventbus: unknown schema %q for topic %s", cfg.Schema, name)
+		}
+	}
+	if eb.provisioned.topics == nil {
+		eb.provisioned.topics = make(map[string]*topic)
+	}
+	t, exists := eb.provisioned.topics[name]
+	switch {
+	case create && exists:
+		return fmt.Errorf("%w: %s", ErrTopicExists, name)
+	case !create && !exists:
+		return fmt.Errorf("%w: %s", ErrUnknownTopic, name)
+	case create:
+		t = &topic{}
+		eb.provisioned.topics[name] = t
+	}
+	t.config = cfg
+	t.schema = schema
+	eb.prune(name, t, time.Now())
+	eb.trim(t)
+	return nil
+}
+
+// DeleteTopic removes a created topic and its retained events. Its
+// subscriptions stay registered; in default-deny mode they receive nothing
+// more.
+func (eb *EventBus) DeleteTopic(name string) error {
+	defer eb.settleRetained()
+
+	eb.provisioned.mu.Lock()
+	defer eb.provisioned.mu.Unlock()
+
+	t, ok := eb.provisioned.topics[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownTopic, name)
+	}
+	for _, r := range t.retained {
+		eb.provisioned.pending -= r.size
+	}
+	delete(eb.provisioned.topics, name)
+	return nil
+}
+
+// Topics describes the created topics, sorted by name.
+func (eb *EventBus) Topics() []TopicInfo {
+	eb.provisioned.mu.Lock()
+	now := time.Now()
+	infos := make([]TopicInfo, 0, len(eb.provisioned.topics))
+	for name, t := range eb.provisioned.topics {
+		eb.prune(name, t, now)
+		infos = append(infos, TopicInfo{Name: name, Config: t.config, Retained: len(t.retained)})
+	}
+	eb.provisioned.mu.Unlock()
+
+	eb.mu.RLock()
+	for i := range infos {
+		infos[i].Subscribers = len(eb.handlers[infos[i].Name])
+	}
+	eb.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Retained returns the events of topic published within its retention
+// period that have not reached their deadline, oldest first.
+func (eb *EventBus) Retained(name string) []Event {
+	defer eb.settleRetained()
+
+	eb.provisioned.mu.Lock()
+	defer eb.provisioned.mu.Unlock()
+
+	t, ok := eb.provisioned.topics[name]
+	if !ok {
+		return nil
+	}
+	eb.prune(name, t, time.Now())
+	events := make([]Event, len(t.retained))
+	for i, r := range t.retained {
+		events[i] = r.event
+	}
+	return events
+}
+
+// admit checks an event against the config of its topic before it is
+// published, gives it the topic's TTL and retains it if the topic says so.
+func (eb *EventBus) admit(event *Event) error {
+	if strings.HasPrefix(event.Type, replyTopicPrefix) {
+		return nil
+	}
+	defer eb.settleRetained()
+
+	eb.provisioned.mu.Lock()
+	defer eb.provisioned.mu.Unlock()
+
+	t, ok := eb.provisioned.topics[event.Type]
+	if !ok {
+		if eb.provisioned.defaultDeny {
+			return fmt.Errorf("%w: %s", ErrUnknownTopic, event.Type)
+		}
+		return nil
+	}
+	if !allowed(t.config.ACL.Publishers, event.Principal) {
+		return fmt.Errorf("%w: %s may not publish to %s", ErrForbidden, event.Principal, event.Type)
+	}
+	if t.schema != nil && reflect.TypeOf(event.Data) != t.schema {
+		return fmt.Errorf("%w: %s wants %s, got %T", ErrSchema, event.Type, t.schema, event.Data)
+	}
+	now := time.Now()
+	if t.config.TTL > 0 && event.Deadline.IsZero() {
+		event.Deadline = now.Add(t.config.TTL)
+	}
+	if t.config.Retention > 0 {
+		eb.prune(event.Type, t, now)
+		r := retainedEvent{event: *event, at: now, size: retainedSize(*event)}
+		t.retained = append(t.retained, r)
+		eb.provisioned.pending += r.size
+		eb.trim(t)
+	}
+	return nil
+}
+
+// mayReceive reports whether a subscription registered by principal may
+// see events of eventType. Subscriptions to patterns are checked here, per
+// event, against the topics they match.
+func (eb *EventBus) mayReceive(principal, eventType string) bool {
+	if principal == "" {
+		return true
+	}
+
+	eb.provisioned.mu.RLock()
+	defer eb.provisioned.mu.RUnlock()
+
+	t, ok := eb.provisioned.topics[eventType]
+	if !ok {
+		return !eb.provisioned.defaultDeny
+	}
+	return allowed(t.config.ACL.Subscribers, principal)
+}
+
+// DispatchAs publishes an event on behalf of principal, such as a client
+// or a bridged process, subject to the publisher ACL of the topic.
+func (eb *EventBus) DispatchAs(principal, eventType string, data interface{}) error {
+	return eb.DispatchEvent(Event{Type: eventType, Data: data, Principal: principal})
+}
+
+// RegisterAs is Register on behalf of principal. It fails if the topic's
+// subscriber ACL does not allow principal, if the topic has MaxSubscribers
+// subscriptions already, or, in default-deny mode, if the topic was not
+// created. Patterns may be registered; the handler only receives the events
+// of matching topics whose ACL allows principal.
+func (eb *EventBus) RegisterAs(principal, eventType string, priority int, handler EventHandler) (SubscriptionID, error) {
+	var cfg TopicConfig
+	if !isPattern(eventType) {
+		eb.provisioned.mu.RLock()
+		t, ok := eb.provisioned.topics[eventType]
+		deny := eb.provisioned.defaultDeny
+		if ok {
+			cfg = t.config
+		}
+		eb.provisioned.mu.RUnlock()
+
+		if !ok && deny {
+			return 0, fmt.Errorf("%w: %s", ErrUnknownTopic, eventType)
+		}
+		if !allowed(cfg.ACL.Subscribers, principal) {
+			return 0, fmt.Errorf("%w: %s may not subscribe to %s", ErrForbidden, principal, eventType)
+		}
+	}
+
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	if cfg.MaxSubscribers > 0 && len(eb.handlers[eventType]) >= cfg.MaxSubscribers {
+		return 0, fmt.Errorf("%w: %s", ErrTooManySubscribers, eventType)
+	}
+	return eb.register(eventType, priority, handler, Expiry{}, principal), nil
+}
+
+// TopicAdminHandler manages the created topics at runtime. GET lists them
+// as JSON. PUT with the parameter name creates the topic, or updates it,
+// with the TopicConfig in the body, and DELETE removes it:
+//
+//	curl -X PUT 'localhost:8001/topics?name=room.news.message' \
+//		-d '{"retention": "1h", "acl": {"publishers": ["alice"]}}'
+func (eb *EventBus) TopicAdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := req.URL.Query().Get("name")
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var cfg TopicConfig
+			if err := json.NewDecoder(req.Body).Decode(&cfg); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			err := eb.UpdateTopic(name, cfg)
+			if errors.Is(err, ErrUnknownTopic) {
+				err = eb.CreateTopic(name, cfg)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodDelete:
+			if err := eb.DeleteTopic(name); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(eb.Topics())
+	})
+}
@@ -0,0 +1,91 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import (
+	"context"
+	"strings"
+)
+
+// Tracer starts a span for delivering an event, such as the tracer of the
+// observability module. StartEvent returns the context the handlers see,
+// holding the span, and a function the bus calls with the first error of
+// the handlers once they are done.
+type Tracer interface {
+	StartEvent(ctx context.Context, eventType, id string) (context.Context, func(err error))
+}
+
+type tracerBox struct{ Tracer }
+
+// SetTracer makes the bus trace the delivery of every event with t. An
+// event published with the context of the handler it came from joins that
+// handler's trace. The private topics of Request replies are not traced.
+// A nil t stops tracing.
+func (eb *EventBus) SetTracer(t Tracer) {
+	if t == nil {
+		eb.tracer.Store(nil)
+		return
+	}
+	eb.tracer.Store(&tracerBox{t})
+}
+
+// DispatchContext is like Dispatch for an event published on behalf of the
+// operation of ctx, such as the request or event a handler is processing.
+// The handlers of the event see ctx, and a traced event joins its trace.
+func (eb *EventBus) DispatchContext(ctx context.Context, eventType string, data interface{}) error {
+	return eb.DispatchEvent(Event{Type: eventType, Data: data}.WithContext(ctx))
+}
+
+// Context returns the context the event was published with, or
+// context.Background. Handlers pass it on to what they call, so that the
+// calls join the event's trace.
+func (e Event) Context() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
+	return e.ctx
+}
+
+// WithContext returns a copy of e carrying ctx.
+func (e Event) WithContext(ctx context.Context) Event {
+	e.ctx = ctx
+	return e
+}
+
+// startSpan starts the span of delivering event, if the bus has a tracer,
+// and returns the event to hand to the handlers with the function that
+// ends the span.
+func (eb *EventBus) startSpan(event Event) (Event, func(error)) {
+	box := eb.tracer.Load()
+	if box == nil || strings.HasPrefix(event.Type, replyTopicPrefix) {
+		return event, func(error) {}
+	}
+	ctx, end := box.StartEvent(event.Context(), event.Type, event.ID)
+	return event.WithContext(ctx), end
+}
@@ -0,0 +1,79 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventbus
+
+import (
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/workerpool"
+)
+
+// DispatchWithTTL is DispatchWithDeadline with the deadline given relative
+// to now.
+func (eb *EventBus) DispatchWithTTL(eventType string, data interface{}, ttl time.Duration) error {
+	return eb.DispatchWithDeadline(eventType, data, time.Now().Add(ttl))
+}
+
+// PurgeExpired removes the events past their deadline from the queue and
+// from the retained events of the created topics, and returns how many it
+// removed. Expired events are never delivered either way, but until they
+// are purged they take up room in the queue and in memory. A full queue
+// is purged automatically before its overflow policy applies.
+func (eb *EventBus) PurgeExpired() int {
+	now := time.Now()
+	n := eb.purgeQueue(now)
+	defer eb.settleRetained()
+
+	eb.provisioned.mu.Lock()
+	defer eb.provisioned.mu.Unlock()
+
+	for name, t := range eb.provisioned.topics {
+		expired, freed := t.prune(now)
+		if expired > 0 {
+			eb.metrics.expired(name, expired)
+		}
+		eb.provisioned.pending -= freed
+		n += expired
+	}
+	return n
+}
+
+// purgeQueue removes the expired events from the queue of a queued bus.
+func (eb *EventBus) purgeQueue(now time.Time) int {
+	if eb.pool == nil {
+		return 0
+	}
+	removed := eb.pool.Remove(func(job workerpool.Job) bool {
+		return job.(delivery).event.Expired(now)
+	})
+	for _, job := range removed {
+		eb.metrics.expired(job.(delivery).event.Type, 1)
+	}
+	return len(removed)
+}
@@ -0,0 +1,181 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventstore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrUnknownKey is returned when a log line was encrypted with a key that is
+// not in the keyring.
+var ErrUnknownKey = errors.New("eventstore: unknown encryption key")
+
+// ErrPlaintext is returned when a log read with a keyring holds a line that
+// is not encrypted. Such a line was either written before the log was
+// encrypted, and has to be migrated with Reencrypt, or added by someone who
+// can write to the log but does not hold the keys.
+var ErrPlaintext = errors.New("eventstore: unencrypted line in an encrypted log")
+
+// SecretProvider hands out the master secrets that encryption keys are
+// derived from. Implementations can wrap a vault, a KMS or, as EnvSecrets
+// does, the environment.
+type SecretProvider interface {
+	Secret(id string) ([]byte, error)
+}
+
+// EnvSecrets reads secrets from environment variables named Prefix followed
+// by the upper-cased key ID, for example EVENTSTORE_KEY_2024A.
+type EnvSecrets struct {
+	Prefix string
+}
+
+func (e EnvSecrets) Secret(id string) ([]byte, error) {
+	name := e.Prefix + strings.ToUpper(id)
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return nil, fmt.Errorf("eventstore: secret %s is not set", name)
+	}
+	return []byte(value), nil
+}
+
+// Keyring holds the AES-256-GCM keys for an encrypted log. New lines are
+// sealed with the active key; the others are kept so that lines written
+// before a rotation can still be opened.
+type Keyring struct {
+	active string
+	aeads  map[string]cipher.AEAD
+}
+
+// NewKeyring derives a key for each ID from the secret the provider returns
+// for it. The first ID is the active key.
+func NewKeyring(provider SecretProvider, active string, older ...string) (*Keyring, error) {
+	k := &Keyring{active: active, aeads: make(map[string]cipher.AEAD)}
+	for _, id := range append([]string{active}, older...) {
+		secret, err := provider.Secret(id)
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(deriveKey(secret, "eventstore "+id))
+		if err != nil {
+			return nil, err
+		}
+		if k.aeads[id], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// deriveKey stretches a secret into a 32-byte key with HKDF-SHA256 (RFC
+// 5869), using info to give every key ID its own key.
+func deriveKey(secret []byte, info string) []byte {
+	extract := hmac.New(sha256.New, make([]byte, sha256.Size))
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write([]byte(info))
+	expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
+
+// sealed is the on-disk form of an encrypted line.
+type sealed struct {
+	KeyID string `json:"kid"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+func (k *Keyring) seal(plaintext []byte) ([]byte, error) {
+	if k == nil {
+		return plaintext, nil
+	}
+	aead := k.aeads[k.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return json.Marshal(sealed{
+		KeyID: k.active,
+		Nonce: nonce,
+		Data:  aead.Seal(nil, nonce, plaintext, []byte(k.active)),
+	})
+}
+
+// open decrypts a line sealed with any key of the keyring. Without a
+// keyring, plain-text lines are returned as they are; with one, they are
+// refused with ErrPlaintext unless allowPlaintext is set.
+func (k *Keyring) open(line []byte, allowPlaintext bool) ([]byte, error) {
+	if !bytes.HasPrefix(line, []byte(`{"kid":`)) {
+		if k != nil && !allowPlaintext {
+			return nil, ErrPlaintext
+		}
+		return line, nil
+	}
+	var s sealed
+	if err := json.Unmarshal(line, &s); err != nil {
+		return nil, err
+	}
+	if k == nil {
+		return nil, fmt.Errorf("%w %q: log is encrypted", ErrUnknownKey, s.KeyID)
+	}
+	aead, ok := k.aeads[s.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, s.KeyID)
+	}
+	return aead.Open(nil, s.Nonce, s.Data, []byte(s.KeyID))
+}
+
+// Reencrypt rewrites the log at path with the active key of keyring, for
+// example after a key rotation or to encrypt a plain-text log. It is the only
+// reader that accepts plain-text lines along with encrypted ones. The log
+// must not be open while it runs; the file is replaced atomically, so a crash
+// leaves either the old or the new version behind.
+func Reencrypt(path string, keyring *Keyring) (int, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	records, err := readRecords(in, path, keyring, true)
+	in.Close()
+	if err != nil {
+		return 0, err
+	}
+	return len(records), replaceLog(path, ".reencrypt-*", records, keyring)
+}
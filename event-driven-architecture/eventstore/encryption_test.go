@@ -0,0 +1,129 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventstore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// secrets is a SecretProvider backed by a map.
+type secrets map[string]string
+
+func (s secrets) Secret(id string) ([]byte, error) {
+	secret, ok := s[id]
+	if !ok {
+		return nil, fmt.Errorf("no secret %q", id)
+	}
+	return []byte(secret), nil
+}
+
+// appendEvents opens the log at path with keyring and appends n events.
+func appendEvents(t *testing.T, path string, keyring *Keyring, n int) {
+	t.Helper()
+	store, err := OpenEncryptedFileStore(path, keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for i := 0; i < n; i++ {
+		if _, err := store.Append("room.lobby", -1, "message", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPlaintextRejected(t *testing.T) {
+	keyring, err := NewKeyring(secrets{"k1": "secret"}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	appendEvents(t, path, keyring, 2)
+
+	// Someone without the key adds an event in plain text.
+	plain := filepath.Join(t.TempDir(), "plain.jsonl")
+	appendEvents(t, plain, nil, 1)
+	line, err := os.ReadFile(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(line)
+	file.Close()
+
+	if _, err := OpenEncryptedFileStore(path, keyring); !errors.Is(err, ErrPlaintext) {
+		t.Fatalf("OpenEncryptedFileStore: got %v, want ErrPlaintext", err)
+	}
+	if _, _, err := Compact(path, keyring, func(_ string, records []Record) []Record { return records }); !errors.Is(err, ErrPlaintext) {
+		t.Fatalf("Compact: got %v, want ErrPlaintext", err)
+	}
+}
+
+func TestReencryptMigratesPlaintext(t *testing.T) {
+	keyring, err := NewKeyring(secrets{"k1": "secret"}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	appendEvents(t, path, nil, 3)
+
+	if _, err := OpenEncryptedFileStore(path, keyring); !errors.Is(err, ErrPlaintext) {
+		t.Fatalf("before Reencrypt: got %v, want ErrPlaintext", err)
+	}
+	n, err := Reencrypt(path, keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("Reencrypt rewrote %d records, want 3", n)
+	}
+
+	store, err := OpenEncryptedFileStore(path, keyring)
+	if err != nil {
+		t.Fatalf("after Reencrypt: %v", err)
+	}
+	defer store.Close()
+	records, err := store.Load("room.lobby", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("loaded %d records, want 3", len(records))
+	}
+	if _, err := OpenFileStore(path); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("OpenFileStore of an encrypted log: got %v, want ErrUnknownKey", err)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrVersionConflict is returned by Append when the stream has moved past the
+// version the caller expected.
+var ErrVersionConflict = errors.New("eventstore: version conflict")
+
+// AnyVersion disables the optimistic concurrency check in Append.
+const AnyVersion = -1
+
+// Record is a single persisted event. Versions start at 1 and increase by one
+// for every event appended to the same stream.
+type Record struct {
+	Stream  string          `json:"stream"`
+	Version uint64          `json:"version"`
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data"`
+	Time    time.Time       `json:"time"`
+}
+
+// Decode unmarshals the record payload into v.
+func (r Record) Decode(v interface{}) error {
+	return json.Unmarshal(r.Data, v)
+}
+
+// EventStore is an append-only log of events grouped into streams, typically
+// one stream per aggregate.
+type EventStore interface {
+	// Append adds an event to the end of stream. If expectedVersion is not
+	// AnyVersion it must match the current version of the stream.
+	Append(stream string, expectedVersion int64, eventType string, data interface{}) (Record, error)
+	// Load returns the events of stream with a version greater than
+	// afterVersion, oldest first.
+	Load(stream string, afterVersion uint64) ([]Record, error)
+}
+
+func newRecord(stream string, version uint64, eventType string, data interface{}) (Record, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Record{}, fmt.Errorf("eventstore: encoding %s event: %w", eventType, err)
+	}
+	return Record{
+		Stream:  stream,
+		Version: version,
+		Type:    eventType,
+		Data:    raw,
+		Time:    time.Now().UTC(),
+	}, nil
+}
+
+func checkVersion(current uint64, expected int64) error {
+	if expected != AnyVersion && uint64(expected) != current {
+		return fmt.Errorf("%w: stream is at version %d, expected %d", ErrVersionConflict, current, expected)
+	}
+	return nil
+}
+
+// Replay feeds the events of stream after afterVersion to apply in order and
+// stops at the first error.
+func Replay(store EventStore, stream string, afterVersion uint64, apply func(Record) error) error {
+	records, err := store.Load(stream, afterVersion)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := apply(record); err != nil {
+			return fmt.Errorf("eventstore: replaying %s v%d: %w", stream, record.Version, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventstore
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileStore persists events as JSON lines in a single append-only file. The
+// file is read once when the store is opened and kept indexed in memory, so
+// it suits demos and small logs rather than large event histories.
+type FileStore struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	memory  *MemoryStore
+	keyring *Keyring
+}
+
+// OpenFileStore opens or creates the log at path and loads its contents.
+func OpenFileStore(path string) (*FileStore, error) {
+	return OpenEncryptedFileStore(path, nil)
+}
+
+// OpenEncryptedFileStore is like OpenFileStore, but every line is encrypted
+// with the active key of keyring. Lines written with an older key of the
+// keyring can still be read; a line in plain text fails with ErrPlaintext, so
+// a plain-text log has to be migrated with Reencrypt before it is opened.
+func OpenEncryptedFileStore(path string, keyring *Keyring) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := readRecords(file, path, keyring, false)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	memory := NewMemoryStore()
+	for _, record := range records {
+		memory.streams[record.Stream] = append(memory.streams[record.Stream], record)
+	}
+
+	return &FileStore{path: path, file: file, memory: memory, keyring: keyring}, nil
+}
+
+// readRecords reads every record of a log in file order. Plain-text lines are
+// only accepted from a log read with a keyring if allowPlaintext is set.
+func readRecords(r io.Reader, path string, keyring *Keyring, allowPlaintext bool) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		data, err := keyring.open(scanner.Bytes(), allowPlaintext)
+		if err != nil {
+			return nil, fmt.Errorf("eventstore: %s line %d: %w", path, line, err)
+		}
+		var record Record
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("eventstore: %s line %d: %w", path, line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// encodeLine turns a record into a log line, encrypted if keyring is set.
+func encodeLine(record Record, keyring *Keyring) ([]byte, error) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if line, err = keyring.seal(line); err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+func (s *FileStore) Append(stream string, expectedVersion int64, eventType string, data interface{}) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.memory.mu.Lock()
+	defer s.memory.mu.Unlock()
+
+	records := s.memory.streams[stream]
+	version := lastVersion(records)
+	if err := checkVersion(version, expectedVersion); err != nil {
+		return Record{}, err
+	}
+	record, err := newRecord(stream, version+1, eventType, data)
+	if err != nil {
+		return Record{}, err
+	}
+
+	line, err := encodeLine(record, s.keyring)
+	if err != nil {
+		return Record{}, err
+	}
+	if err := s.lock(); err != nil {
+		return Record{}, err
+	}
+	_, err = s.file.Write(line)
+	unlockFile(s.file)
+	if err != nil {
+		return Record{}, err
+	}
+	s.memory.streams[stream] = append(records, record)
+	return record, nil
+}
+
+// lock takes a shared lock on the log for an append. If Compact replaced
+// the log since the store opened it, the store reopens it first, so the
+// append is not lost in the old file. The caller must hold s.mu.
+func (s *FileStore) lock() error {
+	for {
+		if err := lockFile(s.file, false); err != nil {
+			return err
+		}
+		current, err := os.Stat(s.path)
+		if err != nil {
+			unlockFile(s.file)
+			return err
+		}
+		opened, err := s.file.Stat()
+		if err != nil {
+			unlockFile(s.file)
+			return err
+		}
+		if os.SameFile(current, opened) {
+			return nil
+		}
+
+		unlockFile(s.file)
+		file, err := os.OpenFile(s.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		s.file.Close()
+		s.file = file
+	}
+}
+
+func (s *FileStore) Load(stream string, afterVersion uint64) ([]Record, error) {
+	return s.memory.Load(stream, afterVersion)
+}
+
+// Compact compacts the log of the store with the package-level Compact,
+// and drops the records keep does not return from the store's memory as
+// well.
+func (s *FileStore) Compact(keep func(stream string, records []Record) []Record) (kept, removed int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if kept, removed, err = Compact(s.path, s.keyring, keep); err != nil {
+		return kept, removed, err
+	}
+
+	s.memory.mu.Lock()
+	defer s.memory.mu.Unlock()
+	for stream, records := range s.memory.streams {
+		s.memory.streams[stream] = keep(stream, records)
+	}
+	return kept, removed, nil
+}
+
+func (s *FileStore) Close() error {
+	return s.file.Close()
+}
+
+// Compact rewrites the log at path with only the records that keep
+// returns, and reports how many records it kept and removed. keep is
+// called once for every stream with the stream's records, oldest first,
+// and returns those to keep, in the same order. Versions are not
+// renumbered, so a compacted stream starts at the version of its oldest
+// kept record.
+//
+// Unlike Reencrypt, Compact may run while the log is open in a FileStore,
+// in this process or another: on Unix it holds an exclusive lock on the
+// log while it rewrites it, appends wait for the lock, and stores reopen
+// the log once it has been replaced. Elsewhere the log must not be written
+// while Compact runs.
+func Compact(path string, keyring *Keyring, keep func(stream string, records []Record) []Record) (kept, removed int, err error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer in.Close()
+	if err := lockFile(in, true); err != nil {
+		return 0, 0, err
+	}
+	defer unlockFile(in)
+
+	records, err := readRecords(in, path, keyring, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	var streams []string
+	byStream := make(map[string][]Record)
+	for _, record := range records {
+		if _, ok := byStream[record.Stream]; !ok {
+			streams = append(streams, record.Stream)
+		}
+		byStream[record.Stream] = append(byStream[record.Stream], record)
+	}
+	var compacted []Record
+	for _, stream := range streams {
+		compacted = append(compacted, keep(stream, byStream[stream])...)
+	}
+
+	if err := replaceLog(path, ".compact-*", compacted, keyring); err != nil {
+		return 0, 0, err
+	}
+	return len(compacted), len(records) - len(compacted), nil
+}
+
+// replaceLog writes records to a temporary file next to path and renames it
+// over path, so a crash leaves either the old or the new log behind.
+func replaceLog(path, pattern string, records []Record, keyring *Keyring) error {
+	out, err := os.CreateTemp(filepath.Dir(path), pattern)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		line, err := encodeLine(record, keyring)
+		if err == nil {
+			_, err = out.Write(line)
+		}
+		if err != nil {
+			out.Close()
+			os.Remove(out.Name())
+			return err
+		}
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+	return os.Rename(out.Name(), path)
+}
@@ -0,0 +1,86 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventstore
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps all streams in memory. It is safe for concurrent use.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	streams map[string][]Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		streams: make(map[string][]Record),
+	}
+}
+
+func (s *MemoryStore) Append(stream string, expectedVersion int64, eventType string, data interface{}) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := s.streams[stream]
+	version := lastVersion(records)
+	if err := checkVersion(version, expectedVersion); err != nil {
+		return Record{}, err
+	}
+
+	record, err := newRecord(stream, version+1, eventType, data)
+	if err != nil {
+		return Record{}, err
+	}
+	s.streams[stream] = append(records, record)
+	return record, nil
+}
+
+func (s *MemoryStore) Load(stream string, afterVersion uint64) ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := s.streams[stream]
+	i := sort.Search(len(records), func(i int) bool { return records[i].Version > afterVersion })
+	if i == len(records) {
+		return nil, nil
+	}
+	return append([]Record(nil), records[i:]...), nil
+}
+
+// lastVersion returns the version of a stream. It is the version of its
+// last record rather than the number of records, because a compacted
+// stream no longer starts at version 1.
+func lastVersion(records []Record) uint64 {
+	if len(records) == 0 {
+		return 0
+	}
+	return records[len(records)-1].Version
+}
@@ -0,0 +1,188 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package eventstore
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Aggregate is state rebuilt from a stream of events. Its exported fields are
+// what gets stored in a snapshot.
+type Aggregate interface {
+	Apply(Record) error
+}
+
+// Snapshot captures the state of a stream at a given version so that a
+// rebuild only needs to replay the events recorded after it.
+type Snapshot struct {
+	Stream  string          `json:"stream"`
+	Version uint64          `json:"version"`
+	State   json.RawMessage `json:"state"`
+}
+
+type SnapshotStore interface {
+	SaveSnapshot(Snapshot) error
+	// LoadSnapshot returns false if no snapshot exists for stream.
+	LoadSnapshot(stream string) (Snapshot, bool, error)
+}
+
+// Rebuild restores agg from the latest snapshot of stream, if any, and then
+// replays the remaining events. It returns the version agg is now at.
+func Rebuild(store EventStore, snapshots SnapshotStore, stream string, agg Aggregate) (uint64, error) {
+	var version uint64
+	if snapshots != nil {
+		snapshot, ok, err := snapshots.LoadSnapshot(stream)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			if err := json.Unmarshal(snapshot.State, agg); err != nil {
+				return 0, err
+			}
+			version = snapshot.Version
+		}
+	}
+
+	err := Replay(store, stream, version, func(record Record) error {
+		version = record.Version
+		return agg.Apply(record)
+	})
+	return version, err
+}
+
+// TakeSnapshot stores the current state of agg as the snapshot of stream at
+// version.
+func TakeSnapshot(snapshots SnapshotStore, stream string, version uint64, agg Aggregate) error {
+	state, err := json.Marshal(agg)
+	if err != nil {
+		return err
+	}
+	return snapshots.SaveSnapshot(Snapshot{Stream: stream, Version: version, State: state})
+}
+
+// MemorySnapshotStore keeps the latest snapshot of each stream in memory.
+type MemorySnapshotStore struct {
+	mu        sync.RWMutex
+	snapshots map[string]Snapshot
+}
+
+func NewMemorySnapshotStore() *MemorySnapshotStore {
+	return &MemorySnapshotStore{
+		snapshots: make(map[string]Snapshot),
+	}
+}
+
+func (s *MemorySnapshotStore) SaveSnapshot(snapshot Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.snapshots[snapshot.Stream] = snapshot
+	return nil
+}
+
+func (s *MemorySnapshotStore) LoadSnapshot(stream string) (Snapshot, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshot, ok := s.snapshots[stream]
+	return snapshot, ok, nil
+}
+
+// FileSnapshotStore writes one JSON file per stream into a directory,
+// replacing it atomically on every save.
+type FileSnapshotStore struct {
+	dir     string
+	keyring *Keyring
+}
+
+func NewFileSnapshotStore(dir string) (*FileSnapshotStore, error) {
+	return NewEncryptedFileSnapshotStore(dir, nil)
+}
+
+// NewEncryptedFileSnapshotStore is like NewFileSnapshotStore, but snapshots
+// are encrypted with the active key of keyring.
+func NewEncryptedFileSnapshotStore(dir string, keyring *Keyring) (*FileSnapshotStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileSnapshotStore{dir: dir, keyring: keyring}, nil
+}
+
+func (s *FileSnapshotStore) SaveSnapshot(snapshot Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	if data, err = s.keyring.seal(data); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".snapshot-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(snapshot.Stream))
+}
+
+func (s *FileSnapshotStore) LoadSnapshot(stream string) (Snapshot, bool, error) {
+	data, err := os.ReadFile(s.path(stream))
+	if errors.Is(err, os.ErrNotExist) {
+		return Snapshot{}, false, nil
+	}
+	if err != nil {
+		return Snapshot{}, false, err
+	}
+	if data, err = s.keyring.open(data, false); err != nil {
+		return Snapshot{}, false, err
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return Snapshot{}, false, err
+	}
+	return snapshot, true, nil
+}
+
+func (s *FileSnapshotStore) path(stream string) string {
+	return filepath.Join(s.dir, url.PathEscape(stream)+".json")
+}
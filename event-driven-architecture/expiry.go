@@ -0,0 +1,78 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// purgeInterval is how often expired messages are purged from the history
+// and from the bus.
+const purgeInterval = 10 * time.Second
+
+// expiry returns when a message sent at now expires: after the ttl seconds
+// the client asked for, but no later than max after now. Zero for either
+// means no limit, and the zero time means the message does not expire.
+func expiry(now time.Time, ttl int, max time.Duration) time.Time {
+	d := time.Duration(ttl) * time.Second
+	if ttl <= 0 || (max > 0 && d > max) {
+		d = max
+	}
+	if d <= 0 {
+		return time.Time{}
+	}
+	return now.Add(d)
+}
+
+// ttlLeft returns the whole seconds until expires, rounded up, for the TTL
+// of an outgoing envelope. It is zero for messages that do not expire.
+func ttlLeft(expires, now time.Time) int {
+	if expires.IsZero() {
+		return 0
+	}
+	left := expires.Sub(now)
+	if left <= 0 {
+		return 1
+	}
+	return int((left + time.Second - 1) / time.Second)
+}
+
+// purgeExpired purges expired messages from the history and the bus. It
+// is scheduled every purgeInterval. Expired messages are never delivered or
+// replayed either way; the purge frees the memory they hold.
+func (cs *ChatServer) purgeExpired(ctx context.Context) error {
+	cs.mu.Lock()
+	history := cs.history
+	cs.mu.Unlock()
+
+	history.Purge()
+	cs.eventBus.PurgeExpired()
+	return nil
+}
@@ -0,0 +1,33 @@
+module github.com/rajamummidi/go-design-patterns/event-driven-architecture
+
+go 1.21
+
+require (
+	github.com/rajamummidi/go-design-patterns/config v0.0.0
+	github.com/rajamummidi/go-design-patterns/future v0.0.0
+	github.com/rajamummidi/go-design-patterns/golden v0.0.0
+	github.com/rajamummidi/go-design-patterns/health v0.0.0
+	github.com/rajamummidi/go-design-patterns/leader-election v0.0.0
+	github.com/rajamummidi/go-design-patterns/leakcheck v0.0.0
+	github.com/rajamummidi/go-design-patterns/lifecycle v0.0.0
+	github.com/rajamummidi/go-design-patterns/observability v0.0.0
+	github.com/rajamummidi/go-design-patterns/otlp v0.0.0
+	github.com/rajamummidi/go-design-patterns/rate-limiter v0.0.0
+	github.com/rajamummidi/go-design-patterns/resp v0.0.0
+	github.com/rajamummidi/go-design-patterns/state-machine v0.0.0
+)
+
+replace (
+	github.com/rajamummidi/go-design-patterns/config => ../config
+	github.com/rajamummidi/go-design-patterns/future => ../future
+	github.com/rajamummidi/go-design-patterns/golden => ../golden
+	github.com/rajamummidi/go-design-patterns/health => ../health
+	github.com/rajamummidi/go-design-patterns/leader-election => ../leader-election
+	github.com/rajamummidi/go-design-patterns/leakcheck => ../leakcheck
+	github.com/rajamummidi/go-design-patterns/lifecycle => ../lifecycle
+	github.com/rajamummidi/go-design-patterns/observability => ../observability
+	github.com/rajamummidi/go-design-patterns/otlp => ../otlp
+	github.com/rajamummidi/go-design-patterns/rate-limiter => ../rate-limiter
+	github.com/rajamummidi/go-design-patterns/resp => ../resp
+	github.com/rajamummidi/go-design-patterns/state-machine => ../state-machine
+)
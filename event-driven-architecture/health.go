@@ -0,0 +1,79 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/health/health"
+)
+
+// healthTopic carries the requests of the liveness check.
+const healthTopic = "health.ping"
+
+// onHealthPing answers the liveness check with the number of clients.
+// Counting them takes the server's lock, so a server stuck on it, or a bus
+// that no longer delivers, fails the check and gets restarted.
+func (cs *ChatServer) onHealthPing(event eventbus.Event) error {
+	return cs.eventBus.Reply(event, cs.clientCount())
+}
+
+// checkBus is the liveness check: a request on the bus is answered.
+func (cs *ChatServer) checkBus(ctx context.Context) error {
+	_, err := cs.eventBus.Request(ctx, healthTopic, nil)
+	return err
+}
+
+// checkListener is a readiness check: the server accepts new clients. It
+// fails before the server listens and once it drains or stops.
+func (cs *ChatServer) checkListener(ctx context.Context) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	switch {
+	case cs.draining:
+		return errors.New("draining")
+	case cs.stopped:
+		return errors.New("stopped")
+	case cs.listener == nil:
+		return errors.New("not listening yet")
+	}
+	return nil
+}
+
+// RegisterHealth adds the server's checks to checks: the bus answering
+// requests for liveness, and the listener accepting clients and the bus
+// taking events for readiness.
+func (cs *ChatServer) RegisterHealth(checks *health.Registry) {
+	checks.AddLiveness("eventbus", health.CheckerFunc(cs.checkBus))
+	checks.AddReadiness("listener", health.CheckerFunc(cs.checkListener))
+	checks.AddReadiness("eventbus-queue", cs.eventBus)
+}
@@ -0,0 +1,425 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventstore"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/membudget"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/protocol"
+)
+
+// defaultHistorySize is how many messages per room are replayed on join
+// unless -history says otherwise.
+const defaultHistorySize = 50
+
+// historyEvent is the event type of the messages in a room's history
+// stream.
+const historyEvent = "message"
+
+// HistoryEntry is a message as it is kept in a room's history.
+type HistoryEntry struct {
+	Nick string    `json:"nick"`
+	Text string    `json:"text"`
+	Time time.Time `json:"time"`
+	// Expires is when the message is purged from the history, if it was
+	// sent with a TTL.
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+func (e HistoryEntry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && now.After(e.Expires)
+}
+
+// HistoryStats are the counters of a History.
+type HistoryStats struct {
+	Rooms    int `json:"rooms"`
+	Messages int `json:"messages"`
+	// Expired counts messages purged because their TTL ran out.
+	Expired uint64 `json:"expired"`
+}
+
+// History keeps the last messages of every room in a ring buffer so they can
+// be replayed to clients joining the room. With an event store, every
+// message is also appended to a stream per room, and the ring buffers are
+// refilled from the store after a restart.
+type History struct {
+	size  int
+	store eventstore.EventStore
+
+	mu      sync.Mutex
+	rooms   map[string]*ring
+	memory  *membudget.Component
+	pending int64 // bytes retained or freed since the budget was last told
+	expired uint64
+}
+
+// NewHistory keeps size messages per room. The store may be nil, in which
+// case the history lives in memory only.
+func NewHistory(size int, store eventstore.EventStore) *History {
+	return &History{size: size, store: store, rooms: make(map[string]*ring)}
+}
+
+// UseBudget accounts the messages kept in memory against budget. When the
+// budget runs out, the oldest messages of all rooms are evicted first;
+// persisted messages stay in the store.
+func (h *History) UseBudget(budget *membudget.Budget, weight float64) {
+	memory := budget.Register("history", weight, h.evict)
+
+	h.mu.Lock()
+	h.memory = memory
+	h.mu.Unlock()
+	h.settle()
+}
+
+// Record adds a message to the history of room. A message that has
+// already expired is not recorded.
+func (h *History) Record(room string, entry HistoryEntry) error {
+	if h.size <= 0 || entry.expired(time.Now()) {
+		return nil
+	}
+	defer h.settle()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, err := h.ring(room)
+	if err != nil {
+		return err
+	}
+	if h.store != nil {
+		if _, err := h.store.Append(historyStream(room), eventstore.AnyVersion, historyEvent, entry); err != nil {
+			return err
+		}
+	}
+	h.push(r, entry)
+	return nil
+}
+
+// Recent returns the kept messages of room that have not expired, oldest
+// first.
+func (h *History) Recent(room string) ([]HistoryEntry, error) {
+	if h.size <= 0 {
+		return nil, nil
+	}
+	defer h.settle()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, err := h.ring(room)
+	if err != nil {
+		return nil, err
+	}
+	h.purge(r, time.Now())
+	return r.entries(), nil
+}
+
+// Purge removes the expired messages of every room from memory and
+// returns how many it removed. Persisted messages stay in the store, but
+// are skipped when the history is loaded from it.
+func (h *History) Purge() int {
+	defer h.settle()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	n := 0
+	for _, r := range h.rooms {
+		n += h.purge(r, now)
+	}
+	return n
+}
+
+// purge removes the expired messages of r. The caller must hold h.mu.
+func (h *History) purge(r *ring, now time.Time) int {
+	removed := r.remove(func(entry HistoryEntry) bool { return entry.expired(now) })
+	for _, entry := range removed {
+		h.pending -= entry.size()
+	}
+	h.expired += uint64(len(removed))
+	return len(removed)
+}
+
+// compactor is an event store whose log can be compacted, such as an
+// eventstore.FileStore.
+type compactor interface {
+	Compact(keep func(stream string, records []eventstore.Record) []eventstore.Record) (kept, removed int, err error)
+}
+
+// Compact drops the messages that would never be replayed again from the
+// event store: expired messages, and all but the last size messages of each
+// room. It returns how many messages it kept and removed, and does nothing
+// if the history has no store or its store cannot be compacted.
+func (h *History) Compact() (kept, removed int, err error) {
+	store, ok := h.store.(compactor)
+	if !ok {
+		return 0, 0, nil
+	}
+	now := time.Now()
+	return store.Compact(func(stream string, records []eventstore.Record) []eventstore.Record {
+		if !strings.HasPrefix(stream, historyStreamPrefix) {
+			return records
+		}
+		var live []eventstore.Record
+		for _, record := range records {
+			var entry HistoryEntry
+			// Records that cannot be decoded are kept for someone to look at.
+			if err := record.Decode(&entry); err == nil && entry.expired(now) {
+				continue
+			}
+			live = append(live, record)
+		}
+		if len(live) > h.size {
+			live = live[len(live)-h.size:]
+		}
+		return live
+	})
+}
+
+// Stats returns the number of rooms and messages kept in memory and how
+// many messages expired.
+func (h *History) Stats() HistoryStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stats := HistoryStats{Rooms: len(h.rooms), Expired: h.expired}
+	for _, r := range h.rooms {
+		stats.Messages += r.n
+	}
+	return stats
+}
+
+// ring returns the ring buffer of room, loading it from the store the first
+// time the room is used. The caller must hold h.mu.
+func (h *History) ring(room string) (*ring, error) {
+	if r, ok := h.rooms[room]; ok {
+		return r, nil
+	}
+
+	r := &ring{buf: make([]HistoryEntry, h.size)}
+	if h.store != nil {
+		records, err := h.store.Load(historyStream(room), 0)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		for _, record := range records {
+			var entry HistoryEntry
+			if err := record.Decode(&entry); err != nil {
+				return nil, fmt.Errorf("history of #%s: %w", room, err)
+			}
+			if !entry.expired(now) {
+				h.push(r, entry)
+			}
+		}
+	}
+	h.rooms[room] = r
+	return r, nil
+}
+
+// push adds entry to r and keeps track of the memory it retains. The caller
+// must hold h.mu.
+func (h *History) push(r *ring, entry HistoryEntry) {
+	h.pending += entry.size()
+	if evicted, ok := r.push(entry); ok {
+		h.pending -= evicted.size()
+	}
+}
+
+// settle tells the budget about the memory retained or freed since the last
+// call. It must be called without h.mu held, because reserving memory may
+// call back into evict.
+func (h *History) settle() {
+	h.mu.Lock()
+	memory, pending := h.memory, h.pending
+	if memory != nil {
+		h.pending = 0
+	}
+	h.mu.Unlock()
+
+	switch {
+	case memory == nil:
+	case pending > 0:
+		memory.Reserve(pending)
+	case pending < 0:
+		memory.Release(-pending)
+	}
+}
+
+// evict drops the oldest messages across all rooms until need bytes are
+// freed or the history is empty.
+func (h *History) evict(need int64) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var freed int64
+	for freed < need {
+		var oldest *ring
+		for _, r := range h.rooms {
+			if first, ok := r.first(); ok {
+				if o, _ := oldest.first(); oldest == nil || first.Time.Before(o.Time) {
+					oldest = r
+				}
+			}
+		}
+		if oldest == nil {
+			break
+		}
+		entry, _ := oldest.pop()
+		freed += entry.size()
+	}
+	return freed
+}
+
+// historyStreamPrefix starts the names of the history streams in the event
+// store.
+const historyStreamPrefix = "room-"
+
+func historyStream(room string) string {
+	return historyStreamPrefix + room
+}
+
+// historyEntryOverhead approximates the memory of a HistoryEntry besides its
+// strings.
+const historyEntryOverhead = 64
+
+func (e HistoryEntry) size() int64 {
+	return int64(historyEntryOverhead + len(e.Nick) + len(e.Text))
+}
+
+// ring is a fixed-size buffer that overwrites its oldest entry when full.
+type ring struct {
+	buf   []HistoryEntry
+	start int
+	n     int
+}
+
+// push appends entry, returning the entry it overwrote if the ring was full.
+func (r *ring) push(entry HistoryEntry) (evicted HistoryEntry, ok bool) {
+	if r.n < len(r.buf) {
+		r.buf[(r.start+r.n)%len(r.buf)] = entry
+		r.n++
+		return HistoryEntry{}, false
+	}
+	evicted = r.buf[r.start]
+	r.buf[r.start] = entry
+	r.start = (r.start + 1) % len(r.buf)
+	return evicted, true
+}
+
+// first returns the oldest entry. It may be called on a nil ring.
+func (r *ring) first() (HistoryEntry, bool) {
+	if r == nil || r.n == 0 {
+		return HistoryEntry{}, false
+	}
+	return r.buf[r.start], true
+}
+
+// pop removes and returns the oldest entry.
+func (r *ring) pop() (HistoryEntry, bool) {
+	entry, ok := r.first()
+	if ok {
+		r.buf[r.start] = HistoryEntry{}
+		r.start = (r.start + 1) % len(r.buf)
+		r.n--
+	}
+	return entry, ok
+}
+
+// remove removes the entries drop reports true for, keeping the others in
+// order, and returns the removed ones.
+func (r *ring) remove(drop func(HistoryEntry) bool) []HistoryEntry {
+	var removed []HistoryEntry
+	kept := 0
+	for i := 0; i < r.n; i++ {
+		entry := r.buf[(r.start+i)%len(r.buf)]
+		if drop(entry) {
+			removed = append(removed, entry)
+			continue
+		}
+		r.buf[(r.start+kept)%len(r.buf)] = entry
+		kept++
+	}
+	for i := kept; i < r.n; i++ {
+		r.buf[(r.start+i)%len(r.buf)] = HistoryEntry{}
+	}
+	r.n = kept
+	return removed
+}
+
+func (r *ring) entries() []HistoryEntry {
+	entries := make([]HistoryEntry, r.n)
+	for i := range entries {
+		entries[i] = r.buf[(r.start+i)%len(r.buf)]
+	}
+	return entries
+}
+
+// onRoomMessageRecorded adds a room message to the room's history.
+func (cs *ChatServer) onRoomMessageRecorded(event eventbus.Event) error {
+	cs.mu.Lock()
+	history := cs.history
+	cs.mu.Unlock()
+
+	msg := cs.redact.Apply(historySink, event).Data.(RoomMessage)
+	return history.Record(msg.Room, HistoryEntry{Nick: msg.Nick, Text: msg.Text, Time: msg.Time, Expires: msg.Expires})
+}
+
+// onRoomJoinedReplay sends the history of a room to a client that just
+// joined it.
+func (cs *ChatServer) onRoomJoinedReplay(event eventbus.Event) error {
+	change := event.Data.(RoomChange)
+	cs.mu.Lock()
+	history := cs.history
+	cs.mu.Unlock()
+
+	entries, err := history.Recent(change.Room)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		cs.send([]Transportable{change.Conn}, protocol.Envelope{
+			Type:      protocol.TypeHistory,
+			Sender:    entry.Nick,
+			Room:      change.Room,
+			Timestamp: entry.Time,
+			Body:      entry.Text,
+			TTL:       ttlLeft(entry.Expires, now),
+		})
+	}
+	return nil
+}
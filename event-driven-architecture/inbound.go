@@ -0,0 +1,179 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/chain"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/usage"
+)
+
+// Every inbound message passes through a chain of processors before it
+// reaches a room. Flood protection comes first, so the messages of a
+// flooding client are dropped before any work is done on them. Blank
+// messages are dropped next, then commands are carried out, then blocked
+// words are masked, and what is left is published to the sender's room.
+
+// processor is a built-in link of the inbound chain.
+type processor struct {
+	priority int
+	process  func(cs *ChatServer, msg Message, next chain.Next[Message]) error
+}
+
+// processors are the built-in links by name. Their priorities leave room
+// for processors registered by other code in between.
+var processors = map[string]processor{
+	"rate-limit": {40, (*ChatServer).throttleMessage},
+	"validate":   {30, (*ChatServer).validateMessage},
+	"commands":   {20, (*ChatServer).onRoomCommand},
+	"profanity":  {10, (*ChatServer).filterProfanity},
+	"broadcast":  {0, (*ChatServer).publishMessage},
+}
+
+// defaultInbound are the processors a new server starts with.
+var defaultInbound = []string{"rate-limit", "validate", "commands", "profanity", "broadcast"}
+
+// Inbound returns the chain inbound messages pass through. Other code may
+// register processors of its own on it while the server runs.
+func (cs *ChatServer) Inbound() *chain.Chain[Message] {
+	return cs.inbound
+}
+
+// EnableProcessor adds the built-in processor name to the inbound chain.
+func (cs *ChatServer) EnableProcessor(name string) error {
+	p, ok := processors[name]
+	if !ok {
+		return fmt.Errorf("unknown processor %q", name)
+	}
+	return cs.inbound.Register(name, p.priority, chain.ProcessorFunc[Message](func(msg Message, next chain.Next[Message]) error {
+		return p.process(cs, msg, next)
+	}))
+}
+
+// DisableProcessor removes the processor name from the inbound chain.
+// Without the broadcast processor, messages reach no room.
+func (cs *ChatServer) DisableProcessor(name string) error {
+	if !cs.inbound.Unregister(name) {
+		return fmt.Errorf("processor %q is not in the chain", name)
+	}
+	return nil
+}
+
+// onMessageReceived records that the sender is active and passes the
+// message through the inbound chain.
+func (cs *ChatServer) onMessageReceived(event eventbus.Event) error {
+	msg := event.Data.(Message)
+	msg.ctx = event.Context()
+	cs.seen(msg.From, msg.Time)
+	// The event counts after the quota was checked for it.
+	err := cs.inbound.Handle(msg)
+	cs.recordUsage(msg.Nick, usage.Usage{Events: 1})
+	return err
+}
+
+// SetBlocklist makes the profanity processor mask the given words, whole
+// and in any case, with asterisks. An empty list masks nothing.
+func (cs *ChatServer) SetBlocklist(words []string) {
+	var quoted []string
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	var blocklist *regexp.Regexp
+	if len(quoted) > 0 {
+		blocklist = regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	}
+
+	cs.mu.Lock()
+	cs.blocklist = blocklist
+	cs.mu.Unlock()
+}
+
+// filterProfanity masks the blocked words of a message and passes it on.
+func (cs *ChatServer) filterProfanity(msg Message, next chain.Next[Message]) error {
+	cs.mu.Lock()
+	blocklist := cs.blocklist
+	cs.mu.Unlock()
+
+	if blocklist != nil {
+		msg.Text = blocklist.ReplaceAllStringFunc(msg.Text, func(word string) string {
+			return strings.Repeat("*", len(word))
+		})
+	}
+	return next(msg)
+}
+
+// InboundHandler shows the inbound chain and the built-in processors as
+// JSON on GET. A POST with the parameter name adds a built-in processor to
+// the chain, and a DELETE removes a processor. Removing the profanity filter
+// or the rate limit changes what clients may send, so, as with
+// TopicAdminHandler, changes take the admin token:
+//
+//	curl -X DELETE -H 'Authorization: Bearer s3cret' 'localhost:8001/inbound?name=profanity'
+func (cs *ChatServer) InboundHandler() http.Handler {
+	return cs.requireAdmin(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		name := req.URL.Query().Get("name")
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			if err := cs.EnableProcessor(name); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodDelete:
+			if err := cs.DisableProcessor(name); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		available := make([]string, 0, len(processors))
+		for name := range processors {
+			available = append(available, name)
+		}
+		sort.Strings(available)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Chain     []chain.Link `json:"chain"`
+			Available []string     `json:"available"`
+		}{cs.inbound.Links(), available})
+	}))
+}
@@ -0,0 +1,166 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/compression"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/protocol"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/scheduler"
+)
+
+// defaultStatsInterval is how often the server publishes its stats unless
+// WithStatsInterval says otherwise.
+const defaultStatsInterval = time.Minute
+
+// statsTopic is where the server publishes its stats.
+const statsTopic = "server-stats"
+
+// ServerStats is the data of a server-stats event.
+type ServerStats struct {
+	Clients     int               `json:"clients"`
+	Rooms       int               `json:"rooms"`
+	History     HistoryStats      `json:"history"`
+	Compression compression.Stats `json:"compression"`
+	Time        time.Time         `json:"time"`
+}
+
+// schedule adds the server's periodic jobs to its scheduler. Each run is
+// announced on the bus with a tick event and reported with a job-completed
+// event.
+func (cs *ChatServer) schedule() error {
+	cs.mu.Lock()
+	idle, stats, compaction, rollup := cs.opts.idleTimeout, cs.opts.stats, cs.opts.compaction, cs.opts.usageRollup
+	cs.mu.Unlock()
+
+	if err := cs.scheduler.Every("purge-expired", purgeInterval, cs.purgeExpired); err != nil {
+		return err
+	}
+	if idle > 0 {
+		interval := idle / 4
+		if interval < 100*time.Millisecond {
+			interval = 100 * time.Millisecond
+		}
+		if err := cs.scheduler.Every("idle-sweep", interval, cs.sweepIdle); err != nil {
+			return err
+		}
+	}
+	if stats > 0 {
+		// Instances started together would otherwise report in lockstep.
+		jitter := scheduler.WithJitter(stats / 10)
+		if err := cs.scheduler.Every("publish-stats", stats, cs.publishStats, jitter); err != nil {
+			return err
+		}
+	}
+	if compaction > 0 {
+		if err := cs.scheduler.Every("compact-history", compaction, cs.compactHistory); err != nil {
+			return err
+		}
+	}
+	if cs.meter != nil && rollup > 0 {
+		if err := cs.scheduler.Every("usage-rollup", rollup, cs.rollupUsage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Jobs returns the stats of the server's scheduled jobs.
+func (cs *ChatServer) Jobs() []scheduler.JobStats {
+	return cs.scheduler.Jobs()
+}
+
+// seen records that an authenticated client sent something at t.
+func (cs *ChatServer) seen(conn Transportable, t time.Time) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if _, ok := cs.lastSeen[conn]; ok {
+		cs.lastSeen[conn] = t
+	}
+}
+
+// sweepIdle disconnects the authenticated clients that sent nothing for
+// the idle timeout.
+func (cs *ChatServer) sweepIdle(ctx context.Context) error {
+	cs.mu.Lock()
+	cutoff := time.Now().Add(-cs.opts.idleTimeout)
+	var idle []Transportable
+	for conn, t := range cs.lastSeen {
+		if t.Before(cutoff) {
+			idle = append(idle, conn)
+		}
+	}
+	cs.mu.Unlock()
+
+	for _, conn := range idle {
+		cs.send([]Transportable{conn}, protocol.Envelope{Type: protocol.TypeError, Body: errIdle.Error()})
+		cs.eventBus.Dispatch("disconnected", conn)
+	}
+	return nil
+}
+
+// compactHistory compacts the event store of the history. Instances that
+// share the store take turns through the election: only the leader
+// compacts, and the others skip the run.
+func (cs *ChatServer) compactHistory(ctx context.Context) error {
+	if !cs.IsLeader() {
+		return nil
+	}
+	cs.mu.Lock()
+	history := cs.history
+	cs.mu.Unlock()
+
+	kept, removed, err := history.Compact()
+	if err != nil || removed == 0 {
+		return err
+	}
+	cs.logger.Info("history compacted", "kept", kept, "removed", removed)
+	return nil
+}
+
+// publishStats publishes a server-stats event.
+func (cs *ChatServer) publishStats(ctx context.Context) error {
+	cs.mu.Lock()
+	stats := ServerStats{Clients: len(cs.nicks), Rooms: len(cs.rooms), Compression: cs.compression, Time: time.Now().UTC()}
+	history := cs.history
+	cs.mu.Unlock()
+
+	stats.History = history.Stats()
+	return cs.eventBus.Dispatch(statsTopic, stats)
+}
+
+func (cs *ChatServer) onServerStats(event eventbus.Event) error {
+	stats := event.Data.(ServerStats)
+	cs.logger.Info("server stats", "clients", stats.Clients, "rooms", stats.Rooms, "messages", stats.History.Messages)
+	return nil
+}
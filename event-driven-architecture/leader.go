@@ -0,0 +1,139 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/rajamummidi/go-design-patterns/leader-election/leaderelection"
+)
+
+// leaderKey is the Redis key instances elect their leader with.
+const leaderKey = "chat-leader"
+
+// newElector makes the server a candidate configured by config, logging
+// when it wins and loses the election.
+func (cs *ChatServer) newElector(config leaderelection.Config) error {
+	config.OnElected = func(ctx context.Context) {
+		cs.logger.Info("elected leader", "id", config.ID)
+	}
+	config.OnLost = func(err error) {
+		if err != nil {
+			cs.logger.Warn("lost leadership", "id", config.ID, "err", err)
+		} else {
+			cs.logger.Info("stepped down as leader", "id", config.ID)
+		}
+	}
+	config.OnError = func(err error) {
+		cs.logger.Warn("leader election", "id", config.ID, "err", err)
+	}
+	elector, err := leaderelection.New(config)
+	if err != nil {
+		return err
+	}
+	cs.elector = elector
+	return nil
+}
+
+// IsLeader reports whether the server is the leader of its instances. A
+// server without WithLeaderElection is always the leader.
+func (cs *ChatServer) IsLeader() bool {
+	return cs.elector == nil || cs.elector.IsLeader()
+}
+
+// campaign takes part in the election until resign.
+func (cs *ChatServer) campaign() {
+	if cs.elector == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	cs.mu.Lock()
+	cs.stopCampaign, cs.campaignDone = cancel, done
+	cs.mu.Unlock()
+
+	go func() {
+		done <- cs.elector.Run(ctx)
+	}()
+}
+
+// resign leaves the election and releases the lock if the server is the
+// leader, so another instance takes over without waiting for the lease to
+// expire.
+func (cs *ChatServer) resign(ctx context.Context) error {
+	cs.mu.Lock()
+	stop, done := cs.stopCampaign, cs.campaignDone
+	cs.mu.Unlock()
+
+	if stop == nil {
+		return nil
+	}
+	stop()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parseLock returns the lock named by -leader-lock: "memory", for a single
+// instance, "file:<path>" for instances on one host, or
+// "redis://[:password@]host:port" for instances anywhere.
+func parseLock(spec string) (leaderelection.Lock, error) {
+	switch {
+	case spec == "memory":
+		return new(leaderelection.MemoryLock), nil
+	case strings.HasPrefix(spec, "file:"):
+		return leaderelection.NewFileLock(strings.TrimPrefix(spec, "file:")), nil
+	case strings.HasPrefix(spec, "redis://"):
+		u, err := url.Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		lock := leaderelection.NewRedisLock(u.Host, leaderKey)
+		lock.Password, _ = u.User.Password()
+		return lock, nil
+	}
+	return nil, fmt.Errorf("unknown lock %q, want memory, file:<path> or redis://host:port", spec)
+}
+
+// defaultInstanceID names an instance after its host and process.
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "chat"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
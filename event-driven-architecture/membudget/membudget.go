@@ -0,0 +1,180 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package membudget shares a memory budget between the components of a
+// program that retain data in memory, such as histories and caches, so that
+// a long-running process does not grow until it runs out of memory.
+//
+// Each component reports the bytes it retains and provides an eviction
+// callback. When the total exceeds the budget, the components that use more
+// than their weighted share are asked to evict, biggest overshoot first.
+package membudget
+
+import (
+	"sort"
+	"sync"
+)
+
+// EvictFunc is asked to free at least need bytes, typically by dropping the
+// oldest entries, and returns how many bytes it freed. The budget subtracts
+// them itself, so the callback must not call Release for them.
+type EvictFunc func(need int64) (freed int64)
+
+// Budget is a memory limit shared by weighted components.
+type Budget struct {
+	limit int64
+
+	mu         sync.Mutex
+	used       int64
+	components []*Component
+}
+
+// Component is one user of a budget.
+type Component struct {
+	budget *Budget
+	name   string
+	weight float64
+	evict  EvictFunc
+	used   int64 // guarded by budget.mu
+}
+
+// New returns a budget of limit bytes. A limit of zero or less never evicts.
+func New(limit int64) *Budget {
+	return &Budget{limit: limit}
+}
+
+// Register adds a component. Its share of the budget is its weight divided
+// by the sum of all weights.
+func (b *Budget) Register(name string, weight float64, evict EvictFunc) *Component {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := &Component{budget: b, name: name, weight: weight, evict: evict}
+	b.components = append(b.components, c)
+	return c
+}
+
+// Usage returns the bytes retained by each component.
+func (b *Budget) Usage() map[string]int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	usage := make(map[string]int64, len(b.components))
+	for _, c := range b.components {
+		usage[c.name] += c.used
+	}
+	return usage
+}
+
+// Reserve records that the component now retains n more bytes and evicts
+// from the components over their share until the budget is met again. The
+// eviction callbacks run on the caller's goroutine, so the caller must not
+// hold a lock its own callback takes.
+func (c *Component) Reserve(n int64) {
+	b := c.budget
+	b.mu.Lock()
+	c.used += n
+	b.used += n
+	b.mu.Unlock()
+
+	b.enforce()
+}
+
+// Release records that the component no longer retains n bytes.
+func (c *Component) Release(n int64) {
+	b := c.budget
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c.used -= n
+	b.used -= n
+}
+
+// enforce evicts until the budget is met or no component can free more.
+func (b *Budget) enforce() {
+	if b.limit <= 0 {
+		return
+	}
+	for {
+		b.mu.Lock()
+		excess := b.used - b.limit
+		if excess <= 0 {
+			b.mu.Unlock()
+			return
+		}
+		victims := b.overShare()
+		b.mu.Unlock()
+
+		freedAny := false
+		for _, v := range victims {
+			need := v.over
+			if need > excess {
+				need = excess
+			}
+			freed := v.c.evict(need)
+			if freed <= 0 {
+				continue
+			}
+			freedAny = true
+			v.c.Release(freed)
+			if excess -= freed; excess <= 0 {
+				break
+			}
+		}
+		if !freedAny {
+			return
+		}
+	}
+}
+
+type victim struct {
+	c    *Component
+	over int64
+}
+
+// overShare returns the components that use more than their share of the
+// budget, biggest overshoot first. The caller must hold b.mu.
+func (b *Budget) overShare() []victim {
+	var total float64
+	for _, c := range b.components {
+		total += c.weight
+	}
+
+	var victims []victim
+	for _, c := range b.components {
+		share := int64(0)
+		if total > 0 {
+			share = int64(float64(b.limit) * c.weight / total)
+		}
+		if over := c.used - share; over > 0 && c.evict != nil {
+			victims = append(victims, victim{c: c, over: over})
+		}
+	}
+	sort.Slice(victims, func(i, j int) bool { return victims[i].over > victims[j].over })
+	return victims
+}
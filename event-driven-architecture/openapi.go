@@ -0,0 +1,333 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// object is a JSON object of the OpenAPI document. encoding/json writes
+// map keys sorted, so the document comes out the same every time.
+type object = map[string]interface{}
+
+func ref(schema string) object {
+	return object{"$ref": "#/components/schemas/" + schema}
+}
+
+func arrayOf(items object) object {
+	return object{"type": "array", "items": items}
+}
+
+func properties(props object, required ...string) object {
+	o := object{"type": "object", "properties": props}
+	if len(required) > 0 {
+		o["required"] = required
+	}
+	return o
+}
+
+var (
+	str     = object{"type": "string"}
+	integer = object{"type": "integer"}
+	number  = object{"type": "number"}
+	moment  = object{"type": "string", "format": "date-time"}
+	strs    = arrayOf(str)
+)
+
+func jsonResponse(description string, schema object) object {
+	return object{
+		"description": description,
+		"content":     object{"application/json": object{"schema": schema}},
+	}
+}
+
+func queryParam(name, description string) object {
+	return object{"name": name, "in": "query", "required": true, "description": description, "schema": str}
+}
+
+func optionalParam(name, description string, schema object) object {
+	return object{"name": name, "in": "query", "description": description, "schema": schema}
+}
+
+// openAPI describes the endpoints served on the admin address.
+func openAPI() object {
+	errorResponse := func(description string) object { return object{"description": description} }
+	topics := jsonResponse("The created topics, sorted by name.", arrayOf(ref("TopicInfo")))
+	adminToken := []object{{"adminToken": strs}}
+	unauthorized := errorResponse("The admin token is missing or wrong.")
+	strategies := jsonResponse("The current strategy and the available ones.", ref("BroadcastStrategies"))
+	inbound := jsonResponse("The inbound chain and the built-in processors.", ref("InboundChain"))
+	report := jsonResponse("Every check passed or is degraded.", ref("HealthReport"))
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "Chat server admin API",
+			"version":     "1.0.0",
+			"description": "Served on the address of the -metrics flag.",
+		},
+		"paths": object{
+			"/metrics": object{"get": object{
+				"summary": "Event bus metrics in the Prometheus text format.",
+				"responses": object{"200": object{
+					"description": "The metrics.",
+					"content":     object{"text/plain": object{"schema": str}},
+				}},
+			}},
+			"/debug/vars": object{"get": object{
+				"summary":   "Event bus, history, job and compression statistics for dashboards, with the Go runtime's memstats and cmdline.",
+				"responses": object{"200": jsonResponse("The published variables.", ref("Vars"))},
+			}},
+			"/topics": object{
+				"get": object{
+					"summary":   "List the created topics.",
+					"security":  adminToken,
+					"responses": object{"200": topics, "401": unauthorized},
+				},
+				"put": object{
+					"summary":     "Create a topic or update its config. Refused with 403 if the server has no admin token.",
+					"security":    adminToken,
+					"parameters":  []object{queryParam("name", "The topic.")},
+					"requestBody": object{"required": true, "content": object{"application/json": object{"schema": ref("TopicConfig")}}},
+					"responses": object{
+						"200": topics,
+						"400": errorResponse("The config is invalid."),
+						"401": unauthorized,
+						"403": errorResponse("The server has no admin token."),
+					},
+				},
+				"delete": object{
+					"summary":    "Delete a topic. Refused with 403 if the server has no admin token.",
+					"security":   adminToken,
+					"parameters": []object{queryParam("name", "The topic.")},
+					"responses": object{
+						"200": topics,
+						"401": unauthorized,
+						"403": errorResponse("The server has no admin token."),
+						"404": errorResponse("There is no such topic."),
+					},
+				},
+			},
+			"/broadcast": object{
+				"get": object{
+					"summary":   "Show the broadcast strategy.",
+					"security":  adminToken,
+					"responses": object{"200": strategies, "401": unauthorized},
+				},
+				"post": object{
+					"summary":    "Switch to another broadcast strategy. Refused with 403 if the server has no admin token.",
+					"security":   adminToken,
+					"parameters": []object{queryParam("strategy", "One of the available strategies.")},
+					"responses": object{
+						"200": strategies,
+						"400": errorResponse("There is no such strategy."),
+						"401": unauthorized,
+						"403": errorResponse("The server has no admin token."),
+					},
+				},
+			},
+			"/inbound": object{
+				"get": object{
+					"summary":   "Show the inbound message chain.",
+					"security":  adminToken,
+					"responses": object{"200": inbound, "401": unauthorized},
+				},
+				"post": object{
+					"summary":    "Add a built-in processor to the chain. Refused with 403 if the server has no admin token.",
+					"security":   adminToken,
+					"parameters": []object{queryParam("name", "The processor.")},
+					"responses": object{
+						"200": inbound,
+						"400": errorResponse("There is no such processor."),
+						"401": unauthorized,
+						"403": errorResponse("The server has no admin token."),
+					},
+				},
+				"delete": object{
+					"summary":    "Remove a processor from the chain. Refused with 403 if the server has no admin token.",
+					"security":   adminToken,
+					"parameters": []object{queryParam("name", "The processor.")},
+					"responses": object{
+						"200": inbound,
+						"401": unauthorized,
+						"403": errorResponse("The server has no admin token."),
+						"404": errorResponse("The processor is not in the chain."),
+					},
+				},
+			},
+			"/usage": object{"get": object{
+				"summary":  "Report the messages, bytes and events of the clients, rolled up per nickname and window.",
+				"security": adminToken,
+				"parameters": []object{
+					optionalParam("key", "The nickname; all clients if omitted.", str),
+					optionalParam("from", "The start of the range; open if omitted.", moment),
+					optionalParam("to", "The end of the range; open if omitted.", moment),
+				},
+				"responses": object{
+					"200": jsonResponse("The total and the rollups in the range, ending with the usage not rolled up yet.", ref("UsageReport")),
+					"400": errorResponse("A time is not in RFC 3339."),
+					"401": unauthorized,
+				},
+			}},
+			"/healthz": object{"get": object{
+				"summary":   "Liveness probe.",
+				"responses": object{"200": report, "503": jsonResponse("A check is down.", ref("HealthReport"))},
+			}},
+			"/readyz": object{"get": object{
+				"summary":   "Readiness probe, including the components of the server.",
+				"responses": object{"200": report, "503": jsonResponse("A check is down.", ref("HealthReport"))},
+			}},
+			"/drain": object{"post": object{
+				"summary":  "Drain the server and shut it down, as SIGTERM does. Refused with 403 if the server has no admin token.",
+				"security": adminToken,
+				"responses": object{
+					"202": object{"description": "The drain has started."},
+					"401": unauthorized,
+					"403": errorResponse("The server has no admin token."),
+				},
+			}},
+			"/openapi.json": object{"get": object{
+				"summary":   "This document.",
+				"responses": object{"200": jsonResponse("The OpenAPI document.", object{"type": "object"})},
+			}},
+		},
+		"components": object{
+			"securitySchemes": object{
+				"adminToken": object{"type": "http", "scheme": "bearer", "description": "The token of the -admin-token flag."},
+			},
+			"schemas": object{
+				"TopicInfo": properties(object{
+					"name":        str,
+					"config":      ref("TopicConfig"),
+					"subscribers": integer,
+					"retained":    integer,
+				}, "name", "config", "subscribers", "retained"),
+				"TopicConfig": properties(object{
+					"retention":       object{"type": "string", "example": "1h"},
+					"max_retained":    integer,
+					"ttl":             object{"type": "string", "example": "30s"},
+					"max_subscribers": integer,
+					"schema":          str,
+					"acl":             properties(object{"publishers": strs, "subscribers": strs}),
+				}),
+				"BroadcastStrategies": properties(object{"current": str, "available": strs}, "current", "available"),
+				"InboundChain": properties(object{
+					"chain":     arrayOf(properties(object{"name": str, "priority": integer}, "name", "priority")),
+					"available": strs,
+				}, "chain", "available"),
+				"Usage": properties(object{"messages": integer, "bytes": integer, "events": integer}, "messages", "bytes", "events"),
+				"UsageReport": properties(object{
+					"total": ref("Usage"),
+					"rollups": arrayOf(properties(object{
+						"key":   str,
+						"start": moment,
+						"end":   moment,
+						"usage": ref("Usage"),
+					}, "key", "start", "end", "usage")),
+				}, "total", "rollups"),
+				"HealthReport": properties(object{
+					"status": object{"type": "string", "enum": []string{"up", "degraded", "down"}},
+					"checks": arrayOf(properties(object{
+						"name":     str,
+						"status":   object{"type": "string", "enum": []string{"up", "degraded", "down"}},
+						"error":    str,
+						"duration": object{"type": "integer", "description": "Nanoseconds."},
+					}, "name", "status", "duration")),
+				}, "status", "checks"),
+				"Vars": properties(object{
+					"eventbus": ref("BusStats"),
+					"history":  properties(object{"rooms": integer, "messages": integer, "expired": integer}, "rooms", "messages", "expired"),
+					"compression": properties(object{
+						"messages":         integer,
+						"bytes_before":     integer,
+						"bytes_after":      integer,
+						"decompressed_in":  integer,
+						"decompressed_out": integer,
+						"ratio":            number,
+					}, "messages", "bytes_before", "bytes_after", "decompressed_in", "decompressed_out", "ratio"),
+					"jobs": arrayOf(properties(object{
+						"name":       str,
+						"runs":       integer,
+						"failures":   integer,
+						"skipped":    integer,
+						"running":    integer,
+						"last_run":   moment,
+						"last_error": str,
+						"next":       moment,
+					}, "name", "runs", "failures", "skipped", "running", "last_run", "next")),
+				}),
+				"BusStats": properties(object{
+					"topics": object{"type": "object", "additionalProperties": properties(object{
+						"published": integer,
+						"dropped":   integer,
+						"rejected":  integer,
+						"expired":   integer,
+						"handled":   integer,
+						"errored":   integer,
+						"latency": properties(object{
+							"counts": object{"type": "array", "items": integer, "description": "Per bucket of eventbus.LatencyBuckets, and one above the largest."},
+							"sum":    number,
+							"count":  integer,
+						}),
+					})},
+					"subscriptions": object{"type": "object", "additionalProperties": arrayOf(properties(object{
+						"id":        integer,
+						"priority":  integer,
+						"expires":   moment,
+						"remaining": integer,
+					}, "id", "priority"))},
+					"queue_depth":    integer,
+					"queue_capacity": integer,
+					"workers": properties(object{
+						"workers":   integer,
+						"busy":      integer,
+						"queued":    integer,
+						"completed": integer,
+						"failed":    integer,
+						"panicked":  integer,
+						"dropped":   integer,
+					}),
+				}, "topics", "subscriptions", "queue_depth", "queue_capacity"),
+			},
+		},
+	}
+}
+
+// OpenAPIHandler serves the OpenAPI document of the admin endpoints.
+func OpenAPIHandler() http.Handler {
+	doc, err := json.MarshalIndent(openAPI(), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	})
+}
@@ -0,0 +1,389 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/strategy"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/usage"
+	"github.com/rajamummidi/go-design-patterns/leader-election/leaderelection"
+)
+
+// defaultPort is where the chat server listens for TCP clients unless
+// WithPort says otherwise.
+const defaultPort = ":8000"
+
+// ServerOption configures a ChatServer. Options are applied in order and
+// checked together by NewChatServer, so options that contradict each other
+// are reported rather than one silently winning.
+type ServerOption func(*serverOptions)
+
+type serverOptions struct {
+	port         string
+	tlsConfig    *tls.Config
+	certFile     string
+	keyFile      string
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	idleTimeout  time.Duration
+	legacy       bool
+
+	history     *History
+	historySize *int
+	tokens      map[string]string
+	adminToken  string
+	rate        float64
+	burst       int
+	floodAction string
+	broadcast   string
+	messageTTL  time.Duration
+	blocklist   []string
+	stats       time.Duration
+	compaction  time.Duration
+	election    *leaderelection.Config
+	logHandler  slog.Handler
+	tracer      eventbus.Tracer
+	compression *compressionOptions
+	meter       *usage.Meter
+	usageRollup time.Duration
+	origins     []string
+}
+
+func defaultServerOptions() serverOptions {
+	return serverOptions{port: defaultPort, floodAction: floodDrop, broadcast: defaultBroadcast, stats: defaultStatsInterval}
+}
+
+// WithPort sets the address the server listens on for TCP clients, such as
+// ":8000" or "127.0.0.1:9000".
+func WithPort(port string) ServerOption {
+	return func(o *serverOptions) {
+		o.port = port
+	}
+}
+
+// WithHistorySize keeps the last n messages of each room in memory and
+// replays them to clients joining the room. Zero disables the history.
+func WithHistorySize(n int) ServerOption {
+	return func(o *serverOptions) {
+		o.historySize = &n
+	}
+}
+
+// WithHistory uses history as the message history, for example one backed
+// by an event store. It cannot be combined with WithHistorySize.
+func WithHistory(history *History) ServerOption {
+	return func(o *serverOptions) {
+		o.history = history
+	}
+}
+
+// WithTokens makes the given nicknames require a token; see SetTokens.
+func WithTokens(tokens map[string]string) ServerOption {
+	return func(o *serverOptions) {
+		o.tokens = tokens
+	}
+}
+
+// WithAdminToken makes the admin endpoints require token as a bearer token;
+// see TopicAdminHandler.
+func WithAdminToken(token string) ServerOption {
+	return func(o *serverOptions) {
+		o.adminToken = token
+	}
+}
+
+// WithRateLimit allows every connection rate messages per second with
+// bursts of up to burst messages, and applies action, floodDrop or
+// floodDisconnect, to messages over the limit; see SetRateLimit.
+func WithRateLimit(rate float64, burst int, action string) ServerOption {
+	return func(o *serverOptions) {
+		o.rate, o.burst, o.floodAction = rate, burst, action
+	}
+}
+
+// WithTLS serves clients over TLS with the certificate and key in the given
+// PEM files.
+func WithTLS(certFile, keyFile string) ServerOption {
+	return func(o *serverOptions) {
+		o.certFile, o.keyFile = certFile, keyFile
+	}
+}
+
+// WithTLSConfig serves clients over TLS with config, which must contain at
+// least one certificate or a GetCertificate callback.
+func WithTLSConfig(config *tls.Config) ServerOption {
+	return func(o *serverOptions) {
+		o.tlsConfig = config
+	}
+}
+
+// WithReadTimeout limits how long a new client may take to send its hello.
+func WithReadTimeout(d time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.readTimeout = d
+	}
+}
+
+// WithWriteTimeout limits how long a single write to a client may block. A
+// client that stops reading, or whose connection died without being closed,
+// is disconnected the next time something is sent to it.
+func WithWriteTimeout(d time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.writeTimeout = d
+	}
+}
+
+// WithIdleTimeout disconnects authenticated clients that send nothing for d.
+// A scheduled sweep looks for them, so they go up to a quarter of d later.
+func WithIdleTimeout(d time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.idleTimeout = d
+	}
+}
+
+// WithLegacyClients keeps clients of the original plain-text protocol
+// working on the TCP port. They are recognized by their first line, join
+// under a guest nickname and receive every envelope as a line of text.
+func WithLegacyClients() ServerOption {
+	return func(o *serverOptions) {
+		o.legacy = true
+	}
+}
+
+// WithBroadcastStrategy delivers room messages with the strategy registered
+// under name in the strategy package, such as "room", "all" or "sharded".
+func WithBroadcastStrategy(name string) ServerOption {
+	return func(o *serverOptions) {
+		o.broadcast = name
+	}
+}
+
+// WithMessageTTL expires chat messages d after they are sent. Messages that
+// ask for a shorter TTL keep it; longer ones are cut to d. Expired messages
+// are no longer delivered and are purged from the history.
+func WithMessageTTL(d time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.messageTTL = d
+	}
+}
+
+// WithBlocklist masks the given words in chat messages; see SetBlocklist.
+func WithBlocklist(words ...string) ServerOption {
+	return func(o *serverOptions) {
+		o.blocklist = append(o.blocklist, words...)
+	}
+}
+
+// WithStatsInterval publishes a server-stats event every d. Zero turns the
+// stats off.
+func WithStatsInterval(d time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.stats = d
+	}
+}
+
+// WithCompaction compacts the event store of the history every d: expired
+// messages and all but the messages replayed to joining clients are
+// dropped from it. Zero, the default, keeps every message. When several
+// instances share the store, combine it with WithLeaderElection so only
+// one of them compacts.
+func WithCompaction(d time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.compaction = d
+	}
+}
+
+// WithLeaderElection makes the server a candidate in an election held
+// over lock, under the unique name id, from Start until Stop. Jobs that
+// only one instance may run, such as compaction, run only while the server
+// is the leader.
+func WithLeaderElection(lock leaderelection.Lock, id string) ServerOption {
+	return func(o *serverOptions) {
+		o.election = &leaderelection.Config{Lock: lock, ID: id}
+	}
+}
+
+// WithLogHandler writes the server's log with h instead of a text handler
+// on stdout, such as a JSON handler for a log collector. Warnings and errors
+// are published on the bus as diagnostics events either way.
+func WithLogHandler(h slog.Handler) ServerOption {
+	return func(o *serverOptions) {
+		o.logHandler = h
+	}
+}
+
+// WithTracer traces the delivery of the server's events with t, such as an
+// *observability.Tracer. A chat message is traced from its arrival through
+// the inbound chain to its room.
+func WithTracer(t eventbus.Tracer) ServerOption {
+	return func(o *serverOptions) {
+		o.tracer = t
+	}
+}
+
+// WithCompression compresses the envelopes sent to clients that accept an
+// encoding in their hello, if their body has at least threshold bytes.
+// With rooms, only the envelopes of those rooms are compressed. Compressed
+// envelopes from clients are accepted either way.
+func WithCompression(threshold int, rooms ...string) ServerOption {
+	return func(o *serverOptions) {
+		o.compression = &compressionOptions{threshold: threshold, rooms: make(map[string]bool)}
+		for _, room := range rooms {
+			o.compression.rooms[room] = true
+		}
+	}
+}
+
+// WithAllowedOrigins lets pages from the given origins, such as
+// "https://chat.example.com", connect over WebSocket besides pages from the
+// server's own host. "*" allows every origin.
+func WithAllowedOrigins(origins ...string) ServerOption {
+	return func(o *serverOptions) {
+		o.origins = append(o.origins, origins...)
+	}
+}
+
+// WithUsage meters the messages, bytes and events of every client under its
+// nickname with meter, and refuses the messages of clients that used up the
+// meter's quota. The usage is rolled up into the meter's repository every
+// interval, and once more when the server stops.
+func WithUsage(meter *usage.Meter, interval time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.meter, o.usageRollup = meter, interval
+	}
+}
+
+// validate reports every option that is invalid on its own or in
+// combination with another.
+func (o *serverOptions) validate() error {
+	var errs []error
+	if o.port == "" {
+		errs = append(errs, errors.New("WithPort: empty address"))
+	}
+	if o.compression != nil && o.compression.threshold < 0 {
+		errs = append(errs, errors.New("WithCompression: negative threshold"))
+	}
+	if (o.certFile == "") != (o.keyFile == "") {
+		errs = append(errs, errors.New("WithTLS: both a certificate and a key are needed"))
+	}
+	if o.history != nil && o.historySize != nil {
+		errs = append(errs, errors.New("WithHistory and WithHistorySize cannot be combined"))
+	}
+	if o.historySize != nil && *o.historySize < 0 {
+		errs = append(errs, fmt.Errorf("WithHistorySize: negative size %d", *o.historySize))
+	}
+	timeouts := []struct {
+		option string
+		d      time.Duration
+	}{
+		{"WithReadTimeout", o.readTimeout},
+		{"WithWriteTimeout", o.writeTimeout},
+		{"WithIdleTimeout", o.idleTimeout},
+		{"WithMessageTTL", o.messageTTL},
+	}
+	for _, t := range timeouts {
+		if t.d < 0 {
+			errs = append(errs, fmt.Errorf("%s: negative timeout %s", t.option, t.d))
+		}
+	}
+	if o.stats < 0 {
+		errs = append(errs, fmt.Errorf("WithStatsInterval: negative interval %s", o.stats))
+	}
+	if o.usageRollup < 0 {
+		errs = append(errs, fmt.Errorf("WithUsage: negative interval %s", o.usageRollup))
+	}
+	if o.compaction < 0 {
+		errs = append(errs, fmt.Errorf("WithCompaction: negative interval %s", o.compaction))
+	}
+	if o.election != nil && (o.election.Lock == nil || o.election.ID == "") {
+		errs = append(errs, errors.New("WithLeaderElection: a lock and an ID are needed"))
+	}
+	if o.rate > 0 && o.burst < 1 {
+		errs = append(errs, fmt.Errorf("WithRateLimit: burst must be at least 1, not %d", o.burst))
+	}
+	if o.floodAction != floodDrop && o.floodAction != floodDisconnect {
+		errs = append(errs, fmt.Errorf("WithRateLimit: unknown flood action %q", o.floodAction))
+	}
+	if _, err := strategy.Lookup(o.broadcast); err != nil {
+		errs = append(errs, fmt.Errorf("WithBroadcastStrategy: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// serverTLSConfig returns the TLS configuration the options ask for, or nil for
+// plain TCP.
+func (o *serverOptions) serverTLSConfig() (*tls.Config, error) {
+	config := o.tlsConfig
+	if o.certFile == "" {
+		return config, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &tls.Config{MinVersion: tls.VersionTLS12}
+	} else {
+		config = config.Clone()
+	}
+	config.Certificates = append(config.Certificates, cert)
+	return config, nil
+}
+
+// deadliner is implemented by connections that support deadlines, which
+// both net.Conn and websocket.Conn do.
+type deadliner interface {
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// setDeadline sets the read or write deadline of conn to d from now, or
+// clears it if d is zero. Connections without deadlines are left alone.
+func setDeadline(conn Transportable, write bool, d time.Duration) {
+	dl, ok := conn.(deadliner)
+	if !ok {
+		return
+	}
+	var t time.Time
+	if d > 0 {
+		t = time.Now().Add(d)
+	}
+	if write {
+		dl.SetWriteDeadline(t)
+	} else {
+		dl.SetReadDeadline(t)
+	}
+}
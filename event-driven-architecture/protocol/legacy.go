@@ -0,0 +1,184 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// LegacyConn lets clients of the original protocol, which sent and received
+// plain text, talk to a server that speaks envelopes. It looks at the first
+// byte a client sends: a JSON envelope starts with '{', and anything else
+// is a legacy client. For a legacy client LegacyConn sends a hello with a
+// guest nickname on its behalf, turns every line it sends into a message
+// envelope, and writes the envelopes the server sends as lines of text.
+// Clients that send envelopes pass through untouched.
+type LegacyConn struct {
+	net.Conn
+	br   *bufio.Reader
+	nick string
+
+	detect  sync.Once
+	mu      sync.RWMutex
+	legacy  bool
+	pending []byte // translated envelopes not yet read
+}
+
+// NewLegacyConn wraps conn. nick is the nickname used in the hello sent for
+// a legacy client.
+func NewLegacyConn(conn net.Conn, nick string) *LegacyConn {
+	return &LegacyConn{Conn: conn, br: bufio.NewReader(conn), nick: nick}
+}
+
+// Legacy reports whether the client turned out to speak the old protocol.
+// It is false until the client has sent something.
+func (c *LegacyConn) Legacy() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.legacy
+}
+
+// Read returns the client's data as envelopes.
+func (c *LegacyConn) Read(p []byte) (int, error) {
+	var err error
+	c.detect.Do(func() { err = c.sniff() })
+	if err != nil {
+		return 0, err
+	}
+	if !c.Legacy() {
+		return c.br.Read(p)
+	}
+
+	for len(c.pending) == 0 {
+		line, err := c.readLine()
+		if err != nil {
+			return 0, err
+		}
+		if len(line) == 0 {
+			continue
+		}
+		if c.pending, err = Marshal(Envelope{Type: TypeMessage, Body: string(line)}); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// sniff decides which protocol the client speaks from the first byte that is
+// not whitespace, and queues the hello for a legacy client.
+func (c *LegacyConn) sniff() error {
+	b, err := c.br.Peek(1)
+	for err == nil && bytes.ContainsAny(b, " \t\r\n") {
+		c.br.Discard(1)
+		b, err = c.br.Peek(1)
+	}
+	if err != nil {
+		return err
+	}
+	if b[0] == '{' {
+		return nil
+	}
+
+	hello, err := Marshal(Envelope{Type: TypeHello, Sender: c.nick, Timestamp: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	c.pending = hello
+	c.mu.Lock()
+	c.legacy = true
+	c.mu.Unlock()
+	return nil
+}
+
+// readLine reads a line without its line ending, up to MaxEnvelopeSize.
+func (c *LegacyConn) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := c.br.ReadSlice('\n')
+		if len(line)+len(chunk) > MaxEnvelopeSize {
+			return nil, ErrTooLarge
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimRight(line, "\r\n"), nil
+	}
+}
+
+// Write takes envelopes, as written by Encoder, and sends them to a legacy
+// client as text.
+func (c *LegacyConn) Write(p []byte) (int, error) {
+	if !c.Legacy() {
+		return c.Conn.Write(p)
+	}
+
+	var out []byte
+	for _, line := range bytes.Split(p, []byte{'\n'}) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var env Envelope
+		if err := json.Unmarshal(line, &env); err != nil {
+			return 0, fmt.Errorf("protocol: translating for a legacy client: %w", err)
+		}
+		out = append(out, FormatLegacy(env)...)
+	}
+	if _, err := c.Conn.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// FormatLegacy renders env as the line the original protocol would have sent
+// for it.
+func FormatLegacy(env Envelope) string {
+	switch env.Type {
+	case TypeMessage, TypeHistory:
+		return fmt.Sprintf("[%s #%s] %s\n", env.Sender, env.Room, env.Body)
+	case TypeError:
+		return "Error: " + env.Body + "\n"
+	case TypeSystem:
+		if env.Room != "" {
+			return "* " + env.Body + "\n"
+		}
+	}
+	return env.Body + "\n"
+}
@@ -0,0 +1,203 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package protocol defines the chat wire protocol: a stream of JSON
+// envelopes, one per line. Raw reads from a socket split and merge messages
+// arbitrarily; the envelope gives every message a boundary, a type and the
+// metadata a client needs to display it.
+package protocol
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/compression"
+)
+
+// MaxEnvelopeSize bounds the encoded size of a single envelope.
+const MaxEnvelopeSize = 64 * 1024
+
+// Envelope types.
+const (
+	// TypeHello must be the first envelope a client sends. Its sender is the
+	// nickname the client wants and its body an optional token.
+	TypeHello = "hello"
+	// TypeMessage is a chat message. Clients send them with just a body,
+	// which may also hold a command such as "JOIN go"; the server fills in
+	// the sender, room and timestamp before relaying them.
+	TypeMessage = "message"
+	// TypeHistory is an earlier message of a room, replayed to a client
+	// when it joins the room.
+	TypeHistory = "history"
+	// TypeSystem is a notice from the server to a single client or a room.
+	TypeSystem = "system"
+	// TypeError tells a client why the server is about to close its
+	// connection.
+	TypeError = "error"
+)
+
+// ErrTooLarge is returned by Decode when an envelope exceeds MaxEnvelopeSize.
+var ErrTooLarge = errors.New("protocol: envelope too large")
+
+type Envelope struct {
+	Type      string    `json:"type"`
+	Sender    string    `json:"sender,omitempty"`
+	Room      string    `json:"room,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Body      string    `json:"body"`
+	// TTL is how many seconds a message stays worth delivering. A client
+	// sets it on the messages it sends; on the messages and history the
+	// server relays it is the time the message has left. Zero means the
+	// message does not expire.
+	TTL int `json:"ttl,omitempty"`
+	// Encoding is, in a hello, the comma-separated body encodings the
+	// client accepts, such as "gzip". On any other envelope it names the
+	// encoding of the body, which is then base64 so the envelope stays
+	// JSON; see Compress.
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Compress returns env with its body compressed with encoding. Only
+// envelopes sent to a client that offered the encoding in its hello may be
+// compressed.
+func Compress(env Envelope, encoding string) (Envelope, error) {
+	data, err := compression.Compress(encoding, []byte(env.Body))
+	if err != nil {
+		return Envelope{}, err
+	}
+	env.Body = base64.StdEncoding.EncodeToString(data)
+	env.Encoding = encoding
+	return env, nil
+}
+
+// Decompress returns env with its body decompressed, if it has an
+// encoding. A body that expands past MaxEnvelopeSize fails with
+// ErrTooLarge, as an envelope of that size would have.
+func Decompress(env Envelope) (Envelope, error) {
+	if env.Encoding == "" || env.Type == TypeHello {
+		return env, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(env.Body)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("protocol: %s body: %w", env.Encoding, err)
+	}
+	body, err := compression.Decompress(env.Encoding, data, MaxEnvelopeSize)
+	if errors.Is(err, compression.ErrTooLarge) {
+		return Envelope{}, ErrTooLarge
+	}
+	if err != nil {
+		return Envelope{}, fmt.Errorf("protocol: %w", err)
+	}
+	env.Body = string(body)
+	env.Encoding = ""
+	return env, nil
+}
+
+// Marshal encodes env as a single newline-terminated line. JSON escapes
+// newlines inside strings, so the line break only ever ends an envelope.
+func Marshal(env Envelope) ([]byte, error) {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Encoder writes envelopes to a stream.
+type Encoder struct {
+	w io.Writer
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes env in a single Write call, so envelopes encoded
+// concurrently on a connection do not interleave.
+func (e *Encoder) Encode(env Envelope) error {
+	data, err := Marshal(env)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+// Decoder reads envelopes from a stream. It accepts any whitespace between
+// envelopes, so clients on message-oriented transports such as WebSocket do
+// not have to send the trailing newline.
+type Decoder struct {
+	r   *countingReader
+	dec *json.Decoder
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	cr := &countingReader{r: r}
+	return &Decoder{r: cr, dec: json.NewDecoder(cr)}
+}
+
+// Decode reads the next envelope. A malformed envelope leaves the stream in
+// an unknown state, so callers should close the connection on any error.
+func (d *Decoder) Decode() (Envelope, error) {
+	d.r.n = 0
+	var env Envelope
+	if err := d.dec.Decode(&env); err != nil {
+		if errors.Is(err, errTooLarge) {
+			return Envelope{}, ErrTooLarge
+		}
+		if err == io.EOF {
+			return Envelope{}, err
+		}
+		return Envelope{}, fmt.Errorf("protocol: %w", err)
+	}
+	return env, nil
+}
+
+var errTooLarge = errors.New("read limit exceeded")
+
+// countingReader fails once more than MaxEnvelopeSize bytes have been read
+// for one envelope. The JSON decoder reads ahead, so the bound is
+// approximate, but it keeps a client from making the server buffer an
+// endless value.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	if c.n > 2*MaxEnvelopeSize {
+		return 0, errTooLarge
+	}
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
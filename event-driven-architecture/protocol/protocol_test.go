@@ -0,0 +1,156 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/compression"
+	"github.com/rajamummidi/go-design-patterns/golden/golden"
+)
+
+// envelopes has an envelope of every type with every field the server
+// fills in for it.
+func envelopes() []Envelope {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return []Envelope{
+		{Type: TypeHello, Sender: "alice", Timestamp: at, Body: "secret-token", Encoding: "gzip"},
+		{Type: TypeSystem, Timestamp: at, Body: "Welcome, alice!"},
+		{Type: TypeSystem, Room: "lobby", Timestamp: at, Body: "bob joined lobby"},
+		{Type: TypeMessage, Sender: "alice", Room: "lobby", Timestamp: at, Body: "hi \"bob\"\nhow are you?"},
+		{Type: TypeMessage, Sender: "bob", Room: "go", Timestamp: at, Body: "gone in a minute", TTL: 60},
+		{Type: TypeHistory, Sender: "carol", Room: "go", Timestamp: at.Add(-time.Hour), Body: "earlier"},
+		{Type: TypeError, Timestamp: at, Body: "nickname alice is taken"},
+	}
+}
+
+// TestFrames locks down the bytes of every envelope type on the wire.
+func TestFrames(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for _, env := range envelopes() {
+		if err := enc.Encode(env); err != nil {
+			t.Fatal(err)
+		}
+	}
+	golden.Assert(t, "frames", buf.Bytes())
+
+	dec := NewDecoder(&buf)
+	for _, want := range envelopes() {
+		got, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("decoded %+v, want %+v", got, want)
+		}
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Errorf("got %v after the last envelope, want EOF", err)
+	}
+}
+
+// TestLegacyFrames locks down the text a legacy client receives for every
+// envelope type, and the envelopes its lines turn into.
+func TestLegacyFrames(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := NewLegacyConn(server, "guest-1")
+	defer conn.Close()
+
+	go client.Write([]byte("hello everyone\n\nJOIN go\n"))
+	dec := NewDecoder(conn)
+	var in []Envelope
+	for i := 0; i < 3; i++ {
+		env, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		env.Timestamp = time.Time{}
+		in = append(in, env)
+	}
+	golden.AssertJSON(t, "legacy-in", in)
+
+	var frames bytes.Buffer
+	for _, env := range envelopes() {
+		data, err := Marshal(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames.Write(data)
+	}
+	out := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(client)
+		out <- data
+	}()
+	if _, err := conn.Write(frames.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	golden.Assert(t, "legacy-out", <-out)
+}
+
+// TestCompress checks that a compressed envelope stays one line, decodes
+// to the original, and is refused if its body expands past the limit.
+func TestCompress(t *testing.T) {
+	want := Envelope{Type: TypeHistory, Sender: "carol", Room: "go", Body: strings.Repeat("line\n", 500)}
+	env, err := Compress(want, compression.Gzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Count(data, []byte("\n")) != 1 || len(data) >= len(want.Body) {
+		t.Errorf("compressed envelope is %d bytes: %s", len(data), data)
+	}
+	got, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err = Decompress(got); err != nil || got != want {
+		t.Errorf("got %+v, %v", got, err)
+	}
+
+	bomb, err := Compress(Envelope{Type: TypeMessage, Body: strings.Repeat("x", MaxEnvelopeSize+1)}, compression.Gzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decompress(bomb); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("oversized body: got %v, want ErrTooLarge", err)
+	}
+}
@@ -0,0 +1,231 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/chain"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/protocol"
+)
+
+// lobby is the room every client joins when it connects.
+const lobby = "lobby"
+
+// Room names become a segment of the room topics, so they may not contain
+// dots or wildcards.
+var roomName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// RoomMessage is the data of a room.<name>.message event.
+type RoomMessage struct {
+	Room string
+	From Transportable
+	Nick string
+	Text string `redact:"mask"`
+	Time time.Time
+	// Expires is when the message stops being delivered and is purged
+	// from the history, if it has a TTL.
+	Expires time.Time
+}
+
+// RoomChange is the data of the room.<name>.joined and room.<name>.left
+// events.
+type RoomChange struct {
+	Room string
+	Conn Transportable
+	Nick string
+}
+
+// roomTopic returns the topic of a room event, for example
+// room.lobby.message. Passing "*" as the room gives the pattern matching
+// that event in every room.
+func roomTopic(room, event string) string {
+	return "room." + room + "." + event
+}
+
+// onRoomCommand handles the JOIN <room>, LEAVE <room> and /who commands,
+// and their slash forms /join and /leave. Plain messages are passed on to
+// the broadcast.
+func (cs *ChatServer) onRoomCommand(msg Message, next chain.Next[Message]) error {
+	command, room, _ := strings.Cut(strings.TrimSpace(msg.Text), " ")
+	room = strings.TrimSpace(room)
+
+	switch strings.ToUpper(command) {
+	case "JOIN", "/JOIN":
+		if !roomName.MatchString(room) {
+			cs.notify(msg.From, "Usage: JOIN <room>, where room is letters, digits, - or _.")
+		} else {
+			cs.join(msg.From, room)
+		}
+	case "LEAVE", "/LEAVE":
+		if !cs.leave(msg.From, room) {
+			cs.notify(msg.From, "You are not in #%s.", room)
+		}
+	case "/WHO":
+		cs.notify(msg.From, "Online: %s", strings.Join(cs.who(), ", "))
+	default:
+		if strings.HasPrefix(command, "/") {
+			cs.notify(msg.From, "Unknown command %s. Commands: JOIN <room>, LEAVE <room>, /who.", command)
+			return nil
+		}
+		return next(msg)
+	}
+	return nil
+}
+
+// onRoomMessage delivers a message to the members of its room except the
+// sender.
+func (cs *ChatServer) onRoomMessage(event eventbus.Event) error {
+	msg := event.Data.(RoomMessage)
+	cs.broadcast(msg.Room, msg.From, protocol.Envelope{
+		Type:      protocol.TypeMessage,
+		Sender:    msg.Nick,
+		Room:      msg.Room,
+		Timestamp: msg.Time,
+		Body:      msg.Text,
+		TTL:       ttlLeft(msg.Expires, time.Now()),
+	})
+	return nil
+}
+
+// onRoomChange tells the members of a room that someone joined or left.
+func (cs *ChatServer) onRoomChange(event eventbus.Event) error {
+	change := event.Data.(RoomChange)
+	verb := "joined"
+	if strings.HasSuffix(event.Type, ".left") {
+		verb = "left"
+	}
+	cs.send(cs.members(change.Room, change.Conn), protocol.Envelope{
+		Type: protocol.TypeSystem,
+		Room: change.Room,
+		Body: fmt.Sprintf("%s %s #%s", change.Nick, verb, change.Room),
+	})
+	return nil
+}
+
+// join adds conn to room, making it the room its messages go to.
+func (cs *ChatServer) join(conn Transportable, room string) {
+	cs.mu.Lock()
+	nick := cs.clients[conn]
+	if cs.rooms[room] == nil {
+		cs.rooms[room] = make(map[Transportable]bool)
+	}
+	alreadyJoined := cs.rooms[room][conn]
+	cs.rooms[room][conn] = true
+	cs.joined[conn] = append(removeRoom(cs.joined[conn], room), room)
+	cs.mu.Unlock()
+
+	cs.notify(conn, "You are now talking in #%s.", room)
+	if !alreadyJoined {
+		cs.eventBus.Dispatch(roomTopic(room, "joined"), RoomChange{Room: room, Conn: conn, Nick: nick})
+	}
+}
+
+// leave removes conn from room. Its messages then go to the room it joined
+// before that one.
+func (cs *ChatServer) leave(conn Transportable, room string) bool {
+	cs.mu.Lock()
+	if !cs.rooms[room][conn] {
+		cs.mu.Unlock()
+		return false
+	}
+	nick := cs.clients[conn]
+	cs.removeMember(room, conn)
+	cs.joined[conn] = removeRoom(cs.joined[conn], room)
+	cs.mu.Unlock()
+
+	cs.eventBus.Dispatch(roomTopic(room, "left"), RoomChange{Room: room, Conn: conn, Nick: nick})
+	if current, ok := cs.currentRoom(conn); ok {
+		cs.notify(conn, "You left #%s and are now talking in #%s.", room, current)
+	} else {
+		cs.notify(conn, "You left #%s.", room)
+	}
+	return true
+}
+
+// leaveAll removes conn from every room and returns the rooms it was in.
+func (cs *ChatServer) leaveAll(conn Transportable) []string {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	rooms := cs.joined[conn]
+	for _, room := range rooms {
+		cs.removeMember(room, conn)
+	}
+	delete(cs.joined, conn)
+	return rooms
+}
+
+// removeMember deletes conn from room and drops the room once it is empty.
+// The caller must hold cs.mu.
+func (cs *ChatServer) removeMember(room string, conn Transportable) {
+	delete(cs.rooms[room], conn)
+	if len(cs.rooms[room]) == 0 {
+		delete(cs.rooms, room)
+	}
+}
+
+func (cs *ChatServer) currentRoom(conn Transportable) (string, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	rooms := cs.joined[conn]
+	if len(rooms) == 0 {
+		return "", false
+	}
+	return rooms[len(rooms)-1], true
+}
+
+// members returns the connections in room other than except.
+func (cs *ChatServer) members(room string, except Transportable) []Transportable {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	conns := make([]Transportable, 0, len(cs.rooms[room]))
+	for conn := range cs.rooms[room] {
+		if conn != except {
+			conns = append(conns, conn)
+		}
+	}
+	return conns
+}
+
+func removeRoom(rooms []string, room string) []string {
+	kept := rooms[:0]
+	for _, r := range rooms {
+		if r != room {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
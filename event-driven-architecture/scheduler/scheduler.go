@@ -0,0 +1,363 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package scheduler runs jobs periodically, on a fixed interval or on a
+// cron schedule. Runs can be spread out with jitter, a job that is still
+// running when it is due again is skipped rather than started twice, and
+// Stop waits for the running jobs to finish. Every run is announced on a
+// bus with a tick event and reported with a job-completed event, so time
+// driven work is as visible as everything else that goes through the bus.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/cron"
+)
+
+// Event types published by a scheduler.
+const (
+	TickTopic         = "tick"
+	JobCompletedTopic = "job-completed"
+)
+
+var (
+	// ErrDuplicate is returned for a job name that is already taken.
+	ErrDuplicate = errors.New("scheduler: job already exists")
+	// ErrStopped is returned for jobs added after Stop.
+	ErrStopped = errors.New("scheduler: stopped")
+)
+
+// Publisher is the part of the EventBus the scheduler needs.
+type Publisher interface {
+	Dispatch(eventType string, data interface{}) error
+}
+
+// Job is the work of a scheduled job. Its context is canceled when the
+// job's timeout passes, or when Stop gives up waiting for it.
+type Job func(ctx context.Context) error
+
+// Trigger decides when a job runs next. A *cron.Schedule is a Trigger.
+type Trigger interface {
+	// Next returns the first run time after t, or the zero time if the job
+	// should not run again.
+	Next(t time.Time) time.Time
+}
+
+// interval is the Trigger of Every.
+type interval time.Duration
+
+func (i interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// Tick is the data of a tick event, published when a job is due.
+type Tick struct {
+	Job       string    `json:"job"`
+	Scheduled time.Time `json:"scheduled"`
+	// Skipped is set when the job was still running from its last tick,
+	// so this one did not start it again.
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// JobCompleted is the data of a job-completed event.
+type JobCompleted struct {
+	Job      string        `json:"job"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// JobOption configures a job.
+type JobOption func(*job)
+
+// WithJitter delays every run of the job by a random duration of up to d,
+// so jobs due at the same time, on one instance or on many, do not all
+// start at once.
+func WithJitter(d time.Duration) JobOption {
+	return func(j *job) {
+		j.jitter = d
+	}
+}
+
+// WithTimeout cancels the context of a run after d.
+func WithTimeout(d time.Duration) JobOption {
+	return func(j *job) {
+		j.timeout = d
+	}
+}
+
+// AllowOverlap starts the job when it is due even if its last run has not
+// finished. By default such a tick is skipped.
+func AllowOverlap() JobOption {
+	return func(j *job) {
+		j.overlap = true
+	}
+}
+
+// JobStats describes a job.
+type JobStats struct {
+	Name     string    `json:"name"`
+	Runs     uint64    `json:"runs"`
+	Failures uint64    `json:"failures"`
+	Skipped  uint64    `json:"skipped"`
+	Running  int       `json:"running"`
+	LastRun  time.Time `json:"last_run"`
+	LastErr  string    `json:"last_error,omitempty"`
+	Next     time.Time `json:"next"`
+}
+
+type job struct {
+	name    string
+	trigger Trigger
+	run     Job
+	jitter  time.Duration
+	timeout time.Duration
+	overlap bool
+
+	// Guarded by the scheduler's mutex.
+	stats JobStats
+}
+
+// Scheduler runs jobs until it is stopped. It is safe for concurrent use.
+type Scheduler struct {
+	bus Publisher
+
+	ctx    context.Context // canceled by Stop, ends the job loops
+	cancel context.CancelFunc
+	runCtx context.Context // canceled when Stop gives up on running jobs
+	abort  context.CancelFunc
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	stopped bool
+	loops   sync.WaitGroup
+	runs    sync.WaitGroup
+}
+
+// New returns a scheduler that publishes its events on bus, which may be
+// nil. Jobs start running as soon as they are added.
+func New(bus Publisher) *Scheduler {
+	s := &Scheduler{bus: bus, jobs: make(map[string]*job)}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.runCtx, s.abort = context.WithCancel(context.Background())
+	return s
+}
+
+// Every runs fn every d, the first time d from now.
+func (s *Scheduler) Every(name string, d time.Duration, fn Job, opts ...JobOption) error {
+	if d <= 0 {
+		return fmt.Errorf("scheduler: job %s: interval must be positive, not %s", name, d)
+	}
+	return s.Add(name, interval(d), fn, opts...)
+}
+
+// Cron runs fn whenever the five-field cron expression expr matches.
+func (s *Scheduler) Cron(name, expr string, fn Job, opts ...JobOption) error {
+	schedule, err := cron.Parse(expr)
+	if err != nil {
+		return fmt.Errorf("scheduler: job %s: %w", name, err)
+	}
+	return s.Add(name, schedule, fn, opts...)
+}
+
+// Add runs fn whenever trigger says so.
+func (s *Scheduler) Add(name string, trigger Trigger, fn Job, opts ...JobOption) error {
+	j := &job{name: name, trigger: trigger, run: fn}
+	for _, opt := range opts {
+		opt(j)
+	}
+	j.stats.Name = name
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return ErrStopped
+	}
+	if _, ok := s.jobs[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicate, name)
+	}
+	s.jobs[name] = j
+	s.loops.Add(1)
+	go s.loop(j)
+	return nil
+}
+
+// Remove stops scheduling the job called name. A run in progress is not
+// interrupted.
+func (s *Scheduler) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.jobs, name)
+}
+
+// Jobs returns the stats of every job, sorted by name.
+func (s *Scheduler) Jobs() []JobStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make([]JobStats, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		stats = append(stats, j.stats)
+	}
+	sort.Slice(stats, func(i, k int) bool { return stats[i].Name < stats[k].Name })
+	return stats
+}
+
+// Stop stops scheduling new runs and waits for the running ones to finish.
+// If ctx is done first, it cancels their contexts and returns ctx's error
+// without waiting any longer.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+
+	s.cancel()
+	s.loops.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		s.runs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.abort()
+		return ctx.Err()
+	}
+}
+
+// loop waits for the job's ticks until the scheduler stops or the job is
+// removed.
+func (s *Scheduler) loop(j *job) {
+	defer s.loops.Done()
+
+	for {
+		next := j.trigger.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		if !s.update(j, func(stats *JobStats) { stats.Next = next }) {
+			return
+		}
+
+		wait := time.Until(next)
+		if j.jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(j.jitter)))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.tick(j, next)
+	}
+}
+
+// tick starts a run of j, unless the last one is still going.
+func (s *Scheduler) tick(j *job, scheduled time.Time) {
+	start := true
+	if !s.update(j, func(stats *JobStats) {
+		if stats.Running > 0 && !j.overlap {
+			stats.Skipped++
+			start = false
+			return
+		}
+		stats.Running++
+	}) {
+		return
+	}
+	s.publish(TickTopic, Tick{Job: j.name, Scheduled: scheduled, Skipped: !start})
+	if !start {
+		return
+	}
+
+	s.runs.Add(1)
+	go func() {
+		defer s.runs.Done()
+
+		ctx := s.runCtx
+		if j.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, j.timeout)
+			defer cancel()
+		}
+		started := time.Now()
+		err := j.run(ctx)
+		completed := JobCompleted{Job: j.name, Started: started, Duration: time.Since(started)}
+		if err != nil {
+			completed.Error = err.Error()
+		}
+
+		s.mu.Lock()
+		j.stats.Running--
+		j.stats.Runs++
+		j.stats.LastRun = started
+		j.stats.LastErr = completed.Error
+		if err != nil {
+			j.stats.Failures++
+		}
+		s.mu.Unlock()
+		s.publish(JobCompletedTopic, completed)
+	}()
+}
+
+// update applies fn to the stats of j under the lock, and reports whether
+// j is still scheduled.
+func (s *Scheduler) update(j *job, fn func(*JobStats)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.jobs[j.name] != j {
+		return false
+	}
+	fn(&j.stats)
+	return true
+}
+
+func (s *Scheduler) publish(eventType string, data interface{}) {
+	if s.bus == nil {
+		return
+	}
+	if err := s.bus.Dispatch(eventType, data); err != nil {
+		fmt.Printf("Error publishing %s event: %v\n", eventType, err)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/config/config"
+)
+
+// settings are what the chat server can be configured with. Load reads them
+// from their defaults, a file given with -config, variables prefixed with
+// CHAT_ and flags, in that order. Nested settings are named after their
+// group: Log.Events is "log-events" as a flag, "events" under "log" in a
+// file and CHAT_LOG_EVENTS in the environment.
+type settings struct {
+	Port       string        `usage:"address to serve TCP clients on" validate:"required"`
+	Metrics    string        `usage:"admin address serving /debug/vars, /metrics, /topics, /broadcast, /inbound, /usage, /drain, /healthz, /readyz and /openapi.json, e.g. :8001"`
+	WS         string        `usage:"address to serve WebSocket clients on at /chat, e.g. :8080"`
+	WSOrigins  []string      `usage:"comma-separated origins whose pages may connect to -ws besides the server's own, e.g. https://chat.example.com, or * for any"`
+	Schedule   string        `usage:"JSON file with cron entries to publish on the bus"`
+	Tokens     string        `usage:"JSON file mapping nicknames to the tokens they must present"`
+	AdminToken string        `usage:"bearer token required by /topics, /broadcast, /inbound, /usage and /drain; without one, topics, the broadcast strategy and the inbound chain can be listed but not changed and the server cannot be drained over HTTP"`
+	Legacy     bool          `default:"true" usage:"accept clients of the original plain-text protocol on the TCP port"`
+	Broadcast  string        `usage:"how room messages are delivered: room, all or sharded"`
+	Alerts     string        `usage:"room to post the warnings and errors the server logs to, e.g. ops"`
+	Blocklist  []string      `usage:"comma-separated words to mask in chat messages"`
+	MessageTTL time.Duration `default:"0s" usage:"expire chat messages after this long, and cap the TTL clients ask for; 0 lets messages live forever" validate:"min=0s"`
+	Compress   struct {
+		Threshold int      `default:"0" usage:"gzip envelope bodies of at least this many bytes for clients that accept it, 0 to disable" validate:"min=0"`
+		Rooms     []string `usage:"comma-separated rooms to compress with -compress-threshold; empty means all"`
+	}
+
+	History      int    `usage:"how many messages per room to replay to joining clients, 0 to disable" validate:"min=0"`
+	HistoryFile  string `usage:"event log to persist room history in, e.g. history.jsonl"`
+	HistoryKey   string `usage:"ID of the key to encrypt the history log with, read from $EVENTSTORE_KEY_<ID>"`
+	MemoryBudget int64  `usage:"bytes of message history and retained topic events to keep in memory, 0 for no limit" validate:"min=0"`
+
+	Rate  float64 `default:"5" usage:"messages per second each client may send, 0 for no limit" validate:"min=0"`
+	Burst int     `default:"10" usage:"messages a client may send at once before -rate applies" validate:"min=1"`
+	Flood string  `usage:"what to do with clients over the limit: drop their messages or disconnect them" validate:"oneof=drop|disconnect"`
+	Usage struct {
+		File     string        `usage:"file to persist the usage of each client in, e.g. usage.jsonl; without one, the last -usage-period is kept in memory"`
+		Rollup   time.Duration `default:"1m" usage:"how often to roll up the usage of each client" validate:"min=1s"`
+		Messages int64         `usage:"chat messages each client may send per -usage-period, 0 for no limit" validate:"min=0"`
+		Bytes    int64         `usage:"bytes of chat messages each client may send per -usage-period, 0 for no limit" validate:"min=0"`
+		Events   int64         `usage:"messages and commands each client may send per -usage-period, 0 for no limit" validate:"min=0"`
+		Period   time.Duration `default:"24h" usage:"how long the quotas of -usage-messages, -usage-bytes and -usage-events last" validate:"min=1s"`
+	}
+
+	TLS struct {
+		Cert string `usage:"PEM certificate to serve TCP and WebSocket clients over TLS"`
+		Key  string `usage:"PEM private key for -tls-cert"`
+	}
+	ReadTimeout  time.Duration `default:"30s" usage:"how long a new client may take to send its hello" validate:"min=0s"`
+	WriteTimeout time.Duration `default:"10s" usage:"how long a write to a client may block before it is disconnected" validate:"min=0s"`
+	IdleTimeout  time.Duration `default:"0s" usage:"disconnect clients that send nothing for this long, 0 to keep them" validate:"min=0s"`
+	DrainTimeout time.Duration `default:"30s" usage:"how long to wait for clients to leave when draining" validate:"min=0s"`
+	StopTimeout  time.Duration `default:"5s" usage:"how long each part of the server may take to stop once the clients have left" validate:"min=1ms"`
+
+	Log struct {
+		Format     string   `default:"text" usage:"format of the log: text or json" validate:"oneof=text|json"`
+		Events     bool     `usage:"log every event on the bus, with sensitive fields redacted"`
+		Sample     int      `default:"1" usage:"log only one in every n events of a type once -log-burst is exceeded" validate:"min=1"`
+		Burst      int      `default:"100" usage:"events of each type logged per second before -log-sample applies" validate:"min=0"`
+		Unredacted []string `usage:"comma-separated event types or patterns to log without redaction"`
+	}
+	Traces       string        `usage:"where to send traces of bus events: off, log, or otlp for the -otlp collector" validate:"oneof=off|log|otlp"`
+	OTLP         string        `usage:"OpenTelemetry collector to export bus metrics to over OTLP/HTTP, e.g. http://localhost:4318"`
+	OTLPInterval time.Duration `default:"15s" usage:"how often to export metrics to -otlp" validate:"min=1s"`
+	SlowHandler  struct {
+		Budget time.Duration `default:"0s" usage:"report event handlers that run longer than this, e.g. 50ms" validate:"min=0s"`
+		Period time.Duration `default:"1m" usage:"how often to report slow handlers" validate:"min=1s"`
+	}
+
+	StatsInterval   time.Duration `usage:"how often to publish and log server stats, 0 to disable" validate:"min=0s"`
+	CompactInterval time.Duration `default:"0s" usage:"how often to drop expired and no longer replayed messages from -history-file, 0 to keep them" validate:"min=0s"`
+	LeaderLock      string        `usage:"lock to elect the instance that compacts a shared -history-file: memory, file:<path> or redis://host:port"`
+	InstanceID      string        `usage:"name of this instance in the -leader-lock election"`
+}
+
+// loadSettings loads the settings of the command line. The defaults that
+// other parts of the server share are set here rather than in tags.
+func loadSettings() (settings, error) {
+	s := settings{
+		Port:          defaultPort,
+		Broadcast:     defaultBroadcast,
+		Flood:         floodDrop,
+		History:       defaultHistorySize,
+		Traces:        tracesOff,
+		StatsInterval: defaultStatsInterval,
+		InstanceID:    defaultInstanceID(),
+	}
+	err := config.Load(&s, config.Options{EnvPrefix: "CHAT"})
+	return s, err
+}
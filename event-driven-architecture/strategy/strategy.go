@@ -0,0 +1,207 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package strategy holds the broadcast strategies of the chat server: how
+// a message reaches its recipients. The server depends only on the
+// Strategy interface and picks an implementation by name from a registry,
+// so strategies can be swapped while it runs, and other packages can add
+// their own by calling Register in an init function, the way database/sql
+// drivers do.
+package strategy
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrUnknown is returned by Lookup for a name that was not registered.
+var ErrUnknown = errors.New("strategy: unknown broadcast strategy")
+
+// Conn is a recipient of broadcasts.
+type Conn interface {
+	Write(p []byte) (int, error)
+}
+
+// Message is an encoded message to broadcast.
+type Message struct {
+	// Room is the room the message was posted in.
+	Room string
+	// From is the sender, who does not receive the message.
+	From Conn
+	Data []byte
+}
+
+// Roster is what a strategy may ask the server about its clients.
+type Roster interface {
+	// Clients returns every signed-in client.
+	Clients() []Conn
+	// Members returns the clients in room.
+	Members(room string) []Conn
+}
+
+// WriteFunc writes data to one recipient, applying the server's write
+// timeout.
+type WriteFunc func(conn Conn, data []byte) error
+
+// Strategy delivers a message to its recipients and returns those that
+// could not be written to, which the server disconnects.
+type Strategy interface {
+	Broadcast(msg Message, roster Roster, write WriteFunc) (failed []Conn)
+}
+
+// AllClients sends every message to every signed-in client, whatever room
+// it was posted in, like the server did before it had rooms.
+type AllClients struct{}
+
+func (AllClients) Broadcast(msg Message, roster Roster, write WriteFunc) []Conn {
+	return writeAll(except(roster.Clients(), msg.From), msg.Data, write)
+}
+
+// RoomOnly sends a message to the members of its room, one after the other.
+// A slow member delays the members after it.
+type RoomOnly struct{}
+
+func (RoomOnly) Broadcast(msg Message, roster Roster, write WriteFunc) []Conn {
+	return writeAll(except(roster.Members(msg.Room), msg.From), msg.Data, write)
+}
+
+// Sharded sends a message to the members of its room like RoomOnly, but
+// splits them into Shards groups that are written concurrently. A slow
+// member then only delays its own shard, which matters in big rooms.
+type Sharded struct {
+	Shards int
+}
+
+func (s Sharded) Broadcast(msg Message, roster Roster, write WriteFunc) []Conn {
+	conns := except(roster.Members(msg.Room), msg.From)
+	shards := s.Shards
+	if shards > len(conns) {
+		shards = len(conns)
+	}
+	if shards <= 1 {
+		return writeAll(conns, msg.Data, write)
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []Conn
+	)
+	size := (len(conns) + shards - 1) / shards
+	for start := 0; start < len(conns); start += size {
+		end := start + size
+		if end > len(conns) {
+			end = len(conns)
+		}
+		wg.Add(1)
+		go func(shard []Conn) {
+			defer wg.Done()
+			if f := writeAll(shard, msg.Data, write); len(f) > 0 {
+				mu.Lock()
+				failed = append(failed, f...)
+				mu.Unlock()
+			}
+		}(conns[start:end])
+	}
+	wg.Wait()
+	return failed
+}
+
+func except(conns []Conn, sender Conn) []Conn {
+	kept := make([]Conn, 0, len(conns))
+	for _, conn := range conns {
+		if conn != sender {
+			kept = append(kept, conn)
+		}
+	}
+	return kept
+}
+
+func writeAll(conns []Conn, data []byte, write WriteFunc) []Conn {
+	var failed []Conn
+	for _, conn := range conns {
+		if err := write(conn, data); err != nil {
+			failed = append(failed, conn)
+		}
+	}
+	return failed
+}
+
+var (
+	mu         sync.RWMutex
+	strategies = make(map[string]Strategy)
+)
+
+// The strategies that come with the package.
+func init() {
+	Register("all", AllClients{})
+	Register("room", RoomOnly{})
+	Register("sharded", Sharded{Shards: 4})
+}
+
+// Register makes a strategy available under name. It panics if the name is
+// taken or s is nil, as both are programming errors.
+func Register(name string, s Strategy) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if s == nil {
+		panic("strategy: Register of nil strategy " + name)
+	}
+	if _, ok := strategies[name]; ok {
+		panic("strategy: Register called twice for " + name)
+	}
+	strategies[name] = s
+}
+
+// Lookup returns the strategy registered under name.
+func Lookup(name string) (Strategy, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	s, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknown, name)
+	}
+	return s, nil
+}
+
+// Names returns the registered names, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,119 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/chain"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/protocol"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/usage"
+	"github.com/rajamummidi/go-design-patterns/rate-limiter/ratelimiter"
+)
+
+// What happens to a client that sends messages faster than its limit.
+const (
+	floodDrop       = "drop"
+	floodDisconnect = "disconnect"
+)
+
+// Throttle is the data of a client-throttled event.
+type Throttle struct {
+	Conn   Transportable
+	Nick   string
+	Action string
+	// Quota is set if the client used up its quota rather than its rate.
+	Quota bool
+}
+
+// SetRateLimit allows every connection rate messages per second with bursts
+// of up to burst messages. Messages over the limit are dropped, and with the
+// disconnect action the client is disconnected as well. A rate of zero or
+// less turns the limit off. With WithUsage, the limiter refuses the
+// messages of clients that used up their quota as well.
+func (cs *ChatServer) SetRateLimit(rate float64, burst int, action string) error {
+	if action != floodDrop && action != floodDisconnect {
+		return fmt.Errorf("unknown flood action %q", action)
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.limiter = nil
+	if rate > 0 {
+		cs.limiter = ratelimiter.NewKeyed[Transportable](rate, burst)
+		cs.limiter.AddHook(cs.checkQuota)
+	}
+	cs.floodAction = action
+	return nil
+}
+
+// throttleMessage stops a message that exceeds its sender's rate limit or
+// quota and publishes a client-throttled event for it. Without a rate
+// limit, the quota is checked directly.
+func (cs *ChatServer) throttleMessage(msg Message, next chain.Next[Message]) error {
+	cs.mu.Lock()
+	limiter, action := cs.limiter, cs.floodAction
+	cs.mu.Unlock()
+
+	var err error
+	if limiter != nil {
+		err = limiter.Check(msg.From)
+	} else {
+		err = cs.checkQuota(msg.From)
+	}
+	if err == nil {
+		return next(msg)
+	}
+	// A client over its quota is not flooding, so its messages are only
+	// dropped until the next period.
+	t := Throttle{Conn: msg.From, Nick: msg.Nick, Action: action}
+	if errors.Is(err, usage.ErrQuotaExceeded) {
+		t.Action, t.Quota = floodDrop, true
+	}
+	return cs.eventBus.Dispatch("client-throttled", t)
+}
+
+// onClientThrottled warns or disconnects a flooding client.
+func (cs *ChatServer) onClientThrottled(event eventbus.Event) error {
+	t := event.Data.(Throttle)
+	if t.Action == floodDisconnect {
+		cs.logger.Warn("disconnecting client for flooding", "nick", t.Nick, "addr", t.Conn.RemoteAddr().String())
+		cs.send([]Transportable{t.Conn}, protocol.Envelope{Type: protocol.TypeError, Body: "too many messages"})
+		return cs.eventBus.Dispatch("disconnected", t.Conn)
+	}
+	if t.Quota {
+		cs.notify(t.Conn, "You have used up your quota; your message was dropped.")
+		return nil
+	}
+	cs.notify(t.Conn, "You are sending messages too fast; your message was dropped.")
+	return nil
+}
@@ -0,0 +1,77 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/observability/observability"
+	"github.com/rajamummidi/go-design-patterns/otlp/otlp"
+)
+
+// Where the -traces flag sends spans.
+const (
+	tracesOff  = "off"
+	tracesLog  = "log"
+	tracesOTLP = "otlp"
+)
+
+// newTracer returns the tracer the -traces flag asks for, or nil for
+// tracesOff. Spans go to the log or, through exporter, to the collector of
+// the -otlp flag.
+func newTracer(mode string, logger *slog.Logger, exporter *otlp.Exporter) (*observability.Tracer, error) {
+	switch mode {
+	case tracesOff:
+		return nil, nil
+	case tracesLog:
+		return observability.NewTracer(observability.TracerConfig{Exporter: observability.LogExporter(logger)}), nil
+	case tracesOTLP:
+		if exporter == nil {
+			return nil, fmt.Errorf("-traces %s needs an -otlp collector", mode)
+		}
+		return observability.NewTracer(observability.TracerConfig{Exporter: observability.OTLPExporter(exporter, "chat")}), nil
+	}
+	return nil, fmt.Errorf("unknown -traces %q: want %s, %s or %s", mode, tracesOff, tracesLog, tracesOTLP)
+}
+
+// busTracer traces the server's events, except the pings of the liveness
+// probe, which would bury the traces of chat traffic.
+type busTracer struct {
+	eventbus.Tracer
+}
+
+func (t busTracer) StartEvent(ctx context.Context, eventType, id string) (context.Context, func(error)) {
+	if eventType == healthTopic {
+		return ctx, func(error) {}
+	}
+	return t.Tracer.StartEvent(ctx, eventType, id)
+}
@@ -0,0 +1,313 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/compression"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+)
+
+// BridgeConfig selects which topics cross the process boundary.
+type BridgeConfig struct {
+	// Name identifies this bridge on the wire. Messages carrying the same
+	// origin are ignored on the way in, so a bridge never consumes its own
+	// events. It must be unique among the bridges sharing a broker.
+	Name string
+	// Outbound topics are forwarded from the local bus to the transport.
+	Outbound []string
+	// Inbound topics are consumed from the transport and dispatched locally.
+	Inbound []string
+	// Types maps inbound topics to a constructor for their payload type.
+	// Payloads of topics without an entry are dispatched as json.RawMessage
+	// (or the raw bytes for non-JSON codecs).
+	Types map[string]func() interface{}
+
+	// HighWatermark pauses inbound consumption once the local bus has that
+	// many events queued, and LowWatermark is the depth at which it resumes.
+	// Consumption is never paused when HighWatermark is zero or the bus is
+	// synchronous.
+	HighWatermark int
+	LowWatermark  int
+
+	// Compression gzips outgoing payloads above a size threshold. Incoming
+	// payloads are decompressed whenever their header says so, whether or
+	// not Compression is set.
+	Compression *Compression
+}
+
+// BridgeStats reports how often and for how long a bridge paused inbound
+// consumption.
+type BridgeStats struct {
+	Paused      bool             `json:"paused"`
+	Pauses      uint64           `json:"pauses"`
+	PausedTotal time.Duration    `json:"paused_total"`
+	Compression CompressionStats `json:"compression"`
+}
+
+// pollInterval is how often a paused bridge checks the local queue depth.
+const pollInterval = 10 * time.Millisecond
+
+// deadlineHeader carries Event.Deadline across the broker, so events keep
+// expiring on the receiving side.
+const deadlineHeader = "deadline"
+
+// Bridge forwards events between an EventBus and a Transport.
+type Bridge struct {
+	bus       *eventbus.EventBus
+	transport Transport
+	codec     Codec
+	cfg       BridgeConfig
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	subs   []eventbus.SubscriptionID
+
+	statsMu     sync.Mutex
+	stats       BridgeStats
+	pausedSince time.Time
+}
+
+func NewBridge(bus *eventbus.EventBus, transport Transport, codec Codec, cfg BridgeConfig) *Bridge {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	return &Bridge{bus: bus, transport: transport, codec: codec, cfg: cfg}
+}
+
+// Start subscribes to the outbound topics on the bus and starts consuming
+// the inbound topics from the transport.
+func (b *Bridge) Start(ctx context.Context) {
+	ctx, b.cancel = context.WithCancel(ctx)
+
+	for _, topic := range b.cfg.Outbound {
+		b.subs = append(b.subs, b.bus.Register(topic, eventbus.DefaultPriority, b.forward(ctx)))
+	}
+
+	if len(b.cfg.Inbound) > 0 {
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			receive := func(msg Message) { b.receive(ctx, msg) }
+			if err := b.transport.Subscribe(ctx, b.cfg.Inbound, receive); err != nil {
+				fmt.Printf("Bridge %s: error subscribing: %v\n", b.cfg.Name, err)
+			}
+		}()
+	}
+}
+
+// Stop unsubscribes from the bus and the transport. It does not close the
+// transport, which may be shared.
+func (b *Bridge) Stop() {
+	for i, topic := range b.cfg.Outbound {
+		b.bus.Unregister(topic, b.subs[i])
+	}
+	b.subs = nil
+	if b.cancel != nil {
+		b.cancel()
+	}
+	b.wg.Wait()
+}
+
+func (b *Bridge) forward(ctx context.Context) eventbus.EventHandler {
+	return func(event eventbus.Event) error {
+		// Events that came in over a bridge are not sent back out, otherwise
+		// two bridges sharing a topic would bounce it between them forever.
+		if event.Source != "" {
+			return nil
+		}
+
+		payload, err := b.codec.Marshal(event.Data)
+		if err != nil {
+			return fmt.Errorf("bridge %s: encoding %s: %w", b.cfg.Name, event.Type, err)
+		}
+		headers := map[string]string{"content-type": b.codec.ContentType()}
+
+		if b.cfg.Compression.applies(event.Type, len(payload)) {
+			compressed, err := compression.Compress(compression.Gzip, payload)
+			if err != nil {
+				return fmt.Errorf("bridge %s: compressing %s: %w", b.cfg.Name, event.Type, err)
+			}
+			b.recordCompression(len(payload), len(compressed))
+			payload = compressed
+			headers[contentEncoding] = compression.Gzip
+		}
+		if !event.Deadline.IsZero() {
+			headers[deadlineHeader] = event.Deadline.Format(time.RFC3339Nano)
+		}
+
+		// Brokers deliver at least once. An ID lets the consumers recognize
+		// the copies with eventbus.Deduplicate.
+		id := event.ID
+		if id == "" {
+			if id, err = newMessageID(); err != nil {
+				return fmt.Errorf("bridge %s: %w", b.cfg.Name, err)
+			}
+		}
+		return b.transport.Publish(ctx, Message{
+			ID:            id,
+			Topic:         event.Type,
+			Payload:       payload,
+			Origin:        b.cfg.Name,
+			CorrelationID: event.CorrelationID,
+			ReplyTo:       event.ReplyTo,
+			Headers:       headers,
+		})
+	}
+}
+
+func (b *Bridge) receive(ctx context.Context, msg Message) {
+	if msg.Origin == b.cfg.Name {
+		return
+	}
+	b.waitForCapacity(ctx)
+
+	data, err := b.decode(msg)
+	if err != nil {
+		fmt.Printf("Bridge %s: dropping %s message: %v\n", b.cfg.Name, msg.Topic, err)
+		return
+	}
+
+	// A malformed deadline is ignored rather than dropping the event.
+	deadline, _ := time.Parse(time.RFC3339Nano, msg.Headers[deadlineHeader])
+	b.bus.DispatchEvent(eventbus.Event{
+		ID:            msg.ID,
+		Type:          msg.Topic,
+		Data:          data,
+		CorrelationID: msg.CorrelationID,
+		ReplyTo:       msg.ReplyTo,
+		Source:        msg.Origin,
+		Deadline:      deadline,
+	})
+}
+
+// newMessageID returns a random ID for a message.
+func newMessageID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func (b *Bridge) decode(msg Message) (interface{}, error) {
+	if encoding := msg.Headers[contentEncoding]; encoding != "" {
+		payload, err := compression.Decompress(encoding, msg.Payload, maxDecompressedSize)
+		if err != nil {
+			return nil, err
+		}
+		b.recordDecompression(len(msg.Payload), len(payload))
+		msg.Payload = payload
+	}
+
+	if newValue, ok := b.cfg.Types[msg.Topic]; ok {
+		v := newValue()
+		if err := b.codec.Unmarshal(msg.Payload, v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	if _, ok := b.codec.(JSONCodec); ok {
+		return json.RawMessage(msg.Payload), nil
+	}
+	return msg.Payload, nil
+}
+
+// Stats returns the pause and compression statistics of the bridge.
+func (b *Bridge) Stats() BridgeStats {
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+
+	stats := b.stats
+	if stats.Paused {
+		stats.PausedTotal += time.Since(b.pausedSince)
+	}
+	return stats
+}
+
+// waitForCapacity blocks while the local queue is above the high watermark,
+// until it falls to the low watermark, so that a slow consumer pushes back on
+// the broker instead of buffering without bound.
+func (b *Bridge) waitForCapacity(ctx context.Context) {
+	if b.cfg.HighWatermark <= 0 || b.bus.QueueDepth() < b.cfg.HighWatermark {
+		return
+	}
+
+	b.setPaused(true)
+	defer b.setPaused(false)
+	if pauser, ok := b.transport.(Pauser); ok {
+		pauser.Pause(b.cfg.Inbound)
+		defer pauser.Resume(b.cfg.Inbound)
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for b.bus.QueueDepth() > b.cfg.LowWatermark {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *Bridge) setPaused(paused bool) {
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+
+	if paused {
+		b.stats.Paused = true
+		b.stats.Pauses++
+		b.pausedSince = time.Now()
+		return
+	}
+	b.stats.Paused = false
+	b.stats.PausedTotal += time.Since(b.pausedSince)
+}
+
+func (b *Bridge) recordCompression(before, after int) {
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+
+	b.stats.Compression.Compressed(before, after)
+}
+
+func (b *Bridge) recordDecompression(in, out int) {
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+
+	b.stats.Compression.Decompressed(in, out)
+}
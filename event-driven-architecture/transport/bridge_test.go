@@ -0,0 +1,172 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/compression"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/golden/golden"
+	"github.com/rajamummidi/go-design-patterns/leakcheck/leakcheck"
+)
+
+// TestBridgeStop checks that a stopped bridge ends its consumer and removes
+// its subscriptions from the bus, and that it can be started again.
+func TestBridgeStop(t *testing.T) {
+	leakcheck.Check(t)
+	broker := NewMemoryTransport()
+	defer broker.Close()
+
+	sender, receiver := eventbus.NewEventBus(), eventbus.NewEventBus()
+	leakcheck.CheckSubscriptions(t, sender)
+	received := make(chan string, 1)
+	receiver.Register("greeting", eventbus.DefaultPriority, func(e eventbus.Event) error {
+		var text string
+		if err := json.Unmarshal(e.Data.(json.RawMessage), &text); err != nil {
+			return err
+		}
+		received <- text
+		return nil
+	})
+
+	out := NewBridge(sender, broker, nil, BridgeConfig{Name: "sender", Outbound: []string{"greeting"}})
+	in := NewBridge(receiver, broker, nil, BridgeConfig{Name: "receiver", Inbound: []string{"greeting"}})
+	for round := 0; round < 2; round++ {
+		out.Start(context.Background())
+		in.Start(context.Background())
+		// The consumer subscribes in the background.
+		time.Sleep(10 * time.Millisecond)
+
+		sender.Dispatch("greeting", "hello")
+		select {
+		case text := <-received:
+			if text != "hello" {
+				t.Fatalf("received %q", text)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("round %d: nothing received", round)
+		}
+		out.Stop()
+		in.Stop()
+	}
+}
+
+// capture is a transport that keeps what is published on it.
+type capture struct {
+	messages []Message
+}
+
+func (c *capture) Publish(ctx context.Context, msg Message) error {
+	c.messages = append(c.messages, msg)
+	return nil
+}
+
+func (c *capture) Subscribe(ctx context.Context, topics []string, handle func(Message)) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (c *capture) Close() error { return nil }
+
+// TestMessageFormat locks down the messages a bridge puts on the wire,
+// which bridges of other versions and other languages have to read.
+func TestMessageFormat(t *testing.T) {
+	bus := eventbus.NewEventBus()
+	broker := &capture{}
+	bridge := NewBridge(bus, broker, nil, BridgeConfig{Name: "chat-1", Outbound: []string{"room.go.message"}})
+	bridge.Start(context.Background())
+	defer bridge.Stop()
+
+	type message struct {
+		Sender string `json:"sender"`
+		Text   string `json:"text"`
+	}
+	bus.DispatchEvent(eventbus.Event{
+		ID:            "4f2c9a",
+		Type:          "room.go.message",
+		Data:          message{Sender: "alice", Text: "hi"},
+		CorrelationID: "c-1",
+		ReplyTo:       "reply.c-1",
+		Deadline:      time.Date(2999, 5, 1, 12, 0, 30, 0, time.UTC),
+	})
+	bus.DispatchEvent(eventbus.Event{ID: "4f2c9b", Type: "room.go.message", Data: message{Sender: "bob", Text: "hello"}})
+	golden.AssertJSON(t, "messages", broker.messages)
+}
+
+// TestCompression checks that only large payloads are compressed, that the
+// receiving bridge restores them, and that a payload expanding past the
+// limit is rejected rather than cut short.
+func TestCompression(t *testing.T) {
+	bus := eventbus.NewEventBus()
+	broker := &capture{}
+	out := NewBridge(bus, broker, nil, BridgeConfig{Name: "sender", Outbound: []string{"note"}, Compression: &Compression{Threshold: 100}})
+	out.Start(context.Background())
+	defer out.Stop()
+
+	long := strings.Repeat("all work and no play ", 20)
+	bus.Dispatch("note", "short")
+	bus.Dispatch("note", long)
+	if len(broker.messages) != 2 {
+		t.Fatalf("published %d messages", len(broker.messages))
+	}
+	if encoding := broker.messages[0].Headers[contentEncoding]; encoding != "" {
+		t.Errorf("short payload compressed with %q", encoding)
+	}
+	if encoding := broker.messages[1].Headers[contentEncoding]; encoding != compression.Gzip {
+		t.Errorf("long payload encoded as %q", encoding)
+	}
+	if stats := out.Stats().Compression; stats.Messages != 1 || stats.Ratio() >= 1 {
+		t.Errorf("sender stats %+v", stats)
+	}
+
+	in := NewBridge(eventbus.NewEventBus(), nil, nil, BridgeConfig{Name: "receiver"})
+	data, err := in.decode(broker.messages[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text string
+	if err := json.Unmarshal(data.(json.RawMessage), &text); err != nil || text != long {
+		t.Errorf("received %q, %v", text, err)
+	}
+
+	bomb, err := compression.Compress(compression.Gzip, make([]byte, maxDecompressedSize+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = in.decode(Message{Topic: "note", Payload: bomb, Headers: map[string]string{contentEncoding: compression.Gzip}})
+	if !errors.Is(err, compression.ErrTooLarge) {
+		t.Errorf("oversized payload: got %v, want ErrTooLarge", err)
+	}
+}
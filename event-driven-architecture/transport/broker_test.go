@@ -0,0 +1,125 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package transport_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// broker is the in-memory broker behind the fake clients that the adapter
+// tests run the conformance checks on. It delivers synchronously and in
+// order, as a single broker node does to a single subscriber.
+type broker struct {
+	mu     sync.Mutex
+	subs   map[string]map[int]func([]byte)
+	next   int
+	closed bool
+}
+
+var errBrokerClosed = errors.New("broker: connection closed")
+
+func newBroker() *broker {
+	return &broker{subs: make(map[string]map[int]func([]byte))}
+}
+
+func (b *broker) publish(topic string, data []byte) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return errBrokerClosed
+	}
+	var handlers []func([]byte)
+	for _, handle := range b.subs[topic] {
+		handlers = append(handlers, handle)
+	}
+	b.mu.Unlock()
+
+	for _, handle := range handlers {
+		handle(append([]byte(nil), data...))
+	}
+	return nil
+}
+
+func (b *broker) subscribe(topic string, handle func([]byte)) (func() error, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, errBrokerClosed
+	}
+	if b.subs[topic] == nil {
+		b.subs[topic] = make(map[int]func([]byte))
+	}
+	id := b.next
+	b.next++
+	b.subs[topic][id] = handle
+	return func() error {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs[topic], id)
+		return nil
+	}, nil
+}
+
+// subscribeAll subscribes to topics until ctx is done.
+func (b *broker) subscribeAll(ctx context.Context, topics []string, handle func(topic string, data []byte)) error {
+	var unsubscribes []func() error
+	defer func() {
+		for _, unsubscribe := range unsubscribes {
+			unsubscribe()
+		}
+	}()
+	for _, topic := range topics {
+		topic := topic
+		unsubscribe, err := b.subscribe(topic, func(data []byte) { handle(topic, data) })
+		if err != nil {
+			return err
+		}
+		unsubscribes = append(unsubscribes, unsubscribe)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func (b *broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.subs = make(map[string]map[int]func([]byte))
+	return nil
+}
+
+// waitWhile polls cond until it is false or ctx is done.
+func waitWhile(ctx context.Context, cond func() bool) {
+	for cond() && ctx.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+}
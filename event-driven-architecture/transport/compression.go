@@ -0,0 +1,65 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package transport
+
+import "github.com/rajamummidi/go-design-patterns/event-driven-architecture/compression"
+
+// contentEncoding is the message header announcing a compressed payload.
+const contentEncoding = "content-encoding"
+
+// maxDecompressedSize guards against payloads that expand without bound.
+const maxDecompressedSize = 64 << 20
+
+// Compression configures payload compression on a bridge. Payloads smaller
+// than Threshold bytes are sent as they are, since compressing them usually
+// costs more than it saves.
+type Compression struct {
+	Threshold int
+	// Topics limits compression to the listed topics; empty means all.
+	Topics []string
+}
+
+func (c *Compression) applies(topic string, size int) bool {
+	if c == nil || size < c.Threshold {
+		return false
+	}
+	if len(c.Topics) == 0 {
+		return true
+	}
+	for _, t := range c.Topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// CompressionStats counts the payload bytes a bridge compressed and what they
+// compressed to.
+type CompressionStats = compression.Stats
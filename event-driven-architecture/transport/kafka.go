@@ -0,0 +1,120 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package transport
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// KafkaRecord is a record of a Kafka topic.
+type KafkaRecord struct {
+	Topic string
+	Key   []byte
+	Value []byte
+}
+
+// KafkaClient is what KafkaTransport needs from a Kafka client, such as
+// franz-go's kgo.Client or a segmentio/kafka-go Writer and Reader behind a
+// small wrapper.
+type KafkaClient interface {
+	Produce(ctx context.Context, record KafkaRecord) error
+	// Consume fetches the records of topics as a member of the client's
+	// consumer group, and calls handle for each, until ctx is done. Every
+	// bridge needs a group of its own to see every record; bridges in one
+	// group share the records between them.
+	Consume(ctx context.Context, topics []string, handle func(KafkaRecord)) error
+	// Pause and Resume stop and restart fetching from topics without
+	// leaving the group.
+	Pause(topics []string)
+	Resume(topics []string)
+	Close() error
+}
+
+// KafkaTransport carries messages over Kafka, with a Kafka topic per topic.
+// Records are keyed by the origin of the message, so the messages of one
+// bridge land in one partition and keep their order. It implements Pauser,
+// so bridges pause fetching rather than blocking the consumer.
+type KafkaTransport struct {
+	client KafkaClient
+	closed atomic.Bool
+}
+
+// NewKafkaTransport returns a transport over client, which it closes on
+// Close.
+func NewKafkaTransport(client KafkaClient) *KafkaTransport {
+	return &KafkaTransport{client: client}
+}
+
+func (t *KafkaTransport) Publish(ctx context.Context, msg Message) error {
+	if t.closed.Load() {
+		return ErrClosed
+	}
+	data, err := marshalMessage(msg)
+	if err != nil {
+		return err
+	}
+	return t.client.Produce(ctx, KafkaRecord{Topic: msg.Topic, Key: []byte(msg.Origin), Value: data})
+}
+
+// Subscribe consumes topics until ctx is done. Records that cannot be
+// decoded are dropped.
+func (t *KafkaTransport) Subscribe(ctx context.Context, topics []string, handle func(Message)) error {
+	if t.closed.Load() {
+		return ErrClosed
+	}
+	err := t.client.Consume(ctx, topics, func(record KafkaRecord) {
+		msg, err := unmarshalMessage(record.Value)
+		if err != nil {
+			fmt.Printf("Kafka transport: dropping malformed record on %s: %v\n", record.Topic, err)
+			return
+		}
+		handle(msg)
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func (t *KafkaTransport) Pause(topics []string) {
+	t.client.Pause(topics)
+}
+
+func (t *KafkaTransport) Resume(topics []string) {
+	t.client.Resume(topics)
+}
+
+func (t *KafkaTransport) Close() error {
+	if t.closed.Swap(true) {
+		return nil
+	}
+	return t.client.Close()
+}
@@ -0,0 +1,119 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package transport_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/transport"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/transport/transporttest"
+)
+
+// kafkaClient is a fake Kafka client. Every Consume reads as a consumer
+// group of its own, from a queue that Pause holds back.
+type kafkaClient struct {
+	*broker
+	mu     sync.Mutex
+	paused map[string]bool
+}
+
+func newKafkaClient() *kafkaClient {
+	return &kafkaClient{broker: newBroker(), paused: make(map[string]bool)}
+}
+
+func (c *kafkaClient) Produce(ctx context.Context, record transport.KafkaRecord) error {
+	return c.publish(record.Topic, record.Value)
+}
+
+func (c *kafkaClient) Consume(ctx context.Context, topics []string, handle func(transport.KafkaRecord)) error {
+	queue := make(chan transport.KafkaRecord, 10000)
+	go func() {
+		for {
+			select {
+			case record := <-queue:
+				waitWhile(ctx, func() bool { return c.isPaused(record.Topic) })
+				handle(record)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c.subscribeAll(ctx, topics, func(topic string, data []byte) {
+		queue <- transport.KafkaRecord{Topic: topic, Value: data}
+	})
+}
+
+func (c *kafkaClient) isPaused(topic string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused[topic]
+}
+
+func (c *kafkaClient) Pause(topics []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range topics {
+		c.paused[topic] = true
+	}
+}
+
+func (c *kafkaClient) Resume(topics []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range topics {
+		delete(c.paused, topic)
+	}
+}
+
+func TestKafkaTransport(t *testing.T) {
+	transporttest.Run(t, func(t *testing.T) transport.Transport {
+		return transport.NewKafkaTransport(newKafkaClient())
+	})
+}
+
+// TestKafkaPause checks that the transport passes the pauses of a bridge
+// on to the client.
+func TestKafkaPause(t *testing.T) {
+	client := newKafkaClient()
+	var tr transport.Transport = transport.NewKafkaTransport(client)
+	pauser, ok := tr.(transport.Pauser)
+	if !ok {
+		t.Fatal("KafkaTransport is not a Pauser")
+	}
+	pauser.Pause([]string{"orders"})
+	if !client.isPaused("orders") {
+		t.Error("Pause did not reach the client")
+	}
+	pauser.Resume([]string{"orders"})
+	if client.isPaused("orders") {
+		t.Error("Resume did not reach the client")
+	}
+}
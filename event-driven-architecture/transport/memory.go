@@ -0,0 +1,117 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package transport
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClosed is returned when publishing to or subscribing on a closed
+// transport.
+var ErrClosed = errors.New("transport: closed")
+
+// MemoryTransport is an in-process broker. Bridges of several buses that
+// share one MemoryTransport behave as if they were connected to a real
+// broker, which makes it handy for demos and for trying out a topology
+// before deploying one.
+type MemoryTransport struct {
+	mu     sync.RWMutex
+	subs   map[string]map[*memorySub]bool
+	closed bool
+}
+
+type memorySub struct {
+	handle func(Message)
+}
+
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{
+		subs: make(map[string]map[*memorySub]bool),
+	}
+}
+
+// Publish delivers msg synchronously to every current subscriber of its
+// topic.
+func (t *MemoryTransport) Publish(ctx context.Context, msg Message) error {
+	t.mu.RLock()
+	if t.closed {
+		t.mu.RUnlock()
+		return ErrClosed
+	}
+	subs := make([]*memorySub, 0, len(t.subs[msg.Topic]))
+	for sub := range t.subs[msg.Topic] {
+		subs = append(subs, sub)
+	}
+	t.mu.RUnlock()
+
+	for _, sub := range subs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		sub.handle(msg)
+	}
+	return nil
+}
+
+func (t *MemoryTransport) Subscribe(ctx context.Context, topics []string, handle func(Message)) error {
+	sub := &memorySub{handle: handle}
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return ErrClosed
+	}
+	for _, topic := range topics {
+		if t.subs[topic] == nil {
+			t.subs[topic] = make(map[*memorySub]bool)
+		}
+		t.subs[topic][sub] = true
+	}
+	t.mu.Unlock()
+
+	<-ctx.Done()
+
+	t.mu.Lock()
+	for _, topic := range topics {
+		delete(t.subs[topic], sub)
+	}
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *MemoryTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	t.subs = make(map[string]map[*memorySub]bool)
+	return nil
+}
@@ -0,0 +1,130 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// NATSConn is what NATSTransport needs from a NATS connection. The nats.go
+// client satisfies it with a few lines of glue:
+//
+//	type natsConn struct{ *nats.Conn }
+//
+//	func (c natsConn) Subscribe(subject string, handle func([]byte)) (func() error, error) {
+//		sub, err := c.Conn.Subscribe(subject, func(m *nats.Msg) { handle(m.Data) })
+//		if err != nil {
+//			return nil, err
+//		}
+//		return sub.Unsubscribe, nil
+//	}
+//
+//	func (c natsConn) Close() error { c.Conn.Close(); return nil }
+type NATSConn interface {
+	Publish(subject string, data []byte) error
+	// Subscribe calls handle with the data of every message published on
+	// subject until unsubscribe is called.
+	Subscribe(subject string, handle func(data []byte)) (unsubscribe func() error, err error)
+	Close() error
+}
+
+// NATSTransport carries messages over NATS core, with a subject per topic.
+// NATS core delivers at most once and only to connected subscribers, like
+// MemoryTransport; JetStream would be needed for redelivery.
+type NATSTransport struct {
+	conn   NATSConn
+	closed atomic.Bool
+}
+
+// NewNATSTransport returns a transport over conn, which it closes on Close.
+func NewNATSTransport(conn NATSConn) *NATSTransport {
+	return &NATSTransport{conn: conn}
+}
+
+func (t *NATSTransport) Publish(ctx context.Context, msg Message) error {
+	if t.closed.Load() {
+		return ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := marshalMessage(msg)
+	if err != nil {
+		return err
+	}
+	return t.conn.Publish(msg.Topic, data)
+}
+
+// Subscribe subscribes to a subject per topic until ctx is done. Messages
+// that cannot be decoded are dropped.
+func (t *NATSTransport) Subscribe(ctx context.Context, topics []string, handle func(Message)) error {
+	if t.closed.Load() {
+		return ErrClosed
+	}
+	var unsubscribes []func() error
+	unsubscribe := func() error {
+		var errs []error
+		for _, unsubscribe := range unsubscribes {
+			errs = append(errs, unsubscribe())
+		}
+		return errors.Join(errs...)
+	}
+	for _, topic := range topics {
+		unsub, err := t.conn.Subscribe(topic, func(data []byte) {
+			msg, err := unmarshalMessage(data)
+			if err != nil {
+				fmt.Printf("NATS transport: dropping malformed message on %s: %v\n", topic, err)
+				return
+			}
+			handle(msg)
+		})
+		if err != nil {
+			unsubscribe()
+			return fmt.Errorf("transport: subscribing to %s: %w", topic, err)
+		}
+		unsubscribes = append(unsubscribes, unsub)
+	}
+
+	<-ctx.Done()
+	if t.closed.Load() {
+		// Closing the connection ended the subscriptions.
+		return nil
+	}
+	return unsubscribe()
+}
+
+func (t *NATSTransport) Close() error {
+	if t.closed.Swap(true) {
+		return nil
+	}
+	return t.conn.Close()
+}
@@ -0,0 +1,55 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package transport_test
+
+import (
+	"testing"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/transport"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/transport/transporttest"
+)
+
+// natsConn is a fake NATS connection.
+type natsConn struct {
+	*broker
+}
+
+func (c natsConn) Publish(subject string, data []byte) error {
+	return c.publish(subject, data)
+}
+
+func (c natsConn) Subscribe(subject string, handle func([]byte)) (func() error, error) {
+	return c.subscribe(subject, handle)
+}
+
+func TestNATSTransport(t *testing.T) {
+	transporttest.Run(t, func(t *testing.T) transport.Transport {
+		return transport.NewNATSTransport(natsConn{newBroker()})
+	})
+}
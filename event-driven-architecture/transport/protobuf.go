@@ -0,0 +1,66 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package transport
+
+import "fmt"
+
+// ProtoMessage is a Protobuf message with generated marshaling methods, as
+// gogoproto generates them. Messages of google.golang.org/protobuf fit
+// behind a wrapper that calls proto.Marshal and proto.Unmarshal; the
+// examples do not depend on it.
+type ProtoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+// ProtobufCodec encodes payloads that are ProtoMessages. Protobuf messages
+// do not describe themselves, so a receiving bridge needs BridgeConfig.Types
+// to decode them; without an entry for a topic, it dispatches the raw
+// bytes.
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(ProtoMessage)
+	if !ok {
+		return nil, fmt.Errorf("transport: %T is not a Protobuf message", v)
+	}
+	return m.Marshal()
+}
+
+func (ProtobufCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(ProtoMessage)
+	if !ok {
+		return fmt.Errorf("transport: %T is not a Protobuf message", v)
+	}
+	return m.Unmarshal(data)
+}
+
+func (ProtobufCodec) ContentType() string {
+	return "application/x-protobuf"
+}
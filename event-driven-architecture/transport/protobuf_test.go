@@ -0,0 +1,128 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+)
+
+// greeting stands in for a generated Protobuf message:
+//
+//	message Greeting {
+//	  string text = 1;
+//	  int64 count = 2;
+//	}
+type greeting struct {
+	Text  string
+	Count int64
+}
+
+func (g *greeting) Marshal() ([]byte, error) {
+	data := binary.AppendUvarint([]byte{1<<3 | 2}, uint64(len(g.Text)))
+	data = append(data, g.Text...)
+	data = append(data, 2<<3|0)
+	return binary.AppendUvarint(data, uint64(g.Count)), nil
+}
+
+func (g *greeting) Unmarshal(data []byte) error {
+	*g = greeting{}
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("greeting: bad key")
+		}
+		data = data[n:]
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errors.New("greeting: bad value")
+		}
+		data = data[n:]
+		switch key {
+		case 1<<3 | 2:
+			if uint64(len(data)) < v {
+				return errors.New("greeting: short text")
+			}
+			g.Text, data = string(data[:v]), data[v:]
+		case 2<<3 | 0:
+			g.Count = int64(v)
+		default:
+			return errors.New("greeting: unknown field")
+		}
+	}
+	return nil
+}
+
+// TestProtobufBridge sends a Protobuf message between two buses and checks
+// that it arrives typed.
+func TestProtobufBridge(t *testing.T) {
+	broker := NewMemoryTransport()
+	defer broker.Close()
+
+	sender, receiver := eventbus.NewEventBus(), eventbus.NewEventBus()
+	received := make(chan *greeting, 1)
+	receiver.Register("greeting", eventbus.DefaultPriority, func(e eventbus.Event) error {
+		received <- e.Data.(*greeting)
+		return nil
+	})
+
+	out := NewBridge(sender, broker, ProtobufCodec{}, BridgeConfig{Name: "sender", Outbound: []string{"greeting"}})
+	in := NewBridge(receiver, broker, ProtobufCodec{}, BridgeConfig{
+		Name:    "receiver",
+		Inbound: []string{"greeting"},
+		Types:   map[string]func() interface{}{"greeting": func() interface{} { return new(greeting) }},
+	})
+	out.Start(context.Background())
+	defer out.Stop()
+	in.Start(context.Background())
+	defer in.Stop()
+	// The consumer subscribes in the background.
+	time.Sleep(10 * time.Millisecond)
+
+	if err := sender.Dispatch("greeting", &greeting{Text: "hello", Count: 3}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case g := <-received:
+		if *g != (greeting{Text: "hello", Count: 3}) {
+			t.Errorf("received %+v", *g)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("nothing received")
+	}
+
+	if _, err := (ProtobufCodec{}).Marshal("not a message"); err == nil {
+		t.Error("marshaled a string")
+	}
+}
@@ -0,0 +1,98 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package transport
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// RedisPubSub is what RedisTransport needs from a Redis client. RedisConn,
+// built with -tags redis, implements it without dependencies; go-redis
+// fits behind a small wrapper.
+type RedisPubSub interface {
+	Publish(ctx context.Context, channel string, payload []byte) error
+	// Subscribe calls handle for every message published on channels
+	// until ctx is done.
+	Subscribe(ctx context.Context, channels []string, handle func(channel string, payload []byte)) error
+	Close() error
+}
+
+// RedisTransport carries messages over Redis pub/sub, with a channel per
+// topic. Like NATS core, Redis pub/sub delivers at most once and only to
+// connected subscribers.
+type RedisTransport struct {
+	client RedisPubSub
+	closed atomic.Bool
+}
+
+// NewRedisTransport returns a transport over client, which it closes on
+// Close.
+func NewRedisTransport(client RedisPubSub) *RedisTransport {
+	return &RedisTransport{client: client}
+}
+
+func (t *RedisTransport) Publish(ctx context.Context, msg Message) error {
+	if t.closed.Load() {
+		return ErrClosed
+	}
+	data, err := marshalMessage(msg)
+	if err != nil {
+		return err
+	}
+	return t.client.Publish(ctx, msg.Topic, data)
+}
+
+// Subscribe subscribes to a channel per topic until ctx is done. Messages
+// that cannot be decoded are dropped.
+func (t *RedisTransport) Subscribe(ctx context.Context, topics []string, handle func(Message)) error {
+	if t.closed.Load() {
+		return ErrClosed
+	}
+	err := t.client.Subscribe(ctx, topics, func(channel string, payload []byte) {
+		msg, err := unmarshalMessage(payload)
+		if err != nil {
+			fmt.Printf("Redis transport: dropping malformed message on %s: %v\n", channel, err)
+			return
+		}
+		handle(msg)
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func (t *RedisTransport) Close() error {
+	if t.closed.Swap(true) {
+		return nil
+	}
+	return t.client.Close()
+}
@@ -0,0 +1,141 @@
+//go:build redis
+
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package transport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/rajamummidi/go-design-patterns/resp/resp"
+)
+
+// This file is only built with -tags redis, so programs that do not talk
+// to Redis do not carry a client for it.
+
+// RedisError is an error reply from Redis.
+type RedisError = resp.Error
+
+// RedisConn is a minimal Redis client for pub/sub, on top of resp.Client,
+// whose Password field it shares. Publishing shares one connection; every
+// Subscribe opens its own, because a subscribed connection accepts no
+// other commands.
+type RedisConn struct {
+	*resp.Client
+
+	mu     sync.Mutex
+	subs   map[*resp.Conn]bool
+	closed bool
+}
+
+// NewRedisConn returns a client for the Redis server at addr. It connects
+// when it is first used.
+func NewRedisConn(addr string) *RedisConn {
+	return &RedisConn{Client: resp.NewClient(addr), subs: make(map[*resp.Conn]bool)}
+}
+
+func (c *RedisConn) Publish(ctx context.Context, channel string, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+	_, err := c.Do(ctx, "PUBLISH", channel, string(payload))
+	return err
+}
+
+// Subscribe subscribes to channels on a connection of its own and calls
+// handle for every message until ctx is done or the connection fails.
+func (c *RedisConn) Subscribe(ctx context.Context, channels []string, handle func(channel string, payload []byte)) error {
+	conn, err := c.Dial(ctx)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		conn.Close()
+		return ErrClosed
+	}
+	c.subs[conn] = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.subs, conn)
+		c.mu.Unlock()
+		conn.Close()
+	}()
+
+	// Closing the connection ends the read below.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := conn.Send(append([]string{"SUBSCRIBE"}, channels...)...); err != nil {
+		return subscribeErr(ctx, err)
+	}
+	for {
+		reply, err := conn.Receive()
+		if err != nil {
+			return subscribeErr(ctx, err)
+		}
+		// Pushes are ["message", channel, payload], after a
+		// ["subscribe", channel, count] for every channel.
+		push, ok := reply.([]interface{})
+		if !ok || len(push) != 3 {
+			return fmt.Errorf("transport: unexpected redis push %v", reply)
+		}
+		if kind, _ := push[0].(string); kind == "message" {
+			channel, _ := push[1].(string)
+			payload, _ := push[2].(string)
+			handle(channel, []byte(payload))
+		}
+	}
+}
+
+// subscribeErr returns nil for the error that closing the connection on
+// ctx's account caused.
+func subscribeErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func (c *RedisConn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	for conn := range c.subs {
+		conn.Close()
+	}
+	c.mu.Unlock()
+	return c.Client.Close()
+}
@@ -0,0 +1,55 @@
+//go:build redis
+
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package transport_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/transport"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/transport/transporttest"
+)
+
+// TestRedisConn runs the conformance checks against the Redis server at
+// $REDIS_ADDR:
+//
+//	REDIS_ADDR=localhost:6379 go test -tags redis ./transport
+func TestRedisConn(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR is not set")
+	}
+	transporttest.Run(t, func(t *testing.T) transport.Transport {
+		conn := transport.NewRedisConn(addr)
+		conn.Password = os.Getenv("REDIS_PASSWORD")
+		return transport.NewRedisTransport(conn)
+	})
+}
@@ -0,0 +1,99 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package transport
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Message is an event on its way to or from an external broker.
+type Message struct {
+	// ID identifies the message, so that consumers can recognize it when
+	// the broker delivers it more than once.
+	ID            string            `json:"id,omitempty"`
+	Topic         string            `json:"topic"`
+	Payload       []byte            `json:"payload"`
+	Origin        string            `json:"origin"`
+	CorrelationID string            `json:"correlation_id,omitempty"`
+	ReplyTo       string            `json:"reply_to,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+}
+
+// Transport connects the local EventBus to a message broker such as NATS,
+// Kafka or Redis pub/sub. Implementations must be safe for concurrent use.
+type Transport interface {
+	Publish(ctx context.Context, msg Message) error
+	// Subscribe delivers messages for topics to handle until ctx is done.
+	Subscribe(ctx context.Context, topics []string, handle func(Message)) error
+	Close() error
+}
+
+// Pauser is implemented by transports that can stop fetching from the broker
+// without tearing down their subscription, as Kafka consumers can. Bridges
+// use it to apply backpressure; for other transports they simply stop
+// returning from the message callback, which blocks the consumer.
+type Pauser interface {
+	Pause(topics []string)
+	Resume(topics []string)
+}
+
+// marshalMessage encodes msg, headers and all, as the body of a broker
+// message. NATS core and Redis pub/sub have no headers, so the adapters for
+// them, and for Kafka to keep one format, send the whole Message as JSON.
+func marshalMessage(msg Message) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func unmarshalMessage(data []byte) (Message, error) {
+	var msg Message
+	err := json.Unmarshal(data, &msg)
+	return msg, err
+}
+
+// Codec turns event payloads into bytes for the wire and back.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	ContentType() string
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (JSONCodec) ContentType() string {
+	return "application/json"
+}
@@ -0,0 +1,301 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package transporttest checks that a Transport behaves the way bridges
+// rely on. An adapter's tests call Run with a constructor:
+//
+//	func TestConformance(t *testing.T) {
+//		transporttest.Run(t, func(t *testing.T) transport.Transport {
+//			return transport.NewRedisTransport(transport.NewRedisConn(addr))
+//		})
+//	}
+package transporttest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/transport"
+)
+
+// Timeout is how long a test waits for a message to arrive, or for
+// Subscribe to return once its context is done.
+var Timeout = 5 * time.Second
+
+// probeHeader marks the messages that check whether a subscription is in
+// place. Subscriptions drop them.
+const probeHeader = "transporttest-probe"
+
+// Run runs every check as a subtest. newTransport is called once per
+// subtest and must return a transport that is not shared with other
+// subtests; it is closed at the end of the subtest if the subtest did not
+// close it. Topics are unique per subtest, so transports may share a
+// broker with other traffic.
+func Run(t *testing.T, newTransport func(t *testing.T) transport.Transport) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, tr transport.Transport, topic func(string) string)
+	}{
+		{"Fields", testFields},
+		{"Topics", testTopics},
+		{"Order", testOrder},
+		{"FanOut", testFanOut},
+		{"ConcurrentPublish", testConcurrentPublish},
+		{"Unsubscribe", testUnsubscribe},
+		{"Close", testClose},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tr := newTransport(t)
+			t.Cleanup(func() { tr.Close() })
+			prefix := "transporttest." + random() + "."
+			test.run(t, tr, func(name string) string { return prefix + name })
+		})
+	}
+}
+
+func random() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// subscription is a running Subscribe call.
+type subscription struct {
+	messages chan transport.Message
+	cancel   context.CancelFunc
+	done     chan error
+}
+
+// subscribe subscribes to topics and returns once messages published on
+// every one of them arrive. Brokers set subscriptions up asynchronously, so
+// it publishes probes until one per topic came through.
+func subscribe(t *testing.T, tr transport.Transport, topics ...string) *subscription {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &subscription{messages: make(chan transport.Message, 1000), cancel: cancel, done: make(chan error, 1)}
+	t.Cleanup(s.stop)
+
+	var mu sync.Mutex
+	probed := make(map[string]bool)
+	go func() {
+		s.done <- tr.Subscribe(ctx, topics, func(msg transport.Message) {
+			if msg.Headers[probeHeader] != "" {
+				mu.Lock()
+				probed[msg.Topic] = true
+				mu.Unlock()
+				return
+			}
+			s.messages <- msg
+		})
+	}()
+
+	deadline := time.Now().Add(Timeout)
+	for _, topic := range topics {
+		for {
+			mu.Lock()
+			ok := probed[topic]
+			mu.Unlock()
+			if ok {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("no probe came through on %s within %v", topic, Timeout)
+			}
+			probe := transport.Message{Topic: topic, Origin: "transporttest", Headers: map[string]string{probeHeader: "1"}}
+			if err := tr.Publish(context.Background(), probe); err != nil {
+				t.Fatalf("publishing a probe on %s: %v", topic, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	return s
+}
+
+func (s *subscription) stop() {
+	s.cancel()
+}
+
+// next returns the next message, failing the test if none arrives.
+func (s *subscription) next(t *testing.T) transport.Message {
+	t.Helper()
+	select {
+	case msg := <-s.messages:
+		return msg
+	case <-time.After(Timeout):
+		t.Fatalf("no message within %v", Timeout)
+		return transport.Message{}
+	}
+}
+
+// none fails the test if a message arrives within a short while.
+func (s *subscription) none(t *testing.T) {
+	t.Helper()
+	select {
+	case msg := <-s.messages:
+		t.Fatalf("unexpected message on %s: %s", msg.Topic, msg.Payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func publish(t *testing.T, tr transport.Transport, msg transport.Message) {
+	t.Helper()
+	if err := tr.Publish(context.Background(), msg); err != nil {
+		t.Fatalf("publishing on %s: %v", msg.Topic, err)
+	}
+}
+
+// testFields checks that every field of a message arrives unchanged.
+func testFields(t *testing.T, tr transport.Transport, topic func(string) string) {
+	s := subscribe(t, tr, topic("fields"))
+	want := transport.Message{
+		ID:            "4f2c9a",
+		Topic:         topic("fields"),
+		Payload:       []byte("{\"text\":\"hi\"}\n\x00\xff"),
+		Origin:        "chat-1",
+		CorrelationID: "c-1",
+		ReplyTo:       "reply.c-1",
+		Headers:       map[string]string{"content-type": "application/json", "deadline": "2999-05-01T12:00:30Z"},
+	}
+	publish(t, tr, want)
+	if got := s.next(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("received %+v, want %+v", got, want)
+	}
+}
+
+// testTopics checks that a subscription receives its topics and no others.
+func testTopics(t *testing.T, tr transport.Transport, topic func(string) string) {
+	s := subscribe(t, tr, topic("a"), topic("b"))
+	for _, name := range []string{"c", "a", "b"} {
+		publish(t, tr, transport.Message{Topic: topic(name), Payload: []byte(name)})
+	}
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		got[string(s.next(t).Payload)] = true
+	}
+	if !got["a"] || !got["b"] {
+		t.Errorf("received %v, want a and b", got)
+	}
+	s.none(t)
+}
+
+// testOrder checks that messages of one publisher on one topic arrive in
+// the order they were published.
+func testOrder(t *testing.T, tr transport.Transport, topic func(string) string) {
+	s := subscribe(t, tr, topic("order"))
+	for i := 0; i < 100; i++ {
+		publish(t, tr, transport.Message{Topic: topic("order"), Origin: "sender", Payload: []byte(fmt.Sprint(i))})
+	}
+	for i := 0; i < 100; i++ {
+		if got := string(s.next(t).Payload); got != fmt.Sprint(i) {
+			t.Fatalf("message %d is %s", i, got)
+		}
+	}
+}
+
+// testFanOut checks that every subscription of a topic receives its
+// messages.
+func testFanOut(t *testing.T, tr transport.Transport, topic func(string) string) {
+	first := subscribe(t, tr, topic("fan-out"))
+	second := subscribe(t, tr, topic("fan-out"))
+	publish(t, tr, transport.Message{Topic: topic("fan-out"), Payload: []byte("hello")})
+	for _, s := range []*subscription{first, second} {
+		if got := string(s.next(t).Payload); got != "hello" {
+			t.Errorf("received %q", got)
+		}
+	}
+}
+
+// testConcurrentPublish checks that publishing from several goroutines
+// loses nothing.
+func testConcurrentPublish(t *testing.T, tr transport.Transport, topic func(string) string) {
+	const publishers, each = 8, 50
+	s := subscribe(t, tr, topic("concurrent"))
+	var wg sync.WaitGroup
+	for p := 0; p < publishers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < each; i++ {
+				msg := transport.Message{Topic: topic("concurrent"), Payload: []byte(fmt.Sprintf("%d-%d", p, i))}
+				if err := tr.Publish(context.Background(), msg); err != nil {
+					t.Errorf("publishing: %v", err)
+					return
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for i := 0; i < publishers*each; i++ {
+		seen[string(s.next(t).Payload)] = true
+	}
+	if len(seen) != publishers*each {
+		t.Errorf("received %d distinct messages, want %d", len(seen), publishers*each)
+	}
+}
+
+// testUnsubscribe checks that Subscribe returns nil once its context is
+// done, and that nothing is delivered after that.
+func testUnsubscribe(t *testing.T, tr transport.Transport, topic func(string) string) {
+	s := subscribe(t, tr, topic("unsubscribe"))
+	s.stop()
+	select {
+	case err := <-s.done:
+		if err != nil {
+			t.Errorf("Subscribe returned %v", err)
+		}
+	case <-time.After(Timeout):
+		t.Fatalf("Subscribe did not return within %v of its context being done", Timeout)
+	}
+	publish(t, tr, transport.Message{Topic: topic("unsubscribe"), Payload: []byte("late")})
+	s.none(t)
+}
+
+// testClose checks that a closed transport refuses to publish and to
+// subscribe.
+func testClose(t *testing.T, tr transport.Transport, topic func(string) string) {
+	if err := tr.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := tr.Publish(context.Background(), transport.Message{Topic: topic("closed")}); err == nil {
+		t.Error("Publish succeeded after Close")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	if err := tr.Subscribe(ctx, []string{topic("closed")}, func(transport.Message) {}); err == nil {
+		t.Error("Subscribe succeeded after Close")
+	}
+}
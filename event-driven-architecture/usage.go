@@ -0,0 +1,75 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/usage"
+)
+
+// recordUsage adds u to the usage of nick, if the server meters usage.
+func (cs *ChatServer) recordUsage(nick string, u usage.Usage) {
+	if cs.meter != nil {
+		cs.meter.Record(nick, u)
+	}
+}
+
+// checkQuota returns an error wrapping usage.ErrQuotaExceeded if the client
+// on conn has used up its quota. The rate limiter consults it as a hook.
+func (cs *ChatServer) checkQuota(conn Transportable) error {
+	if cs.meter == nil {
+		return nil
+	}
+	cs.mu.Lock()
+	nick := cs.clients[conn]
+	cs.mu.Unlock()
+
+	return cs.meter.Check(nick)
+}
+
+// rollupUsage is the usage-rollup job, which saves the usage of every
+// client to the meter's repository.
+func (cs *ChatServer) rollupUsage(ctx context.Context) error {
+	if cs.meter == nil {
+		return nil
+	}
+	return cs.meter.Rollup()
+}
+
+// UsageHandler serves the usage of the clients as JSON for
+// GET /usage?key=<nick>&from=<time>&to=<time>, to the same requests as
+// TopicAdminHandler. Without WithUsage it answers 404.
+func (cs *ChatServer) UsageHandler() http.Handler {
+	if cs.meter == nil {
+		return http.NotFoundHandler()
+	}
+	return cs.requireAdmin(cs.meter.Handler())
+}
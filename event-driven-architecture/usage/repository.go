@@ -0,0 +1,170 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// Repository persists rollups.
+type Repository interface {
+	// Save stores rollups.
+	Save(rollups []Rollup) error
+	// Query returns the rollups of key, or of every key if key is empty,
+	// whose window overlaps the range from from to to, in the order they
+	// were saved. A zero from or to leaves that end of the range open.
+	Query(key string, from, to time.Time) ([]Rollup, error)
+}
+
+// MemoryRepository keeps rollups in memory, for tests and for servers
+// that do not need them to outlive the process.
+type MemoryRepository struct {
+	maxAge time.Duration
+
+	mu      sync.Mutex
+	rollups []Rollup
+}
+
+// NewMemoryRepository returns a repository that drops rollups ending more
+// than maxAge before the last saved one. A maxAge of zero keeps them all.
+func NewMemoryRepository(maxAge time.Duration) *MemoryRepository {
+	return &MemoryRepository{maxAge: maxAge}
+}
+
+func (r *MemoryRepository) Save(rollups []Rollup) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rollups = append(r.rollups, rollups...)
+	if r.maxAge <= 0 || len(r.rollups) == 0 {
+		return nil
+	}
+	cutoff := r.rollups[len(r.rollups)-1].End.Add(-r.maxAge)
+	kept := r.rollups[:0]
+	for _, rollup := range r.rollups {
+		if !rollup.End.Before(cutoff) {
+			kept = append(kept, rollup)
+		}
+	}
+	clear(r.rollups[len(kept):])
+	r.rollups = kept
+	return nil
+}
+
+func (r *MemoryRepository) Query(key string, from, to time.Time) ([]Rollup, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var found []Rollup
+	for _, rollup := range r.rollups {
+		if matches(rollup, key, from, to) {
+			found = append(found, rollup)
+		}
+	}
+	return found, nil
+}
+
+// FileRepository appends rollups to a file as JSON lines and syncs after
+// each save.
+type FileRepository struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+func OpenFileRepository(path string) (*FileRepository, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileRepository{path: path, file: file}, nil
+}
+
+func (r *FileRepository) Save(rollups []Rollup) error {
+	var lines []byte
+	for _, rollup := range rollups {
+		line, err := json.Marshal(rollup)
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.file.Write(lines); err != nil {
+		return err
+	}
+	return r.file.Sync()
+}
+
+// Query scans the whole file, which is fine for an example; a real
+// repository would index rollups by key and time or keep them in a
+// database.
+func (r *FileRepository) Query(key string, from, to time.Time) ([]Rollup, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file, err := os.Open(r.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var found []Rollup
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rollup Rollup
+		if err := json.Unmarshal(scanner.Bytes(), &rollup); err != nil {
+			return nil, err
+		}
+		if matches(rollup, key, from, to) {
+			found = append(found, rollup)
+		}
+	}
+	return found, scanner.Err()
+}
+
+func (r *FileRepository) Close() error {
+	return r.file.Close()
+}
+
+// matches reports whether rollup belongs to the result of a query.
+func matches(rollup Rollup, key string, from, to time.Time) bool {
+	return (key == "" || rollup.Key == key) && overlaps(rollup.Start, rollup.End, from, to)
+}
@@ -0,0 +1,284 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package usage meters what each client of a server uses, such as the
+// messages and bytes it sends and the events it causes, and enforces quotas
+// on it.
+//
+// A Meter counts usage per key, typically a user or a tenant, in memory.
+// Rollup periodically moves the counts into a Repository as one Rollup per
+// key and window, so they survive a restart and can be queried later. A
+// quota limits how much a key may use per period, such as a day.
+package usage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExceeded is returned by Meter.Check for a key that has used up
+// its quota for the current period.
+var ErrQuotaExceeded = errors.New("usage: quota exceeded")
+
+// Usage is what a key used. As a quota, a zero field is not limited.
+type Usage struct {
+	Messages int64 `json:"messages"`
+	Bytes    int64 `json:"bytes"`
+	Events   int64 `json:"events"`
+}
+
+// Add returns the sum of u and v.
+func (u Usage) Add(v Usage) Usage {
+	return Usage{Messages: u.Messages + v.Messages, Bytes: u.Bytes + v.Bytes, Events: u.Events + v.Events}
+}
+
+// Rollup is the usage of a key in the window from Start to End.
+type Rollup struct {
+	Key   string    `json:"key"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Usage Usage     `json:"usage"`
+}
+
+// Report answers a query: the rollups of the queried keys and time range,
+// followed by the usage not rolled up yet, and their total.
+type Report struct {
+	Total   Usage    `json:"total"`
+	Rollups []Rollup `json:"rollups"`
+}
+
+// Meter counts usage per key and enforces a quota on it.
+type Meter struct {
+	repo Repository
+	now  func() time.Time
+
+	mu          sync.Mutex
+	start       time.Time        // of the window not rolled up yet
+	window      map[string]Usage // since start
+	quota       Usage
+	period      time.Duration
+	periodStart time.Time
+	spent       map[string]Usage // since periodStart
+}
+
+// New returns a meter that rolls usage up into repo, or into a
+// MemoryRepository that keeps every rollup if repo is nil. It enforces no
+// quota until SetQuota.
+func New(repo Repository) *Meter {
+	if repo == nil {
+		repo = NewMemoryRepository(0)
+	}
+	m := &Meter{repo: repo, now: time.Now, window: make(map[string]Usage), spent: make(map[string]Usage)}
+	m.start = m.now()
+	return m
+}
+
+// SetQuota limits how much each key may use per period. Periods are aligned
+// to multiples of period since the zero time, so a period of 24 hours starts
+// at midnight UTC. The usage the repository holds for the current period
+// counts against the quota, so a restart does not reset it. A zero quota
+// turns the limit off.
+func (m *Meter) SetQuota(quota Usage, period time.Duration) error {
+	if quota != (Usage{}) && period <= 0 {
+		return fmt.Errorf("usage: quota period must be positive, not %s", period)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.quota, m.period = quota, period
+	m.spent = make(map[string]Usage)
+	if quota == (Usage{}) {
+		return nil
+	}
+	now := m.now()
+	m.periodStart = now.Truncate(period)
+	rollups, err := m.repo.Query("", m.periodStart, now)
+	if err != nil {
+		return err
+	}
+	for _, r := range rollups {
+		m.spent[r.Key] = m.spent[r.Key].Add(r.Usage)
+	}
+	for key, u := range m.window {
+		m.spent[key] = m.spent[key].Add(u)
+	}
+	return nil
+}
+
+// Record adds u to the usage of key.
+func (m *Meter) Record(key string, u Usage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.advance()
+	m.window[key] = m.window[key].Add(u)
+	if m.quota != (Usage{}) {
+		m.spent[key] = m.spent[key].Add(u)
+	}
+}
+
+// Check returns an error wrapping ErrQuotaExceeded if key has used all of
+// its quota of any kind for the current period, and nil otherwise.
+func (m *Meter) Check(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.advance()
+	spent, quota := m.spent[key], m.quota
+	switch {
+	case quota.Messages > 0 && spent.Messages >= quota.Messages:
+		return fmt.Errorf("%w: %d of %d messages", ErrQuotaExceeded, spent.Messages, quota.Messages)
+	case quota.Bytes > 0 && spent.Bytes >= quota.Bytes:
+		return fmt.Errorf("%w: %d of %d bytes", ErrQuotaExceeded, spent.Bytes, quota.Bytes)
+	case quota.Events > 0 && spent.Events >= quota.Events:
+		return fmt.Errorf("%w: %d of %d events", ErrQuotaExceeded, spent.Events, quota.Events)
+	}
+	return nil
+}
+
+// advance starts a new quota period once the current one is over. It must
+// be called with m.mu held.
+func (m *Meter) advance() {
+	if m.quota == (Usage{}) {
+		return
+	}
+	if now := m.now(); !now.Before(m.periodStart.Add(m.period)) {
+		m.periodStart = now.Truncate(m.period)
+		m.spent = make(map[string]Usage)
+	}
+}
+
+// Rollup saves the usage counted since the last rollup to the repository,
+// one Rollup per key, and starts a new window. If the repository fails, the
+// usage stays in the window and is saved by the next rollup.
+func (m *Meter) Rollup() error {
+	m.mu.Lock()
+	start, window := m.start, m.window
+	end := m.now()
+	m.start, m.window = end, make(map[string]Usage)
+	m.mu.Unlock()
+
+	rollups := rollupsOf(window, start, end)
+	if len(rollups) == 0 {
+		return nil
+	}
+	if err := m.repo.Save(rollups); err != nil {
+		m.mu.Lock()
+		for key, u := range m.window {
+			window[key] = window[key].Add(u)
+		}
+		m.start, m.window = start, window
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Query reports the usage of key, or of every key if key is empty, from
+// from to to. A zero from or to leaves that end of the range open. The
+// usage not rolled up yet is included as rollups that end now.
+func (m *Meter) Query(key string, from, to time.Time) (Report, error) {
+	m.mu.Lock()
+	start, end := m.start, m.now()
+	window := make(map[string]Usage, len(m.window))
+	for k, u := range m.window {
+		if key == "" || k == key {
+			window[k] = u
+		}
+	}
+	m.mu.Unlock()
+
+	rollups, err := m.repo.Query(key, from, to)
+	if err != nil {
+		return Report{}, err
+	}
+	if overlaps(start, end, from, to) {
+		rollups = append(rollups, rollupsOf(window, start, end)...)
+	}
+	report := Report{Rollups: rollups}
+	if report.Rollups == nil {
+		report.Rollups = []Rollup{}
+	}
+	for _, r := range rollups {
+		report.Total = report.Total.Add(r.Usage)
+	}
+	return report, nil
+}
+
+// Handler serves Query over HTTP. GET ?key=alice&from=...&to=..., with the
+// times in RFC 3339, returns the Report as JSON.
+func (m *Meter) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		var times [2]time.Time
+		for i, name := range []string{"from", "to"} {
+			if v := query.Get(name); v != "" {
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("invalid %s: %v", name, err), http.StatusBadRequest)
+					return
+				}
+				times[i] = t
+			}
+		}
+		report, err := m.Query(query.Get("key"), times[0], times[1])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	})
+}
+
+// rollupsOf returns the rollups of window, sorted by key.
+func rollupsOf(window map[string]Usage, start, end time.Time) []Rollup {
+	rollups := make([]Rollup, 0, len(window))
+	for key, u := range window {
+		rollups = append(rollups, Rollup{Key: key, Start: start, End: end, Usage: u})
+	}
+	sort.Slice(rollups, func(i, j int) bool { return rollups[i].Key < rollups[j].Key })
+	return rollups
+}
+
+// overlaps reports whether the window from start to end overlaps the range
+// from from to to, either of which may be zero for an open end.
+func overlaps(start, end, from, to time.Time) bool {
+	return (from.IsZero() || end.After(from)) && (to.IsZero() || start.Before(to))
+}
@@ -0,0 +1,171 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package usage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// clock is a time that tests move by hand.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func newMeter(t *testing.T, repo Repository) (*Meter, *clock) {
+	t.Helper()
+	c := &clock{t: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	m := New(repo)
+	m.now, m.start = c.now, c.t
+	return m, c
+}
+
+// TestQuota checks that a key is refused once it used its quota, that other
+// keys are not, and that the next period starts afresh.
+func TestQuota(t *testing.T) {
+	m, c := newMeter(t, nil)
+	if err := m.SetQuota(Usage{Messages: 2}, 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := m.Check("alice"); err != nil {
+			t.Fatalf("message %d: %v", i+1, err)
+		}
+		m.Record("alice", Usage{Messages: 1, Bytes: 5})
+	}
+	if err := m.Check("alice"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("third message: got %v, want ErrQuotaExceeded", err)
+	}
+	if err := m.Check("bob"); err != nil {
+		t.Errorf("bob: %v", err)
+	}
+
+	c.t = c.t.Add(14 * time.Hour)
+	if err := m.Check("alice"); err != nil {
+		t.Errorf("next day: %v", err)
+	}
+}
+
+// TestQuotaSurvivesRestart checks that a new meter counts the usage rolled
+// up by the previous one in the same period.
+func TestQuotaSurvivesRestart(t *testing.T) {
+	repo := NewMemoryRepository(0)
+	m, c := newMeter(t, repo)
+	m.Record("alice", Usage{Bytes: 100})
+	c.t = c.t.Add(time.Minute)
+	if err := m.Rollup(); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, _ := newMeter(t, repo)
+	restarted.now = c.now
+	if err := restarted.SetQuota(Usage{Bytes: 100}, 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.Check("alice"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("got %v, want ErrQuotaExceeded", err)
+	}
+}
+
+// TestRollupAndQuery checks that rollups are saved per key and window, and
+// that queries add the usage not rolled up yet.
+func TestRollupAndQuery(t *testing.T) {
+	repo, err := OpenFileRepository(filepath.Join(t.TempDir(), "usage.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	m, c := newMeter(t, repo)
+	start := c.t
+
+	m.Record("alice", Usage{Messages: 1, Bytes: 5, Events: 1})
+	m.Record("bob", Usage{Events: 1})
+	c.t = c.t.Add(time.Minute)
+	if err := m.Rollup(); err != nil {
+		t.Fatal(err)
+	}
+	m.Record("alice", Usage{Messages: 1, Bytes: 7, Events: 1})
+	c.t = c.t.Add(30 * time.Second)
+
+	saved, err := repo.Query("", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Rollup{
+		{Key: "alice", Start: start, End: start.Add(time.Minute), Usage: Usage{Messages: 1, Bytes: 5, Events: 1}},
+		{Key: "bob", Start: start, End: start.Add(time.Minute), Usage: Usage{Events: 1}},
+	}
+	if len(saved) != len(want) {
+		t.Fatalf("saved %+v, want %+v", saved, want)
+	}
+	for i := range want {
+		if !saved[i].Start.Equal(want[i].Start) || !saved[i].End.Equal(want[i].End) ||
+			saved[i].Key != want[i].Key || saved[i].Usage != want[i].Usage {
+			t.Errorf("rollup %d: got %+v, want %+v", i, saved[i], want[i])
+		}
+	}
+
+	report, err := m.Query("alice", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Usage{Messages: 2, Bytes: 12, Events: 2}); report.Total != want || len(report.Rollups) != 2 {
+		t.Errorf("alice: got %+v, want a total of %+v in 2 rollups", report, want)
+	}
+	report, err = m.Query("", start.Add(time.Minute), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Usage{Messages: 1, Bytes: 7, Events: 1}); report.Total != want {
+		t.Errorf("after the first minute: got %+v, want %+v", report.Total, want)
+	}
+}
+
+// TestMemoryRepositoryMaxAge checks that old rollups are dropped once a
+// newer one is saved.
+func TestMemoryRepositoryMaxAge(t *testing.T) {
+	repo := NewMemoryRepository(time.Hour)
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		end := start.Add(time.Duration(i+1) * time.Hour)
+		if err := repo.Save([]Rollup{{Key: "alice", Start: end.Add(-time.Hour), End: end}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kept, err := repo.Query("", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 2 || !kept[0].End.Equal(start.Add(2*time.Hour)) {
+		t.Errorf("kept %+v, want the last two hours", kept)
+	}
+}
@@ -0,0 +1,365 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package websocket implements the server side of the WebSocket protocol
+// (RFC 6455) to the extent the chat example needs it: the opening handshake,
+// text and binary messages, fragmentation, ping/pong and the closing
+// handshake. Extensions such as compression are not supported.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// acceptGUID is the fixed GUID from RFC 6455 used to compute the
+// Sec-WebSocket-Accept header.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// MaxMessageSize bounds the size of a message assembled from frames.
+const MaxMessageSize = 1 << 20
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// maxControlPayload is the largest payload of a control frame.
+const maxControlPayload = 125
+
+// closeProtocolError is the status code of a close frame sent because the
+// peer broke the protocol.
+const closeProtocolError = 1002
+
+var (
+	ErrBadHandshake    = errors.New("websocket: bad handshake")
+	ErrBadOrigin       = errors.New("websocket: origin not allowed")
+	ErrMessageTooLarge = errors.New("websocket: message too large")
+	errProtocol        = errors.New("websocket: protocol error")
+)
+
+// Conn is a WebSocket connection. Each Read returns data from a single
+// message, and each Write is sent as one text message, so message
+// boundaries survive as long as the caller's buffer is large enough.
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	writeMu sync.Mutex
+	pending []byte
+	closed  bool
+}
+
+// Upgrader performs opening handshakes. A browser lets any page it shows
+// open a WebSocket connection, with the user's cookies, and tells the
+// server which site the page came from in the Origin header. The upgrader
+// only accepts pages from the server's own host and from AllowedOrigins, so
+// a page on another site cannot talk to the server as its user. Requests
+// without an Origin header do not come from a browser page and are
+// accepted.
+type Upgrader struct {
+	// AllowedOrigins lists the other origins whose pages may connect, such
+	// as "https://chat.example.com". "*" allows every origin.
+	AllowedOrigins []string
+}
+
+// Upgrade performs the opening handshake with an Upgrader that accepts
+// pages from the server's own host only.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	var u Upgrader
+	return u.Upgrade(w, r)
+}
+
+// Upgrade performs the opening handshake and takes over the underlying
+// connection from the HTTP server.
+func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" {
+		http.Error(w, "expected a WebSocket upgrade request", http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, ErrBadHandshake
+	}
+	if !u.allowed(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return nil, ErrBadOrigin
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection cannot be upgraded", http.StatusInternalServerError)
+		return nil, ErrBadHandshake
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Conn{conn: conn, br: rw.Reader}, nil
+}
+
+// allowed reports whether the page that sent r may connect.
+func (u *Upgrader) allowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if parsed, err := url.Parse(origin); err == nil && strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range u.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Read reads message data. Control frames are handled internally; a close
+// frame from the peer is answered and reported as io.EOF. A peer that
+// breaks the protocol is sent a close frame with status 1002 and
+// disconnected.
+func (c *Conn) Read(p []byte) (int, error) {
+	if len(c.pending) == 0 {
+		msg, err := c.readMessage()
+		if errors.Is(err, errProtocol) {
+			c.writeFrame(opClose, closePayload(closeProtocolError))
+			c.conn.Close()
+		}
+		if err != nil {
+			return 0, err
+		}
+		c.pending = msg
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write sends p as a single text message.
+func (c *Conn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(opText, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close sends a close frame and closes the connection.
+func (c *Conn) Close() error {
+	c.writeFrame(opClose, closePayload(1000)) // normal closure
+	return c.conn.Close()
+}
+
+func closePayload(code uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, code)
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetReadDeadline sets the deadline for reading the next frames, including
+// the control frames handled by Read.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for writing frames.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *Conn) readMessage() ([]byte, error) {
+	var msg []byte
+	started := false
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			c.writeFrame(opClose, nil)
+			c.conn.Close()
+			return nil, io.EOF
+		case opText, opBinary:
+			if started {
+				return nil, errProtocol
+			}
+			started = true
+		case opContinuation:
+			if !started {
+				return nil, errProtocol
+			}
+		default:
+			return nil, errProtocol
+		}
+
+		if len(msg)+len(payload) > MaxMessageSize {
+			return nil, ErrMessageTooLarge
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+func (c *Conn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(c.br, header[:]); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	// Clients must mask every frame they send.
+	if !masked || header[0]&0x70 != 0 {
+		err = errProtocol
+		return
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	// Control frames are small and never fragmented, so they can be
+	// answered between the frames of a message.
+	if opcode&0x8 != 0 && (!fin || length > maxControlPayload) {
+		err = errProtocol
+		return
+	}
+	if length > MaxMessageSize {
+		err = ErrMessageTooLarge
+		return
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closed {
+		return net.ErrClosed
+	}
+	if opcode == opClose {
+		c.closed = true
+	}
+
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|opcode)
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+
+	if _, err := c.conn.Write(frame); err != nil {
+		return fmt.Errorf("websocket: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// serve runs a server that upgrades every request with u and reads until
+// the connection fails.
+func serve(t *testing.T, u *Upgrader) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := u.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		buf := make([]byte, 512)
+		for {
+			if _, err := conn.Read(buf); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// handshake sends an opening handshake from origin, if it is not empty, and
+// returns the response and a reader for the frames that follow it.
+func handshake(t *testing.T, srv *httptest.Server, origin string) (net.Conn, *http.Response, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/chat", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, resp, br
+}
+
+// frame returns a masked client frame.
+func frame(fin bool, opcode byte, payload []byte) []byte {
+	b := []byte{opcode}
+	if fin {
+		b[0] |= 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		b = append(b, 0x80|byte(n))
+	default:
+		b = append(b, 0x80|126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	}
+	mask := []byte{1, 2, 3, 4}
+	b = append(b, mask...)
+	for i, c := range payload {
+		b = append(b, c^mask[i%4])
+	}
+	return b
+}
+
+func TestOrigin(t *testing.T) {
+	srv := serve(t, &Upgrader{AllowedOrigins: []string{"https://chat.example.com"}})
+	for origin, want := range map[string]int{
+		"":                               http.StatusSwitchingProtocols,
+		srv.URL:                          http.StatusSwitchingProtocols,
+		"https://chat.example.com":       http.StatusSwitchingProtocols,
+		"https://evil.example.com":       http.StatusForbidden,
+		"http://chat.example.com":        http.StatusForbidden,
+		"https://chat.example.com.evil.": http.StatusForbidden,
+	} {
+		if _, resp, _ := handshake(t, srv, origin); resp.StatusCode != want {
+			t.Errorf("origin %q: got status %d, want %d", origin, resp.StatusCode, want)
+		}
+	}
+
+	open := serve(t, &Upgrader{AllowedOrigins: []string{"*"}})
+	if _, resp, _ := handshake(t, open, "https://evil.example.com"); resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("any origin: got status %d", resp.StatusCode)
+	}
+}
+
+// TestMalformedControlFrames checks that control frames over 125 bytes or
+// without FIN close the connection with status 1002.
+func TestMalformedControlFrames(t *testing.T) {
+	srv := serve(t, &Upgrader{})
+	for name, f := range map[string][]byte{
+		"oversized ping":  frame(true, opPing, bytes.Repeat([]byte("x"), 126)),
+		"fragmented ping": frame(false, opPing, []byte("hi")),
+		"oversized close": frame(true, opClose, append(closePayload(1000), bytes.Repeat([]byte("x"), 124)...)),
+	} {
+		conn, resp, br := handshake(t, srv, "")
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			t.Fatalf("%s: handshake got status %d", name, resp.StatusCode)
+		}
+		if _, err := conn.Write(f); err != nil {
+			t.Fatal(err)
+		}
+		var close [4]byte
+		if _, err := io.ReadFull(br, close[:]); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if close[0] != 0x80|opClose || close[1] != 2 || binary.BigEndian.Uint16(close[2:]) != closeProtocolError {
+			t.Errorf("%s: got frame % x, want a close frame with status 1002", name, close)
+		}
+		if _, err := br.ReadByte(); err != io.EOF {
+			t.Errorf("%s: connection still open: %v", name, err)
+		}
+	}
+
+	// A ping of exactly 125 bytes is fine and answered.
+	conn, _, br := handshake(t, srv, "")
+	payload := bytes.Repeat([]byte("x"), maxControlPayload)
+	conn.Write(frame(true, opPing, payload))
+	pong := make([]byte, 2+len(payload))
+	if _, err := io.ReadFull(br, pong); err != nil {
+		t.Fatal(err)
+	}
+	if pong[0] != 0x80|opPong || !bytes.Equal(pong[2:], payload) {
+		t.Errorf("got frame % x, want a pong", pong[:2])
+	}
+}
@@ -0,0 +1,259 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package workerpool
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// Order is the order in which the workers of a pool take queued jobs.
+type Order int
+
+const (
+	// FIFO runs jobs in the order they were queued.
+	FIFO Order = iota
+	// EarliestDeadlineFirst runs the queued job with the earliest deadline
+	// next. Jobs without a deadline run after every job with one, in the
+	// order they were queued.
+	EarliestDeadlineFirst
+)
+
+// Deadliner is implemented by jobs that have a deadline, which an
+// EarliestDeadlineFirst pool orders them by. A zero deadline means none.
+type Deadliner interface {
+	Deadline() time.Time
+}
+
+type inheritedKey struct{}
+
+// InheritDeadline returns a copy of ctx that passes deadline on to the
+// jobs queued with it. A job queued on an EarliestDeadlineFirst pool with
+// Submit or Go runs no later in the order than its own deadline or the
+// inherited one, whichever is earlier. So follow-up work of an urgent job
+// does not queue behind work that is less urgent than the job itself. The
+// pool runs every job with a context that passes on the job's deadline.
+//
+// Unlike context.WithDeadline, the inherited deadline cancels nothing; it
+// only orders the queue.
+func InheritDeadline(ctx context.Context, deadline time.Time) context.Context {
+	if inherited, ok := InheritedDeadline(ctx); ok && !inherited.After(deadline) {
+		return ctx
+	}
+	return context.WithValue(ctx, inheritedKey{}, deadline)
+}
+
+// InheritedDeadline returns the deadline ctx passes on, if any.
+func InheritedDeadline(ctx context.Context) (time.Time, bool) {
+	deadline, ok := ctx.Value(inheritedKey{}).(time.Time)
+	return deadline, ok
+}
+
+// earliest returns the earlier of two deadlines, where zero means none.
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+// queue is the bounded queue of a pool. A job takes a slot before it is
+// pushed, which bounds the queue, and announces itself on ready once it is
+// in the heap. A worker that receives from ready pops the job first in
+// order, so the number of announced jobs never exceeds the jobs in the
+// heap.
+type queue struct {
+	order Order
+	slots chan struct{}
+	ready chan struct{}
+
+	mu    sync.Mutex
+	tasks taskHeap
+	seq   uint64
+}
+
+func newQueue(size int, order Order) *queue {
+	return &queue{
+		order: order,
+		slots: make(chan struct{}, size),
+		ready: make(chan struct{}, size),
+		tasks: taskHeap{order: order},
+	}
+}
+
+// put queues t, waiting for a slot until ctx or done is.
+func (q *queue) put(ctx context.Context, done <-chan struct{}, t *task) error {
+	select {
+	case q.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return ErrClosed
+	}
+	q.push(t)
+	return nil
+}
+
+// tryPut queues t if there is a free slot.
+func (q *queue) tryPut(t *task) error {
+	select {
+	case q.slots <- struct{}{}:
+	default:
+		return ErrFull
+	}
+	q.push(t)
+	return nil
+}
+
+func (q *queue) push(t *task) {
+	q.mu.Lock()
+	t.seq = q.seq
+	q.seq++
+	heap.Push(&q.tasks, t)
+	q.mu.Unlock()
+	q.ready <- struct{}{}
+}
+
+// take pops the next task. The caller must have received from ready.
+func (q *queue) take() *task {
+	q.mu.Lock()
+	t := heap.Pop(&q.tasks).(*task)
+	q.mu.Unlock()
+	<-q.slots
+	return t
+}
+
+// tryTake pops the next task if there is one.
+func (q *queue) tryTake() (*task, bool) {
+	select {
+	case <-q.ready:
+		return q.take(), true
+	default:
+		return nil, false
+	}
+}
+
+// remove takes the tasks drop reports true for out of the queue. The
+// others keep their place.
+func (q *queue) remove(drop func(*task) bool) []*task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var matched, removed []*task
+	for _, t := range q.tasks.items {
+		if drop(t) {
+			matched = append(matched, t)
+		}
+	}
+	for _, t := range matched {
+		// Every removed task takes an announcement with it, so that no
+		// worker waits for a task that is gone. A task pushed but not yet
+		// announced is left for the next call.
+		select {
+		case <-q.ready:
+		default:
+			return removed
+		}
+		heap.Remove(&q.tasks, t.index)
+		<-q.slots
+		removed = append(removed, t)
+	}
+	return removed
+}
+
+// removeOldest takes the task queued first out of the queue.
+func (q *queue) removeOldest() (*task, bool) {
+	select {
+	case <-q.ready:
+	default:
+		return nil, false
+	}
+	q.mu.Lock()
+	oldest := 0
+	for i, t := range q.tasks.items {
+		if t.seq < q.tasks.items[oldest].seq {
+			oldest = i
+		}
+	}
+	t := heap.Remove(&q.tasks, oldest).(*task)
+	q.mu.Unlock()
+	<-q.slots
+	return t, true
+}
+
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.tasks.items)
+}
+
+// taskHeap orders tasks for container/heap.
+type taskHeap struct {
+	order Order
+	items []*task
+}
+
+func (h taskHeap) Len() int { return len(h.items) }
+
+func (h taskHeap) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if h.order == EarliestDeadlineFirst && !a.deadline.Equal(b.deadline) {
+		switch {
+		case a.deadline.IsZero():
+			return false
+		case b.deadline.IsZero():
+			return true
+		default:
+			return a.deadline.Before(b.deadline)
+		}
+	}
+	return a.seq < b.seq
+}
+
+func (h taskHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+func (h *taskHeap) Push(x interface{}) {
+	t := x.(*task)
+	t.index = len(h.items)
+	h.items = append(h.items, t)
+}
+
+func (h *taskHeap) Pop() interface{} {
+	last := len(h.items) - 1
+	t := h.items[last]
+	h.items[last] = nil
+	h.items = h.items[:last]
+	return t
+}
@@ -0,0 +1,409 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package workerpool runs jobs on a bounded number of goroutines fed from a
+// bounded queue, in the order they were queued or earliest deadline first.
+// The pool can be resized while it runs, drains its queue when closed, and
+// keeps a panicking job from taking its worker, or the process, down with
+// it.
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrFull is returned by TrySubmit when the queue is full.
+	ErrFull = errors.New("workerpool: queue is full")
+	// ErrClosed is returned when submitting to a closed pool.
+	ErrClosed = errors.New("workerpool: pool is closed")
+	// ErrDropped is the result of a job removed by DropOldest.
+	ErrDropped = errors.New("workerpool: job dropped")
+)
+
+// Job is a unit of work. Run gets a context that is cancelled when the
+// pool is closed and its deadline passes without the queue being drained.
+type Job interface {
+	Run(ctx context.Context) (interface{}, error)
+}
+
+// JobFunc adapts a function to the Job interface.
+type JobFunc func(ctx context.Context) (interface{}, error)
+
+func (f JobFunc) Run(ctx context.Context) (interface{}, error) {
+	return f(ctx)
+}
+
+// PanicError is the error of a job that panicked.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("workerpool: job panicked: %v", e.Value)
+}
+
+// Future is the pending result of a submitted job.
+type Future struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// Done is closed once the job has finished or was dropped.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the job has finished or ctx is done.
+func (f *Future) Wait(ctx context.Context) (interface{}, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (f *Future) resolve(value interface{}, err error) {
+	if f == nil {
+		return
+	}
+	f.value, f.err = value, err
+	close(f.done)
+}
+
+type task struct {
+	job    Job
+	future *Future // nil for jobs queued with Go or TryGo
+
+	// deadline orders the task in an EarliestDeadlineFirst queue; seq and
+	// index are its place in the queue.
+	deadline time.Time
+	seq      uint64
+	index    int
+}
+
+// newTask returns the task of running job, with the deadline of the job
+// or the one inherited through ctx, whichever is earlier.
+func newTask(ctx context.Context, job Job, future *Future) *task {
+	t := &task{job: job, future: future}
+	if d, ok := job.(Deadliner); ok {
+		t.deadline = d.Deadline()
+	}
+	if inherited, ok := InheritedDeadline(ctx); ok {
+		t.deadline = earliest(t.deadline, inherited)
+	}
+	return t
+}
+
+// Config sizes a pool.
+type Config struct {
+	// Workers is the number of goroutines running jobs (1 if zero).
+	Workers int
+	// QueueSize is how many jobs may wait for a worker (1 if zero).
+	QueueSize int
+	// Order is the order in which workers take queued jobs (FIFO).
+	Order Order
+	// OnPanic, if set, is called on the worker's goroutine after a job
+	// panicked. The worker carries on with the next job either way.
+	OnPanic func(job Job, err *PanicError)
+}
+
+// Stats are the counters of a pool.
+type Stats struct {
+	Workers   int    `json:"workers"`
+	Busy      int64  `json:"busy"`
+	Queued    int    `json:"queued"`
+	Completed uint64 `json:"completed"`
+	Failed    uint64 `json:"failed"`
+	Panicked  uint64 `json:"panicked"`
+	Dropped   uint64 `json:"dropped"`
+}
+
+type Pool struct {
+	queue   *queue
+	onPanic func(Job, *PanicError)
+
+	mu sync.Mutex
+	// quits holds a channel per worker, which Resize closes to retire it.
+	// Its length is the number of workers.
+	quits   []chan struct{}
+	running sync.WaitGroup
+
+	closed    atomic.Bool
+	done      chan struct{}
+	closeOnce sync.Once
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	busy      atomic.Int64
+	completed atomic.Uint64
+	failed    atomic.Uint64
+	panicked  atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// New starts a pool with cfg.Workers workers.
+func New(cfg Config) *Pool {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize < 1 {
+		cfg.QueueSize = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		queue:   newQueue(cfg.QueueSize, cfg.Order),
+		onPanic: cfg.OnPanic,
+		done:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	p.Resize(cfg.Workers)
+	return p
+}
+
+// Resize changes the number of workers. Extra workers start at once;
+// surplus workers stop after the job they are running.
+func (p *Pool) Resize(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed.Load() {
+		return
+	}
+	for len(p.quits) < workers {
+		quit := make(chan struct{})
+		p.quits = append(p.quits, quit)
+		p.running.Add(1)
+		go p.work(quit)
+	}
+	for len(p.quits) > workers {
+		last := len(p.quits) - 1
+		close(p.quits[last])
+		p.quits = p.quits[:last]
+	}
+}
+
+// Submit queues job, waiting for room in the queue until ctx is done or
+// the pool is closed. The returned future carries the job's result.
+func (p *Pool) Submit(ctx context.Context, job Job) (*Future, error) {
+	t := newTask(ctx, job, &Future{done: make(chan struct{})})
+	if err := p.put(ctx, t); err != nil {
+		return nil, err
+	}
+	return t.future, nil
+}
+
+// TrySubmit queues job if there is room, and returns ErrFull otherwise.
+func (p *Pool) TrySubmit(job Job) (*Future, error) {
+	t := newTask(context.Background(), job, &Future{done: make(chan struct{})})
+	if err := p.tryPut(t); err != nil {
+		return nil, err
+	}
+	return t.future, nil
+}
+
+// Go is like Submit for jobs whose result nobody waits for. It saves
+// allocating a future.
+func (p *Pool) Go(ctx context.Context, job Job) error {
+	return p.put(ctx, newTask(ctx, job, nil))
+}
+
+// TryGo is like TrySubmit for jobs whose result nobody waits for.
+func (p *Pool) TryGo(job Job) error {
+	return p.tryPut(newTask(context.Background(), job, nil))
+}
+
+func (p *Pool) put(ctx context.Context, t *task) error {
+	if p.closed.Load() {
+		return ErrClosed
+	}
+	return p.queue.put(ctx, p.done, t)
+}
+
+func (p *Pool) tryPut(t *task) error {
+	if p.closed.Load() {
+		return ErrClosed
+	}
+	return p.queue.tryPut(t)
+}
+
+// DropOldest removes the job that has waited longest, if any, and resolves
+// its future with ErrDropped. Together with TrySubmit it lets callers make
+// room for new work at the expense of old.
+func (p *Pool) DropOldest() (Job, bool) {
+	t, ok := p.queue.removeOldest()
+	if !ok {
+		return nil, false
+	}
+	p.dropped.Add(1)
+	t.future.resolve(nil, ErrDropped)
+	return t.job, true
+}
+
+// Remove takes the queued jobs that drop reports true for out of the queue,
+// resolves their futures with ErrDropped and returns them. The jobs that
+// stay keep their place.
+func (p *Pool) Remove(drop func(Job) bool) []Job {
+	removed := p.queue.remove(func(t *task) bool { return drop(t.job) })
+	jobs := make([]Job, len(removed))
+	for i, t := range removed {
+		p.dropped.Add(1)
+		t.future.resolve(nil, ErrDropped)
+		jobs[i] = t.job
+	}
+	return jobs
+}
+
+// Queued returns the number of jobs waiting for a worker.
+func (p *Pool) Queued() int {
+	return p.queue.len()
+}
+
+// Capacity returns the size of the queue.
+func (p *Pool) Capacity() int {
+	return cap(p.queue.slots)
+}
+
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	workers := len(p.quits)
+	p.mu.Unlock()
+
+	return Stats{
+		Workers:   workers,
+		Busy:      p.busy.Load(),
+		Queued:    p.queue.len(),
+		Completed: p.completed.Load(),
+		Failed:    p.failed.Load(),
+		Panicked:  p.panicked.Load(),
+		Dropped:   p.dropped.Load(),
+	}
+}
+
+// work runs jobs until quit is closed, or until the pool is closed and
+// the queue drained.
+func (p *Pool) work(quit <-chan struct{}) {
+	defer p.running.Done()
+
+	for {
+		select {
+		case <-p.queue.ready:
+			p.run(p.queue.take())
+		case <-quit:
+			return
+		case <-p.done:
+			p.drain()
+			return
+		}
+	}
+}
+
+// drain runs the jobs still queued when the pool was closed.
+func (p *Pool) drain() {
+	for {
+		t, ok := p.queue.tryTake()
+		if !ok {
+			return
+		}
+		p.run(t)
+	}
+}
+
+func (p *Pool) run(t *task) {
+	p.busy.Add(1)
+	defer p.busy.Add(-1)
+
+	var value interface{}
+	var err error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				perr := &PanicError{Value: r, Stack: debug.Stack()}
+				err = perr
+				p.panicked.Add(1)
+				if p.onPanic != nil {
+					p.onPanic(t.job, perr)
+				}
+			}
+		}()
+		ctx := p.ctx
+		if !t.deadline.IsZero() {
+			ctx = InheritDeadline(ctx, t.deadline)
+		}
+		value, err = t.job.Run(ctx)
+	}()
+
+	if err != nil {
+		p.failed.Add(1)
+	} else {
+		p.completed.Add(1)
+	}
+	t.future.resolve(value, err)
+}
+
+// Close stops the pool from accepting jobs, wakes up blocked submitters,
+// and waits for the workers to run the jobs already queued. If ctx expires
+// first, Close cancels the context passed to the jobs and returns ctx's
+// error; the workers finish draining in the background. Jobs submitted
+// concurrently with Close may never run.
+func (p *Pool) Close(ctx context.Context) error {
+	p.closeOnce.Do(func() {
+		p.mu.Lock()
+		p.closed.Store(true)
+		p.mu.Unlock()
+		close(p.done)
+	})
+
+	drained := make(chan struct{})
+	go func() {
+		p.running.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,223 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package workerpool
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/leakcheck/leakcheck"
+)
+
+// deadlineJob records its name when it runs.
+type deadlineJob struct {
+	name     string
+	deadline time.Time
+	ran      *recorder
+}
+
+func (j deadlineJob) Deadline() time.Time { return j.deadline }
+
+func (j deadlineJob) Run(ctx context.Context) (interface{}, error) {
+	j.ran.add(j.name)
+	return nil, nil
+}
+
+type recorder struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (r *recorder) add(name string) {
+	r.mu.Lock()
+	r.names = append(r.names, name)
+	r.mu.Unlock()
+}
+
+func (r *recorder) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.names...)
+}
+
+// blocked returns a pool with one worker that is busy until the returned
+// function is called, so that jobs queue up behind it.
+func blocked(t *testing.T, order Order) (*Pool, func()) {
+	t.Helper()
+	leakcheck.Check(t)
+	p := New(Config{Workers: 1, QueueSize: 16, Order: order})
+	release := make(chan struct{})
+	started := make(chan struct{})
+	p.Go(context.Background(), JobFunc(func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	}))
+	<-started
+	t.Cleanup(func() { p.Close(context.Background()) })
+	return p, func() { close(release) }
+}
+
+func queueJobs(t *testing.T, p *Pool, ran *recorder) {
+	t.Helper()
+	now := time.Now()
+	jobs := []deadlineJob{
+		{name: "none-1"},
+		{name: "late", deadline: now.Add(3 * time.Second)},
+		{name: "early", deadline: now.Add(time.Second)},
+		{name: "none-2"},
+		{name: "middle", deadline: now.Add(2 * time.Second)},
+	}
+	for _, job := range jobs {
+		job.ran = ran
+		if err := p.TryGo(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func waitFor(t *testing.T, ran *recorder, n int) []string {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		if names := ran.get(); len(names) >= n {
+			return names
+		}
+	}
+	t.Fatalf("only %v ran", ran.get())
+	return nil
+}
+
+func TestFIFO(t *testing.T) {
+	p, release := blocked(t, FIFO)
+	ran := &recorder{}
+	queueJobs(t, p, ran)
+	release()
+
+	want := []string{"none-1", "late", "early", "none-2", "middle"}
+	if got := waitFor(t, ran, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %v, want %v", got, want)
+	}
+}
+
+func TestEarliestDeadlineFirst(t *testing.T) {
+	p, release := blocked(t, EarliestDeadlineFirst)
+	ran := &recorder{}
+	queueJobs(t, p, ran)
+	release()
+
+	want := []string{"early", "middle", "late", "none-1", "none-2"}
+	if got := waitFor(t, ran, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %v, want %v", got, want)
+	}
+}
+
+// TestInheritDeadline checks that a job queued by an urgent job runs
+// before the less urgent jobs that were queued earlier.
+func TestInheritDeadline(t *testing.T) {
+	p, release := blocked(t, EarliestDeadlineFirst)
+	ran := &recorder{}
+	queueJobs(t, p, ran)
+	urgent := time.Now().Add(500 * time.Millisecond)
+	// The urgent job has no deadline of its own: it inherits one from
+	// the context it was queued with.
+	p.Go(InheritDeadline(context.Background(), urgent), JobFunc(func(ctx context.Context) (interface{}, error) {
+		ran.add("urgent")
+		if inherited, ok := InheritedDeadline(ctx); !ok || !inherited.Equal(urgent) {
+			t.Errorf("job runs with inherited deadline %v, %v, want %v", inherited, ok, urgent)
+		}
+		return nil, p.Go(ctx, deadlineJob{name: "follow-up", ran: ran})
+	}))
+	release()
+
+	got := waitFor(t, ran, 7)
+	if got[0] != "urgent" || got[1] != "follow-up" {
+		t.Errorf("ran %v, want the inheriting job and its follow-up first", got)
+	}
+}
+
+func TestRemoveKeepsOrder(t *testing.T) {
+	p, release := blocked(t, EarliestDeadlineFirst)
+	ran := &recorder{}
+	queueJobs(t, p, ran)
+
+	removed := p.Remove(func(job Job) bool {
+		name := job.(deadlineJob).name
+		return name == "middle" || name == "none-1"
+	})
+	if len(removed) != 2 || p.Queued() != 3 {
+		t.Fatalf("removed %d jobs, %d left, want 2 and 3", len(removed), p.Queued())
+	}
+	if job, ok := p.DropOldest(); !ok || job.(deadlineJob).name != "late" {
+		t.Fatalf("DropOldest dropped %v, want the job queued first", job)
+	}
+	release()
+
+	want := []string{"early", "none-2"}
+	if got := waitFor(t, ran, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %v, want %v", got, want)
+	}
+	if dropped := p.Stats().Dropped; dropped != 3 {
+		t.Errorf("Stats().Dropped = %d, want 3", dropped)
+	}
+}
+
+func TestResize(t *testing.T) {
+	leakcheck.Check(t)
+	p := New(Config{Workers: 4})
+	defer p.Close(context.Background())
+
+	// Shrinking and growing again must not leave retirements pending that
+	// would stop the new workers. Closing the pool must end all of them,
+	// retired or not.
+	p.Resize(1)
+	p.Resize(4)
+	started := make(chan struct{}, 4)
+	release := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		p.Go(context.Background(), JobFunc(func(ctx context.Context) (interface{}, error) {
+			started <- struct{}{}
+			<-release
+			return nil, nil
+		}))
+	}
+	for i := 0; i < 4; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatalf("%d of 4 jobs started, Stats().Workers = %d", i, p.Stats().Workers)
+		}
+	}
+	close(release)
+	if workers := p.Stats().Workers; workers != 4 {
+		t.Errorf("Stats().Workers = %d, want 4", workers)
+	}
+}
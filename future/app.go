@@ -0,0 +1,104 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/future/future"
+)
+
+// lookup pretends to ask a remote service for the price of an item. It
+// takes a random time of up to 100ms, and fails for unknown items.
+func lookup(ctx context.Context, item string) (int, error) {
+	prices := map[string]int{"apple": 3, "bread": 5, "cheese": 12}
+	select {
+	case <-time.After(time.Duration(rand.Intn(100)) * time.Millisecond):
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	price, ok := prices[item]
+	if !ok {
+		return 0, fmt.Errorf("no price for %s", item)
+	}
+	return price, nil
+}
+
+func price(ctx context.Context, item string) *future.Future[int] {
+	return future.Go(ctx, func(ctx context.Context) (int, error) {
+		return lookup(ctx, item)
+	})
+}
+
+func main() {
+	ctx := context.Background()
+
+	// All: the lookups run concurrently, and the total is computed once
+	// every price is known.
+	total := future.Then(future.All(price(ctx, "apple"), price(ctx, "bread"), price(ctx, "cheese")),
+		func(prices []int) (int, error) {
+			sum := 0
+			for _, p := range prices {
+				sum += p
+			}
+			return sum, nil
+		})
+	fmt.Println(total.Get())
+
+	// All fails with the first error, and Catch recovers from it.
+	basket := future.All(price(ctx, "apple"), price(ctx, "caviar")).Catch(func(err error) ([]int, error) {
+		fmt.Println("falling back:", err)
+		return nil, nil
+	})
+	fmt.Println(basket.Get())
+
+	// Any: the first replica to answer wins.
+	fmt.Println(future.Any(price(ctx, "bread"), price(ctx, "bread"), price(ctx, "bread")).Get())
+
+	// Timeout gives up waiting, and a cancelled context stops the work.
+	slow := future.Go(ctx, func(ctx context.Context) (int, error) {
+		time.Sleep(time.Second)
+		return 42, nil
+	})
+	_, err := slow.Timeout(50 * time.Millisecond).Get()
+	fmt.Println(err)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancelled := price(cctx, "cheese")
+	cancel()
+	fmt.Println(cancelled.Get())
+
+	// A promise is completed by hand, here from a callback.
+	promise := future.NewPromise[string]()
+	time.AfterFunc(10*time.Millisecond, func() { promise.Resolve("callback fired") })
+	fmt.Println(promise.Future().Await(ctx))
+}
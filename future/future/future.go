@@ -0,0 +1,287 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package future implements futures: values that a computation running in
+// the background will provide. A caller starts the work, goes on with its
+// own, and waits for the result only when it needs it, if at all. Futures
+// compose: Then chains work onto a result, Catch recovers from an error,
+// All waits for several futures and Any for the first to succeed. Waiting
+// is a receive on a channel, so a future can take part in a select like any
+// other event.
+package future
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrTimeout is the error of a future returned by Timeout whose result did
+// not arrive in time.
+var ErrTimeout = errors.New("future: timed out")
+
+// ErrNoFutures is the error of Any without futures.
+var ErrNoFutures = errors.New("future: no futures")
+
+// Future is a result of type T that becomes available later, either a
+// value or an error. It is safe for concurrent use, and any number of
+// goroutines may wait for it.
+type Future[T any] struct {
+	done  chan struct{}
+	once  sync.Once
+	value T
+	err   error
+}
+
+func newFuture[T any]() *Future[T] {
+	return &Future[T]{done: make(chan struct{})}
+}
+
+// complete sets the result of f and reports whether it was the first.
+func (f *Future[T]) complete(value T, err error) bool {
+	first := false
+	f.once.Do(func() {
+		f.value, f.err = value, err
+		close(f.done)
+		first = true
+	})
+	return first
+}
+
+// Go runs fn in a goroutine and returns a future of its result. fn gets a
+// context derived from ctx. If ctx is done before fn returns, the future
+// fails with the context's error straight away, and fn's context is
+// cancelled so it can give up as well. A panic in fn fails the future.
+func Go[T any](ctx context.Context, fn func(ctx context.Context) (T, error)) *Future[T] {
+	f := newFuture[T]()
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		defer cancel()
+		f.complete(call(func() (T, error) { return fn(ctx) }))
+	}()
+	go func() {
+		<-ctx.Done()
+		var zero T
+		f.complete(zero, context.Cause(ctx))
+	}()
+	return f
+}
+
+// call calls fn and turns a panic into an error.
+func call[T any](fn func() (T, error)) (value T, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("future: panic: %v", r)
+		}
+	}()
+	return fn()
+}
+
+// Resolved returns a future that has succeeded with value.
+func Resolved[T any](value T) *Future[T] {
+	f := newFuture[T]()
+	f.complete(value, nil)
+	return f
+}
+
+// Rejected returns a future that has failed with err.
+func Rejected[T any](err error) *Future[T] {
+	f := newFuture[T]()
+	var zero T
+	f.complete(zero, err)
+	return f
+}
+
+// Done returns a channel that is closed once the result is available.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Get waits for the result and returns it.
+func (f *Future[T]) Get() (T, error) {
+	<-f.done
+	return f.value, f.err
+}
+
+// Await waits for the result until ctx is done, and then returns the
+// context's error. The work behind the future goes on; only the wait ends.
+func (f *Future[T]) Await(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Poll returns the result if it is available, with ok set.
+func (f *Future[T]) Poll() (value T, err error, ok bool) {
+	select {
+	case <-f.done:
+		return f.value, f.err, true
+	default:
+		return value, nil, false
+	}
+}
+
+// Catch returns a future with the result of f if it succeeds, and with the
+// result of fn if it fails. fn can recover, such as with a default value,
+// or return an error of its own. A panic in fn fails the future.
+func (f *Future[T]) Catch(fn func(err error) (T, error)) *Future[T] {
+	next := newFuture[T]()
+	go func() {
+		value, err := f.Get()
+		if err != nil {
+			value, err = call(func() (T, error) { return fn(err) })
+		}
+		next.complete(value, err)
+	}()
+	return next
+}
+
+// Timeout returns a future with the result of f, which fails with
+// ErrTimeout if the result does not arrive within d.
+func (f *Future[T]) Timeout(d time.Duration) *Future[T] {
+	next := newFuture[T]()
+	go func() {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-f.done:
+			next.complete(f.value, f.err)
+		case <-timer.C:
+			var zero T
+			next.complete(zero, ErrTimeout)
+		}
+	}()
+	return next
+}
+
+// Then returns a future of fn applied to the value of f. If f fails, fn is
+// not called and the returned future fails with the same error. A panic in
+// fn fails the returned future. It is a function rather than a method
+// because a method cannot introduce the type U.
+func Then[T, U any](f *Future[T], fn func(T) (U, error)) *Future[U] {
+	next := newFuture[U]()
+	go func() {
+		value, err := f.Get()
+		if err != nil {
+			var zero U
+			next.complete(zero, err)
+			return
+		}
+		next.complete(call(func() (U, error) { return fn(value) }))
+	}()
+	return next
+}
+
+// All returns a future of the values of every future, in their order. It
+// fails as soon as one of them fails, with that future's error, without
+// waiting for the rest.
+func All[T any](futures ...*Future[T]) *Future[[]T] {
+	all := newFuture[[]T]()
+	values := make([]T, len(futures))
+	var wg sync.WaitGroup
+	for i, f := range futures {
+		wg.Add(1)
+		go func(i int, f *Future[T]) {
+			defer wg.Done()
+			value, err := f.Get()
+			if err != nil {
+				all.complete(nil, err)
+				return
+			}
+			values[i] = value
+		}(i, f)
+	}
+	go func() {
+		wg.Wait()
+		all.complete(values, nil)
+	}()
+	return all
+}
+
+// Any returns a future of the value of the first future to succeed. If
+// all of them fail, it fails with all their errors.
+func Any[T any](futures ...*Future[T]) *Future[T] {
+	if len(futures) == 0 {
+		return Rejected[T](ErrNoFutures)
+	}
+	first := newFuture[T]()
+	errs := make([]error, len(futures))
+	var wg sync.WaitGroup
+	for i, f := range futures {
+		wg.Add(1)
+		go func(i int, f *Future[T]) {
+			defer wg.Done()
+			value, err := f.Get()
+			if err == nil {
+				first.complete(value, nil)
+				return
+			}
+			errs[i] = err
+		}(i, f)
+	}
+	go func() {
+		wg.Wait()
+		var zero T
+		first.complete(zero, errors.Join(errs...))
+	}()
+	return first
+}
+
+// Promise is the writing end of a future, for results that do not come
+// from a function, such as a reply that arrives on an event bus.
+type Promise[T any] struct {
+	future *Future[T]
+}
+
+// NewPromise returns a promise whose future has no result yet.
+func NewPromise[T any]() *Promise[T] {
+	return &Promise[T]{future: newFuture[T]()}
+}
+
+// Future returns the future the promise completes.
+func (p *Promise[T]) Future() *Future[T] {
+	return p.future
+}
+
+// Resolve makes the future succeed with value. Only the first call to
+// Resolve or Reject counts; it reports whether this was it.
+func (p *Promise[T]) Resolve(value T) bool {
+	return p.future.complete(value, nil)
+}
+
+// Reject makes the future fail with err, unless it has a result already.
+func (p *Promise[T]) Reject(err error) bool {
+	var zero T
+	return p.future.complete(zero, err)
+}
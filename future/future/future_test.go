@@ -0,0 +1,53 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package future
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPanics checks that a panic in Go, Then or Catch fails the future
+// instead of crashing the program.
+func TestPanics(t *testing.T) {
+	boom := func() int { panic("boom") }
+	for name, f := range map[string]*Future[int]{
+		"Go":    Go(context.Background(), func(ctx context.Context) (int, error) { return boom(), nil }),
+		"Then":  Then(Resolved(1), func(int) (int, error) { return boom(), nil }),
+		"Catch": Rejected[int](errors.New("failed")).Catch(func(error) (int, error) { return boom(), nil }),
+	} {
+		_, err := f.Timeout(time.Second).Get()
+		if err == nil || !strings.Contains(err.Error(), "future: panic: boom") {
+			t.Errorf("%s: got %v, want the panic as an error", name, err)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/rajamummidi/go-design-patterns/future
+
+go 1.21
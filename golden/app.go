@@ -0,0 +1,73 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/golden/golden"
+)
+
+// envelope is a message on the wire, as clients see it.
+type envelope struct {
+	Type      string    `json:"type"`
+	Sender    string    `json:"sender,omitempty"`
+	Room      string    `json:"room,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Body      string    `json:"body"`
+}
+
+// renamed is the same envelope after a refactoring that renamed a field
+// and, without meaning to, the JSON key clients read.
+type renamed struct {
+	Type      string    `json:"type"`
+	From      string    `json:"from,omitempty"`
+	Room      string    `json:"room,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Body      string    `json:"body"`
+}
+
+func encode(v interface{}) string {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return string(data) + "\n"
+}
+
+func main() {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	want := encode(envelope{Type: "message", Sender: "alice", Room: "lobby", Timestamp: at, Body: "hi"})
+	got := encode(renamed{Type: "message", From: "alice", Room: "lobby", Timestamp: at, Body: "hi"})
+
+	fmt.Print("The golden file holds:\n", want, "\n")
+	fmt.Print("After the refactoring, the test fails with (-want +got):\n", golden.Diff(want, got))
+}
@@ -0,0 +1,3 @@
+module github.com/rajamummidi/go-design-patterns/golden
+
+go 1.21
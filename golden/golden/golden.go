@@ -0,0 +1,189 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package golden compares the output of a test with a golden file, a copy
+// of the expected output kept in the testdata directory next to the test.
+// Formats that other programs depend on, such as wire protocols and the
+// JSON that dashboards read, are locked down this way: a change to them
+// fails the test with a diff, and once the change is intended, running
+//
+//	go test -update
+//
+// rewrites the golden files, so the change shows up in the commit.
+package golden
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current output")
+
+// Dir is the directory of the golden files, relative to the package
+// under test.
+var Dir = "testdata"
+
+// TB is the part of testing.TB the helpers use.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// Path returns the file the golden output called name is kept in.
+func Path(name string) string {
+	return filepath.Join(Dir, name+".golden")
+}
+
+// Assert fails t with a diff if got differs from the golden file called
+// name. With -update it writes got to the file instead.
+func Assert(t TB, name string, got []byte) {
+	t.Helper()
+	path := Path(name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("golden: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("golden: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Fatalf("golden: %s does not exist; run the test with -update to create it", path)
+	}
+	if err != nil {
+		t.Fatalf("golden: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("golden: output differs from %s (-want +got):\n%s\nRun the test with -update if the change is intended.",
+			path, Diff(string(want), string(got)))
+	}
+}
+
+// AssertJSON is Assert for v encoded as indented JSON.
+func AssertJSON(t TB, name string, v interface{}) {
+	t.Helper()
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatalf("golden: encoding %s: %v", name, err)
+	}
+	Assert(t, name, append(data, '\n'))
+}
+
+// contextLines is how many unchanged lines Diff shows around a change.
+const contextLines = 2
+
+// Diff returns a line diff of want and got. Removed lines start with "-",
+// added lines with "+", and unchanged lines near a change with a space.
+// Longer runs of unchanged lines are left out.
+func Diff(want, got string) string {
+	a, b := lines(want), lines(got)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, " "+a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, "-"+a[i])
+			i++
+		default:
+			ops = append(ops, "+"+b[j])
+			j++
+		}
+	}
+
+	var out strings.Builder
+	skipped := 0
+	for k, op := range ops {
+		if op[0] == ' ' && !nearChange(ops, k) {
+			skipped++
+			continue
+		}
+		if skipped > 0 {
+			fmt.Fprintf(&out, "@@ %d unchanged lines @@\n", skipped)
+			skipped = 0
+		}
+		out.WriteString(op)
+		out.WriteByte('\n')
+	}
+	if skipped > 0 {
+		fmt.Fprintf(&out, "@@ %d unchanged lines @@\n", skipped)
+	}
+	return out.String()
+}
+
+func nearChange(ops []string, k int) bool {
+	for d := -contextLines; d <= contextLines; d++ {
+		if n := k + d; n >= 0 && n < len(ops) && ops[n][0] != ' ' {
+			return true
+		}
+	}
+	return false
+}
+
+// lines splits s into lines. A missing newline at the end is shown, since
+// it is a difference too.
+func lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	l := strings.Split(s, "\n")
+	if l[len(l)-1] == "" {
+		return l[:len(l)-1]
+	}
+	l[len(l)-1] += " (no newline at end)"
+	return l
+}
@@ -0,0 +1,98 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package golden
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// recorder is a TB that records failures instead of failing the test.
+type recorder struct {
+	errors []string
+	fatal  bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	r.fatal = true
+}
+
+func TestDiff(t *testing.T) {
+	want := "a\nb\nc\nd\ne\nf\ng\nh\n"
+	got := "a\nb\nc\nd\nE\nf\ng\nh\ni\n"
+	diff := Diff(want, got)
+	expected := "@@ 2 unchanged lines @@\n" +
+		" c\n d\n-e\n+E\n f\n g\n h\n+i\n"
+	if diff != expected {
+		t.Fatalf("got\n%s\nwant\n%s", diff, expected)
+	}
+
+	if diff := Diff("a\n", "a"); diff != "-a\n+a (no newline at end)\n" {
+		t.Fatalf("missing newline: got\n%s", diff)
+	}
+	if diff := Diff("same\n", "same\n"); diff != "@@ 1 unchanged lines @@\n" {
+		t.Fatalf("equal input: got\n%s", diff)
+	}
+}
+
+func TestAssert(t *testing.T) {
+	old := Dir
+	Dir = t.TempDir()
+	defer func() { Dir = old }()
+
+	r := &recorder{}
+	Assert(r, "missing", []byte("x"))
+	if !r.fatal || !strings.Contains(r.errors[0], "-update") {
+		t.Fatalf("a missing golden file gave %q", r.errors)
+	}
+
+	*update = true
+	AssertJSON(t, "report", map[string]int{"a": 1, "b": 2})
+	*update = false
+	if data, err := os.ReadFile(Path("report")); err != nil || string(data) != "{\n  \"a\": 1,\n  \"b\": 2\n}\n" {
+		t.Fatalf("-update wrote %q, %v", data, err)
+	}
+
+	AssertJSON(t, "report", map[string]int{"a": 1, "b": 2})
+
+	r = &recorder{}
+	AssertJSON(r, "report", map[string]int{"a": 1, "b": 3})
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], "-  \"b\": 2\n+  \"b\": 3\n") {
+		t.Fatalf("a changed output gave %q", r.errors)
+	}
+}
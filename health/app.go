@@ -0,0 +1,121 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+
+	"github.com/rajamummidi/go-design-patterns/health/health"
+)
+
+// probe asks the handler like an orchestrator would and prints the answer.
+func probe(name string, h http.Handler) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/"+name, nil))
+	var report health.Report
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	fmt.Printf("  /%s %d %s\n", name, rec.Code, report.Status)
+	for _, c := range report.Checks {
+		if c.Error == "" {
+			fmt.Printf("    %-9s %s\n", c.Name, c.Status)
+		} else {
+			fmt.Printf("    %-9s %-8s %s\n", c.Name, c.Status, c.Error)
+		}
+	}
+}
+
+func main() {
+	// A database to depend on, which goes away later.
+	database, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	go func() {
+		for {
+			conn, err := database.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	var (
+		accepting atomic.Bool // the server's accept loop runs
+		queued    atomic.Int64
+		cacheDown atomic.Bool
+	)
+	accepting.Store(true)
+
+	checks := health.New(health.Config{})
+	checks.AddLiveness("listener", health.CheckerFunc(func(ctx context.Context) error {
+		if !accepting.Load() {
+			return errors.New("accept loop exited")
+		}
+		return nil
+	}))
+	checks.AddReadiness("database", health.Dial(database.Addr().String()))
+	checks.AddReadiness("queue", health.Threshold(func() int { return int(queued.Load()) }, 100))
+	// The service answers from its own data when the cache is down, only
+	// slower.
+	checks.AddReadiness("cache", health.Optional(health.CheckerFunc(func(ctx context.Context) error {
+		if cacheDown.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	})))
+
+	live, ready := checks.LiveHandler(), checks.ReadyHandler()
+
+	fmt.Println("all is well:")
+	probe("healthz", live)
+	probe("readyz", ready)
+
+	fmt.Println("the cache is down:")
+	cacheDown.Store(true)
+	probe("readyz", ready)
+
+	fmt.Println("the queue backs up and the database goes away:")
+	queued.Store(150)
+	database.Close()
+	probe("readyz", ready)
+	fmt.Println("  but the process is alive, so it is not restarted:")
+	probe("healthz", live)
+
+	fmt.Println("the accept loop dies:")
+	accepting.Store(false)
+	probe("healthz", live)
+}
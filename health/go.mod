@@ -0,0 +1,3 @@
+module github.com/rajamummidi/go-design-patterns/health
+
+go 1.20
@@ -0,0 +1,242 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package health reports whether a service is alive and whether it is ready
+// for traffic. Named checks are registered for liveness, which fails when
+// the process is broken and should be restarted, or for readiness, which
+// fails while it should get no traffic, for example during startup, a drain
+// or an outage of something it depends on. The results are aggregated into
+// one status per probe and served on /healthz and /readyz.
+package health
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Checker checks one thing a service depends on. It returns nil when the
+// thing is fine, and an error saying what is wrong otherwise.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to a Checker.
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Status is the outcome of a check, or of all of them.
+type Status string
+
+const (
+	// Up means the check passed.
+	Up Status = "up"
+	// Degraded means the check failed, but the service still does its
+	// job, only worse, for example from a cache. It does not fail a probe.
+	Degraded Status = "degraded"
+	// Down means the check failed and fails the probe.
+	Down Status = "down"
+)
+
+// degraded marks the error of a check that degrades the service.
+type degraded struct {
+	err error
+}
+
+func (d degraded) Error() string { return d.err.Error() }
+func (d degraded) Unwrap() error { return d.err }
+func (d degraded) Degraded() bool {
+	return true
+}
+
+// Degrade marks err as degrading the service rather than taking it down.
+// Packages that cannot import this one can do the same with an error that
+// has a Degraded() bool method.
+func Degrade(err error) error {
+	if err == nil {
+		return nil
+	}
+	return degraded{err}
+}
+
+// Optional returns c with its failures reported as degraded, for checks of
+// things the service can do without for a while.
+func Optional(c Checker) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return Degrade(c.Check(ctx))
+	})
+}
+
+// statusOf maps the error of a check to its status.
+func statusOf(err error) Status {
+	if err == nil {
+		return Up
+	}
+	var d interface{ Degraded() bool }
+	if errors.As(err, &d) && d.Degraded() {
+		return Degraded
+	}
+	return Down
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Name     string        `json:"name"`
+	Status   Status        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Report is the outcome of a probe: Down if any check is down, Degraded if
+// any is degraded and Up otherwise.
+type Report struct {
+	Status Status   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Config configures a Registry.
+type Config struct {
+	// Timeout bounds every check (2s if zero). A check that takes longer
+	// is down.
+	Timeout time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.Timeout <= 0 {
+		c.Timeout = 2 * time.Second
+	}
+	return c
+}
+
+type check struct {
+	name    string
+	checker Checker
+}
+
+// Registry holds the liveness and readiness checks of a service. It is safe
+// for concurrent use.
+type Registry struct {
+	config Config
+
+	mu        sync.Mutex
+	liveness  []check
+	readiness []check
+}
+
+func New(config Config) *Registry {
+	return &Registry{config: config.withDefaults()}
+}
+
+// AddLiveness registers a check that fails the liveness probe, and with it
+// the readiness probe, since a process that is not alive is not ready
+// either. Liveness checks should only fail when a restart helps, such as a
+// listener that stopped accepting; a failing dependency is a readiness
+// matter, and restarting for it only adds to the outage.
+func (r *Registry) AddLiveness(name string, c Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.liveness = append(r.liveness, check{name, c})
+}
+
+// AddReadiness registers a check that fails the readiness probe only.
+func (r *Registry) AddReadiness(name string, c Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.readiness = append(r.readiness, check{name, c})
+}
+
+// Live runs the liveness checks.
+func (r *Registry) Live(ctx context.Context) Report {
+	r.mu.Lock()
+	checks := append([]check(nil), r.liveness...)
+	r.mu.Unlock()
+	return r.run(ctx, checks)
+}
+
+// Ready runs the liveness and the readiness checks.
+func (r *Registry) Ready(ctx context.Context) Report {
+	r.mu.Lock()
+	checks := append(append([]check(nil), r.liveness...), r.readiness...)
+	r.mu.Unlock()
+	return r.run(ctx, checks)
+}
+
+// run runs checks concurrently, each within the timeout, and sorts the
+// results by name.
+func (r *Registry) run(ctx context.Context, checks []check) Report {
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			results[i] = r.runOne(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+
+	report := Report{Status: Up, Checks: results}
+	for _, res := range results {
+		switch {
+		case res.Status == Down:
+			report.Status = Down
+		case res.Status == Degraded && report.Status == Up:
+			report.Status = Degraded
+		}
+	}
+	return report
+}
+
+// runOne runs a check and gives up on it at the timeout, in case it does
+// not watch its context.
+func (r *Registry) runOne(ctx context.Context, c check) Result {
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- c.checker.Check(ctx) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	res := Result{Name: c.name, Status: statusOf(err), Duration: time.Since(start)}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
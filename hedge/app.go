@@ -0,0 +1,107 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/circuit-breaker/circuitbreaker"
+	"github.com/rajamummidi/go-design-patterns/hedge/hedge"
+)
+
+// calls counts how often the backend was called, hedges included.
+var calls atomic.Int64
+
+// backend answers in about 10ms, but one call in twenty takes half a
+// second, as when a request lands on a replica that is collecting garbage.
+func backend(ctx context.Context) (string, error) {
+	calls.Add(1)
+	latency := 10 * time.Millisecond
+	if rand.Intn(20) == 0 {
+		latency = 500 * time.Millisecond
+	}
+	select {
+	case <-time.After(latency):
+		return "response", nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+var breaker = circuitbreaker.New("backend", circuitbreaker.Config{})
+
+// protected runs every attempt through the breaker, so hedges stop once
+// the backend is failing instead of adding to its load. Attempts cancelled
+// because another one won do not count as failures.
+func protected(ctx context.Context) (string, error) {
+	var response string
+	err := breaker.Execute(ctx, func() error {
+		var err error
+		response, err = backend(ctx)
+		return err
+	})
+	return response, err
+}
+
+func main() {
+	const requests = 200
+
+	run := func(name string, call func(ctx context.Context) (string, error)) {
+		calls.Store(0)
+		latencies := make([]time.Duration, requests)
+		for i := range latencies {
+			start := time.Now()
+			if _, err := call(context.Background()); err != nil {
+				fmt.Println("error:", err)
+			}
+			latencies[i] = time.Since(start)
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		fmt.Printf("%-22s p50 %-8v p99 %-8v max %-8v backend calls %d\n", name,
+			latencies[requests/2].Round(time.Millisecond),
+			latencies[requests*99/100].Round(time.Millisecond),
+			latencies[requests-1].Round(time.Millisecond),
+			calls.Load())
+	}
+
+	policy := hedge.Policy{Delay: 20 * time.Millisecond, MaxAttempts: 3, Timeout: time.Second}
+
+	run("plain", backend)
+	run("hedged", func(ctx context.Context) (string, error) {
+		return hedge.Do(ctx, policy, backend)
+	})
+	run("hedged with breaker", func(ctx context.Context) (string, error) {
+		return hedge.Do(ctx, policy, protected)
+	})
+}
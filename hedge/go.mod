@@ -0,0 +1,34 @@
+module github.com/rajamummidi/go-design-patterns/hedge
+
+go 1.21
+
+require github.com/rajamummidi/go-design-patterns/circuit-breaker v0.0.0
+
+require (
+	github.com/rajamummidi/go-design-patterns/future v0.0.0 // indirect
+	github.com/rajamummidi/go-design-patterns/state-machine v0.0.0 // indirect
+)
+
+replace github.com/rajamummidi/go-design-patterns/circuit-breaker => ../circuit-breaker
+
+replace github.com/rajamummidi/go-design-patterns/bulkhead => ../bulkhead
+
+replace github.com/rajamummidi/go-design-patterns/otlp => ../otlp
+
+replace github.com/rajamummidi/go-design-patterns/decorator => ../decorator
+
+replace github.com/rajamummidi/go-design-patterns/state-machine => ../state-machine
+
+replace github.com/rajamummidi/go-design-patterns/proxy => ../proxy
+
+replace github.com/rajamummidi/go-design-patterns/rate-limiter => ../rate-limiter
+
+replace github.com/rajamummidi/go-design-patterns/lifecycle => ../lifecycle
+
+replace github.com/rajamummidi/go-design-patterns/health => ../health
+
+replace github.com/rajamummidi/go-design-patterns/observability => ../observability
+
+replace github.com/rajamummidi/go-design-patterns/config => ../config
+
+replace github.com/rajamummidi/go-design-patterns/future => ../future
@@ -0,0 +1,158 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package hedge cuts tail latency by sending a request again when the
+// first attempt is slow, and using whichever answer arrives first.
+package hedge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Policy says when to hedge. Zero fields take the defaults given below.
+type Policy struct {
+	// Delay is how long to wait for an attempt before starting the next
+	// one (50ms). It is usually set near the 95th percentile latency of
+	// the call, so that only the slowest few percent are hedged.
+	Delay time.Duration
+
+	// MaxAttempts is how many attempts run at most, including the first
+	// (3).
+	MaxAttempts int
+
+	// Timeout, if set, bounds the whole call, all attempts included.
+	Timeout time.Duration
+
+	// OnHedge, if set, is called when attempt n (2 or later) is started.
+	OnHedge func(attempt int)
+}
+
+func (p Policy) withDefaults() Policy {
+	if p.Delay <= 0 {
+		p.Delay = 50 * time.Millisecond
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	return p
+}
+
+type result[T any] struct {
+	value T
+	err   error
+}
+
+// Do calls fn and, each time Delay passes without an answer, calls it again
+// up to policy.MaxAttempts times. An attempt that fails starts the next one
+// at once. The first successful result is returned, and the context passed
+// to the other attempts is cancelled. If every attempt fails, Do returns
+// their errors joined; if ctx ends or the timeout passes first, it returns
+// the context's error.
+//
+// Every attempt must be safe to run more than once and concurrently, so
+// only idempotent calls should be hedged.
+func Do[T any](ctx context.Context, policy Policy, fn func(ctx context.Context) (T, error)) (T, error) {
+	policy = policy.withDefaults()
+
+	var cancel context.CancelFunc
+	if policy.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, policy.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	// Cancelling on return stops the attempts that lost.
+	defer cancel()
+
+	// The channel is buffered for every attempt, so the losers never block.
+	results := make(chan result[T], policy.MaxAttempts)
+	start := func() {
+		go func() {
+			value, err := fn(ctx)
+			results <- result[T]{value, err}
+		}()
+	}
+
+	start()
+	started, failed := 1, 0
+	var errs []error
+
+	timer := time.NewTimer(policy.Delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case r := <-results:
+			if r.err == nil {
+				return r.value, nil
+			}
+			errs = append(errs, r.err)
+			failed++
+			if failed == policy.MaxAttempts {
+				var zero T
+				return zero, fmt.Errorf("hedge: all %d attempts failed: %w", failed, errors.Join(errs...))
+			}
+			if started == failed {
+				// Nothing is in flight any more, so don't wait for the timer.
+				started++
+				policy.hedged(started)
+				start()
+				resetTimer(timer, policy.Delay)
+			}
+		case <-timer.C:
+			if started < policy.MaxAttempts {
+				started++
+				policy.hedged(started)
+				start()
+				timer.Reset(policy.Delay)
+			}
+		case <-ctx.Done():
+			var zero T
+			return zero, fmt.Errorf("hedge: %w after %d attempts", ctx.Err(), started)
+		}
+	}
+}
+
+func (p Policy) hedged(attempt int) {
+	if p.OnHedge != nil {
+		p.OnHedge(attempt)
+	}
+}
+
+// resetTimer restarts a timer that may or may not have fired.
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
@@ -0,0 +1,100 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package busapi is an inbound adapter that lets other components drive
+// ports.TaskService over an event bus with request/reply. Each request is
+// answered with the resulting domain.Task or an error.
+package busapi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/hexagonal-architecture/domain"
+	"github.com/rajamummidi/go-design-patterns/hexagonal-architecture/ports"
+)
+
+// The commands the adapter accepts, and their payloads.
+const (
+	CreateTask   = "tasks.create"
+	AssignTask   = "tasks.assign"
+	CompleteTask = "tasks.complete"
+)
+
+type Create struct {
+	Title string
+}
+
+type Assign struct {
+	ID       string
+	Assignee string
+}
+
+type Complete struct {
+	ID string
+}
+
+// Register subscribes the adapter's handlers on bus.
+func Register(bus *eventbus.EventBus, tasks ports.TaskService) {
+	handle := func(command string, run func(ctx context.Context, data interface{}) (domain.Task, error)) {
+		bus.Register(command, eventbus.DefaultPriority, func(event eventbus.Event) error {
+			task, err := run(context.Background(), event.Data)
+			if err != nil {
+				return bus.Reply(event, err)
+			}
+			return bus.Reply(event, task)
+		})
+	}
+
+	handle(CreateTask, func(ctx context.Context, data interface{}) (domain.Task, error) {
+		cmd, ok := data.(Create)
+		if !ok {
+			return domain.Task{}, badPayload(CreateTask, data)
+		}
+		return tasks.Create(ctx, cmd.Title)
+	})
+	handle(AssignTask, func(ctx context.Context, data interface{}) (domain.Task, error) {
+		cmd, ok := data.(Assign)
+		if !ok {
+			return domain.Task{}, badPayload(AssignTask, data)
+		}
+		return tasks.Assign(ctx, cmd.ID, cmd.Assignee)
+	})
+	handle(CompleteTask, func(ctx context.Context, data interface{}) (domain.Task, error) {
+		cmd, ok := data.(Complete)
+		if !ok {
+			return domain.Task{}, badPayload(CompleteTask, data)
+		}
+		return tasks.Complete(ctx, cmd.ID)
+	})
+}
+
+func badPayload(command string, data interface{}) error {
+	return fmt.Errorf("%s: unexpected payload %T", command, data)
+}
@@ -0,0 +1,125 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package httpapi is an inbound adapter that exposes ports.TaskService as a
+// JSON API:
+//
+//	GET  /tasks                 list tasks
+//	POST /tasks                 create a task from {"title": ...}
+//	GET  /tasks/{id}            get a task
+//	POST /tasks/{id}/assign     assign it from {"assignee": ...}
+//	POST /tasks/{id}/complete   complete it
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/rajamummidi/go-design-patterns/hexagonal-architecture/domain"
+	"github.com/rajamummidi/go-design-patterns/hexagonal-architecture/ports"
+)
+
+type Handler struct {
+	tasks ports.TaskService
+}
+
+func NewHandler(tasks ports.TaskService) *Handler {
+	return &Handler{tasks: tasks}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "tasks" || len(parts) > 3 {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx := r.Context()
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		tasks, err := h.tasks.List(ctx)
+		respond(w, http.StatusOK, tasks, err)
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		var body struct {
+			Title string `json:"title"`
+		}
+		if !decode(w, r, &body) {
+			return
+		}
+		task, err := h.tasks.Create(ctx, body.Title)
+		respond(w, http.StatusCreated, task, err)
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		task, err := h.tasks.Get(ctx, parts[1])
+		respond(w, http.StatusOK, task, err)
+	case len(parts) == 3 && parts[2] == "assign" && r.Method == http.MethodPost:
+		var body struct {
+			Assignee string `json:"assignee"`
+		}
+		if !decode(w, r, &body) {
+			return
+		}
+		task, err := h.tasks.Assign(ctx, parts[1], body.Assignee)
+		respond(w, http.StatusOK, task, err)
+	case len(parts) == 3 && parts[2] == "complete" && r.Method == http.MethodPost:
+		task, err := h.tasks.Complete(ctx, parts[1])
+		respond(w, http.StatusOK, task, err)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// respond writes v as JSON, or maps err to a status code. Translating
+// domain errors to HTTP is the adapter's job, not the core's.
+func respond(w http.ResponseWriter, status int, v interface{}, err error) {
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, domain.ErrEmptyTitle):
+			status = http.StatusBadRequest
+		case errors.Is(err, domain.ErrNotAssigned), errors.Is(err, domain.ErrAlreadyClosed):
+			status = http.StatusConflict
+		default:
+			status = http.StatusInternalServerError
+		}
+		v = map[string]string{"error": err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,95 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package memory is an outbound adapter that keeps tasks in a map.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/rajamummidi/go-design-patterns/hexagonal-architecture/domain"
+	"github.com/rajamummidi/go-design-patterns/hexagonal-architecture/ports"
+)
+
+type Repository struct {
+	mu    sync.RWMutex
+	tasks map[string]domain.Task
+	next  int
+}
+
+var _ ports.TaskRepository = (*Repository)(nil)
+
+func NewRepository() *Repository {
+	return &Repository{tasks: make(map[string]domain.Task)}
+}
+
+func (r *Repository) NextID(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.next++
+	return fmt.Sprintf("task-%d", r.next), nil
+}
+
+func (r *Repository) Save(ctx context.Context, task domain.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tasks[task.ID] = task
+	return nil
+}
+
+func (r *Repository) Get(ctx context.Context, id string) (domain.Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	task, ok := r.tasks[id]
+	if !ok {
+		return domain.Task{}, domain.ErrNotFound
+	}
+	return task, nil
+}
+
+// List returns the tasks in the order they were created.
+func (r *Repository) List(ctx context.Context) ([]domain.Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tasks := make([]domain.Task, 0, len(r.tasks))
+	for _, task := range r.tasks {
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].CreatedAt.Before(tasks[j].CreatedAt) ||
+			tasks[i].CreatedAt.Equal(tasks[j].CreatedAt) && tasks[i].ID < tasks[j].ID
+	})
+	return tasks, nil
+}
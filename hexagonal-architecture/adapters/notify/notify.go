@@ -0,0 +1,111 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package notify holds the outbound adapters for ports.Notifier.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/rajamummidi/go-design-patterns/circuit-breaker/circuitbreaker"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/hexagonal-architecture/domain"
+	"github.com/rajamummidi/go-design-patterns/hexagonal-architecture/ports"
+)
+
+// Bus publishes every domain event on an event bus under its type, with
+// the event as data.
+type Bus struct {
+	bus *eventbus.EventBus
+}
+
+var _ ports.Notifier = (*Bus)(nil)
+
+func NewBus(bus *eventbus.EventBus) *Bus {
+	return &Bus{bus: bus}
+}
+
+func (b *Bus) Notify(ctx context.Context, event domain.Event) error {
+	return b.bus.Dispatch(event.Type, event)
+}
+
+// Webhook posts every domain event as JSON to a URL. Its client runs
+// through a circuit breaker, so a webhook receiver that is down does not
+// slow down every use case.
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+var _ ports.Notifier = (*Webhook)(nil)
+
+func NewWebhook(url string, breakers *circuitbreaker.Registry) *Webhook {
+	return &Webhook{
+		url: url,
+		client: &http.Client{
+			Transport: &circuitbreaker.Transport{Registry: breakers, Key: circuitbreaker.ByHost},
+		},
+	}
+}
+
+func (w *Webhook) Notify(ctx context.Context, event domain.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: %s", resp.Status)
+	}
+	return nil
+}
+
+// Multi sends every event to all of its notifiers and joins their errors.
+type Multi []ports.Notifier
+
+func (m Multi) Notify(ctx context.Context, event domain.Event) error {
+	var errs []error
+	for _, n := range m {
+		errs = append(errs, n.Notify(ctx, event))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,112 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/circuit-breaker/circuitbreaker"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/future/future"
+	"github.com/rajamummidi/go-design-patterns/hexagonal-architecture/adapters/busapi"
+	"github.com/rajamummidi/go-design-patterns/hexagonal-architecture/adapters/httpapi"
+	"github.com/rajamummidi/go-design-patterns/hexagonal-architecture/adapters/memory"
+	"github.com/rajamummidi/go-design-patterns/hexagonal-architecture/adapters/notify"
+	"github.com/rajamummidi/go-design-patterns/hexagonal-architecture/domain"
+	"github.com/rajamummidi/go-design-patterns/hexagonal-architecture/service"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "address of the HTTP API")
+	webhook := flag.String("webhook", "", "URL to post task events to")
+	flag.Parse()
+
+	// main is the composition root: the only place that knows every
+	// adapter, and the only place that changes when one is swapped.
+	bus := eventbus.NewEventBus()
+	repo := memory.NewRepository()
+
+	notifier := notify.Multi{notify.NewBus(bus)}
+	if *webhook != "" {
+		breakers := circuitbreaker.NewRegistry(circuitbreaker.Config{OpenTimeout: 30 * time.Second})
+		notifier = append(notifier, notify.NewWebhook(*webhook, breakers))
+	}
+
+	tasks := service.New(repo, notifier)
+
+	busapi.Register(bus, tasks)
+	http.Handle("/tasks", httpapi.NewHandler(tasks))
+	http.Handle("/tasks/", httpapi.NewHandler(tasks))
+
+	// Something else in the process reacting to the domain events.
+	bus.Register("task.*", eventbus.DefaultPriority, func(event eventbus.Event) error {
+		e := event.Data.(domain.Event)
+		fmt.Printf("event %s: %s %q (%s)\n", e.Type, e.Task.ID, e.Task.Title, e.Task.Status)
+		return nil
+	})
+
+	demo(bus)
+
+	fmt.Println("Serving the task API on", *addr)
+	if err := http.ListenAndServe(*addr, nil); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// demo drives the application through the bus adapter, as another module
+// of a larger program would.
+func demo(bus *eventbus.EventBus) {
+	ctx := context.Background()
+
+	// The two tasks are created concurrently, and the demo goes on once both
+	// replies are in.
+	created, err := future.All(
+		bus.RequestAsync(ctx, busapi.CreateTask, busapi.Create{Title: "Write the README"}),
+		bus.RequestAsync(ctx, busapi.CreateTask, busapi.Create{Title: "Record a screencast"}),
+	).Get()
+	if err != nil {
+		fmt.Println("create:", err)
+		return
+	}
+	id := created[0].(domain.Task).ID
+
+	if _, err := bus.Request(ctx, busapi.CompleteTask, busapi.Complete{ID: id}); err != nil {
+		fmt.Println("complete before assigning:", err)
+	}
+	if _, err := bus.Request(ctx, busapi.AssignTask, busapi.Assign{ID: id, Assignee: "raja"}); err != nil {
+		fmt.Println("assign:", err)
+	}
+	if _, err := bus.Request(ctx, busapi.CompleteTask, busapi.Complete{ID: id}); err != nil {
+		fmt.Println("complete:", err)
+	}
+}
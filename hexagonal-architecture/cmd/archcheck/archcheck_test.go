@@ -0,0 +1,67 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestArchitecture fails when a package of this module imports a layer
+// that architecture.json does not allow, so that go test guards the layers
+// as well as the tool does.
+func TestArchitecture(t *testing.T) {
+	violations, err := check("../..", "../../architecture.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range violations {
+		t.Errorf("%s: %s", v.pos, v.msg)
+	}
+}
+
+// TestViolation runs the checker over a module in testdata whose domain
+// imports an adapter.
+func TestViolation(t *testing.T) {
+	violations, err := check("testdata/violation", "testdata/violation/architecture.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 1 {
+		t.Fatalf("got %d violations, want 1: %v", len(violations), violations)
+	}
+	v := violations[0]
+	if !strings.HasSuffix(v.pos.Filename, "domain.go") || v.pos.Line != 6 {
+		t.Errorf("violation reported at %s, want domain.go:6", v.pos)
+	}
+	want := "domain (layer domain) must not import example.com/violation/adapters/store (layer adapters)"
+	if v.msg != want {
+		t.Errorf("got %q, want %q", v.msg, want)
+	}
+}
@@ -0,0 +1,240 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Command archcheck verifies that the packages of a module only import the
+// layers they are allowed to, as declared in a JSON rules file:
+//
+//	{"layers": [
+//	    {"name": "domain", "packages": ["domain"], "may_import": []},
+//	    {"name": "adapters", "packages": ["adapters/..."], "may_import": ["domain", "external"]}
+//	]}
+//
+// Package patterns are relative to the module root, and "dir/..." matches
+// dir and everything below it. The standard library may always be
+// imported. Packages from other modules belong to the layer "external".
+// A package may import other packages of its own layer only if the layer
+// lists itself. Packages that belong to no layer are reported too.
+//
+// archcheck prints every violation and exits with status 1 if there is
+// one, so it can run next to go vet in CI:
+//
+//	go run ./cmd/archcheck -rules architecture.json
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const external = "external"
+
+type layer struct {
+	Name      string   `json:"name"`
+	Packages  []string `json:"packages"`
+	MayImport []string `json:"may_import"`
+}
+
+type rules struct {
+	Layers []layer `json:"layers"`
+}
+
+// layerOf returns the layer the package in dir (relative to the module
+// root, "." for the root) belongs to.
+func (r *rules) layerOf(dir string) (*layer, bool) {
+	for i := range r.Layers {
+		for _, pattern := range r.Layers[i].Packages {
+			if matchPackage(pattern, dir) {
+				return &r.Layers[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+func matchPackage(pattern, dir string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/..."); ok {
+		return dir == prefix || strings.HasPrefix(dir, prefix+"/")
+	}
+	return dir == pattern
+}
+
+func (l *layer) allows(other string) bool {
+	for _, name := range l.MayImport {
+		if name == other {
+			return true
+		}
+	}
+	return false
+}
+
+type violation struct {
+	pos token.Position
+	msg string
+}
+
+func main() {
+	rulesFile := flag.String("rules", "architecture.json", "file with the layer rules")
+	root := flag.String("root", ".", "root directory of the module")
+	flag.Parse()
+
+	violations, err := check(*root, *rulesFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "archcheck:", err)
+		os.Exit(2)
+	}
+	for _, v := range violations {
+		fmt.Printf("%s: %s\n", v.pos, v.msg)
+	}
+	if len(violations) > 0 {
+		fmt.Printf("%d architecture violation(s)\n", len(violations))
+		os.Exit(1)
+	}
+}
+
+func check(root, rulesFile string) ([]violation, error) {
+	data, err := os.ReadFile(rulesFile)
+	if err != nil {
+		return nil, err
+	}
+	var r rules
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%s: %w", rulesFile, err)
+	}
+	module, err := modulePath(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []violation
+	fset := token.NewFileSet()
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if p != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(p, ".go") {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(root, filepath.Dir(p))
+		dir := filepath.ToSlash(rel)
+		file, err := parser.ParseFile(fset, p, nil, parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+
+		from, ok := r.layerOf(dir)
+		if !ok {
+			violations = append(violations, violation{fset.Position(file.Package), fmt.Sprintf("package %s belongs to no layer", dir)})
+			return nil
+		}
+		for _, spec := range file.Imports {
+			imported, _ := strconv.Unquote(spec.Path.Value)
+			to, ok := classify(&r, module, imported)
+			if !ok {
+				violations = append(violations, violation{fset.Position(spec.Pos()), fmt.Sprintf("%s imports %s, which belongs to no layer", dir, imported)})
+				continue
+			}
+			if to == "" || from.allows(to) {
+				continue
+			}
+			violations = append(violations, violation{fset.Position(spec.Pos()),
+				fmt.Sprintf("%s (layer %s) must not import %s (layer %s)", dir, from.Name, imported, to)})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(violations, func(i, j int) bool {
+		if violations[i].pos.Filename != violations[j].pos.Filename {
+			return violations[i].pos.Filename < violations[j].pos.Filename
+		}
+		return violations[i].pos.Line < violations[j].pos.Line
+	})
+	return violations, nil
+}
+
+// classify returns the layer of an import path: "" for the standard
+// library, external for other modules, and the layer name for packages of
+// this module.
+func classify(r *rules, module, imported string) (string, bool) {
+	if rel, ok := strings.CutPrefix(imported, module); ok && (rel == "" || rel[0] == '/') {
+		dir := strings.TrimPrefix(rel, "/")
+		if dir == "" {
+			dir = "."
+		}
+		l, ok := r.layerOf(path.Clean(dir))
+		if !ok {
+			return "", false
+		}
+		return l.Name, true
+	}
+	if first, _, _ := strings.Cut(imported, "/"); !strings.Contains(first, ".") {
+		return "", true
+	}
+	return external, true
+}
+
+func modulePath(goMod string) (string, error) {
+	f, err := os.Open(goMod)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if module, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "module "); ok {
+			return strings.Trim(strings.TrimSpace(module), `"`), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New(goMod + ": no module directive")
+}
@@ -0,0 +1,11 @@
+package domain
+
+import (
+	"strings"
+
+	"example.com/violation/adapters/store"
+)
+
+func Name(id string) string {
+	return strings.ToUpper(store.Lookup(id))
+}
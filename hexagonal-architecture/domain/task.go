@@ -0,0 +1,104 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package domain is the core of the task service: the Task entity and its
+// rules. It imports nothing from the rest of the service, so it can be
+// understood, and changed, without knowing how tasks are stored or reached.
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound      = errors.New("task not found")
+	ErrEmptyTitle    = errors.New("task title must not be empty")
+	ErrNotAssigned   = errors.New("task must be assigned before it is completed")
+	ErrAlreadyClosed = errors.New("task is already done")
+)
+
+type Status string
+
+const (
+	Open Status = "open"
+	Done Status = "done"
+)
+
+type Task struct {
+	ID        string     `json:"id"`
+	Title     string     `json:"title"`
+	Assignee  string     `json:"assignee,omitempty"`
+	Status    Status     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	DoneAt    *time.Time `json:"done_at,omitempty"`
+}
+
+// NewTask returns an open task.
+func NewTask(id, title string, now time.Time) (*Task, error) {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return nil, ErrEmptyTitle
+	}
+	return &Task{ID: id, Title: title, Status: Open, CreatedAt: now}, nil
+}
+
+// Assign hands an open task to someone; reassigning is allowed.
+func (t *Task) Assign(assignee string) error {
+	if t.Status == Done {
+		return ErrAlreadyClosed
+	}
+	t.Assignee = assignee
+	return nil
+}
+
+// Complete marks an assigned task as done.
+func (t *Task) Complete(now time.Time) error {
+	if t.Status == Done {
+		return ErrAlreadyClosed
+	}
+	if t.Assignee == "" {
+		return ErrNotAssigned
+	}
+	t.Status = Done
+	t.DoneAt = &now
+	return nil
+}
+
+// Event tells the outside world that something happened to a task.
+type Event struct {
+	Type string `json:"type"`
+	Task Task   `json:"task"`
+}
+
+const (
+	TaskCreated   = "task.created"
+	TaskAssigned  = "task.assigned"
+	TaskCompleted = "task.completed"
+)
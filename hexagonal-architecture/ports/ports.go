@@ -0,0 +1,62 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package ports declares the boundaries of the hexagon. Inbound adapters
+// drive the application through TaskService; the application drives the
+// outside world through TaskRepository and Notifier, which outbound
+// adapters implement.
+package ports
+
+import (
+	"context"
+
+	"github.com/rajamummidi/go-design-patterns/hexagonal-architecture/domain"
+)
+
+// TaskService is the inbound port: the use cases of the application.
+type TaskService interface {
+	Create(ctx context.Context, title string) (domain.Task, error)
+	Assign(ctx context.Context, id, assignee string) (domain.Task, error)
+	Complete(ctx context.Context, id string) (domain.Task, error)
+	Get(ctx context.Context, id string) (domain.Task, error)
+	List(ctx context.Context) ([]domain.Task, error)
+}
+
+// TaskRepository stores tasks. Get returns domain.ErrNotFound for unknown
+// IDs.
+type TaskRepository interface {
+	NextID(ctx context.Context) (string, error)
+	Save(ctx context.Context, task domain.Task) error
+	Get(ctx context.Context, id string) (domain.Task, error)
+	List(ctx context.Context) ([]domain.Task, error)
+}
+
+// Notifier tells other systems about domain events.
+type Notifier interface {
+	Notify(ctx context.Context, event domain.Event) error
+}
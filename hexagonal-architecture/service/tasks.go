@@ -0,0 +1,108 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package service implements the use cases of the task service on top of
+// the outbound ports. It knows nothing about HTTP, the event bus or storage.
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/hexagonal-architecture/domain"
+	"github.com/rajamummidi/go-design-patterns/hexagonal-architecture/ports"
+)
+
+// Tasks implements ports.TaskService.
+type Tasks struct {
+	repo     ports.TaskRepository
+	notifier ports.Notifier
+	now      func() time.Time
+}
+
+var _ ports.TaskService = (*Tasks)(nil)
+
+func New(repo ports.TaskRepository, notifier ports.Notifier) *Tasks {
+	return &Tasks{repo: repo, notifier: notifier, now: time.Now}
+}
+
+func (s *Tasks) Create(ctx context.Context, title string) (domain.Task, error) {
+	id, err := s.repo.NextID(ctx)
+	if err != nil {
+		return domain.Task{}, err
+	}
+	task, err := domain.NewTask(id, title, s.now())
+	if err != nil {
+		return domain.Task{}, err
+	}
+	return s.save(ctx, domain.TaskCreated, *task)
+}
+
+func (s *Tasks) Assign(ctx context.Context, id, assignee string) (domain.Task, error) {
+	return s.update(ctx, id, domain.TaskAssigned, func(t *domain.Task) error {
+		return t.Assign(assignee)
+	})
+}
+
+func (s *Tasks) Complete(ctx context.Context, id string) (domain.Task, error) {
+	return s.update(ctx, id, domain.TaskCompleted, func(t *domain.Task) error {
+		return t.Complete(s.now())
+	})
+}
+
+func (s *Tasks) Get(ctx context.Context, id string) (domain.Task, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *Tasks) List(ctx context.Context) ([]domain.Task, error) {
+	return s.repo.List(ctx)
+}
+
+func (s *Tasks) update(ctx context.Context, id, event string, change func(t *domain.Task) error) (domain.Task, error) {
+	task, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return domain.Task{}, err
+	}
+	if err := change(&task); err != nil {
+		return domain.Task{}, err
+	}
+	return s.save(ctx, event, task)
+}
+
+// save stores task and then announces event. A failed notification does
+// not undo the change; it is reported but the task is returned.
+func (s *Tasks) save(ctx context.Context, event string, task domain.Task) (domain.Task, error) {
+	if err := s.repo.Save(ctx, task); err != nil {
+		return domain.Task{}, err
+	}
+	if err := s.notifier.Notify(ctx, domain.Event{Type: event, Task: task}); err != nil {
+		fmt.Printf("Notifying %s for task %s failed: %v\n", event, task.ID, err)
+	}
+	return task, nil
+}
@@ -0,0 +1,168 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/idempotency/idempotency"
+)
+
+// payments charges cards. Charging the same payment twice is the bug this
+// module is about.
+type payments struct {
+	charges atomic.Int64
+	// slow makes the next charge take longer than the client waits.
+	slow atomic.Bool
+}
+
+func (p *payments) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Amount int64 `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if p.slow.Swap(false) {
+		time.Sleep(300 * time.Millisecond)
+	}
+	n := p.charges.Add(1)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, `{"charge":"ch_%d","amount":%d}`, n, req.Amount)
+}
+
+// charge posts a payment with an idempotency key and describes the answer.
+func charge(client *http.Client, base, key string, amount int64) string {
+	body := fmt.Sprintf(`{"amount":%d}`, amount)
+	req, _ := http.NewRequest(http.MethodPost, base+"/payments", bytes.NewBufferString(body))
+	req.Header.Set(idempotency.KeyHeader, key)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "no answer (" + err.Error() + ")"
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	replayed := ""
+	if resp.Header.Get(idempotency.ReplayedHeader) != "" {
+		replayed = " replayed"
+	}
+	return fmt.Sprintf("%d%s %s", resp.StatusCode, replayed, bytes.TrimSpace(data))
+}
+
+func httpDemo() {
+	service := &payments{}
+	dedup := idempotency.New(idempotency.NewMemoryStore(0), time.Hour)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	go http.Serve(listener, idempotency.Middleware(dedup)(service))
+	base := "http://" + listener.Addr().String()
+	impatient := &http.Client{Timeout: 100 * time.Millisecond}
+
+	fmt.Println("HTTP: POST /payments with an Idempotency-Key header")
+	fmt.Println("  pay-1:", charge(http.DefaultClient, base, "pay-1", 25_00))
+	fmt.Println("  pay-1 again:", charge(http.DefaultClient, base, "pay-1", 25_00))
+
+	service.slow.Store(true)
+	fmt.Println("  pay-2, client gives up:", charge(impatient, base, "pay-2", 40_00))
+	fmt.Println("  pay-2, client retries:", charge(http.DefaultClient, base, "pay-2", 40_00))
+
+	var wg sync.WaitGroup
+	answers := make([]string, 3)
+	for i := range answers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			answers[i] = charge(http.DefaultClient, base, "pay-3", 10_00)
+		}(i)
+	}
+	wg.Wait()
+	for _, answer := range answers {
+		fmt.Println("  pay-3, three at once:", answer)
+	}
+	fmt.Println("  pay-1 with another amount:", charge(http.DefaultClient, base, "pay-1", 99_00))
+	fmt.Printf("  cards charged %d times for 3 payments, %+v\n\n", service.charges.Load(), dedup.Stats())
+}
+
+func eventDemo() {
+	dir, err := os.MkdirTemp("", "idempotency")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "shipping.jsonl")
+
+	shipped := 0
+	// run starts a consumer with the records of the last run, as after a
+	// restart, and delivers events to it.
+	run := func(ids ...string) {
+		store, err := idempotency.OpenFileStore(path)
+		if err != nil {
+			panic(err)
+		}
+		defer store.Close()
+		dedup := idempotency.New(store, 24*time.Hour)
+
+		bus := eventbus.NewEventBus()
+		bus.Register("order.placed", eventbus.DefaultPriority, eventbus.Deduplicate(dedup, "shipping", func(e eventbus.Event) error {
+			shipped++
+			fmt.Printf("  shipping %s\n", e.Data)
+			return nil
+		}))
+		for _, id := range ids {
+			bus.DispatchWithID(id, "order.placed", "order "+id)
+		}
+		fmt.Printf("  %+v\n", dedup.Stats())
+	}
+
+	fmt.Println("Events: a broker delivers order.placed at least once")
+	run("o-1", "o-2", "o-1", "o-2", "o-3")
+	fmt.Println("After a restart, the broker redelivers o-3 and o-4:")
+	run("o-3", "o-4")
+	fmt.Printf("  %d orders shipped once each\n", shipped)
+}
+
+func main() {
+	httpDemo()
+	eventDemo()
+}
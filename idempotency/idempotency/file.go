@@ -0,0 +1,175 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package idempotency
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileStore keeps records as JSON lines in a file, so that copies are
+// recognized across restarts. Every record is appended to the file and
+// kept in memory; the file is compacted when the store is opened and by
+// Compact, which drop the expired records.
+type FileStore struct {
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	records map[string]Record
+}
+
+// OpenFileStore opens or creates the store at path and compacts it.
+func OpenFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, records: make(map[string]Record)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.Compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the records in the file. Later lines replace earlier ones
+// with the same key.
+func (s *FileStore) load() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("idempotency: %s line %d: %w", s.path, line, err)
+		}
+		s.records[record.Key] = record
+	}
+	return scanner.Err()
+}
+
+func (s *FileStore) Get(key string) (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[key]
+	if !ok || record.expired(time.Now()) {
+		return Record{}, false, nil
+	}
+	return record, true, nil
+}
+
+func (s *FileStore) Put(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.records[record.Key] = record
+	return nil
+}
+
+// Compact drops the expired records, from memory and from the file. The
+// file is replaced atomically, so a crash leaves either the old or the new
+// version behind.
+func (s *FileStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out, err := os.CreateTemp(filepath.Dir(s.path), ".idempotency-*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	now := time.Now()
+	for key, record := range s.records {
+		if record.expired(now) {
+			delete(s.records, key)
+			continue
+		}
+		line, err := json.Marshal(record)
+		if err == nil {
+			_, err = w.Write(append(line, '\n'))
+		}
+		if err != nil {
+			out.Close()
+			os.Remove(out.Name())
+			return err
+		}
+	}
+	if err := w.Flush(); err == nil {
+		err = out.Sync()
+	}
+	if err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+	if err := os.Rename(out.Name(), s.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = file
+	return nil
+}
+
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,155 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// KeyHeader is the header clients send the key of a request in.
+const KeyHeader = "Idempotency-Key"
+
+// ReplayedHeader is set on responses that are answered from a record.
+const ReplayedHeader = "Idempotent-Replayed"
+
+// response is a response as it is recorded.
+type response struct {
+	// Fingerprint is a hash of the request, to catch a key sent with a
+	// different request.
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+}
+
+// errServerError keeps a 5xx response from being recorded.
+var errServerError = errors.New("idempotency: server error")
+
+// Middleware makes requests with an Idempotency-Key header idempotent. The
+// first request with a key is handled and its response recorded; a retry
+// with the same key gets the recorded response, with an
+// Idempotent-Replayed header, without reaching the handler. Keys are scoped
+// to the method and path. A key sent again with a different body is
+// answered with 422 Unprocessable Entity, since it most likely is a bug in
+// the client.
+//
+// Responses with a 5xx status are not recorded, so the client can retry
+// them. Requests without the header, and GET, HEAD and OPTIONS requests,
+// which are idempotent already, pass through.
+func Middleware(d *Deduplicator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(KeyHeader)
+			if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			sum := sha256.Sum256(body)
+			fingerprint := hex.EncodeToString(sum[:])
+
+			var recorded response
+			result, duplicate, err := d.Do(r.Context(), r.Method+" "+r.URL.Path+" "+key, func() ([]byte, error) {
+				rec := &recorder{header: make(http.Header), status: http.StatusOK}
+				next.ServeHTTP(rec, r)
+				recorded = response{Fingerprint: fingerprint, Status: rec.status, Header: rec.header, Body: rec.body.Bytes()}
+				if rec.status >= http.StatusInternalServerError {
+					return nil, errServerError
+				}
+				return json.Marshal(recorded)
+			})
+			switch {
+			case errors.Is(err, errServerError):
+				recorded.write(w)
+			case err != nil && recorded.Status != 0:
+				// The response could not be recorded; the client still
+				// gets it.
+				recorded.write(w)
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			case !duplicate:
+				recorded.write(w)
+			default:
+				var replay response
+				if err := json.Unmarshal(result, &replay); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if replay.Fingerprint != fingerprint {
+					http.Error(w, KeyHeader+" was used with a different request", http.StatusUnprocessableEntity)
+					return
+				}
+				w.Header().Set(ReplayedHeader, "true")
+				replay.write(w)
+			}
+		})
+	}
+}
+
+func (resp response) write(w http.ResponseWriter) {
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// recorder is a ResponseWriter that keeps the response.
+type recorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = status, true
+	}
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	return r.body.Write(p)
+}
@@ -0,0 +1,159 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package idempotency makes it safe to process a request or an event more
+// than once. Clients retry requests whose answer they did not get, and
+// brokers and outbox relays deliver some messages twice. If the sender
+// attaches a key that identifies the operation, such as an Idempotency-Key
+// header or an event ID, a Deduplicator runs the operation for the first
+// copy, remembers its result under the key, and answers every later copy
+// with that result instead of running it again.
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Record is the result of an operation, kept under its key until it
+// expires.
+type Record struct {
+	Key     string    `json:"key"`
+	Result  []byte    `json:"result,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+func (r Record) expired(now time.Time) bool {
+	return !now.Before(r.Expires)
+}
+
+// Store keeps the records of a Deduplicator. Implementations must be safe
+// for concurrent use.
+type Store interface {
+	// Get returns the record of key, if there is one that has not expired.
+	Get(key string) (Record, bool, error)
+	// Put stores record, replacing any record with the same key.
+	Put(record Record) error
+}
+
+// Stats are the counters of a Deduplicator.
+type Stats struct {
+	// Processed counts operations that ran and succeeded.
+	Processed uint64 `json:"processed"`
+	// Duplicates counts copies answered with a recorded result.
+	Duplicates uint64 `json:"duplicates"`
+	// Failed counts operations that ran and failed. Their results are not
+	// recorded, so the next copy runs them again.
+	Failed uint64 `json:"failed"`
+}
+
+// Deduplicator runs operations at most once per key within a TTL. It is
+// safe for concurrent use.
+type Deduplicator struct {
+	store Store
+	ttl   time.Duration
+
+	mu       sync.Mutex
+	inflight map[string]chan struct{}
+	stats    Stats
+}
+
+// New returns a Deduplicator that keeps results in store for ttl (24h if
+// zero). The TTL should be longer than the time in which a sender may
+// retry.
+func New(store Store, ttl time.Duration) *Deduplicator {
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &Deduplicator{store: store, ttl: ttl, inflight: make(map[string]chan struct{})}
+}
+
+// Do runs fn unless an operation with key succeeded within the TTL, in
+// which case it returns the result of that operation and duplicate is true.
+// When fn fails its result is not recorded, so the next copy runs it
+// again.
+//
+// A copy that arrives while the operation of its key is still running waits
+// for it, until ctx is done, rather than running fn at the same time.
+func (d *Deduplicator) Do(ctx context.Context, key string, fn func() ([]byte, error)) (result []byte, duplicate bool, err error) {
+	for {
+		record, ok, err := d.store.Get(key)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			d.count(func(s *Stats) { s.Duplicates++ })
+			return record.Result, true, nil
+		}
+
+		d.mu.Lock()
+		running, busy := d.inflight[key]
+		if !busy {
+			running = make(chan struct{})
+			d.inflight[key] = running
+		}
+		d.mu.Unlock()
+		if !busy {
+			break
+		}
+		select {
+		case <-running:
+			// Look again: the operation may have failed.
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+
+	defer func() {
+		d.mu.Lock()
+		close(d.inflight[key])
+		delete(d.inflight, key)
+		d.mu.Unlock()
+	}()
+
+	if result, err = fn(); err != nil {
+		d.count(func(s *Stats) { s.Failed++ })
+		return nil, false, err
+	}
+	d.count(func(s *Stats) { s.Processed++ })
+	return result, false, d.store.Put(Record{Key: key, Result: result, Expires: time.Now().Add(d.ttl)})
+}
+
+// Stats returns the counters of the Deduplicator.
+func (d *Deduplicator) Stats() Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats
+}
+
+func (d *Deduplicator) count(update func(*Stats)) {
+	d.mu.Lock()
+	update(&d.stats)
+	d.mu.Unlock()
+}
@@ -0,0 +1,166 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package idempotency
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/membudget"
+)
+
+// MemoryStore keeps records in memory, up to a maximum number. When it is
+// full, the least recently used record is evicted first, which shortens
+// the window in which its copies are recognized.
+type MemoryStore struct {
+	max int
+
+	mu      sync.Mutex
+	records map[string]*list.Element // of Record
+	lru     *list.List               // most recently used first
+	memory  *membudget.Component
+	pending int64 // bytes retained or freed since the budget was last told
+}
+
+// NewMemoryStore returns a store of up to max records (10000 if zero).
+func NewMemoryStore(max int) *MemoryStore {
+	if max <= 0 {
+		max = 10000
+	}
+	return &MemoryStore{max: max, records: make(map[string]*list.Element), lru: list.New()}
+}
+
+// UseBudget accounts the records against budget. When the budget runs
+// out, the least recently used records are evicted first.
+func (s *MemoryStore) UseBudget(budget *membudget.Budget, weight float64) {
+	memory := budget.Register("idempotency", weight, s.evict)
+
+	s.mu.Lock()
+	s.memory = memory
+	s.mu.Unlock()
+	s.settle()
+}
+
+func (s *MemoryStore) Get(key string) (Record, bool, error) {
+	defer s.settle()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.records[key]
+	if !ok {
+		return Record{}, false, nil
+	}
+	record := elem.Value.(Record)
+	if record.expired(time.Now()) {
+		s.remove(elem)
+		return Record{}, false, nil
+	}
+	s.lru.MoveToFront(elem)
+	return record, true, nil
+}
+
+func (s *MemoryStore) Put(record Record) error {
+	defer s.settle()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending += record.size()
+	if elem, ok := s.records[record.Key]; ok {
+		s.pending -= elem.Value.(Record).size()
+		elem.Value = record
+		s.lru.MoveToFront(elem)
+		return nil
+	}
+	s.records[record.Key] = s.lru.PushFront(record)
+	for s.lru.Len() > s.max {
+		s.remove(s.lru.Back())
+	}
+	return nil
+}
+
+// remove drops the record of elem. The caller must hold s.mu.
+func (s *MemoryStore) remove(elem *list.Element) {
+	record := s.lru.Remove(elem).(Record)
+	delete(s.records, record.Key)
+	s.pending -= record.size()
+}
+
+// settle tells the budget about the memory retained or freed since the last
+// call. It must be called without s.mu held, because reserving memory may
+// call back into evict.
+func (s *MemoryStore) settle() {
+	s.mu.Lock()
+	memory, pending := s.memory, s.pending
+	if memory != nil {
+		s.pending = 0
+	}
+	s.mu.Unlock()
+
+	switch {
+	case memory == nil:
+	case pending > 0:
+		memory.Reserve(pending)
+	case pending < 0:
+		memory.Release(-pending)
+	}
+}
+
+// evict drops the least recently used records until need bytes are freed
+// or the store is empty.
+func (s *MemoryStore) evict(need int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var freed int64
+	for freed < need && s.lru.Len() > 0 {
+		record := s.lru.Remove(s.lru.Back()).(Record)
+		delete(s.records, record.Key)
+		freed += record.size()
+	}
+	return freed
+}
+
+// recordOverhead approximates the memory of a record besides its key and
+// result.
+const recordOverhead = 96
+
+func (r Record) size() int64 {
+	return int64(recordOverhead + len(r.Key) + len(r.Result))
+}
+
+// Len returns the number of records, including expired ones that have not
+// been looked up since they expired.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
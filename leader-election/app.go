@@ -0,0 +1,196 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/leader-election/leaderelection"
+)
+
+var start = time.Now()
+
+func logf(format string, args ...interface{}) {
+	fmt.Printf("%6.2fs  %s\n", time.Since(start).Seconds(), fmt.Sprintf(format, args...))
+}
+
+// crashable stands in for a process that can die: once crashed, it can no
+// longer reach the lock, and it never gets to release it.
+type crashable struct {
+	leaderelection.Lock
+	crashed atomic.Bool
+}
+
+var errCrashed = errors.New("process crashed")
+
+func (c *crashable) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	if c.crashed.Load() {
+		return false, errCrashed
+	}
+	return c.Lock.Acquire(ctx, holder, ttl)
+}
+
+func (c *crashable) Release(ctx context.Context, holder string) error {
+	if c.crashed.Load() {
+		return errCrashed
+	}
+	return c.Lock.Release(ctx, holder)
+}
+
+type candidate struct {
+	elector *leaderelection.Elector
+	lock    *crashable
+	stop    context.CancelFunc
+	done    chan struct{}
+}
+
+func main() {
+	backend := flag.String("backend", "memory", "where the lock lives: memory, file or redis")
+	path := flag.String("file", filepath.Join(os.TempDir(), "leader-election-demo.lock"), "lock file for the file backend")
+	addr := flag.String("redis", "localhost:6379", "Redis address for the redis backend")
+	n := flag.Int("candidates", 3, "number of candidates")
+	ttl := flag.Duration("ttl", 2*time.Second, "lease duration")
+	flag.Parse()
+
+	var shared leaderelection.MemoryLock
+	newLock := func() leaderelection.Lock {
+		switch *backend {
+		case "file":
+			return leaderelection.NewFileLock(*path)
+		case "redis":
+			return leaderelection.NewRedisLock(*addr, "leader-election-demo")
+		}
+		return &shared
+	}
+	switch *backend {
+	case "memory", "redis":
+	case "file":
+		os.Remove(*path)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown backend %q\n", *backend)
+		os.Exit(2)
+	}
+
+	var wg sync.WaitGroup
+	candidates := make([]*candidate, *n)
+	for i := range candidates {
+		c := &candidate{lock: &crashable{Lock: newLock()}, done: make(chan struct{})}
+		id := fmt.Sprintf("candidate-%d", i+1)
+		elector, err := leaderelection.New(leaderelection.Config{
+			Lock: c.lock,
+			ID:   id,
+			TTL:  *ttl,
+			OnElected: func(ctx context.Context) {
+				logf("%s elected", id)
+				ticker := time.NewTicker(*ttl / 2)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-ticker.C:
+						if c.elector.IsLeader() {
+							logf("%s compacts history", id)
+						}
+					}
+				}
+			},
+			OnLost: func(err error) {
+				if err != nil {
+					logf("%s stepped down: %v", id, err)
+				} else {
+					logf("%s stepped down", id)
+				}
+			},
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		c.elector = elector
+		ctx, cancel := context.WithCancel(context.Background())
+		c.stop = cancel
+		candidates[i] = c
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(c.done)
+			if err := elector.Run(ctx); err != nil {
+				logf("%s: %v", id, err)
+			}
+		}()
+	}
+
+	leader := func() *candidate {
+		for _, c := range candidates {
+			if c.elector.IsLeader() {
+				return c
+			}
+		}
+		return nil
+	}
+
+	logf("%d candidates share a %s lock with a %v lease", *n, *backend, *ttl)
+	time.Sleep(*ttl)
+
+	if c := leader(); c != nil {
+		logf("%s crashes without releasing the lock", c.elector.ID())
+		c.lock.crashed.Store(true)
+	}
+	// The others wait for the lease to run out.
+	time.Sleep(2 * *ttl)
+
+	if c := leader(); c != nil {
+		logf("%s shuts down and releases the lock", c.elector.ID())
+		c.stop()
+		<-c.done
+	}
+	// The next candidate takes over on its next attempt.
+	time.Sleep(*ttl)
+
+	var ids []string
+	for _, c := range candidates {
+		if c.elector.IsLeader() {
+			ids = append(ids, c.elector.ID())
+		}
+		c.stop()
+	}
+	wg.Wait()
+	logf("leader at the end: %s", strings.Join(ids, ", "))
+}
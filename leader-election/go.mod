@@ -0,0 +1,7 @@
+module github.com/rajamummidi/go-design-patterns/leader-election
+
+go 1.20
+
+require github.com/rajamummidi/go-design-patterns/resp v0.0.0
+
+replace github.com/rajamummidi/go-design-patterns/resp => ../resp
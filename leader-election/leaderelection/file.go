@@ -0,0 +1,105 @@
+//go:build unix
+
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package leaderelection
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+// FileLock is a lock for processes on the same host. The lease is kept as
+// JSON in a file, and every change to it is made under an exclusive flock
+// of that file, which the operating system drops when a process dies.
+// File locks are unreliable on network file systems; use RedisLock across
+// hosts.
+type FileLock struct {
+	path string
+}
+
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+func (l *FileLock) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	var ok bool
+	err := l.update(func(current *lease) bool {
+		ok = current.acquire(holder, ttl, time.Now())
+		return ok
+	})
+	return ok, err
+}
+
+func (l *FileLock) Release(ctx context.Context, holder string) error {
+	return l.update(func(current *lease) bool {
+		return current.release(holder)
+	})
+}
+
+// update applies fn to the lease in the file while holding the flock, and
+// writes it back if fn reports a change.
+func (l *FileLock) update(fn func(*lease) bool) error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close() // also drops the flock
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	var current lease
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &current); err != nil {
+			return err
+		}
+	}
+	if !fn(&current) {
+		return nil
+	}
+
+	data, err = json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err = file.WriteAt(data, 0)
+	return err
+}
@@ -0,0 +1,57 @@
+//go:build !unix
+
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package leaderelection
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var errNoFileLocks = errors.New("leaderelection: file locks need a Unix system")
+
+// FileLock is a lock for processes on the same host. It relies on flock,
+// so on other systems every call fails.
+type FileLock struct {
+	path string
+}
+
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+func (l *FileLock) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	return false, errNoFileLocks
+}
+
+func (l *FileLock) Release(ctx context.Context, holder string) error {
+	return errNoFileLocks
+}
@@ -0,0 +1,246 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package leaderelection elects one leader among several instances of a
+// service, so that work which must happen exactly once, such as a
+// compaction or a report, is done by one of them at a time.
+//
+// Candidates compete for a lock with a lease: whoever holds it is the
+// leader until the lease runs out, and the leader renews the lease well
+// before that. A leader that crashes, or loses touch with the lock, stops
+// renewing, and another candidate takes over once the lease has expired.
+// Where the lock lives is up to a pluggable Lock: in memory for candidates
+// in one process, in a file for processes on one host, or in Redis for
+// processes anywhere.
+package leaderelection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Lock is a lock with a lease, shared by the candidates of an election.
+type Lock interface {
+	// Acquire takes the lock for holder until ttl from now if it is free,
+	// or if its lease has expired, and reports whether holder has it. If
+	// holder has it already, Acquire renews the lease.
+	Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error)
+	// Release frees the lock if holder has it, so the next candidate does
+	// not have to wait for the lease to expire.
+	Release(ctx context.Context, holder string) error
+}
+
+// Config configures a candidate. Lock and ID are required.
+type Config struct {
+	Lock Lock
+	// ID identifies the candidate. It must be unique among the candidates,
+	// for example the host name and process ID.
+	ID string
+
+	// TTL is how long a lease lasts (15s). It bounds how long the service
+	// is without a leader after the leader crashes.
+	TTL time.Duration
+	// RetryInterval is how often the leader renews its lease and the
+	// other candidates try to acquire it (TTL/3).
+	RetryInterval time.Duration
+
+	// OnElected is called on its own goroutine when the candidate becomes
+	// the leader, with a context that is canceled when it stops being the
+	// leader. Work that only the leader may do should stop then, and
+	// should check IsLeader before each step: the context is canceled on
+	// the first failed renewal after the lease ran out, which can be up to
+	// RetryInterval later.
+	OnElected func(ctx context.Context)
+	// OnLost is called when the candidate stops being the leader, with the
+	// error that made it lose the lease, if any.
+	OnLost func(err error)
+	// OnError, if set, is called with every error from the lock, so that a
+	// candidate that cannot reach it does not go unnoticed.
+	OnError func(err error)
+}
+
+func (c Config) withDefaults() Config {
+	if c.TTL <= 0 {
+		c.TTL = 15 * time.Second
+	}
+	if c.RetryInterval <= 0 || c.RetryInterval >= c.TTL {
+		c.RetryInterval = c.TTL / 3
+	}
+	return c
+}
+
+// errLeaseLost is passed to OnLost when the lock was taken by someone else.
+var errLeaseLost = errors.New("leaderelection: lease lost to another candidate")
+
+// Elector is a candidate in an election. It is safe for concurrent use.
+type Elector struct {
+	config Config
+
+	mu         sync.Mutex
+	leader     bool
+	leaseUntil time.Time
+	stepDown   context.CancelFunc
+}
+
+func New(config Config) (*Elector, error) {
+	if config.Lock == nil || config.ID == "" {
+		return nil, errors.New("leaderelection: Lock and ID are required")
+	}
+	return &Elector{config: config.withDefaults()}, nil
+}
+
+func (e *Elector) ID() string {
+	return e.config.ID
+}
+
+// IsLeader reports whether the candidate is the leader. It turns false as
+// soon as the lease runs out, even before a failed renewal is noticed, so
+// a leader cut off from the lock never overlaps with its successor.
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.leader && time.Now().Before(e.leaseUntil)
+}
+
+// Run takes part in the election until ctx is done, then steps down and
+// releases the lock if it holds it.
+func (e *Elector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.config.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		e.campaign(ctx)
+		select {
+		case <-ctx.Done():
+			if e.lose(nil) {
+				release, cancel := context.WithTimeout(context.Background(), e.config.RetryInterval)
+				defer cancel()
+				if err := e.config.Lock.Release(release, e.config.ID); err != nil {
+					return fmt.Errorf("leaderelection: releasing lock: %w", err)
+				}
+			}
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// campaign acquires or renews the lease once.
+func (e *Elector) campaign(ctx context.Context) {
+	// The lease is counted from before the request, so the candidate's
+	// idea of it never outlasts the lock's.
+	start := time.Now()
+	attempt, cancel := context.WithTimeout(ctx, e.config.RetryInterval)
+	ok, err := e.config.Lock.Acquire(attempt, e.config.ID, e.config.TTL)
+	cancel()
+	if ctx.Err() != nil {
+		return
+	}
+
+	switch {
+	case err == nil && ok:
+		e.win(start.Add(e.config.TTL))
+	case err == nil:
+		e.lose(errLeaseLost)
+	default:
+		if e.config.OnError != nil {
+			e.config.OnError(err)
+		}
+		// The lock may be unreachable only for a moment, so the leader
+		// keeps its lease until it runs out.
+		e.mu.Lock()
+		expired := !time.Now().Before(e.leaseUntil)
+		e.mu.Unlock()
+		if expired {
+			e.lose(err)
+		}
+	}
+}
+
+func (e *Elector) win(leaseUntil time.Time) {
+	e.mu.Lock()
+	e.leaseUntil = leaseUntil
+	if e.leader {
+		e.mu.Unlock()
+		return
+	}
+	e.leader = true
+	ctx, cancel := context.WithCancel(context.Background())
+	e.stepDown = cancel
+	e.mu.Unlock()
+
+	if e.config.OnElected != nil {
+		go e.config.OnElected(ctx)
+	}
+}
+
+// lose steps down if the candidate is the leader, and reports whether it
+// was.
+func (e *Elector) lose(err error) bool {
+	e.mu.Lock()
+	if !e.leader {
+		e.mu.Unlock()
+		return false
+	}
+	e.leader = false
+	e.leaseUntil = time.Time{}
+	e.stepDown()
+	e.mu.Unlock()
+
+	if e.config.OnLost != nil {
+		e.config.OnLost(err)
+	}
+	return true
+}
+
+// lease is the state of a lock kept by this package, in memory or in a
+// file.
+type lease struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+func (l *lease) acquire(holder string, ttl time.Duration, now time.Time) bool {
+	if l.Holder != "" && l.Holder != holder && now.Before(l.Expires) {
+		return false
+	}
+	l.Holder, l.Expires = holder, now.Add(ttl)
+	return true
+}
+
+func (l *lease) release(holder string) bool {
+	if l.Holder != holder {
+		return false
+	}
+	*l = lease{}
+	return true
+}
@@ -0,0 +1,87 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package leaderelection
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/resp/resp"
+)
+
+// renewScript extends the lease if holder has the lock. Comparing and
+// extending in one script keeps a lease that expired in between from being
+// extended for its new holder.
+const renewScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`
+
+// releaseScript deletes the lock if holder has it.
+const releaseScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`
+
+// RedisError is an error reply from Redis.
+type RedisError = resp.Error
+
+// RedisLock is a lock kept in a Redis key, for processes on any host. The
+// key holds the ID of the leader and expires with its lease: a candidate
+// takes the lock with SET NX PX, which only succeeds once the key is gone,
+// and the leader renews the expiry with a script that first checks that
+// the key is still its own.
+//
+// It sends its commands through a resp.Client, whose Password field it
+// shares, over one connection that is redialed after an error.
+type RedisLock struct {
+	*resp.Client
+	key string
+}
+
+func NewRedisLock(addr, key string) *RedisLock {
+	return &RedisLock{Client: resp.NewClient(addr), key: key}
+}
+
+func (l *RedisLock) Acquire(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	ms := strconv.FormatInt(ttl.Milliseconds(), 10)
+	reply, err := l.Do(ctx, "SET", l.key, holder, "NX", "PX", ms)
+	if err != nil || reply != nil {
+		return err == nil, err
+	}
+	// The key exists. It may be ours, in which case this is a renewal.
+	reply, err = l.Do(ctx, "EVAL", renewScript, "1", l.key, holder, ms)
+	return reply == int64(1), err
+}
+
+func (l *RedisLock) Release(ctx context.Context, holder string) error {
+	_, err := l.Do(ctx, "EVAL", releaseScript, "1", l.key, holder)
+	return err
+}
@@ -0,0 +1,88 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/leakcheck/leakcheck"
+)
+
+// ticker reports ticks until it is stopped. The leaky version forgets to
+// end its goroutine in Stop.
+type ticker struct {
+	leaky bool
+	done  chan struct{}
+	ticks chan int
+}
+
+func startTicker(leaky bool) *ticker {
+	t := &ticker{leaky: leaky, done: make(chan struct{}), ticks: make(chan int)}
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case t.ticks <- i:
+			case <-t.done:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+func (t *ticker) Stop() {
+	if !t.leaky {
+		close(t.done)
+	}
+}
+
+func run(leaky bool) {
+	snapshot := leakcheck.IgnoreCurrent()
+
+	t := startTicker(leaky)
+	fmt.Println("  ticks:", <-t.ticks, <-t.ticks, <-t.ticks)
+	t.Stop()
+
+	if err := leakcheck.Find(snapshot, leakcheck.Timeout(100*time.Millisecond)); err != nil {
+		leak := err.(*leakcheck.LeakError)
+		for _, g := range leak.Goroutines {
+			fmt.Printf("  leaked goroutine %d [%s] in %s\n", g.ID, g.State, g.Top)
+		}
+		return
+	}
+	fmt.Println("  no goroutines leaked")
+}
+
+func main() {
+	fmt.Println("A ticker that stops its goroutine:")
+	run(false)
+	fmt.Println("A ticker that does not:")
+	run(true)
+}
@@ -0,0 +1,3 @@
+module github.com/rajamummidi/go-design-patterns/leakcheck
+
+go 1.21
@@ -0,0 +1,299 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package leakcheck finds goroutines and subscriptions that outlive the code
+// that started them. A test takes a snapshot of what is running when it
+// starts, and once it has stopped everything it started, checks that nothing
+// besides the snapshot is left:
+//
+//	func TestServer(t *testing.T) {
+//		leakcheck.Check(t)
+//		s := NewServer()
+//		defer s.Stop()
+//		...
+//	}
+//
+// Goroutines usually exit a little after the Stop that ends them returns,
+// so the check retries for a while before it reports a leak.
+package leakcheck
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Goroutine is a goroutine in a stack dump.
+type Goroutine struct {
+	ID    int
+	State string
+	// Top is the function the goroutine is in, such as
+	// "net/http.(*Server).Serve".
+	Top   string
+	Stack string
+}
+
+func (g Goroutine) String() string {
+	return g.Stack
+}
+
+// Goroutines returns every goroutine that is running, except the caller.
+func Goroutines() []Goroutine {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	var all []Goroutine
+	// The first stack is the caller's.
+	for i, stack := range bytes.Split(buf, []byte("\n\n")) {
+		if g, ok := parse(string(stack)); ok && i > 0 {
+			all = append(all, g)
+		}
+	}
+	return all
+}
+
+// parse reads a stack that starts with a header such as
+// "goroutine 7 [chan receive]:".
+func parse(stack string) (Goroutine, bool) {
+	header, rest, _ := strings.Cut(stack, "\n")
+	header, ok := strings.CutPrefix(header, "goroutine ")
+	if !ok {
+		return Goroutine{}, false
+	}
+	id, state, ok := strings.Cut(strings.TrimSuffix(header, ":"), " ")
+	if !ok {
+		return Goroutine{}, false
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return Goroutine{}, false
+	}
+	state = strings.TrimSuffix(strings.TrimPrefix(state, "["), "]")
+	top, _, _ := strings.Cut(rest, "\n")
+	if i := strings.LastIndex(top, "("); i > 0 {
+		top = top[:i]
+	}
+	return Goroutine{ID: n, State: state, Top: top, Stack: stack}, true
+}
+
+type options struct {
+	ignored  map[int]bool
+	ignoreFn []string
+	timeout  time.Duration
+}
+
+// Option configures Find, Check and VerifyNone.
+type Option func(*options)
+
+// IgnoreCurrent ignores the goroutines running when it is called, which is
+// the snapshot Check takes.
+func IgnoreCurrent() Option {
+	ids := make(map[int]bool)
+	for _, g := range Goroutines() {
+		ids[g.ID] = true
+	}
+	return func(o *options) {
+		for id := range ids {
+			o.ignored[id] = true
+		}
+	}
+}
+
+// IgnoreTopFunction ignores goroutines that are in the function fn, given
+// with its package path, such as "database/sql.(*DB).connectionOpener".
+// It is meant for goroutines a package starts once and keeps running.
+func IgnoreTopFunction(fn string) Option {
+	return func(o *options) {
+		o.ignoreFn = append(o.ignoreFn, fn)
+	}
+}
+
+// Timeout sets how long Find waits for goroutines to exit before it reports
+// them. The default is two seconds.
+func Timeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// background lists functions of the runtime and the testing package whose
+// goroutines run for the whole test binary.
+var background = []string{
+	"testing.(*T).Run",
+	"testing.(*T).Parallel",
+	"testing.runTests",
+	"testing.(*M).startAlarm",
+	"testing.tRunner",
+	"os/signal.signal_recv",
+	"os/signal.loop",
+	"runtime.goexit",
+	"runtime.ensureSigM",
+}
+
+func (o *options) ignores(g Goroutine) bool {
+	if o.ignored[g.ID] {
+		return true
+	}
+	for _, fn := range o.ignoreFn {
+		if g.Top == fn {
+			return true
+		}
+	}
+	for _, fn := range background {
+		if g.Top == fn {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns an error listing the goroutines that are running and not
+// ignored by opts, once they have had the timeout to exit.
+func Find(opts ...Option) error {
+	o := options{ignored: make(map[int]bool), timeout: 2 * time.Second}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	deadline := time.Now().Add(o.timeout)
+	wait := time.Millisecond
+	for {
+		var leaked []Goroutine
+		for _, g := range Goroutines() {
+			if !o.ignores(g) {
+				leaked = append(leaked, g)
+			}
+		}
+		if len(leaked) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return &LeakError{Goroutines: leaked}
+		}
+		time.Sleep(wait)
+		if wait < 100*time.Millisecond {
+			wait *= 2
+		}
+	}
+}
+
+// LeakError is the error of Find. It lists the leaked goroutines.
+type LeakError struct {
+	Goroutines []Goroutine
+}
+
+func (e *LeakError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "leakcheck: %d goroutines leaked", len(e.Goroutines))
+	for _, g := range e.Goroutines {
+		b.WriteString("\n\n")
+		b.WriteString(g.Stack)
+	}
+	return b.String()
+}
+
+// TB is the part of testing.TB the checks use.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Cleanup(func())
+}
+
+// VerifyNone fails t if Find reports leaked goroutines.
+func VerifyNone(t TB, opts ...Option) {
+	t.Helper()
+	if err := Find(opts...); err != nil {
+		t.Errorf("%v", err)
+	}
+}
+
+// Check takes a snapshot of the goroutines running now and, once t and its
+// cleanups have finished, fails t if goroutines that are not in the
+// snapshot are still running. Call it first thing in a test, so the cleanups
+// that stop what the test started run before the check. Tests running in
+// parallel see each other's goroutines, so Check is for sequential tests.
+func Check(t TB, opts ...Option) {
+	t.Helper()
+	opts = append([]Option{IgnoreCurrent()}, opts...)
+	t.Cleanup(func() {
+		t.Helper()
+		VerifyNone(t, opts...)
+	})
+}
+
+// Subscriber is a bus that reports its subscriptions by topic, such as
+// eventbus.EventBus.
+type Subscriber[S any] interface {
+	Subscriptions() map[string][]S
+}
+
+// CheckSubscriptions takes a snapshot of how many subscriptions bus has on
+// each topic and, once t and its cleanups have finished, fails t if a topic
+// has more than it had then.
+func CheckSubscriptions[S any](t TB, bus Subscriber[S]) {
+	t.Helper()
+	before := count(bus)
+	t.Cleanup(func() {
+		t.Helper()
+		if leaked := leakedSubscriptions(before, count(bus)); len(leaked) > 0 {
+			t.Errorf("leakcheck: subscriptions leaked: %s", strings.Join(leaked, ", "))
+		}
+	})
+}
+
+func count[S any](bus Subscriber[S]) map[string]int {
+	counts := make(map[string]int)
+	for topic, subs := range bus.Subscriptions() {
+		counts[topic] = len(subs)
+	}
+	return counts
+}
+
+// leakedSubscriptions describes the topics that have more subscriptions
+// after than before, sorted by topic.
+func leakedSubscriptions(before, after map[string]int) []string {
+	var leaked []string
+	for topic, n := range after {
+		if n > before[topic] {
+			leaked = append(leaked, fmt.Sprintf("%s (%d more)", topic, n-before[topic]))
+		}
+	}
+	sort.Strings(leaked)
+	return leaked
+}
@@ -0,0 +1,159 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package leakcheck
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorder is a TB that records failures instead of failing the test.
+type recorder struct {
+	errors   []string
+	cleanups []func()
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Cleanup(fn func()) {
+	r.cleanups = append(r.cleanups, fn)
+}
+
+// finish runs the cleanups, last registered first, as testing does.
+func (r *recorder) finish() {
+	for i := len(r.cleanups) - 1; i >= 0; i-- {
+		r.cleanups[i]()
+	}
+}
+
+func TestParse(t *testing.T) {
+	stack := "goroutine 42 [chan receive, 3 minutes]:\n" +
+		"example.com/server.(*Server).loop(0xc000010000)\n" +
+		"\t/src/server.go:12 +0x25\n" +
+		"created by example.com/server.New in goroutine 1\n" +
+		"\t/src/server.go:8 +0x65"
+	g, ok := parse(stack)
+	if !ok {
+		t.Fatal("parse failed")
+	}
+	if g.ID != 42 || g.State != "chan receive, 3 minutes" || g.Top != "example.com/server.(*Server).loop" {
+		t.Fatalf("got %d %q %q", g.ID, g.State, g.Top)
+	}
+	if _, ok := parse("not a stack"); ok {
+		t.Fatal("parsed a stack without a header")
+	}
+}
+
+func blocker() (stop func()) {
+	done := make(chan struct{})
+	go func() { <-done }()
+	return func() { close(done) }
+}
+
+func TestFindReportsLeak(t *testing.T) {
+	ignore := IgnoreCurrent()
+	stop := blocker()
+	err := Find(ignore, Timeout(50*time.Millisecond))
+	stop()
+
+	leak, ok := err.(*LeakError)
+	if !ok {
+		t.Fatalf("got %v, want a LeakError", err)
+	}
+	if len(leak.Goroutines) != 1 || !strings.Contains(leak.Goroutines[0].Stack, "leakcheck.blocker") {
+		t.Fatalf("got %v", leak)
+	}
+	if err := Find(ignore); err != nil {
+		t.Fatalf("goroutine still reported after it exited: %v", err)
+	}
+}
+
+func TestFindWaitsForExit(t *testing.T) {
+	ignore := IgnoreCurrent()
+	stop := blocker()
+	time.AfterFunc(20*time.Millisecond, stop)
+	if err := Find(ignore); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIgnoreTopFunction(t *testing.T) {
+	ignore := IgnoreCurrent()
+	done := make(chan struct{})
+	defer close(done)
+	go func() { <-done }()
+	if err := Find(ignore, IgnoreTopFunction("github.com/rajamummidi/go-design-patterns/leakcheck/leakcheck.TestIgnoreTopFunction.func1"), Timeout(0)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	r := &recorder{}
+	Check(r, Timeout(50*time.Millisecond))
+	stop := blocker()
+	r.finish()
+	stop()
+	if len(r.errors) != 1 {
+		t.Fatalf("got %d errors, want 1", len(r.errors))
+	}
+
+	r = &recorder{}
+	Check(r)
+	stop = blocker()
+	r.Cleanup(stop)
+	r.finish()
+	if len(r.errors) != 0 {
+		t.Fatalf("a goroutine stopped by a cleanup was reported: %v", r.errors)
+	}
+}
+
+type bus map[string][]int
+
+func (b bus) Subscriptions() map[string][]int { return b }
+
+func TestCheckSubscriptions(t *testing.T) {
+	b := bus{"a": {1}, "b": {2}}
+	r := &recorder{}
+	CheckSubscriptions(r, b)
+	b["a"] = append(b["a"], 3)
+	b["c"] = []int{4, 5}
+	delete(b, "b")
+	r.finish()
+
+	want := "leakcheck: subscriptions leaked: a (1 more), c (2 more)"
+	if len(r.errors) != 1 || r.errors[0] != want {
+		t.Fatalf("got %q, want %q", r.errors, want)
+	}
+}
@@ -0,0 +1,146 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/lifecycle/lifecycle"
+)
+
+// fake stands in for a real component and prints its start and stop.
+func fake(name string, startErr error) lifecycle.Component {
+	return lifecycle.Hooks{
+		OnStart: func(ctx context.Context) error {
+			if startErr != nil {
+				fmt.Printf("  %s failed to start: %v\n", name, startErr)
+				return startErr
+			}
+			fmt.Printf("  started %s\n", name)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			fmt.Printf("  stopped %s\n", name)
+			return nil
+		},
+	}
+}
+
+// register adds the components of an event-driven service, deliberately
+// in no particular order; the manager sorts them out. bridgeErr makes the
+// broker bridge fail to start.
+func register(m *lifecycle.Manager, bridgeErr error) {
+	m.Register("http", fake("http", nil), "projections", "bridge")
+	m.Register("projections", fake("projections", nil), "eventstore", "eventbus")
+	m.Register("bridge", fake("bridge", bridgeErr), "eventbus")
+	m.Register("eventstore", fake("eventstore", nil))
+	m.Register("eventbus", fake("eventbus", nil))
+}
+
+// slow stands in for a component that takes a while to stop, such as a
+// server finishing its requests. A stop that takes longer than the
+// component's timeout is given up on.
+func slow(name string, d time.Duration) lifecycle.Component {
+	return lifecycle.Hooks{
+		OnStart: func(ctx context.Context) error {
+			fmt.Printf("  started %s\n", name)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			fmt.Printf("  stopping %s, which takes %s\n", name, d)
+			time.Sleep(d)
+			fmt.Printf("  stopped %s\n", name)
+			return nil
+		},
+	}
+}
+
+func printStatus(m *lifecycle.Manager) {
+	for _, s := range m.Status() {
+		fmt.Printf("  %-12s %s\n", s.Name, s.State)
+	}
+}
+
+func main() {
+	ctx := context.Background()
+
+	m := lifecycle.New()
+	register(m, nil)
+	order, _ := m.Order()
+	fmt.Println("start order:", order)
+
+	fmt.Println("starting:")
+	m.Start(ctx)
+	fmt.Println("ready:", m.Ready())
+	fmt.Println("stopping:")
+	m.Stop(ctx)
+
+	// A component that fails to start takes down the ones started before
+	// it, and the status shows which one it was.
+	m = lifecycle.New()
+	register(m, errors.New("broker unreachable"))
+	fmt.Println("starting with a broken bridge:")
+	if err := m.Start(ctx); err != nil {
+		fmt.Println("error:", err)
+	}
+	printStatus(m)
+
+	// Run stops the components when the process is interrupted. The
+	// demo interrupts itself; a bridge stuck in its stop is given up on
+	// after its timeout, and the rest still stop.
+	m = lifecycle.New()
+	m.SetStopTimeout(time.Second)
+	m.Register("eventbus", fake("eventbus", nil))
+	m.Register("bridge", lifecycle.WithStopTimeout(slow("bridge", time.Hour), 200*time.Millisecond), "eventbus")
+	m.Register("http", slow("http", 100*time.Millisecond), "bridge")
+	fmt.Println("running until interrupted:")
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		self, _ := os.FindProcess(os.Getpid())
+		fmt.Println("  interrupt")
+		self.Signal(os.Interrupt)
+	}()
+	if err := m.Run(ctx); err != nil {
+		fmt.Println("error:", err)
+	}
+	printStatus(m)
+
+	// A cycle leaves no order to start in.
+	m = lifecycle.New()
+	m.Register("orders", fake("orders", nil), "billing")
+	m.Register("billing", fake("billing", nil), "shipping")
+	m.Register("shipping", fake("shipping", nil), "orders")
+	if _, err := m.Order(); err != nil {
+		fmt.Println("error:", err)
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/rajamummidi/go-design-patterns/lifecycle
+
+go 1.20
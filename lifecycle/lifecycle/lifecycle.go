@@ -0,0 +1,427 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package lifecycle starts and stops the components of a program in
+// dependency order. Components declare what they depend on when they are
+// registered, for example bridges on the event bus and projections on the
+// event store. The manager starts every component after its dependencies
+// and stops them in the reverse order, and it reports the state of each
+// component, so a readiness endpoint can tell which part is not up yet.
+// Run ties this to the signals a process is stopped with, and stop
+// timeouts keep one stuck component from holding up the rest.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrExists is returned by Register for a name that is taken.
+var ErrExists = errors.New("lifecycle: component already registered")
+
+// Component is a part of a program with a start and a stop.
+type Component interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// Hooks adapts a pair of functions to a Component. Either may be nil.
+type Hooks struct {
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+func (h Hooks) Start(ctx context.Context) error {
+	if h.OnStart == nil {
+		return nil
+	}
+	return h.OnStart(ctx)
+}
+
+func (h Hooks) Stop(ctx context.Context) error {
+	if h.OnStop == nil {
+		return nil
+	}
+	return h.OnStop(ctx)
+}
+
+// WithStopTimeout returns c with a stop timeout of its own, which takes
+// the place of the manager's for it. A draining server needs longer than
+// a cache that only drops its entries.
+func WithStopTimeout(c Component, d time.Duration) Component {
+	return timeout{Component: c, d: d}
+}
+
+type timeout struct {
+	Component
+	d time.Duration
+}
+
+func (t timeout) StopTimeout() time.Duration {
+	return t.d
+}
+
+// State is where a component is in its lifecycle.
+type State int
+
+const (
+	Pending State = iota
+	Starting
+	Ready
+	Failed
+	Stopping
+	Stopped
+)
+
+func (s State) String() string {
+	switch s {
+	case Pending:
+		return "pending"
+	case Starting:
+		return "starting"
+	case Ready:
+		return "ready"
+	case Failed:
+		return "failed"
+	case Stopping:
+		return "stopping"
+	case Stopped:
+		return "stopped"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// CycleError is returned when the dependencies of the components form a
+// cycle, which leaves no order to start them in.
+type CycleError struct {
+	Path []string // the cycle, starting and ending with the same component
+}
+
+func (e *CycleError) Error() string {
+	return "lifecycle: dependency cycle " + strings.Join(e.Path, " -> ")
+}
+
+// Status is the state of one component.
+type Status struct {
+	Name      string
+	DependsOn []string
+	State     State
+	Err       error // why it failed to start or stop
+}
+
+type component struct {
+	name      string
+	c         Component
+	dependsOn []string
+	state     State
+	err       error
+}
+
+// Manager starts and stops registered components in dependency order. It
+// is safe for concurrent use.
+type Manager struct {
+	mu          sync.Mutex
+	components  []*component // in registration order
+	byName      map[string]*component
+	started     []*component // in start order
+	stopTimeout time.Duration
+}
+
+func New() *Manager {
+	return &Manager{byName: make(map[string]*component)}
+}
+
+// SetStopTimeout bounds how long Stop waits for each component that has no
+// timeout of its own from WithStopTimeout. Zero, the default, waits as long
+// as the context passed to Stop allows.
+func (m *Manager) SetStopTimeout(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopTimeout = d
+}
+
+// Register adds a component that is started after the components named in
+// dependsOn. The dependencies need not be registered yet, but they must be
+// by the time Start is called.
+func (m *Manager) Register(name string, c Component, dependsOn ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.byName[name]; ok {
+		return fmt.Errorf("%w: %s", ErrExists, name)
+	}
+	comp := &component{name: name, c: c, dependsOn: dependsOn}
+	m.components = append(m.components, comp)
+	m.byName[name] = comp
+	return nil
+}
+
+// Order returns the names of the components in the order Start starts
+// them: every component after its dependencies and otherwise in the order
+// they were registered. It fails on unknown dependencies and cycles.
+func (m *Manager) Order() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, err := m.order()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(order))
+	for i, c := range order {
+		names[i] = c.name
+	}
+	return names, nil
+}
+
+// order sorts the components topologically with a depth-first search. m.mu
+// must be held.
+func (m *Manager) order() ([]*component, error) {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	marks := make(map[*component]int)
+	var order []*component
+	var path []string
+
+	var visit func(c *component) error
+	visit = func(c *component) error {
+		switch marks[c] {
+		case done:
+			return nil
+		case visiting:
+			for i, name := range path {
+				if name == c.name {
+					return &CycleError{Path: append(path[i:len(path):len(path)], c.name)}
+				}
+			}
+		}
+		marks[c] = visiting
+		path = append(path, c.name)
+		for _, dep := range c.dependsOn {
+			d, ok := m.byName[dep]
+			if !ok {
+				return fmt.Errorf("lifecycle: %s depends on unknown component %s", c.name, dep)
+			}
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		marks[c] = done
+		order = append(order, c)
+		return nil
+	}
+
+	for _, c := range m.components {
+		if err := visit(c); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Start starts the components in dependency order. If one fails, the
+// components already started are stopped again, in reverse order, and
+// Start returns the error.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	order, err := m.order()
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range order {
+		if m.state(c) == Ready {
+			continue
+		}
+		m.setState(c, Starting, nil)
+		if err := c.c.Start(ctx); err != nil {
+			m.setState(c, Failed, err)
+			err = fmt.Errorf("lifecycle: starting %s: %w", c.name, err)
+			return errors.Join(err, m.Stop(ctx))
+		}
+		m.mu.Lock()
+		c.state = Ready
+		m.started = append(m.started, c)
+		m.mu.Unlock()
+	}
+	return nil
+}
+
+// Stop stops the started components in the reverse order of their start,
+// so a component stops before the components it depends on. It stops
+// every component even if some fail and returns their errors joined.
+//
+// A component that has not stopped when its stop timeout expires, or when
+// ctx is done, is given up on: it is marked failed and Stop moves on to the
+// next one, leaving it to finish in the background.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	started := m.started
+	m.started = nil
+	m.mu.Unlock()
+
+	var errs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		c := started[i]
+		m.setState(c, Stopping, nil)
+		if err := m.stop(ctx, c); err != nil {
+			m.setState(c, Failed, err)
+			errs = append(errs, fmt.Errorf("lifecycle: stopping %s: %w", c.name, err))
+			continue
+		}
+		m.setState(c, Stopped, nil)
+	}
+	return errors.Join(errs...)
+}
+
+// stop stops one component within its stop timeout.
+func (m *Manager) stop(ctx context.Context, c *component) error {
+	m.mu.Lock()
+	d := m.stopTimeout
+	m.mu.Unlock()
+	if t, ok := c.c.(interface{ StopTimeout() time.Duration }); ok {
+		d = t.StopTimeout()
+	}
+	if d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- c.c.Stop(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("gave up waiting: %w", ctx.Err())
+	}
+}
+
+// Run starts the components, waits until ctx is done or the process
+// receives one of signals, SIGINT or SIGTERM if none are given, and then
+// stops the components. A second signal while they stop gives up on the
+// ones still stopping, for an operator who cannot wait. Run returns the
+// error of Start or Stop.
+func (m *Manager) Run(ctx context.Context, signals ...os.Signal) error {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	received := make(chan os.Signal, 2)
+	signal.Notify(received, signals...)
+	defer signal.Stop(received)
+
+	if err := m.Start(ctx); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+	case <-received:
+	}
+
+	// The stop does not inherit ctx, which may be done already.
+	stopCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-received:
+			cancel()
+		case <-stopCtx.Done():
+		}
+	}()
+	return m.Stop(stopCtx)
+}
+
+func (m *Manager) state(c *component) State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return c.state
+}
+
+func (m *Manager) setState(c *component, state State, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c.state = state
+	c.err = err
+}
+
+// Status returns the state of every component, in registration order.
+func (m *Manager) Status() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]Status, len(m.components))
+	for i, c := range m.components {
+		statuses[i] = Status{Name: c.name, DependsOn: c.dependsOn, State: c.state, Err: c.err}
+	}
+	return statuses
+}
+
+// Ready reports whether every component has started.
+func (m *Manager) Ready() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, c := range m.components {
+		if c.state != Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// Check returns an error naming the components that are not ready, or nil
+// when all are. It has the signature of a health check, so a readiness
+// probe can use the manager directly.
+func (m *Manager) Check(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var names []string
+	for _, c := range m.components {
+		if c.state != Ready {
+			names = append(names, c.name+" is "+c.state.String())
+		}
+	}
+	if len(names) > 0 {
+		return errors.New("lifecycle: " + strings.Join(names, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rajamummidi/go-design-patterns/mediator/mediator"
+)
+
+// line is one step of the script both rooms play.
+type line struct {
+	from, text string
+}
+
+var script = []line{
+	{"alice", "morning all"},
+	{"bob", "@alice can you review my PR?"},
+	{"carol", "!who"},
+	{"dave", "BUY CHEAP WATCHES"},
+	{"alice", "!mute dave"},
+	{"dave", "BUY CHEAP WATCHES"},
+	{"carol", "@erin are you around?"},
+	{"bob", "!roll"},
+}
+
+// user prints and counts what it receives once the script starts.
+type user struct {
+	name     string
+	playing  bool
+	received int
+}
+
+func (u *user) Name() string { return u.name }
+
+func (u *user) Receive(msg mediator.Message) {
+	if !u.playing {
+		return
+	}
+	u.received++
+	fmt.Printf("  %-6s <- %s\n", u.name, msg)
+}
+
+// modBot answers !who and lets members mute each other. It knows the
+// mediator, like every colleague in the pattern, and asks it for what it
+// needs instead of keeping its own list of members.
+type modBot struct {
+	room *mediator.RoomMediator
+}
+
+func (b *modBot) Name() string                 { return "modbot" }
+func (b *modBot) Receive(msg mediator.Message) {}
+func (b *modBot) Commands() []string           { return []string{"mute", "unmute", "who"} }
+
+func (b *modBot) Handle(cmd mediator.Command) string {
+	switch cmd.Name {
+	case "who":
+		return "here: " + strings.Join(b.room.Members(), ", ")
+	case "mute", "unmute":
+		if len(cmd.Args) != 1 {
+			return "usage: !" + cmd.Name + " <name>"
+		}
+		if err := b.room.Mute(cmd.Args[0], cmd.Name == "mute"); err != nil {
+			return err.Error()
+		}
+		return cmd.Args[0] + " is " + cmd.Name + "d"
+	}
+	return ""
+}
+
+// transcript watches the room and keeps a log of everything said in it.
+type transcript struct {
+	lines []string
+}
+
+func (t *transcript) Name() string { return "transcript" }
+
+func (t *transcript) Receive(msg mediator.Message) {
+	t.lines = append(t.lines, msg.String())
+}
+
+// withMediator plays the script in a room coordinated by a RoomMediator.
+func withMediator() map[string]int {
+	room := mediator.NewRoomMediator("general")
+	log := &transcript{}
+	room.Watch(log)
+
+	users := make(map[string]*user)
+	for _, name := range []string{"alice", "bob", "carol", "dave"} {
+		users[name] = &user{name: name}
+		room.Join(users[name])
+	}
+	room.Join(&modBot{room: room})
+	for _, u := range users {
+		u.playing = true
+	}
+
+	for _, l := range script {
+		fmt.Printf("%s: %s\n", l.from, l.text)
+		if err := room.Send(l.from, l.text); err != nil {
+			fmt.Printf("  (%v)\n", err)
+		}
+	}
+	fmt.Printf("The transcript holds %d lines.\n", len(log.lines))
+
+	counts := make(map[string]int)
+	for name, u := range users {
+		counts[name] = u.received
+	}
+	return counts
+}
+
+// topic is plain publish/subscribe: every subscriber receives every
+// message and decides on its own what to do with it.
+type topic struct {
+	subscribers []func(from, text string)
+}
+
+func (t *topic) publish(from, text string) {
+	for _, s := range t.subscribers {
+		s(from, text)
+	}
+}
+
+// client is a participant of the pub/sub room. Every client has to apply
+// the rules of the room itself: ignore its own messages and direct
+// messages for others, and keep its own list of muted senders.
+type client struct {
+	name      string
+	muted     map[string]bool
+	received  int // messages delivered to the client
+	discarded int // of which it had to throw away
+	overheard int // direct messages for someone else it received
+}
+
+func (c *client) receive(from, text string) {
+	c.received++
+	if to, _, ok := strings.Cut(strings.TrimPrefix(text, "@"), " "); strings.HasPrefix(text, "@") && ok && to != c.name {
+		c.overheard++
+		c.discarded++
+		return
+	}
+	if from == c.name || c.muted[from] {
+		c.discarded++
+	}
+}
+
+// withPubSub plays the script on a topic.
+func withPubSub() map[string]*client {
+	var room topic
+	clients := make(map[string]*client)
+	for _, name := range []string{"alice", "bob", "carol", "dave"} {
+		c := &client{name: name, muted: make(map[string]bool)}
+		clients[name] = c
+		room.subscribers = append(room.subscribers, c.receive)
+	}
+	// Each client can only mute for itself, so alice's !mute is a note to
+	// her own client.
+	for _, l := range script {
+		if l.from == "alice" && l.text == "!mute dave" {
+			clients["alice"].muted["dave"] = true
+		}
+		room.publish(l.from, l.text)
+	}
+	return clients
+}
+
+func main() {
+	fmt.Println("=== Mediator")
+	mediated := withMediator()
+
+	fmt.Println("\n=== Plain pub/sub")
+	published := withPubSub()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "\tmediator\tpub/sub\tdiscarded\toverheard DMs\t")
+	for _, name := range []string{"alice", "bob", "carol", "dave"} {
+		c := published[name]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t\n", name, mediated[name], c.received, c.discarded, c.overheard)
+	}
+	w.Flush()
+	fmt.Println("\nWith pub/sub every client received every message: the direct message")
+	fmt.Println("reached carol and dave, the bot's commands cluttered the room, and dave's")
+	fmt.Println("spam still reached bob and carol, who had not muted him themselves.")
+}
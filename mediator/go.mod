@@ -0,0 +1,3 @@
+module github.com/rajamummidi/go-design-patterns/mediator
+
+go 1.20
@@ -0,0 +1,338 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package mediator implements the mediator pattern for a chat room. The
+// participants of a RoomMediator never talk to each other directly, and do
+// not broadcast to everyone either: they hand every message to the
+// mediator, which decides who receives it. Direct messages, bot commands,
+// muting and the room's transcript are rules of the mediator, kept in one
+// place instead of repeated in every participant.
+package mediator
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNameTaken    = errors.New("mediator: name already taken")
+	ErrCommandTaken = errors.New("mediator: command already handled by another bot")
+	ErrNotMember    = errors.New("mediator: not a member of the room")
+	ErrMuted        = errors.New("mediator: sender is muted")
+)
+
+// System is the sender of the messages the mediator sends itself, such as
+// announcements and errors.
+const System = "system"
+
+// Message is a message delivered to a participant.
+type Message struct {
+	Room string
+	From string
+	// To is the participant a direct message or a command reply is for,
+	// and empty for messages to the whole room.
+	To   string
+	Text string
+	Time time.Time
+}
+
+func (m Message) String() string {
+	if m.To != "" {
+		return fmt.Sprintf("[%s -> %s] %s", m.From, m.To, m.Text)
+	}
+	return fmt.Sprintf("[%s] %s", m.From, m.Text)
+}
+
+// Participant is a member of a room, such as a user's connection.
+type Participant interface {
+	Name() string
+	// Receive is called by the mediator for every message the participant
+	// is meant to see. It must not block for long.
+	Receive(msg Message)
+}
+
+// Command is a message of the form "!name args...".
+type Command struct {
+	From string
+	Name string
+	Args []string
+}
+
+// Bot is a participant that answers commands. The mediator routes a
+// command only to the bot that handles it, and sends the reply only to
+// the participant who asked, so commands do not clutter the room.
+type Bot interface {
+	Participant
+	Commands() []string
+	Handle(cmd Command) (reply string)
+}
+
+// RoomMediator coordinates the participants of one room. It is safe for
+// concurrent use. Participants are called without the mediator's lock
+// held, so they may call it back, for example to send a message or mute
+// someone.
+type RoomMediator struct {
+	room string
+
+	mu       sync.RWMutex
+	members  []Participant // in the order they joined
+	commands map[string]Bot
+	watchers []Participant
+	muted    map[string]bool
+}
+
+func NewRoomMediator(room string) *RoomMediator {
+	return &RoomMediator{
+		room:     room,
+		commands: make(map[string]Bot),
+		muted:    make(map[string]bool),
+	}
+}
+
+func (r *RoomMediator) Room() string {
+	return r.room
+}
+
+// Join adds p to the room and announces it. A bot's commands are routed to
+// it from then on.
+func (r *RoomMediator) Join(p Participant) error {
+	r.mu.Lock()
+	if p.Name() == System || r.member(p.Name()) != nil {
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrNameTaken, p.Name())
+	}
+	if bot, ok := p.(Bot); ok {
+		for _, name := range bot.Commands() {
+			if _, taken := r.commands[name]; taken || name == "help" {
+				r.mu.Unlock()
+				return fmt.Errorf("%w: %s", ErrCommandTaken, name)
+			}
+		}
+		for _, name := range bot.Commands() {
+			r.commands[name] = bot
+		}
+	}
+	r.members = append(r.members, p)
+	r.mu.Unlock()
+
+	r.deliver(Message{From: System, Text: p.Name() + " joined"})
+	return nil
+}
+
+// Leave removes the participant called name from the room, together with
+// the commands of a bot.
+func (r *RoomMediator) Leave(name string) {
+	r.mu.Lock()
+	p := r.member(name)
+	if p == nil {
+		r.mu.Unlock()
+		return
+	}
+	for i, m := range r.members {
+		if m == p {
+			r.members = append(r.members[:i:i], r.members[i+1:]...)
+			break
+		}
+	}
+	for command, bot := range r.commands {
+		if Participant(bot) == p {
+			delete(r.commands, command)
+		}
+	}
+	delete(r.muted, name)
+	r.mu.Unlock()
+
+	r.deliver(Message{From: System, Text: name + " left"})
+}
+
+// Watch makes p see every message in the room, including direct messages
+// and commands, without being a member: it cannot be addressed and does
+// not appear in Members. It suits transcripts and moderation tools.
+func (r *RoomMediator) Watch(p Participant) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.watchers = append(r.watchers, p)
+}
+
+// Mute stops or resumes the delivery of the messages of the participant
+// called name. Muted participants still receive messages, and may still
+// use commands.
+func (r *RoomMediator) Mute(name string, muted bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.member(name) == nil {
+		return fmt.Errorf("%w: %s", ErrNotMember, name)
+	}
+	if muted {
+		r.muted[name] = true
+	} else {
+		delete(r.muted, name)
+	}
+	return nil
+}
+
+// Members returns the names of the members, in the order they joined.
+func (r *RoomMediator) Members() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, len(r.members))
+	for i, p := range r.members {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// Send hands a message from the participant called from to the mediator,
+// which routes it:
+//
+//   - "!command args" goes to the bot handling the command, and the reply
+//     to from only;
+//   - "@name text" goes to name only;
+//   - anything else goes to every other member.
+//
+// Watchers see every message. Mistakes, such as an unknown recipient or
+// command, are explained to the sender in a message from System.
+func (r *RoomMediator) Send(from, text string) error {
+	r.mu.RLock()
+	sender := r.member(from)
+	muted := r.muted[from]
+	r.mu.RUnlock()
+	if sender == nil {
+		return fmt.Errorf("%w: %s", ErrNotMember, from)
+	}
+
+	text = strings.TrimSpace(text)
+	switch {
+	case strings.HasPrefix(text, "!"):
+		r.command(sender, text)
+	case muted:
+		r.deliver(Message{From: System, To: from, Text: "you are muted"})
+		return ErrMuted
+	case strings.HasPrefix(text, "@"):
+		to, body, _ := strings.Cut(text[1:], " ")
+		r.mu.RLock()
+		recipient := r.member(to)
+		r.mu.RUnlock()
+		if recipient == nil {
+			r.deliver(Message{From: System, To: from, Text: "nobody called " + to + " is here"})
+			return nil
+		}
+		r.deliver(Message{From: from, To: to, Text: body})
+	default:
+		r.deliver(Message{From: from, Text: text})
+	}
+	return nil
+}
+
+// command passes a command to the bot that handles it and returns the
+// reply to the sender.
+func (r *RoomMediator) command(sender Participant, text string) {
+	fields := strings.Fields(text[1:])
+	if len(fields) == 0 {
+		return
+	}
+	cmd := Command{From: sender.Name(), Name: fields[0], Args: fields[1:]}
+	r.watch(Message{From: cmd.From, Text: text})
+
+	r.mu.RLock()
+	bot, ok := r.commands[cmd.Name]
+	r.mu.RUnlock()
+	switch {
+	case cmd.Name == "help":
+		r.deliver(Message{From: System, To: cmd.From, Text: "commands: " + strings.Join(r.commandNames(), ", ")})
+	case !ok:
+		r.deliver(Message{From: System, To: cmd.From, Text: "unknown command !" + cmd.Name + ", try !help"})
+	default:
+		if reply := bot.Handle(cmd); reply != "" {
+			r.deliver(Message{From: bot.Name(), To: cmd.From, Text: reply})
+		}
+	}
+}
+
+func (r *RoomMediator) commandNames() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := []string{"help"}
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// deliver sends msg to its recipients: the addressee of a direct message,
+// or every member but the sender of a room message, and every watcher.
+func (r *RoomMediator) deliver(msg Message) {
+	msg.Room = r.room
+	msg.Time = time.Now()
+
+	r.mu.RLock()
+	var recipients []Participant
+	for _, p := range r.members {
+		if msg.To == "" && p.Name() != msg.From || msg.To == p.Name() {
+			recipients = append(recipients, p)
+		}
+	}
+	recipients = append(recipients, r.watchers...)
+	r.mu.RUnlock()
+
+	for _, p := range recipients {
+		p.Receive(msg)
+	}
+}
+
+// watch shows msg to the watchers only.
+func (r *RoomMediator) watch(msg Message) {
+	msg.Room = r.room
+	msg.Time = time.Now()
+
+	r.mu.RLock()
+	watchers := append([]Participant(nil), r.watchers...)
+	r.mu.RUnlock()
+	for _, p := range watchers {
+		p.Receive(msg)
+	}
+}
+
+// member returns the member called name, or nil. The caller must hold r.mu.
+func (r *RoomMediator) member(name string) Participant {
+	for _, p := range r.members {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/circuit-breaker/circuitbreaker"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/transport"
+	"github.com/rajamummidi/go-design-patterns/microservices/orders"
+	"github.com/rajamummidi/go-design-patterns/microservices/payment"
+	"github.com/rajamummidi/go-design-patterns/resp/resp"
+	"github.com/rajamummidi/go-design-patterns/task-queue/taskqueue"
+)
+
+// redelivering is a broker that delivers every nth message twice, as real
+// brokers do now and then after a consumer timed out or reconnected.
+type redelivering struct {
+	transport.Transport
+	every int64
+	count atomic.Int64
+}
+
+func (t *redelivering) Publish(ctx context.Context, msg transport.Message) error {
+	if err := t.Transport.Publish(ctx, msg); err != nil {
+		return err
+	}
+	if t.count.Add(1)%t.every == 0 {
+		fmt.Printf("    broker: redelivering %s\n", msg.Topic)
+		return t.Transport.Publish(ctx, msg)
+	}
+	return nil
+}
+
+// bank charges cards until it is taken down.
+type bank struct {
+	down     atomic.Bool
+	payments atomic.Int64
+}
+
+func (b *bank) Charge(ctx context.Context, card string, amount int64) (string, error) {
+	if b.down.Load() {
+		return "", errors.New("bank unavailable")
+	}
+	if card == "0000" {
+		return "", payment.ErrDeclined
+	}
+	return fmt.Sprintf("pay-%d", b.payments.Add(1)), nil
+}
+
+func main() {
+	redis := flag.String("redis", "", "Redis server to keep the notifier's jobs in, e.g. localhost:6379; in memory if empty")
+	flag.Parse()
+
+	var notifications taskqueue.Queue = taskqueue.NewMemory()
+	if *redis != "" {
+		client := resp.NewClient(*redis)
+		defer client.Close()
+		notifications = taskqueue.NewRedisQueue(client, "microservices-notifications")
+	}
+
+	// The services share nothing but the broker. Each has its own bus and a
+	// bridge that decides which topics leave and enter the service; with a
+	// network transport they would run as separate processes unchanged.
+	broker := &redelivering{Transport: transport.NewMemoryTransport(), every: 7}
+	defer broker.Close()
+
+	s := newStack(context.Background(), broker, notifications, map[string]int{"book": 5, "lamp": 0})
+	s.up()
+	defer s.down()
+	s.breaker.OnStateChange(func(from, to circuitbreaker.State) {
+		fmt.Printf("    payment: bank circuit %s -> %s\n", from, to)
+	})
+
+	place := func(order orders.Order) {
+		fmt.Printf("%s: %d %s for %d\n", order.ID, order.Quantity, order.Item, order.Amount)
+		// The final event is flushed from the outbox before place returns,
+		// so the output stays in order.
+		result, err := s.place(order)
+		if err != nil {
+			fmt.Println("  error:", err)
+			return
+		}
+		fmt.Printf("  => %s %s\n\n", result.Status, result.Reason)
+	}
+
+	place(orders.Order{ID: "order-1", Item: "book", Quantity: 1, Amount: 25_00, Card: "4242"})
+	place(orders.Order{ID: "order-2", Item: "book", Quantity: 2, Amount: 50_00, Card: "0000"})
+	place(orders.Order{ID: "order-3", Item: "lamp", Quantity: 1, Amount: 40_00, Card: "4242"})
+
+	fmt.Println("The bank goes down.")
+	s.bank.down.Store(true)
+	place(orders.Order{ID: "order-4", Item: "book", Quantity: 1, Amount: 25_00, Card: "4242"})
+	place(orders.Order{ID: "order-5", Item: "book", Quantity: 1, Amount: 25_00, Card: "4242"})
+	place(orders.Order{ID: "order-6", Item: "book", Quantity: 1, Amount: 25_00, Card: "4242"})
+
+	fmt.Println("The bank is back; the breaker lets a probe through once it has waited.")
+	s.bank.down.Store(false)
+	time.Sleep(payment.BreakerConfig.OpenTimeout)
+	place(orders.Order{ID: "order-7", Item: "book", Quantity: 2, Amount: 50_00, Card: "4242"})
+
+	fmt.Printf("books left: %d, messages relayed: %d\n", s.inventoryService.Stock("book"), s.relay.Published())
+	fmt.Printf("duplicates ignored: inventory %d, payment %d, notifier %d\n",
+		s.inventoryService.Duplicates(), s.paymentService.Duplicates(), s.notified.Stats().Duplicates)
+	fmt.Printf("notifications sent: %d\n", s.notifier.Stats().Done)
+}
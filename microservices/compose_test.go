@@ -0,0 +1,244 @@
+//go:build compose
+
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/circuit-breaker/circuitbreaker"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/transport"
+	"github.com/rajamummidi/go-design-patterns/leakcheck/leakcheck"
+	"github.com/rajamummidi/go-design-patterns/microservices/contracts"
+	"github.com/rajamummidi/go-design-patterns/microservices/orders"
+	"github.com/rajamummidi/go-design-patterns/microservices/payment"
+	"github.com/rajamummidi/go-design-patterns/task-queue/taskqueue"
+)
+
+// These tests bring the whole stack up and talk to it only through the
+// order service, the way a docker-compose test talks to running containers.
+// Run them with
+//
+//	go test -tags compose .
+
+// compose brings up a stack whose broker redelivers every nth message, and
+// takes it down when the test ends. Taking it down must end every goroutine
+// the stack started and remove the bridges' subscriptions from the buses.
+func compose(t *testing.T, every int64, stock map[string]int) *stack {
+	t.Helper()
+	leakcheck.Check(t)
+	broker := &redelivering{Transport: transport.NewMemoryTransport(), every: every}
+	s := newStack(context.Background(), broker, taskqueue.NewMemory(), stock)
+	for _, svc := range s.services {
+		leakcheck.CheckSubscriptions(t, svc.bus)
+	}
+	s.up()
+	t.Cleanup(func() {
+		s.down()
+		broker.Close()
+	})
+	return s
+}
+
+func book(id string, quantity int, card string) orders.Order {
+	return orders.Order{ID: id, Item: "book", Quantity: quantity, Amount: int64(quantity) * 25_00, Card: card}
+}
+
+func expectOrder(t *testing.T, got orders.Order, err error, status orders.Status, reason string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", got.ID, err)
+	}
+	if got.Status != status || !strings.Contains(got.Reason, reason) {
+		t.Fatalf("%s: got %s %q, want %s with a reason containing %q", got.ID, got.Status, got.Reason, status, reason)
+	}
+}
+
+func expectStock(t *testing.T, s *stack, item string, want int) {
+	t.Helper()
+	if got := s.inventoryService.Stock(item); got != want {
+		t.Fatalf("%s in stock: got %d, want %d", item, got, want)
+	}
+}
+
+func TestPlaceOrder(t *testing.T) {
+	s := compose(t, 1000, map[string]int{"book": 5, "lamp": 0})
+
+	got, err := s.place(book("order-1", 2, "4242"))
+	expectOrder(t, got, err, orders.Confirmed, "")
+	if got.PaymentID == "" {
+		t.Fatal("a confirmed order has no payment ID")
+	}
+	expectStock(t, s, "book", 3)
+
+	// A declined card cancels the order and gives the stock back.
+	got, err = s.place(book("order-2", 2, "0000"))
+	expectOrder(t, got, err, orders.Cancelled, payment.ErrDeclined.Error())
+	expectStock(t, s, "book", 3)
+
+	got, err = s.place(orders.Order{ID: "order-3", Item: "lamp", Quantity: 1, Amount: 40_00, Card: "4242"})
+	expectOrder(t, got, err, orders.Cancelled, "lamp is out of stock")
+
+	if _, err := s.place(book("order-1", 1, "4242")); err == nil {
+		t.Fatal("placing an order twice succeeded")
+	}
+
+	if n := s.bank.payments.Load(); n != 1 {
+		t.Fatalf("the bank charged %d cards, want 1", n)
+	}
+	if placed, confirmed, cancelled := s.notifications(contracts.OrderPlaced),
+		s.notifications(contracts.OrderConfirmed), s.notifications(contracts.OrderCancelled); placed != 3 || confirmed != 1 || cancelled != 2 {
+		t.Fatalf("notified placed %d, confirmed %d, cancelled %d; want 3, 1, 2", placed, confirmed, cancelled)
+	}
+}
+
+// TestRedelivery has the broker deliver every other message twice. Every
+// duplicate must be recognized: no card is charged twice, no stock goes
+// missing and no customer is notified twice.
+func TestRedelivery(t *testing.T) {
+	s := compose(t, 2, map[string]int{"book": 10})
+
+	for i := 1; i <= 4; i++ {
+		got, err := s.place(book(fmt.Sprintf("order-%d", i), 1, "4242"))
+		expectOrder(t, got, err, orders.Confirmed, "")
+	}
+	got, err := s.place(book("order-5", 1, "0000"))
+	expectOrder(t, got, err, orders.Cancelled, payment.ErrDeclined.Error())
+
+	expectStock(t, s, "book", 6)
+	if n := s.bank.payments.Load(); n != 4 {
+		t.Fatalf("the bank charged %d cards, want 4", n)
+	}
+	if placed, confirmed := s.notifications(contracts.OrderPlaced), s.notifications(contracts.OrderConfirmed); placed != 5 || confirmed != 4 {
+		t.Fatalf("notified placed %d, confirmed %d; want 5 and 4", placed, confirmed)
+	}
+	duplicates := s.inventoryService.Duplicates() + s.paymentService.Duplicates() + s.notified.Stats().Duplicates
+	if duplicates == 0 {
+		t.Fatal("no consumer saw a redelivered message")
+	}
+}
+
+// TestBankOutage takes the bank down until the breaker opens, and checks
+// that orders go through again once it is back.
+func TestBankOutage(t *testing.T) {
+	s := compose(t, 1000, map[string]int{"book": 5})
+
+	s.bank.down.Store(true)
+	for i, reason := range []string{"bank unavailable", "bank unavailable", circuitbreaker.ErrOpen.Error()} {
+		got, err := s.place(book(fmt.Sprintf("order-%d", i+1), 1, "4242"))
+		expectOrder(t, got, err, orders.Cancelled, reason)
+	}
+	expectStock(t, s, "book", 5)
+	if state := s.breaker.State(); state != circuitbreaker.Open {
+		t.Fatalf("breaker is %s, want open", state)
+	}
+
+	s.bank.down.Store(false)
+	time.Sleep(payment.BreakerConfig.OpenTimeout)
+	got, err := s.place(book("order-4", 2, "4242"))
+	expectOrder(t, got, err, orders.Confirmed, "")
+	expectStock(t, s, "book", 3)
+	if state := s.breaker.State(); state != circuitbreaker.Closed {
+		t.Fatalf("breaker is %s, want closed", state)
+	}
+}
+
+// TestServiceRestart stops the payment service. Orders placed meanwhile
+// time out waiting for the charge and release their stock; once the
+// service is started again, orders go through.
+func TestServiceRestart(t *testing.T) {
+	timeout := orders.ReplyTimeout
+	orders.ReplyTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { orders.ReplyTimeout = timeout })
+
+	s := compose(t, 1000, map[string]int{"book": 5})
+
+	s.stop("payment")
+	got, err := s.place(book("order-1", 1, "4242"))
+	expectOrder(t, got, err, orders.Cancelled, "waiting for the reply to order-1.charge-payment")
+	expectStock(t, s, "book", 5)
+
+	s.start("payment")
+	got, err = s.place(book("order-2", 1, "4242"))
+	expectOrder(t, got, err, orders.Confirmed, "")
+	expectStock(t, s, "book", 4)
+	if n := s.bank.payments.Load(); n != 1 {
+		t.Fatalf("the bank charged %d cards, want 1", n)
+	}
+}
+
+// TestConcurrentOrders places more orders at once than there is stock for,
+// over a broker that redelivers. Exactly as many orders as there are books
+// may be confirmed.
+func TestConcurrentOrders(t *testing.T) {
+	const books, customers = 10, 25
+	s := compose(t, 3, map[string]int{"book": books})
+
+	var wg sync.WaitGroup
+	results := make([]orders.Order, customers)
+	errs := make([]error, customers)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = s.place(book(fmt.Sprintf("order-%d", i+1), 1, "4242"))
+		}(i)
+	}
+	wg.Wait()
+
+	confirmed := 0
+	for i, order := range results {
+		if errs[i] != nil {
+			t.Fatalf("order-%d: %v", i+1, errs[i])
+		}
+		switch order.Status {
+		case orders.Confirmed:
+			confirmed++
+		case orders.Cancelled:
+			if order.Reason != "book is out of stock" {
+				t.Fatalf("%s was cancelled: %s", order.ID, order.Reason)
+			}
+		default:
+			t.Fatalf("%s is %s", order.ID, order.Status)
+		}
+	}
+	if confirmed != books {
+		t.Fatalf("%d orders confirmed, want %d", confirmed, books)
+	}
+	expectStock(t, s, "book", 0)
+	if n := s.bank.payments.Load(); n != books {
+		t.Fatalf("the bank charged %d cards, want %d", n, books)
+	}
+}
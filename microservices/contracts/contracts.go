@@ -0,0 +1,107 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package contracts holds the topics and payloads the services exchange over
+// the broker. It is the only package the services share; each service owns
+// its data and reaches the others through these messages alone.
+package contracts
+
+// Commands are sent by the order service to the service that handles them.
+const (
+	ReserveStock  = "inventory.reserve"
+	ReleaseStock  = "inventory.release"
+	ChargePayment = "payment.charge"
+	RefundPayment = "payment.refund"
+)
+
+// Every command is answered with a Reply on the replies topic of the service
+// that handled it.
+const (
+	InventoryReplies = "inventory.replies"
+	PaymentReplies   = "payment.replies"
+)
+
+// Events published by the order service for whoever is interested.
+const (
+	OrderPlaced    = "orders.placed"
+	OrderConfirmed = "orders.confirmed"
+	OrderCancelled = "orders.cancelled"
+)
+
+// Every message carries a MessageID that stays the same when the message is
+// delivered again, which is what consumers deduplicate on.
+
+type StockCommand struct {
+	MessageID string `json:"message_id"`
+	OrderID   string `json:"order_id"`
+	Item      string `json:"item"`
+	Quantity  int    `json:"quantity"`
+}
+
+type PaymentCommand struct {
+	MessageID string `json:"message_id"`
+	OrderID   string `json:"order_id"`
+	Amount    int64  `json:"amount"`
+	Card      string `json:"card,omitempty"`
+	// PaymentID is the payment a refund is for.
+	PaymentID string `json:"payment_id,omitempty"`
+}
+
+// Reply answers the command CommandID. A command that was refused is still
+// answered, with OK false and the reason.
+type Reply struct {
+	MessageID string `json:"message_id"`
+	CommandID string `json:"command_id"`
+	OrderID   string `json:"order_id"`
+	OK        bool   `json:"ok"`
+	Reason    string `json:"reason,omitempty"`
+	// Ref is what the command created, such as the ID of a payment.
+	Ref string `json:"ref,omitempty"`
+}
+
+type OrderEvent struct {
+	MessageID string `json:"message_id"`
+	OrderID   string `json:"order_id"`
+	Item      string `json:"item"`
+	Quantity  int    `json:"quantity"`
+	Amount    int64  `json:"amount"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Types tells a bridge which payload type to decode each topic into.
+var Types = map[string]func() interface{}{
+	ReserveStock:     func() interface{} { return new(StockCommand) },
+	ReleaseStock:     func() interface{} { return new(StockCommand) },
+	ChargePayment:    func() interface{} { return new(PaymentCommand) },
+	RefundPayment:    func() interface{} { return new(PaymentCommand) },
+	InventoryReplies: func() interface{} { return new(Reply) },
+	PaymentReplies:   func() interface{} { return new(Reply) },
+	OrderPlaced:      func() interface{} { return new(OrderEvent) },
+	OrderConfirmed:   func() interface{} { return new(OrderEvent) },
+	OrderCancelled:   func() interface{} { return new(OrderEvent) },
+}
@@ -0,0 +1,121 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package inventory is the inventory service. It reserves and releases stock
+// on command and answers every command on contracts.InventoryReplies.
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/idempotency/idempotency"
+	"github.com/rajamummidi/go-design-patterns/microservices/contracts"
+)
+
+type Service struct {
+	bus   *eventbus.EventBus
+	inbox *idempotency.Deduplicator
+
+	mu    sync.Mutex
+	stock map[string]int
+}
+
+// New starts the service on bus with the given stock levels.
+func New(bus *eventbus.EventBus, stock map[string]int) *Service {
+	s := &Service{bus: bus, inbox: idempotency.New(idempotency.NewMemoryStore(0), 0), stock: make(map[string]int)}
+	for item, n := range stock {
+		s.stock[item] = n
+	}
+	bus.Register(contracts.ReserveStock, eventbus.DefaultPriority, s.handle(s.reserve))
+	bus.Register(contracts.ReleaseStock, eventbus.DefaultPriority, s.handle(s.release))
+	return s
+}
+
+// handle runs a command through the inbox and publishes the reply. A
+// duplicate command gets the reply of the original again, since the reply
+// may be what got lost.
+func (s *Service) handle(fn func(contracts.StockCommand) contracts.Reply) eventbus.EventHandler {
+	return func(event eventbus.Event) error {
+		cmd := *event.Data.(*contracts.StockCommand)
+		result, duplicate, err := s.inbox.Do(event.Context(), cmd.MessageID, func() ([]byte, error) {
+			reply := fn(cmd)
+			reply.MessageID = cmd.MessageID + ".reply"
+			reply.CommandID = cmd.MessageID
+			reply.OrderID = cmd.OrderID
+			return json.Marshal(reply)
+		})
+		if err != nil {
+			return err
+		}
+		if duplicate {
+			fmt.Printf("    inventory: %s seen before, replaying the reply\n", cmd.MessageID)
+		}
+		var reply contracts.Reply
+		if err := json.Unmarshal(result, &reply); err != nil {
+			return err
+		}
+		return s.bus.Dispatch(contracts.InventoryReplies, reply)
+	}
+}
+
+func (s *Service) reserve(cmd contracts.StockCommand) contracts.Reply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stock[cmd.Item] < cmd.Quantity {
+		fmt.Printf("    inventory: cannot reserve %d %s for %s, %d left\n", cmd.Quantity, cmd.Item, cmd.OrderID, s.stock[cmd.Item])
+		return contracts.Reply{Reason: fmt.Sprintf("%s is out of stock", cmd.Item)}
+	}
+	s.stock[cmd.Item] -= cmd.Quantity
+	fmt.Printf("    inventory: reserved %d %s for %s, %d left\n", cmd.Quantity, cmd.Item, cmd.OrderID, s.stock[cmd.Item])
+	return contracts.Reply{OK: true}
+}
+
+func (s *Service) release(cmd contracts.StockCommand) contracts.Reply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stock[cmd.Item] += cmd.Quantity
+	fmt.Printf("    inventory: released %d %s for %s, %d left\n", cmd.Quantity, cmd.Item, cmd.OrderID, s.stock[cmd.Item])
+	return contracts.Reply{OK: true}
+}
+
+// Stock returns the stock level of item.
+func (s *Service) Stock(item string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stock[item]
+}
+
+// Duplicates returns how many duplicate commands the service ignored.
+func (s *Service) Duplicates() uint64 {
+	return s.inbox.Stats().Duplicates
+}
@@ -0,0 +1,280 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package orders is the order service. Placing an order runs a saga that
+// reserves stock with the inventory service and charges the customer with
+// the payment service, undoing the reservation when the payment fails.
+//
+// The service sends nothing directly: every command and event goes into the
+// outbox in the same transaction as the change to the order, and the relay
+// publishes it from there.
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/microservices/contracts"
+	"github.com/rajamummidi/go-design-patterns/outbox/outbox"
+	"github.com/rajamummidi/go-design-patterns/saga/saga"
+)
+
+// ErrNotFound is returned for an order the service does not know.
+var ErrNotFound = errors.New("order not found")
+
+// ReplyTimeout is how long a step of the saga waits for the other service
+// to answer its command.
+var ReplyTimeout = 2 * time.Second
+
+type Status string
+
+const (
+	Pending   Status = "pending"
+	Confirmed Status = "confirmed"
+	Cancelled Status = "cancelled"
+)
+
+type Order struct {
+	ID        string
+	Item      string
+	Quantity  int
+	Amount    int64
+	Card      string
+	Status    Status
+	PaymentID string
+	Reason    string
+}
+
+type Service struct {
+	db           *store
+	orchestrator *saga.Orchestrator[Order]
+
+	waitMu  sync.Mutex
+	waiters map[string]chan contracts.Reply
+}
+
+// New starts the service on bus. Its outbox must be relayed to bus for the
+// service to make progress; see Outbox.
+func New(bus *eventbus.EventBus) *Service {
+	s := &Service{
+		db:      &store{orders: make(map[string]Order)},
+		waiters: make(map[string]chan contracts.Reply),
+	}
+	s.orchestrator = saga.NewOrchestrator(s.placeOrder(), saga.NewMemoryLog())
+	bus.Register(contracts.InventoryReplies, eventbus.DefaultPriority, s.receive)
+	bus.Register(contracts.PaymentReplies, eventbus.DefaultPriority, s.receive)
+	return s
+}
+
+// Outbox returns the service's outbox, for a relay to publish.
+func (s *Service) Outbox() outbox.Store {
+	return s.db
+}
+
+// Place stores the order and runs the saga for it. The order returned is
+// confirmed, or cancelled with the reason.
+func (s *Service) Place(ctx context.Context, order Order) (Order, error) {
+	order.Status = Pending
+	err := s.db.update(func(orders map[string]Order, out *outbox.Table) error {
+		if _, ok := orders[order.ID]; ok {
+			return fmt.Errorf("order %s already exists", order.ID)
+		}
+		orders[order.ID] = order
+		out.Add(event(order, contracts.OrderPlaced, "placed"))
+		return nil
+	})
+	if err != nil {
+		return Order{}, err
+	}
+
+	result, err := s.orchestrator.Run(ctx, order.ID, order)
+	var sagaErr *saga.Error
+	switch {
+	case err == nil:
+		return s.Get(order.ID)
+	case errors.As(err, &sagaErr):
+		// The steps that completed have been undone; all that is left is
+		// to record why the order did not go through.
+		result.Reason = sagaErr.Err.Error()
+		if err := s.finish(result, Cancelled, contracts.OrderCancelled); err != nil {
+			return Order{}, err
+		}
+		return s.Get(order.ID)
+	default:
+		return Order{}, err
+	}
+}
+
+func (s *Service) Get(id string) (Order, error) {
+	return s.db.get(id)
+}
+
+func (s *Service) placeOrder() saga.Saga[Order] {
+	return saga.Saga[Order]{
+		Name: "place-order",
+		Steps: []saga.Step[Order]{
+			{
+				Name: "reserve-stock",
+				Action: func(ctx context.Context, o *Order) error {
+					_, err := s.send(ctx, stockCommand(*o, contracts.ReserveStock, "reserve-stock"))
+					return err
+				},
+				Compensate: func(ctx context.Context, o *Order) error {
+					_, err := s.send(ctx, stockCommand(*o, contracts.ReleaseStock, "release-stock"))
+					return err
+				},
+			},
+			{
+				Name: "charge-payment",
+				Action: func(ctx context.Context, o *Order) error {
+					reply, err := s.send(ctx, paymentCommand(*o, contracts.ChargePayment, "charge-payment"))
+					if err == nil {
+						o.PaymentID = reply.Ref
+					}
+					return err
+				},
+				Compensate: func(ctx context.Context, o *Order) error {
+					_, err := s.send(ctx, paymentCommand(*o, contracts.RefundPayment, "refund-payment"))
+					return err
+				},
+			},
+			{
+				// Nothing runs after confirming that could fail, so it
+				// needs no compensation.
+				Name: "confirm",
+				Action: func(ctx context.Context, o *Order) error {
+					return s.finish(*o, Confirmed, contracts.OrderConfirmed)
+				},
+			},
+		},
+	}
+}
+
+// finish stores the final state of order together with the event that
+// announces it.
+func (s *Service) finish(order Order, status Status, topic string) error {
+	return s.db.update(func(orders map[string]Order, out *outbox.Table) error {
+		order.Status = status
+		orders[order.ID] = order
+		out.Add(event(order, topic, string(status)))
+		return nil
+	})
+}
+
+// The ID of a message is derived from the order and what the message is
+// for, so a retried compensation sends the same command again and the other
+// service recognizes it.
+
+func stockCommand(order Order, topic, step string) outbox.Message {
+	id := order.ID + "." + step
+	return outbox.Message{ID: id, Topic: topic, Data: contracts.StockCommand{
+		MessageID: id,
+		OrderID:   order.ID,
+		Item:      order.Item,
+		Quantity:  order.Quantity,
+	}}
+}
+
+func paymentCommand(order Order, topic, step string) outbox.Message {
+	id := order.ID + "." + step
+	return outbox.Message{ID: id, Topic: topic, Data: contracts.PaymentCommand{
+		MessageID: id,
+		OrderID:   order.ID,
+		Amount:    order.Amount,
+		Card:      order.Card,
+		PaymentID: order.PaymentID,
+	}}
+}
+
+func event(order Order, topic, suffix string) outbox.Message {
+	id := order.ID + "." + suffix
+	return outbox.Message{ID: id, Topic: topic, Data: contracts.OrderEvent{
+		MessageID: id,
+		OrderID:   order.ID,
+		Item:      order.Item,
+		Quantity:  order.Quantity,
+		Amount:    order.Amount,
+		Reason:    order.Reason,
+	}}
+}
+
+// send puts a command into the outbox and waits for its reply. A command
+// that was refused is returned as an error.
+func (s *Service) send(ctx context.Context, cmd outbox.Message) (contracts.Reply, error) {
+	ctx, cancel := context.WithTimeout(ctx, ReplyTimeout)
+	defer cancel()
+
+	replies := make(chan contracts.Reply, 1)
+	s.waitMu.Lock()
+	s.waiters[cmd.ID] = replies
+	s.waitMu.Unlock()
+	defer func() {
+		s.waitMu.Lock()
+		delete(s.waiters, cmd.ID)
+		s.waitMu.Unlock()
+	}()
+
+	if err := s.db.update(func(_ map[string]Order, out *outbox.Table) error {
+		out.Add(cmd)
+		return nil
+	}); err != nil {
+		return contracts.Reply{}, err
+	}
+
+	select {
+	case reply := <-replies:
+		if !reply.OK {
+			return reply, errors.New(reply.Reason)
+		}
+		return reply, nil
+	case <-ctx.Done():
+		return contracts.Reply{}, fmt.Errorf("waiting for the reply to %s: %w", cmd.ID, ctx.Err())
+	}
+}
+
+// receive hands a reply to the step waiting for it. A reply nobody waits
+// for is a duplicate of one that was already handled.
+func (s *Service) receive(e eventbus.Event) error {
+	reply := *e.Data.(*contracts.Reply)
+
+	s.waitMu.Lock()
+	replies, ok := s.waiters[reply.CommandID]
+	delete(s.waiters, reply.CommandID)
+	s.waitMu.Unlock()
+
+	if !ok {
+		fmt.Printf("    orders: nobody waits for %s, dropping it\n", reply.MessageID)
+		return nil
+	}
+	replies <- reply
+	return nil
+}
@@ -0,0 +1,90 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package orders
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rajamummidi/go-design-patterns/outbox/outbox"
+)
+
+// store is the service's database: the orders table and the outbox. update
+// changes both under one lock, standing in for a database transaction.
+type store struct {
+	mu     sync.Mutex
+	orders map[string]Order
+	outbox outbox.Table
+}
+
+// update runs fn as a transaction. If fn fails, neither the orders nor the
+// outbox change.
+func (s *store) update(fn func(orders map[string]Order, out *outbox.Table) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orders := make(map[string]Order, len(s.orders))
+	for id, order := range s.orders {
+		orders[id] = order
+	}
+	var staged outbox.Table
+	if err := fn(orders, &staged); err != nil {
+		return err
+	}
+
+	s.orders = orders
+	for _, msg := range staged.Pending(staged.Len()) {
+		s.outbox.Add(msg)
+	}
+	return nil
+}
+
+func (s *store) get(id string) (Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, ok := s.orders[id]
+	if !ok {
+		return Order{}, ErrNotFound
+	}
+	return order, nil
+}
+
+func (s *store) Pending(ctx context.Context, limit int) ([]outbox.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.outbox.Pending(limit), nil
+}
+
+func (s *store) MarkSent(ctx context.Context, ids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outbox.MarkSent(ids...)
+	return nil
+}
@@ -0,0 +1,141 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package payment is the payment service. It charges cards through a bank
+// guarded by a circuit breaker, refunds payments on command, and answers
+// every command on contracts.PaymentReplies.
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/circuit-breaker/circuitbreaker"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/idempotency/idempotency"
+	"github.com/rajamummidi/go-design-patterns/microservices/contracts"
+)
+
+// ErrDeclined is returned by a Bank that refuses a charge. It is an answer,
+// not a failure of the bank, so it does not count against the breaker.
+var ErrDeclined = errors.New("card declined")
+
+// Bank charges a card and returns the ID of the payment.
+type Bank func(ctx context.Context, card string, amount int64) (string, error)
+
+// BreakerConfig is the breaker configuration the service uses for the bank
+// unless it is given another one.
+var BreakerConfig = circuitbreaker.Config{
+	MinRequests:  2,
+	FailureRatio: 0.5,
+	OpenTimeout:  time.Second,
+	Timeout:      100 * time.Millisecond,
+	IsFailure: func(err error) bool {
+		return err != nil && !errors.Is(err, ErrDeclined)
+	},
+}
+
+type Service struct {
+	bus     *eventbus.EventBus
+	bank    Bank
+	breaker *circuitbreaker.Breaker
+	inbox   *idempotency.Deduplicator
+
+	mu       sync.Mutex
+	refunded map[string]bool
+}
+
+// New starts the service on bus. Calls to bank go through breaker.
+func New(bus *eventbus.EventBus, bank Bank, breaker *circuitbreaker.Breaker) *Service {
+	s := &Service{bus: bus, bank: bank, breaker: breaker, inbox: idempotency.New(idempotency.NewMemoryStore(0), 0), refunded: make(map[string]bool)}
+	bus.Register(contracts.ChargePayment, eventbus.DefaultPriority, s.handle(s.charge))
+	bus.Register(contracts.RefundPayment, eventbus.DefaultPriority, s.handle(s.refund))
+	return s
+}
+
+// handle runs a command through the inbox and publishes the reply. A
+// duplicate command gets the reply of the original again, so a card is
+// never charged twice for one command.
+func (s *Service) handle(fn func(contracts.PaymentCommand) contracts.Reply) eventbus.EventHandler {
+	return func(event eventbus.Event) error {
+		cmd := *event.Data.(*contracts.PaymentCommand)
+		result, duplicate, err := s.inbox.Do(event.Context(), cmd.MessageID, func() ([]byte, error) {
+			reply := fn(cmd)
+			reply.MessageID = cmd.MessageID + ".reply"
+			reply.CommandID = cmd.MessageID
+			reply.OrderID = cmd.OrderID
+			return json.Marshal(reply)
+		})
+		if err != nil {
+			return err
+		}
+		if duplicate {
+			fmt.Printf("    payment: %s seen before, replaying the reply\n", cmd.MessageID)
+		}
+		var reply contracts.Reply
+		if err := json.Unmarshal(result, &reply); err != nil {
+			return err
+		}
+		return s.bus.Dispatch(contracts.PaymentReplies, reply)
+	}
+}
+
+func (s *Service) charge(cmd contracts.PaymentCommand) contracts.Reply {
+	var id string
+	err := s.breaker.Execute(context.Background(), func() error {
+		var err error
+		id, err = s.bank(context.Background(), cmd.Card, cmd.Amount)
+		return err
+	})
+	if err != nil {
+		fmt.Printf("    payment: charging %d for %s failed: %v\n", cmd.Amount, cmd.OrderID, err)
+		return contracts.Reply{Reason: err.Error()}
+	}
+	fmt.Printf("    payment: charged %d for %s as %s\n", cmd.Amount, cmd.OrderID, id)
+	return contracts.Reply{OK: true, Ref: id}
+}
+
+func (s *Service) refund(cmd contracts.PaymentCommand) contracts.Reply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.refunded[cmd.PaymentID] {
+		s.refunded[cmd.PaymentID] = true
+		fmt.Printf("    payment: refunded %s for %s\n", cmd.PaymentID, cmd.OrderID)
+	}
+	return contracts.Reply{OK: true}
+}
+
+// Duplicates returns how many duplicate commands the service ignored.
+func (s *Service) Duplicates() uint64 {
+	return s.inbox.Stats().Duplicates
+}
@@ -0,0 +1,272 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/circuit-breaker/circuitbreaker"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/transport"
+	"github.com/rajamummidi/go-design-patterns/idempotency/idempotency"
+	"github.com/rajamummidi/go-design-patterns/microservices/contracts"
+	"github.com/rajamummidi/go-design-patterns/microservices/inventory"
+	"github.com/rajamummidi/go-design-patterns/microservices/orders"
+	"github.com/rajamummidi/go-design-patterns/microservices/payment"
+	"github.com/rajamummidi/go-design-patterns/outbox/outbox"
+	"github.com/rajamummidi/go-design-patterns/task-queue/taskqueue"
+)
+
+// notificationPriority orders the notifications waiting in the queue: a
+// customer whose order failed hears about it first.
+var notificationPriority = map[string]int{
+	contracts.OrderCancelled: 2,
+	contracts.OrderConfirmed: 1,
+	contracts.OrderPlaced:    0,
+}
+
+// stack runs the services of the example the way docker-compose runs
+// containers: each service has its own bus and a bridge to the shared
+// broker, and can be stopped and started again while the others keep
+// running. A stopped service keeps its data, like a container with a
+// volume, but receives nothing until it is started again.
+type stack struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	broker transport.Transport
+
+	bank             *bank
+	breaker          *circuitbreaker.Breaker
+	orderService     *orders.Service
+	inventoryService *inventory.Service
+	paymentService   *payment.Service
+	notified         *idempotency.Deduplicator
+	notifierJobs     taskqueue.Queue
+	notifier         *taskqueue.Worker
+	relay            *outbox.Relay
+
+	mu       sync.Mutex
+	services map[string]*service
+
+	noticesMu sync.Mutex
+	notices   map[string]int
+}
+
+// service is one container of the stack.
+type service struct {
+	bus    *eventbus.EventBus
+	cfg    transport.BridgeConfig
+	bridge *transport.Bridge
+}
+
+// newStack wires the services of the stack to broker, with the inventory
+// service holding stock and the notifier keeping its jobs in notifications.
+// Nothing is connected until up is called.
+func newStack(ctx context.Context, broker transport.Transport, notifications taskqueue.Queue, stock map[string]int) *stack {
+	s := &stack{
+		broker:       broker,
+		bank:         &bank{},
+		breaker:      circuitbreaker.New("bank", payment.BreakerConfig),
+		notified:     idempotency.New(idempotency.NewMemoryStore(0), 0),
+		notifierJobs: notifications,
+		services:     make(map[string]*service),
+		notices:      make(map[string]int),
+	}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+
+	orderBus := eventbus.NewEventBus()
+	s.orderService = orders.New(orderBus)
+	s.add("orders", orderBus,
+		[]string{contracts.ReserveStock, contracts.ReleaseStock, contracts.ChargePayment, contracts.RefundPayment,
+			contracts.OrderPlaced, contracts.OrderConfirmed, contracts.OrderCancelled},
+		[]string{contracts.InventoryReplies, contracts.PaymentReplies})
+
+	inventoryBus := eventbus.NewEventBus()
+	s.inventoryService = inventory.New(inventoryBus, stock)
+	s.add("inventory", inventoryBus,
+		[]string{contracts.InventoryReplies},
+		[]string{contracts.ReserveStock, contracts.ReleaseStock})
+
+	paymentBus := eventbus.NewEventBus()
+	s.paymentService = payment.New(paymentBus, s.bank.Charge, s.breaker)
+	s.add("payment", paymentBus,
+		[]string{contracts.PaymentReplies},
+		[]string{contracts.ChargePayment, contracts.RefundPayment})
+
+	// A fourth service only listens to what happens to orders, and must not
+	// notify a customer twice. It queues a job for every notification, and
+	// its worker sends them, so a slow or failing mail server holds up
+	// neither the bus nor the other services.
+	notifierBus := eventbus.NewEventBus()
+	notifierBus.Register("orders.*", eventbus.DefaultPriority, func(e eventbus.Event) error {
+		event := e.Data.(*contracts.OrderEvent)
+		_, _, err := s.notified.Do(e.Context(), event.MessageID, func() ([]byte, error) {
+			payload, err := json.Marshal(event)
+			if err != nil {
+				return nil, err
+			}
+			_, err = s.notifierJobs.Enqueue(e.Context(), taskqueue.Job{
+				ID:       event.MessageID,
+				Type:     e.Type,
+				Payload:  payload,
+				Priority: notificationPriority[e.Type],
+			})
+			if errors.Is(err, taskqueue.ErrDuplicate) {
+				err = nil
+			}
+			return nil, err
+		})
+		return err
+	})
+	s.notifier = taskqueue.NewWorker(notifications, "notifier-1")
+	s.notifier.Poll = 5 * time.Millisecond
+	for topic := range notificationPriority {
+		s.notifier.Handle(topic, s.notify)
+	}
+	s.add("notifier", notifierBus, nil,
+		[]string{contracts.OrderPlaced, contracts.OrderConfirmed, contracts.OrderCancelled})
+
+	s.relay = outbox.NewRelay(s.orderService.Outbox(), orderBus, 5*time.Millisecond)
+	return s
+}
+
+// notify sends the notification of a job the notifier queued.
+func (s *stack) notify(ctx context.Context, job taskqueue.Job) error {
+	var event contracts.OrderEvent
+	if err := json.Unmarshal(job.Payload, &event); err != nil {
+		return err
+	}
+	fmt.Printf("    notifier: %s %s %s\n", job.Type, event.OrderID, event.Reason)
+	s.noticesMu.Lock()
+	s.notices[job.Type]++
+	s.noticesMu.Unlock()
+	return nil
+}
+
+// up starts every service, the relay of the order service's outbox and the
+// notifier's worker.
+func (s *stack) up() {
+	for name := range s.services {
+		s.start(name)
+	}
+	go s.relay.Run(s.ctx)
+	go s.notifier.Run(s.ctx)
+}
+
+func (s *stack) add(name string, bus *eventbus.EventBus, outbound, inbound []string) {
+	s.services[name] = &service{bus: bus, cfg: transport.BridgeConfig{
+		Name:     name,
+		Outbound: outbound,
+		Inbound:  inbound,
+		Types:    contracts.Types,
+	}}
+}
+
+// start connects the named service to the broker. Starting a running
+// service does nothing.
+func (s *stack) start(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	svc := s.services[name]
+	if svc.bridge != nil {
+		return
+	}
+	svc.bridge = transport.NewBridge(svc.bus, s.broker, nil, svc.cfg)
+	svc.bridge.Start(s.ctx)
+	// Wait until the bridge is subscribed, so no message published after
+	// start returns is missed.
+	time.Sleep(10 * time.Millisecond)
+}
+
+// stop disconnects the named service from the broker. The messages sent to
+// it while it is stopped are lost, as with a broker that does not keep
+// messages for consumers that are gone.
+func (s *stack) stop(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	svc := s.services[name]
+	if svc.bridge == nil {
+		return
+	}
+	svc.bridge.Stop()
+	svc.bridge = nil
+}
+
+// down stops every service and the relay.
+func (s *stack) down() {
+	for name := range s.services {
+		s.stop(name)
+	}
+	s.cancel()
+}
+
+// place runs order through the saga and waits until its final event has
+// left the outbox and the customer has been notified.
+func (s *stack) place(order orders.Order) (orders.Order, error) {
+	result, err := s.orderService.Place(s.ctx, order)
+	if err != nil {
+		return orders.Order{}, err
+	}
+	if err := s.relay.Flush(s.ctx); err != nil {
+		return result, err
+	}
+	return result, s.waitNotified()
+}
+
+// waitNotified waits until the notifier's queue has no job left to run.
+func (s *stack) waitNotified() error {
+	deadline := time.Now().Add(time.Second)
+	for {
+		stats, err := s.notifierJobs.Stats(s.ctx)
+		if err != nil {
+			return err
+		}
+		if stats.Ready+stats.Delayed+stats.Active == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("notifier still has %d jobs to run", stats.Ready+stats.Delayed+stats.Active)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// notifications returns how many events of topic the notifier handled.
+func (s *stack) notifications(topic string) int {
+	s.noticesMu.Lock()
+	defer s.noticesMu.Unlock()
+	return s.notices[topic]
+}
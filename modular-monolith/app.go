@@ -0,0 +1,71 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"fmt"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/modular-monolith/modules/billing"
+	"github.com/rajamummidi/go-design-patterns/modular-monolith/modules/catalog"
+	"github.com/rajamummidi/go-design-patterns/modular-monolith/modules/orders"
+	"github.com/rajamummidi/go-design-patterns/modular-monolith/modules/shipping"
+)
+
+func main() {
+	// One process, one bus, four modules. Each module only sees the bus
+	// and the APIs it is handed here.
+	bus := eventbus.NewEventBus()
+	catalogModule := catalog.New()
+	var ordersAPI orders.API = orders.New(bus, catalogModule)
+	var billingAPI billing.API = billing.New(bus)
+	shipping.New(bus)
+
+	// Trace the conversation between the modules, ahead of the modules'
+	// own handlers.
+	bus.Register("#", eventbus.DefaultPriority+1, func(event eventbus.Event) error {
+		fmt.Printf("  %-26s %+v\n", event.Type, event.Data)
+		return nil
+	})
+
+	place := func(customer string, items ...orders.Item) {
+		fmt.Printf("%s orders %v\n", customer, items)
+		id, err := ordersAPI.Place(customer, items)
+		if err != nil {
+			fmt.Println("  rejected:", err)
+			return
+		}
+		status, note, _ := ordersAPI.Status(id)
+		fmt.Printf("  => %s is %s %s, balance %d\n\n", id, status, note, billingAPI.Balance(customer))
+	}
+
+	place("alice", orders.Item{ProductID: "kbd", Quantity: 1}, orders.Item{ProductID: "mouse", Quantity: 2})
+	place("bob", orders.Item{ProductID: "screen", Quantity: 1})
+	place("alice", orders.Item{ProductID: "tablet", Quantity: 1})
+}
@@ -0,0 +1,180 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The boundary tests read the same architecture.json as the archcheck tool
+// of the hexagonal-architecture example, so that go test catches a module
+// reaching into another one without depending on that module.
+
+const modulePath = "github.com/rajamummidi/go-design-patterns/modular-monolith"
+
+type layer struct {
+	Name      string   `json:"name"`
+	Packages  []string `json:"packages"`
+	MayImport []string `json:"may_import"`
+}
+
+type rules []layer
+
+func loadRules(t *testing.T) rules {
+	t.Helper()
+	data, err := os.ReadFile("architecture.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		Layers rules `json:"layers"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("architecture.json: %v", err)
+	}
+	return file.Layers
+}
+
+// layerOf returns the layer of the package in dir, relative to the module
+// root.
+func (r rules) layerOf(dir string) (layer, bool) {
+	for _, l := range r {
+		for _, pattern := range l.Packages {
+			if prefix, ok := strings.CutSuffix(pattern, "/..."); ok {
+				if dir == prefix || strings.HasPrefix(dir, prefix+"/") {
+					return l, true
+				}
+			} else if dir == pattern {
+				return l, true
+			}
+		}
+	}
+	return layer{}, false
+}
+
+// classify returns the layer of an import path: "" for the standard
+// library, "external" for other modules and the layer of this module's
+// packages.
+func (r rules) classify(imported string) (string, bool) {
+	if rel, ok := strings.CutPrefix(imported, modulePath); ok && (rel == "" || rel[0] == '/') {
+		dir := strings.TrimPrefix(rel, "/")
+		if dir == "" {
+			dir = "."
+		}
+		l, ok := r.layerOf(dir)
+		return l.Name, ok
+	}
+	if first, _, _ := strings.Cut(imported, "/"); !strings.Contains(first, ".") {
+		return "", true
+	}
+	return "external", true
+}
+
+func (l layer) allows(name string) bool {
+	for _, allowed := range l.MayImport {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// TestModuleBoundaries fails for every import of a package that its layer
+// may not use, and for packages outside every layer.
+func TestModuleBoundaries(t *testing.T) {
+	r := loadRules(t)
+	fset := token.NewFileSet()
+	err := filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return err
+		}
+		dir := filepath.ToSlash(filepath.Dir(path))
+		from, ok := r.layerOf(dir)
+		if !ok {
+			t.Errorf("%s: package %s belongs to no layer", path, dir)
+			return nil
+		}
+		file, err := parser.ParseFile(fset, path, nil, parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+		for _, spec := range file.Imports {
+			imported, _ := strconv.Unquote(spec.Path.Value)
+			to, ok := r.classify(imported)
+			switch {
+			case !ok:
+				t.Errorf("%s: %s belongs to no layer", fset.Position(spec.Pos()), imported)
+			case to != "" && !from.allows(to):
+				t.Errorf("%s: %s (layer %s) must not import %s (layer %s)", fset.Position(spec.Pos()), dir, from.Name, imported, to)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRulesKeepModulesApart guards the rules themselves: the modules that
+// react to orders must only hear about them through the contracts and the
+// bus, and the catalog stays a leaf.
+func TestRulesKeepModulesApart(t *testing.T) {
+	r := loadRules(t)
+	forbidden := []struct{ from, to string }{
+		{"billing", "orders"},
+		{"billing", "shipping"},
+		{"billing", "catalog"},
+		{"shipping", "orders"},
+		{"shipping", "billing"},
+		{"shipping", "catalog"},
+		{"orders", "billing"},
+		{"orders", "shipping"},
+		{"catalog", "orders"},
+		{"catalog", "external"},
+		{"contracts", "external"},
+	}
+	for _, f := range forbidden {
+		from, ok := r.layerOf("modules/" + f.from)
+		if !ok {
+			t.Errorf("no layer for module %s", f.from)
+			continue
+		}
+		if from.allows(f.to) {
+			t.Errorf("architecture.json lets %s import %s", f.from, f.to)
+		}
+	}
+}
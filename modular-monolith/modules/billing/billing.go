@@ -0,0 +1,68 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package billing is the public face of the billing module. It charges
+// customers for placed orders and reports the outcome as events. No other
+// module calls it directly.
+package billing
+
+import (
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/modular-monolith/modules/billing/internal/ledger"
+	"github.com/rajamummidi/go-design-patterns/modular-monolith/modules/contracts"
+)
+
+// API lets the outside world look at balances.
+type API interface {
+	Balance(customer string) int64
+}
+
+type Module struct {
+	bus    *eventbus.EventBus
+	ledger *ledger.Ledger
+}
+
+func New(bus *eventbus.EventBus) *Module {
+	m := &Module{bus: bus, ledger: ledger.New()}
+	m.ledger.Open("alice", 300_00)
+	m.ledger.Open("bob", 20_00)
+	bus.Register(contracts.OrderPlacedTopic, eventbus.DefaultPriority, m.onOrderPlaced)
+	return m
+}
+
+func (m *Module) Balance(customer string) int64 {
+	return m.ledger.Balance(customer)
+}
+
+func (m *Module) onOrderPlaced(event eventbus.Event) error {
+	placed := event.Data.(contracts.OrderPlaced)
+	if err := m.ledger.Debit(placed.Customer, placed.Total); err != nil {
+		return m.bus.Dispatch(contracts.PaymentFailedTopic, contracts.PaymentFailed{OrderID: placed.OrderID, Reason: err.Error()})
+	}
+	return m.bus.Dispatch(contracts.PaymentSucceededTopic, contracts.PaymentSucceeded{OrderID: placed.OrderID, Amount: placed.Total})
+}
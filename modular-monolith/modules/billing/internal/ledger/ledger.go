@@ -0,0 +1,79 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package ledger keeps the billing module's accounts. Only the billing
+// module can import it.
+package ledger
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	ErrNoAccount         = errors.New("no account")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+)
+
+type Ledger struct {
+	mu       sync.Mutex
+	balances map[string]int64
+}
+
+func New() *Ledger {
+	return &Ledger{balances: make(map[string]int64)}
+}
+
+func (l *Ledger) Open(customer string, balance int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.balances[customer] = balance
+}
+
+func (l *Ledger) Balance(customer string) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.balances[customer]
+}
+
+func (l *Ledger) Debit(customer string, amount int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	balance, ok := l.balances[customer]
+	if !ok {
+		return ErrNoAccount
+	}
+	if balance < amount {
+		return ErrInsufficientFunds
+	}
+	l.balances[customer] = balance - amount
+	return nil
+}
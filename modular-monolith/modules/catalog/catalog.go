@@ -0,0 +1,71 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package catalog is the public face of the catalog module: the API other
+// modules may call and nothing else. Its storage lives in internal/, which
+// the Go toolchain refuses to let other modules import.
+package catalog
+
+import (
+	"errors"
+
+	"github.com/rajamummidi/go-design-patterns/modular-monolith/modules/catalog/internal/store"
+)
+
+var ErrUnknownProduct = errors.New("catalog: unknown product")
+
+type Product struct {
+	ID    string
+	Name  string
+	Price int64
+}
+
+// API is what other modules may ask the catalog.
+type API interface {
+	Product(id string) (Product, error)
+}
+
+type Module struct {
+	store *store.Store
+}
+
+func New() *Module {
+	m := &Module{store: store.New()}
+	m.store.Put(store.Row{ID: "kbd", Name: "Keyboard", Price: 49_00})
+	m.store.Put(store.Row{ID: "mouse", Name: "Mouse", Price: 19_00})
+	m.store.Put(store.Row{ID: "screen", Name: "Screen", Price: 199_00})
+	return m
+}
+
+func (m *Module) Product(id string) (Product, error) {
+	row, ok := m.store.Get(id)
+	if !ok {
+		return Product{}, ErrUnknownProduct
+	}
+	return Product{ID: row.ID, Name: row.Name, Price: row.Price}, nil
+}
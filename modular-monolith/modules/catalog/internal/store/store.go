@@ -0,0 +1,63 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package store keeps the catalog's products. Only the catalog module can
+// import it.
+package store
+
+import "sync"
+
+type Row struct {
+	ID    string
+	Name  string
+	Price int64
+}
+
+type Store struct {
+	mu   sync.RWMutex
+	rows map[string]Row
+}
+
+func New() *Store {
+	return &Store{rows: make(map[string]Row)}
+}
+
+func (s *Store) Put(row Row) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rows[row.ID] = row
+}
+
+func (s *Store) Get(id string) (Row, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	row, ok := s.rows[id]
+	return row, ok
+}
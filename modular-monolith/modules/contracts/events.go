@@ -0,0 +1,67 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package contracts is the published language of the monolith: the topics
+// and payloads of the events modules exchange over the bus. Modules depend
+// on it instead of on each other, which keeps their dependency graph free
+// of cycles.
+package contracts
+
+const (
+	OrderPlacedTopic      = "orders.placed"
+	OrderCancelledTopic   = "orders.cancelled"
+	PaymentSucceededTopic = "billing.payment-succeeded"
+	PaymentFailedTopic    = "billing.payment-failed"
+	OrderShippedTopic     = "shipping.shipped"
+)
+
+type OrderPlaced struct {
+	OrderID  string
+	Customer string
+	Total    int64
+}
+
+type OrderCancelled struct {
+	OrderID string
+	Reason  string
+}
+
+type PaymentSucceeded struct {
+	OrderID string
+	Amount  int64
+}
+
+type PaymentFailed struct {
+	OrderID string
+	Reason  string
+}
+
+type OrderShipped struct {
+	OrderID      string
+	TrackingCode string
+}
@@ -0,0 +1,100 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package store keeps the orders module's orders. Only the orders module
+// can import it.
+package store
+
+import (
+	"fmt"
+	"sync"
+)
+
+type Status string
+
+const (
+	Placed    Status = "placed"
+	Paid      Status = "paid"
+	Shipped   Status = "shipped"
+	Cancelled Status = "cancelled"
+)
+
+type Order struct {
+	ID       string
+	Customer string
+	Total    int64
+	Status   Status
+	Note     string
+}
+
+type Store struct {
+	mu     sync.Mutex
+	orders map[string]*Order
+	next   int
+}
+
+func New() *Store {
+	return &Store{orders: make(map[string]*Order)}
+}
+
+// Add stores a new placed order and returns its ID.
+func (s *Store) Add(customer string, total int64) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.next++
+	id := fmt.Sprintf("order-%d", s.next)
+	s.orders[id] = &Order{ID: id, Customer: customer, Total: total, Status: Placed}
+	return id
+}
+
+func (s *Store) Get(id string) (Order, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, ok := s.orders[id]
+	if !ok {
+		return Order{}, false
+	}
+	return *order, true
+}
+
+// stage orders the statuses. Events of other modules may arrive in any
+// order, so a status never moves back to an earlier stage.
+var stage = map[Status]int{Placed: 0, Paid: 1, Shipped: 2, Cancelled: 2}
+
+// Advance moves an order to status, unless it is already past it.
+func (s *Store) Advance(id string, status Status, note string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if order, ok := s.orders[id]; ok && stage[status] > stage[order.Status] {
+		order.Status = status
+		order.Note = note
+	}
+}
@@ -0,0 +1,128 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package orders is the public face of the orders module. It takes orders,
+// prices them through the catalog API and follows them through billing and
+// shipping by listening to their events.
+package orders
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/modular-monolith/modules/catalog"
+	"github.com/rajamummidi/go-design-patterns/modular-monolith/modules/contracts"
+	"github.com/rajamummidi/go-design-patterns/modular-monolith/modules/orders/internal/store"
+)
+
+var (
+	ErrEmptyOrder   = errors.New("orders: order has no items")
+	ErrUnknownOrder = errors.New("orders: unknown order")
+)
+
+type Item struct {
+	ProductID string
+	Quantity  int
+}
+
+type Status = store.Status
+
+const (
+	Placed    = store.Placed
+	Paid      = store.Paid
+	Shipped   = store.Shipped
+	Cancelled = store.Cancelled
+)
+
+// API is what other modules and the outside world may ask of orders.
+type API interface {
+	Place(customer string, items []Item) (string, error)
+	Status(id string) (Status, string, error)
+}
+
+type Module struct {
+	bus     *eventbus.EventBus
+	catalog catalog.API
+	store   *store.Store
+}
+
+// New wires the module to the bus. It only needs the catalog's API, not
+// the catalog module itself.
+func New(bus *eventbus.EventBus, catalog catalog.API) *Module {
+	m := &Module{bus: bus, catalog: catalog, store: store.New()}
+	bus.Register(contracts.PaymentSucceededTopic, eventbus.DefaultPriority, m.onPaymentSucceeded)
+	bus.Register(contracts.PaymentFailedTopic, eventbus.DefaultPriority, m.onPaymentFailed)
+	bus.Register(contracts.OrderShippedTopic, eventbus.DefaultPriority, m.onShipped)
+	return m
+}
+
+func (m *Module) Place(customer string, items []Item) (string, error) {
+	if len(items) == 0 {
+		return "", ErrEmptyOrder
+	}
+	var total int64
+	for _, item := range items {
+		product, err := m.catalog.Product(item.ProductID)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", item.ProductID, err)
+		}
+		total += product.Price * int64(item.Quantity)
+	}
+
+	id := m.store.Add(customer, total)
+	err := m.bus.Dispatch(contracts.OrderPlacedTopic, contracts.OrderPlaced{OrderID: id, Customer: customer, Total: total})
+	return id, err
+}
+
+// Status returns the status of an order and a note on how it got there.
+func (m *Module) Status(id string) (Status, string, error) {
+	order, ok := m.store.Get(id)
+	if !ok {
+		return "", "", ErrUnknownOrder
+	}
+	return order.Status, order.Note, nil
+}
+
+func (m *Module) onPaymentSucceeded(event eventbus.Event) error {
+	paid := event.Data.(contracts.PaymentSucceeded)
+	m.store.Advance(paid.OrderID, store.Paid, "")
+	return nil
+}
+
+func (m *Module) onPaymentFailed(event eventbus.Event) error {
+	failed := event.Data.(contracts.PaymentFailed)
+	m.store.Advance(failed.OrderID, store.Cancelled, failed.Reason)
+	return m.bus.Dispatch(contracts.OrderCancelledTopic, contracts.OrderCancelled{OrderID: failed.OrderID, Reason: failed.Reason})
+}
+
+func (m *Module) onShipped(event eventbus.Event) error {
+	shipped := event.Data.(contracts.OrderShipped)
+	m.store.Advance(shipped.OrderID, store.Shipped, "tracking "+shipped.TrackingCode)
+	return nil
+}
@@ -0,0 +1,57 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package shipping is the shipping module. It ships paid orders. It is
+// small enough to need no internal packages, and it offers no API: other
+// modules only hear from it through its events.
+package shipping
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/modular-monolith/modules/contracts"
+)
+
+type Module struct {
+	bus      *eventbus.EventBus
+	shipment atomic.Int64
+}
+
+func New(bus *eventbus.EventBus) *Module {
+	m := &Module{bus: bus}
+	bus.Register(contracts.PaymentSucceededTopic, eventbus.DefaultPriority, m.onPaid)
+	return m
+}
+
+func (m *Module) onPaid(event eventbus.Event) error {
+	paid := event.Data.(contracts.PaymentSucceeded)
+	code := fmt.Sprintf("TRK-%04d", m.shipment.Add(1))
+	return m.bus.Dispatch(contracts.OrderShippedTopic, contracts.OrderShipped{OrderID: paid.OrderID, TrackingCode: code})
+}
@@ -0,0 +1,130 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/object-pool/objectpool"
+)
+
+// drain reads and throws away whatever the chat server sent on conn since
+// it was last used, so the next user starts clean. A connection the server
+// has closed fails here and is discarded by the pool.
+func drain(conn net.Conn) error {
+	buf := make([]byte, 4096)
+	for {
+		conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+		_, err := conn.Read(buf)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return conn.SetReadDeadline(time.Time{})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:8000", "address of the chat server")
+	messages := flag.Int("messages", 8, "how many announcements to send")
+	flag.Parse()
+
+	dialer := net.Dialer{Timeout: time.Second}
+	pool := objectpool.New(objectpool.Config[net.Conn]{
+		New: func(ctx context.Context) (net.Conn, error) {
+			fmt.Println("dialing", *addr)
+			return dialer.DialContext(ctx, "tcp", *addr)
+		},
+		Reset:       drain,
+		Close:       func(conn net.Conn) error { return conn.Close() },
+		MaxOpen:     3,
+		MaxIdle:     2,
+		MaxLifetime: time.Minute,
+	})
+	defer pool.Close()
+
+	// The first connection doubles as a check that the server is up.
+	conn, err := pool.Get(context.Background())
+	if err != nil {
+		fmt.Printf("Error connecting: %v\nStart the chat server first: cd ../event-driven-architecture && go run .\n", err)
+		os.Exit(1)
+	}
+	pool.Put(conn)
+
+	// Each announcement borrows a connection, writes one line of the plain
+	// text protocol and gives it back, so eight announcements from four
+	// goroutines need no more than three connections.
+	var wg sync.WaitGroup
+	work := make(chan int)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range work {
+				if err := announce(pool, n); err != nil {
+					fmt.Printf("announcement %d: %v\n", n, err)
+				}
+			}
+		}()
+	}
+	for n := 1; n <= *messages; n++ {
+		work <- n
+	}
+	close(work)
+	wg.Wait()
+
+	fmt.Printf("%+v\n", pool.Stats())
+}
+
+func announce(pool *objectpool.Pool[net.Conn], n int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	conn, err := pool.Get(ctx)
+	if err != nil {
+		return err
+	}
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	if _, err := fmt.Fprintf(conn, "announcement %d\n", n); err != nil {
+		pool.Discard(conn)
+		return err
+	}
+	time.Sleep(20 * time.Millisecond) // the time the connection is busy
+	pool.Put(conn)
+	return nil
+}
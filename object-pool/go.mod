@@ -0,0 +1,3 @@
+module github.com/rajamummidi/go-design-patterns/object-pool
+
+go 1.20
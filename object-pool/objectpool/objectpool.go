@@ -0,0 +1,246 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package objectpool implements the object pool pattern. A Pool keeps
+// objects that are expensive to create, such as network connections, for
+// reuse: Get hands out an idle object or creates one, and Put returns it
+// for the next caller.
+package objectpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by Get once the pool has been closed.
+var ErrClosed = errors.New("objectpool: pool is closed")
+
+// DefaultMaxIdle is the number of idle objects a pool keeps unless
+// configured otherwise.
+const DefaultMaxIdle = 2
+
+// Config configures a Pool.
+type Config[T comparable] struct {
+	// New creates an object. It is required.
+	New func(ctx context.Context) (T, error)
+	// Reset, if set, prepares an object returned with Put for its next
+	// user. An object it fails on is discarded.
+	Reset func(T) error
+	// Close, if set, releases an object the pool discards.
+	Close func(T) error
+
+	// MaxIdle is how many objects are kept for reuse (DefaultMaxIdle by
+	// default, negative to keep none). Objects returned beyond it are
+	// discarded.
+	MaxIdle int
+	// MaxOpen limits the objects in existence, idle or in use. Get waits
+	// for one to be returned once the limit is reached. Zero means no
+	// limit.
+	MaxOpen int
+	// MaxLifetime is how long an object is used before it is replaced,
+	// counted from its creation. Zero means forever.
+	MaxLifetime time.Duration
+}
+
+// Stats counts the objects of a pool.
+type Stats struct {
+	Open      int    // idle or in use
+	Idle      int    // waiting in the pool
+	Created   uint64 // by New
+	Reused    uint64 // Gets served from the pool
+	Discarded uint64 // closed by the pool
+	Waits     uint64 // Gets that waited for MaxOpen
+}
+
+// Pool is a pool of objects of type T. It is safe for concurrent use.
+type Pool[T comparable] struct {
+	cfg   Config[T]
+	slots chan struct{} // one per open object when MaxOpen is set
+
+	mu      sync.Mutex
+	idle    []T             // most recently returned last
+	created map[T]time.Time // of every open object
+	closed  bool
+	stats   Stats
+}
+
+func New[T comparable](cfg Config[T]) *Pool[T] {
+	if cfg.MaxIdle == 0 {
+		cfg.MaxIdle = DefaultMaxIdle
+	}
+	p := &Pool[T]{cfg: cfg, created: make(map[T]time.Time)}
+	if cfg.MaxOpen > 0 {
+		p.slots = make(chan struct{}, cfg.MaxOpen)
+	}
+	return p
+}
+
+// Get returns an idle object, most recently used first, or creates a new
+// one. If MaxOpen objects are in use, it waits until one is returned or
+// ctx is done. The object must be given back with Put or Discard.
+func (p *Pool[T]) Get(ctx context.Context) (T, error) {
+	var zero T
+	if err := p.acquire(ctx); err != nil {
+		return zero, err
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		p.release()
+		return zero, ErrClosed
+	}
+	for len(p.idle) > 0 {
+		v := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if p.expired(v) {
+			p.discard(v)
+			continue
+		}
+		p.stats.Reused++
+		p.mu.Unlock()
+		return v, nil
+	}
+	p.mu.Unlock()
+
+	v, err := p.cfg.New(ctx)
+	if err != nil {
+		p.release()
+		return zero, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.created[v] = time.Now()
+	p.stats.Created++
+	return v, nil
+}
+
+// acquire takes a slot for an open object if MaxOpen is set.
+func (p *Pool[T]) acquire(ctx context.Context) error {
+	if p.slots == nil {
+		return nil
+	}
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	p.mu.Lock()
+	p.stats.Waits++
+	p.mu.Unlock()
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pool[T]) release() {
+	if p.slots != nil {
+		<-p.slots
+	}
+}
+
+// Put returns an object obtained from Get to the pool. It is reset and kept
+// for reuse, unless it is past its lifetime, the pool has MaxIdle objects
+// already or the pool is closed. Objects the pool did not create are
+// ignored.
+func (p *Pool[T]) Put(v T) {
+	if p.cfg.Reset != nil && p.cfg.Reset(v) != nil {
+		p.Discard(v)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.created[v]; !ok {
+		return
+	}
+	defer p.release()
+	if p.closed || len(p.idle) >= p.cfg.MaxIdle || p.expired(v) {
+		p.discard(v)
+		return
+	}
+	p.idle = append(p.idle, v)
+}
+
+// Discard closes an object obtained from Get instead of returning it,
+// typically because it broke while in use.
+func (p *Pool[T]) Discard(v T) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.created[v]; ok {
+		p.discard(v)
+		p.release()
+	}
+}
+
+// expired reports whether v is past MaxLifetime. p.mu must be held.
+func (p *Pool[T]) expired(v T) bool {
+	return p.cfg.MaxLifetime > 0 && time.Since(p.created[v]) > p.cfg.MaxLifetime
+}
+
+// discard closes v and forgets it. p.mu must be held.
+func (p *Pool[T]) discard(v T) {
+	delete(p.created, v)
+	p.stats.Discarded++
+	if p.cfg.Close != nil {
+		p.cfg.Close(v)
+	}
+}
+
+// Close closes the idle objects and makes Get fail. Objects in use are
+// closed when they are returned.
+func (p *Pool[T]) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for _, v := range p.idle {
+		p.discard(v)
+	}
+	p.idle = nil
+}
+
+// Stats returns the counters of the pool.
+func (p *Pool[T]) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	stats.Open = len(p.created)
+	stats.Idle = len(p.idle)
+	return stats
+}
@@ -0,0 +1,115 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/observability/observability"
+)
+
+func main() {
+	logger := observability.NewLogger(observability.LogConfig{Service: "demo"})
+
+	// Spans are logged rather than sent to a collector, which shows the
+	// trace without running one.
+	tracer := observability.NewTracer(observability.TracerConfig{
+		Exporter: observability.LogExporter(logger.With("exporter", "spans")),
+		Interval: 100 * time.Millisecond,
+	})
+
+	// The inventory service fails for one item. Its logs carry the trace of
+	// the request that caused them.
+	inventory := httptest.NewServer(observability.Middleware(tracer)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		item := r.URL.Query().Get("item")
+		observability.SpanFromContext(r.Context()).SetAttributes(slog.String("item", item))
+		if item == "anvil" {
+			logger.ErrorContext(r.Context(), "inventory lookup failed", "item", item)
+			http.Error(w, "database unavailable", http.StatusInternalServerError)
+			return
+		}
+		logger.InfoContext(r.Context(), "inventory lookup", "item", item)
+		fmt.Fprintln(w, "3 in stock")
+	})))
+	defer inventory.Close()
+
+	// The shop calls it through a traced client, so that both services'
+	// spans belong to one trace.
+	client := &http.Client{Transport: observability.Transport(tracer)(http.DefaultTransport)}
+	shop := httptest.NewServer(observability.Middleware(tracer)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, inventory.URL+"/stock?"+r.URL.RawQuery, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	})))
+	defer shop.Close()
+
+	for _, item := range []string{"hammer", "anvil"} {
+		fmt.Printf("GET /order?item=%s\n", item)
+		resp, err := http.Get(shop.URL + "/order?item=" + item)
+		if err != nil {
+			panic(err)
+		}
+		resp.Body.Close()
+		// Wait for the spans, which are exported in the background.
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	// A caller that is traced already passes its span in a traceparent
+	// header, and the shop's spans join its trace.
+	sc, _ := observability.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := observability.ContextWithSpanContext(context.Background(), sc)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, shop.URL+"/order?item=nails", nil)
+	observability.Inject(ctx, observability.HeaderCarrier(req.Header))
+	fmt.Printf("GET /order?item=nails with %s: %s\n", observability.TraceParentHeader, req.Header.Get(observability.TraceParentHeader))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		panic(err)
+	}
+	resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := tracer.Shutdown(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	fmt.Printf("tracer stats: %+v\n", tracer.Stats())
+}
@@ -0,0 +1,98 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package observability
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/rajamummidi/go-design-patterns/otlp/otlp"
+)
+
+// ExporterFunc adapts a function to a SpanExporter.
+type ExporterFunc func(ctx context.Context, spans []SpanData) error
+
+func (f ExporterFunc) ExportSpans(ctx context.Context, spans []SpanData) error {
+	return f(ctx, spans)
+}
+
+// LogExporter returns an exporter that logs every span at info level, or at
+// error level if it failed. It is enough to follow traces in a demo
+// without running a collector.
+func LogExporter(logger *slog.Logger) SpanExporter {
+	return ExporterFunc(func(ctx context.Context, spans []SpanData) error {
+		for _, s := range spans {
+			level, attrs := slog.LevelInfo, []slog.Attr{
+				slog.String("kind", s.Kind.String()),
+				slog.String("trace_id", s.TraceID.String()),
+				slog.String("span_id", s.SpanID.String()),
+			}
+			if s.Parent.IsValid() {
+				attrs = append(attrs, slog.String("parent_id", s.Parent.String()))
+			}
+			attrs = append(attrs, slog.Duration("duration", s.End.Sub(s.Start)))
+			attrs = append(attrs, s.Attributes...)
+			if s.Error != "" {
+				level = slog.LevelError
+				attrs = append(attrs, slog.String("error", s.Error))
+			}
+			logger.LogAttrs(ctx, level, "span "+s.Name, attrs...)
+		}
+		return nil
+	})
+}
+
+// OTLPExporter returns an exporter that sends spans to an OpenTelemetry
+// collector through e, under the instrumentation scope name.
+func OTLPExporter(e *otlp.Exporter, scope string) SpanExporter {
+	return ExporterFunc(func(ctx context.Context, spans []SpanData) error {
+		out := make([]otlp.Span, len(spans))
+		for i, s := range spans {
+			attrs := make(map[string]string, len(s.Attributes))
+			for _, a := range s.Attributes {
+				attrs[a.Key] = a.Value.String()
+			}
+			out[i] = otlp.Span{
+				Scope:      scope,
+				TraceID:    s.TraceID.String(),
+				SpanID:     s.SpanID.String(),
+				Name:       s.Name,
+				Kind:       otlp.SpanKind(s.Kind),
+				Start:      s.Start,
+				End:        s.End,
+				Attributes: attrs,
+				Error:      s.Error,
+			}
+			if s.Parent.IsValid() {
+				out[i].ParentSpanID = s.Parent.String()
+			}
+		}
+		return e.ExportSpans(ctx, out)
+	})
+}
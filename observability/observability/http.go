@@ -0,0 +1,146 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package observability
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Middleware returns HTTP middleware that traces every request in a server
+// span, continuing the trace of the caller's traceparent header. Handlers
+// find the span with SpanFromContext(r.Context()) to add attributes of
+// their own. A response status of 500 or more marks the span as failed.
+func Middleware(t *Tracer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := Extract(r.Context(), HeaderCarrier(r.Header))
+			ctx, span := t.Start(ctx, r.Method+" "+r.URL.Path, Server,
+				slog.String("http.request.method", r.Method),
+				slog.String("url.path", r.URL.Path),
+			)
+			defer span.End()
+
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r.WithContext(ctx))
+			span.SetAttributes(slog.Int("http.response.status_code", rec.status))
+			if rec.status >= http.StatusInternalServerError {
+				span.RecordError(fmt.Errorf("%d %s", rec.status, http.StatusText(rec.status)))
+			}
+		})
+	}
+}
+
+// Logging returns HTTP middleware that logs every request with its status,
+// size and duration, like decorator.Logging, but to a structured logger and
+// with the request's context. Behind Middleware, the records carry the
+// request's trace.
+func Logging(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			logger.InfoContext(r.Context(), "request",
+				"method", r.Method,
+				"uri", r.URL.RequestURI(),
+				"status", rec.status,
+				"bytes", rec.bytes,
+				"duration", time.Since(start).Round(time.Microsecond),
+			)
+		})
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+// Transport returns a round tripper decorator, in the shape of
+// decorator.Tripperware, that traces every request in a client span and
+// passes the span on in a traceparent header, so that the server's spans
+// join the caller's trace.
+func Transport(t *Tracer) func(http.RoundTripper) http.RoundTripper {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			ctx, span := t.Start(r.Context(), r.Method, Client,
+				slog.String("http.request.method", r.Method),
+				slog.String("url.full", r.URL.String()),
+			)
+			defer span.End()
+
+			r = r.Clone(ctx)
+			Inject(ctx, HeaderCarrier(r.Header))
+			resp, err := next.RoundTrip(r)
+			if err != nil {
+				span.RecordError(err)
+				return nil, err
+			}
+			span.SetAttributes(slog.Int("http.response.status_code", resp.StatusCode))
+			if resp.StatusCode >= http.StatusInternalServerError {
+				span.RecordError(fmt.Errorf("%s", resp.Status))
+			}
+			return resp, nil
+		})
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
@@ -0,0 +1,106 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package observability gives the examples structured logs and traces. Its
+// logger is a log/slog logger whose records carry the trace and span ID of
+// the context they are logged with. Its tracer starts spans, propagates them
+// between processes in W3C traceparent headers, the format OpenTelemetry
+// uses by default, and exports them in batches, for example to a collector
+// through the otlp module. HTTP middleware and a transport trace requests
+// on both ends, and StartEvent traces the events of a bus.
+package observability
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// LogConfig configures a logger. Zero fields take the defaults given below.
+type LogConfig struct {
+	// Service is added to every record as "service".
+	Service string
+	// Format is "text" (the default) or "json". JSON suits log
+	// collectors, text suits people.
+	Format string
+	// Level is the lowest level logged (slog.LevelInfo).
+	Level slog.Leveler
+	// Writer receives the log (os.Stdout).
+	Writer io.Writer
+}
+
+// NewLogger returns a logger configured by cfg.
+func NewLogger(cfg LogConfig) *slog.Logger {
+	return slog.New(NewHandler(cfg))
+}
+
+// NewHandler returns the handler of NewLogger, for code that puts handlers
+// of its own in front of it.
+func NewHandler(cfg LogConfig) slog.Handler {
+	if cfg.Writer == nil {
+		cfg.Writer = os.Stdout
+	}
+	opts := &slog.HandlerOptions{Level: cfg.Level}
+	var h slog.Handler
+	if cfg.Format == "json" {
+		h = slog.NewJSONHandler(cfg.Writer, opts)
+	} else {
+		h = slog.NewTextHandler(cfg.Writer, opts)
+	}
+	if cfg.Service != "" {
+		h = h.WithAttrs([]slog.Attr{slog.String("service", cfg.Service)})
+	}
+	return TraceHandler(h)
+}
+
+// TraceHandler returns a handler that adds the trace_id and span_id of the
+// span in a record's context to the record before passing it to next. Only
+// records logged with a context, such as with InfoContext, have one.
+func TraceHandler(next slog.Handler) slog.Handler {
+	return traceHandler{next}
+}
+
+type traceHandler struct {
+	slog.Handler
+}
+
+func (h traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID.String()), slog.String("span_id", sc.SpanID.String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return traceHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h traceHandler) WithGroup(name string) slog.Handler {
+	return traceHandler{h.Handler.WithGroup(name)}
+}
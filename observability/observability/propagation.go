@@ -0,0 +1,119 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package observability
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TraceParentHeader is the W3C header that carries a span context from one
+// process to the next.
+const TraceParentHeader = "traceparent"
+
+// Carrier is where a span context is written to and read from, such as the
+// headers of a request or the metadata of a message.
+type Carrier interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+// HeaderCarrier carries a span context in HTTP headers.
+type HeaderCarrier http.Header
+
+func (c HeaderCarrier) Get(key string) string { return http.Header(c).Get(key) }
+func (c HeaderCarrier) Set(key, value string) { http.Header(c).Set(key, value) }
+
+// MapCarrier carries a span context in a map, such as message metadata.
+type MapCarrier map[string]string
+
+func (c MapCarrier) Get(key string) string { return c[key] }
+func (c MapCarrier) Set(key, value string) { c[key] = value }
+
+// Inject writes the span context of ctx to c, if it has a valid one.
+func Inject(ctx context.Context, c Carrier) {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		c.Set(TraceParentHeader, sc.TraceParent())
+	}
+}
+
+// Extract returns a copy of ctx holding the span context read from c, so
+// that the spans started with it continue the caller's trace. A missing or
+// malformed traceparent leaves ctx as it is.
+func Extract(ctx context.Context, c Carrier) context.Context {
+	sc, err := ParseTraceParent(c.Get(TraceParentHeader))
+	if err != nil {
+		return ctx
+	}
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// TraceParent formats sc as a traceparent header value.
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+var errTraceParent = errors.New("observability: malformed traceparent")
+
+// ParseTraceParent parses a traceparent header value, such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", into a remote
+// span context.
+func ParseTraceParent(s string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, fmt.Errorf("%w: %q", errTraceParent, s)
+	}
+	var sc SpanContext
+	var flags [1]byte
+	for _, f := range []struct {
+		dst []byte
+		src string
+	}{{sc.TraceID[:], parts[1]}, {sc.SpanID[:], parts[2]}, {flags[:], parts[3]}} {
+		if len(f.src) != 2*len(f.dst) || strings.ToLower(f.src) != f.src {
+			return SpanContext{}, fmt.Errorf("%w: %q", errTraceParent, s)
+		}
+		if _, err := hex.Decode(f.dst, []byte(f.src)); err != nil {
+			return SpanContext{}, fmt.Errorf("%w: %q", errTraceParent, s)
+		}
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("%w: %q", errTraceParent, s)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	sc.Remote = true
+	return sc, nil
+}
@@ -0,0 +1,433 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package observability
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace, the spans of one request across every
+// process it passes through.
+type TraceID [16]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (t TraceID) IsValid() bool  { return t != TraceID{} }
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+// SpanContext is the part of a span that travels with a request or event:
+// enough for the next process to continue the trace.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// Sampled says whether the trace is recorded. Spans of a trace that is
+	// not are propagated but not exported.
+	Sampled bool
+	// Remote is set for a span context that came from another process.
+	Remote bool
+}
+
+// IsValid reports whether sc names a span.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// SpanKind says what a span does, with the values of OTLP.
+type SpanKind int
+
+const (
+	Internal SpanKind = iota + 1
+	Server
+	Client
+	Producer
+	Consumer
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case Internal:
+		return "internal"
+	case Server:
+		return "server"
+	case Client:
+		return "client"
+	case Producer:
+		return "producer"
+	case Consumer:
+		return "consumer"
+	}
+	return fmt.Sprintf("SpanKind(%d)", int(k))
+}
+
+// SpanData is a finished span, as it is exported.
+type SpanData struct {
+	Name       string
+	Kind       SpanKind
+	TraceID    TraceID
+	SpanID     SpanID
+	Parent     SpanID // zero for the root of a trace
+	Start, End time.Time
+	Attributes []slog.Attr
+	// Error, if set, marks the span as failed and says why.
+	Error string
+}
+
+// Span is an operation being traced. Its methods may be called on a nil
+// Span, which does nothing, so code can trace without checking whether a
+// tracer is configured.
+type Span struct {
+	tracer *Tracer // nil for a span that is not recorded
+	sc     SpanContext
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SpanContext returns what identifies the span to other processes.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttributes adds attributes to the span, replacing ones of the same key.
+func (s *Span) SetAttributes(attrs ...slog.Attr) {
+	if s == nil || s.tracer == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, attr := range attrs {
+		replaced := false
+		for i := range s.data.Attributes {
+			if s.data.Attributes[i].Key == attr.Key {
+				s.data.Attributes[i] = attr
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			s.data.Attributes = append(s.data.Attributes, attr)
+		}
+	}
+}
+
+// RecordError marks the span as failed with err. A nil err does nothing.
+func (s *Span) RecordError(err error) {
+	if s == nil || s.tracer == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = err.Error()
+}
+
+// End finishes the span and hands it to the tracer's exporter. Calls after
+// the first do nothing.
+func (s *Span) End() {
+	if s == nil || s.tracer == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	s.tracer.enqueue(data)
+}
+
+type spanKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx whose spans continue the
+// trace of sc, such as one extracted from a request.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanKey{}, &Span{sc: sc})
+}
+
+// SpanFromContext returns the span in ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SpanContextFromContext returns the span context of the span in ctx, which
+// is invalid if there is none.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	return SpanFromContext(ctx).SpanContext()
+}
+
+// SpanExporter sends finished spans somewhere, such as to a collector.
+type SpanExporter interface {
+	ExportSpans(ctx context.Context, spans []SpanData) error
+}
+
+// TracerConfig configures a Tracer. Zero fields take the defaults given
+// below.
+type TracerConfig struct {
+	// Exporter receives the finished spans in batches. Without one, spans
+	// are propagated but not recorded.
+	Exporter SpanExporter
+	// Interval is how often finished spans are exported (5s). A batch is
+	// exported earlier once BatchSize (512) spans have finished.
+	Interval  time.Duration
+	BatchSize int
+	// MaxQueue bounds the finished spans waiting for export (2048). Spans
+	// that finish while it is full are dropped.
+	MaxQueue int
+	// Timeout limits every export (10s).
+	Timeout time.Duration
+}
+
+func (c TracerConfig) withDefaults() TracerConfig {
+	if c.Interval <= 0 {
+		c.Interval = 5 * time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 512
+	}
+	if c.MaxQueue <= 0 {
+		c.MaxQueue = 2048
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	return c
+}
+
+// TracerStats counts what a tracer did.
+type TracerStats struct {
+	Spans    uint64 `json:"spans"`    // spans finished
+	Exported uint64 `json:"exported"` // spans the exporter accepted
+	Dropped  uint64 `json:"dropped"`  // spans lost to a full queue or a failed export
+}
+
+// Tracer starts spans and exports them once they end. It is safe for
+// concurrent use.
+type Tracer struct {
+	cfg TracerConfig
+
+	mu      sync.Mutex
+	queue   []SpanData
+	stats   TracerStats
+	stopped bool
+
+	exportMu sync.Mutex // one export at a time
+	full     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewTracer returns a tracer that exports in the background until
+// Shutdown.
+func NewTracer(cfg TracerConfig) *Tracer {
+	t := &Tracer{
+		cfg:  cfg.withDefaults(),
+		full: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go t.loop()
+	return t
+}
+
+// ErrTracerStopped is returned by Shutdown when it was called before.
+var ErrTracerStopped = errors.New("observability: tracer stopped")
+
+// Start starts a span as a child of the span in ctx, or as the root of a new
+// trace if there is none, and returns a context holding it. The caller must
+// End the span. A nil Tracer returns ctx and a nil span, so tracing can be
+// left unconfigured.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, attrs ...slog.Attr) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{TraceID: parent.TraceID, Sampled: true}
+	if parent.IsValid() {
+		sc.Sampled = parent.Sampled
+	} else {
+		randomID(sc.TraceID[:])
+	}
+	randomID(sc.SpanID[:])
+
+	span := &Span{sc: sc}
+	if sc.Sampled && t.cfg.Exporter != nil {
+		span.tracer = t
+		span.data = SpanData{
+			Name:       name,
+			Kind:       kind,
+			TraceID:    sc.TraceID,
+			SpanID:     sc.SpanID,
+			Parent:     parent.SpanID,
+			Start:      time.Now(),
+			Attributes: attrs,
+		}
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// StartEvent starts a consumer span for delivering an event of eventType
+// with id, which may be empty. It returns a context holding the span, for
+// the handlers and the events they publish, and a function that ends the
+// span with the error of the handlers. It has the signature the eventbus
+// package expects of a tracer.
+func (t *Tracer) StartEvent(ctx context.Context, eventType, id string) (context.Context, func(error)) {
+	attrs := []slog.Attr{slog.String("messaging.system", "eventbus"), slog.String("messaging.destination.name", eventType)}
+	if id != "" {
+		attrs = append(attrs, slog.String("messaging.message.id", id))
+	}
+	ctx, span := t.Start(ctx, eventType+" process", Consumer, attrs...)
+	return ctx, func(err error) {
+		span.RecordError(err)
+		span.End()
+	}
+}
+
+// randomID fills id with random bytes, which are never all zero.
+func randomID(id []byte) {
+	for {
+		rand.Read(id)
+		for _, b := range id {
+			if b != 0 {
+				return
+			}
+		}
+	}
+}
+
+func (t *Tracer) enqueue(data SpanData) {
+	t.mu.Lock()
+	t.stats.Spans++
+	if t.stopped || len(t.queue) >= t.cfg.MaxQueue {
+		t.stats.Dropped++
+		t.mu.Unlock()
+		return
+	}
+	t.queue = append(t.queue, data)
+	full := len(t.queue) >= t.cfg.BatchSize
+	t.mu.Unlock()
+	if full {
+		select {
+		case t.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (t *Tracer) loop() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		case <-t.full:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), t.cfg.Timeout)
+		t.export(ctx)
+		cancel()
+	}
+}
+
+// export sends the queued spans in batches. A batch the exporter fails to
+// take is dropped; spans are worth less than the memory to keep them.
+func (t *Tracer) export(ctx context.Context) error {
+	t.exportMu.Lock()
+	defer t.exportMu.Unlock()
+
+	var errs []error
+	for {
+		t.mu.Lock()
+		n := min(len(t.queue), t.cfg.BatchSize)
+		batch := t.queue[:n:n]
+		t.queue = t.queue[n:]
+		t.mu.Unlock()
+		if n == 0 {
+			return errors.Join(errs...)
+		}
+
+		err := t.cfg.Exporter.ExportSpans(ctx, batch)
+		t.mu.Lock()
+		if err != nil {
+			t.stats.Dropped += uint64(n)
+			errs = append(errs, err)
+		} else {
+			t.stats.Exported += uint64(n)
+		}
+		t.mu.Unlock()
+		if ctx.Err() != nil {
+			return errors.Join(errs...)
+		}
+	}
+}
+
+// Shutdown stops the background export and exports the spans that have
+// finished, until ctx expires. Spans that end later are dropped.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	if t.stopped {
+		t.mu.Unlock()
+		return ErrTracerStopped
+	}
+	t.stopped = true
+	t.mu.Unlock()
+
+	close(t.stop)
+	<-t.done
+	if t.cfg.Exporter == nil {
+		return nil
+	}
+	return t.export(ctx)
+}
+
+// Stats returns what the tracer has done so far.
+func (t *Tracer) Stats() TracerStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats
+}
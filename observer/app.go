@@ -0,0 +1,111 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/observer/observer"
+)
+
+// Quote is the price of a stock at a point in time.
+type Quote struct {
+	Symbol string
+	Price  float64
+}
+
+// alerter is an observer type of its own: it remembers the last price and
+// reports large moves.
+type alerter struct {
+	last map[string]float64
+}
+
+func (a *alerter) Update(q Quote) {
+	if last, ok := a.last[q.Symbol]; ok && (q.Price-last)/last > 0.05 {
+		fmt.Printf("  alert: %s up %.1f%% to %.2f\n", q.Symbol, (q.Price-last)/last*100, q.Price)
+	}
+	a.last[q.Symbol] = q.Price
+}
+
+func main() {
+	var ticker observer.Subject[Quote]
+
+	// Synchronous observers run inside Notify, one after the other.
+	ticker.Attach(&alerter{last: map[string]float64{}})
+	logID := ticker.AttachFunc(func(q Quote) {
+		fmt.Printf("  log: %s %.2f\n", q.Symbol, q.Price)
+	})
+
+	var wg sync.WaitGroup
+	consume := func(name string, ch <-chan Quote, delay time.Duration) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n := 0
+			var last Quote
+			for q := range ch {
+				time.Sleep(delay)
+				n++
+				last = q
+			}
+			fmt.Printf("%s saw %d quotes, the last %s %.2f\n", name, n, last.Symbol, last.Price)
+		}()
+	}
+
+	// The audit trail must see every quote, so it blocks the ticker when it
+	// falls behind. The dashboard only cares about the latest price and
+	// the chart samples whatever fits into its buffer.
+	auditID, audit := ticker.AttachChan(4, observer.Block)
+	dashboardID, dashboard := ticker.AttachChan(1, observer.DropOldest)
+	chartID, chart := ticker.AttachChan(2, observer.DropNewest)
+	consume("audit", audit, time.Millisecond)
+	consume("dashboard", dashboard, 20*time.Millisecond)
+	consume("chart", chart, 20*time.Millisecond)
+
+	fmt.Printf("%d observers attached\n", ticker.Len())
+	prices := []float64{100, 101, 99.5, 106, 107, 105, 112.5, 111, 110, 118}
+	for i, price := range prices {
+		ticker.Notify(Quote{Symbol: "ACME", Price: price})
+		if i == 4 {
+			fmt.Println("Detaching the log.")
+			ticker.Detach(logID)
+		}
+	}
+
+	dropped := map[string]uint64{
+		"audit":     ticker.Dropped(auditID),
+		"dashboard": ticker.Dropped(dashboardID),
+		"chart":     ticker.Dropped(chartID),
+	}
+	ticker.Close()
+	wg.Wait()
+	fmt.Printf("dropped: audit %d, dashboard %d, chart %d\n", dropped["audit"], dropped["dashboard"], dropped["chart"])
+}
@@ -0,0 +1,241 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package observer implements the observer pattern with typed subjects. A
+// Subject[T] keeps a list of observers and notifies each of them of every
+// value passed to Notify. Observers are either functions, called
+// synchronously by Notify, or channels, which decouple a slow observer from
+// the subject at the cost of choosing what happens when it falls behind.
+package observer
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Observer is notified of the values of a subject.
+type Observer[T any] interface {
+	Update(value T)
+}
+
+// Func adapts a function to an Observer.
+type Func[T any] func(value T)
+
+func (f Func[T]) Update(value T) {
+	f(value)
+}
+
+// Policy decides what Notify does when the buffer of a channel observer is
+// full.
+type Policy int
+
+const (
+	// Block waits until the observer has room. A slow observer slows down
+	// Notify, and with it every other observer.
+	Block Policy = iota
+	// DropNewest discards the value being notified.
+	DropNewest
+	// DropOldest discards the oldest buffered value to make room, so the
+	// observer always sees the latest values.
+	DropOldest
+)
+
+// ID identifies an attached observer.
+type ID uint64
+
+type entry[T any] struct {
+	observer Observer[T]
+
+	// Channel observers only.
+	ch      chan T
+	policy  Policy
+	done    chan struct{} // closed on Detach, to release a blocked Notify
+	mu      sync.Mutex    // held while sending, so ch is not closed under it
+	closed  bool
+	dropped atomic.Uint64
+}
+
+// Subject notifies attached observers of values of type T. It is safe for
+// concurrent use. The zero value is ready to use.
+type Subject[T any] struct {
+	mu        sync.RWMutex
+	next      ID
+	order     []ID
+	observers map[ID]*entry[T]
+}
+
+// Attach adds an observer that Notify calls synchronously, in the order the
+// observers were attached.
+func (s *Subject[T]) Attach(o Observer[T]) ID {
+	return s.add(&entry[T]{observer: o})
+}
+
+// AttachFunc is Attach for a function.
+func (s *Subject[T]) AttachFunc(fn func(T)) ID {
+	return s.Attach(Func[T](fn))
+}
+
+// AttachChan adds an observer that receives the values on a channel with
+// room for buffer values. policy says what happens once the channel is
+// full; dropping needs a buffer, so it is at least 1 for DropNewest and
+// DropOldest. The channel is closed when the observer is detached.
+func (s *Subject[T]) AttachChan(buffer int, policy Policy) (ID, <-chan T) {
+	if buffer < 1 && policy != Block {
+		buffer = 1
+	}
+	e := &entry[T]{ch: make(chan T, buffer), policy: policy, done: make(chan struct{})}
+	return s.add(e), e.ch
+}
+
+func (s *Subject[T]) add(e *entry[T]) ID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.observers == nil {
+		s.observers = make(map[ID]*entry[T])
+	}
+	s.next++
+	s.observers[s.next] = e
+	s.order = append(s.order, s.next)
+	return s.next
+}
+
+// Detach removes the observer id. It reports false if there was no such
+// observer.
+func (s *Subject[T]) Detach(id ID) bool {
+	s.mu.Lock()
+	e, ok := s.observers[id]
+	if ok {
+		delete(s.observers, id)
+		for i, other := range s.order {
+			if other == id {
+				s.order = append(s.order[:i], s.order[i+1:]...)
+				break
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if ok && e.ch != nil {
+		close(e.done)
+		e.mu.Lock()
+		e.closed = true
+		close(e.ch)
+		e.mu.Unlock()
+	}
+	return ok
+}
+
+// Close detaches every observer.
+func (s *Subject[T]) Close() {
+	s.mu.RLock()
+	ids := append([]ID(nil), s.order...)
+	s.mu.RUnlock()
+
+	for _, id := range ids {
+		s.Detach(id)
+	}
+}
+
+// Notify passes value to every observer attached when it was called. The
+// subject's lock is not held while observers run, so an observer may attach
+// or detach observers, including itself.
+func (s *Subject[T]) Notify(value T) {
+	s.mu.RLock()
+	entries := make([]*entry[T], 0, len(s.order))
+	for _, id := range s.order {
+		entries = append(entries, s.observers[id])
+	}
+	s.mu.RUnlock()
+
+	for _, e := range entries {
+		if e.ch == nil {
+			e.observer.Update(value)
+			continue
+		}
+		e.send(value)
+	}
+}
+
+func (e *entry[T]) send(value T) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+
+	select {
+	case e.ch <- value:
+		return
+	default:
+	}
+
+	switch e.policy {
+	case Block:
+		select {
+		case e.ch <- value:
+		case <-e.done:
+		}
+	case DropNewest:
+		e.dropped.Add(1)
+	case DropOldest:
+		// The observer may take a value between the two steps, in which
+		// case nothing needs to be dropped; retry until the value is in.
+		for {
+			select {
+			case <-e.ch:
+				e.dropped.Add(1)
+			default:
+			}
+			select {
+			case e.ch <- value:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// Len returns the number of attached observers.
+func (s *Subject[T]) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.order)
+}
+
+// Dropped returns how many values the channel observer id missed because
+// it fell behind.
+func (s *Subject[T]) Dropped(id ID) uint64 {
+	s.mu.RLock()
+	e, ok := s.observers[id]
+	s.mu.RUnlock()
+	if !ok {
+		return 0
+	}
+	return e.dropped.Load()
+}
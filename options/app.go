@@ -0,0 +1,85 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/options/mailer"
+)
+
+// Mailtrap bundles the settings of a test mail service into one option.
+func Mailtrap(username, password string) mailer.Option {
+	return mailer.Options(
+		mailer.WithPort(2525),
+		mailer.WithAuth(username, password),
+	)
+}
+
+func show(name string, m *mailer.Mailer, err error) {
+	if err != nil {
+		fmt.Printf("%s:\n  %s\n", name, strings.ReplaceAll(err.Error(), "\n", "\n  "))
+		return
+	}
+	fmt.Printf("%s:\n  %s\n", name, m)
+}
+
+func main() {
+	m, err := mailer.New("smtp.example.com")
+	show("defaults", m, err)
+
+	// The port follows the security mode unless it is set explicitly.
+	m, err = mailer.New("smtp.example.com",
+		mailer.WithSecurity(mailer.ImplicitTLS),
+		mailer.WithAuth("alerts", "s3cret"),
+		mailer.WithTimeout(10*time.Second),
+	)
+	show("implicit TLS", m, err)
+
+	m, err = mailer.New("sandbox.mailtrap.io", Mailtrap("user", "pass"))
+	show("preset", m, err)
+
+	// Each option is fine on its own; together they are not, and every
+	// problem is reported at once.
+	m, err = mailer.New("smtp.example.com",
+		mailer.WithSecurity(mailer.None),
+		mailer.WithAuth("alerts", "s3cret"),
+		mailer.WithPort(465),
+		mailer.WithPoolSize(0),
+	)
+	show("conflicting options", m, err)
+
+	m, err = mailer.NewBuilder("smtp.example.com").
+		Security(mailer.ImplicitTLS).
+		Port(587).
+		Build()
+	show("builder", m, err)
+}
@@ -0,0 +1,3 @@
+module github.com/rajamummidi/go-design-patterns/options
+
+go 1.20
@@ -0,0 +1,247 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package mailer is the configuration side of a mail client, used to show
+// the functional options pattern. New takes the one required setting, the
+// host, as an argument and everything else as options; it fills in
+// defaults that depend on other options and rejects combinations that are
+// invalid or unsafe.
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Security is how the connection to the mail server is encrypted.
+type Security int
+
+const (
+	// StartTLS connects in plain text and upgrades to TLS, on port 587.
+	StartTLS Security = iota
+	// ImplicitTLS speaks TLS from the first byte, on port 465.
+	ImplicitTLS
+	// None does not encrypt, on port 25.
+	None
+)
+
+func (s Security) String() string {
+	switch s {
+	case StartTLS:
+		return "STARTTLS"
+	case ImplicitTLS:
+		return "implicit TLS"
+	case None:
+		return "none"
+	}
+	return fmt.Sprintf("Security(%d)", int(s))
+}
+
+// defaultPort is the port each security mode is normally served on.
+var defaultPort = map[Security]int{StartTLS: 587, ImplicitTLS: 465, None: 25}
+
+// Option configures a Mailer.
+type Option func(*config)
+
+type config struct {
+	port         int
+	security     Security
+	username     string
+	password     string
+	insecureAuth bool
+	timeout      time.Duration
+	poolSize     int
+}
+
+// WithPort connects to port instead of the default port of the security
+// mode.
+func WithPort(port int) Option {
+	return func(c *config) {
+		c.port = port
+	}
+}
+
+// WithSecurity sets how the connection is encrypted (StartTLS by default).
+func WithSecurity(s Security) Option {
+	return func(c *config) {
+		c.security = s
+	}
+}
+
+// WithAuth logs in with a username and password.
+func WithAuth(username, password string) Option {
+	return func(c *config) {
+		c.username, c.password = username, password
+	}
+}
+
+// WithInsecureAuth allows WithAuth on an unencrypted connection, which
+// sends the password in clear text. Only for test servers.
+func WithInsecureAuth() Option {
+	return func(c *config) {
+		c.insecureAuth = true
+	}
+}
+
+// WithTimeout bounds how long a message may take to send (30 seconds by
+// default).
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.timeout = d
+	}
+}
+
+// WithPoolSize keeps up to n connections open (2 by default).
+func WithPoolSize(n int) Option {
+	return func(c *config) {
+		c.poolSize = n
+	}
+}
+
+// Options combines several options into one, for presets such as the
+// settings of a particular provider.
+func Options(opts ...Option) Option {
+	return func(c *config) {
+		for _, opt := range opts {
+			opt(c)
+		}
+	}
+}
+
+// Mailer holds a validated configuration. Its fields cannot be changed
+// after New, so it can be shared freely.
+type Mailer struct {
+	host string
+	cfg  config
+}
+
+// New returns a Mailer for host configured by opts. It reports every
+// problem with the options at once.
+func New(host string, opts ...Option) (*Mailer, error) {
+	cfg := config{timeout: 30 * time.Second, poolSize: 2}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	// Defaults that depend on other options are filled in after all of
+	// them have been applied, so their order does not matter.
+	if cfg.port == 0 {
+		cfg.port = defaultPort[cfg.security]
+	}
+	if err := cfg.validate(host); err != nil {
+		return nil, err
+	}
+	return &Mailer{host: host, cfg: cfg}, nil
+}
+
+func (c *config) validate(host string) error {
+	var errs []error
+	if host == "" {
+		errs = append(errs, errors.New("mailer: no host"))
+	}
+	if _, ok := defaultPort[c.security]; !ok {
+		errs = append(errs, fmt.Errorf("mailer: unknown security mode %d", int(c.security)))
+	}
+	if c.port < 1 || c.port > 65535 {
+		errs = append(errs, fmt.Errorf("mailer: port %d out of range", c.port))
+	}
+	// The two TLS modes are easy to mix up, and a client speaking the
+	// wrong one just hangs until it times out.
+	if c.port == defaultPort[ImplicitTLS] && c.security == StartTLS {
+		errs = append(errs, fmt.Errorf("mailer: port %d expects implicit TLS, not STARTTLS", c.port))
+	}
+	if c.port == defaultPort[StartTLS] && c.security == ImplicitTLS {
+		errs = append(errs, fmt.Errorf("mailer: port %d expects STARTTLS, not implicit TLS", c.port))
+	}
+	if (c.username == "") != (c.password == "") {
+		errs = append(errs, errors.New("mailer: WithAuth needs both a username and a password"))
+	}
+	if c.username != "" && c.security == None && !c.insecureAuth {
+		errs = append(errs, errors.New("mailer: WithAuth without encryption sends the password in clear text; add WithInsecureAuth to allow it"))
+	}
+	if c.insecureAuth && c.username == "" {
+		errs = append(errs, errors.New("mailer: WithInsecureAuth without WithAuth"))
+	}
+	if c.timeout <= 0 {
+		errs = append(errs, fmt.Errorf("mailer: timeout must be positive, not %s", c.timeout))
+	}
+	if c.poolSize < 1 {
+		errs = append(errs, fmt.Errorf("mailer: pool size must be at least 1, not %d", c.poolSize))
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Mailer) String() string {
+	auth := "no auth"
+	if m.cfg.username != "" {
+		auth = "as " + m.cfg.username
+	}
+	return fmt.Sprintf("%s:%d, %s, %s, timeout %s, pool %d", m.host, m.cfg.port, m.cfg.security, auth, m.cfg.timeout, m.cfg.poolSize)
+}
+
+// Builder is the builder pattern for the same configuration: each method
+// records a setting and Build validates them all. It suits callers that
+// assemble a configuration step by step, such as from a config file.
+type Builder struct {
+	host string
+	opts []Option
+}
+
+func NewBuilder(host string) *Builder {
+	return &Builder{host: host}
+}
+
+func (b *Builder) Port(port int) *Builder {
+	b.opts = append(b.opts, WithPort(port))
+	return b
+}
+
+func (b *Builder) Security(s Security) *Builder {
+	b.opts = append(b.opts, WithSecurity(s))
+	return b
+}
+
+func (b *Builder) Auth(username, password string) *Builder {
+	b.opts = append(b.opts, WithAuth(username, password))
+	return b
+}
+
+func (b *Builder) Timeout(d time.Duration) *Builder {
+	b.opts = append(b.opts, WithTimeout(d))
+	return b
+}
+
+func (b *Builder) PoolSize(n int) *Builder {
+	b.opts = append(b.opts, WithPoolSize(n))
+	return b
+}
+
+// Build returns the Mailer, or every problem with the settings.
+func (b *Builder) Build() (*Mailer, error) {
+	return New(b.host, b.opts...)
+}
@@ -0,0 +1,127 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/otlp/otlp"
+)
+
+// collector stands in for an OpenTelemetry collector. It is unavailable for
+// its first requests and then prints what it receives.
+func collector(unavailable int64) (string, func()) {
+	var requests atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc(otlp.MetricsPath, func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= unavailable {
+			fmt.Println("collector: 503, come back later")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var req struct {
+			ResourceMetrics []struct {
+				ScopeMetrics []struct {
+					Scope   struct{ Name string }
+					Metrics []json.RawMessage
+				}
+			}
+		}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &req)
+		for _, rm := range req.ResourceMetrics {
+			for _, sm := range rm.ScopeMetrics {
+				fmt.Printf("collector: %d metrics from %s, %d bytes\n", len(sm.Metrics), sm.Scope.Name, len(body))
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	return "http://" + listener.Addr().String(), func() { server.Close() }
+}
+
+func main() {
+	endpoint, stop := collector(2)
+	defer stop()
+
+	// A source is anything that writes the Prometheus text format, such as
+	// EventBus.WritePrometheus.
+	var handled atomic.Int64
+	jobs := func(w io.Writer) {
+		fmt.Fprintf(w, "# HELP jobs_handled_total Jobs handled.\n# TYPE jobs_handled_total counter\n")
+		fmt.Fprintf(w, "jobs_handled_total{queue=\"default\"} %d\n", handled.Load())
+		fmt.Fprintf(w, "# HELP jobs_queued Jobs waiting.\n# TYPE jobs_queued gauge\n")
+		fmt.Fprintf(w, "jobs_queued{queue=\"default\"} %d\n", 100-handled.Load())
+		fmt.Fprintf(w, "# HELP jobs_duration_seconds Job latency.\n# TYPE jobs_duration_seconds histogram\n")
+		fmt.Fprintf(w, "jobs_duration_seconds_bucket{le=\"0.1\"} %d\n", handled.Load()/2)
+		fmt.Fprintf(w, "jobs_duration_seconds_bucket{le=\"+Inf\"} %d\n", handled.Load())
+		fmt.Fprintf(w, "jobs_duration_seconds_sum %g\n", float64(handled.Load())*0.12)
+		fmt.Fprintf(w, "jobs_duration_seconds_count %d\n", handled.Load())
+	}
+
+	exporter := otlp.New(otlp.Config{
+		Endpoint:     endpoint,
+		Resource:     map[string]string{"service.name": "otlp-demo"},
+		Interval:     200 * time.Millisecond,
+		MaxRetries:   1,
+		RetryBackoff: 50 * time.Millisecond,
+	})
+	exporter.Register("jobs", jobs)
+	exporter.Start()
+
+	for i := 0; i < 10; i++ {
+		handled.Add(10)
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// Shutdown sends the final numbers, so nothing measured since the last
+	// interval is lost.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := exporter.Shutdown(ctx); err != nil {
+		fmt.Println("shutdown:", err)
+	}
+	stats := exporter.Stats()
+	fmt.Printf("exports %d, retries %d, failures %d, dropped %d, queued %d\n",
+		stats.Exports, stats.Retries, stats.Failures, stats.Dropped, stats.Queued)
+}
@@ -0,0 +1,386 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package otlp exports metrics and traces to an OpenTelemetry collector over
+// OTLP/HTTP with JSON encoding. The instrumented packages of this repository
+// write their metrics in the Prometheus text format, so the exporter takes
+// any such writer as a source, such as EventBus.WritePrometheus or
+// Registry.WritePrometheus of the circuit breaker, and converts what it
+// writes into OTLP metrics. Spans are handed to ExportSpans by a tracer. It
+// needs nothing beyond the standard library.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MetricsPath is where OTLP/HTTP collectors accept metrics.
+const MetricsPath = "/v1/metrics"
+
+// ErrStopped is returned by Flush after Shutdown.
+var ErrStopped = errors.New("otlp: exporter stopped")
+
+// Source writes metrics in the Prometheus text exposition format.
+type Source func(w io.Writer)
+
+// Config configures an Exporter. Zero fields take the defaults given below.
+type Config struct {
+	// Endpoint is the base URL of the collector, such as
+	// http://localhost:4318. MetricsPath or TracesPath is appended to it.
+	Endpoint string
+	// Headers are sent with every request, for example for authentication.
+	Headers map[string]string
+	// Resource describes what is being measured. It should at least
+	// contain service.name.
+	Resource map[string]string
+
+	// Interval is how often metrics are collected and sent (15s).
+	Interval time.Duration
+	// Timeout limits every request (10s).
+	Timeout time.Duration
+	// MaxRetries is how often a request that failed with a retryable
+	// error is tried again within one export (3), waiting RetryBackoff
+	// (500ms) before the first retry and twice as long before each
+	// following one.
+	MaxRetries   int
+	RetryBackoff time.Duration
+	// MaxQueue is how many exports are kept while the collector cannot be
+	// reached (10). Once it is full the oldest export is dropped.
+	MaxQueue int
+
+	Client *http.Client
+}
+
+func (c Config) withDefaults() Config {
+	if c.Interval <= 0 {
+		c.Interval = 15 * time.Second
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = 3
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = 500 * time.Millisecond
+	}
+	if c.MaxQueue <= 0 {
+		c.MaxQueue = 10
+	}
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	return c
+}
+
+// Stats counts what an exporter did.
+type Stats struct {
+	Exports  uint64 `json:"exports"`  // requests the collector accepted
+	Retries  uint64 `json:"retries"`  // requests tried again
+	Failures uint64 `json:"failures"` // exports that could not be sent
+	Dropped  uint64 `json:"dropped"`  // exports given up on
+	Queued   int    `json:"queued"`   // exports waiting to be sent
+	Spans    uint64 `json:"spans"`    // spans the collector accepted
+}
+
+type namedSource struct {
+	scope  string
+	source Source
+}
+
+// Exporter periodically collects metrics from its sources and sends them to
+// a collector. Each collection becomes one request holding every source,
+// and requests that cannot be sent are queued and sent in order later.
+type Exporter struct {
+	cfg   Config
+	start time.Time
+
+	mu      sync.Mutex
+	sources []namedSource
+	queue   [][]byte
+	stats   Stats
+	started bool
+	stopped bool
+
+	sendMu sync.Mutex // one export at a time, so the queue stays in order
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func New(cfg Config) *Exporter {
+	return &Exporter{cfg: cfg.withDefaults(), start: time.Now(), stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+// Register adds a source of metrics. scope names the instrumentation
+// scope its metrics are reported under, such as "eventbus".
+func (e *Exporter) Register(scope string, source Source) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sources = append(e.sources, namedSource{scope: scope, source: source})
+}
+
+// Start exports every Interval until Shutdown.
+func (e *Exporter) Start() {
+	e.mu.Lock()
+	e.started = true
+	e.mu.Unlock()
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(e.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-e.stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), e.cfg.Interval)
+				if err := e.Flush(ctx); err != nil && !errors.Is(err, ErrStopped) {
+					fmt.Printf("OTLP export: %v\n", err)
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// Shutdown stops the periodic export and sends the metrics one last time,
+// along with anything still queued, until ctx expires.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	if e.stopped {
+		e.mu.Unlock()
+		return ErrStopped
+	}
+	e.stopped = true
+	started := e.started
+	e.mu.Unlock()
+
+	close(e.stop)
+	if started {
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return e.flush(ctx)
+}
+
+// Flush collects the metrics now and sends them with anything queued.
+func (e *Exporter) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	stopped := e.stopped
+	e.mu.Unlock()
+	if stopped {
+		return ErrStopped
+	}
+	return e.flush(ctx)
+}
+
+func (e *Exporter) flush(ctx context.Context) error {
+	e.sendMu.Lock()
+	defer e.sendMu.Unlock()
+
+	body, err := e.collect()
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	if body != nil {
+		e.queue = append(e.queue, body)
+	}
+	if over := len(e.queue) - e.cfg.MaxQueue; over > 0 {
+		e.queue = e.queue[over:]
+		e.stats.Dropped += uint64(over)
+	}
+	e.mu.Unlock()
+
+	for {
+		e.mu.Lock()
+		if len(e.queue) == 0 {
+			e.mu.Unlock()
+			return nil
+		}
+		next := e.queue[0]
+		e.mu.Unlock()
+
+		err := e.send(ctx, MetricsPath, next)
+		var permanent *permanentError
+		if err != nil && !errors.As(err, &permanent) {
+			// Keep it for the next export; the collector may be back by
+			// then.
+			e.mu.Lock()
+			e.stats.Failures++
+			e.mu.Unlock()
+			return err
+		}
+
+		e.mu.Lock()
+		e.queue = e.queue[1:]
+		if err != nil {
+			e.stats.Failures++
+			e.stats.Dropped++
+		} else {
+			e.stats.Exports++
+		}
+		e.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// collect reads every source and encodes one export request, or returns nil
+// if there is nothing to export.
+func (e *Exporter) collect() ([]byte, error) {
+	e.mu.Lock()
+	sources := append([]namedSource(nil), e.sources...)
+	e.mu.Unlock()
+
+	now := time.Now().UnixNano()
+	rm := resourceMetrics{Resource: resource{Attributes: e.resourceAttributes()}}
+	for _, s := range sources {
+		var buf bytes.Buffer
+		s.source(&buf)
+		families, err := parseText(&buf)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s metrics: %w", s.scope, err)
+		}
+		if metrics := convert(families, e.start.UnixNano(), now); len(metrics) > 0 {
+			rm.ScopeMetrics = append(rm.ScopeMetrics, scopeMetrics{Scope: scope{Name: s.scope}, Metrics: metrics})
+		}
+	}
+	if len(rm.ScopeMetrics) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(exportRequest{ResourceMetrics: []resourceMetrics{rm}})
+}
+
+func (e *Exporter) resourceAttributes() []keyValue {
+	keys := make([]string, 0, len(e.cfg.Resource))
+	for key := range e.cfg.Resource {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	attrs := make([]keyValue, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, keyValue{Key: key, Value: anyValue{StringValue: e.cfg.Resource[key]}})
+	}
+	return attrs
+}
+
+// permanentError is a response the collector will give again however often
+// the request is retried, such as 400 for a malformed request.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// send posts body to path, retrying on network errors and on the statuses
+// the OTLP specification calls retryable.
+func (e *Exporter) send(ctx context.Context, path string, body []byte) error {
+	backoff := e.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		wait, err := e.post(ctx, path, body)
+		var permanent *permanentError
+		if err == nil || errors.As(err, &permanent) || attempt == e.cfg.MaxRetries {
+			return err
+		}
+
+		if wait <= 0 {
+			wait = backoff
+			backoff *= 2
+		}
+		e.mu.Lock()
+		e.stats.Retries++
+		e.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// post makes one request. For a retryable failure it returns how long the
+// collector asked the client to wait, if it did.
+func (e *Exporter) post(ctx context.Context, path string, body []byte) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, &permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.cfg.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusBadGateway,
+		resp.StatusCode == http.StatusServiceUnavailable,
+		resp.StatusCode == http.StatusGatewayTimeout:
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return time.Duration(seconds) * time.Second, fmt.Errorf("collector answered %s", resp.Status)
+	default:
+		return 0, &permanentError{fmt.Errorf("collector rejected the export: %s", resp.Status)}
+	}
+}
+
+// Stats returns what the exporter has done so far.
+func (e *Exporter) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	stats := e.stats
+	stats.Queued = len(e.queue)
+	return stats
+}
@@ -0,0 +1,310 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package otlp
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The types below are the parts of the OTLP metrics data model the exporter
+// produces, in the JSON encoding of OTLP/HTTP. 64-bit integers are strings,
+// as the protobuf JSON mapping requires.
+
+type exportRequest struct {
+	ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+}
+
+type resourceMetrics struct {
+	Resource     resource       `json:"resource"`
+	ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type scopeMetrics struct {
+	Scope   scope    `json:"scope"`
+	Metrics []metric `json:"metrics"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type metric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Unit        string     `json:"unit,omitempty"`
+	Sum         *sum       `json:"sum,omitempty"`
+	Gauge       *gauge     `json:"gauge,omitempty"`
+	Histogram   *histogram `json:"histogram,omitempty"`
+	Summary     *summary   `json:"summary,omitempty"`
+}
+
+// aggregationCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE: every point
+// is the total since the start time, which is what Prometheus counters are.
+const aggregationCumulative = 2
+
+type sum struct {
+	DataPoints             []numberPoint `json:"dataPoints"`
+	AggregationTemporality int           `json:"aggregationTemporality"`
+	IsMonotonic            bool          `json:"isMonotonic"`
+}
+
+type gauge struct {
+	DataPoints []numberPoint `json:"dataPoints"`
+}
+
+type histogram struct {
+	DataPoints             []histogramPoint `json:"dataPoints"`
+	AggregationTemporality int              `json:"aggregationTemporality"`
+}
+
+type summary struct {
+	DataPoints []summaryPoint `json:"dataPoints"`
+}
+
+type numberPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	AsInt             *string    `json:"asInt,omitempty"`
+	AsDouble          *float64   `json:"asDouble,omitempty"`
+}
+
+type histogramPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	Count             string     `json:"count"`
+	Sum               float64    `json:"sum"`
+	BucketCounts      []string   `json:"bucketCounts"`
+	ExplicitBounds    []float64  `json:"explicitBounds"`
+}
+
+type summaryPoint struct {
+	Attributes        []keyValue      `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	Count             string          `json:"count"`
+	Sum               float64         `json:"sum"`
+	QuantileValues    []quantileValue `json:"quantileValues"`
+}
+
+type quantileValue struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+// convert turns metric families into OTLP metrics. start is when the
+// cumulative series began and now when they were read, both in Unix
+// nanoseconds.
+func convert(families []*family, start, now int64) []metric {
+	startNano, nowNano := strconv.FormatInt(start, 10), strconv.FormatInt(now, 10)
+
+	metrics := make([]metric, 0, len(families))
+	for _, f := range families {
+		if len(f.samples) == 0 {
+			continue
+		}
+		m := metric{Name: f.name, Description: f.help, Unit: unit(f.name)}
+		switch f.typ {
+		case "counter":
+			m.Sum = &sum{
+				DataPoints:             numberPoints(f.samples, startNano, nowNano),
+				AggregationTemporality: aggregationCumulative,
+				IsMonotonic:            true,
+			}
+		case "histogram":
+			m.Histogram = &histogram{
+				DataPoints:             histogramPoints(f, startNano, nowNano),
+				AggregationTemporality: aggregationCumulative,
+			}
+		case "summary":
+			m.Summary = &summary{DataPoints: summaryPoints(f, startNano, nowNano)}
+		default:
+			// Gauges, and untyped samples, which are best treated as one.
+			m.Gauge = &gauge{DataPoints: numberPoints(f.samples, "", nowNano)}
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+// unit derives the UCUM unit from the suffix Prometheus names carry.
+func unit(name string) string {
+	name = strings.TrimSuffix(name, "_total")
+	switch {
+	case strings.HasSuffix(name, "_seconds"):
+		return "s"
+	case strings.HasSuffix(name, "_bytes"):
+		return "By"
+	}
+	return ""
+}
+
+func numberPoints(samples []sample, start, now string) []numberPoint {
+	points := make([]numberPoint, 0, len(samples))
+	for _, s := range samples {
+		p := numberPoint{Attributes: attributes(s.labels, ""), StartTimeUnixNano: start, TimeUnixNano: now}
+		if s.value == math.Trunc(s.value) && math.Abs(s.value) < 1<<53 {
+			value := strconv.FormatInt(int64(s.value), 10)
+			p.AsInt = &value
+		} else {
+			value := s.value
+			p.AsDouble = &value
+		}
+		points = append(points, p)
+	}
+	return points
+}
+
+// series groups the samples of a family by their labels, leaving out the
+// label that tells the samples of one series apart.
+func series(f *family, except string) (keys []string, groups map[string][]sample) {
+	groups = make(map[string][]sample)
+	for _, s := range f.samples {
+		var b strings.Builder
+		for _, l := range s.labels {
+			if l.name != except {
+				b.WriteString(l.name + "=" + l.value + ",")
+			}
+		}
+		key := b.String()
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], s)
+	}
+	return keys, groups
+}
+
+func histogramPoints(f *family, start, now string) []histogramPoint {
+	keys, groups := series(f, "le")
+	points := make([]histogramPoint, 0, len(keys))
+	for _, key := range keys {
+		type bucket struct {
+			bound      float64
+			cumulative float64
+		}
+		var (
+			buckets []bucket
+			p       = histogramPoint{StartTimeUnixNano: start, TimeUnixNano: now}
+			count   float64
+		)
+		for _, s := range groups[key] {
+			p.Attributes = attributes(s.labels, "le")
+			switch s.name {
+			case f.name + "_bucket":
+				bound, err := strconv.ParseFloat(labelValue(s.labels, "le"), 64)
+				if err == nil {
+					buckets = append(buckets, bucket{bound, s.value})
+				}
+			case f.name + "_sum":
+				p.Sum = s.value
+			case f.name + "_count":
+				count = s.value
+			}
+		}
+		sort.Slice(buckets, func(i, j int) bool { return buckets[i].bound < buckets[j].bound })
+
+		// Prometheus buckets are cumulative and end with +Inf; OTLP wants
+		// the count of each bucket and only the finite bounds.
+		var previous float64
+		for _, b := range buckets {
+			if !math.IsInf(b.bound, 1) {
+				p.ExplicitBounds = append(p.ExplicitBounds, b.bound)
+			}
+			p.BucketCounts = append(p.BucketCounts, strconv.FormatUint(uint64(b.cumulative-previous), 10))
+			previous = b.cumulative
+		}
+		if len(buckets) == 0 || !math.IsInf(buckets[len(buckets)-1].bound, 1) {
+			p.BucketCounts = append(p.BucketCounts, strconv.FormatUint(uint64(count-previous), 10))
+		}
+		p.Count = strconv.FormatUint(uint64(count), 10)
+		points = append(points, p)
+	}
+	return points
+}
+
+func summaryPoints(f *family, start, now string) []summaryPoint {
+	keys, groups := series(f, "quantile")
+	points := make([]summaryPoint, 0, len(keys))
+	for _, key := range keys {
+		p := summaryPoint{StartTimeUnixNano: start, TimeUnixNano: now, Count: "0"}
+		for _, s := range groups[key] {
+			p.Attributes = attributes(s.labels, "quantile")
+			switch s.name {
+			case f.name:
+				q, err := strconv.ParseFloat(labelValue(s.labels, "quantile"), 64)
+				if err == nil {
+					p.QuantileValues = append(p.QuantileValues, quantileValue{Quantile: q, Value: s.value})
+				}
+			case f.name + "_sum":
+				p.Sum = s.value
+			case f.name + "_count":
+				p.Count = strconv.FormatUint(uint64(s.value), 10)
+			}
+		}
+		points = append(points, p)
+	}
+	return points
+}
+
+func attributes(labels []label, except string) []keyValue {
+	var attrs []keyValue
+	for _, l := range labels {
+		if l.name != except {
+			attrs = append(attrs, keyValue{Key: l.name, Value: anyValue{StringValue: l.value}})
+		}
+	}
+	return attrs
+}
+
+func labelValue(labels []label, name string) string {
+	for _, l := range labels {
+		if l.name == name {
+			return l.value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,187 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package otlp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// family is a metric family read from the Prometheus text format: the
+// samples following a "# TYPE" line.
+type family struct {
+	name    string
+	help    string
+	typ     string // counter, gauge, histogram, summary or untyped
+	samples []sample
+}
+
+type sample struct {
+	name   string
+	labels []label
+	value  float64
+}
+
+type label struct {
+	name, value string
+}
+
+// parseText reads metric families in the Prometheus text exposition format,
+// as written by the WritePrometheus methods in this repository. Timestamps
+// on samples are ignored.
+func parseText(r io.Reader) ([]*family, error) {
+	var (
+		families []*family
+		current  *family
+		help     = map[string]string{}
+	)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "# HELP "):
+			fields := strings.SplitN(line[len("# HELP "):], " ", 2)
+			if len(fields) == 2 {
+				help[fields[0]] = fields[1]
+			}
+			continue
+		case strings.HasPrefix(line, "# TYPE "):
+			fields := strings.Fields(line[len("# TYPE "):])
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: malformed TYPE", n)
+			}
+			current = &family{name: fields[0], typ: fields[1], help: help[fields[0]]}
+			families = append(families, current)
+			continue
+		case strings.HasPrefix(line, "#"):
+			continue
+		}
+
+		s, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if current == nil || !belongs(s.name, current) {
+			current = &family{name: s.name, typ: "untyped", help: help[s.name]}
+			families = append(families, current)
+		}
+		current.samples = append(current.samples, s)
+	}
+	return families, scanner.Err()
+}
+
+// belongs reports whether a sample called name is part of f, counting the
+// _bucket, _sum and _count series of histograms and summaries.
+func belongs(name string, f *family) bool {
+	if name == f.name {
+		return true
+	}
+	if f.typ != "histogram" && f.typ != "summary" {
+		return false
+	}
+	switch strings.TrimPrefix(name, f.name) {
+	case "_bucket":
+		return f.typ == "histogram"
+	case "_sum", "_count":
+		return true
+	}
+	return false
+}
+
+func parseSample(line string) (sample, error) {
+	var s sample
+	end := strings.IndexAny(line, "{ ")
+	if end < 0 {
+		return s, fmt.Errorf("malformed sample %q", line)
+	}
+	s.name = line[:end]
+	rest := line[end:]
+
+	if strings.HasPrefix(rest, "{") {
+		var err error
+		if s.labels, rest, err = parseLabels(rest[1:]); err != nil {
+			return s, err
+		}
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return s, fmt.Errorf("sample %s has no value", s.name)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return s, fmt.Errorf("sample %s: %w", s.name, err)
+	}
+	s.value = value
+	return s, nil
+}
+
+// parseLabels parses `name="value",...}` and returns what follows the
+// closing brace.
+func parseLabels(s string) ([]label, string, error) {
+	var labels []label
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if strings.HasPrefix(s, "}") {
+			return labels, s[1:], nil
+		}
+		eq := strings.Index(s, "=")
+		if eq < 0 || len(s) < eq+2 || s[eq+1] != '"' {
+			return nil, "", fmt.Errorf("malformed labels %q", s)
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+2:]
+
+		var value strings.Builder
+		i := 0
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			value.WriteByte(s[i])
+		}
+		if i == len(s) {
+			return nil, "", fmt.Errorf("unterminated value of label %s", name)
+		}
+		labels = append(labels, label{name: name, value: value.String()})
+		s = s[i+1:]
+	}
+}
@@ -0,0 +1,177 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// TracesPath is where OTLP/HTTP collectors accept traces.
+const TracesPath = "/v1/traces"
+
+// SpanKind says what a span does, with the values of OTLP.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+	SpanKindProducer SpanKind = 4
+	SpanKindConsumer SpanKind = 5
+)
+
+// Span is a finished span. The IDs are lowercase hex, as in a W3C
+// traceparent header; ParentSpanID is empty for the root of a trace.
+type Span struct {
+	Scope        string // the instrumentation scope, such as "eventbus"
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Kind         SpanKind
+	Start, End   time.Time
+	Attributes   map[string]string
+	// Error, if set, marks the span as failed and says why.
+	Error string
+}
+
+// ExportSpans sends spans to the collector at once, retrying like an export
+// of metrics. Spans that cannot be sent are not queued; the tracer that
+// collected them decides whether to try again.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []Span) error {
+	e.mu.Lock()
+	stopped := e.stopped
+	e.mu.Unlock()
+	if stopped {
+		return ErrStopped
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(traceRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: e.resourceAttributes()},
+		ScopeSpans: groupSpans(spans),
+	}}})
+	if err != nil {
+		return err
+	}
+	err = e.send(ctx, TracesPath, body)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		e.stats.Failures++
+		return err
+	}
+	e.stats.Spans += uint64(len(spans))
+	return nil
+}
+
+// The types below are the parts of the OTLP trace data model the exporter
+// produces.
+
+type traceRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []spanJSON `json:"spans"`
+}
+
+type spanJSON struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              SpanKind   `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            spanStatus `json:"status"`
+}
+
+type spanStatus struct {
+	Code    int    `json:"code"` // 0 unset, 1 ok, 2 error
+	Message string `json:"message,omitempty"`
+}
+
+// groupSpans sorts spans into their scopes, in the order the scopes first
+// appear.
+func groupSpans(spans []Span) []scopeSpans {
+	var groups []scopeSpans
+	index := make(map[string]int)
+	for _, s := range spans {
+		i, ok := index[s.Scope]
+		if !ok {
+			i = len(groups)
+			index[s.Scope] = i
+			groups = append(groups, scopeSpans{Scope: scope{Name: s.Scope}})
+		}
+		groups[i].Spans = append(groups[i].Spans, encodeSpan(s))
+	}
+	return groups
+}
+
+func encodeSpan(s Span) spanJSON {
+	keys := make([]string, 0, len(s.Attributes))
+	for key := range s.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	attrs := make([]keyValue, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, keyValue{Key: key, Value: anyValue{StringValue: s.Attributes[key]}})
+	}
+
+	span := spanJSON{
+		TraceID:           s.TraceID,
+		SpanID:            s.SpanID,
+		ParentSpanID:      s.ParentSpanID,
+		Name:              s.Name,
+		Kind:              s.Kind,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		Attributes:        attrs,
+	}
+	if s.Error != "" {
+		span.Status = spanStatus{Code: 2, Message: s.Error}
+	}
+	return span
+}
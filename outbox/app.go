@@ -0,0 +1,168 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/idempotency/idempotency"
+	"github.com/rajamummidi/go-design-patterns/outbox/outbox"
+)
+
+// OrderPlaced is the event stored in the outbox with every new order.
+type OrderPlaced struct {
+	MessageID string `json:"message_id"`
+	OrderID   string `json:"order_id"`
+	Customer  string `json:"customer"`
+	Amount    int64  `json:"amount"`
+}
+
+// placed returns the outbox message that goes with a new order.
+func placed(id, customer string, amount int64) outbox.Message {
+	msgID := id + ".placed"
+	return outbox.Message{
+		ID:    msgID,
+		Topic: "order.placed",
+		Data:  OrderPlaced{MessageID: msgID, OrderID: id, Customer: customer, Amount: amount},
+	}
+}
+
+// shop is the demo's database: an orders table and the outbox, changed
+// together in one transaction by place.
+type shop interface {
+	outbox.Store
+	place(ctx context.Context, id, customer string, amount int64) error
+	orders(ctx context.Context) ([]string, error)
+	// cleanUp removes the sent messages and returns how many there were.
+	cleanUp(ctx context.Context) (int64, error)
+	Close() error
+}
+
+// crashingStore fails to mark the next message as sent once crash is set,
+// as if the relay died right after publishing it.
+type crashingStore struct {
+	outbox.Store
+	mu    sync.Mutex
+	crash bool
+}
+
+func (s *crashingStore) MarkSent(ctx context.Context, ids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.crash {
+		s.crash = false
+		return errors.New("relay crashed before marking the message")
+	}
+	return s.Store.MarkSent(ctx, ids...)
+}
+
+func main() {
+	driver := flag.String("driver", "", "database/sql driver to use; without one, the orders and the outbox are kept in memory")
+	dsn := flag.String("dsn", "", "data source name, a temporary SQLite file by default")
+	flag.Parse()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var db shop = newMemoryShop()
+	if *driver != "" {
+		if !registered(*driver) {
+			fmt.Printf("No %q driver is compiled in (have: %s).\n", *driver, strings.Join(sql.Drivers(), ", "))
+			fmt.Println(`For SQLite, add a file with import _ "modernc.org/sqlite", run go get modernc.org/sqlite and go run . -driver sqlite`)
+			return
+		}
+		var err error
+		if db, err = openSQLShop(ctx, *driver, *dsn); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	defer db.Close()
+
+	// The consumer is idempotent: the relay delivers at least once, and
+	// publishes every message with its ID, so copies are dropped before
+	// they reach the handler.
+	bus := eventbus.NewEventBus()
+	dedup := idempotency.New(idempotency.NewMemoryStore(0), time.Hour)
+	bus.Register("order.placed", eventbus.DefaultPriority, eventbus.Deduplicate(dedup, "shipping", func(e eventbus.Event) error {
+		var event OrderPlaced
+		if err := json.Unmarshal(e.Data.(json.RawMessage), &event); err != nil {
+			return err
+		}
+		fmt.Printf("  consumer: %s placed %s for %d\n", event.Customer, event.OrderID, event.Amount)
+		return nil
+	}))
+
+	crashing := &crashingStore{Store: db}
+	relay := outbox.NewRelay(crashing, bus, 20*time.Millisecond)
+	go relay.Run(ctx)
+
+	place := func(id, customer string, amount int64) {
+		if err := db.place(ctx, id, customer, amount); err != nil {
+			fmt.Printf("%s: not placed: %v\n", id, err)
+			return
+		}
+		fmt.Printf("%s: placed\n", id)
+	}
+
+	place("order-1", "alice", 25_00)
+	place("order-2", "bob", 0)
+	place("order-1", "carol", 10_00)
+	time.Sleep(100 * time.Millisecond)
+
+	fmt.Println("The relay crashes after publishing the next message.")
+	crashing.mu.Lock()
+	crashing.crash = true
+	crashing.mu.Unlock()
+	place("order-3", "dave", 40_00)
+	time.Sleep(100 * time.Millisecond)
+
+	cancel()
+	orders, err := db.orders(context.Background())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	deleted, err := db.cleanUp(context.Background())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("orders stored: %v, messages published: %d, duplicates dropped: %d, sent messages cleaned up: %d\n",
+		orders, relay.Published(), dedup.Stats().Duplicates, deleted)
+}
@@ -0,0 +1,119 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/rajamummidi/go-design-patterns/outbox/outbox"
+)
+
+// memoryShop keeps the orders and the outbox in memory, the way the
+// services of the microservices example do. One lock stands in for the
+// database transaction.
+type memoryShop struct {
+	mu     sync.Mutex
+	rows   map[string]OrderPlaced
+	outbox outbox.Table
+	sent   int64
+}
+
+func newMemoryShop() *memoryShop {
+	return &memoryShop{rows: make(map[string]OrderPlaced)}
+}
+
+// place stores the order and its event under one lock: either both are
+// stored or neither is.
+func (s *memoryShop) place(ctx context.Context, id, customer string, amount int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rows[id]; ok {
+		return fmt.Errorf("order %s already exists", id)
+	}
+	if amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	msg := placed(id, customer, amount)
+	// The data is kept as JSON, as SQLStore keeps it, so the consumer sees
+	// the same event whichever shop the demo runs on.
+	data, err := json.Marshal(msg.Data)
+	if err != nil {
+		return err
+	}
+	s.rows[id] = msg.Data.(OrderPlaced)
+	msg.Data = json.RawMessage(data)
+	s.outbox.Add(msg)
+	return nil
+}
+
+func (s *memoryShop) orders(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	orders := make([]string, 0, len(s.rows))
+	for id := range s.rows {
+		orders = append(orders, id)
+	}
+	sort.Strings(orders)
+	return orders, nil
+}
+
+func (s *memoryShop) Pending(ctx context.Context, limit int) ([]outbox.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.outbox.Pending(limit), nil
+}
+
+func (s *memoryShop) MarkSent(ctx context.Context, ids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before := s.outbox.Len()
+	s.outbox.MarkSent(ids...)
+	s.sent += int64(before - s.outbox.Len())
+	return nil
+}
+
+// cleanUp reports the messages sent since the last call. Table drops them
+// as soon as they are marked, so there is nothing left to delete.
+func (s *memoryShop) cleanUp(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sent := s.sent
+	s.sent = 0
+	return sent, nil
+}
+
+func (s *memoryShop) Close() error {
+	return nil
+}
@@ -0,0 +1,71 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package outbox
+
+import "time"
+
+// Table is an outbox kept in memory next to a service's other tables. It
+// does no locking of its own: the service adds to it under the same lock
+// that guards the change, which is what makes the two one transaction.
+type Table struct {
+	messages []Message
+}
+
+func (t *Table) Add(msg Message) {
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+	t.messages = append(t.messages, msg)
+}
+
+// Len returns the number of unsent messages.
+func (t *Table) Len() int {
+	return len(t.messages)
+}
+
+func (t *Table) Pending(limit int) []Message {
+	if limit > len(t.messages) {
+		limit = len(t.messages)
+	}
+	return append([]Message(nil), t.messages[:limit]...)
+}
+
+func (t *Table) MarkSent(ids ...string) {
+	sent := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		sent[id] = true
+	}
+	kept := t.messages[:0]
+	for _, msg := range t.messages {
+		if !sent[msg.ID] {
+			kept = append(kept, msg)
+		}
+	}
+	t.messages = kept
+}
@@ -0,0 +1,148 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package outbox implements the transactional outbox: a service stores the
+// messages it wants to send in the same transaction as the change that
+// caused them, and a relay publishes them afterwards. A message is never
+// sent for a change that was rolled back, and never lost for one that was
+// committed. The price is that a message may be published more than once,
+// if the relay stops between publishing it and marking it sent, so
+// consumers must be idempotent.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Message is a message waiting in the outbox. ID must be unique and is
+// expected to travel with the payload, so consumers can recognize a message
+// delivered twice.
+type Message struct {
+	ID        string
+	Topic     string
+	Data      interface{}
+	CreatedAt time.Time
+}
+
+// Store is the outbox table of a service.
+type Store interface {
+	// Pending returns up to limit unsent messages, oldest first.
+	Pending(ctx context.Context, limit int) ([]Message, error)
+	MarkSent(ctx context.Context, ids ...string) error
+}
+
+// Publisher is where the relay publishes to, usually an EventBus, possibly
+// with a bridge forwarding the topics to a broker.
+type Publisher interface {
+	Dispatch(eventType string, data interface{}) error
+}
+
+// IDPublisher is a Publisher that can also pass the ID of a message along
+// with it, as an EventBus can. The relay then publishes every message with
+// its ID, so consumers can recognize the copies without an ID in the
+// payload.
+type IDPublisher interface {
+	Publisher
+	DispatchWithID(id, eventType string, data interface{}) error
+}
+
+// Relay moves messages from a Store to a Publisher.
+type Relay struct {
+	store     Store
+	publisher Publisher
+	interval  time.Duration
+
+	// BatchSize is how many messages are read from the store at once (100).
+	BatchSize int
+
+	mu        sync.Mutex // one pass at a time, so messages keep their order
+	published uint64
+}
+
+// NewRelay returns a relay that polls store every interval.
+func NewRelay(store Store, publisher Publisher, interval time.Duration) *Relay {
+	return &Relay{store: store, publisher: publisher, interval: interval, BatchSize: 100}
+}
+
+// Run polls the store until ctx is done.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Flush(ctx); err != nil && ctx.Err() == nil {
+				fmt.Printf("Outbox relay: %v\n", err)
+			}
+		}
+	}
+}
+
+// Flush publishes every pending message. It stops at the first message that
+// cannot be published or marked, which is tried again on the next pass.
+func (r *Relay) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for {
+		batch, err := r.store.Pending(ctx, r.BatchSize)
+		if err != nil || len(batch) == 0 {
+			return err
+		}
+		for _, msg := range batch {
+			if err := r.publish(msg); err != nil {
+				return fmt.Errorf("publishing %s: %w", msg.ID, err)
+			}
+			// Marking each message on its own keeps the window in which a
+			// crash causes a duplicate down to one message.
+			if err := r.store.MarkSent(ctx, msg.ID); err != nil {
+				return fmt.Errorf("marking %s as sent: %w", msg.ID, err)
+			}
+			r.published++
+		}
+	}
+}
+
+func (r *Relay) publish(msg Message) error {
+	if publisher, ok := r.publisher.(IDPublisher); ok {
+		return publisher.DispatchWithID(msg.ID, msg.Topic, msg.Data)
+	}
+	return r.publisher.Dispatch(msg.Topic, msg.Data)
+}
+
+// Published returns how many messages the relay has published.
+func (r *Relay) Published() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.published
+}
@@ -0,0 +1,161 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Execer is what Add needs to insert a message: a *sql.Tx, so the message
+// is written in the same transaction as the change that caused it.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// SQLStore keeps the outbox in a table of a SQL database, next to the
+// tables of the domain. The statements work on SQLite and PostgreSQL.
+//
+// Only one relay should read a store at a time. Two relays would publish
+// every message twice, which consumers survive but do not need.
+type SQLStore struct {
+	db    *sql.DB
+	table string
+
+	// Placeholder renders the nth parameter of a statement, counting from
+	// 1. It renders question marks, as SQLite wants, unless set to Dollar
+	// for PostgreSQL.
+	Placeholder func(n int) string
+}
+
+// NewSQLStore returns a store for the outbox in table.
+func NewSQLStore(db *sql.DB, table string) *SQLStore {
+	return &SQLStore{db: db, table: table, Placeholder: func(int) string { return "?" }}
+}
+
+// Dollar renders PostgreSQL placeholders: $1, $2 and so on.
+func Dollar(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// CreateTable creates the outbox table and its index if they do not exist.
+// Times are stored as Unix nanoseconds, which every database can compare.
+func (s *SQLStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id         TEXT PRIMARY KEY,
+	topic      TEXT NOT NULL,
+	payload    TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	sent_at    BIGINT
+)`, s.table))
+	if err != nil {
+		return err
+	}
+	// The relay only ever looks for unsent messages, so the index only
+	// holds those and stays small however many sent rows are kept.
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf(
+		`CREATE INDEX IF NOT EXISTS %[1]s_unsent ON %[1]s (created_at) WHERE sent_at IS NULL`, s.table))
+	return err
+}
+
+// Add inserts msg into the outbox through tx. The data is stored as JSON.
+func (s *SQLStore) Add(ctx context.Context, tx Execer, msg Message) error {
+	payload, err := json.Marshal(msg.Data)
+	if err != nil {
+		return fmt.Errorf("outbox: encoding %s: %w", msg.ID, err)
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (id, topic, payload, created_at) VALUES (%s, %s, %s, %s)`,
+		s.table, s.Placeholder(1), s.Placeholder(2), s.Placeholder(3), s.Placeholder(4)),
+		msg.ID, msg.Topic, string(payload), msg.CreatedAt.UnixNano())
+	return err
+}
+
+// Pending returns the oldest unsent messages. Their data is the stored
+// JSON, as a json.RawMessage.
+func (s *SQLStore) Pending(ctx context.Context, limit int) ([]Message, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(
+		`SELECT id, topic, payload, created_at FROM %s WHERE sent_at IS NULL ORDER BY created_at, id LIMIT %s`,
+		s.table, s.Placeholder(1)), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var (
+			msg       Message
+			payload   string
+			createdAt int64
+		)
+		if err := rows.Scan(&msg.ID, &msg.Topic, &payload, &createdAt); err != nil {
+			return nil, err
+		}
+		msg.Data = json.RawMessage(payload)
+		msg.CreatedAt = time.Unix(0, createdAt)
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+func (s *SQLStore) MarkSent(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := []interface{}{time.Now().UnixNano()}
+	params := make([]string, len(ids))
+	for i, id := range ids {
+		args = append(args, id)
+		params[i] = s.Placeholder(i + 2)
+	}
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		`UPDATE %s SET sent_at = %s WHERE id IN (%s)`,
+		s.table, s.Placeholder(1), strings.Join(params, ", ")), args...)
+	return err
+}
+
+// DeleteSent removes the messages sent before t and returns how many there
+// were. Sent rows are kept until then to help with debugging.
+func (s *SQLStore) DeleteSent(ctx context.Context, t time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		`DELETE FROM %s WHERE sent_at IS NOT NULL AND sent_at < %s`, s.table, s.Placeholder(1)), t.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,153 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/outbox/outbox"
+)
+
+// sqlShop keeps the orders and the outbox in tables of a database/sql
+// database.
+type sqlShop struct {
+	*outbox.SQLStore
+	db  *sql.DB
+	dir string // temporary directory of the default SQLite file
+}
+
+// openSQLShop opens the database and creates the tables. An empty dsn
+// means a SQLite file in a temporary directory.
+func openSQLShop(ctx context.Context, driver, dsn string) (*sqlShop, error) {
+	s := &sqlShop{}
+	if dsn == "" {
+		dir, err := os.MkdirTemp("", "outbox")
+		if err != nil {
+			return nil, err
+		}
+		s.dir = dir
+		dsn = filepath.Join(dir, "shop.db")
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.db = db
+	// SQLite has a single writer; one connection keeps the relay from
+	// running into the locks of an open transaction.
+	db.SetMaxOpenConns(1)
+
+	s.SQLStore = outbox.NewSQLStore(db, "outbox")
+	if err := s.CreateTable(ctx); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS orders (
+	id       TEXT PRIMARY KEY,
+	customer TEXT NOT NULL,
+	amount   BIGINT NOT NULL
+)`); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// place inserts the order and its event in one transaction: either both
+// are stored or neither is.
+func (s *sqlShop) place(ctx context.Context, id, customer string, amount int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO orders (id, customer, amount) VALUES (?, ?, ?)`, id, customer, amount); err != nil {
+		return err
+	}
+	if amount <= 0 {
+		// Rejected after the insert: the rollback takes the order back, and
+		// the event never reaches the outbox.
+		return errors.New("amount must be positive")
+	}
+	if err := s.Add(ctx, tx, placed(id, customer, amount)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlShop) orders(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM orders`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var orders []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		orders = append(orders, id)
+	}
+	sort.Strings(orders)
+	return orders, rows.Err()
+}
+
+func (s *sqlShop) cleanUp(ctx context.Context) (int64, error) {
+	return s.DeleteSent(ctx, time.Now())
+}
+
+func (s *sqlShop) Close() error {
+	var err error
+	if s.db != nil {
+		err = s.db.Close()
+	}
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+	}
+	return err
+}
+
+func registered(driver string) bool {
+	for _, name := range sql.Drivers() {
+		if name == driver {
+			return true
+		}
+	}
+	return false
+}
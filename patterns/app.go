@@ -0,0 +1,104 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/patterns/cookbook"
+)
+
+const usage = `Usage:
+  patterns list                   list the scenarios
+  patterns demo <scenario>...     run scenarios and check their outcomes
+  patterns demo all               run every scenario
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+
+	switch flag.Arg(0) {
+	case "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, s := range cookbook.Scenarios() {
+			fmt.Fprintf(w, "%s\t%s\n", s.Name, s.Description)
+		}
+		w.Flush()
+	case "demo":
+		names := flag.Args()[1:]
+		if len(names) == 1 && names[0] == "all" {
+			names = nil
+			for _, s := range cookbook.Scenarios() {
+				names = append(names, s.Name)
+			}
+		}
+		if len(names) == 0 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		if !demo(names) {
+			os.Exit(1)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// demo runs the scenarios and reports whether all their checks passed.
+func demo(names []string) bool {
+	passed := true
+	var checks, failures int
+	var elapsed time.Duration
+	for _, name := range names {
+		fmt.Printf("=== %s\n", name)
+		result, err := cookbook.Run(name, os.Stdout)
+		if err != nil {
+			fmt.Printf("%v (see patterns list)\n", err)
+			passed = false
+			continue
+		}
+		status := "PASS"
+		if result.Failures > 0 {
+			status = "FAIL"
+			passed = false
+		}
+		fmt.Printf("--- %s %s: %d checks, %d failed (%s)\n\n", status, name, result.Checks, result.Failures, result.Duration.Round(time.Millisecond))
+		checks += result.Checks
+		failures += result.Failures
+		elapsed += result.Duration
+	}
+	fmt.Printf("%d scenarios, %d checks, %d failed in %s\n", len(names), checks, failures, elapsed.Round(time.Millisecond))
+	return passed
+}
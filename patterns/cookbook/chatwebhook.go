@@ -0,0 +1,242 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package cookbook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/circuit-breaker/circuitbreaker"
+	"github.com/rajamummidi/go-design-patterns/decorator/decorator"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventstore"
+	"github.com/rajamummidi/go-design-patterns/pubsub/pubsub"
+)
+
+func init() {
+	Register(Scenario{
+		Name:        "chat-webhook",
+		Description: "chat messages are persisted, and mentions of @ops reach a flaky webhook through a circuit breaker",
+		Run:         chatWebhook,
+	})
+}
+
+// ChatMessage is a message posted in a chat room.
+type ChatMessage struct {
+	Room string `json:"room"`
+	Nick string `json:"nick"`
+	Text string `json:"text"`
+}
+
+// Notification is what the webhook receives for a mention.
+type Notification struct {
+	ID      string `json:"id"`
+	Room    string `json:"room"`
+	Message string `json:"message"`
+}
+
+// chatWebhook wires an event bus, an event store, a pub/sub broker and a
+// circuit breaker behind a decorated HTTP client:
+//
+//	bus --room.*.message--> persist --> event store
+//	    \-> notify --notifications--> broker --> webhook consumer --> breaker --> webhook
+//
+// The webhook fails its first calls, like a service being redeployed. The
+// broker redelivers what failed, the breaker keeps the consumer from
+// hammering the webhook meanwhile, and every mention arrives in the end.
+func chatWebhook(t *T) {
+	dir, err := os.MkdirTemp("", "cookbook")
+	if err != nil {
+		t.Fatalf("creating a directory for the event store: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "chat.jsonl")
+	store, err := eventstore.OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("opening the event store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	// The webhook answers its first three calls with 503.
+	var calls atomic.Int64
+	var mu sync.Mutex
+	received := make(map[string]Notification)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 3 {
+			http.Error(w, "restarting", http.StatusServiceUnavailable)
+			return
+		}
+		var n Notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		received[n.ID] = n
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(webhook.Close)
+	host, _ := url.Parse(webhook.URL)
+
+	breakers := circuitbreaker.NewRegistry(circuitbreaker.Config{MinRequests: 2, OpenTimeout: 100 * time.Millisecond})
+	var opened atomic.Int64
+	breakers.OnStateChange(func(name string, from, to circuitbreaker.State) {
+		t.Logf("breaker %s: %s -> %s", name, from, to)
+		if to == circuitbreaker.Open {
+			opened.Add(1)
+		}
+	})
+	client := &http.Client{
+		Timeout:   time.Second,
+		Transport: decorator.ChainTransport(nil, circuitbreaker.TransportMiddleware(breakers, circuitbreaker.ByHost)),
+	}
+
+	broker := pubsub.New()
+	t.Cleanup(broker.Close)
+	consumer, err := broker.Subscribe("notifications", "webhook", pubsub.SubscriptionConfig{
+		VisibilityTimeout: time.Second,
+		MaxAttempts:       20,
+		DeadLetterTopic:   "notifications.dead",
+	})
+	if err != nil {
+		t.Fatalf("subscribing to notifications: %v", err)
+	}
+	dead, err := broker.Subscribe("notifications.dead", "audit", pubsub.SubscriptionConfig{})
+	if err != nil {
+		t.Fatalf("subscribing to dead letters: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go consumer.Consume(ctx, func(msg pubsub.Message) error {
+		err := postNotification(ctx, client, webhook.URL, msg.Data.(Notification))
+		if err != nil {
+			t.Logf("attempt %d to deliver %s failed: %v", msg.Attempt, msg.Data.(Notification).ID, err)
+			// Give the webhook a moment before the broker redelivers.
+			time.Sleep(30 * time.Millisecond)
+		}
+		return err
+	})
+
+	bus := eventbus.NewEventBus()
+	bus.Register("room.*.message", eventbus.DefaultPriority, func(event eventbus.Event) error {
+		msg := event.Data.(ChatMessage)
+		_, err := store.Append("room-"+msg.Room, eventstore.AnyVersion, "message", msg)
+		return err
+	})
+	var mentions atomic.Int64
+	bus.Register("room.*.message", eventbus.DefaultPriority, func(event eventbus.Event) error {
+		msg := event.Data.(ChatMessage)
+		if !strings.Contains(msg.Text, "@ops") {
+			return nil
+		}
+		id := fmt.Sprintf("mention-%d", mentions.Add(1))
+		_, err := broker.Publish("notifications", Notification{ID: id, Room: msg.Room, Message: msg.Nick + ": " + msg.Text})
+		return err
+	})
+
+	script := []ChatMessage{
+		{"incidents", "alice", "checkout is throwing 500s"},
+		{"incidents", "alice", "@ops can someone look at checkout?"},
+		{"incidents", "bob", "looking"},
+		{"incidents", "bob", "@ops rolling back the last deploy"},
+		{"incidents", "alice", "@ops errors are gone, thanks"},
+	}
+	for _, msg := range script {
+		t.Logf("%s in #%s: %s", msg.Nick, msg.Room, msg.Text)
+		if err := bus.Dispatch("room."+msg.Room+".message", msg); err != nil {
+			t.Fatalf("dispatching: %v", err)
+		}
+	}
+
+	records, err := store.Load("room-incidents", 0)
+	t.Check(err == nil && len(records) == len(script), "all %d messages were persisted (got %d, err %v)", len(script), len(records), err)
+	t.Check(Eventually(5*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 3
+	}), "the webhook received all 3 mentions of @ops although its first %d calls failed", 3)
+	t.Check(opened.Load() > 0, "the breaker opened while the webhook was failing")
+	t.Check(breakers.Get(host.Host).State() == circuitbreaker.Closed, "the breaker closed again once the webhook recovered")
+	stats := consumer.Stats()
+	t.Check(stats.Acked == 3 && stats.DeadLettered == 0 && dead.Stats().Backlog == 0,
+		"every notification was acknowledged and none was dead-lettered (%d deliveries for 3 notifications)", stats.Delivered)
+
+	// The history outlives the process that wrote it.
+	store.Close()
+	reopened, err := eventstore.OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("reopening the event store: %v", err)
+	}
+	t.Cleanup(func() { reopened.Close() })
+	var replayed []ChatMessage
+	err = eventstore.Replay(reopened, "room-incidents", 0, func(r eventstore.Record) error {
+		var msg ChatMessage
+		err := r.Decode(&msg)
+		replayed = append(replayed, msg)
+		return err
+	})
+	t.Check(err == nil && len(replayed) == len(script) && replayed[len(replayed)-1] == script[len(script)-1],
+		"the room's history is replayed in order from the reopened store")
+}
+
+// postNotification sends n to the webhook. The breaker's transport counts
+// 5xx responses as failures but returns them, so they are turned into
+// errors here.
+func postNotification(ctx context.Context, client *http.Client, url string, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
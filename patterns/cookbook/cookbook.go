@@ -0,0 +1,188 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package cookbook holds scenarios that wire several modules of this
+// repository together, run a scripted interaction and check what can be
+// observed from outside. They are executable documentation: each one shows
+// how patterns compose, and fails loudly when they stop composing.
+package cookbook
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrUnknown is returned by Run for a scenario that was not registered.
+var ErrUnknown = errors.New("cookbook: unknown scenario")
+
+// Scenario is a scripted interaction between several modules.
+type Scenario struct {
+	Name        string
+	Description string
+	Run         func(t *T)
+}
+
+var (
+	mu        sync.Mutex
+	scenarios = make(map[string]Scenario)
+)
+
+// Register adds a scenario. It panics if the name is taken, as that is a
+// programming error.
+func Register(s Scenario) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := scenarios[s.Name]; ok {
+		panic("cookbook: Register called twice for " + s.Name)
+	}
+	scenarios[s.Name] = s
+}
+
+// Scenarios returns the registered scenarios sorted by name.
+func Scenarios() []Scenario {
+	mu.Lock()
+	defer mu.Unlock()
+
+	list := make([]Scenario, 0, len(scenarios))
+	for _, s := range scenarios {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Result sums up a run of a scenario.
+type Result struct {
+	Checks   int
+	Failures int
+	Duration time.Duration
+}
+
+// Run runs the scenario name, writing its log and checks to out.
+func Run(name string, out io.Writer) (Result, error) {
+	mu.Lock()
+	s, ok := scenarios[name]
+	mu.Unlock()
+	if !ok {
+		return Result{}, fmt.Errorf("%w: %s", ErrUnknown, name)
+	}
+
+	t := &T{out: out}
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer t.cleanup()
+		s.Run(t)
+	}()
+	<-done
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Result{Checks: t.checks, Failures: t.failures, Duration: time.Since(start)}, nil
+}
+
+// T is handed to a running scenario, like testing.T to a test. Its methods
+// may be called from any goroutine, except Fatalf.
+type T struct {
+	out io.Writer
+
+	mu       sync.Mutex
+	checks   int
+	failures int
+	cleanups []func()
+}
+
+// Logf writes a line of narration.
+func (t *T) Logf(format string, args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.out, "      "+format+"\n", args...)
+}
+
+// Check records an expected outcome and whether it was observed, and
+// returns ok.
+func (t *T) Check(ok bool, format string, args ...interface{}) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.checks++
+	status := "ok  "
+	if !ok {
+		t.failures++
+		status = "FAIL"
+	}
+	fmt.Fprintf(t.out, "%s  "+format+"\n", append([]interface{}{status}, args...)...)
+	return ok
+}
+
+// Fatalf records a failure that makes the rest of the scenario pointless,
+// such as a component that cannot be set up, and stops the scenario. It
+// must be called from the scenario's goroutine.
+func (t *T) Fatalf(format string, args ...interface{}) {
+	t.Check(false, format, args...)
+	runtime.Goexit()
+}
+
+// Cleanup registers fn to run when the scenario ends, last registered
+// first.
+func (t *T) Cleanup(fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cleanups = append(t.cleanups, fn)
+}
+
+func (t *T) cleanup() {
+	t.mu.Lock()
+	cleanups := t.cleanups
+	t.cleanups = nil
+	t.mu.Unlock()
+
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+}
+
+// Eventually polls cond until it holds or timeout passes, for outcomes
+// that other goroutines bring about, and reports whether it held.
+func Eventually(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package cookbook
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+)
+
+func init() {
+	Register(Scenario{
+		Name:        "expiring-events",
+		Description: "events with a TTL are purged from a stuck queue instead of being delivered late",
+		Run:         expiringEvents,
+	})
+}
+
+// expiringEvents blocks the only worker of a queued bus and publishes
+// price ticks that are worthless after 50ms. By the time the worker is
+// free they have expired: they are purged rather than delivered late, and
+// the next fresh tick goes straight through.
+func expiringEvents(t *T) {
+	bus, err := eventbus.New(eventbus.WithQueue(10, 1))
+	if err != nil {
+		t.Fatalf("creating the bus: %v", err)
+	}
+	t.Cleanup(func() { bus.Close(context.Background()) })
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	bus.Register("jobs.slow", eventbus.DefaultPriority, func(eventbus.Event) error {
+		close(started)
+		<-unblock
+		return nil
+	})
+	var mu sync.Mutex
+	var delivered []int
+	bus.Register("prices.tick", eventbus.DefaultPriority, func(event eventbus.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		delivered = append(delivered, event.Data.(int))
+		return nil
+	})
+	ticks := func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), delivered...)
+	}
+
+	bus.Dispatch("jobs.slow", nil)
+	<-started
+	t.Logf("the only worker is busy")
+	for price := 100; price < 105; price++ {
+		bus.DispatchWithTTL("prices.tick", price, 50*time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	t.Check(bus.QueueDepth() == 5, "5 ticks are queued behind the busy worker (depth %d)", bus.QueueDepth())
+	purged := bus.PurgeExpired()
+	t.Check(purged == 5, "all 5 ticks expired and were purged (%d purged)", purged)
+	t.Check(bus.QueueDepth() == 0, "the queue is empty again")
+
+	close(unblock)
+	bus.DispatchWithTTL("prices.tick", 200, time.Second)
+	t.Check(Eventually(time.Second, func() bool { return len(ticks()) == 1 }),
+		"a fresh tick is delivered once the worker is free")
+	got := ticks()
+	t.Check(len(got) == 1 && got[0] == 200, "no stale tick was delivered: %v", got)
+	stats := bus.Stats().Topics["prices.tick"]
+	t.Check(stats.Published == 6 && stats.Expired == 5, "the bus counts 6 ticks published and 5 expired")
+}
@@ -0,0 +1,131 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package cookbook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/outbox/outbox"
+)
+
+func init() {
+	Register(Scenario{
+		Name:        "outbox-relay",
+		Description: "orders are saved with their events in one step, and the relay publishes them once the topic exists",
+		Run:         outboxRelay,
+	})
+}
+
+// OrderPlaced is published for every order.
+type OrderPlaced struct {
+	ID    string `json:"id"`
+	Total int    `json:"total"`
+}
+
+// orderService keeps its orders and its outbox under one lock, so placing
+// an order and queueing its event cannot be separated.
+type orderService struct {
+	mu     sync.Mutex
+	orders map[string]int
+	outbox outbox.Table
+}
+
+func (s *orderService) place(id string, total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orders[id] = total
+	s.outbox.Add(outbox.Message{ID: id, Topic: "orders.placed", Data: OrderPlaced{id, total}})
+}
+
+// Pending and MarkSent make the service its own outbox.Store.
+func (s *orderService) Pending(ctx context.Context, limit int) ([]outbox.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.outbox.Pending(limit), nil
+}
+
+func (s *orderService) MarkSent(ctx context.Context, ids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outbox.MarkSent(ids...)
+	return nil
+}
+
+func (s *orderService) pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.outbox.Len()
+}
+
+// outboxRelay places orders while the bus refuses their topic, as it does
+// when a service is deployed before the topic is provisioned. The events
+// wait in the outbox instead of being lost, and the relay publishes them
+// in order once the topic is created.
+func outboxRelay(t *T) {
+	bus, err := eventbus.New(eventbus.WithDefaultDeny())
+	if err != nil {
+		t.Fatalf("creating the bus: %v", err)
+	}
+	service := &orderService{orders: make(map[string]int)}
+	relay := outbox.NewRelay(service, bus, 0)
+	ctx := context.Background()
+
+	for i, total := range []int{1200, 450, 3099} {
+		id := fmt.Sprintf("order-%d", i+1)
+		t.Logf("placing %s for %d", id, total)
+		service.place(id, total)
+	}
+
+	err = relay.Flush(ctx)
+	t.Logf("relay: %v", err)
+	t.Check(errors.Is(err, eventbus.ErrUnknownTopic), "publishing fails while orders.placed does not exist")
+	t.Check(service.pending() == 3, "the 3 events wait in the outbox (%d pending)", service.pending())
+
+	if err := bus.CreateTopic("orders.placed", eventbus.TopicConfig{}); err != nil {
+		t.Fatalf("creating orders.placed: %v", err)
+	}
+	t.Logf("created topic orders.placed")
+	var received []string
+	bus.Register("orders.placed", eventbus.DefaultPriority, func(event eventbus.Event) error {
+		received = append(received, event.Data.(OrderPlaced).ID)
+		return nil
+	})
+
+	err = relay.Flush(ctx)
+	t.Check(err == nil, "the relay publishes once the topic exists (err %v)", err)
+	t.Check(fmt.Sprint(received) == "[order-1 order-2 order-3]", "the subscriber got the orders in the order they were placed: %v", received)
+	t.Check(relay.Published() == 3 && service.pending() == 0, "the relay published 3 events and emptied the outbox")
+
+	err = relay.Flush(ctx)
+	t.Check(err == nil && len(received) == 3, "flushing again publishes nothing twice")
+}
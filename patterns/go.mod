@@ -0,0 +1,39 @@
+module github.com/rajamummidi/go-design-patterns/patterns
+
+go 1.21
+
+require (
+	github.com/rajamummidi/go-design-patterns/circuit-breaker v0.0.0
+	github.com/rajamummidi/go-design-patterns/decorator v0.0.0
+	github.com/rajamummidi/go-design-patterns/event-driven-architecture v0.0.0
+	github.com/rajamummidi/go-design-patterns/outbox v0.0.0
+	github.com/rajamummidi/go-design-patterns/pubsub v0.0.0
+)
+
+require (
+	github.com/rajamummidi/go-design-patterns/future v0.0.0 // indirect
+	github.com/rajamummidi/go-design-patterns/state-machine v0.0.0 // indirect
+)
+
+replace (
+	github.com/rajamummidi/go-design-patterns/bulkhead => ../bulkhead
+	github.com/rajamummidi/go-design-patterns/circuit-breaker => ../circuit-breaker
+	github.com/rajamummidi/go-design-patterns/config => ../config
+	github.com/rajamummidi/go-design-patterns/decorator => ../decorator
+	github.com/rajamummidi/go-design-patterns/event-driven-architecture => ../event-driven-architecture
+	github.com/rajamummidi/go-design-patterns/future => ../future
+	github.com/rajamummidi/go-design-patterns/golden => ../golden
+	github.com/rajamummidi/go-design-patterns/health => ../health
+	github.com/rajamummidi/go-design-patterns/idempotency => ../idempotency
+	github.com/rajamummidi/go-design-patterns/leader-election => ../leader-election
+	github.com/rajamummidi/go-design-patterns/leakcheck => ../leakcheck
+	github.com/rajamummidi/go-design-patterns/lifecycle => ../lifecycle
+	github.com/rajamummidi/go-design-patterns/observability => ../observability
+	github.com/rajamummidi/go-design-patterns/otlp => ../otlp
+	github.com/rajamummidi/go-design-patterns/outbox => ../outbox
+	github.com/rajamummidi/go-design-patterns/proxy => ../proxy
+	github.com/rajamummidi/go-design-patterns/pubsub => ../pubsub
+	github.com/rajamummidi/go-design-patterns/rate-limiter => ../rate-limiter
+	github.com/rajamummidi/go-design-patterns/resp => ../resp
+	github.com/rajamummidi/go-design-patterns/state-machine => ../state-machine
+)
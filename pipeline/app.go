@@ -0,0 +1,114 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/pipeline/pipeline"
+)
+
+var documents = []string{
+	"the quick brown fox",
+	"jumps over the lazy dog",
+	"go channels compose well",
+	"pipelines fan out and fan in",
+	"cancel the whole pipeline on error",
+	"generics keep the stages typed",
+}
+
+// latencies are how long each document takes to download.
+var latencies = []time.Duration{50, 10, 40, 20, 30, 10}
+
+// fetch pretends to download a document.
+func fetch(ctx context.Context, id int) (string, error) {
+	select {
+	case <-time.After(latencies[id] * time.Millisecond):
+		return documents[id], nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+type count struct {
+	text  string
+	words int
+}
+
+func countWords(ctx context.Context, text string) (count, error) {
+	return count{text, len(strings.Fields(text))}, nil
+}
+
+func run(name string, opts ...pipeline.Option) {
+	start := time.Now()
+	p := pipeline.New(context.Background())
+
+	ids := pipeline.Source(p, 0, 1, 2, 3, 4, 5)
+	texts := pipeline.Map(p, ids, fetch, opts...)
+	counts := pipeline.Map(p, texts, countWords)
+
+	results, err := pipeline.Collect(p, counts)
+	if err != nil {
+		fmt.Println(name, "failed:", err)
+		return
+	}
+	fmt.Printf("%s (%v):\n", name, time.Since(start).Round(10*time.Millisecond))
+	for _, r := range results {
+		fmt.Printf("  %d words  %s\n", r.words, r.text)
+	}
+}
+
+func main() {
+	run("one worker")
+	run("three workers, unordered", pipeline.Workers(3))
+	run("three workers, ordered", pipeline.Workers(3), pipeline.Ordered())
+
+	// An error in any stage cancels every other one.
+	p := pipeline.New(context.Background())
+	ids := pipeline.Source(p, 0, 1, 2, 3, 4, 5)
+	checked := pipeline.Map(p, ids, func(ctx context.Context, id int) (int, error) {
+		if id == 3 {
+			return 0, errors.New("document 3 is corrupt")
+		}
+		return id, nil
+	})
+	texts := pipeline.Map(p, checked, fetch, pipeline.Workers(2))
+	results, err := pipeline.Collect(p, texts)
+	fmt.Printf("with a failing stage: %d results before the error: %v\n", len(results), err)
+
+	// Fan-in of two independent sources.
+	p = pipeline.New(context.Background())
+	merged := pipeline.Merge(p, pipeline.Source(p, "a", "b", "c"), pipeline.Source(p, "1", "2", "3"))
+	all, _ := pipeline.Collect(p, merged)
+	fmt.Println("merged:", all)
+}
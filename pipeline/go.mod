@@ -0,0 +1,3 @@
+module github.com/rajamummidi/go-design-patterns/pipeline
+
+go 1.20
@@ -0,0 +1,269 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package pipeline builds pipelines of stages connected by channels. A
+// stage can run on several workers (fan-out) whose results are merged into
+// one channel again (fan-in), in input order or as they come. The first
+// error anywhere cancels the whole pipeline.
+package pipeline
+
+import (
+	"context"
+	"sync"
+)
+
+// Stage turns one input into one output. It should return promptly when
+// ctx is done.
+type Stage[In, Out any] func(ctx context.Context, in In) (Out, error)
+
+// Pipeline ties the goroutines of a pipeline together, much like an
+// errgroup: they share a context, the first error cancels it, and Wait
+// waits for all of them.
+type Pipeline struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	errOnce sync.Once
+	err     error
+}
+
+// New returns a pipeline whose context is derived from ctx. Cancelling ctx
+// stops the pipeline.
+func New(ctx context.Context) *Pipeline {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Pipeline{ctx: ctx, cancel: cancel}
+}
+
+// Context is cancelled when the pipeline fails or is stopped.
+func (p *Pipeline) Context() context.Context {
+	return p.ctx
+}
+
+// Stop cancels the pipeline without an error, for consumers that have seen
+// enough.
+func (p *Pipeline) Stop() {
+	p.errOnce.Do(p.cancel)
+}
+
+// Wait waits for every goroutine of the pipeline to finish and returns the
+// first error, or the context's error if the pipeline was cancelled from
+// outside.
+func (p *Pipeline) Wait() error {
+	p.wg.Wait()
+	p.fail(p.ctx.Err())
+	p.cancel()
+	return p.err
+}
+
+func (p *Pipeline) fail(err error) {
+	if err == nil {
+		return
+	}
+	p.errOnce.Do(func() {
+		p.err = err
+		p.cancel()
+	})
+}
+
+func (p *Pipeline) spawn(fn func()) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		fn()
+	}()
+}
+
+// send delivers v on out unless the pipeline is cancelled first.
+func send[T any](p *Pipeline, out chan<- T, v T) bool {
+	select {
+	case out <- v:
+		return true
+	case <-p.ctx.Done():
+		return false
+	}
+}
+
+type options struct {
+	workers int
+	ordered bool
+	buffer  int
+}
+
+// Option configures a stage added with Map.
+type Option func(*options)
+
+// Workers runs the stage on n goroutines.
+func Workers(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.workers = n
+		}
+	}
+}
+
+// Ordered makes a stage with several workers emit its results in the order
+// of its inputs. Results that finish early wait for the ones before them,
+// so one slow item holds up those behind it.
+func Ordered() Option {
+	return func(o *options) { o.ordered = true }
+}
+
+// Buffer gives the stage's output channel room for n results.
+func Buffer(n int) Option {
+	return func(o *options) { o.buffer = n }
+}
+
+// Source emits items and closes its channel.
+func Source[T any](p *Pipeline, items ...T) <-chan T {
+	out := make(chan T)
+	p.spawn(func() {
+		defer close(out)
+		for _, item := range items {
+			if !send(p, out, item) {
+				return
+			}
+		}
+	})
+	return out
+}
+
+type sequenced[T any] struct {
+	seq int
+	v   T
+}
+
+// Map adds a stage that applies stage to every value from in. Without
+// options it runs on one goroutine and keeps the order.
+func Map[In, Out any](p *Pipeline, in <-chan In, stage Stage[In, Out], opts ...Option) <-chan Out {
+	o := options{workers: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Number the inputs so that an ordered stage can restore their order.
+	jobs := make(chan sequenced[In])
+	p.spawn(func() {
+		defer close(jobs)
+		seq := 0
+		for v := range in {
+			if !send(p, jobs, sequenced[In]{seq, v}) {
+				return
+			}
+			seq++
+		}
+	})
+
+	// Fan out to the workers...
+	results := make(chan sequenced[Out])
+	var workers sync.WaitGroup
+	workers.Add(o.workers)
+	for i := 0; i < o.workers; i++ {
+		p.spawn(func() {
+			defer workers.Done()
+			for job := range jobs {
+				v, err := stage(p.ctx, job.v)
+				if err != nil {
+					p.fail(err)
+					return
+				}
+				if !send(p, results, sequenced[Out]{job.seq, v}) {
+					return
+				}
+			}
+		})
+	}
+	p.spawn(func() {
+		workers.Wait()
+		close(results)
+	})
+
+	// ...and fan back in.
+	out := make(chan Out, o.buffer)
+	p.spawn(func() {
+		defer close(out)
+		if !o.ordered || o.workers == 1 {
+			for r := range results {
+				if !send(p, out, r.v) {
+					return
+				}
+			}
+			return
+		}
+		pending := make(map[int]Out)
+		next := 0
+		for r := range results {
+			pending[r.seq] = r.v
+			for {
+				v, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+				if !send(p, out, v) {
+					return
+				}
+			}
+		}
+	})
+	return out
+}
+
+// Merge fans several channels into one, in no particular order.
+func Merge[T any](p *Pipeline, ins ...<-chan T) <-chan T {
+	out := make(chan T)
+	var wg sync.WaitGroup
+	wg.Add(len(ins))
+	for _, in := range ins {
+		in := in
+		p.spawn(func() {
+			defer wg.Done()
+			for v := range in {
+				if !send(p, out, v) {
+					return
+				}
+			}
+		})
+	}
+	p.spawn(func() {
+		wg.Wait()
+		close(out)
+	})
+	return out
+}
+
+// Collect reads everything from in and then waits for the pipeline. On
+// error it returns what was collected so far together with the error.
+func Collect[T any](p *Pipeline, in <-chan T) ([]T, error) {
+	var all []T
+	for v := range in {
+		all = append(all, v)
+	}
+	return all, p.Wait()
+}
@@ -0,0 +1,142 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/proxy/proxy"
+)
+
+// upstream stands in for a slow service that can start failing.
+type upstream struct {
+	requests atomic.Int64
+	failing  atomic.Bool
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := u.requests.Add(1)
+	time.Sleep(100 * time.Millisecond)
+	if u.failing.Load() {
+		http.Error(w, "upstream is down", http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "report #%d", n)
+}
+
+// serve serves h on a free local port and returns its URL.
+func serve(h http.Handler) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	go http.Serve(listener, h)
+	return "http://" + listener.Addr().String()
+}
+
+// get sends n concurrent requests as client and tallies the responses by
+// status and X-Cache header.
+func get(base, client string, n int) string {
+	var mu sync.Mutex
+	tally := map[string]int{}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodGet, base+"/report", nil)
+			req.Header.Set("X-Client", client)
+			outcome := "error"
+			if resp, err := http.DefaultClient.Do(req); err == nil {
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				outcome = fmt.Sprintf("%d %s", resp.StatusCode, resp.Header.Get("X-Cache"))
+			}
+			mu.Lock()
+			tally[strings.TrimSpace(outcome)]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	var parts []string
+	for outcome, count := range tally {
+		parts = append(parts, fmt.Sprintf("%dx %s", count, outcome))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+func main() {
+	service := &upstream{}
+	target, _ := url.Parse(serve(service))
+	p, err := proxy.New(proxy.Config{
+		Target:               target,
+		TTL:                  300 * time.Millisecond,
+		StaleWhileRevalidate: 500 * time.Millisecond,
+		StaleIfError:         5 * time.Second,
+		Rate:                 10,
+		Burst:                10,
+		ClientKey:            func(r *http.Request) string { return r.Header.Get("X-Client") },
+	})
+	if err != nil {
+		panic(err)
+	}
+	base := serve(p)
+
+	step := func(what, result string) {
+		fmt.Printf("%-44s %-28s upstream requests: %d\n", what, result, service.requests.Load())
+	}
+
+	step("10 clients ask at once", get(base, "alice", 10))
+	step("they ask again", get(base, "bob", 10))
+	time.Sleep(400 * time.Millisecond)
+	step("after the TTL", get(base, "carol", 1))
+	time.Sleep(200 * time.Millisecond)
+	step("after the background revalidation", get(base, "carol", 1))
+
+	service.failing.Store(true)
+	time.Sleep(time.Second)
+	step("upstream down, TTL and revalidation over", get(base, "carol", 1))
+
+	service.failing.Store(false)
+	step("a greedy client sends 30 requests", get(base, "mallory", 30))
+	step("meanwhile another client", get(base, "dave", 1))
+
+	fmt.Printf("\n%+v\n", p.Stats())
+}
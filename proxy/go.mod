@@ -0,0 +1,7 @@
+module github.com/rajamummidi/go-design-patterns/proxy
+
+go 1.20
+
+require github.com/rajamummidi/go-design-patterns/rate-limiter v0.0.0
+
+replace github.com/rajamummidi/go-design-patterns/rate-limiter => ../rate-limiter
@@ -0,0 +1,539 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package proxy implements a reverse proxy that caches and throttles. A
+// proxy has the same interface as the server behind it, so clients cannot
+// tell the two apart, and it adds behaviour on the way: it answers repeated
+// requests from a cache, and it turns away clients that send too many
+// requests, so neither reaches the upstream server.
+package proxy
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/rate-limiter/ratelimiter"
+)
+
+// Config configures a Proxy. Target is required.
+type Config struct {
+	// Target is the server every request is forwarded to. Its path, if
+	// any, is prefixed to the path of the requests.
+	Target *url.URL
+	// Transport sends the requests to Target, http.DefaultTransport if
+	// nil. Wrap it to protect the upstream, for example with a circuit
+	// breaker.
+	Transport http.RoundTripper
+	// Timeout bounds the requests that fill the cache (10s). They are not
+	// canceled when the client that caused them goes away, because other
+	// clients may be waiting for the same response.
+	Timeout time.Duration
+
+	// TTL is how long a response is served from the cache (1m). A
+	// max-age or s-maxage in the response's Cache-Control takes
+	// precedence, and responses marked no-store, no-cache or private are
+	// not cached at all.
+	TTL time.Duration
+	// StaleWhileRevalidate is how long after its TTL a response is still
+	// served, while it is fetched again in the background. Zero fetches an
+	// expired response again before answering.
+	StaleWhileRevalidate time.Duration
+	// StaleIfError is how long after its TTL a response is still served
+	// when fetching it again fails.
+	StaleIfError time.Duration
+	// MaxEntries bounds the number of cached responses (1000). The least
+	// recently used response is evicted first.
+	MaxEntries int
+	// MaxBodyBytes is the size of the largest response that is cached
+	// (1 MiB). Larger responses are forwarded as they are.
+	MaxBodyBytes int64
+
+	// Rate throttles every client to Rate requests per second on average,
+	// with bursts of up to Burst requests. Zero does not throttle.
+	Rate  float64
+	Burst int
+	// ClientKey identifies the client of a request, by its IP address if
+	// nil.
+	ClientKey func(r *http.Request) string
+
+	// ErrorHandler answers the requests that could not be forwarded. If
+	// nil, they are answered with 502 Bad Gateway.
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+func (c Config) withDefaults() Config {
+	if c.Transport == nil {
+		c.Transport = http.DefaultTransport
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.TTL <= 0 {
+		c.TTL = time.Minute
+	}
+	if c.MaxEntries <= 0 {
+		c.MaxEntries = 1000
+	}
+	if c.MaxBodyBytes <= 0 {
+		c.MaxBodyBytes = 1 << 20
+	}
+	if c.Rate > 0 && c.Burst < 1 {
+		c.Burst = 1
+	}
+	if c.ClientKey == nil {
+		c.ClientKey = ClientIP
+	}
+	if c.ErrorHandler == nil {
+		c.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		}
+	}
+	return c
+}
+
+// ClientIP returns the IP address a request came from.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Values of the X-Cache header, which tells clients where a response came
+// from.
+const (
+	cacheHit    = "HIT"
+	cacheStale  = "STALE"
+	cacheMiss   = "MISS"
+	cacheBypass = "BYPASS"
+)
+
+// errTooLarge stops a response from being cached.
+var errTooLarge = errors.New("proxy: response too large to cache")
+
+// Stats are the counters of a Proxy.
+type Stats struct {
+	// Hits counts responses served fresh from the cache.
+	Hits uint64 `json:"hits"`
+	// Stale counts expired responses served from the cache, while they
+	// were revalidated or because fetching them again failed.
+	Stale uint64 `json:"stale"`
+	// Misses counts requests that had to wait for the upstream.
+	Misses uint64 `json:"misses"`
+	// Bypassed counts requests that are never cached, such as POSTs.
+	Bypassed uint64 `json:"bypassed"`
+	// Revalidations counts background refreshes of stale responses.
+	Revalidations uint64 `json:"revalidations"`
+	// Throttled counts requests turned away with 429 Too Many Requests.
+	Throttled uint64 `json:"throttled"`
+	// Errors counts requests that could not be forwarded.
+	Errors uint64 `json:"errors"`
+	// Entries is the number of cached responses.
+	Entries int `json:"entries"`
+}
+
+// Proxy is a caching, throttling reverse proxy. It caches successful
+// responses to GET requests by URL, serves expired ones while it
+// revalidates them, and shares one upstream request among the clients that
+// ask for the same URL at the same time. Requests with an Authorization
+// header and requests with other methods are forwarded without caching.
+type Proxy struct {
+	config  Config
+	limiter *ratelimiter.Keyed[string]
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element // of *entry
+	lru      *list.List               // most recently used first
+	inflight map[string]*call
+	stats    Stats
+}
+
+// entry is a cached response.
+type entry struct {
+	key     string
+	status  int
+	header  http.Header
+	body    []byte
+	stored  time.Time
+	ttl     time.Duration
+	noStore bool
+}
+
+// call is an upstream request that clients wait on.
+type call struct {
+	done  chan struct{}
+	entry *entry
+	err   error
+}
+
+func New(config Config) (*Proxy, error) {
+	if config.Target == nil {
+		return nil, errors.New("proxy: Target is required")
+	}
+	p := &Proxy{
+		config:   config.withDefaults(),
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+		inflight: make(map[string]*call),
+	}
+	if p.config.Rate > 0 {
+		p.limiter = ratelimiter.NewKeyed[string](p.config.Rate, p.config.Burst)
+	}
+	return p, nil
+}
+
+// Stats returns the counters of the proxy.
+func (p *Proxy) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	stats.Entries = p.lru.Len()
+	return stats
+}
+
+// Purge empties the cache.
+func (p *Proxy) Purge() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.entries = make(map[string]*list.Element)
+	p.lru.Init()
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.limiter != nil && !p.limiter.Allow(p.config.ClientKey(r)) {
+		p.count(func(s *Stats) { s.Throttled++ })
+		w.Header().Set("Retry-After", strconv.Itoa(int(1/p.config.Rate)+1))
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return
+	}
+	if r.Method != http.MethodGet || r.Header.Get("Authorization") != "" {
+		p.count(func(s *Stats) { s.Bypassed++ })
+		p.forward(w, r)
+		return
+	}
+
+	key := r.URL.RequestURI()
+	now := time.Now()
+	cached := p.lookup(key)
+	if cached != nil && !noCache(r.Header) {
+		age := now.Sub(cached.stored)
+		switch {
+		case age < cached.ttl:
+			p.count(func(s *Stats) { s.Hits++ })
+			cached.write(w, cacheHit, now)
+			return
+		case age < cached.ttl+p.config.StaleWhileRevalidate:
+			p.count(func(s *Stats) { s.Stale++ })
+			p.revalidate(r, key)
+			cached.write(w, cacheStale, now)
+			return
+		}
+	}
+
+	p.count(func(s *Stats) { s.Misses++ })
+	fresh, err := p.fetch(r, key)
+	if errors.Is(err, errTooLarge) {
+		p.forward(w, r)
+		return
+	}
+	if err == nil && fresh.status < http.StatusInternalServerError {
+		fresh.write(w, cacheMiss, time.Now())
+		return
+	}
+	if cached != nil && now.Sub(cached.stored) < cached.ttl+p.config.StaleIfError {
+		p.count(func(s *Stats) { s.Stale++ })
+		cached.write(w, cacheStale, now)
+		return
+	}
+	if err != nil {
+		p.count(func(s *Stats) { s.Errors++ })
+		p.config.ErrorHandler(w, r, err)
+		return
+	}
+	fresh.write(w, cacheMiss, time.Now())
+}
+
+func (p *Proxy) count(update func(*Stats)) {
+	p.mu.Lock()
+	update(&p.stats)
+	p.mu.Unlock()
+}
+
+// lookup returns the cached response for key, or nil.
+func (p *Proxy) lookup(key string) *entry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	elem, ok := p.entries[key]
+	if !ok {
+		return nil
+	}
+	p.lru.MoveToFront(elem)
+	return elem.Value.(*entry)
+}
+
+// store caches e, evicting the least recently used response if the cache
+// is full.
+func (p *Proxy) store(e *entry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if elem, ok := p.entries[e.key]; ok {
+		elem.Value = e
+		p.lru.MoveToFront(elem)
+		return
+	}
+	p.entries[e.key] = p.lru.PushFront(e)
+	for p.lru.Len() > p.config.MaxEntries {
+		oldest := p.lru.Back()
+		p.lru.Remove(oldest)
+		delete(p.entries, oldest.Value.(*entry).key)
+	}
+}
+
+// revalidate fetches key again in the background, unless that is already
+// happening.
+func (p *Proxy) revalidate(r *http.Request, key string) {
+	p.mu.Lock()
+	_, busy := p.inflight[key]
+	if !busy {
+		p.stats.Revalidations++
+	}
+	p.mu.Unlock()
+
+	if !busy {
+		// The handler returns before the fetch is done.
+		go p.fetch(r.Clone(context.Background()), key)
+	}
+}
+
+// fetch requests key from the upstream and caches the response if it can.
+// Concurrent fetches of the same key share one request.
+func (p *Proxy) fetch(r *http.Request, key string) (*entry, error) {
+	p.mu.Lock()
+	if c, ok := p.inflight[key]; ok {
+		p.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.entry, c.err
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+	}
+	c := &call{done: make(chan struct{})}
+	p.inflight[key] = c
+	p.mu.Unlock()
+
+	c.entry, c.err = p.roundTrip(r, key)
+	if c.err == nil && !c.entry.noStore {
+		p.store(c.entry)
+	}
+
+	p.mu.Lock()
+	delete(p.inflight, key)
+	p.mu.Unlock()
+	close(c.done)
+	return c.entry, c.err
+}
+
+// roundTrip sends a cacheable request upstream and reads the response.
+func (p *Proxy) roundTrip(r *http.Request, key string) (*entry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.config.Timeout)
+	defer cancel()
+
+	out := p.outbound(ctx, r)
+	// The cached body is served to every client, so it must not be
+	// encoded for the one that happened to ask first. The transport
+	// decompresses responses when no encoding was asked for.
+	out.Header.Del("Accept-Encoding")
+	resp, err := p.config.Transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.ContentLength > p.config.MaxBodyBytes {
+		return nil, errTooLarge
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, p.config.MaxBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > p.config.MaxBodyBytes {
+		return nil, errTooLarge
+	}
+
+	header := resp.Header.Clone()
+	removeHopHeaders(header)
+	ttl, ok := p.freshness(resp)
+	return &entry{
+		key:     key,
+		status:  resp.StatusCode,
+		header:  header,
+		body:    body,
+		stored:  time.Now(),
+		ttl:     ttl,
+		noStore: !ok,
+	}, nil
+}
+
+// cacheable lists the statuses whose responses are cached.
+var cacheable = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// freshness returns how long resp may be cached, and false if it may not
+// be cached at all.
+func (p *Proxy) freshness(resp *http.Response) (time.Duration, bool) {
+	if !cacheable[resp.StatusCode] || resp.Header.Get("Vary") == "*" || resp.Header.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+	ttl := p.config.TTL
+	maxAge, sharedMaxAge := -1, -1
+	for _, directive := range strings.Split(resp.Header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache", "private":
+			return 0, false
+		case "max-age":
+			maxAge, _ = strconv.Atoi(value)
+		case "s-maxage":
+			sharedMaxAge, _ = strconv.Atoi(value)
+		}
+	}
+	switch {
+	case sharedMaxAge >= 0:
+		ttl = time.Duration(sharedMaxAge) * time.Second
+	case maxAge >= 0:
+		ttl = time.Duration(maxAge) * time.Second
+	}
+	return ttl, ttl > 0
+}
+
+// noCache reports whether the client asked for a response fresh from the
+// upstream.
+func noCache(header http.Header) bool {
+	control := strings.ToLower(header.Get("Cache-Control"))
+	return strings.Contains(control, "no-cache") || strings.Contains(control, "max-age=0")
+}
+
+func (e *entry) write(w http.ResponseWriter, cache string, now time.Time) {
+	for name, values := range e.header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("X-Cache", cache)
+	if cache != cacheMiss {
+		w.Header().Set("Age", strconv.Itoa(int(now.Sub(e.stored).Seconds())))
+	}
+	w.WriteHeader(e.status)
+	w.Write(e.body)
+}
+
+// forward passes a request through to the upstream and streams the
+// response back, without caching.
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request) {
+	resp, err := p.config.Transport.RoundTrip(p.outbound(r.Context(), r))
+	if err != nil {
+		p.count(func(s *Stats) { s.Errors++ })
+		p.config.ErrorHandler(w, r, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	removeHopHeaders(resp.Header)
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("X-Cache", cacheBypass)
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// outbound turns an incoming request into the request to the upstream.
+func (p *Proxy) outbound(ctx context.Context, r *http.Request) *http.Request {
+	target := p.config.Target
+	out := r.Clone(ctx)
+	out.RequestURI = ""
+	out.URL.Scheme = target.Scheme
+	out.URL.Host = target.Host
+	out.URL.Path = strings.TrimSuffix(target.Path, "/") + r.URL.Path
+	out.URL.RawPath = ""
+	out.Host = target.Host
+	if r.ContentLength == 0 {
+		out.Body = nil
+	}
+
+	removeHopHeaders(out.Header)
+	client := ClientIP(r)
+	if prior := out.Header.Get("X-Forwarded-For"); prior != "" {
+		client = prior + ", " + client
+	}
+	out.Header.Set("X-Forwarded-For", client)
+	return out
+}
+
+// hopHeaders are meant for one connection, so proxies must not pass them
+// on.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+func removeHopHeaders(header http.Header) {
+	for _, field := range header.Values("Connection") {
+		for _, name := range strings.Split(field, ",") {
+			header.Del(strings.TrimSpace(name))
+		}
+	}
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
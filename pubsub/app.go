@@ -0,0 +1,124 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/membudget"
+	"github.com/rajamummidi/go-design-patterns/pubsub/pubsub"
+)
+
+// Order is the data of the messages on the orders topic.
+type Order struct {
+	ID     string
+	Amount float64
+}
+
+func main() {
+	broker := pubsub.New()
+	defer broker.Close()
+
+	// Two subscriptions of the same topic each see every order.
+	emails, _ := broker.Subscribe("orders", "emails", pubsub.SubscriptionConfig{
+		VisibilityTimeout: 100 * time.Millisecond,
+		MaxAttempts:       3,
+		DeadLetterTopic:   "orders.dead-letter",
+	})
+	billing, _ := broker.Subscribe("orders", "billing", pubsub.SubscriptionConfig{})
+	dead, _ := broker.Subscribe("orders.dead-letter", "ops", pubsub.SubscriptionConfig{})
+	// Nobody may drain the dead letters for a while, so they share a memory
+	// budget with the other caches of the process instead of growing until
+	// it runs out of memory.
+	dead.UseBudget(membudget.New(64<<20), 1)
+
+	for _, order := range []Order{{"A-1", 20}, {"A-2", 35}, {"A-3", 12}, {"A-4", 80}} {
+		broker.Publish("orders", order)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// The email sender fails in three different ways: A-2 bounces once and
+	// is nacked, the sender stalls on A-3 past its visibility timeout, and
+	// A-4 has an address that never works.
+	for {
+		d, err := emails.Receive(ctx)
+		if err != nil {
+			break
+		}
+		order := d.Data.(Order)
+		switch {
+		case order.ID == "A-2" && d.Attempt == 1:
+			fmt.Printf("emails: %s attempt %d bounced, nack\n", order.ID, d.Attempt)
+			d.Nack()
+		case order.ID == "A-3" && d.Attempt == 1:
+			fmt.Printf("emails: %s attempt %d stalled\n", order.ID, d.Attempt)
+			time.Sleep(150 * time.Millisecond)
+			if err := d.Ack(); errors.Is(err, pubsub.ErrExpired) {
+				fmt.Printf("emails: %s ack too late, it was redelivered\n", order.ID)
+			}
+		case order.ID == "A-4":
+			fmt.Printf("emails: %s attempt %d failed, nack\n", order.ID, d.Attempt)
+			d.Nack()
+		default:
+			fmt.Printf("emails: %s attempt %d sent\n", order.ID, d.Attempt)
+			d.Ack()
+		}
+		if stats := emails.Stats(); stats.Backlog == 0 && stats.InFlight == 0 {
+			break
+		}
+	}
+
+	drain(billing, func(msg pubsub.Message) error {
+		fmt.Printf("billing: %s charged %.2f\n", msg.Data.(Order).ID, msg.Data.(Order).Amount)
+		return nil
+	})
+
+	drain(dead, func(msg pubsub.Message) error {
+		dl := msg.DeadLetter
+		fmt.Printf("ops: %s dead-lettered by %s after %d attempts (%s)\n", msg.Data.(Order).ID, dl.Subscription, dl.Attempts, dl.Reason)
+		return nil
+	})
+
+	for _, sub := range []*pubsub.Subscription{emails, billing, dead} {
+		fmt.Printf("%s: %+v\n", sub.Name(), sub.Stats())
+	}
+}
+
+// drain consumes the messages of a subscription that are already in its
+// queue, giving up after a moment.
+func drain(sub *pubsub.Subscription, handler func(pubsub.Message) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	sub.Consume(ctx, handler)
+}
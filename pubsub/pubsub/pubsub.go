@@ -0,0 +1,554 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package pubsub is a publish/subscribe broker with at-least-once delivery.
+//
+// Every subscription of a topic receives a copy of each message published
+// on it. Unlike the fire-and-forget event bus, a subscriber has to
+// acknowledge each message it receives. A message that is negatively
+// acknowledged, or not acknowledged within the subscription's visibility
+// timeout, is delivered again. After its last allowed attempt it is routed
+// to the subscription's dead-letter topic instead, so one message that can
+// never be processed does not keep coming back forever.
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/membudget"
+)
+
+// ErrClosed is returned once the broker has been closed.
+var ErrClosed = errors.New("pubsub: broker is closed")
+
+// ErrExists is returned by Subscribe for a subscription name that is taken.
+var ErrExists = errors.New("pubsub: subscription already exists")
+
+// ErrExpired is returned by Ack, Nack and Extend for a delivery that is no
+// longer outstanding: its visibility timeout passed, so the message is
+// already back in the queue or dead-lettered, or it was acknowledged
+// before.
+var ErrExpired = errors.New("pubsub: delivery is no longer outstanding")
+
+// Why a message was dead-lettered.
+const (
+	ReasonNacked  = "nacked"
+	ReasonExpired = "visibility timeout"
+)
+
+// Message is one delivery of a published message to a subscription.
+type Message struct {
+	ID          string
+	Topic       string
+	Data        interface{}
+	PublishedAt time.Time
+
+	// Attempt is 1 on the first delivery to a subscription and grows with
+	// every redelivery.
+	Attempt int
+
+	// DeadLetter is set on messages routed to a dead-letter topic.
+	DeadLetter *DeadLetter
+}
+
+// DeadLetter says where a dead-lettered message came from.
+type DeadLetter struct {
+	Topic        string
+	Subscription string
+	Attempts     int
+	Reason       string
+}
+
+// SubscriptionConfig configures a subscription.
+type SubscriptionConfig struct {
+	// VisibilityTimeout is how long a received message stays hidden from
+	// other receivers while it is being processed (30 seconds by default).
+	// A message that is not acknowledged in time is delivered again.
+	VisibilityTimeout time.Duration
+	// MaxAttempts is how often a message is delivered before it is
+	// dead-lettered. Zero means no limit.
+	MaxAttempts int
+	// DeadLetterTopic receives the messages that used up their attempts.
+	// Without one they are dropped.
+	DeadLetterTopic string
+}
+
+// Stats counts what happened to the messages of a subscription.
+type Stats struct {
+	Delivered    uint64 // deliveries, including redeliveries
+	Acked        uint64
+	Nacked       uint64
+	Expired      uint64 // deliveries whose visibility timeout passed
+	DeadLettered uint64
+	Dropped      uint64 // out of attempts with no dead-letter topic
+	Evicted      uint64 // dropped from the backlog when the memory budget ran out
+	Backlog      int    // messages waiting to be delivered
+	InFlight     int    // messages delivered and not yet acknowledged
+}
+
+// Broker routes published messages to the subscriptions of their topic. It
+// is safe for concurrent use.
+type Broker struct {
+	mu     sync.RWMutex
+	topics map[string][]*Subscription
+	names  map[string]*Subscription
+	seq    uint64
+	closed bool
+}
+
+func New() *Broker {
+	return &Broker{
+		topics: make(map[string][]*Subscription),
+		names:  make(map[string]*Subscription),
+	}
+}
+
+// Subscribe creates the subscription name on topic. It receives the
+// messages published from now on; messages published before it existed
+// are not replayed.
+func (b *Broker) Subscribe(topic, name string, cfg SubscriptionConfig) (*Subscription, error) {
+	if cfg.VisibilityTimeout <= 0 {
+		cfg.VisibilityTimeout = 30 * time.Second
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+	if _, ok := b.names[name]; ok {
+		return nil, ErrExists
+	}
+	s := &Subscription{
+		broker:   b,
+		topic:    topic,
+		name:     name,
+		cfg:      cfg,
+		inflight: make(map[uint64]*entry),
+		wake:     make(chan struct{}),
+	}
+	b.names[name] = s
+	b.topics[topic] = append(b.topics[topic], s)
+	return s, nil
+}
+
+// Publish delivers data to every subscription of topic and returns the ID
+// of the message. A topic without subscriptions drops it.
+func (b *Broker) Publish(topic string, data interface{}) (string, error) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return "", ErrClosed
+	}
+	b.seq++
+	id := strconv.FormatUint(b.seq, 10)
+	b.mu.Unlock()
+
+	b.publish(Message{ID: id, Topic: topic, Data: data, PublishedAt: time.Now()})
+	return id, nil
+}
+
+func (b *Broker) publish(msg Message) {
+	b.mu.RLock()
+	subs := b.topics[msg.Topic]
+	b.mu.RUnlock()
+
+	for _, s := range subs {
+		s.enqueue(msg)
+	}
+}
+
+// Close stops the broker. Blocked Receive calls return ErrClosed and
+// messages not yet acknowledged are discarded.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	var subs []*Subscription
+	for _, s := range b.names {
+		subs = append(subs, s)
+	}
+	b.mu.Unlock()
+
+	for _, s := range subs {
+		s.close()
+	}
+}
+
+type entry struct {
+	msg      Message
+	size     int64       // estimated memory, accounted while in the backlog
+	deadline time.Time   // of the current delivery
+	timer    *time.Timer // fires at deadline
+}
+
+// entryOverhead approximates the memory of a queued message besides its
+// ID, topic and data.
+const entryOverhead = 128
+
+// messageSize estimates the memory a queued message takes up. Data that is
+// not a string or bytes is measured by its JSON encoding.
+func messageSize(msg Message) int64 {
+	size := entryOverhead + len(msg.ID) + len(msg.Topic)
+	switch data := msg.Data.(type) {
+	case nil:
+	case string:
+		size += len(data)
+	case []byte:
+		size += len(data)
+	default:
+		if b, err := json.Marshal(data); err == nil {
+			size += len(b)
+		}
+	}
+	return int64(size)
+}
+
+// Subscription is a queue of the messages of one topic. Its messages are
+// shared between the goroutines that receive from it: each delivery goes
+// to one receiver.
+type Subscription struct {
+	broker *Broker
+	topic  string
+	name   string
+	cfg    SubscriptionConfig
+
+	mu       sync.Mutex
+	ready    []*entry
+	inflight map[uint64]*entry // by delivery token
+	token    uint64
+	wake     chan struct{} // closed and replaced when a message is ready
+	closed   bool
+	stats    Stats
+	memory   *membudget.Component
+	pending  int64 // bytes queued or freed since the budget was last told
+}
+
+func (s *Subscription) Name() string {
+	return s.name
+}
+
+func (s *Subscription) Topic() string {
+	return s.topic
+}
+
+// UseBudget accounts the backlog of the subscription against budget, which
+// matters most for a dead-letter subscription nobody drains. When the
+// budget runs out, the oldest messages of the backlog are evicted and
+// counted in Stats.Evicted. Messages in flight are not accounted.
+func (s *Subscription) UseBudget(budget *membudget.Budget, weight float64) {
+	memory := budget.Register("pubsub/"+s.name, weight, s.evict)
+
+	s.mu.Lock()
+	s.memory = memory
+	s.mu.Unlock()
+	s.account()
+}
+
+func (s *Subscription) enqueue(msg Message) {
+	defer s.account()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.push(&entry{msg: msg, size: messageSize(msg)})
+}
+
+// push appends e to the backlog and wakes a receiver. s.mu must be held.
+func (s *Subscription) push(e *entry) {
+	s.ready = append(s.ready, e)
+	s.pending += e.size
+	s.signal()
+}
+
+// account tells the budget about the memory queued or freed since the last
+// call. It must be called without s.mu held, because reserving memory may
+// call back into evict.
+func (s *Subscription) account() {
+	s.mu.Lock()
+	memory, pending := s.memory, s.pending
+	if memory != nil {
+		s.pending = 0
+	}
+	s.mu.Unlock()
+
+	switch {
+	case memory == nil:
+	case pending > 0:
+		memory.Reserve(pending)
+	case pending < 0:
+		memory.Release(-pending)
+	}
+}
+
+// evict drops the oldest messages of the backlog until need bytes are
+// freed or the backlog is empty.
+func (s *Subscription) evict(need int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var freed int64
+	for freed < need && len(s.ready) > 0 {
+		freed += s.ready[0].size
+		s.ready[0] = nil
+		s.ready = s.ready[1:]
+		s.stats.Evicted++
+	}
+	return freed
+}
+
+// signal wakes the receivers waiting for a message. s.mu must be held.
+func (s *Subscription) signal() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// Receive waits for the next message and delivers it. The message must be
+// acknowledged with Ack or Nack on the returned delivery before the
+// visibility timeout passes, or it is delivered again.
+func (s *Subscription) Receive(ctx context.Context) (*Delivery, error) {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return nil, ErrClosed
+		}
+		if len(s.ready) > 0 {
+			e := s.ready[0]
+			s.ready[0] = nil
+			s.ready = s.ready[1:]
+			s.pending -= e.size
+			d := s.deliver(e)
+			s.mu.Unlock()
+			s.account()
+			return d, nil
+		}
+		wake := s.wake
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-wake:
+		}
+	}
+}
+
+// deliver makes e in flight under a new delivery token. s.mu must be held.
+func (s *Subscription) deliver(e *entry) *Delivery {
+	s.token++
+	token := s.token
+	e.msg.Attempt++
+	e.deadline = time.Now().Add(s.cfg.VisibilityTimeout)
+	e.timer = time.AfterFunc(s.cfg.VisibilityTimeout, func() { s.expire(token) })
+	s.inflight[token] = e
+	s.stats.Delivered++
+	return &Delivery{Message: e.msg, sub: s, token: token}
+}
+
+// settle removes the delivery token from the messages in flight.
+func (s *Subscription) settle(token uint64) (*entry, bool) {
+	e, ok := s.inflight[token]
+	if ok {
+		delete(s.inflight, token)
+		e.timer.Stop()
+	}
+	return e, ok
+}
+
+func (s *Subscription) expire(token uint64) {
+	s.mu.Lock()
+	e, ok := s.inflight[token]
+	if !ok || s.closed {
+		s.mu.Unlock()
+		return
+	}
+	// Extend may have moved the deadline while the timer was firing.
+	if remaining := time.Until(e.deadline); remaining > 0 {
+		e.timer = time.AfterFunc(remaining, func() { s.expire(token) })
+		s.mu.Unlock()
+		return
+	}
+	delete(s.inflight, token)
+	s.stats.Expired++
+	dead := s.retry(e, ReasonExpired)
+	s.mu.Unlock()
+
+	s.account()
+	s.deadLetter(dead)
+}
+
+// retry puts a failed message back in the queue, or returns it as a dead
+// letter once it has used up its attempts. s.mu must be held.
+func (s *Subscription) retry(e *entry, reason string) *Message {
+	if s.cfg.MaxAttempts > 0 && e.msg.Attempt >= s.cfg.MaxAttempts {
+		if s.cfg.DeadLetterTopic == "" {
+			s.stats.Dropped++
+			return nil
+		}
+		s.stats.DeadLettered++
+		msg := e.msg
+		msg.Topic = s.cfg.DeadLetterTopic
+		msg.Attempt = 0
+		msg.DeadLetter = &DeadLetter{
+			Topic:        e.msg.Topic,
+			Subscription: s.name,
+			Attempts:     e.msg.Attempt,
+			Reason:       reason,
+		}
+		return &msg
+	}
+	s.push(e)
+	return nil
+}
+
+// deadLetter publishes msg, if any, on its dead-letter topic. It is called
+// without s.mu, as the dead-letter subscriptions have locks of their own.
+func (s *Subscription) deadLetter(msg *Message) {
+	if msg != nil {
+		s.broker.publish(*msg)
+	}
+}
+
+func (s *Subscription) close() {
+	defer s.account()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for token, e := range s.inflight {
+		e.timer.Stop()
+		delete(s.inflight, token)
+	}
+	for _, e := range s.ready {
+		s.pending -= e.size
+	}
+	s.ready = nil
+	s.signal()
+}
+
+// Stats returns the counters of the subscription.
+func (s *Subscription) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.stats
+	stats.Backlog = len(s.ready)
+	stats.InFlight = len(s.inflight)
+	return stats
+}
+
+// Consume receives messages until ctx is done or the broker is closed,
+// calling handler for each one. A nil error acknowledges the message and
+// any other error nacks it. Consume returns the error that stopped it.
+func (s *Subscription) Consume(ctx context.Context, handler func(Message) error) error {
+	for {
+		d, err := s.Receive(ctx)
+		if err != nil {
+			return err
+		}
+		if handler(d.Message) == nil {
+			d.Ack()
+		} else {
+			d.Nack()
+		}
+	}
+}
+
+// Delivery is a message handed to a receiver, waiting to be acknowledged.
+type Delivery struct {
+	Message
+
+	sub   *Subscription
+	token uint64
+}
+
+// Ack acknowledges the message: it was processed and is not delivered
+// again.
+func (d *Delivery) Ack() error {
+	s := d.sub
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.settle(d.token); !ok {
+		return ErrExpired
+	}
+	s.stats.Acked++
+	return nil
+}
+
+// Nack gives the message back straight away, to be delivered again or
+// dead-lettered if this was its last attempt.
+func (d *Delivery) Nack() error {
+	s := d.sub
+	s.mu.Lock()
+	e, ok := s.settle(d.token)
+	if !ok {
+		s.mu.Unlock()
+		return ErrExpired
+	}
+	s.stats.Nacked++
+	dead := s.retry(e, ReasonNacked)
+	s.mu.Unlock()
+
+	s.account()
+	s.deadLetter(dead)
+	return nil
+}
+
+// Extend gives the receiver another timeout, counted from now, to
+// acknowledge the message. Long-running handlers call it periodically.
+func (d *Delivery) Extend(timeout time.Duration) error {
+	s := d.sub
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.inflight[d.token]
+	if !ok {
+		return ErrExpired
+	}
+	e.deadline = time.Now().Add(timeout)
+	if e.timer.Stop() {
+		token := d.token
+		e.timer = time.AfterFunc(timeout, func() { s.expire(token) })
+	}
+	return nil
+}
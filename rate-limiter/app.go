@@ -0,0 +1,64 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/rate-limiter/ratelimiter"
+)
+
+func main() {
+	// Two requests per second with bursts of up to five.
+	bucket := ratelimiter.NewTokenBucket(2, 5)
+
+	start := time.Now()
+	for i := 1; i <= 8; i++ {
+		fmt.Printf("request %d allowed: %v\n", i, bucket.Allow())
+	}
+
+	// Wait blocks until the next token arrives instead of rejecting.
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for i := 1; i <= 3; i++ {
+		if err := bucket.Wait(ctx); err != nil {
+			fmt.Println("wait:", err)
+			return
+		}
+		fmt.Printf("waited for token %d, %.1fs after start\n", i, time.Since(start).Seconds())
+	}
+
+	// A keyed limiter gives every client its own bucket.
+	clients := ratelimiter.NewKeyed[string](1, 2)
+	for _, client := range []string{"alice", "alice", "alice", "bob"} {
+		fmt.Printf("%s allowed: %v\n", client, clients.Allow(client))
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/rajamummidi/go-design-patterns/rate-limiter
+
+go 1.20
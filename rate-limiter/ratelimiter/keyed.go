@@ -0,0 +1,111 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package ratelimiter
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrLimited is returned by Keyed.Check for a key whose bucket is empty.
+var ErrLimited = errors.New("ratelimiter: rate limit exceeded")
+
+// Hook is consulted by Keyed.Check before the bucket of a key. It returns
+// an error to refuse the key whatever its bucket holds, for example because
+// the key has used up a quota that spans a longer period than its bucket.
+type Hook[K comparable] func(key K) error
+
+// Keyed keeps a TokenBucket per key, such as a client address or user, so
+// that one busy client cannot use up the allowance of the others.
+type Keyed[K comparable] struct {
+	rate  float64
+	burst int
+
+	mu      sync.Mutex
+	buckets map[K]*TokenBucket
+	hooks   []Hook[K]
+}
+
+func NewKeyed[K comparable](rate float64, burst int) *Keyed[K] {
+	return &Keyed[K]{rate: rate, burst: burst, buckets: make(map[K]*TokenBucket)}
+}
+
+// AddHook makes Check consult hook before the bucket of a key.
+func (k *Keyed[K]) AddHook(hook Hook[K]) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.hooks = append(k.hooks, hook)
+}
+
+// Allow takes a token from the bucket of key, creating a full bucket for a
+// key it has not seen before. It reports false if a hook refuses key.
+func (k *Keyed[K]) Allow(key K) bool {
+	return k.Check(key) == nil
+}
+
+// Check is Allow with a reason: the error of the first hook that refuses
+// key, or ErrLimited if its bucket is empty. A refused key keeps its
+// tokens.
+func (k *Keyed[K]) Check(key K) error {
+	k.mu.Lock()
+	hooks := k.hooks
+	k.mu.Unlock()
+
+	for _, hook := range hooks {
+		if err := hook(key); err != nil {
+			return err
+		}
+	}
+	if !k.Bucket(key).Allow() {
+		return ErrLimited
+	}
+	return nil
+}
+
+// Bucket returns the bucket of key.
+func (k *Keyed[K]) Bucket(key K) *TokenBucket {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	bucket, ok := k.buckets[key]
+	if !ok {
+		bucket = NewTokenBucket(k.rate, k.burst)
+		k.buckets[key] = bucket
+	}
+	return bucket
+}
+
+// Forget drops the bucket of key, for example when a client disconnects.
+func (k *Keyed[K]) Forget(key K) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	delete(k.buckets, key)
+}
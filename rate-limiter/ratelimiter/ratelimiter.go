@@ -0,0 +1,138 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package ratelimiter implements the token bucket algorithm. A bucket holds
+// up to burst tokens and is refilled at a steady rate; every request takes a
+// token, so short bursts are absorbed while the long-run rate stays bounded.
+package ratelimiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter is what callers of a rate limiter need, so that other algorithms
+// can stand in for the token bucket.
+type Limiter interface {
+	Allow() bool
+	Wait(ctx context.Context) error
+}
+
+// TokenBucket is a Limiter that allows rate events per second on average and
+// up to burst events at once. It is safe for concurrent use.
+type TokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a full bucket. A rate of zero or less never refills
+// it.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Allow takes a token if one is available.
+func (b *TokenBucket) Allow() bool {
+	return b.AllowN(1)
+}
+
+// AllowN takes n tokens if they are all available, and none otherwise.
+func (b *TokenBucket) AllowN(n int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens < float64(n) {
+		return false
+	}
+	b.tokens -= float64(n)
+	return true
+}
+
+// Wait blocks until a token is available and takes it, or returns ctx's
+// error if ctx is done first.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.refill(now)
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		delay := b.delay(1)
+		b.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Tokens returns the number of tokens currently in the bucket.
+func (b *TokenBucket) Tokens() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	return b.tokens
+}
+
+// refill adds the tokens earned since the last call. The caller must hold
+// b.mu.
+func (b *TokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 && b.rate > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+	}
+	b.last = now
+}
+
+// delay returns how long it takes until n tokens are available. The caller
+// must hold b.mu.
+func (b *TokenBucket) delay(n float64) time.Duration {
+	if b.rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
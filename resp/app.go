@@ -0,0 +1,72 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/rajamummidi/go-design-patterns/resp/resp"
+)
+
+func main() {
+	addr := flag.String("addr", "", "address of a Redis server to send the commands to, e.g. localhost:6379")
+	flag.Parse()
+
+	commands := [][]string{
+		{"SET", "greeting", "hello", "PX", "30000"},
+		{"GET", "greeting"},
+		{"GET", "missing"},
+		{"INCR", "greeting"},
+	}
+
+	if *addr == "" {
+		// Without a server, show what goes over the wire.
+		var buf bytes.Buffer
+		resp.WriteCommand(&buf, commands[0]...)
+		fmt.Printf("%s is sent as %q\n\n", strings.Join(commands[0], " "), buf.String())
+
+		for _, reply := range []string{"+OK\r\n", "$5\r\nhello\r\n", "$-1\r\n", "-ERR value is not an integer or out of range\r\n"} {
+			v, err := resp.ReadReply(bufio.NewReader(strings.NewReader(reply)))
+			fmt.Printf("%-52q reads as %#v, %v\n", reply, v, err)
+		}
+		return
+	}
+
+	client := resp.NewClient(*addr)
+	defer client.Close()
+	for _, args := range commands {
+		reply, err := client.Do(context.Background(), args...)
+		fmt.Printf("%-35s %#v, %v\n", strings.Join(args, " "), reply, err)
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/rajamummidi/go-design-patterns/resp
+
+go 1.20
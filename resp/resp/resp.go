@@ -0,0 +1,257 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package resp is a minimal Redis client. It speaks RESP, the protocol of
+// Redis, over TCP: enough of it to send commands and read their replies,
+// so the packages of this repository that use Redis have no dependencies.
+package resp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxLength bounds the length of a bulk string or an array, as Redis
+// itself does, so a corrupt header cannot make a reader allocate gigabytes.
+const maxLength = 512 << 20
+
+// Error is an error reply from Redis, such as "WRONGTYPE Operation against
+// a key holding the wrong kind of value". The connection stays usable
+// after one.
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// WriteCommand writes a command as an array of bulk strings.
+func WriteCommand(w io.Writer, args ...string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(bw, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return bw.Flush()
+}
+
+// ReadReply reads a reply: a string for simple and bulk strings, an int64
+// for an integer, a []interface{} of replies for an array, and nil for a
+// null bulk string or array. An error reply is returned as an Error, or
+// kept as one in the array it is part of, as in the reply to EXEC. A reply
+// that is cut short fails with io.ErrUnexpectedEOF.
+func ReadReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line != "" {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("resp: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, Error(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := readLength(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if data[n] != '\r' || data[n+1] != '\n' {
+			return nil, fmt.Errorf("resp: bulk string of %d bytes not followed by CRLF", n)
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := readLength(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		replies := make([]interface{}, n)
+		for i := range replies {
+			reply, err := ReadReply(r)
+			var redisErr Error
+			switch {
+			case errors.As(err, &redisErr):
+				replies[i] = redisErr
+			case err == io.EOF:
+				return nil, io.ErrUnexpectedEOF
+			case err != nil:
+				return nil, err
+			default:
+				replies[i] = reply
+			}
+		}
+		return replies, nil
+	}
+	return nil, fmt.Errorf("resp: unexpected reply %q", line)
+}
+
+// readLength parses the length of a bulk string or an array; -1 stands for
+// a null reply.
+func readLength(body string) (int, error) {
+	n, err := strconv.Atoi(body)
+	if err != nil || n < -1 || n > maxLength {
+		return 0, fmt.Errorf("resp: bad length %q", body)
+	}
+	return n, nil
+}
+
+// Conn is a single connection to Redis. It is not safe for concurrent use.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Dial connects to the Redis server at addr and, if password is set,
+// authenticates with AUTH.
+func Dial(ctx context.Context, addr, password string) (*Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{conn: conn, r: bufio.NewReader(conn)}
+	if password != "" {
+		if _, err := c.Do(ctx, "AUTH", password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Do sends a command and reads its reply, within ctx's deadline or five
+// seconds.
+func (c *Conn) Do(ctx context.Context, args ...string) (interface{}, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	c.conn.SetDeadline(deadline)
+	if err := WriteCommand(c.conn, args...); err != nil {
+		return nil, err
+	}
+	return ReadReply(c.r)
+}
+
+// Send writes a command without reading its reply, for commands such as
+// SUBSCRIBE whose replies arrive as pushes; see Receive.
+func (c *Conn) Send(args ...string) error {
+	c.conn.SetDeadline(time.Time{})
+	return WriteCommand(c.conn, args...)
+}
+
+// Receive waits for the next reply, without a deadline. Closing the
+// connection ends the wait.
+func (c *Conn) Receive() (interface{}, error) {
+	return ReadReply(c.r)
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Client sends commands over one connection, which it dials on first use
+// and dials again after any error other than an error reply, since the
+// connection is then in an unknown state. It is safe for concurrent use;
+// commands are sent one at a time.
+type Client struct {
+	addr string
+
+	// Password, if set, is sent with AUTH on every new connection.
+	Password string
+
+	mu   sync.Mutex
+	conn *Conn
+}
+
+// NewClient returns a client for the Redis server at addr. It connects
+// when it is first used.
+func NewClient(addr string) *Client {
+	return &Client{addr: addr}
+}
+
+// Do sends a command and returns its reply, as ReadReply reads it.
+func (c *Client) Do(ctx context.Context, args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		conn, err := Dial(ctx, c.addr, c.Password)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+	}
+	reply, err := c.conn.Do(ctx, args...)
+	var redisErr Error
+	if err != nil && !errors.As(err, &redisErr) {
+		c.conn.Close()
+		c.conn = nil
+	}
+	return reply, err
+}
+
+// Dial opens a connection of its own to the client's server, for commands
+// that hold a connection, such as SUBSCRIBE or blocking pops.
+func (c *Client) Dial(ctx context.Context) (*Conn, error) {
+	return Dial(ctx, c.addr, c.Password)
+}
+
+// Close closes the shared connection. A later command dials a new one.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
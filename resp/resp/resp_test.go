@@ -0,0 +1,223 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReadReply(t *testing.T) {
+	for _, tt := range []struct {
+		name, in string
+		want     interface{}
+	}{
+		{"simple string", "+OK\r\n", "OK"},
+		{"integer", ":-42\r\n", int64(-42)},
+		{"bulk string", "$5\r\nhe\r\no\r\n", "he\r\no"},
+		{"empty bulk string", "$0\r\n\r\n", ""},
+		{"nil bulk string", "$-1\r\n", nil},
+		{"nil array", "*-1\r\n", nil},
+		{"array", "*3\r\n$7\r\nmessage\r\n:1\r\n$-1\r\n", []interface{}{"message", int64(1), nil}},
+		{"nested array", "*2\r\n*1\r\n+a\r\n*0\r\n", []interface{}{[]interface{}{"a"}, []interface{}{}}},
+		{"error in an array", "*2\r\n+OK\r\n-WRONGTYPE bad\r\n", []interface{}{"OK", Error("WRONGTYPE bad")}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// Replies arrive in pieces from the network; read them a byte
+			// at a time.
+			r := bufio.NewReaderSize(iotest.OneByteReader(strings.NewReader(tt.in)), 16)
+			got, err := ReadReply(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+			if _, err := r.ReadByte(); err != io.EOF {
+				t.Errorf("reply not read to its end")
+			}
+		})
+	}
+}
+
+func TestReadReplyError(t *testing.T) {
+	got, err := ReadReply(bufio.NewReader(strings.NewReader("-ERR unknown command 'FOO'\r\n")))
+	var redisErr Error
+	if !errors.As(err, &redisErr) || redisErr != "ERR unknown command 'FOO'" {
+		t.Fatalf("got %v, %v; want the error reply", got, err)
+	}
+}
+
+func TestReadReplyTruncated(t *testing.T) {
+	for _, in := range []string{
+		"+OK",
+		"$5\r\nhel",
+		"$5\r\nhello",
+		"$5\r\n",
+		"*2\r\n+OK\r\n",
+		"*2\r\n$3\r\nab",
+	} {
+		_, err := ReadReply(bufio.NewReader(strings.NewReader(in)))
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("%q: got %v, want io.ErrUnexpectedEOF", in, err)
+		}
+	}
+	if _, err := ReadReply(bufio.NewReader(strings.NewReader(""))); err != io.EOF {
+		t.Errorf("empty input: got %v, want io.EOF", err)
+	}
+}
+
+func TestReadReplyMalformed(t *testing.T) {
+	for _, in := range []string{
+		"OK\r\n",
+		"+OK\n",
+		"$x\r\n",
+		"$-2\r\n",
+		"$99999999999\r\n",
+		"$3\r\nabcde\r\n",
+		"*-5\r\n",
+		":one\r\n",
+	} {
+		_, err := ReadReply(bufio.NewReader(strings.NewReader(in)))
+		var redisErr Error
+		if err == nil || errors.As(err, &redisErr) || err == io.ErrUnexpectedEOF {
+			t.Errorf("%q: got %v, want a protocol error", in, err)
+		}
+	}
+}
+
+func TestWriteCommand(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCommand(&buf, "SET", "k", "a b\r\n", ""); err != nil {
+		t.Fatal(err)
+	}
+	want := "*4\r\n$3\r\nSET\r\n$1\r\nk\r\n$5\r\na b\r\n\r\n$0\r\n\r\n"
+	if buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+// fakeServer accepts connections and answers every command with the reply
+// reply returns for it, closing the connection instead if that is empty.
+// It counts the connections it accepted.
+func fakeServer(t *testing.T, reply func(args []interface{}) string) (addr string, conns *atomic.Int32) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	conns = new(atomic.Int32)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					cmd, err := ReadReply(r)
+					if err != nil {
+						return
+					}
+					out := reply(cmd.([]interface{}))
+					if out == "" {
+						return
+					}
+					io.WriteString(conn, out)
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), conns
+}
+
+func TestClient(t *testing.T) {
+	addr, conns := fakeServer(t, func(args []interface{}) string {
+		switch args[0] {
+		case "AUTH":
+			if args[1] != "s3cret" {
+				return "-WRONGPASS invalid password\r\n"
+			}
+			return "+OK\r\n"
+		case "GET":
+			return "$-1\r\n"
+		case "DROP":
+			return ""
+		}
+		return "-ERR unknown command\r\n"
+	})
+	ctx := context.Background()
+
+	c := NewClient(addr)
+	c.Password = "s3cret"
+	defer c.Close()
+	if got, err := c.Do(ctx, "GET", "missing"); got != nil || err != nil {
+		t.Fatalf("GET: got %v, %v; want a nil reply", got, err)
+	}
+	var redisErr Error
+	if _, err := c.Do(ctx, "FOO"); !errors.As(err, &redisErr) {
+		t.Fatalf("FOO: got %v, want an error reply", err)
+	}
+	if _, err := c.Do(ctx, "GET", "missing"); err != nil {
+		t.Fatal(err)
+	}
+	if n := conns.Load(); n != 1 {
+		t.Fatalf("%d connections after an error reply, want 1", n)
+	}
+
+	// A connection that fails is dialed again for the next command.
+	if _, err := c.Do(ctx, "DROP"); err == nil || errors.As(err, &redisErr) {
+		t.Fatalf("DROP: got %v, want a connection error", err)
+	}
+	if _, err := c.Do(ctx, "GET", "missing"); err != nil {
+		t.Fatal(err)
+	}
+	if n := conns.Load(); n != 2 {
+		t.Fatalf("%d connections after a dropped one, want 2", n)
+	}
+
+	wrong := NewClient(addr)
+	wrong.Password = "guess"
+	if _, err := wrong.Do(ctx, "GET", "missing"); !errors.As(err, &redisErr) {
+		t.Fatalf("wrong password: got %v, want an error reply", err)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/circuit-breaker/circuitbreaker"
+	"github.com/rajamummidi/go-design-patterns/retry/retry"
+)
+
+var errUnavailable = errors.New("service unavailable")
+
+// flakyService fails the given share of its calls.
+func flakyService(failureRate float64) func() error {
+	return func() error {
+		if rand.Float64() < failureRate {
+			return errUnavailable
+		}
+		return nil
+	}
+}
+
+var policy = retry.Policy{
+	MaxAttempts:  4,
+	InitialDelay: 10 * time.Millisecond,
+	MaxDelay:     100 * time.Millisecond,
+	Jitter:       0.5,
+	// An open breaker will not close within a few milliseconds, so
+	// retrying it only wastes time.
+	Retryable: func(err error) bool {
+		return !errors.Is(err, circuitbreaker.ErrOpen) && !errors.Is(err, circuitbreaker.ErrTooManyRequests)
+	},
+}
+
+func newBreaker(name string) *circuitbreaker.Breaker {
+	return circuitbreaker.New(name, circuitbreaker.Config{
+		MinRequests:  10,
+		FailureRatio: 0.5,
+		OpenTimeout:  time.Second,
+	})
+}
+
+// run makes 50 requests with call and prints how they went.
+func run(name string, breaker *circuitbreaker.Breaker, call func(ctx context.Context) error) {
+	outcomes := map[string]int{}
+	for i := 0; i < 50; i++ {
+		err := call(context.Background())
+		switch {
+		case err == nil:
+			outcomes["ok"]++
+		case errors.Is(err, circuitbreaker.ErrOpen):
+			outcomes["rejected by breaker"]++
+		default:
+			outcomes["failed"]++
+		}
+	}
+	stats := breaker.Stats()
+	fmt.Printf("%s: %v; breaker saw %d calls, %d failed, state %s\n",
+		name, outcomes, stats.Requests, stats.Failures, stats.State)
+}
+
+func main() {
+	// A service that fails now and then: retries hide the failures.
+	service := flakyService(0.3)
+
+	// Retry inside the breaker: the breaker sees one call per request and
+	// only counts a failure when every attempt failed.
+	inside := newBreaker("inside")
+	run("retry inside breaker", inside, func(ctx context.Context) error {
+		return inside.Execute(ctx, func() error {
+			return retry.Do(ctx, policy, func(ctx context.Context) error { return service() })
+		})
+	})
+
+	// Retry outside the breaker: every attempt is a call of its own, so the
+	// breaker notices a struggling service sooner, and an open breaker ends
+	// the retries at once.
+	outside := newBreaker("outside")
+	run("retry outside breaker", outside, func(ctx context.Context) error {
+		return retry.Do(ctx, policy, func(ctx context.Context) error {
+			return outside.Execute(ctx, service)
+		})
+	})
+
+	// A service that is down: retries cannot help, and the breaker stops
+	// them from piling onto it.
+	service = flakyService(1)
+	down := newBreaker("down")
+	run("service down, retry outside breaker", down, func(ctx context.Context) error {
+		return retry.Do(ctx, policy, func(ctx context.Context) error {
+			return down.Execute(ctx, service)
+		})
+	})
+}
@@ -0,0 +1,153 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package retry calls an operation again when it fails with an error that
+// is likely to be temporary, waiting longer after every failure.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Policy says how often and how patiently to retry. Zero fields take the
+// defaults given below.
+type Policy struct {
+	// MaxAttempts is how often the operation is called at most, including
+	// the first call (3).
+	MaxAttempts int
+
+	// The delay before the n-th retry is InitialDelay (100ms) multiplied by
+	// Multiplier (2) n-1 times, but at most MaxDelay (10s).
+	InitialDelay time.Duration
+	Multiplier   float64
+	MaxDelay     time.Duration
+
+	// Jitter randomizes each delay by up to this fraction of it (0 to 1),
+	// so that clients that failed together do not all retry together.
+	Jitter float64
+
+	// Retryable decides which errors are worth another attempt. By default
+	// every error is, except context errors and errors marked Permanent.
+	Retryable func(err error) bool
+
+	// OnRetry, if set, is called before waiting for the next attempt.
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+func (p Policy) withDefaults() Policy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialDelay <= 0 {
+		p.InitialDelay = 100 * time.Millisecond
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 10 * time.Second
+	}
+	if p.Retryable == nil {
+		p.Retryable = func(err error) bool {
+			return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+		}
+	}
+	return p
+}
+
+// permanent marks an error that must not be retried.
+type permanent struct {
+	err error
+}
+
+func (p permanent) Error() string { return p.err.Error() }
+func (p permanent) Unwrap() error { return p.err }
+
+// Permanent wraps err so that Do returns it at once instead of retrying,
+// whatever the policy's Retryable says.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanent{err}
+}
+
+// Do calls fn until it succeeds, fails with an error that is not
+// retryable, or has been called policy.MaxAttempts times. It waits between
+// attempts as the policy says, and gives up early when ctx is done. The
+// returned error is the one of the last attempt, wrapped with the number of
+// attempts if they ran out.
+func Do(ctx context.Context, policy Policy, fn func(ctx context.Context) error) error {
+	policy = policy.withDefaults()
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		var p permanent
+		if errors.As(err, &p) {
+			return p.err
+		}
+		if !policy.Retryable(err) {
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			return fmt.Errorf("retry: giving up after %d attempts: %w", attempt, err)
+		}
+
+		delay := policy.delay(attempt)
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, err, delay)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("retry: %w after %d attempts, last error: %v", ctx.Err(), attempt, err)
+		case <-timer.C:
+		}
+	}
+}
+
+// delay returns how long to wait after the given failed attempt.
+func (p Policy) delay(attempt int) time.Duration {
+	d := float64(p.InitialDelay) * math.Pow(p.Multiplier, float64(attempt-1))
+	if d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		d -= d * p.Jitter * rand.Float64()
+	}
+	return time.Duration(d)
+}
@@ -0,0 +1,228 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/event-driven-architecture/eventbus"
+	"github.com/rajamummidi/go-design-patterns/saga/saga"
+)
+
+// Order is the data the steps of the order saga share.
+type Order struct {
+	ID       string
+	Item     string
+	Amount   int64
+	Address  string
+	Payment  string
+	Tracking string
+}
+
+// The three services are reached through the bus with request/reply, as
+// they would be over a broker if they ran in separate processes.
+const (
+	reserveStock  = "inventory.reserve"
+	releaseStock  = "inventory.release"
+	chargePayment = "payment.charge"
+	refundPayment = "payment.refund"
+	shipOrder     = "shipping.ship"
+)
+
+var slowPayments atomic.Bool
+
+func startServices(bus *eventbus.EventBus) {
+	var mu sync.Mutex
+	stock := map[string]int{"book": 2}
+	payments := map[string]string{}
+	refunded := map[string]bool{}
+
+	bus.Register(reserveStock, eventbus.DefaultPriority, func(e eventbus.Event) error {
+		order := e.Data.(Order)
+		mu.Lock()
+		defer mu.Unlock()
+		if stock[order.Item] == 0 {
+			return bus.Reply(e, fmt.Errorf("%s is out of stock", order.Item))
+		}
+		stock[order.Item]--
+		fmt.Printf("    inventory: reserved %s for %s, %d left\n", order.Item, order.ID, stock[order.Item])
+		return bus.Reply(e, nil)
+	})
+	bus.Register(releaseStock, eventbus.DefaultPriority, func(e eventbus.Event) error {
+		order := e.Data.(Order)
+		mu.Lock()
+		defer mu.Unlock()
+		stock[order.Item]++
+		fmt.Printf("    inventory: released %s for %s, %d left\n", order.Item, order.ID, stock[order.Item])
+		return bus.Reply(e, nil)
+	})
+	bus.Register(chargePayment, eventbus.DefaultPriority, func(e eventbus.Event) error {
+		order := e.Data.(Order)
+		if slowPayments.Load() {
+			time.Sleep(200 * time.Millisecond)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		// Charging is idempotent per order, because a resumed saga
+		// repeats the step that was interrupted.
+		id, ok := payments[order.ID]
+		if !ok {
+			id = fmt.Sprintf("pay-%d", len(payments)+1)
+			payments[order.ID] = id
+			fmt.Printf("    payment: charged %d for %s as %s\n", order.Amount, order.ID, id)
+		}
+		return bus.Reply(e, id)
+	})
+	bus.Register(refundPayment, eventbus.DefaultPriority, func(e eventbus.Event) error {
+		order := e.Data.(Order)
+		mu.Lock()
+		defer mu.Unlock()
+		if !refunded[order.Payment] {
+			refunded[order.Payment] = true
+			fmt.Printf("    payment: refunded %s\n", order.Payment)
+		}
+		return bus.Reply(e, nil)
+	})
+	bus.Register(shipOrder, eventbus.DefaultPriority, func(e eventbus.Event) error {
+		order := e.Data.(Order)
+		if order.Address == "Atlantis" {
+			return bus.Reply(e, errors.New("no carrier delivers to Atlantis"))
+		}
+		return bus.Reply(e, "TRK-"+order.ID)
+	})
+}
+
+func orderSaga(bus *eventbus.EventBus) saga.Saga[Order] {
+	call := func(ctx context.Context, topic string, order *Order) (interface{}, error) {
+		return bus.Request(ctx, topic, *order)
+	}
+	return saga.Saga[Order]{
+		Name: "place-order",
+		Steps: []saga.Step[Order]{
+			{
+				Name: "reserve-stock",
+				Action: func(ctx context.Context, o *Order) error {
+					_, err := call(ctx, reserveStock, o)
+					return err
+				},
+				Compensate: func(ctx context.Context, o *Order) error {
+					_, err := call(ctx, releaseStock, o)
+					return err
+				},
+			},
+			{
+				Name: "charge-payment",
+				Action: func(ctx context.Context, o *Order) error {
+					id, err := call(ctx, chargePayment, o)
+					if err == nil {
+						o.Payment = id.(string)
+					}
+					return err
+				},
+				Compensate: func(ctx context.Context, o *Order) error {
+					_, err := call(ctx, refundPayment, o)
+					return err
+				},
+			},
+			{
+				// The last step needs no compensation: nothing runs after
+				// it that could fail.
+				Name: "ship",
+				Action: func(ctx context.Context, o *Order) error {
+					tracking, err := call(ctx, shipOrder, o)
+					if err == nil {
+						o.Tracking = tracking.(string)
+					}
+					return err
+				},
+			},
+		},
+	}
+}
+
+func main() {
+	bus := eventbus.NewQueuedEventBus(eventbus.QueueConfig{Size: 64, Workers: 4})
+	defer bus.Close(context.Background())
+	startServices(bus)
+
+	// Progress goes to a synchronous bus, so it is printed in order with
+	// what the services print.
+	progress := eventbus.NewEventBus()
+	progress.Register(saga.EventPrefix+"*", eventbus.DefaultPriority, func(e eventbus.Event) error {
+		r := e.Data.(saga.Record)
+		fmt.Printf("  %-26s %s %s\n", e.Type, r.Step, r.Error)
+		return nil
+	})
+
+	dir, err := os.MkdirTemp("", "saga")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	log, err := saga.OpenFileLog(filepath.Join(dir, "sagas.log"))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer log.Close()
+
+	orchestrator := saga.NewOrchestrator(orderSaga(bus), log)
+	orchestrator.PublishTo(progress)
+
+	run := func(ctx context.Context, order Order) {
+		fmt.Printf("%s: %s to %s\n", order.ID, order.Item, order.Address)
+		result, err := orchestrator.Run(ctx, order.ID, order)
+		states, _ := orchestrator.StepStates(order.ID)
+		fmt.Printf("  => tracking %q, steps %v, error: %v\n\n", result.Tracking, states, err)
+	}
+
+	run(context.Background(), Order{ID: "order-1", Item: "book", Amount: 25_00, Address: "Hyderabad"})
+	run(context.Background(), Order{ID: "order-2", Item: "book", Amount: 25_00, Address: "Atlantis"})
+
+	// The process "crashes" while the payment is slow; the log knows where
+	// the saga was, and Resume picks it up again.
+	slowPayments.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	run(ctx, Order{ID: "order-3", Item: "book", Amount: 25_00, Address: "Chennai"})
+	cancel()
+	slowPayments.Store(false)
+	time.Sleep(200 * time.Millisecond)
+
+	fmt.Println("order-3: resuming")
+	result, err := orchestrator.Resume(context.Background(), "order-3")
+	fmt.Printf("  => tracking %q, payment %s, error: %v\n", result.Tracking, result.Payment, err)
+}
@@ -0,0 +1,161 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package saga
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Kind says what a log record is about.
+type Kind string
+
+const (
+	StepStarted            Kind = "step-started"
+	StepCompleted          Kind = "step-completed"
+	StepFailed             Kind = "step-failed"
+	StepCompensated        Kind = "step-compensated"
+	CompensationFailed     Kind = "compensation-failed"
+	SagaCompleted          Kind = "saga-completed"
+	SagaCompensated        Kind = "saga-compensated"
+	SagaCompensationFailed Kind = "saga-compensation-failed"
+)
+
+// Record is one entry of a saga's log. Data is the saga's data as JSON
+// after the step, so a resumed saga continues with what the steps had
+// stored in it.
+type Record struct {
+	SagaID string          `json:"saga_id"`
+	Saga   string          `json:"saga"`
+	Kind   Kind            `json:"kind"`
+	Step   string          `json:"step,omitempty"`
+	Index  int             `json:"index"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Time   time.Time       `json:"time"`
+}
+
+// Log records the progress of sagas so that they can be resumed after a
+// crash. Implementations must be safe for concurrent use.
+type Log interface {
+	Append(r Record) error
+	// Load returns the records of one saga in the order they were
+	// appended.
+	Load(sagaID string) ([]Record, error)
+}
+
+// MemoryLog keeps records in memory. It survives an interrupted Run, but
+// not the process.
+type MemoryLog struct {
+	mu      sync.Mutex
+	records map[string][]Record
+}
+
+func NewMemoryLog() *MemoryLog {
+	return &MemoryLog{records: make(map[string][]Record)}
+}
+
+func (l *MemoryLog) Append(r Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.records[r.SagaID] = append(l.records[r.SagaID], r)
+	return nil
+}
+
+func (l *MemoryLog) Load(sagaID string) ([]Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]Record(nil), l.records[sagaID]...), nil
+}
+
+// FileLog appends records to a file as JSON lines and syncs after each, so
+// that a step is never recorded as done before it is on disk.
+type FileLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+func OpenFileLog(path string) (*FileLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileLog{path: path, file: file}, nil
+}
+
+func (l *FileLog) Append(r Record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+// Load scans the whole file, which is fine for an example; a real log
+// would be indexed by saga or kept in a database.
+func (l *FileLog) Load(sagaID string) ([]Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, err
+		}
+		if r.SagaID == sagaID {
+			records = append(records, r)
+		}
+	}
+	return records, scanner.Err()
+}
+
+func (l *FileLog) Close() error {
+	return l.file.Close()
+}
@@ -0,0 +1,290 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package saga runs a business transaction that spans several services as
+// a sequence of local steps. Each step has a compensating action that
+// undoes it. If a step fails, the orchestrator compensates the steps that
+// succeeded, in reverse order, so the system ends up consistent without a
+// distributed lock or two-phase commit.
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrInterrupted is returned when ctx ended during a saga. The saga is
+	// left as it is and can be continued with Resume.
+	ErrInterrupted = errors.New("saga: interrupted")
+	// ErrFinished is returned by Resume for a saga that already completed
+	// or was compensated.
+	ErrFinished = errors.New("saga: already finished")
+	// ErrUnknown is returned by Resume when the log has no such saga.
+	ErrUnknown = errors.New("saga: unknown saga")
+)
+
+// Step is one local transaction of a saga. Action does the work and
+// Compensate undoes it; both may store what they need in data. A step that
+// fails is assumed to have had no effect and is not compensated. Actions
+// may run again when a saga is resumed, and compensations are retried, so
+// both should be idempotent.
+type Step[T any] struct {
+	Name       string
+	Action     func(ctx context.Context, data *T) error
+	Compensate func(ctx context.Context, data *T) error
+}
+
+// Saga is the definition of a saga: its steps in the order they run. T is
+// the data the steps share; it is stored in the log as JSON.
+type Saga[T any] struct {
+	Name  string
+	Steps []Step[T]
+}
+
+// Error is returned when a step failed. Compensated says whether every
+// completed step was undone; if not, CompensationErrors says what went
+// wrong and the saga needs attention.
+type Error struct {
+	Saga               string
+	Step               string
+	Err                error
+	Compensated        bool
+	CompensationErrors []error
+}
+
+func (e *Error) Error() string {
+	if e.Compensated {
+		return fmt.Sprintf("saga %s: step %s failed and was compensated: %v", e.Saga, e.Step, e.Err)
+	}
+	return fmt.Sprintf("saga %s: step %s failed: %v; compensation failed: %v", e.Saga, e.Step, e.Err, errors.Join(e.CompensationErrors...))
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Publisher is anything that can publish events, such as an EventBus.
+type Publisher interface {
+	Dispatch(eventType string, data interface{}) error
+}
+
+// EventPrefix starts the event types under which an orchestrator publishes
+// its log records, such as "saga.step-completed".
+const EventPrefix = "saga."
+
+// Orchestrator runs the sagas of one definition and records their progress
+// in a log.
+type Orchestrator[T any] struct {
+	saga      Saga[T]
+	log       Log
+	publisher Publisher
+
+	// CompensationAttempts is how often a failing compensation is tried
+	// before the orchestrator gives up on it (3).
+	CompensationAttempts int
+}
+
+func NewOrchestrator[T any](saga Saga[T], log Log) *Orchestrator[T] {
+	return &Orchestrator[T]{saga: saga, log: log, CompensationAttempts: 3}
+}
+
+// PublishTo makes the orchestrator publish every log record on p.
+func (o *Orchestrator[T]) PublishTo(p Publisher) {
+	o.publisher = p
+}
+
+// Run starts the saga id with data and runs it to the end. It returns the
+// data as the steps left it, and an *Error if a step failed.
+func (o *Orchestrator[T]) Run(ctx context.Context, id string, data T) (T, error) {
+	err := o.forward(ctx, id, &data, newSteps(len(o.saga.Steps)), 0)
+	return data, err
+}
+
+// Resume continues a saga that was interrupted, from the log: it reruns
+// the step that was in progress and carries on, or finishes the
+// compensation if one had started.
+func (o *Orchestrator[T]) Resume(ctx context.Context, id string) (T, error) {
+	data, st, failed, err := o.replay(id)
+	if err != nil {
+		return data, err
+	}
+
+	if i := st.first(StateFailed); i >= 0 {
+		err = o.compensate(ctx, id, &data, st, i, errors.New(failed))
+	} else {
+		err = o.forward(ctx, id, &data, st, st.first(StateRunning, StatePending))
+	}
+	return data, err
+}
+
+// StepStates returns the state of every step of the saga id, as its log
+// says.
+func (o *Orchestrator[T]) StepStates(id string) ([]StepState, error) {
+	_, st, _, err := o.replay(id)
+	if errors.Is(err, ErrFinished) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return st.states(), nil
+}
+
+// replay reads the log of the saga id back into the data and the states of
+// its steps. It returns the error of the failed step, if one failed, and
+// ErrFinished with the states of a saga that ended.
+func (o *Orchestrator[T]) replay(id string) (data T, st steps, failed string, err error) {
+	records, err := o.log.Load(id)
+	if err != nil {
+		return data, nil, "", err
+	}
+	if len(records) == 0 {
+		return data, nil, "", ErrUnknown
+	}
+
+	st = newSteps(len(o.saga.Steps))
+	for _, r := range records {
+		if r.Data != nil {
+			data = *new(T)
+			if err := json.Unmarshal(r.Data, &data); err != nil {
+				return data, nil, "", err
+			}
+		}
+		if err := st.apply(r); err != nil {
+			return data, nil, "", err
+		}
+		switch r.Kind {
+		case StepFailed:
+			failed = r.Error
+		case SagaCompleted, SagaCompensated, SagaCompensationFailed:
+			return data, st, failed, ErrFinished
+		}
+	}
+	return data, st, failed, nil
+}
+
+// forward runs the steps from index from on. A saga whose steps have all
+// completed starts at -1 and only records that it completed.
+func (o *Orchestrator[T]) forward(ctx context.Context, id string, data *T, st steps, from int) error {
+	for i := from; i >= 0 && i < len(o.saga.Steps); i++ {
+		step := o.saga.Steps[i]
+		if err := o.record(id, st, StepStarted, i, data, nil); err != nil {
+			return err
+		}
+		if err := step.Action(ctx, data); err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("%w in step %s: %v", ErrInterrupted, step.Name, err)
+			}
+			if err := o.record(id, st, StepFailed, i, data, err); err != nil {
+				return err
+			}
+			return o.compensate(ctx, id, data, st, i, err)
+		}
+		if err := o.record(id, st, StepCompleted, i, data, nil); err != nil {
+			return err
+		}
+	}
+	return o.record(id, st, SagaCompleted, len(o.saga.Steps)-1, data, nil)
+}
+
+// compensate undoes, in reverse order, the steps that completed before
+// step failed, including those whose compensation failed before.
+func (o *Orchestrator[T]) compensate(ctx context.Context, id string, data *T, st steps, failed int, cause error) error {
+	sagaErr := &Error{Saga: o.saga.Name, Step: o.saga.Steps[failed].Name, Err: cause}
+	for i := failed - 1; i >= 0; i-- {
+		step := o.saga.Steps[i]
+		state := st[i].State()
+		if state != StateCompleted && state != StateCompensationFailed || step.Compensate == nil {
+			continue
+		}
+		err := o.tryCompensate(ctx, step, data)
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w while compensating %s: %v", ErrInterrupted, step.Name, ctx.Err())
+		}
+		if err != nil {
+			sagaErr.CompensationErrors = append(sagaErr.CompensationErrors, fmt.Errorf("%s: %w", step.Name, err))
+			if err := o.record(id, st, CompensationFailed, i, data, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := o.record(id, st, StepCompensated, i, data, nil); err != nil {
+			return err
+		}
+	}
+
+	sagaErr.Compensated = len(sagaErr.CompensationErrors) == 0
+	final := SagaCompensated
+	if !sagaErr.Compensated {
+		final = SagaCompensationFailed
+	}
+	if err := o.record(id, st, final, failed-1, data, cause); err != nil {
+		return err
+	}
+	return sagaErr
+}
+
+func (o *Orchestrator[T]) tryCompensate(ctx context.Context, step Step[T], data *T) error {
+	var err error
+	for attempt := 0; attempt < o.CompensationAttempts || attempt == 0; attempt++ {
+		if err = step.Compensate(ctx, data); err == nil || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// record moves the step at index along with kind and appends the record
+// to the log.
+func (o *Orchestrator[T]) record(id string, st steps, kind Kind, index int, data *T, cause error) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	r := Record{SagaID: id, Saga: o.saga.Name, Kind: kind, Index: index, Data: encoded, Time: time.Now()}
+	if index >= 0 && index < len(o.saga.Steps) && kind != SagaCompleted && kind != SagaCompensated && kind != SagaCompensationFailed {
+		r.Step = o.saga.Steps[index].Name
+	}
+	if cause != nil {
+		r.Error = cause.Error()
+	}
+	if err := st.apply(r); err != nil {
+		return err
+	}
+	if err := o.log.Append(r); err != nil {
+		return fmt.Errorf("saga %s: recording %s: %w", id, kind, err)
+	}
+	if o.publisher != nil {
+		o.publisher.Dispatch(EventPrefix+string(kind), r)
+	}
+	return nil
+}
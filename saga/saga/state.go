@@ -0,0 +1,118 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package saga
+
+import (
+	"fmt"
+
+	"github.com/rajamummidi/go-design-patterns/state-machine/statemachine"
+)
+
+// StepState is where a step of one saga stands. The records of its log are
+// the events that move it along.
+type StepState string
+
+const (
+	StatePending            StepState = "pending"
+	StateRunning            StepState = "running"
+	StateCompleted          StepState = "completed"
+	StateFailed             StepState = "failed"
+	StateCompensated        StepState = "compensated"
+	StateCompensationFailed StepState = "compensation-failed"
+)
+
+// newStepMachine returns the lifecycle of a step. A running step may be
+// started again when its saga is resumed, and a step whose compensation
+// failed may be compensated again when its compensation is resumed.
+func newStepMachine() *statemachine.Machine[StepState, Kind] {
+	return statemachine.New[StepState, Kind](StatePending).
+		Permit(StatePending, StepStarted, StateRunning).
+		Permit(StateRunning, StepStarted, StateRunning).
+		Permit(StateRunning, StepCompleted, StateCompleted).
+		Permit(StateRunning, StepFailed, StateFailed).
+		Permit(StateCompleted, StepCompensated, StateCompensated).
+		Permit(StateCompleted, CompensationFailed, StateCompensationFailed).
+		Permit(StateCompensationFailed, StepCompensated, StateCompensated).
+		Permit(StateCompensationFailed, CompensationFailed, StateCompensationFailed)
+}
+
+// StepLifecycle renders the states a step goes through as a Graphviz
+// digraph.
+func StepLifecycle() string {
+	return newStepMachine().DOT()
+}
+
+// steps tracks the state of every step of one saga, as it runs or as its
+// log is replayed.
+type steps []*statemachine.Machine[StepState, Kind]
+
+func newSteps(n int) steps {
+	s := make(steps, n)
+	for i := range s {
+		s[i] = newStepMachine()
+	}
+	return s
+}
+
+// apply moves the step of r along. Records about the saga as a whole leave
+// the steps as they are. A record its step cannot take, such as a second
+// completion, means the log is not what the orchestrator wrote.
+func (s steps) apply(r Record) error {
+	switch r.Kind {
+	case SagaCompleted, SagaCompensated, SagaCompensationFailed:
+		return nil
+	}
+	if r.Index < 0 || r.Index >= len(s) {
+		return fmt.Errorf("saga %s: %s for unknown step %d", r.SagaID, r.Kind, r.Index)
+	}
+	if err := s[r.Index].Fire(r.Kind); err != nil {
+		return fmt.Errorf("saga %s: step %s: %w", r.SagaID, r.Step, err)
+	}
+	return nil
+}
+
+// first returns the index of the first step in one of states, or -1.
+func (s steps) first(states ...StepState) int {
+	for i, m := range s {
+		for _, state := range states {
+			if m.State() == state {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func (s steps) states() []StepState {
+	states := make([]StepState, len(s))
+	for i, m := range s {
+		states[i] = m.State()
+	}
+	return states
+}
@@ -0,0 +1,94 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/singleton/singleton"
+)
+
+// Config is the kind of object there should be only one of: loading it is
+// slow, and every part of the program must see the same settings.
+type Config struct {
+	Addr     string
+	LoadedAt time.Time
+}
+
+var loads atomic.Int32
+
+func loadConfig() (*Config, error) {
+	loads.Add(1)
+	time.Sleep(50 * time.Millisecond) // reading a file, asking a config service...
+	return &Config{Addr: ":8000", LoadedAt: time.Now()}, nil
+}
+
+// The classic form: a package-level instance guarded by a sync.Once.
+var (
+	instance *Config
+	once     sync.Once
+)
+
+// Instance returns the configuration, loading it on first use.
+func Instance() *Config {
+	once.Do(func() {
+		instance, _ = loadConfig()
+	})
+	return instance
+}
+
+// The generic form, which also keeps the error of the first load.
+var config = singleton.NewLazy(loadConfig)
+
+func main() {
+	var wg sync.WaitGroup
+	seen := make([]*Config, 10)
+	for i := range seen {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			seen[i] = Instance()
+		}(i)
+	}
+	wg.Wait()
+
+	same := true
+	for _, c := range seen {
+		same = same && c == seen[0]
+	}
+	fmt.Printf("10 goroutines, %d load, same instance: %v\n", loads.Load(), same)
+
+	loads.Store(0)
+	first, _ := config.Get()
+	second, _ := config.Get()
+	fmt.Printf("Lazy: %d load, same instance: %v, addr %s\n", loads.Load(), first == second, first.Addr)
+}
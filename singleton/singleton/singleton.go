@@ -0,0 +1,58 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package singleton creates a value once, on first use, however many
+// goroutines ask for it at the same time.
+package singleton
+
+import "sync"
+
+// Lazy holds a value that is created by the first call to Get. Later calls,
+// and calls made concurrently with the first, return the same value. If
+// creating it fails, every call returns the error; the value is not
+// created again.
+type Lazy[T any] struct {
+	once  sync.Once
+	new   func() (T, error)
+	value T
+	err   error
+}
+
+// NewLazy returns a Lazy that creates its value with fn.
+func NewLazy[T any](fn func() (T, error)) *Lazy[T] {
+	return &Lazy[T]{new: fn}
+}
+
+// Get returns the value, creating it on the first call.
+func (l *Lazy[T]) Get() (T, error) {
+	l.once.Do(func() {
+		l.value, l.err = l.new()
+		l.new = nil
+	})
+	return l.value, l.err
+}
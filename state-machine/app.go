@@ -0,0 +1,86 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"fmt"
+
+	"github.com/rajamummidi/go-design-patterns/state-machine/statemachine"
+)
+
+type State string
+
+const (
+	Locked   State = "locked"
+	Unlocked State = "unlocked"
+	Broken   State = "broken"
+)
+
+type Event string
+
+const (
+	Coin   Event = "coin"
+	Push   Event = "push"
+	Kick   Event = "kick"
+	Repair Event = "repair"
+)
+
+func main() {
+	coins := 0
+	turnstile := statemachine.New[State, Event](Locked).
+		Permit(Locked, Coin, Unlocked).
+		Permit(Unlocked, Push, Locked).
+		Permit(Unlocked, Coin, Unlocked).
+		PermitIf(Locked, Kick, Broken, "coins > 2", func() bool { return coins > 2 }).
+		Permit(Broken, Repair, Locked).
+		OnEnter(Unlocked, func(t statemachine.Transition[State, Event]) {
+			coins++
+			fmt.Printf("entered %s after %s, %d coins collected\n", t.To, t.Event, coins)
+		}).
+		OnExit(Broken, func(t statemachine.Transition[State, Event]) {
+			fmt.Println("turnstile repaired")
+		}).
+		KeepHistory(4)
+
+	for _, event := range []Event{Push, Coin, Push, Kick, Coin, Coin, Push, Kick, Repair} {
+		if err := turnstile.Fire(event); err != nil {
+			fmt.Printf("%s: %v\n", event, err)
+			continue
+		}
+		fmt.Printf("%s -> %s\n", event, turnstile.State())
+	}
+
+	fmt.Println("\nlast transitions:")
+	for _, r := range turnstile.History() {
+		fmt.Printf("%s  %s --%s--> %s\n", r.Time.Format("15:04:05.000"), r.From, r.Event, r.To)
+	}
+
+	fmt.Println()
+	fmt.Print(turnstile.DOT())
+}
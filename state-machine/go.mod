@@ -0,0 +1,3 @@
+module github.com/rajamummidi/go-design-patterns/state-machine
+
+go 1.20
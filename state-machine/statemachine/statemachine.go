@@ -0,0 +1,276 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package statemachine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidTransition is returned by Fire when the current state has no
+	// transition for the event.
+	ErrInvalidTransition = errors.New("statemachine: invalid transition")
+	// ErrGuardRejected is returned by Fire when the transitions for the event
+	// exist but none of their guards allowed it.
+	ErrGuardRejected = errors.New("statemachine: transition rejected by guard")
+)
+
+// Guard decides whether a transition may be taken.
+type Guard func() bool
+
+// Action runs when a state is entered or exited.
+type Action[S comparable, E comparable] func(t Transition[S, E])
+
+type Transition[S comparable, E comparable] struct {
+	From  S
+	Event E
+	To    S
+}
+
+// Record is a transition in the history of a machine.
+type Record[S comparable, E comparable] struct {
+	Transition[S, E]
+	Time time.Time
+}
+
+type edge[S comparable, E comparable] struct {
+	Transition[S, E]
+	guard     Guard
+	guardName string
+}
+
+// Machine is a finite state machine over states S and events E. Transitions,
+// guards and actions are configured up front; Fire moves the machine between
+// states. Actions run while the machine is locked and must not call Fire.
+type Machine[S comparable, E comparable] struct {
+	mu      sync.Mutex
+	current S
+	initial S
+	edges   []edge[S, E]
+	onEnter map[S][]Action[S, E]
+	onExit  map[S][]Action[S, E]
+	onAny   []Action[S, E]
+
+	history []Record[S, E] // ring of the last keep transitions
+	next    int
+	keep    int
+}
+
+func New[S comparable, E comparable](initial S) *Machine[S, E] {
+	return &Machine[S, E]{
+		current: initial,
+		initial: initial,
+		onEnter: make(map[S][]Action[S, E]),
+		onExit:  make(map[S][]Action[S, E]),
+	}
+}
+
+// Permit allows event to move the machine from one state to another.
+func (m *Machine[S, E]) Permit(from S, event E, to S) *Machine[S, E] {
+	return m.PermitIf(from, event, to, "", nil)
+}
+
+// PermitIf is like Permit, but the transition is only taken when guard
+// returns true. The name is used to label the edge in the DOT output. Several
+// guarded transitions may share a state and event; the first whose guard
+// passes is taken.
+func (m *Machine[S, E]) PermitIf(from S, event E, to S, name string, guard Guard) *Machine[S, E] {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.edges = append(m.edges, edge[S, E]{
+		Transition: Transition[S, E]{From: from, Event: event, To: to},
+		guard:      guard,
+		guardName:  name,
+	})
+	return m
+}
+
+func (m *Machine[S, E]) OnEnter(state S, action Action[S, E]) *Machine[S, E] {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onEnter[state] = append(m.onEnter[state], action)
+	return m
+}
+
+func (m *Machine[S, E]) OnExit(state S, action Action[S, E]) *Machine[S, E] {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onExit[state] = append(m.onExit[state], action)
+	return m
+}
+
+// OnTransition registers an action that runs on every transition, after
+// the exit actions of the old state and before the entry actions of the new
+// one.
+func (m *Machine[S, E]) OnTransition(action Action[S, E]) *Machine[S, E] {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.onAny = append(m.onAny, action)
+	return m
+}
+
+// KeepHistory makes the machine remember its last n transitions, for
+// History. It forgets those it remembered so far.
+func (m *Machine[S, E]) KeepHistory(n int) *Machine[S, E] {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.keep = n
+	m.history = nil
+	m.next = 0
+	return m
+}
+
+// History returns the transitions remembered since KeepHistory, oldest
+// first.
+func (m *Machine[S, E]) History() []Record[S, E] {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append(append([]Record[S, E](nil), m.history[m.next:]...), m.history[:m.next]...)
+}
+
+func (m *Machine[S, E]) State() S {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.current
+}
+
+// Can reports whether event would be accepted in the current state.
+func (m *Machine[S, E]) Can(event E) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := m.find(event)
+	return err == nil
+}
+
+// Fire applies event to the current state, running the exit actions of the
+// old state and the entry actions of the new one.
+func (m *Machine[S, E]) Fire(event E) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, err := m.find(event)
+	if err != nil {
+		return err
+	}
+
+	for _, action := range m.onExit[t.From] {
+		action(t)
+	}
+	m.current = t.To
+	m.remember(t)
+	for _, action := range m.onAny {
+		action(t)
+	}
+	for _, action := range m.onEnter[t.To] {
+		action(t)
+	}
+	return nil
+}
+
+func (m *Machine[S, E]) remember(t Transition[S, E]) {
+	if m.keep <= 0 {
+		return
+	}
+	r := Record[S, E]{Transition: t, Time: time.Now()}
+	if len(m.history) < m.keep {
+		m.history = append(m.history, r)
+		return
+	}
+	m.history[m.next] = r
+	m.next = (m.next + 1) % m.keep
+}
+
+func (m *Machine[S, E]) find(event E) (Transition[S, E], error) {
+	matched := false
+	for _, e := range m.edges {
+		if e.From != m.current || e.Event != event {
+			continue
+		}
+		matched = true
+		if e.guard == nil || e.guard() {
+			return e.Transition, nil
+		}
+	}
+	if matched {
+		return Transition[S, E]{}, fmt.Errorf("%w: %v on %v", ErrGuardRejected, event, m.current)
+	}
+	return Transition[S, E]{}, fmt.Errorf("%w: %v on %v", ErrInvalidTransition, event, m.current)
+}
+
+// DOT renders the configured transitions as a Graphviz digraph. The initial
+// state is drawn with a double border.
+func (m *Machine[S, E]) DOT() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	states := map[string]bool{fmt.Sprint(m.initial): true}
+	var b strings.Builder
+	b.WriteString("digraph {\n")
+	fmt.Fprintf(&b, "\t%q [shape=doublecircle];\n", fmt.Sprint(m.initial))
+	for _, e := range m.edges {
+		from, to := fmt.Sprint(e.From), fmt.Sprint(e.To)
+		states[from], states[to] = true, true
+
+		label := fmt.Sprint(e.Event)
+		if e.guard != nil {
+			name := e.guardName
+			if name == "" {
+				name = "guard"
+			}
+			label += " [" + name + "]"
+		}
+		fmt.Fprintf(&b, "\t%q -> %q [label=%q];\n", from, to, label)
+	}
+
+	names := make([]string, 0, len(states))
+	for name := range states {
+		if name != fmt.Sprint(m.initial) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "\t%q [shape=circle];\n", name)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
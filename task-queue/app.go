@@ -0,0 +1,105 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/resp/resp"
+	"github.com/rajamummidi/go-design-patterns/task-queue/taskqueue"
+)
+
+func main() {
+	addr := flag.String("redis", "", "address of a Redis server to keep the queue in, e.g. localhost:6379; in memory if empty")
+	flag.Parse()
+
+	var queue taskqueue.Queue = taskqueue.NewMemory()
+	if *addr != "" {
+		client := resp.NewClient(*addr)
+		defer client.Close()
+		queue = taskqueue.NewRedisQueue(client, fmt.Sprintf("demo-%d", time.Now().UnixNano()))
+	}
+	ctx := context.Background()
+	start := time.Now()
+	say := func(format string, args ...interface{}) {
+		fmt.Printf("%4dms  %s\n", time.Since(start).Milliseconds(), fmt.Sprintf(format, args...))
+	}
+
+	for _, job := range []taskqueue.Job{
+		{ID: "welcome-alice", Type: "email", Payload: []byte("Welcome, Alice!")},
+		{ID: "reset-bob", Type: "email", Payload: []byte("Your password reset code is 1234"), Priority: 10},
+		{ID: "reminder-alice", Type: "email", Payload: []byte("Your cart misses you"), RunAt: time.Now().Add(300 * time.Millisecond)},
+		{ID: "digest-carol", Type: "email", Payload: []byte("This week's digest")},
+		{ID: "invoice-dave", Type: "invoice", Payload: []byte("dave")},
+	} {
+		if _, err := queue.Enqueue(ctx, job); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	say("queued 5 jobs; the password reset goes first, the reminder waits 300ms")
+
+	// A worker takes the first job and crashes before it is done. Its
+	// heartbeat lapses, and the job goes to the next worker.
+	queue.Heartbeat(ctx, "crashing", 50*time.Millisecond)
+	if job, ok, _ := queue.Dequeue(ctx, "crashing"); ok {
+		say("worker crashing took %s and crashed", job.ID)
+	}
+
+	worker := taskqueue.NewWorker(queue, "worker-1")
+	worker.Poll = 10 * time.Millisecond
+	worker.Backoff = func(n int) time.Duration { return time.Duration(n) * 50 * time.Millisecond }
+	worker.Handle("email", func(ctx context.Context, job taskqueue.Job) error {
+		if job.ID == "digest-carol" && job.Attempts == 1 {
+			say("worker-1 could not send %s: mail server busy", job.ID)
+			return errors.New("mail server busy")
+		}
+		say("worker-1 sent %s (attempt %d): %s", job.ID, job.Attempts, job.Payload)
+		return nil
+	})
+	worker.Handle("invoice", func(ctx context.Context, job taskqueue.Job) error {
+		say("worker-1 failed to render %s (attempt %d)", job.ID, job.Attempts)
+		return errors.New("invoice template missing")
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 800*time.Millisecond)
+	defer cancel()
+	worker.Run(ctx)
+
+	dead, _ := queue.Dead(context.Background())
+	for _, job := range dead {
+		say("dead letter: %s after %d attempts: %s", job.ID, job.Attempts, job.LastError)
+	}
+	stats := worker.Stats()
+	say("worker-1 finished %d jobs, retried %d and buried %d", stats.Done, stats.Retried, stats.Buried)
+}
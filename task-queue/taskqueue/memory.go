@@ -0,0 +1,239 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package taskqueue
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory is a Queue in memory, for tests and for jobs that may be lost
+// when the process ends.
+type Memory struct {
+	mu      sync.Mutex
+	seq     uint64
+	jobs    map[string]*memoryJob
+	workers map[string]time.Time // heartbeat deadlines
+	dead    []string             // IDs, in the order they were buried
+}
+
+type memoryJob struct {
+	job  Job
+	due  time.Time
+	seq  uint64 // orders jobs of the same priority that are due together
+	dead bool
+}
+
+func NewMemory() *Memory {
+	return &Memory{jobs: make(map[string]*memoryJob), workers: make(map[string]time.Time)}
+}
+
+func (m *Memory) Enqueue(ctx context.Context, job Job) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if job.ID == "" {
+		job.ID = newID()
+	}
+	if _, ok := m.jobs[job.ID]; ok {
+		return "", ErrDuplicate
+	}
+	job.Attempts, job.Worker = 0, ""
+	j := &memoryJob{job: job}
+	m.schedule(j, job.RunAt, time.Now())
+	m.jobs[job.ID] = j
+	return job.ID, nil
+}
+
+// schedule makes j wait in the queue until at, or until now if at has
+// passed.
+func (m *Memory) schedule(j *memoryJob, at, now time.Time) {
+	if at.Before(now) {
+		at = now
+	}
+	m.seq++
+	j.job.Worker, j.due, j.seq, j.dead = "", at, m.seq, false
+}
+
+func (m *Memory) Dequeue(ctx context.Context, worker string) (Job, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for name, deadline := range m.workers {
+		if deadline.Before(now) {
+			delete(m.workers, name)
+		}
+	}
+	var next *memoryJob
+	for _, j := range m.jobs {
+		if j.job.Worker != "" {
+			if _, alive := m.workers[j.job.Worker]; alive {
+				continue
+			}
+			m.schedule(j, now, now)
+		}
+		if j.dead || j.due.After(now) {
+			continue
+		}
+		if next == nil || j.job.Priority > next.job.Priority ||
+			j.job.Priority == next.job.Priority && (j.due.Before(next.due) || j.due.Equal(next.due) && j.seq < next.seq) {
+			next = j
+		}
+	}
+	if next == nil {
+		return Job{}, false, nil
+	}
+	next.job.Attempts++
+	next.job.Worker = worker
+	return next.job, true, nil
+}
+
+// leased returns the job leased to job.Worker, or nil.
+func (m *Memory) leased(job Job) *memoryJob {
+	j, ok := m.jobs[job.ID]
+	if !ok || job.Worker == "" || j.job.Worker != job.Worker {
+		return nil
+	}
+	return j
+}
+
+func (m *Memory) Ack(ctx context.Context, job Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.leased(job) == nil {
+		return ErrNotFound
+	}
+	delete(m.jobs, job.ID)
+	return nil
+}
+
+func (m *Memory) Retry(ctx context.Context, job Job, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j := m.leased(job)
+	if j == nil {
+		return ErrNotFound
+	}
+	j.job.LastError = job.LastError
+	m.schedule(j, at, time.Now())
+	return nil
+}
+
+func (m *Memory) Bury(ctx context.Context, job Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j := m.leased(job)
+	if j == nil {
+		return ErrNotFound
+	}
+	j.job.LastError = job.LastError
+	j.job.Worker, j.dead = "", true
+	m.dead = append(m.dead, job.ID)
+	return nil
+}
+
+func (m *Memory) Dead(ctx context.Context) ([]Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jobs := make([]Job, 0, len(m.dead))
+	for _, id := range m.dead {
+		jobs = append(jobs, m.jobs[id].job)
+	}
+	return jobs, nil
+}
+
+func (m *Memory) Requeue(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok || !j.dead {
+		return ErrNotFound
+	}
+	for i, dead := range m.dead {
+		if dead == id {
+			m.dead = append(m.dead[:i], m.dead[i+1:]...)
+			break
+		}
+	}
+	j.job.Attempts = 0
+	m.schedule(j, time.Time{}, time.Now())
+	return nil
+}
+
+func (m *Memory) Heartbeat(ctx context.Context, worker string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.workers[worker] = time.Now().Add(ttl)
+	return nil
+}
+
+func (m *Memory) Workers(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var names []string
+	for name, deadline := range m.workers {
+		if !deadline.Before(now) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *Memory) Stats(ctx context.Context) (Stats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var s Stats
+	for _, j := range m.jobs {
+		switch {
+		case j.dead:
+			s.Dead++
+		case j.job.Worker != "":
+			s.Active++
+		case j.due.After(now):
+			s.Delayed++
+		default:
+			s.Ready++
+		}
+	}
+	return s, nil
+}
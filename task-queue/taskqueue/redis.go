@@ -0,0 +1,319 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package taskqueue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/resp/resp"
+)
+
+// prelude starts every script. The keys are passed in the order of
+// RedisQueue.keys. A job that is due waits in the ready set with its
+// negated priority as its score, so ZPOPMIN takes the highest priority
+// first, and a sequence number in front of its ID, so that ties go to the
+// job that became due first.
+const prelude = `local jobs, priority, attempts, ready, delayed, active, workers, dead, seq = unpack(KEYS)
+local function make_ready(id)
+	local member = string.format('%016d:%s', redis.call('INCR', seq), id)
+	redis.call('ZADD', ready, -tonumber(redis.call('HGET', priority, id)), member)
+end
+local function promote(now)
+	for _, id in ipairs(redis.call('ZRANGEBYSCORE', delayed, '-inf', now)) do
+		redis.call('ZREM', delayed, id)
+		make_ready(id)
+	end
+end
+`
+
+// enqueueScript adds a job: ARGV is its ID, its JSON, its priority, when it
+// is due and the current time, in milliseconds.
+const enqueueScript = prelude + `
+if redis.call('HEXISTS', jobs, ARGV[1]) == 1 then
+	return 0
+end
+redis.call('HSET', jobs, ARGV[1], ARGV[2])
+redis.call('HSET', priority, ARGV[1], ARGV[3])
+promote(ARGV[5])
+if tonumber(ARGV[4]) > tonumber(ARGV[5]) then
+	redis.call('ZADD', delayed, ARGV[4], ARGV[1])
+else
+	make_ready(ARGV[1])
+end
+return 1`
+
+// dequeueScript leases the next due job to the worker ARGV[2] at the time
+// ARGV[1], after returning the jobs of workers whose heartbeat expired to
+// the queue. It returns the job's JSON and attempts.
+const dequeueScript = prelude + `
+local now = tonumber(ARGV[1])
+local leased = redis.call('HGETALL', active)
+for i = 1, #leased, 2 do
+	local beat = redis.call('ZSCORE', workers, leased[i + 1])
+	if not beat or tonumber(beat) < now then
+		redis.call('HDEL', active, leased[i])
+		make_ready(leased[i])
+	end
+end
+redis.call('ZREMRANGEBYSCORE', workers, '-inf', '(' .. now)
+promote(now)
+local next = redis.call('ZPOPMIN', ready)
+if #next == 0 then
+	return false
+end
+local id = string.match(next[1], '^%d+:(.*)$')
+redis.call('HSET', active, id, ARGV[2])
+return {redis.call('HGET', jobs, id), redis.call('HINCRBY', attempts, id, 1)}`
+
+// settle starts the scripts that end the lease of the job ARGV[1] held by
+// the worker ARGV[2].
+const settle = prelude + `
+if redis.call('HGET', active, ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('HDEL', active, ARGV[1])
+`
+
+const ackScript = settle + `
+redis.call('HDEL', jobs, ARGV[1])
+redis.call('HDEL', priority, ARGV[1])
+redis.call('HDEL', attempts, ARGV[1])
+return 1`
+
+// retryScript stores the job's JSON ARGV[3] and delays it until ARGV[4].
+const retryScript = settle + `
+redis.call('HSET', jobs, ARGV[1], ARGV[3])
+redis.call('ZADD', delayed, ARGV[4], ARGV[1])
+return 1`
+
+// buryScript stores the job's JSON ARGV[3] and buries it at ARGV[4].
+const buryScript = settle + `
+redis.call('HSET', jobs, ARGV[1], ARGV[3])
+redis.call('ZADD', dead, ARGV[4], ARGV[1])
+return 1`
+
+const requeueScript = prelude + `
+if redis.call('ZREM', dead, ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HDEL', attempts, ARGV[1])
+make_ready(ARGV[1])
+return 1`
+
+// deadScript returns the JSON and attempts of every buried job.
+const deadScript = prelude + `
+local out = {}
+for _, id in ipairs(redis.call('ZRANGE', dead, 0, -1)) do
+	table.insert(out, redis.call('HGET', jobs, id))
+	table.insert(out, tonumber(redis.call('HGET', attempts, id) or '0'))
+end
+return out`
+
+const statsScript = prelude + `
+promote(ARGV[1])
+return {redis.call('ZCARD', ready), redis.call('ZCARD', delayed), redis.call('HLEN', active), redis.call('ZCARD', dead)}`
+
+// RedisQueue is a Queue in Redis, for workers on any host. Each change is
+// a Lua script, so it happens at once even with many workers. The queue
+// named name lives in keys starting with "taskqueue:<name>:". The scripts
+// take the time from the caller, so the clocks of the hosts must agree to
+// well within a heartbeat.
+type RedisQueue struct {
+	client *resp.Client
+	prefix string
+}
+
+// NewRedisQueue returns the queue name in the Redis server of client.
+// Closing client is up to the caller.
+func NewRedisQueue(client *resp.Client, name string) *RedisQueue {
+	return &RedisQueue{client: client, prefix: "taskqueue:" + name + ":"}
+}
+
+func (q *RedisQueue) keys() []string {
+	names := []string{"jobs", "priority", "attempts", "ready", "delayed", "active", "workers", "dead", "seq"}
+	keys := make([]string, len(names))
+	for i, name := range names {
+		keys[i] = q.prefix + name
+	}
+	return keys
+}
+
+// eval runs script with the queue's keys and args.
+func (q *RedisQueue) eval(ctx context.Context, script string, args ...string) (interface{}, error) {
+	keys := q.keys()
+	cmd := append([]string{"EVAL", script, strconv.Itoa(len(keys))}, keys...)
+	return q.client.Do(ctx, append(cmd, args...)...)
+}
+
+// changed turns the reply of a script that returns 1 or 0 into an error.
+func changed(reply interface{}, err error) error {
+	if err == nil && reply != int64(1) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func millis(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+func (q *RedisQueue) Enqueue(ctx context.Context, job Job) (string, error) {
+	if job.ID == "" {
+		job.ID = newID()
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	runAt := job.RunAt
+	if runAt.Before(now) {
+		runAt = now
+	}
+	reply, err := q.eval(ctx, enqueueScript, job.ID, string(data), strconv.Itoa(job.Priority), millis(runAt), millis(now))
+	if err != nil {
+		return "", err
+	}
+	if reply != int64(1) {
+		return "", ErrDuplicate
+	}
+	return job.ID, nil
+}
+
+func (q *RedisQueue) Dequeue(ctx context.Context, worker string) (Job, bool, error) {
+	reply, err := q.eval(ctx, dequeueScript, millis(time.Now()), worker)
+	if err != nil || reply == nil {
+		return Job{}, false, err
+	}
+	job, err := decodeJob(reply, 0)
+	if err != nil {
+		return Job{}, false, err
+	}
+	job.Worker = worker
+	return job, true, nil
+}
+
+// decodeJob decodes the JSON and the attempts of a job at reply[i] and
+// reply[i+1].
+func decodeJob(reply interface{}, i int) (Job, error) {
+	fields, ok := reply.([]interface{})
+	if !ok || len(fields) < i+2 {
+		return Job{}, fmt.Errorf("taskqueue: unexpected redis reply %v", reply)
+	}
+	data, _ := fields[i].(string)
+	attempts, _ := fields[i+1].(int64)
+	var job Job
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		return Job{}, err
+	}
+	job.Attempts = int(attempts)
+	return job, nil
+}
+
+func (q *RedisQueue) Ack(ctx context.Context, job Job) error {
+	return changed(q.eval(ctx, ackScript, job.ID, job.Worker))
+}
+
+func (q *RedisQueue) Retry(ctx context.Context, job Job, at time.Time) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return changed(q.eval(ctx, retryScript, job.ID, job.Worker, string(data), millis(at)))
+}
+
+func (q *RedisQueue) Bury(ctx context.Context, job Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return changed(q.eval(ctx, buryScript, job.ID, job.Worker, string(data), millis(time.Now())))
+}
+
+func (q *RedisQueue) Dead(ctx context.Context) ([]Job, error) {
+	reply, err := q.eval(ctx, deadScript)
+	if err != nil {
+		return nil, err
+	}
+	fields, _ := reply.([]interface{})
+	jobs := make([]Job, 0, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		job, err := decodeJob(fields, i)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (q *RedisQueue) Requeue(ctx context.Context, id string) error {
+	return changed(q.eval(ctx, requeueScript, id))
+}
+
+func (q *RedisQueue) Heartbeat(ctx context.Context, worker string, ttl time.Duration) error {
+	_, err := q.client.Do(ctx, "ZADD", q.prefix+"workers", millis(time.Now().Add(ttl)), worker)
+	return err
+}
+
+func (q *RedisQueue) Workers(ctx context.Context) ([]string, error) {
+	reply, err := q.client.Do(ctx, "ZRANGEBYSCORE", q.prefix+"workers", millis(time.Now()), "+inf")
+	if err != nil {
+		return nil, err
+	}
+	members, _ := reply.([]interface{})
+	names := make([]string, 0, len(members))
+	for _, member := range members {
+		name, _ := member.(string)
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (q *RedisQueue) Stats(ctx context.Context) (Stats, error) {
+	reply, err := q.eval(ctx, statsScript, millis(time.Now()))
+	if err != nil {
+		return Stats{}, err
+	}
+	counts, _ := reply.([]interface{})
+	if len(counts) != 4 {
+		return Stats{}, fmt.Errorf("taskqueue: unexpected redis reply %v", reply)
+	}
+	n := func(i int) int {
+		c, _ := counts[i].(int64)
+		return int(c)
+	}
+	return Stats{Ready: n(0), Delayed: n(1), Active: n(2), Dead: n(3)}, nil
+}
@@ -0,0 +1,319 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package taskqueue runs jobs in the background. Jobs wait in a queue until
+// they are due, and workers take them in order of priority. A job that fails
+// runs again after a delay, and once it has failed too often it is parked
+// in a dead-letter queue for someone to look at. Workers send heartbeats,
+// and the jobs of a worker that stops sending them go back to the queue.
+package taskqueue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrDuplicate is returned by Enqueue for a job whose ID is already in
+	// the queue, so a producer that retries cannot queue a job twice.
+	ErrDuplicate = errors.New("taskqueue: duplicate job ID")
+
+	// ErrNotFound is returned for a job that is not where the call expects
+	// it: not leased to the worker that settles it, for example because its
+	// heartbeat expired and the job went to another worker, or not in the
+	// dead-letter queue.
+	ErrNotFound = errors.New("taskqueue: no such job")
+)
+
+// Job is a unit of work.
+type Job struct {
+	// ID identifies the job. Enqueue makes one up if it is empty.
+	ID string `json:"id"`
+
+	// Type selects the handler that runs the job.
+	Type    string `json:"type"`
+	Payload []byte `json:"payload,omitempty"`
+
+	// Priority orders the jobs that are due: higher first, and among equal
+	// priorities in the order they became due.
+	Priority int `json:"priority,omitempty"`
+
+	// RunAt delays the job until then. A zero RunAt means now.
+	RunAt time.Time `json:"run_at"`
+
+	// MaxAttempts, if set, overrides the MaxAttempts of the worker.
+	MaxAttempts int `json:"max_attempts,omitempty"`
+
+	// LastError is the error of the latest failed attempt.
+	LastError string `json:"last_error,omitempty"`
+
+	// Attempts is how often the job was handed to a worker, this time
+	// included, and Worker the worker it is leased to. The queue sets them.
+	Attempts int    `json:"-"`
+	Worker   string `json:"-"`
+}
+
+// Stats counts the jobs of a queue by state.
+type Stats struct {
+	Ready   int `json:"ready"`   // due, waiting for a worker
+	Delayed int `json:"delayed"` // waiting until their RunAt
+	Active  int `json:"active"`  // leased to a worker
+	Dead    int `json:"dead"`    // in the dead-letter queue
+}
+
+// Queue keeps jobs between the producers and the workers. Memory keeps them
+// in memory, for tests and single processes; RedisQueue keeps them in
+// Redis, where workers on any host share them.
+type Queue interface {
+	// Enqueue adds job and returns its ID.
+	Enqueue(ctx context.Context, job Job) (string, error)
+
+	// Dequeue leases the next due job to worker. The jobs of workers whose
+	// heartbeat has expired go back to the queue first, so a worker must
+	// send one before it dequeues. ok is false if no job is due.
+	Dequeue(ctx context.Context, worker string) (job Job, ok bool, err error)
+
+	// Ack removes a leased job that is done.
+	Ack(ctx context.Context, job Job) error
+
+	// Retry puts a leased job back to run again at at, with its LastError.
+	Retry(ctx context.Context, job Job, at time.Time) error
+
+	// Bury moves a leased job to the dead-letter queue, with its LastError.
+	Bury(ctx context.Context, job Job) error
+
+	// Dead returns the jobs in the dead-letter queue, in the order they were
+	// buried.
+	Dead(ctx context.Context) ([]Job, error)
+
+	// Requeue moves the job with the given ID from the dead-letter queue
+	// back to the queue, with its attempts reset, once whatever made it
+	// fail has been fixed.
+	Requeue(ctx context.Context, id string) error
+
+	// Heartbeat tells the queue that worker is alive for the next ttl.
+	Heartbeat(ctx context.Context, worker string, ttl time.Duration) error
+
+	// Workers returns the names of the workers whose heartbeat has not
+	// expired, sorted.
+	Workers(ctx context.Context) ([]string, error)
+
+	Stats(ctx context.Context) (Stats, error)
+}
+
+// newID returns a random job ID.
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Handler runs a job. An error, or a panic, makes the job run again later,
+// until it has used up its attempts.
+type Handler func(ctx context.Context, job Job) error
+
+// WorkerStats counts the jobs a worker has settled.
+type WorkerStats struct {
+	Done    uint64 `json:"done"`
+	Retried uint64 `json:"retried"`
+	Buried  uint64 `json:"buried"`
+}
+
+// Worker takes jobs from a queue one at a time and runs the handler
+// registered for their type. Several workers, in one process or many, can
+// share a queue.
+type Worker struct {
+	queue    Queue
+	name     string
+	handlers map[string]Handler
+
+	// MaxAttempts is how often a job runs at most before it is buried (3).
+	MaxAttempts int
+
+	// Backoff returns how long a job waits after its n-th failed attempt.
+	// By default it waits a second, doubled after every attempt up to a
+	// minute.
+	Backoff func(n int) time.Duration
+
+	// Heartbeat is how often the worker sends a heartbeat (1s). The queue
+	// counts it as gone after three missed ones.
+	Heartbeat time.Duration
+
+	// Poll is how long the worker waits when no job is due (100ms).
+	Poll time.Duration
+
+	done, retried, buried atomic.Uint64
+}
+
+// NewWorker returns a worker called name, which must be unique among the
+// workers of queue.
+func NewWorker(queue Queue, name string) *Worker {
+	return &Worker{queue: queue, name: name, handlers: make(map[string]Handler)}
+}
+
+// Handle registers handler for jobs of jobType. Jobs of a type without a
+// handler are buried. Handle must be called before Run.
+func (w *Worker) Handle(jobType string, handler Handler) {
+	w.handlers[jobType] = handler
+}
+
+// Run sends heartbeats and runs jobs until ctx is done. A job that is
+// running when ctx is done is retried.
+func (w *Worker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	interval := w.heartbeat()
+	if err := w.queue.Heartbeat(ctx, w.name, 3*interval); err != nil {
+		fmt.Printf("Task queue worker %s: %v\n", w.name, err)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := w.queue.Heartbeat(ctx, w.name, 3*interval); err != nil && ctx.Err() == nil {
+					fmt.Printf("Task queue worker %s: %v\n", w.name, err)
+				}
+			}
+		}
+	}()
+
+	poll := w.Poll
+	if poll <= 0 {
+		poll = 100 * time.Millisecond
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		job, ok, err := w.queue.Dequeue(ctx, w.name)
+		if err != nil && ctx.Err() == nil {
+			fmt.Printf("Task queue worker %s: %v\n", w.name, err)
+		}
+		if !ok {
+			timer.Reset(poll)
+			continue
+		}
+		if err := w.process(ctx, job); err != nil {
+			fmt.Printf("Task queue worker %s: settling %s: %v\n", w.name, job.ID, err)
+		}
+		timer.Reset(0)
+	}
+}
+
+// process runs a job and acks, retries or buries it.
+func (w *Worker) process(ctx context.Context, job Job) error {
+	maxAttempts := job.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = w.MaxAttempts
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+	// Settle the job even if ctx is done, so it is not left to wait until
+	// the heartbeat expires.
+	settle := context.WithoutCancel(ctx)
+
+	if job.Attempts > maxAttempts {
+		// Workers went away while running the job, maybe because it made
+		// them crash.
+		job.LastError = fmt.Sprintf("abandoned by %d workers", job.Attempts-1)
+		w.buried.Add(1)
+		return w.queue.Bury(settle, job)
+	}
+	handler, ok := w.handlers[job.Type]
+	if !ok {
+		job.LastError = fmt.Sprintf("no handler for jobs of type %q", job.Type)
+		w.buried.Add(1)
+		return w.queue.Bury(settle, job)
+	}
+
+	err := run(ctx, handler, job)
+	if err == nil {
+		w.done.Add(1)
+		return w.queue.Ack(settle, job)
+	}
+	job.LastError = err.Error()
+	if job.Attempts >= maxAttempts {
+		w.buried.Add(1)
+		return w.queue.Bury(settle, job)
+	}
+	w.retried.Add(1)
+	return w.queue.Retry(settle, job, time.Now().Add(w.backoff(job.Attempts)))
+}
+
+// run calls handler, turning a panic into an error.
+func run(ctx context.Context, handler Handler, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+func (w *Worker) heartbeat() time.Duration {
+	if w.Heartbeat <= 0 {
+		return time.Second
+	}
+	return w.Heartbeat
+}
+
+func (w *Worker) backoff(n int) time.Duration {
+	if w.Backoff != nil {
+		return w.Backoff(n)
+	}
+	d := time.Second << (n - 1)
+	if n > 6 || d > time.Minute {
+		return time.Minute
+	}
+	return d
+}
+
+// Stats returns the counts of the jobs the worker has settled.
+func (w *Worker) Stats() WorkerStats {
+	return WorkerStats{Done: w.done.Load(), Retried: w.retried.Load(), Buried: w.buried.Load()}
+}
@@ -0,0 +1,240 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package taskqueue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/resp/resp"
+)
+
+// forEachQueue runs test on a Memory queue and, if $REDIS_ADDR is set, on a
+// RedisQueue of its own:
+//
+//	REDIS_ADDR=localhost:6379 go test ./taskqueue
+func forEachQueue(t *testing.T, test func(t *testing.T, q Queue)) {
+	t.Run("memory", func(t *testing.T) { test(t, NewMemory()) })
+	t.Run("redis", func(t *testing.T) {
+		addr := os.Getenv("REDIS_ADDR")
+		if addr == "" {
+			t.Skip("REDIS_ADDR is not set")
+		}
+		client := resp.NewClient(addr)
+		client.Password = os.Getenv("REDIS_PASSWORD")
+		t.Cleanup(func() { client.Close() })
+		test(t, NewRedisQueue(client, "test-"+newID()))
+	})
+}
+
+// next dequeues a job for worker, failing the test if there is none.
+func next(t *testing.T, q Queue, worker string) Job {
+	t.Helper()
+	job, ok, err := q.Dequeue(context.Background(), worker)
+	if err != nil || !ok {
+		t.Fatalf("Dequeue: got ok %v, err %v; want a job", ok, err)
+	}
+	return job
+}
+
+func expectEmpty(t *testing.T, q Queue, worker string) {
+	t.Helper()
+	if job, ok, err := q.Dequeue(context.Background(), worker); err != nil || ok {
+		t.Fatalf("Dequeue: got %+v, %v; want no job", job, err)
+	}
+}
+
+func TestPriorities(t *testing.T) {
+	forEachQueue(t, func(t *testing.T, q Queue) {
+		ctx := context.Background()
+		q.Heartbeat(ctx, "w1", time.Minute)
+		for _, job := range []Job{
+			{ID: "a", Type: "email"},
+			{ID: "b", Type: "email", Priority: 5},
+			{ID: "c", Type: "email"},
+			{ID: "d", Type: "email", Priority: 5},
+		} {
+			if _, err := q.Enqueue(ctx, job); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := q.Enqueue(ctx, Job{ID: "a", Type: "email"}); !errors.Is(err, ErrDuplicate) {
+			t.Fatalf("enqueueing a twice: got %v, want ErrDuplicate", err)
+		}
+
+		for _, want := range []string{"b", "d", "a", "c"} {
+			job := next(t, q, "w1")
+			if job.ID != want || job.Attempts != 1 || job.Worker != "w1" {
+				t.Fatalf("got %s, attempt %d, worker %q; want %s, attempt 1, worker w1", job.ID, job.Attempts, job.Worker, want)
+			}
+			if err := q.Ack(ctx, job); err != nil {
+				t.Fatal(err)
+			}
+		}
+		expectEmpty(t, q, "w1")
+	})
+}
+
+func TestDelay(t *testing.T) {
+	forEachQueue(t, func(t *testing.T, q Queue) {
+		ctx := context.Background()
+		q.Heartbeat(ctx, "w1", time.Minute)
+		id, err := q.Enqueue(ctx, Job{Type: "reminder", RunAt: time.Now().Add(100 * time.Millisecond)})
+		if err != nil || id == "" {
+			t.Fatalf("Enqueue: got ID %q, err %v", id, err)
+		}
+		expectEmpty(t, q, "w1")
+		if s, _ := q.Stats(ctx); s != (Stats{Delayed: 1}) {
+			t.Fatalf("stats before the job is due: %+v", s)
+		}
+
+		time.Sleep(150 * time.Millisecond)
+		if s, _ := q.Stats(ctx); s != (Stats{Ready: 1}) {
+			t.Fatalf("stats once the job is due: %+v", s)
+		}
+		if job := next(t, q, "w1"); job.ID != id {
+			t.Fatalf("got job %s, want %s", job.ID, id)
+		}
+	})
+}
+
+// TestLostWorker checks that the jobs of a worker whose heartbeat expired go
+// to another worker, and that the lost worker can no longer settle them.
+func TestLostWorker(t *testing.T) {
+	forEachQueue(t, func(t *testing.T, q Queue) {
+		ctx := context.Background()
+		q.Enqueue(ctx, Job{ID: "report", Type: "report"})
+		q.Heartbeat(ctx, "w1", 50*time.Millisecond)
+		lost := next(t, q, "w1")
+
+		q.Heartbeat(ctx, "w2", time.Minute)
+		expectEmpty(t, q, "w2")
+		time.Sleep(100 * time.Millisecond)
+		if workers, _ := q.Workers(ctx); len(workers) != 1 || workers[0] != "w2" {
+			t.Fatalf("workers: got %v, want [w2]", workers)
+		}
+
+		job := next(t, q, "w2")
+		if job.ID != "report" || job.Attempts != 2 {
+			t.Fatalf("got %s, attempt %d; want report, attempt 2", job.ID, job.Attempts)
+		}
+		if err := q.Ack(ctx, lost); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Ack by the lost worker: got %v, want ErrNotFound", err)
+		}
+		if err := q.Ack(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+		if s, _ := q.Stats(ctx); s != (Stats{}) {
+			t.Fatalf("stats after Ack: %+v", s)
+		}
+	})
+}
+
+// TestWorker runs a worker with a job that succeeds on its second attempt,
+// one that always fails and one of a type without a handler.
+func TestWorker(t *testing.T) {
+	forEachQueue(t, func(t *testing.T, q Queue) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var calls atomic.Int32
+		w := NewWorker(q, "w1")
+		w.Poll = 5 * time.Millisecond
+		w.Backoff = func(n int) time.Duration { return 10 * time.Millisecond }
+		w.Handle("flaky", func(ctx context.Context, job Job) error {
+			if job.Attempts == 1 {
+				return errors.New("mail server busy")
+			}
+			return nil
+		})
+		w.Handle("broken", func(ctx context.Context, job Job) error {
+			calls.Add(1)
+			panic("template missing")
+		})
+
+		q.Enqueue(ctx, Job{ID: "flaky", Type: "flaky"})
+		q.Enqueue(ctx, Job{ID: "broken", Type: "broken"})
+		q.Enqueue(ctx, Job{ID: "unknown", Type: "fax"})
+		done := make(chan struct{})
+		go func() {
+			w.Run(ctx)
+			close(done)
+		}()
+
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if s, _ := q.Stats(ctx); s == (Stats{Dead: 2}) {
+				break
+			}
+			if time.Now().After(deadline) {
+				s, _ := q.Stats(ctx)
+				t.Fatalf("stats: got %+v, want two dead jobs and nothing else", s)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		cancel()
+		<-done
+
+		if got, want := w.Stats(), (WorkerStats{Done: 1, Retried: 3, Buried: 2}); got != want {
+			t.Errorf("worker stats: got %+v, want %+v", got, want)
+		}
+		if n := calls.Load(); n != 3 {
+			t.Errorf("the broken job ran %d times, want 3", n)
+		}
+		dead, err := q.Dead(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byID := make(map[string]Job)
+		for _, job := range dead {
+			byID[job.ID] = job
+		}
+		if job := byID["broken"]; job.Attempts != 3 || job.LastError != "panic: template missing" {
+			t.Errorf("dead broken job: %+v", job)
+		}
+		if job := byID["unknown"]; job.Attempts != 1 || job.LastError != `no handler for jobs of type "fax"` {
+			t.Errorf("dead unknown job: %+v", job)
+		}
+
+		if err := q.Requeue(ctx, "broken"); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.Requeue(ctx, "flaky"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("requeueing a job that is not dead: got %v, want ErrNotFound", err)
+		}
+		q.Heartbeat(ctx, "w2", time.Minute)
+		if job := next(t, q, "w2"); job.ID != "broken" || job.Attempts != 1 {
+			t.Fatalf("after Requeue: got %s, attempt %d; want broken, attempt 1", job.ID, job.Attempts)
+		}
+	})
+}
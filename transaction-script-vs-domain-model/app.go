@@ -0,0 +1,123 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rajamummidi/go-design-patterns/transaction-script-vs-domain-model/db"
+	"github.com/rajamummidi/go-design-patterns/transaction-script-vs-domain-model/domainmodel"
+	"github.com/rajamummidi/go-design-patterns/transaction-script-vs-domain-model/ordering"
+	"github.com/rajamummidi/go-design-patterns/transaction-script-vs-domain-model/transactionscript"
+)
+
+// seed fills a fresh database with the demo data, the same data the
+// conformance suite in ordering/orderingtest starts from.
+func seed() *db.DB {
+	d := db.New()
+	d.Update(func(tx *db.Tx) error {
+		tx.PutProduct(db.ProductRow{SKU: "pen", Name: "Pen", Price: 2_50, Stock: 100})
+		tx.PutProduct(db.ProductRow{SKU: "book", Name: "Book", Price: 40_00, Stock: 5})
+		tx.PutProduct(db.ProductRow{SKU: "lamp", Name: "Lamp", Price: 80_00, Stock: 2})
+		tx.PutCustomer(db.CustomerRow{ID: "alice", Name: "Alice", CreditLimit: 500_00})
+		tx.PutCustomer(db.CustomerRow{ID: "bob", Name: "Bob", CreditLimit: 50_00})
+		return nil
+	})
+	return d
+}
+
+func stock(d *db.DB, sku string) int {
+	var row db.ProductRow
+	d.View(func(tx *db.Tx) error { row, _ = tx.Product(sku); return nil })
+	return row.Stock
+}
+
+func balance(d *db.DB, customer string) int64 {
+	var row db.CustomerRow
+	d.View(func(tx *db.Tx) error { row, _ = tx.Customer(customer); return nil })
+	return row.Balance
+}
+
+func main() {
+	implementations := []struct {
+		name string
+		new  func(d *db.DB) ordering.Service
+	}{
+		{"transaction script", func(d *db.DB) ordering.Service { return transactionscript.New(d) }},
+		{"domain model", func(d *db.DB) ordering.Service { return domainmodel.New(d) }},
+	}
+
+	for _, impl := range implementations {
+		fmt.Println(impl.name)
+		d := seed()
+		s := impl.new(d)
+
+		id, err := s.PlaceOrder("alice", []ordering.Line{{SKU: "book", Quantity: 3}})
+		if err != nil {
+			fmt.Println("  place:", err)
+			continue
+		}
+		order, _ := s.Order(id)
+		fmt.Printf("  placed %s for %d cents, %d books left, alice owes %d\n", id, order.Total, stock(d, "book"), balance(d, "alice"))
+		if err := s.CancelOrder(id); err != nil {
+			fmt.Println("  cancel:", err)
+		}
+		fmt.Printf("  cancelled %s, %d books left, alice owes %d\n", id, stock(d, "book"), balance(d, "alice"))
+
+		_, err = s.PlaceOrder("bob", []ordering.Line{{SKU: "lamp", Quantity: 1}})
+		fmt.Println("  bob orders a lamp:", err)
+
+		// Twenty customers race for five books.
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		outcomes := make(map[string]int)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := s.PlaceOrder("alice", []ordering.Line{{SKU: "book", Quantity: 1}})
+				outcome := "placed"
+				switch {
+				case errors.Is(err, ordering.ErrConflict):
+					outcome = "conflict"
+				case err != nil:
+					outcome = "rejected"
+				}
+				mu.Lock()
+				outcomes[outcome]++
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+		fmt.Printf("  20 concurrent orders: %d placed, %d rejected, %d conflicts, %d books left\n",
+			outcomes["placed"], outcomes["rejected"], outcomes["conflict"], stock(d, "book"))
+	}
+}
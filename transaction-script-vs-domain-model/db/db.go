@@ -0,0 +1,189 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package db is a tiny in-memory database with tables of plain rows and
+// all-or-nothing updates. Both implementations of the workflow store their
+// data in it, the way two applications might share a SQL schema.
+package db
+
+import (
+	"fmt"
+	"sync"
+)
+
+type ProductRow struct {
+	SKU     string
+	Name    string
+	Price   int64
+	Stock   int
+	Version int
+}
+
+type CustomerRow struct {
+	ID          string
+	Name        string
+	CreditLimit int64
+	Balance     int64
+	Version     int
+}
+
+type LineRow struct {
+	SKU      string
+	Quantity int
+	Price    int64
+}
+
+type OrderRow struct {
+	ID       string
+	Customer string
+	Lines    []LineRow
+	Total    int64
+	Status   string
+	Version  int
+}
+
+type tables struct {
+	products  map[string]ProductRow
+	customers map[string]CustomerRow
+	orders    map[string]OrderRow
+	nextOrder int
+}
+
+func (t *tables) clone() *tables {
+	c := &tables{
+		products:  make(map[string]ProductRow, len(t.products)),
+		customers: make(map[string]CustomerRow, len(t.customers)),
+		orders:    make(map[string]OrderRow, len(t.orders)),
+		nextOrder: t.nextOrder,
+	}
+	for k, v := range t.products {
+		c.products[k] = v
+	}
+	for k, v := range t.customers {
+		c.customers[k] = v
+	}
+	for k, v := range t.orders {
+		c.orders[k] = v
+	}
+	return c
+}
+
+// DB is safe for concurrent use. Updates are serialized.
+type DB struct {
+	mu   sync.RWMutex
+	data *tables
+}
+
+func New() *DB {
+	return &DB{data: &tables{
+		products:  make(map[string]ProductRow),
+		customers: make(map[string]CustomerRow),
+		orders:    make(map[string]OrderRow),
+	}}
+}
+
+// Tx gives access to the tables inside View or Update. Rows are values, so
+// changing one has no effect until it is put back.
+type Tx struct {
+	data     *tables
+	writable bool
+}
+
+// View runs fn with a read-only transaction.
+func (db *DB) View(fn func(tx *Tx) error) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return fn(&Tx{data: db.data})
+}
+
+// Update runs fn with a writable transaction. Its changes are kept if fn
+// returns nil and discarded otherwise.
+func (db *DB) Update(fn func(tx *Tx) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tx := &Tx{data: db.data.clone(), writable: true}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	db.data = tx.data
+	return nil
+}
+
+func (tx *Tx) Product(sku string) (ProductRow, bool) {
+	row, ok := tx.data.products[sku]
+	return row, ok
+}
+
+func (tx *Tx) Customer(id string) (CustomerRow, bool) {
+	row, ok := tx.data.customers[id]
+	return row, ok
+}
+
+func (tx *Tx) Order(id string) (OrderRow, bool) {
+	row, ok := tx.data.orders[id]
+	if ok {
+		row.Lines = append([]LineRow(nil), row.Lines...)
+	}
+	return row, ok
+}
+
+// The Put methods store a row and bump its version.
+
+func (tx *Tx) PutProduct(row ProductRow) {
+	tx.mustWrite()
+	row.Version++
+	tx.data.products[row.SKU] = row
+}
+
+func (tx *Tx) PutCustomer(row CustomerRow) {
+	tx.mustWrite()
+	row.Version++
+	tx.data.customers[row.ID] = row
+}
+
+func (tx *Tx) PutOrder(row OrderRow) {
+	tx.mustWrite()
+	row.Version++
+	row.Lines = append([]LineRow(nil), row.Lines...)
+	tx.data.orders[row.ID] = row
+}
+
+// NextOrderID hands out order IDs.
+func (tx *Tx) NextOrderID() string {
+	tx.mustWrite()
+	tx.data.nextOrder++
+	return fmt.Sprintf("order-%d", tx.data.nextOrder)
+}
+
+func (tx *Tx) mustWrite() {
+	if !tx.writable {
+		panic("db: write in a read-only transaction")
+	}
+}
@@ -0,0 +1,171 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package domainmodel implements the ordering workflow as a domain model:
+// products, customers and orders are objects that guard their own rules,
+// loaded and saved by a unit of work. The service only coordinates them.
+package domainmodel
+
+import (
+	"fmt"
+
+	"github.com/rajamummidi/go-design-patterns/transaction-script-vs-domain-model/ordering"
+)
+
+type Product struct {
+	sku   string
+	price int64
+	stock int
+}
+
+func (p *Product) SKU() string  { return p.sku }
+func (p *Product) Price() int64 { return p.price }
+
+// Reserve takes quantity items out of stock for an order.
+func (p *Product) Reserve(quantity int) error {
+	if quantity <= 0 {
+		return ordering.ErrInvalidQuantity
+	}
+	if p.stock < quantity {
+		return fmt.Errorf("%s: %w", p.sku, ordering.ErrOutOfStock)
+	}
+	p.stock -= quantity
+	return nil
+}
+
+// Release puts reserved items back into stock.
+func (p *Product) Release(quantity int) {
+	p.stock += quantity
+}
+
+type Customer struct {
+	id          string
+	creditLimit int64
+	balance     int64
+}
+
+func (c *Customer) ID() string { return c.id }
+
+// Charge adds amount to the customer's balance, within the credit limit.
+func (c *Customer) Charge(amount int64) error {
+	if c.balance+amount > c.creditLimit {
+		return ordering.ErrCreditLimit
+	}
+	c.balance += amount
+	return nil
+}
+
+func (c *Customer) Refund(amount int64) {
+	c.balance -= amount
+}
+
+type line struct {
+	sku      string
+	quantity int
+	price    int64
+}
+
+// Order is the aggregate root of an order and its lines. Its total is
+// fixed when it is placed, so later price changes do not affect it.
+type Order struct {
+	id       string
+	customer string
+	lines    []line
+	total    int64
+	status   ordering.Status
+}
+
+// NewOrder starts an empty order; it gets its ID when it is saved.
+func NewOrder(customer *Customer) *Order {
+	return &Order{customer: customer.ID()}
+}
+
+func (o *Order) ID() string { return o.id }
+
+// AddLine reserves quantity items of product for the order.
+func (o *Order) AddLine(product *Product, quantity int) error {
+	if o.status != "" {
+		return fmt.Errorf("order %s is %s", o.id, o.status)
+	}
+	if err := product.Reserve(quantity); err != nil {
+		return err
+	}
+	o.lines = append(o.lines, line{sku: product.SKU(), quantity: quantity, price: product.Price()})
+	return nil
+}
+
+// Place fixes the total, discount included, and charges it to customer.
+func (o *Order) Place(customer *Customer) error {
+	if len(o.lines) == 0 {
+		return ordering.ErrEmptyOrder
+	}
+	var total int64
+	for _, l := range o.lines {
+		total += l.price * int64(l.quantity)
+	}
+	if total >= ordering.DiscountThreshold {
+		total -= total * ordering.Discount / 100
+	}
+	if err := customer.Charge(total); err != nil {
+		return err
+	}
+	o.total = total
+	o.status = ordering.Placed
+	return nil
+}
+
+// Cancel returns the reserved items through release and refunds customer.
+func (o *Order) Cancel(customer *Customer, release func(sku string, quantity int) error) error {
+	if o.status != ordering.Placed {
+		return ordering.ErrNotCancellable
+	}
+	for _, l := range o.lines {
+		if err := release(l.sku, l.quantity); err != nil {
+			return err
+		}
+	}
+	customer.Refund(o.total)
+	o.status = ordering.Cancelled
+	return nil
+}
+
+func (o *Order) Ship() error {
+	if o.status != ordering.Placed {
+		return ordering.ErrNotShippable
+	}
+	o.status = ordering.Shipped
+	return nil
+}
+
+func (o *Order) View() ordering.OrderView {
+	view := ordering.OrderView{ID: o.id, Customer: o.customer, Total: o.total, Status: o.status}
+	for _, l := range o.lines {
+		view.Lines = append(view.Lines, ordering.Line{SKU: l.sku, Quantity: l.quantity})
+	}
+	return view
+}
@@ -0,0 +1,114 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package domainmodel
+
+import (
+	"github.com/rajamummidi/go-design-patterns/transaction-script-vs-domain-model/db"
+	"github.com/rajamummidi/go-design-patterns/transaction-script-vs-domain-model/ordering"
+)
+
+// Service is the application service: each method loads the objects of one
+// use case, lets them do the work and commits the unit of work.
+type Service struct {
+	db *db.DB
+}
+
+func New(database *db.DB) *Service {
+	return &Service{db: database}
+}
+
+func (s *Service) PlaceOrder(customerID string, lines []ordering.Line) (string, error) {
+	uow := NewUnitOfWork(s.db)
+	customer, err := uow.Customer(customerID)
+	if err != nil {
+		return "", err
+	}
+	order := NewOrder(customer)
+	for _, l := range lines {
+		product, err := uow.Product(l.SKU)
+		if err != nil {
+			return "", err
+		}
+		if err := order.AddLine(product, l.Quantity); err != nil {
+			return "", err
+		}
+	}
+	if err := order.Place(customer); err != nil {
+		return "", err
+	}
+	uow.AddOrder(order)
+	if err := uow.Commit(); err != nil {
+		return "", err
+	}
+	return order.ID(), nil
+}
+
+func (s *Service) CancelOrder(id string) error {
+	uow := NewUnitOfWork(s.db)
+	order, err := uow.Order(id)
+	if err != nil {
+		return err
+	}
+	customer, err := uow.Customer(order.customer)
+	if err != nil {
+		return err
+	}
+	release := func(sku string, quantity int) error {
+		product, err := uow.Product(sku)
+		if err != nil {
+			return err
+		}
+		product.Release(quantity)
+		return nil
+	}
+	if err := order.Cancel(customer, release); err != nil {
+		return err
+	}
+	return uow.Commit()
+}
+
+func (s *Service) ShipOrder(id string) error {
+	uow := NewUnitOfWork(s.db)
+	order, err := uow.Order(id)
+	if err != nil {
+		return err
+	}
+	if err := order.Ship(); err != nil {
+		return err
+	}
+	return uow.Commit()
+}
+
+func (s *Service) Order(id string) (ordering.OrderView, error) {
+	order, err := NewUnitOfWork(s.db).Order(id)
+	if err != nil {
+		return ordering.OrderView{}, err
+	}
+	return order.View(), nil
+}
@@ -0,0 +1,170 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package domainmodel
+
+import (
+	"fmt"
+
+	"github.com/rajamummidi/go-design-patterns/transaction-script-vs-domain-model/db"
+	"github.com/rajamummidi/go-design-patterns/transaction-script-vs-domain-model/ordering"
+)
+
+// UnitOfWork loads the objects a use case needs, keeps one instance per
+// row (an identity map), and saves all of them in one transaction on
+// Commit. Rows are read without holding a lock, so Commit checks that none
+// of them changed in the meantime and fails with ordering.ErrConflict if
+// one did.
+type UnitOfWork struct {
+	db *db.DB
+
+	products  map[string]*Product
+	customers map[string]*Customer
+	orders    map[string]*Order
+	added     []*Order
+
+	// versions holds the row version each object was loaded at.
+	versions map[interface{}]int
+}
+
+func NewUnitOfWork(database *db.DB) *UnitOfWork {
+	return &UnitOfWork{
+		db:        database,
+		products:  make(map[string]*Product),
+		customers: make(map[string]*Customer),
+		orders:    make(map[string]*Order),
+		versions:  make(map[interface{}]int),
+	}
+}
+
+// Product is the product repository.
+func (u *UnitOfWork) Product(sku string) (*Product, error) {
+	if p, ok := u.products[sku]; ok {
+		return p, nil
+	}
+	var row db.ProductRow
+	var found bool
+	u.db.View(func(tx *db.Tx) error {
+		row, found = tx.Product(sku)
+		return nil
+	})
+	if !found {
+		return nil, fmt.Errorf("product %s: %w", sku, ordering.ErrNotFound)
+	}
+	p := &Product{sku: row.SKU, price: row.Price, stock: row.Stock}
+	u.products[sku] = p
+	u.versions[p] = row.Version
+	return p, nil
+}
+
+// Customer is the customer repository.
+func (u *UnitOfWork) Customer(id string) (*Customer, error) {
+	if c, ok := u.customers[id]; ok {
+		return c, nil
+	}
+	var row db.CustomerRow
+	var found bool
+	u.db.View(func(tx *db.Tx) error {
+		row, found = tx.Customer(id)
+		return nil
+	})
+	if !found {
+		return nil, fmt.Errorf("customer %s: %w", id, ordering.ErrNotFound)
+	}
+	c := &Customer{id: row.ID, creditLimit: row.CreditLimit, balance: row.Balance}
+	u.customers[id] = c
+	u.versions[c] = row.Version
+	return c, nil
+}
+
+// Order is the order repository.
+func (u *UnitOfWork) Order(id string) (*Order, error) {
+	if o, ok := u.orders[id]; ok {
+		return o, nil
+	}
+	var row db.OrderRow
+	var found bool
+	u.db.View(func(tx *db.Tx) error {
+		row, found = tx.Order(id)
+		return nil
+	})
+	if !found {
+		return nil, fmt.Errorf("order %s: %w", id, ordering.ErrNotFound)
+	}
+	o := &Order{id: row.ID, customer: row.Customer, total: row.Total, status: ordering.Status(row.Status)}
+	for _, l := range row.Lines {
+		o.lines = append(o.lines, line{sku: l.SKU, quantity: l.Quantity, price: l.Price})
+	}
+	u.orders[id] = o
+	u.versions[o] = row.Version
+	return o, nil
+}
+
+// AddOrder registers a new order to be inserted on Commit.
+func (u *UnitOfWork) AddOrder(o *Order) {
+	u.added = append(u.added, o)
+}
+
+// Commit saves every loaded and added object. New orders get their IDs.
+func (u *UnitOfWork) Commit() error {
+	return u.db.Update(func(tx *db.Tx) error {
+		for sku, p := range u.products {
+			row, _ := tx.Product(sku)
+			if row.Version != u.versions[p] {
+				return ordering.ErrConflict
+			}
+			row.Stock = p.stock
+			tx.PutProduct(row)
+		}
+		for id, c := range u.customers {
+			row, _ := tx.Customer(id)
+			if row.Version != u.versions[c] {
+				return ordering.ErrConflict
+			}
+			row.Balance = c.balance
+			tx.PutCustomer(row)
+		}
+		for id, o := range u.orders {
+			row, _ := tx.Order(id)
+			if row.Version != u.versions[o] {
+				return ordering.ErrConflict
+			}
+			row.Status = string(o.status)
+			tx.PutOrder(row)
+		}
+		for _, o := range u.added {
+			o.id = tx.NextOrderID()
+			row := db.OrderRow{ID: o.id, Customer: o.customer, Total: o.total, Status: string(o.status)}
+			for _, l := range o.lines {
+				row.Lines = append(row.Lines, db.LineRow{SKU: l.sku, Quantity: l.quantity, Price: l.price})
+			}
+			tx.PutOrder(row)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,3 @@
+module github.com/rajamummidi/go-design-patterns/transaction-script-vs-domain-model
+
+go 1.20
@@ -0,0 +1,87 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package ordering is the contract both implementations of the ordering
+// workflow fulfil, so the same scenarios can be run against either.
+package ordering
+
+import "errors"
+
+var (
+	ErrNotFound        = errors.New("ordering: not found")
+	ErrEmptyOrder      = errors.New("ordering: order has no lines")
+	ErrInvalidQuantity = errors.New("ordering: quantity must be positive")
+	ErrOutOfStock      = errors.New("ordering: out of stock")
+	ErrCreditLimit     = errors.New("ordering: credit limit exceeded")
+	ErrNotCancellable  = errors.New("ordering: order can no longer be cancelled")
+	ErrNotShippable    = errors.New("ordering: order cannot be shipped")
+	// ErrConflict is returned when a concurrent change got in the way; the
+	// call can be retried.
+	ErrConflict = errors.New("ordering: concurrent update")
+)
+
+// Business rules shared by both implementations. Amounts are in cents.
+const (
+	// DiscountThreshold is the order total from which Discount applies.
+	DiscountThreshold = 100_00
+	// Discount is the percentage taken off large orders.
+	Discount = 5
+)
+
+// Status is where an order is in its life.
+type Status string
+
+const (
+	Placed    Status = "placed"
+	Shipped   Status = "shipped"
+	Cancelled Status = "cancelled"
+)
+
+type Line struct {
+	SKU      string
+	Quantity int
+}
+
+// OrderView is what callers get to see of an order.
+type OrderView struct {
+	ID       string
+	Customer string
+	Lines    []Line
+	Total    int64
+	Status   Status
+}
+
+// Service is the ordering workflow: placing an order reserves stock and
+// charges the customer's account, cancelling undoes both, and shipping
+// makes the order final.
+type Service interface {
+	PlaceOrder(customer string, lines []Line) (string, error)
+	CancelOrder(id string) error
+	ShipOrder(id string) error
+	Order(id string) (OrderView, error)
+}
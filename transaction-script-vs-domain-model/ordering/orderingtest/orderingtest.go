@@ -0,0 +1,182 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package orderingtest is the conformance suite of ordering.Service. Every
+// implementation runs the same scenarios, each against a freshly seeded
+// database, which is what makes the implementations comparable:
+//
+//	func TestConformance(t *testing.T) {
+//		orderingtest.Run(t, func(d *db.DB) ordering.Service { return transactionscript.New(d) })
+//	}
+package orderingtest
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/rajamummidi/go-design-patterns/transaction-script-vs-domain-model/db"
+	"github.com/rajamummidi/go-design-patterns/transaction-script-vs-domain-model/ordering"
+)
+
+// Seed fills a fresh database with the data every scenario starts from.
+func Seed() *db.DB {
+	d := db.New()
+	d.Update(func(tx *db.Tx) error {
+		tx.PutProduct(db.ProductRow{SKU: "pen", Name: "Pen", Price: 2_50, Stock: 100})
+		tx.PutProduct(db.ProductRow{SKU: "book", Name: "Book", Price: 40_00, Stock: 5})
+		tx.PutProduct(db.ProductRow{SKU: "lamp", Name: "Lamp", Price: 80_00, Stock: 2})
+		tx.PutCustomer(db.CustomerRow{ID: "alice", Name: "Alice", CreditLimit: 500_00})
+		tx.PutCustomer(db.CustomerRow{ID: "bob", Name: "Bob", CreditLimit: 50_00})
+		return nil
+	})
+	return d
+}
+
+func stock(d *db.DB, sku string) int {
+	var row db.ProductRow
+	d.View(func(tx *db.Tx) error { row, _ = tx.Product(sku); return nil })
+	return row.Stock
+}
+
+func balance(d *db.DB, customer string) int64 {
+	var row db.CustomerRow
+	d.View(func(tx *db.Tx) error { row, _ = tx.Customer(customer); return nil })
+	return row.Balance
+}
+
+func expect(t *testing.T, what string, got, want interface{}) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+// scenarios describe the workflow's behaviour. Every implementation has to
+// pass all of them, which is what makes the two comparable.
+var scenarios = []struct {
+	name string
+	run  func(t *testing.T, s ordering.Service, d *db.DB)
+}{
+	{"placing an order reserves stock and charges the customer", func(t *testing.T, s ordering.Service, d *db.DB) {
+		id, err := s.PlaceOrder("alice", []ordering.Line{{SKU: "pen", Quantity: 4}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		order, err := s.Order(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect(t, "total", order.Total, int64(10_00))
+		expect(t, "status", order.Status, ordering.Placed)
+		expect(t, "stock", stock(d, "pen"), 96)
+		expect(t, "balance", balance(d, "alice"), int64(10_00))
+	}},
+	{"large orders get a discount", func(t *testing.T, s ordering.Service, d *db.DB) {
+		id, err := s.PlaceOrder("alice", []ordering.Line{{SKU: "book", Quantity: 3}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		order, _ := s.Order(id)
+		expect(t, "total", order.Total, int64(114_00))
+	}},
+	{"orders over the credit limit are rejected", func(t *testing.T, s ordering.Service, d *db.DB) {
+		_, err := s.PlaceOrder("bob", []ordering.Line{{SKU: "lamp", Quantity: 1}})
+		expect(t, "error", errors.Is(err, ordering.ErrCreditLimit), true)
+		expect(t, "stock", stock(d, "lamp"), 2)
+		expect(t, "balance", balance(d, "bob"), int64(0))
+	}},
+	{"an order is placed completely or not at all", func(t *testing.T, s ordering.Service, d *db.DB) {
+		_, err := s.PlaceOrder("alice", []ordering.Line{{SKU: "pen", Quantity: 1}, {SKU: "lamp", Quantity: 3}})
+		expect(t, "error", errors.Is(err, ordering.ErrOutOfStock), true)
+		expect(t, "pen stock", stock(d, "pen"), 100)
+	}},
+	{"empty orders and bad quantities are rejected", func(t *testing.T, s ordering.Service, d *db.DB) {
+		_, empty := s.PlaceOrder("alice", nil)
+		_, negative := s.PlaceOrder("alice", []ordering.Line{{SKU: "pen", Quantity: -1}})
+		_, unknown := s.PlaceOrder("carol", []ordering.Line{{SKU: "pen", Quantity: 1}})
+		expect(t, "empty", errors.Is(empty, ordering.ErrEmptyOrder), true)
+		expect(t, "negative", errors.Is(negative, ordering.ErrInvalidQuantity), true)
+		expect(t, "unknown customer", errors.Is(unknown, ordering.ErrNotFound), true)
+	}},
+	{"cancelling returns the stock and refunds the customer", func(t *testing.T, s ordering.Service, d *db.DB) {
+		id, err := s.PlaceOrder("alice", []ordering.Line{{SKU: "lamp", Quantity: 2}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.CancelOrder(id); err != nil {
+			t.Fatal(err)
+		}
+		order, _ := s.Order(id)
+		expect(t, "status", order.Status, ordering.Cancelled)
+		expect(t, "stock", stock(d, "lamp"), 2)
+		expect(t, "balance", balance(d, "alice"), int64(0))
+		expect(t, "cancel twice", errors.Is(s.CancelOrder(id), ordering.ErrNotCancellable), true)
+	}},
+	{"shipped orders cannot be cancelled", func(t *testing.T, s ordering.Service, d *db.DB) {
+		id, err := s.PlaceOrder("alice", []ordering.Line{{SKU: "pen", Quantity: 1}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.ShipOrder(id); err != nil {
+			t.Fatal(err)
+		}
+		expect(t, "cancel", errors.Is(s.CancelOrder(id), ordering.ErrNotCancellable), true)
+	}},
+	{"concurrent orders never oversell", func(t *testing.T, s ordering.Service, d *db.DB) {
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		placed := 0
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := s.PlaceOrder("alice", []ordering.Line{{SKU: "book", Quantity: 1}}); err == nil {
+					mu.Lock()
+					placed++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		expect(t, "stock", stock(d, "book"), 5-placed)
+		expect(t, "balance", balance(d, "alice"), int64(placed)*40_00)
+	}},
+}
+
+// Run runs every scenario as a subtest against a service that newService
+// builds on a freshly seeded database.
+func Run(t *testing.T, newService func(d *db.DB) ordering.Service) {
+	for _, sc := range scenarios {
+		sc := sc
+		t.Run(sc.name, func(t *testing.T) {
+			d := Seed()
+			sc.run(t, newService(d), d)
+		})
+	}
+}
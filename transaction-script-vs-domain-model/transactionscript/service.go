@@ -0,0 +1,157 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package transactionscript implements the ordering workflow as a
+// transaction script: one procedure per use case that reads the rows it
+// needs, applies the business rules inline and writes the rows back, all
+// inside a single database transaction.
+package transactionscript
+
+import (
+	"fmt"
+
+	"github.com/rajamummidi/go-design-patterns/transaction-script-vs-domain-model/db"
+	"github.com/rajamummidi/go-design-patterns/transaction-script-vs-domain-model/ordering"
+)
+
+type Service struct {
+	db *db.DB
+}
+
+func New(database *db.DB) *Service {
+	return &Service{db: database}
+}
+
+func (s *Service) PlaceOrder(customerID string, lines []ordering.Line) (string, error) {
+	var id string
+	err := s.db.Update(func(tx *db.Tx) error {
+		if len(lines) == 0 {
+			return ordering.ErrEmptyOrder
+		}
+		customer, ok := tx.Customer(customerID)
+		if !ok {
+			return fmt.Errorf("customer %s: %w", customerID, ordering.ErrNotFound)
+		}
+
+		var total int64
+		rows := make([]db.LineRow, 0, len(lines))
+		for _, line := range lines {
+			if line.Quantity <= 0 {
+				return ordering.ErrInvalidQuantity
+			}
+			product, ok := tx.Product(line.SKU)
+			if !ok {
+				return fmt.Errorf("product %s: %w", line.SKU, ordering.ErrNotFound)
+			}
+			if product.Stock < line.Quantity {
+				return fmt.Errorf("%s: %w", line.SKU, ordering.ErrOutOfStock)
+			}
+			product.Stock -= line.Quantity
+			tx.PutProduct(product)
+
+			total += product.Price * int64(line.Quantity)
+			rows = append(rows, db.LineRow{SKU: line.SKU, Quantity: line.Quantity, Price: product.Price})
+		}
+		if total >= ordering.DiscountThreshold {
+			total -= total * ordering.Discount / 100
+		}
+
+		if customer.Balance+total > customer.CreditLimit {
+			return ordering.ErrCreditLimit
+		}
+		customer.Balance += total
+		tx.PutCustomer(customer)
+
+		id = tx.NextOrderID()
+		tx.PutOrder(db.OrderRow{
+			ID:       id,
+			Customer: customerID,
+			Lines:    rows,
+			Total:    total,
+			Status:   string(ordering.Placed),
+		})
+		return nil
+	})
+	return id, err
+}
+
+func (s *Service) CancelOrder(id string) error {
+	return s.db.Update(func(tx *db.Tx) error {
+		order, ok := tx.Order(id)
+		if !ok {
+			return fmt.Errorf("order %s: %w", id, ordering.ErrNotFound)
+		}
+		if order.Status != string(ordering.Placed) {
+			return ordering.ErrNotCancellable
+		}
+
+		for _, line := range order.Lines {
+			product, _ := tx.Product(line.SKU)
+			product.Stock += line.Quantity
+			tx.PutProduct(product)
+		}
+		customer, _ := tx.Customer(order.Customer)
+		customer.Balance -= order.Total
+		tx.PutCustomer(customer)
+
+		order.Status = string(ordering.Cancelled)
+		tx.PutOrder(order)
+		return nil
+	})
+}
+
+func (s *Service) ShipOrder(id string) error {
+	return s.db.Update(func(tx *db.Tx) error {
+		order, ok := tx.Order(id)
+		if !ok {
+			return fmt.Errorf("order %s: %w", id, ordering.ErrNotFound)
+		}
+		if order.Status != string(ordering.Placed) {
+			return ordering.ErrNotShippable
+		}
+		order.Status = string(ordering.Shipped)
+		tx.PutOrder(order)
+		return nil
+	})
+}
+
+func (s *Service) Order(id string) (ordering.OrderView, error) {
+	var view ordering.OrderView
+	err := s.db.View(func(tx *db.Tx) error {
+		order, ok := tx.Order(id)
+		if !ok {
+			return fmt.Errorf("order %s: %w", id, ordering.ErrNotFound)
+		}
+		view = ordering.OrderView{ID: order.ID, Customer: order.Customer, Total: order.Total, Status: ordering.Status(order.Status)}
+		for _, line := range order.Lines {
+			view.Lines = append(view.Lines, ordering.Line{SKU: line.SKU, Quantity: line.Quantity})
+		}
+		return nil
+	})
+	return view, err
+}
@@ -0,0 +1,180 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/retry/retry"
+	"github.com/rajamummidi/go-design-patterns/workflow/workflow"
+)
+
+// Order is the input of the fulfilment workflow.
+type Order struct {
+	ID     string
+	Item   string
+	Amount int64
+	Card   string
+}
+
+// Services the workflow talks to. The bank is down for the first two
+// charges and the courier hangs on its first booking; a slow courier keeps
+// an order in the middle of the workflow long enough to be interrupted.
+var (
+	charges      atomic.Int64
+	bookings     atomic.Int64
+	slowCouriers atomic.Bool
+)
+
+func fulfilment() workflow.Workflow {
+	return workflow.Workflow{
+		Name: "fulfil-order",
+		Steps: []workflow.Step{
+			{Name: "validate", Run: validate},
+			workflow.Parallel("prepare",
+				workflow.Step{Name: "reserve-stock", Run: reserve},
+				workflow.Step{
+					Name:  "charge-card",
+					Run:   charge,
+					Retry: retry.Policy{MaxAttempts: 4, InitialDelay: 20 * time.Millisecond},
+				},
+				workflow.Step{
+					Name:    "book-courier",
+					Run:     book,
+					Retry:   retry.Policy{MaxAttempts: 2, InitialDelay: 10 * time.Millisecond},
+					Timeout: 50 * time.Millisecond,
+				},
+			),
+			{Name: "confirm", Run: confirm, Retry: retry.Policy{MaxAttempts: 1}},
+		},
+	}
+}
+
+func validate(ctx context.Context, s *workflow.Scope) (any, error) {
+	var order Order
+	if err := s.Input(&order); err != nil {
+		return nil, retry.Permanent(err)
+	}
+	fmt.Printf("  validate: %s for %d\n", order.Item, order.Amount)
+	return nil, nil
+}
+
+func reserve(ctx context.Context, s *workflow.Scope) (any, error) {
+	var order Order
+	s.Input(&order)
+	fmt.Printf("  reserve-stock: one %s\n", order.Item)
+	return "shelf-7", nil
+}
+
+func charge(ctx context.Context, s *workflow.Scope) (any, error) {
+	var order Order
+	s.Input(&order)
+	if order.Card == "0000" {
+		fmt.Printf("  charge-card: attempt %d, declined\n", s.Attempt())
+		return nil, retry.Permanent(errors.New("card declined"))
+	}
+	if n := charges.Add(1); n <= 2 {
+		fmt.Printf("  charge-card: attempt %d, bank unavailable\n", s.Attempt())
+		return nil, errors.New("bank unavailable")
+	}
+	fmt.Printf("  charge-card: attempt %d, charged %d\n", s.Attempt(), order.Amount)
+	return fmt.Sprintf("pay-%s", order.ID), nil
+}
+
+func book(ctx context.Context, s *workflow.Scope) (any, error) {
+	var order Order
+	s.Input(&order)
+	if bookings.Add(1) == 1 || slowCouriers.Load() {
+		fmt.Printf("  book-courier: attempt %d, waiting for the courier\n", s.Attempt())
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	fmt.Printf("  book-courier: attempt %d, booked\n", s.Attempt())
+	return fmt.Sprintf("TRK-%s", order.ID), nil
+}
+
+func confirm(ctx context.Context, s *workflow.Scope) (any, error) {
+	var payment, tracking string
+	if err := s.Output("charge-card", &payment); err != nil {
+		return nil, err
+	}
+	if err := s.Output("book-courier", &tracking); err != nil {
+		return nil, err
+	}
+	fmt.Printf("  confirm: paid with %s, shipped as %s\n", payment, tracking)
+	return nil, nil
+}
+
+func main() {
+	dir, err := os.MkdirTemp("", "workflow")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	repo, err := workflow.OpenFileRepository(dir)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	engine, err := workflow.New(fulfilment(), repo)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	report := func(run workflow.Run, err error) {
+		fmt.Printf("  => %s, attempts %v, error: %v\n\n", run.Status, run.Attempts, err)
+	}
+
+	fmt.Println("order-1: the bank and the courier fail at first")
+	report(engine.Start(context.Background(), "order-1", Order{ID: "order-1", Item: "book", Amount: 25_00, Card: "4242"}))
+
+	fmt.Println("order-2: the card is declined, which no retry changes")
+	report(engine.Start(context.Background(), "order-2", Order{ID: "order-2", Item: "lamp", Amount: 40_00, Card: "0000"}))
+
+	// The process "crashes" while the courier is slow. The repository has
+	// what the other steps did, and a new engine, as after a restart, picks
+	// the run up again without reserving or charging a second time.
+	fmt.Println("order-3: the process stops while the courier is slow")
+	slowCouriers.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	report(engine.Start(ctx, "order-3", Order{ID: "order-3", Item: "book", Amount: 25_00, Card: "4242"}))
+	cancel()
+	slowCouriers.Store(false)
+
+	fmt.Println("order-3: resuming after a restart")
+	restarted, _ := workflow.New(fulfilment(), repo)
+	report(restarted.Resume(context.Background(), "order-3"))
+}
@@ -0,0 +1,177 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+package workflow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by Repository.Load for a run it does not have.
+var ErrNotFound = errors.New("workflow: run not found")
+
+// Status says how far a run got.
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+)
+
+// Run is the durable progress of one workflow: its input, the output of
+// every step that completed and how often each step was attempted. A run
+// that was interrupted while running is still StatusRunning when it is
+// loaded again.
+type Run struct {
+	ID       string                     `json:"id"`
+	Workflow string                     `json:"workflow"`
+	Status   Status                     `json:"status"`
+	Input    json.RawMessage            `json:"input"`
+	Outputs  map[string]json.RawMessage `json:"outputs"`
+	Attempts map[string]int             `json:"attempts"`
+	Error    string                     `json:"error,omitempty"`
+	Started  time.Time                  `json:"started"`
+	Updated  time.Time                  `json:"updated"`
+}
+
+func (r Run) clone() Run {
+	r.Outputs = maps.Clone(r.Outputs)
+	r.Attempts = maps.Clone(r.Attempts)
+	return r
+}
+
+// Repository keeps the runs of an engine. Save replaces the run with the
+// same ID. Implementations must be safe for concurrent use.
+type Repository interface {
+	Save(run Run) error
+	Load(id string) (Run, error)
+}
+
+// MemoryRepository keeps runs in memory. It survives an interrupted run,
+// but not the process.
+type MemoryRepository struct {
+	mu   sync.Mutex
+	runs map[string]Run
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{runs: make(map[string]Run)}
+}
+
+func (r *MemoryRepository) Save(run Run) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.runs[run.ID] = run.clone()
+	return nil
+}
+
+func (r *MemoryRepository) Load(id string) (Run, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	run, ok := r.runs[id]
+	if !ok {
+		return Run{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return run.clone(), nil
+}
+
+// FileRepository keeps every run in a JSON file of its own in a directory.
+// A run is written to a temporary file that is synced and then renamed
+// over the old one, so a crash leaves either the old or the new progress
+// on disk, never half of it.
+type FileRepository struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// OpenFileRepository returns a repository in dir, creating dir if needed.
+func OpenFileRepository(dir string) (*FileRepository, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileRepository{dir: dir}, nil
+}
+
+func (r *FileRepository) path(id string) string {
+	return filepath.Join(r.dir, filepath.Base(id)+".json")
+}
+
+func (r *FileRepository) Save(run Run) error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tmp, err := os.CreateTemp(r.dir, "run-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path(run.ID))
+}
+
+func (r *FileRepository) Load(id string) (Run, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := os.ReadFile(r.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return Run{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return Run{}, err
+	}
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return Run{}, fmt.Errorf("%s: %w", r.path(id), err)
+	}
+	return run, nil
+}
@@ -0,0 +1,356 @@
+/*
+**************************************************************************************
+*
+This project is licensed under the MIT license.
+MIT License
+
+# Copyright (c) 2023 Raja Manohar
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+*
+**************************************************************************************
+*/
+// Package workflow runs multi-step business processes whose progress
+// survives the process that runs them. A workflow is a sequence of steps,
+// some of which may be groups of steps that run in parallel. Every step
+// has its own retry and timeout policy, and the output of every step that
+// succeeded is saved in a Repository as soon as it is known, so a workflow
+// that was interrupted continues where it stopped instead of starting over.
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rajamummidi/go-design-patterns/retry/retry"
+)
+
+var (
+	// ErrInterrupted is returned when ctx ended during a run. The run is
+	// saved as it is and can be continued with Resume.
+	ErrInterrupted = errors.New("workflow: interrupted")
+	// ErrFinished is returned by Resume for a run that already completed.
+	ErrFinished = errors.New("workflow: already finished")
+	// ErrTimeout is returned by an attempt of a step that took longer than
+	// the step's Timeout. Unlike an ended context, it is retried.
+	ErrTimeout = errors.New("workflow: step timed out")
+	// ErrNoOutput is returned by Scope.Output for a step that has not
+	// completed.
+	ErrNoOutput = errors.New("workflow: step has no output")
+)
+
+// Step is one step of a workflow: a task with Run, or a group of steps
+// that run in parallel with Parallel. A step name must be unique within
+// its workflow, because the outputs of the steps are saved by name.
+type Step struct {
+	Name string
+	// Run does the work of the step and returns its output, which is saved
+	// as JSON. It may run again when a run is resumed, so it should be
+	// idempotent.
+	Run func(ctx context.Context, s *Scope) (any, error)
+	// Parallel are the steps of a group. The group succeeds when they all
+	// succeed; the first that fails cancels the others.
+	Parallel []Step
+	// Retry says how often Run is attempted; zero fields take the defaults
+	// of the retry package, so a step is attempted three times unless its
+	// policy says otherwise.
+	Retry retry.Policy
+	// Timeout bounds each attempt of Run. Zero means no limit.
+	Timeout time.Duration
+}
+
+// Parallel returns a group of steps that run in parallel.
+func Parallel(name string, steps ...Step) Step {
+	return Step{Name: name, Parallel: steps}
+}
+
+// Workflow is the definition of a workflow: its steps in the order they
+// run.
+type Workflow struct {
+	Name  string
+	Steps []Step
+}
+
+// validate checks that every step is either a task or a group and that no
+// two steps share a name.
+func (w Workflow) validate() error {
+	names := make(map[string]bool)
+	var check func(steps []Step) error
+	check = func(steps []Step) error {
+		for _, step := range steps {
+			switch {
+			case step.Name == "":
+				return fmt.Errorf("workflow %s: step without a name", w.Name)
+			case names[step.Name]:
+				return fmt.Errorf("workflow %s: two steps named %s", w.Name, step.Name)
+			case (step.Run == nil) == (len(step.Parallel) == 0):
+				return fmt.Errorf("workflow %s: step %s needs either Run or Parallel", w.Name, step.Name)
+			}
+			names[step.Name] = true
+			if err := check(step.Parallel); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return check(w.Steps)
+}
+
+// Error is returned when a step failed after its last attempt. The run is
+// saved as failed and can be continued with Resume once the cause is
+// fixed.
+type Error struct {
+	Workflow string
+	Step     string
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("workflow %s: step %s failed: %v", e.Workflow, e.Step, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Engine runs the workflows of one definition and saves their progress in
+// a repository. It is safe for concurrent use.
+type Engine struct {
+	workflow Workflow
+	repo     Repository
+}
+
+// New returns an engine for w, or an error if w is not a valid definition.
+func New(w Workflow, repo Repository) (*Engine, error) {
+	if err := w.validate(); err != nil {
+		return nil, err
+	}
+	return &Engine{workflow: w, repo: repo}, nil
+}
+
+// Start begins the run id with input and runs it to the end. It returns the
+// run as it was last saved, and an *Error if a step failed.
+func (e *Engine) Start(ctx context.Context, id string, input any) (Run, error) {
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		return Run{}, err
+	}
+	now := time.Now()
+	run := Run{
+		ID:       id,
+		Workflow: e.workflow.Name,
+		Status:   StatusRunning,
+		Input:    encoded,
+		Outputs:  make(map[string]json.RawMessage),
+		Attempts: make(map[string]int),
+		Started:  now,
+		Updated:  now,
+	}
+	if err := e.repo.Save(run); err != nil {
+		return run, err
+	}
+	return e.execute(ctx, run)
+}
+
+// Resume continues the run id from the repository. The steps that
+// completed are skipped; the others run, including a step that failed.
+func (e *Engine) Resume(ctx context.Context, id string) (Run, error) {
+	run, err := e.repo.Load(id)
+	if err != nil {
+		return run, err
+	}
+	if run.Status == StatusCompleted {
+		return run, ErrFinished
+	}
+	run.Status = StatusRunning
+	run.Error = ""
+	if run.Outputs == nil {
+		run.Outputs = make(map[string]json.RawMessage)
+	}
+	if run.Attempts == nil {
+		run.Attempts = make(map[string]int)
+	}
+	return e.execute(ctx, run)
+}
+
+// execute runs the steps that have not completed and saves the outcome.
+func (e *Engine) execute(ctx context.Context, run Run) (Run, error) {
+	x := &execution{engine: e, run: run}
+	err := x.steps(ctx, e.workflow.Steps)
+
+	var stepErr *Error
+	switch {
+	case err == nil:
+		x.run.Status = StatusCompleted
+	case errors.As(err, &stepErr):
+		x.run.Status = StatusFailed
+		x.run.Error = err.Error()
+	case ctx.Err() != nil:
+		err = fmt.Errorf("%w: %v", ErrInterrupted, err)
+	}
+	x.run.Updated = time.Now()
+	if saveErr := e.repo.Save(x.run); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return x.run, err
+}
+
+// execution is one Start or Resume of a run. Steps of a group change the
+// run concurrently, so it is guarded by mu.
+type execution struct {
+	engine *Engine
+
+	mu  sync.Mutex
+	run Run
+}
+
+func (x *execution) steps(ctx context.Context, steps []Step) error {
+	for _, step := range steps {
+		if err := x.step(ctx, step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *execution) step(ctx context.Context, step Step) error {
+	if len(step.Parallel) > 0 {
+		return x.parallel(ctx, step.Parallel)
+	}
+
+	x.mu.Lock()
+	_, done := x.run.Outputs[step.Name]
+	x.mu.Unlock()
+	if done {
+		return nil
+	}
+
+	var output any
+	err := retry.Do(ctx, step.Retry, func(ctx context.Context) error {
+		x.mu.Lock()
+		x.run.Attempts[step.Name]++
+		attempt := x.run.Attempts[step.Name]
+		x.mu.Unlock()
+
+		var err error
+		output, err = x.attempt(ctx, step, &Scope{x: x, attempt: attempt})
+		return err
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		return &Error{Workflow: x.engine.workflow.Name, Step: step.Name, Err: err}
+	}
+
+	encoded, err := json.Marshal(output)
+	if err != nil {
+		return &Error{Workflow: x.engine.workflow.Name, Step: step.Name, Err: err}
+	}
+	return x.save(func(run *Run) { run.Outputs[step.Name] = encoded })
+}
+
+// attempt runs step once, within its timeout.
+func (x *execution) attempt(ctx context.Context, step Step, s *Scope) (any, error) {
+	if step.Timeout <= 0 {
+		return step.Run(ctx, s)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, step.Timeout)
+	defer cancel()
+
+	output, err := step.Run(attemptCtx, s)
+	if err != nil && ctx.Err() == nil && attemptCtx.Err() != nil {
+		return nil, fmt.Errorf("%w after %s", ErrTimeout, step.Timeout)
+	}
+	return output, err
+}
+
+// parallel runs steps at the same time. The first failure cancels the
+// others and is returned.
+func (x *execution) parallel(ctx context.Context, steps []Step) error {
+	groupCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg    sync.WaitGroup
+		once  sync.Once
+		first error
+	)
+	for _, step := range steps {
+		wg.Add(1)
+		go func(step Step) {
+			defer wg.Done()
+			if err := x.step(groupCtx, step); err != nil {
+				once.Do(func() {
+					first = err
+					cancel()
+				})
+			}
+		}(step)
+	}
+	wg.Wait()
+	return first
+}
+
+// save changes the run and saves it, so that the change survives a crash.
+func (x *execution) save(change func(run *Run)) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	change(&x.run)
+	x.run.Updated = time.Now()
+	return x.engine.repo.Save(x.run)
+}
+
+// Scope is what a step sees of its run: the input and the outputs of the
+// steps that completed.
+type Scope struct {
+	x       *execution
+	attempt int
+}
+
+// Input decodes the input of the run into v.
+func (s *Scope) Input(v any) error {
+	s.x.mu.Lock()
+	input := s.x.run.Input
+	s.x.mu.Unlock()
+	return json.Unmarshal(input, v)
+}
+
+// Output decodes the output of step into v. It returns ErrNoOutput if step
+// has not completed, such as a step of the same parallel group.
+func (s *Scope) Output(step string, v any) error {
+	s.x.mu.Lock()
+	output, ok := s.x.run.Outputs[step]
+	s.x.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoOutput, step)
+	}
+	return json.Unmarshal(output, v)
+}
+
+// Attempt is 1 on the first attempt of the step and grows with every
+// retry, across resumes.
+func (s *Scope) Attempt() int {
+	return s.attempt
+}